@@ -0,0 +1,237 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// AccelType is the qemu accelerator type.
+type AccelType string
+
+const (
+	// AccelKVM is the Linux KVM accelerator.
+	AccelKVM AccelType = "kvm"
+
+	// AccelTCG is the qemu binary translator.
+	AccelTCG AccelType = "tcg"
+
+	// AccelHVF is the macOS Hypervisor.framework accelerator.
+	AccelHVF AccelType = "hvf"
+
+	// AccelWHPX is the Windows Hypervisor Platform accelerator.
+	AccelWHPX AccelType = "whpx"
+)
+
+// Accel describes an -accel parameter. When several accelerators are
+// configured qemu uses the first one that is available on the host.
+type Accel struct {
+	// Type is the accelerator type.
+	Type AccelType `yaml:"type"`
+
+	// Thread is the tcg thread mode, single|multi.
+	Thread string `yaml:"thread"`
+
+	// TBSize is the tcg translation block cache size in MiB.
+	TBSize uint32 `yaml:"tb-size"`
+
+	// DirtyRingSize is the kvm dirty ring size, must be a power of 2.
+	DirtyRingSize uint32 `yaml:"dirty-ring-size"`
+
+	// KernelIRQChip controls the kvm in-kernel irqchip, on|off|split.
+	KernelIRQChip string `yaml:"kernel-irqchip"`
+
+	// NotifyVMExit is the kvm action on a guest stuck in a vm exit loop,
+	// run|internal-error|disable.
+	NotifyVMExit string `yaml:"notify-vmexit"`
+
+	// NotifyWindow is the number of cycles without a vm exit triggering
+	// the NotifyVMExit action.
+	NotifyWindow uint32 `yaml:"notify-window"`
+
+	// HaltPollNS is a hint for the kvm.halt_poll_ns module parameter, the
+	// time a halted vcpu polls for a wakeup before sleeping. It is not a
+	// qemu parameter, see ApplyKVMModuleParams.
+	HaltPollNS *uint32 `yaml:"halt-poll-ns"`
+
+	// IgnoreMSRs is a hint for the kvm.ignore_msrs module parameter,
+	// ignoring guest accesses to unhandled MSRs instead of injecting a
+	// fault. It is not a qemu parameter, see ApplyKVMModuleParams.
+	IgnoreMSRs bool `yaml:"ignore-msrs"`
+}
+
+// kvmModuleParamsDir is the sysfs directory of the kvm module parameters.
+var kvmModuleParamsDir = "/sys/module/kvm/parameters"
+
+// Valid returns an error if the Accel structure is not valid and complete.
+func (accel Accel) Valid() error {
+	switch accel.Type {
+	case AccelKVM, AccelTCG, AccelHVF, AccelWHPX:
+	case "":
+		return fmt.Errorf("Accel has empty Type field")
+	default:
+		return fmt.Errorf("Accel has unknown Type '%s'", accel.Type)
+	}
+
+	if accel.Type != AccelTCG && (accel.Thread != "" || accel.TBSize != 0) {
+		return fmt.Errorf("Accel Type=%s does not support Thread or TBSize, only %s does", accel.Type, AccelTCG)
+	}
+
+	switch accel.Thread {
+	case "", "single", "multi":
+	default:
+		return fmt.Errorf("Invalid Accel Thread value: '%s', must be one of 'single' or 'multi'", accel.Thread)
+	}
+
+	if accel.Type != AccelKVM && (accel.DirtyRingSize != 0 || accel.KernelIRQChip != "" ||
+		accel.NotifyVMExit != "" || accel.NotifyWindow != 0 || accel.HaltPollNS != nil || accel.IgnoreMSRs) {
+		return fmt.Errorf("Accel Type=%s does not support kvm tuning, only %s does", accel.Type, AccelKVM)
+	}
+
+	if accel.DirtyRingSize&(accel.DirtyRingSize-1) != 0 {
+		return fmt.Errorf("Accel DirtyRingSize %d must be a power of 2", accel.DirtyRingSize)
+	}
+
+	switch accel.KernelIRQChip {
+	case "", "on", "off", "split":
+	default:
+		return fmt.Errorf("Invalid Accel KernelIRQChip value: '%s', must be one of 'on', 'off', or 'split'", accel.KernelIRQChip)
+	}
+
+	switch accel.NotifyVMExit {
+	case "", "run", "internal-error", "disable":
+	default:
+		return fmt.Errorf("Invalid Accel NotifyVMExit value: '%s', must be one of 'run', 'internal-error', or 'disable'", accel.NotifyVMExit)
+	}
+
+	if accel.NotifyWindow != 0 && (accel.NotifyVMExit == "" || accel.NotifyVMExit == "disable") {
+		return fmt.Errorf("Accel NotifyWindow requires NotifyVMExit 'run' or 'internal-error'")
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the Accel.
+func (accel Accel) QemuParams() []string {
+	var accelParams []string
+
+	accelParams = append(accelParams, string(accel.Type))
+
+	if accel.Thread != "" {
+		accelParams = append(accelParams, fmt.Sprintf("thread=%s", accel.Thread))
+	}
+	if accel.TBSize > 0 {
+		accelParams = append(accelParams, fmt.Sprintf("tb-size=%d", accel.TBSize))
+	}
+	if accel.DirtyRingSize > 0 {
+		accelParams = append(accelParams, fmt.Sprintf("dirty-ring-size=%d", accel.DirtyRingSize))
+	}
+	if accel.KernelIRQChip != "" {
+		accelParams = append(accelParams, fmt.Sprintf("kernel-irqchip=%s", accel.KernelIRQChip))
+	}
+	if accel.NotifyVMExit != "" {
+		accelParams = append(accelParams, fmt.Sprintf("notify-vmexit=%s", accel.NotifyVMExit))
+	}
+	if accel.NotifyWindow > 0 {
+		accelParams = append(accelParams, fmt.Sprintf("notify-window=%d", accel.NotifyWindow))
+	}
+
+	return []string{"-accel", strings.Join(accelParams, ",")}
+}
+
+func (config *Config) appendAccels() error {
+	if len(config.Accels) == 0 {
+		return nil
+	}
+
+	if config.Machine.Acceleration != "" {
+		return fmt.Errorf("Machine.Acceleration and Accels are mutually exclusive")
+	}
+
+	var errors []string
+	var params []string
+	for _, accel := range config.Accels {
+		if err := accel.Valid(); err != nil {
+			errors = append(errors, err.Error())
+			continue
+		}
+		params = append(params, accel.QemuParams()...)
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Failed to append %d Accel(s):\n%s", len(errors), strings.Join(errors, "\n"))
+	}
+
+	config.qemuParams = append(config.qemuParams, params...)
+
+	return nil
+}
+
+// kvmModuleParams returns the kvm module parameter values hinted by the
+// Accel.
+func (accel Accel) kvmModuleParams() map[string]string {
+	params := make(map[string]string)
+
+	if accel.HaltPollNS != nil {
+		params["halt_poll_ns"] = strconv.FormatUint(uint64(*accel.HaltPollNS), 10)
+	}
+	if accel.IgnoreMSRs {
+		params["ignore_msrs"] = "Y"
+	}
+
+	return params
+}
+
+// ApplyKVMModuleParams writes the HaltPollNS and IgnoreMSRs hints of the kvm
+// Accels to the kvm module parameters of the host. The module parameters
+// are global to the host and require root to change, a differing value is
+// overwritten and a parameter already set to the hint is not written.
+func (config *Config) ApplyKVMModuleParams() error {
+	for _, accel := range config.Accels {
+		if accel.Type != AccelKVM {
+			continue
+		}
+
+		for name, value := range accel.kvmModuleParams() {
+			path := filepath.Join(kvmModuleParamsDir, name)
+			current, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("Failed to read kvm module parameter %s: %v", name, err)
+			}
+			if strings.TrimSpace(string(current)) == value {
+				continue
+			}
+			if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+				return fmt.Errorf("Failed to set kvm module parameter %s=%s: %v", name, value, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package qcli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	accelTCGString = "-accel tcg,thread=multi,tb-size=512"
+	accelKVMString = "-accel kvm,dirty-ring-size=4096,kernel-irqchip=split"
+
+	accelKVMNotifyString = "-accel kvm,notify-vmexit=run,notify-window=100"
+)
+
+func TestAppendAccel(t *testing.T) {
+	accel := Accel{
+		Type:   AccelTCG,
+		Thread: "multi",
+		TBSize: 512,
+	}
+	testAppend(accel, accelTCGString, t)
+
+	accel = Accel{
+		Type:          AccelKVM,
+		DirtyRingSize: 4096,
+		KernelIRQChip: "split",
+	}
+	testAppend(accel, accelKVMString, t)
+}
+
+func TestAppendAccelKVMNotifyVMExit(t *testing.T) {
+	// IgnoreMSRs is a kvm module parameter, not an -accel property
+	accel := Accel{
+		Type:         AccelKVM,
+		NotifyVMExit: "run",
+		NotifyWindow: 100,
+		IgnoreMSRs:   true,
+	}
+	testAppend(accel, accelKVMNotifyString, t)
+}
+
+func TestAppendAccelFallback(t *testing.T) {
+	c := &Config{
+		Machine: Machine{Type: MachineTypeVirt},
+		Accels:  []Accel{{Type: AccelHVF}, {Type: AccelTCG}},
+	}
+	testConfig(c, "-machine virt -accel hvf -accel tcg", t)
+}
+
+func TestBadAccel(t *testing.T) {
+	accels := []Accel{
+		{},
+		{Type: "qtest"},
+		{Type: AccelKVM, Thread: "multi"},
+		{Type: AccelTCG, Thread: "many"},
+		{Type: AccelWHPX, KernelIRQChip: "on"},
+		{Type: AccelKVM, DirtyRingSize: 1000},
+		{Type: AccelKVM, KernelIRQChip: "yes"},
+		{Type: AccelKVM, NotifyVMExit: "panic"},
+		{Type: AccelKVM, NotifyWindow: 100},
+		{Type: AccelKVM, NotifyVMExit: "disable", NotifyWindow: 100},
+		{Type: AccelTCG, IgnoreMSRs: true},
+	}
+	for _, accel := range accels {
+		if err := accel.Valid(); err == nil {
+			t.Errorf("Expected error for invalid Accel %+v", accel)
+		}
+	}
+
+	c := &Config{
+		Machine: Machine{Type: MachineTypePC35, Acceleration: MachineAccelerationKVM},
+		Accels:  []Accel{{Type: AccelKVM}},
+	}
+	if err := c.appendAccels(); err == nil {
+		t.Errorf("Expected error for Machine.Acceleration with Accels")
+	}
+}
+
+func TestApplyKVMModuleParams(t *testing.T) {
+	saved := kvmModuleParamsDir
+	defer func() { kvmModuleParamsDir = saved }()
+	kvmModuleParamsDir = t.TempDir()
+
+	for _, name := range []string{"halt_poll_ns", "ignore_msrs"} {
+		if err := os.WriteFile(filepath.Join(kvmModuleParamsDir, name), []byte("N\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	haltPollNS := uint32(50000)
+	c := &Config{
+		Accels: []Accel{
+			{Type: AccelKVM, HaltPollNS: &haltPollNS, IgnoreMSRs: true},
+			{Type: AccelTCG},
+		},
+	}
+	if err := c.ApplyKVMModuleParams(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := map[string]string{"halt_poll_ns": "50000", "ignore_msrs": "Y"}
+	for name, value := range expected {
+		found, err := os.ReadFile(filepath.Join(kvmModuleParamsDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(found) != value {
+			t.Errorf("Expected %s=%s, found %s", name, value, found)
+		}
+	}
+
+	kvmModuleParamsDir = filepath.Join(kvmModuleParamsDir, "missing")
+	if err := c.ApplyKVMModuleParams(); err == nil {
+		t.Errorf("Expected error for missing kvm module parameters")
+	}
+}
@@ -0,0 +1,150 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ACPITable represents a qemu -acpitable entry injecting an ACPI table,
+// e.g. a custom SSDT, into the guest.
+// File and Data are mutually exclusive
+type ACPITable struct {
+	// File is a complete ACPI table, including its header
+	File string `yaml:"file"`
+
+	// Data is a colon separated list of files, e.g. body1.aml:body2.aml,
+	// concatenated into the body of the ACPI table, qemu generates the
+	// header from the fields below
+	Data string `yaml:"data"`
+
+	// Sig is the 4 character table signature, e.g. SSDT
+	Sig string `yaml:"signature"`
+
+	// Rev is the table revision
+	Rev int `yaml:"revision"`
+
+	// OEMID is the 6 character OEM id
+	OEMID string `yaml:"oem-id"`
+
+	// OEMTableID is the 8 character OEM table id
+	OEMTableID string `yaml:"oem-table-id"`
+
+	// OEMRev is the OEM revision
+	OEMRev int `yaml:"oem-revision"`
+
+	// ASLCompilerID is the 4 character ASL compiler vendor id
+	ASLCompilerID string `yaml:"asl-compiler-id"`
+
+	// ASLCompilerRev is the ASL compiler revision
+	ASLCompilerRev int `yaml:"asl-compiler-revision"`
+}
+
+// Valid returns an error if the ACPITable structure is not valid and complete.
+func (t ACPITable) Valid() error {
+	if t.File == "" && t.Data == "" {
+		return fmt.Errorf("ACPITable requires either File or Data field to be set")
+	}
+
+	if t.File != "" && t.Data != "" {
+		return fmt.Errorf("ACPITable File and Data fields are mutually exclusive")
+	}
+
+	lengths := []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"Sig", t.Sig, 4},
+		{"OEMID", t.OEMID, 6},
+		{"OEMTableID", t.OEMTableID, 8},
+		{"ASLCompilerID", t.ASLCompilerID, 4},
+	}
+	for _, l := range lengths {
+		if len(l.value) > l.max {
+			return fmt.Errorf("ACPITable %s field %q is longer than %d characters", l.name, l.value, l.max)
+		}
+	}
+
+	if t.Rev < 0 || t.OEMRev < 0 || t.ASLCompilerRev < 0 {
+		return fmt.Errorf("ACPITable revisions must not be negative")
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the ACPITable.
+func (t ACPITable) QemuParams(config *Config) []string {
+	var tableParams []string
+
+	if t.Sig != "" {
+		tableParams = append(tableParams, fmt.Sprintf("sig=%s", t.Sig))
+	}
+	if t.Rev > 0 {
+		tableParams = append(tableParams, fmt.Sprintf("rev=%d", t.Rev))
+	}
+	if t.OEMID != "" {
+		tableParams = append(tableParams, fmt.Sprintf("oem_id=%s", t.OEMID))
+	}
+	if t.OEMTableID != "" {
+		tableParams = append(tableParams, fmt.Sprintf("oem_table_id=%s", t.OEMTableID))
+	}
+	if t.OEMRev > 0 {
+		tableParams = append(tableParams, fmt.Sprintf("oem_rev=%d", t.OEMRev))
+	}
+	if t.ASLCompilerID != "" {
+		tableParams = append(tableParams, fmt.Sprintf("asl_compiler_id=%s", t.ASLCompilerID))
+	}
+	if t.ASLCompilerRev > 0 {
+		tableParams = append(tableParams, fmt.Sprintf("asl_compiler_rev=%d", t.ASLCompilerRev))
+	}
+
+	if t.File != "" {
+		tableParams = append(tableParams, fmt.Sprintf("file=%s", t.File))
+	} else {
+		tableParams = append(tableParams, fmt.Sprintf("data=%s", t.Data))
+	}
+
+	return []string{"-acpitable", strings.Join(tableParams, ",")}
+}
+
+func (config *Config) appendACPITables() error {
+	var errors []string
+	for _, t := range config.ACPITables {
+		if err := t.Valid(); err != nil {
+			errors = append(errors, err.Error())
+			continue
+		}
+
+		config.qemuParams = append(config.qemuParams, t.QemuParams(config)...)
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Failed to append %d ACPITable(s):\n%s", len(errors), strings.Join(errors, "\n"))
+	}
+
+	return nil
+}
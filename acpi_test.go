@@ -0,0 +1,53 @@
+package qcli
+
+import "testing"
+
+var (
+	acpiTableFileString = "-acpitable file=/var/lib/vm/ssdt-tpm.aml"
+	acpiTableDataString = "-acpitable sig=SSDT,rev=2,oem_id=QCLI,oem_table_id=QUIRKS,oem_rev=1,asl_compiler_id=INTL,asl_compiler_rev=20200925,data=/var/lib/vm/quirks.dat"
+)
+
+func TestAppendACPITable(t *testing.T) {
+	table := ACPITable{
+		File: "/var/lib/vm/ssdt-tpm.aml",
+	}
+	testAppend(table, acpiTableFileString, t)
+
+	table = ACPITable{
+		Data:           "/var/lib/vm/quirks.dat",
+		Sig:            "SSDT",
+		Rev:            2,
+		OEMID:          "QCLI",
+		OEMTableID:     "QUIRKS",
+		OEMRev:         1,
+		ASLCompilerID:  "INTL",
+		ASLCompilerRev: 20200925,
+	}
+	testAppend(table, acpiTableDataString, t)
+}
+
+func TestBadACPITable(t *testing.T) {
+	c := &Config{}
+	if err := c.appendACPITables(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(c.qemuParams) != 0 {
+		t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
+	}
+
+	c = &Config{
+		ACPITables: []ACPITable{
+			{},
+			{File: "ssdt.aml", Data: "ssdt.dat"},
+			{File: "ssdt.aml", Sig: "SSDTX"},
+			{Data: "ssdt.dat", OEMID: "TOOLONG"},
+			{Data: "ssdt.dat", Rev: -1},
+		},
+	}
+	if err := c.appendACPITables(); err == nil {
+		t.Fatalf("Expected error for invalid ACPITables")
+	}
+	if len(c.qemuParams) != 0 {
+		t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
+	}
+}
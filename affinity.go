@@ -0,0 +1,187 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CPUAffinity pins the qemu threads to host CPUs once qemu is running, see
+// ApplyCPUAffinity. CPU lists use the taskset/cpuset syntax, e.g., 2-3,6.
+type CPUAffinity struct {
+	// VCPUs maps a vcpu index to the host CPUs its thread may run on
+	VCPUs map[int]string `yaml:"vcpus"`
+
+	// Emulator is the host CPU list of every other qemu thread, e.g., the
+	// main loop, iothreads and vhost workers
+	Emulator string `yaml:"emulator"`
+}
+
+// MaxHostCPUs is the number of host CPUs a thread can be pinned to, i.e.,
+// CPU_SETSIZE.
+const MaxHostCPUs = 1024
+
+// ParseCPUList parses a cpuset list such as 0-3,8 and returns the sorted
+// CPU numbers, which must be lower than MaxHostCPUs.
+func ParseCPUList(list string) ([]int, error) {
+	seen := map[int]bool{}
+	for _, tok := range strings.Split(list, ",") {
+		tok = strings.TrimSpace(tok)
+		first, last, isRange := strings.Cut(tok, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("Invalid CPU list '%s': bad CPU '%s'", list, tok)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("Invalid CPU list '%s': bad range '%s'", list, tok)
+			}
+		}
+		if end >= MaxHostCPUs {
+			return nil, fmt.Errorf("Invalid CPU list '%s': CPU '%s' is not lower than %d", list, tok, MaxHostCPUs)
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			seen[cpu] = true
+		}
+	}
+
+	cpus := make([]int, 0, len(seen))
+	for cpu := range seen {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// Valid returns an error if a CPU list of the affinity is invalid.
+func (a CPUAffinity) Valid() error {
+	for vcpu, list := range a.VCPUs {
+		if vcpu < 0 {
+			return fmt.Errorf("Invalid CPUAffinity vcpu index %d", vcpu)
+		}
+		if _, err := ParseCPUList(list); err != nil {
+			return err
+		}
+	}
+	if a.Emulator != "" {
+		if _, err := ParseCPUList(a.Emulator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (config *Config) validateCPUAffinity() error {
+	if len(config.CPUAffinity.VCPUs) == 0 && config.CPUAffinity.Emulator == "" {
+		return nil
+	}
+	if err := config.CPUAffinity.Valid(); err != nil {
+		return err
+	}
+
+	maxCPUs := int(config.SMP.CPUs)
+	if int(config.SMP.MaxCPUs) > maxCPUs {
+		maxCPUs = int(config.SMP.MaxCPUs)
+	}
+	if maxCPUs == 0 {
+		return nil
+	}
+	for vcpu := range config.CPUAffinity.VCPUs {
+		if vcpu >= maxCPUs {
+			return fmt.Errorf("CPUAffinity vcpu %d does not exist, the VM has %d vcpus", vcpu, maxCPUs)
+		}
+	}
+	return nil
+}
+
+// ApplyCPUAffinity pins the vcpu threads, found with query-cpus-fast, and
+// the emulator threads of the running qemu process pid according to
+// Config.CPUAffinity. pid is only needed to pin the emulator threads, it
+// may be found with RunningPid.
+func (config *Config) ApplyCPUAffinity(ctx context.Context, q *QMP, pid int) error {
+	affinity := config.CPUAffinity
+	if len(affinity.VCPUs) == 0 && affinity.Emulator == "" {
+		return nil
+	}
+	if err := affinity.Valid(); err != nil {
+		return err
+	}
+
+	cpus, err := q.ExecQueryCpusFast(ctx)
+	if err != nil {
+		return err
+	}
+
+	vcpuThreads := map[int]bool{}
+	for _, cpu := range cpus {
+		vcpuThreads[cpu.ThreadID] = true
+	}
+
+	var errors []string
+	for _, cpu := range cpus {
+		list, ok := affinity.VCPUs[cpu.CPUIndex]
+		if !ok {
+			continue
+		}
+		hostCPUs, _ := ParseCPUList(list)
+		if err := setThreadAffinity(cpu.ThreadID, hostCPUs); err != nil {
+			errors = append(errors, fmt.Sprintf("vcpu %d (thread %d): %v", cpu.CPUIndex, cpu.ThreadID, err))
+		}
+	}
+
+	if affinity.Emulator != "" {
+		if pid <= 0 {
+			return fmt.Errorf("CPUAffinity emulator pinning requires the qemu pid")
+		}
+		hostCPUs, _ := ParseCPUList(affinity.Emulator)
+		tasks, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(pid), "task"))
+		if err != nil {
+			return fmt.Errorf("Failed to list the threads of qemu pid %d: %v", pid, err)
+		}
+		for _, task := range tasks {
+			tid, err := strconv.Atoi(task.Name())
+			if err != nil || vcpuThreads[tid] {
+				continue
+			}
+			if err := setThreadAffinity(tid, hostCPUs); err != nil {
+				errors = append(errors, fmt.Sprintf("emulator thread %d: %v", tid, err))
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Failed to pin %d qemu thread(s):\n%s", len(errors), strings.Join(errors, "\n"))
+	}
+	return nil
+}
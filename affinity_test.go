@@ -0,0 +1,141 @@
+package qcli
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	for list, expected := range map[string][]int{
+		"0":        {0},
+		"2-4":      {2, 3, 4},
+		"6,0-1, 1": {0, 1, 6},
+	} {
+		cpus, err := ParseCPUList(list)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(cpus, expected) {
+			t.Errorf("Expected %v for '%s', found %v", expected, list, cpus)
+		}
+	}
+
+	for _, list := range []string{"", "a", "-1", "4-2", "1-", "1024", "0-4294967295"} {
+		if _, err := ParseCPUList(list); err == nil {
+			t.Errorf("Expected error for CPU list '%s'", list)
+		}
+	}
+}
+
+func TestValidateCPUAffinity(t *testing.T) {
+	config := Config{
+		SMP: SMP{CPUs: 2, MaxCPUs: 4},
+		CPUAffinity: CPUAffinity{
+			VCPUs:    map[int]string{0: "2", 3: "3-4"},
+			Emulator: "0-1",
+		},
+	}
+	if err := config.validateCPUAffinity(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	config.CPUAffinity.VCPUs[4] = "5"
+	if err := config.validateCPUAffinity(); err == nil {
+		t.Errorf("Expected error for a vcpu out of range")
+	}
+	delete(config.CPUAffinity.VCPUs, 4)
+
+	config.CPUAffinity.Emulator = "0-"
+	if err := config.validateCPUAffinity(); err == nil {
+		t.Errorf("Expected error for an invalid emulator CPU list")
+	}
+}
+
+// allowedCPU returns a host CPU the test process may run on
+func allowedCPU(t *testing.T) string {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		t.Skip("no /proc on this platform")
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if strings.HasPrefix(line, "Cpus_allowed_list:") {
+			list := strings.TrimPrefix(line, "Cpus_allowed_list:")
+			cpus, err := ParseCPUList(strings.TrimSpace(list))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return strconv.Itoa(cpus[len(cpus)-1])
+		}
+	}
+	t.Skip("no Cpus_allowed_list in /proc/self/status")
+	return ""
+}
+
+func threadAffinity(t *testing.T, pid int) string {
+	status, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if strings.HasPrefix(line, "Cpus_allowed_list:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Cpus_allowed_list:"))
+		}
+	}
+	return ""
+}
+
+func TestApplyCPUAffinity(t *testing.T) {
+	cpu := allowedCPU(t)
+
+	// sleep processes stand in for a vcpu thread and the qemu process
+	var pids []int
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command("sleep", "30")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+		pids = append(pids, cmd.Process.Pid)
+	}
+
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("query-cpus-fast", nil, "return", []interface{}{
+		map[string]interface{}{
+			"cpu-index": 0,
+			"qom-path":  "/machine/unattached/device[0]",
+			"thread-id": pids[0],
+			"target":    "x86_64",
+		},
+	})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	config := Config{
+		CPUAffinity: CPUAffinity{
+			VCPUs:    map[int]string{0: cpu},
+			Emulator: cpu,
+		},
+	}
+	if err := config.ApplyCPUAffinity(context.Background(), q, pids[1]); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, pid := range pids {
+		if affinity := threadAffinity(t, pid); affinity != cpu {
+			t.Errorf("Expected thread %d pinned to CPU %s, found %s", pid, cpu, affinity)
+		}
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
@@ -36,6 +36,10 @@ type BalloonDevice struct {
 	DisableModern bool   `yaml:"disable-modern"`
 	ID            string `yaml:"id"`
 
+	// FreePageReporting lets the guest report free pages to the host so
+	// their memory can be reclaimed.
+	FreePageReporting bool `yaml:"free-page-reporting"`
+
 	// ROMFile specifies the ROM file being used for this device.
 	ROMFile string `yaml:"rom-file"`
 
@@ -70,7 +74,7 @@ func (b BalloonDevice) QemuParams(config *Config) []string {
 	}
 
 	if b.Transport.isVirtioCCW(config) {
-		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", b.DevNo))
+		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(b.DevNo)))
 	}
 
 	if b.DeflateOnOOM {
@@ -78,6 +82,9 @@ func (b BalloonDevice) QemuParams(config *Config) []string {
 	} else {
 		deviceParams = append(deviceParams, "deflate-on-oom=off")
 	}
+	if b.FreePageReporting {
+		deviceParams = append(deviceParams, "free-page-reporting=on")
+	}
 	if s := b.Transport.disableModern(config, b.DisableModern); s != "" {
 		deviceParams = append(deviceParams, s)
 	}
@@ -40,4 +40,19 @@ func TestAppendVirtioBalloon(t *testing.T) {
 	balloonDevice.DisableModern = true
 	testAppend(balloonDevice, deviceString+OnDeflateOnOMM+OnDisableModern, t)
 
+	balloonDevice.FreePageReporting = true
+	testAppend(balloonDevice, deviceString+OnDeflateOnOMM+",free-page-reporting=on"+OnDisableModern, t)
+}
+
+func TestAppendConfigBalloonDevices(t *testing.T) {
+	c := &Config{
+		BalloonDevices: []BalloonDevice{
+			{
+				ID:                "balloon0",
+				DeflateOnOOM:      true,
+				FreePageReporting: true,
+			},
+		},
+	}
+	testConfig(c, "-device virtio-balloon-pci,id=balloon0,deflate-on-oom=on,free-page-reporting=on,disable-modern=false", t)
 }
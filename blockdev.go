@@ -26,8 +26,11 @@
 package qcli
 
 import (
+	"context"
 	"fmt"
 	"strings"
+
+	"github.com/project-machine/qcli/diskimage"
 )
 
 type CacheMode string
@@ -101,8 +104,83 @@ const (
 	QCOW2 BlockDeviceFormat = "qcow2"
 	// RAW is the direct indexing image format
 	RAW BlockDeviceFormat = "raw"
+	// LUKS is the LUKS encrypted image format
+	LUKS BlockDeviceFormat = "luks"
 )
 
+// BlockDeviceThrottle limits the I/O rate of a block device. A value of
+// zero leaves that limit unset.
+type BlockDeviceThrottle struct {
+	// IOPS is the total I/O operations per second limit
+	IOPS uint64 `yaml:"iops-total"`
+	// IOPSRead is the read I/O operations per second limit
+	IOPSRead uint64 `yaml:"iops-read"`
+	// IOPSWrite is the write I/O operations per second limit
+	IOPSWrite uint64 `yaml:"iops-write"`
+	// IOPSMax is the total I/O operations per second burst limit
+	IOPSMax uint64 `yaml:"iops-total-max"`
+
+	// BPS is the total bytes per second limit
+	BPS uint64 `yaml:"bps-total"`
+	// BPSRead is the read bytes per second limit
+	BPSRead uint64 `yaml:"bps-read"`
+	// BPSWrite is the write bytes per second limit
+	BPSWrite uint64 `yaml:"bps-write"`
+	// BPSMax is the total bytes per second burst limit
+	BPSMax uint64 `yaml:"bps-total-max"`
+
+	// Group is the throttle group name, drives in the same group share
+	// the limits
+	Group string `yaml:"group"`
+}
+
+// Valid returns an error if the throttle limits are inconsistent.
+func (t BlockDeviceThrottle) Valid() error {
+	if t.IOPS > 0 && (t.IOPSRead > 0 || t.IOPSWrite > 0) {
+		return fmt.Errorf("IOPS total and read/write limits are mutually exclusive")
+	}
+	if t.BPS > 0 && (t.BPSRead > 0 || t.BPSWrite > 0) {
+		return fmt.Errorf("BPS total and read/write limits are mutually exclusive")
+	}
+	if t.IOPSMax > 0 && t.IOPSMax < t.IOPS {
+		return fmt.Errorf("IOPSMax %d must not be lower than IOPS %d", t.IOPSMax, t.IOPS)
+	}
+	if t.BPSMax > 0 && t.BPSMax < t.BPS {
+		return fmt.Errorf("BPSMax %d must not be lower than BPS %d", t.BPSMax, t.BPS)
+	}
+	return nil
+}
+
+// driveParams returns the -drive throttling parameters.
+func (t BlockDeviceThrottle) driveParams() []string {
+	var params []string
+
+	limits := []struct {
+		name  string
+		value uint64
+	}{
+		{"iops-total", t.IOPS},
+		{"iops-read", t.IOPSRead},
+		{"iops-write", t.IOPSWrite},
+		{"iops-total-max", t.IOPSMax},
+		{"bps-total", t.BPS},
+		{"bps-read", t.BPSRead},
+		{"bps-write", t.BPSWrite},
+		{"bps-total-max", t.BPSMax},
+	}
+	for _, l := range limits {
+		if l.value > 0 {
+			params = append(params, fmt.Sprintf("throttling.%s=%d", l.name, l.value))
+		}
+	}
+
+	if t.Group != "" {
+		params = append(params, fmt.Sprintf("throttling.group=%s", t.Group))
+	}
+
+	return params
+}
+
 // BlockDevice represents a qemu block device.
 type BlockDevice struct {
 	Driver    DeviceDriver         `yaml:"driver"`
@@ -113,7 +191,7 @@ type BlockDevice struct {
 	Format    BlockDeviceFormat    `yaml:"format"`
 	SCSI      bool                 `yaml:"scsi"`
 	WCE       bool                 `yaml:"write-cache"`
-	BootIndex string               `yaml:"bootindex"`
+	BootIndex *BootIndex           `yaml:"bootindex"`
 
 	// Media is a hint about the what type of content on the disk, e.g media=cdrom
 	Media string `yaml:"media"`
@@ -163,6 +241,34 @@ type BlockDevice struct {
 
 	// VVFAT driver options
 	VVFATDev VVFATDev `yaml:"vvfat-device"`
+
+	// IOThread is the IO thread on which IO will be handled, only
+	// supported with Driver=virtio-blk
+	IOThread string `yaml:"iothread"`
+
+	// NumQueues is the number of virtio-blk request queues, at most one
+	// per vcpu, only supported with Driver=virtio-blk
+	NumQueues uint16 `yaml:"num-queues"`
+
+	// QueueSize is the size of each virtio-blk queue, a power of 2 up to
+	// 1024, only supported with Driver=virtio-blk
+	QueueSize uint16 `yaml:"queue-size"`
+
+	// IOThreadVQs are the IO threads the virtio-blk queues are spread over
+	// round-robin. It requires qemu 9.0, excludes IOThread and switches
+	// the -device parameter to its JSON syntax.
+	IOThreadVQs []string `yaml:"iothread-vq-mapping"`
+
+	// Throttle sets I/O limits on the drive
+	Throttle BlockDeviceThrottle `yaml:"throttle"`
+
+	// KeySecret is the ID of the SecretObject holding the passphrase of
+	// a LUKS encrypted image, only supported with Format=qcow2|luks
+	KeySecret string `yaml:"key-secret"`
+
+	// Size is the size of the image, e.g. 20G, used by CreateMissingDisks
+	// to create File when it does not exist
+	Size string `yaml:"size"`
 }
 
 type VVFATDev struct {
@@ -226,6 +332,43 @@ func (blkdev BlockDevice) Valid() error {
 		if blkdev.RotationRate > 0 && strings.HasPrefix(string(blkdev.Driver), "virtio") {
 			return fmt.Errorf("BlockDevice ID=%s with RotationRate cannot be Driver=virtio*", blkdev.ID)
 		}
+		if blkdev.IOThread != "" && blkdev.Driver != VirtioBlock {
+			return fmt.Errorf("BlockDevice ID=%s with IOThread must be Driver=virtio-blk", blkdev.ID)
+		}
+		if (blkdev.NumQueues > 0 || blkdev.QueueSize > 0 || len(blkdev.IOThreadVQs) > 0) && blkdev.Driver != VirtioBlock {
+			return fmt.Errorf("BlockDevice ID=%s with NumQueues, QueueSize or IOThreadVQs must be Driver=virtio-blk", blkdev.ID)
+		}
+		if blkdev.QueueSize > 0 && (blkdev.QueueSize&(blkdev.QueueSize-1) != 0 || blkdev.QueueSize > 1024) {
+			return fmt.Errorf("BlockDevice ID=%s QueueSize %d must be a power of 2 up to 1024", blkdev.ID, blkdev.QueueSize)
+		}
+		if len(blkdev.IOThreadVQs) > 0 && blkdev.IOThread != "" {
+			return fmt.Errorf("BlockDevice ID=%s cannot have both IOThread and IOThreadVQs", blkdev.ID)
+		}
+		for _, iothread := range blkdev.IOThreadVQs {
+			if iothread == "" {
+				return fmt.Errorf("BlockDevice ID=%s has an empty IOThreadVQs entry", blkdev.ID)
+			}
+		}
+		if err := blkdev.Throttle.Valid(); err != nil {
+			return fmt.Errorf("BlockDevice ID=%s invalid Throttle: %s", blkdev.ID, err)
+		}
+		if blkdev.Format == LUKS && blkdev.KeySecret == "" {
+			return fmt.Errorf("BlockDevice ID=%s with Format=luks must have KeySecret", blkdev.ID)
+		}
+		if blkdev.KeySecret != "" && blkdev.Format != QCOW2 && blkdev.Format != LUKS {
+			return fmt.Errorf("BlockDevice ID=%s with KeySecret must be Format=qcow2|luks", blkdev.ID)
+		}
+		if blkdev.isSCSIPassthrough() {
+			if blkdev.Format != RAW {
+				return fmt.Errorf("BlockDevice ID=%s with Driver=%s must be Format=raw", blkdev.ID, blkdev.Driver)
+			}
+			if blkdev.Bus == "" {
+				return fmt.Errorf("BlockDevice ID=%s with Driver=%s has empty Bus field", blkdev.ID, blkdev.Driver)
+			}
+			if blkdev.Serial != "" || blkdev.BlockSize > 0 || blkdev.KeySecret != "" {
+				return fmt.Errorf("BlockDevice ID=%s with Driver=%s does not support Serial, BlockSize or KeySecret", blkdev.ID, blkdev.Driver)
+			}
+		}
 	}
 	return nil
 }
@@ -302,6 +445,16 @@ func (blkdev BlockDevice) QemuParams(config *Config) []string {
 			driveParams = append(driveParams, "readonly=on")
 		}
 
+		switch {
+		case blkdev.KeySecret != "" && blkdev.Format == QCOW2:
+			driveParams = append(driveParams, "encrypt.format=luks")
+			driveParams = append(driveParams, fmt.Sprintf("encrypt.key-secret=%s", blkdev.KeySecret))
+		case blkdev.KeySecret != "":
+			driveParams = append(driveParams, fmt.Sprintf("key-secret=%s", blkdev.KeySecret))
+		}
+
+		driveParams = append(driveParams, blkdev.Throttle.driveParams()...)
+
 		qemuParams = append(qemuParams, "-drive")
 		qemuParams = append(qemuParams, strings.Join(driveParams, ","))
 
@@ -313,14 +466,29 @@ func (blkdev BlockDevice) QemuParams(config *Config) []string {
 		// All device parameters must be after DriveOnly
 		deviceParams = append(deviceParams, blkdev.deviceName(config))
 		deviceParams = append(deviceParams, fmt.Sprintf("drive=%s", blkdev.ID))
+
+		// the pass-through devices report the host device identity
+		if blkdev.isSCSIPassthrough() {
+			if p := blkdev.BootIndex.param(); p != "" {
+				deviceParams = append(deviceParams, p)
+			}
+			deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", blkdev.Bus))
+			if blkdev.ShareRW {
+				deviceParams = append(deviceParams, "share-rw=on")
+			}
+			qemuParams = append(qemuParams, "-device")
+			qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+			return qemuParams
+		}
+
 		if blkdev.Serial != "" {
 			deviceParams = append(deviceParams, fmt.Sprintf("serial=%s", blkdev.Serial))
 		} else {
 			deviceParams = append(deviceParams, fmt.Sprintf("serial=%s", blkdev.ID))
 		}
 
-		if blkdev.BootIndex != "" {
-			deviceParams = append(deviceParams, fmt.Sprintf("bootindex=%s", blkdev.BootIndex))
+		if p := blkdev.BootIndex.param(); p != "" {
+			deviceParams = append(deviceParams, p)
 		}
 
 		if blkdev.Driver == VirtioBlock {
@@ -338,6 +506,13 @@ func (blkdev BlockDevice) QemuParams(config *Config) []string {
 				}
 				deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", bus))
 			}
+
+			if blkdev.NumQueues > 0 {
+				deviceParams = append(deviceParams, fmt.Sprintf("num-queues=%d", blkdev.NumQueues))
+			}
+			if blkdev.QueueSize > 0 {
+				deviceParams = append(deviceParams, fmt.Sprintf("queue-size=%d", blkdev.QueueSize))
+			}
 		}
 
 		if blkdev.Driver == SCSIHD && blkdev.Bus != "" {
@@ -374,20 +549,266 @@ func (blkdev BlockDevice) QemuParams(config *Config) []string {
 		}
 
 		if blkdev.Transport.isVirtioCCW(config) {
-			deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", blkdev.DevNo))
+			deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(blkdev.DevNo)))
 		}
 
 		if blkdev.ShareRW {
 			deviceParams = append(deviceParams, "share-rw=on")
 		}
+
+		if blkdev.IOThread != "" {
+			deviceParams = append(deviceParams, fmt.Sprintf("iothread=%s", blkdev.IOThread))
+		}
 	}
 
 	qemuParams = append(qemuParams, "-device")
-	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+	if len(blkdev.IOThreadVQs) > 0 {
+		// iothread-vq-mapping is a list, only the JSON syntax can set it
+		qemuParams = append(qemuParams, blkdev.deviceJSON(deviceParams))
+	} else {
+		qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+	}
+
+	if blkdev.IOThread != "" {
+		qemuParams = append(qemuParams, config.ioThreadParams(blkdev.IOThread)...)
+	}
+	for _, iothread := range blkdev.IOThreadVQs {
+		qemuParams = append(qemuParams, config.ioThreadParams(iothread)...)
+	}
 
 	return qemuParams
 }
 
+// blockDeviceIntProps are the -device properties deviceJSON emits as
+// numbers, the JSON syntax is strictly typed.
+var blockDeviceIntProps = map[string]bool{
+	"bootindex":           true,
+	"num-queues":          true,
+	"queue-size":          true,
+	"logical_block_size":  true,
+	"physical_block_size": true,
+}
+
+// deviceJSON returns the JSON syntax of the -device parameters with the
+// IOThreadVQs iothread-vq-mapping added.
+func (blkdev BlockDevice) deviceJSON(deviceParams []string) string {
+	var props []string
+
+	props = append(props, fmt.Sprintf("%q:%q", "driver", deviceParams[0]))
+	for _, param := range deviceParams[1:] {
+		key, val, _ := strings.Cut(param, "=")
+		switch {
+		case blockDeviceIntProps[key]:
+			props = append(props, fmt.Sprintf("%q:%s", key, val))
+		case val == "on" || val == "true":
+			props = append(props, fmt.Sprintf("%q:true", key))
+		case val == "off" || val == "false":
+			props = append(props, fmt.Sprintf("%q:false", key))
+		default:
+			props = append(props, fmt.Sprintf("%q:%q", key, val))
+		}
+	}
+
+	var mapping []string
+	for _, iothread := range blkdev.IOThreadVQs {
+		mapping = append(mapping, fmt.Sprintf("{%q:%q}", "iothread", iothread))
+	}
+	props = append(props, fmt.Sprintf("%q:[%s]", "iothread-vq-mapping", strings.Join(mapping, ",")))
+
+	return "{" + strings.Join(props, ",") + "}"
+}
+
+// validateBlockQueues checks the virtio-blk queues against the vcpus and
+// the qemu version.
+func (config *Config) validateBlockQueues() error {
+	cpus := config.SMP.CPUs
+	if config.SMP.MaxCPUs > cpus {
+		cpus = config.SMP.MaxCPUs
+	}
+
+	for _, blkdev := range config.BlkDevices {
+		if blkdev.NumQueues > 0 && cpus > 0 && uint32(blkdev.NumQueues) > cpus {
+			return fmt.Errorf("BlockDevice ID=%s NumQueues %d exceeds the %d vcpus", blkdev.ID, blkdev.NumQueues, cpus)
+		}
+		if len(blkdev.IOThreadVQs) > 0 && config.Version.Before(9, 0) {
+			return fmt.Errorf("BlockDevice ID=%s IOThreadVQs requires qemu 9.0, found %s", blkdev.ID, config.Version)
+		}
+	}
+
+	return nil
+}
+
+// isCDROM returns true if the device holds a removable cdrom medium.
+func (blkdev BlockDevice) isCDROM() bool {
+	return blkdev.Media == "cdrom" || blkdev.Driver == IDECDROM || blkdev.Driver == SCSICD
+}
+
+// cdrom returns the cdrom BlockDevice id of the config.
+func (config *Config) cdrom(id string) (*BlockDevice, error) {
+	for i := range config.BlkDevices {
+		if config.BlkDevices[i].ID != id {
+			continue
+		}
+		if !config.BlkDevices[i].isCDROM() {
+			return nil, fmt.Errorf("BlockDevice ID=%s is not a cdrom", id)
+		}
+		return &config.BlkDevices[i], nil
+	}
+	return nil, fmt.Errorf("BlockDevice ID=%s not found", id)
+}
+
+// ChangeCDROM inserts the raw image file, e.g. an installer ISO, in the
+// cdrom BlockDevice id of the running qemu. The BlockDevice File is
+// updated so that a relaunched qemu keeps the new medium.
+func (config *Config) ChangeCDROM(ctx context.Context, q *QMP, id, file string) error {
+	blkdev, err := config.cdrom(id)
+	if err != nil {
+		return err
+	}
+
+	if err := q.ExecuteBlockdevChangeMedium(ctx, id, file, string(RAW)); err != nil {
+		return err
+	}
+
+	blkdev.File = file
+	blkdev.Format = RAW
+	return nil
+}
+
+// EjectCDROM ejects the medium of the cdrom BlockDevice id of the running
+// qemu, force ejects it even if the guest locked the tray.
+func (config *Config) EjectCDROM(ctx context.Context, q *QMP, id string, force bool) error {
+	if _, err := config.cdrom(id); err != nil {
+		return err
+	}
+
+	return q.ExecuteEject(ctx, id, force)
+}
+
+// QueryBlockDevices returns the query-block information of the BlockDevices
+// of the running qemu, keyed by their ID. The BlockDevices qemu does not
+// report are not in the map.
+func (config *Config) QueryBlockDevices(ctx context.Context, q *QMP) (map[string]BlockInfo, error) {
+	blocks, err := q.ExecuteQueryBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for _, blkdev := range config.BlkDevices {
+		ids[blkdev.ID] = true
+	}
+
+	devices := make(map[string]BlockInfo)
+	for _, block := range blocks {
+		switch {
+		case ids[block.Device]:
+			// -drive id=ID
+			devices[block.Device] = block
+		case block.Inserted != nil && ids[block.Inserted.NodeName]:
+			// -blockdev node-name=ID
+			devices[block.Inserted.NodeName] = block
+		}
+	}
+
+	return devices, nil
+}
+
+// BlockDeviceForNode returns the ID of the BlockDevice the block node
+// nodeName of the running qemu is inserted in, e.g. the node of a
+// BLOCK_WRITE_THRESHOLD event.
+func (config *Config) BlockDeviceForNode(ctx context.Context, q *QMP, nodeName string) (string, error) {
+	devices, err := config.QueryBlockDevices(ctx, q)
+	if err != nil {
+		return "", err
+	}
+
+	stats, err := q.ExecuteQueryBlockstats(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for id, block := range devices {
+		if block.Inserted == nil {
+			continue
+		}
+		if block.Inserted.NodeName == nodeName || blockFileNode(stats, block.Inserted.NodeName) == nodeName {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("No BlockDevice has the block node %s", nodeName)
+}
+
+// blockFileNode returns the name of the protocol node the block node
+// nodeName stores its data in, e.g. the file child of a qcow2 node, or
+// nodeName if it has none.
+func blockFileNode(stats []BlockStats, nodeName string) string {
+	for _, s := range stats {
+		if s.NodeName == nodeName && s.Parent != nil && s.Parent.NodeName != "" {
+			return s.Parent.NodeName
+		}
+	}
+	return nodeName
+}
+
+// SetBlockWriteThreshold sets the write threshold of the BlockDevice id of
+// the running qemu, e.g. to be notified with a BLOCK_WRITE_THRESHOLD event
+// before a thin-provisioned image fills its storage. The threshold is set
+// on the protocol node of the image, e.g. the file child of a qcow2 node,
+// so that it applies to the host offsets. The event is raised once, the
+// threshold must be set again afterwards.
+func (config *Config) SetBlockWriteThreshold(ctx context.Context, q *QMP, id string, threshold uint64) error {
+	devices, err := config.QueryBlockDevices(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	block, ok := devices[id]
+	if !ok {
+		return fmt.Errorf("BlockDevice ID=%s not found", id)
+	}
+	if block.Inserted == nil {
+		return fmt.Errorf("BlockDevice ID=%s has no medium", id)
+	}
+
+	stats, err := q.ExecuteQueryBlockstats(ctx)
+	if err != nil {
+		return err
+	}
+
+	return q.ExecuteBlockSetWriteThreshold(ctx, blockFileNode(stats, block.Inserted.NodeName), threshold)
+}
+
+// isSCSIPassthrough returns true if the device passes a host SCSI device
+// through to the guest.
+func (blkdev BlockDevice) isSCSIPassthrough() bool {
+	return blkdev.Driver == SCSIBlock || blkdev.Driver == SCSIGeneric
+}
+
+// validateSCSIPassthrough checks the SCSI pass-through devices are on the
+// bus of a virtio-scsi controller of the config.
+func (config *Config) validateSCSIPassthrough() error {
+	controllers := make(map[string]bool)
+	for _, scsiCon := range config.SCSIControllerDevices {
+		if scsiCon.Driver == "" || scsiCon.Driver == VirtioScsi {
+			controllers[scsiCon.ID] = true
+		}
+	}
+
+	for _, blkdev := range config.BlkDevices {
+		if !blkdev.isSCSIPassthrough() {
+			continue
+		}
+		controller, _, _ := strings.Cut(blkdev.Bus, ".")
+		if !controllers[controller] {
+			return fmt.Errorf("BlockDevice ID=%s Bus %s is not on a virtio-scsi controller", blkdev.ID, blkdev.Bus)
+		}
+	}
+
+	return nil
+}
+
 // deviceName returns the QEMU device name for the current combination of
 // driver and transport.
 func (blkdev BlockDevice) deviceName(config *Config) string {
@@ -402,3 +823,26 @@ func (blkdev BlockDevice) deviceName(config *Config) string {
 
 	return string(blkdev.Driver)
 }
+
+// CreateMissingDisks creates the images of the BlkDevices declared with a
+// Size whose File does not exist yet. Only qcow2 and raw images can be
+// created.
+func (config *Config) CreateMissingDisks(ctx context.Context) error {
+	for _, blkdev := range config.BlkDevices {
+		if blkdev.Size == "" || blkdev.File == "" || PathExists(blkdev.File) {
+			continue
+		}
+
+		switch blkdev.Format {
+		case QCOW2, RAW:
+		default:
+			return fmt.Errorf("BlockDevice ID=%s cannot create image with Format=%s", blkdev.ID, blkdev.Format)
+		}
+
+		if err := diskimage.Create(ctx, blkdev.File, string(blkdev.Format), blkdev.Size, ""); err != nil {
+			return fmt.Errorf("BlockDevice ID=%s failed to create %s: %v", blkdev.ID, blkdev.File, err)
+		}
+	}
+
+	return nil
+}
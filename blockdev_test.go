@@ -1,6 +1,14 @@
 package qcli
 
-import "testing"
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/project-machine/qcli/diskimage"
+)
 
 var (
 	deviceBlockString         = "-drive file=/var/lib/vm.img,id=hd0,if=none,format=qcow2,aio=threads,cache=unsafe,discard=unmap,detect-zeroes=unmap,readonly=on -device virtio-blk-pci,drive=hd0,serial=abc-123,disable-modern=true,addr=0x03,bus=pcie.0,logical_block_size=4096,physical_block_size=4096,scsi=off,config-wce=off,romfile=efi-virtio.rom,share-rw=on"
@@ -11,6 +19,12 @@ var (
 	deviceBlockIDECDRom       = "-drive file=ubuntu.iso,id=cdrom0,if=none,format=raw,aio=threads,media=cdrom,readonly=on -device ide-cd,drive=cdrom0,serial=ubuntu.iso,bootindex=0,bus=ide.0"
 	deviceBlockSCSIHDStr      = "-drive file=root-disk.qcow,id=drive0,if=none,format=qcow2,aio=threads,cache=unsafe,discard=unmap,detect-zeroes=unmap -device scsi-hd,drive=drive0,serial=root-disk,bootindex=1,bus=scsi0.0,logical_block_size=512,physical_block_size=512"
 	deviceBlockUSBHDStr       = "-drive file=disk0-usb.img,id=drive1,if=none,format=raw,aio=threads,cache=unsafe,discard=unmap,detect-zeroes=unmap -device usb-storage,drive=drive1,serial=disk0-usb,logical_block_size=512,physical_block_size=512"
+	deviceBlockIOThreadString = "-drive file=/var/lib/vm0.img,id=hd0,if=none,format=qcow2 -device virtio-blk-pci,drive=hd0,serial=hd0,disable-modern=false,addr=0x07,bus=pcie.0,scsi=off,config-wce=off,iothread=iothread0 -object iothread,id=iothread0 -drive file=/var/lib/vm1.img,id=hd1,if=none,format=qcow2 -device virtio-blk-pci,drive=hd1,serial=hd1,disable-modern=false,addr=0x08,bus=pcie.0,scsi=off,config-wce=off,iothread=iothread0"
+	deviceBlockThrottleString = "-drive file=/var/lib/vm.img,id=hd0,if=none,format=qcow2,throttling.iops-total=1000,throttling.iops-total-max=2000,throttling.bps-read=10485760,throttling.bps-write=5242880,throttling.group=tenant0 -device virtio-blk-pci,drive=hd0,serial=hd0,disable-modern=false,addr=0x07,bus=pcie.0,scsi=off,config-wce=off"
+	deviceBlockEncryptedStr   = "-drive file=/var/lib/vm.img,id=hd0,if=none,format=qcow2,encrypt.format=luks,encrypt.key-secret=sec0 -device virtio-blk-pci,drive=hd0,serial=hd0,disable-modern=false,addr=0x07,bus=pcie.0,scsi=off,config-wce=off"
+	deviceBlockLUKSStr        = "-drive file=/var/lib/vm.luks,id=hd0,if=none,format=luks,key-secret=sec0 -device virtio-blk-pci,drive=hd0,serial=hd0,disable-modern=false,addr=0x07,bus=pcie.0,scsi=off,config-wce=off"
+	deviceBlockQueuesString   = "-drive file=/var/lib/vm.img,id=hd0,if=none,format=qcow2 -device virtio-blk-pci,drive=hd0,serial=hd0,disable-modern=false,addr=0x07,bus=pcie.0,num-queues=4,queue-size=256,scsi=off,config-wce=off"
+	deviceBlockIOThreadVQsStr = `-drive file=/var/lib/vm.img,id=hd0,if=none,format=qcow2 -device {"driver":"virtio-blk-pci","drive":"hd0","serial":"hd0","disable-modern":false,"addr":"0x07","bus":"pcie.0","num-queues":4,"scsi":false,"config-wce":false,"iothread-vq-mapping":[{"iothread":"iot0"},{"iothread":"iot1"}]} -object iothread,id=iot0 -object iothread,id=iot1`
 	deviceBlockVVFATBlkdev    = "-blockdev driver=vvfat,node-name=cidata,dir=seed,fat-type=32,floppy=off,label=CIDATA,read-only=on -device virtio-blk-pci,drive=cidata"
 )
 
@@ -56,6 +70,180 @@ func TestAppendDeviceBlockAddr(t *testing.T) {
 	testAppend(blkdev, deviceBlockAddrString, t)
 }
 
+func TestAppendDeviceBlockIOThread(t *testing.T) {
+	c := &Config{
+		BlkDevices: []BlockDevice{
+			{
+				Driver:    VirtioBlock,
+				ID:        "hd0",
+				File:      "/var/lib/vm0.img",
+				Format:    QCOW2,
+				Interface: NoInterface,
+				BusAddr:   "7",
+				IOThread:  "iothread0",
+			},
+			{
+				Driver:    VirtioBlock,
+				ID:        "hd1",
+				File:      "/var/lib/vm1.img",
+				Format:    QCOW2,
+				Interface: NoInterface,
+				BusAddr:   "8",
+				IOThread:  "iothread0",
+			},
+		},
+		IOThreads: []IOThread{{ID: "iothread0"}},
+	}
+	if c.BlkDevices[0].Transport.isVirtioCCW(nil) {
+		t.Skip("iothread test is for virtio-blk-pci")
+	}
+
+	if err := c.appendDevices(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	c.appendIOThreads()
+
+	result := strings.Join(c.qemuParams, " ")
+	if result != deviceBlockIOThreadString {
+		t.Fatalf("Failed to append parameters [%s] != [%s]", result, deviceBlockIOThreadString)
+	}
+
+	blkdev := BlockDevice{
+		Driver:    IDEHardDisk,
+		ID:        "hd0",
+		File:      "/var/lib/vm0.img",
+		Format:    QCOW2,
+		Interface: NoInterface,
+		IOThread:  "iothread0",
+	}
+	if err := blkdev.Valid(); err == nil {
+		t.Fatalf("Expected error for IOThread on non virtio-blk device")
+	}
+}
+
+func TestAppendDeviceBlockQueues(t *testing.T) {
+	blkdev := BlockDevice{
+		Driver:    VirtioBlock,
+		ID:        "hd0",
+		File:      "/var/lib/vm.img",
+		Format:    QCOW2,
+		Interface: NoInterface,
+		BusAddr:   "7",
+		NumQueues: 4,
+		QueueSize: 256,
+	}
+	if blkdev.Transport.isVirtioCCW(nil) {
+		t.Skip("queues test is for virtio-blk-pci")
+	}
+	testAppend(blkdev, deviceBlockQueuesString, t)
+
+	blkdev.QueueSize = 0
+	blkdev.IOThreadVQs = []string{"iot0", "iot1"}
+	testAppend(blkdev, deviceBlockIOThreadVQsStr, t)
+}
+
+func TestBadBlockDeviceQueues(t *testing.T) {
+	base := BlockDevice{Driver: VirtioBlock, ID: "hd0", File: "/var/lib/vm.img", Format: QCOW2, Interface: NoInterface}
+
+	devices := []BlockDevice{base, base, base, base}
+	devices[0].QueueSize = 100
+	devices[1].QueueSize = 2048
+	devices[2].IOThread = "iot0"
+	devices[2].IOThreadVQs = []string{"iot1"}
+	devices[3].Driver = IDEHardDisk
+	devices[3].NumQueues = 2
+	for _, d := range devices {
+		if err := d.Valid(); err == nil {
+			t.Errorf("Expected error for invalid BlockDevice %+v", d)
+		}
+	}
+
+	queues := base
+	queues.NumQueues = 8
+	vqs := base
+	vqs.IOThreadVQs = []string{"iot0"}
+	configs := []*Config{
+		{SMP: SMP{CPUs: 4}, BlkDevices: []BlockDevice{queues}},
+		{Version: Version{Major: 8, Minor: 2}, BlkDevices: []BlockDevice{vqs}},
+	}
+	for _, c := range configs {
+		if err := c.validateBlockQueues(); err == nil {
+			t.Errorf("Expected error for invalid block queues config %+v", c)
+		}
+	}
+
+	c := &Config{SMP: SMP{CPUs: 4, MaxCPUs: 8}, Version: Version{Major: 9}, BlkDevices: []BlockDevice{queues, vqs}}
+	if err := c.validateBlockQueues(); err != nil {
+		t.Errorf("Unexpected error for block queues config: %s", err)
+	}
+}
+
+func TestAppendDeviceBlockThrottle(t *testing.T) {
+	blkdev := BlockDevice{
+		Driver:    VirtioBlock,
+		ID:        "hd0",
+		File:      "/var/lib/vm.img",
+		Format:    QCOW2,
+		Interface: NoInterface,
+		BusAddr:   "7",
+		Throttle: BlockDeviceThrottle{
+			IOPS:     1000,
+			IOPSMax:  2000,
+			BPSRead:  10485760,
+			BPSWrite: 5242880,
+			Group:    "tenant0",
+		},
+	}
+	if blkdev.Transport.isVirtioCCW(nil) {
+		blkdev.DevNo = DevNo
+	}
+	testAppend(blkdev, deviceBlockThrottleString, t)
+
+	bad := []BlockDeviceThrottle{
+		{IOPS: 100, IOPSRead: 50},
+		{BPS: 100, BPSWrite: 50},
+		{IOPS: 100, IOPSMax: 50},
+		{BPS: 100, BPSMax: 50},
+	}
+	for _, throttle := range bad {
+		blkdev.Throttle = throttle
+		if err := blkdev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid throttle %+v", throttle)
+		}
+	}
+}
+
+func TestAppendDeviceBlockEncrypted(t *testing.T) {
+	blkdev := BlockDevice{
+		Driver:    VirtioBlock,
+		ID:        "hd0",
+		File:      "/var/lib/vm.img",
+		Format:    QCOW2,
+		Interface: NoInterface,
+		BusAddr:   "7",
+		KeySecret: "sec0",
+	}
+	if blkdev.Transport.isVirtioCCW(nil) {
+		blkdev.DevNo = DevNo
+	}
+	testAppend(blkdev, deviceBlockEncryptedStr, t)
+
+	blkdev.File = "/var/lib/vm.luks"
+	blkdev.Format = LUKS
+	testAppend(blkdev, deviceBlockLUKSStr, t)
+
+	blkdev.KeySecret = ""
+	if err := blkdev.Valid(); err == nil {
+		t.Errorf("Expected error for luks BlockDevice without KeySecret")
+	}
+
+	blkdev.Format = RAW
+	blkdev.KeySecret = "sec0"
+	if err := blkdev.Valid(); err == nil {
+		t.Errorf("Expected error for raw BlockDevice with KeySecret")
+	}
+}
+
 func TestAppendDeviceBlockVirtioCDROM(t *testing.T) {
 	blkdev := BlockDevice{
 		Driver:    VirtioBlock,
@@ -67,7 +255,7 @@ func TestAppendDeviceBlockVirtioCDROM(t *testing.T) {
 		Format:    RAW,
 		ReadOnly:  true,
 		Media:     "cdrom",
-		BootIndex: "0",
+		BootIndex: NewBootIndex(0),
 	}
 	if blkdev.Transport.isVirtioCCW(nil) {
 		blkdev.DevNo = DevNo
@@ -86,7 +274,7 @@ func TestAppendDeviceBlockIDECDROM(t *testing.T) {
 		Format:    RAW,
 		ReadOnly:  true,
 		Media:     "cdrom",
-		BootIndex: "0",
+		BootIndex: NewBootIndex(0),
 		Bus:       "ide.0",
 	}
 	if blkdev.Transport.isVirtioCCW(nil) {
@@ -105,7 +293,7 @@ func TestAppendDeviceBlockSCSIHD(t *testing.T) {
 		Serial:       "root-disk",
 		File:         "root-disk.qcow",
 		Format:       QCOW2,
-		BootIndex:    "1",
+		BootIndex:    NewBootIndex(1),
 		Bus:          "scsi0.0",
 		Cache:        CacheModeUnsafe,
 		Discard:      DiscardUnmap,
@@ -115,6 +303,64 @@ func TestAppendDeviceBlockSCSIHD(t *testing.T) {
 	testAppend(blkdev, deviceBlockSCSIHDStr, t)
 }
 
+var (
+	deviceBlockSCSIGenericStr = "-drive file=/dev/sg3,id=tape0,if=none,format=raw,aio=native,cache=none -device scsi-generic,drive=tape0,bus=scsi0.0"
+	deviceBlockSCSIBlockStr   = "-drive file=/dev/sdb,id=lun0,if=none,format=raw -device scsi-block,drive=lun0,bootindex=2,bus=scsi0.0,share-rw=on"
+)
+
+func TestAppendDeviceBlockSCSIPassthrough(t *testing.T) {
+	blkdev := BlockDevice{
+		Driver:    SCSIGeneric,
+		Interface: NoInterface,
+		ID:        "tape0",
+		AIO:       Native,
+		File:      "/dev/sg3",
+		Format:    RAW,
+		Bus:       "scsi0.0",
+		Cache:     CacheModeNone,
+	}
+	testAppend(blkdev, deviceBlockSCSIGenericStr, t)
+
+	blkdev = BlockDevice{
+		Driver:    SCSIBlock,
+		Interface: NoInterface,
+		ID:        "lun0",
+		File:      "/dev/sdb",
+		Format:    RAW,
+		Bus:       "scsi0.0",
+		BootIndex: NewBootIndex(2),
+		ShareRW:   true,
+	}
+	testAppend(blkdev, deviceBlockSCSIBlockStr, t)
+
+	c := &Config{
+		SCSIControllerDevices: []SCSIControllerDevice{{ID: "scsi0"}},
+		BlkDevices:            []BlockDevice{blkdev},
+	}
+	if err := c.validateSCSIPassthrough(); err != nil {
+		t.Errorf("Unexpected error for SCSI pass-through config: %s", err)
+	}
+	c.BlkDevices[0].Bus = "scsi1.0"
+	if err := c.validateSCSIPassthrough(); err == nil {
+		t.Errorf("Expected error for SCSI pass-through device without controller")
+	}
+}
+
+func TestBadBlockDeviceSCSIPassthrough(t *testing.T) {
+	base := BlockDevice{Driver: SCSIGeneric, ID: "tape0", File: "/dev/sg3", Format: RAW, Interface: NoInterface, Bus: "scsi0.0"}
+
+	devices := []BlockDevice{base, base, base, base}
+	devices[0].Format = QCOW2
+	devices[1].Bus = ""
+	devices[2].Serial = "tape"
+	devices[3].BlockSize = 4096
+	for _, d := range devices {
+		if err := d.Valid(); err == nil {
+			t.Errorf("Expected error for invalid BlockDevice %+v", d)
+		}
+	}
+}
+
 // FIXME: add Scsi + Rotation_rate good/bad tests
 // FIXME: add Rotational + Virtio bad test
 
@@ -190,3 +436,166 @@ func TestAppendVVFatBlockDevInvaidMode(t *testing.T) {
 		t.Fatalf("expected FATMode invalid error, got nil")
 	}
 }
+
+func TestCreateMissingDisks(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "qemu-img")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> "+logFile+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	origPath := diskimage.QemuImgPath
+	diskimage.QemuImgPath = script
+	t.Cleanup(func() { diskimage.QemuImgPath = origPath })
+
+	existing := filepath.Join(dir, "existing.qcow2")
+	if err := os.WriteFile(existing, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{
+		BlkDevices: []BlockDevice{
+			{ID: "hd0", File: filepath.Join(dir, "root.qcow2"), Format: QCOW2, Size: "20G"},
+			{ID: "hd1", File: existing, Format: QCOW2, Size: "20G"},
+			{ID: "hd2", File: filepath.Join(dir, "data.img"), Format: RAW, Size: "1G"},
+			{ID: "hd3", File: filepath.Join(dir, "nosize.qcow2"), Format: QCOW2},
+		},
+	}
+	if err := c.CreateMissingDisks(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	content, _ := os.ReadFile(logFile)
+	expected := "create -f qcow2 " + filepath.Join(dir, "root.qcow2") + " 20G\n" +
+		"create -f raw " + filepath.Join(dir, "data.img") + " 1G\n"
+	if string(content) != expected {
+		t.Fatalf("Expected qemu-img calls\n%s\nfound\n%s", expected, content)
+	}
+
+	c = &Config{
+		BlkDevices: []BlockDevice{
+			{ID: "hd0", File: filepath.Join(dir, "root.luks"), Format: LUKS, Size: "20G"},
+		},
+	}
+	if err := c.CreateMissingDisks(context.Background()); err == nil {
+		t.Fatalf("Expected error creating a luks image")
+	}
+}
+
+func TestChangeCDROM(t *testing.T) {
+	c := &Config{
+		BlkDevices: []BlockDevice{
+			{Driver: VirtioBlock, ID: "hd0", File: "disk.qcow2", Format: QCOW2, Interface: NoInterface},
+			{Driver: IDECDROM, ID: "cdrom0", File: "old.iso", Format: RAW, Interface: NoInterface, Media: "cdrom"},
+		},
+	}
+
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("blockdev-change-medium", nil, "return", nil)
+	buf.AddCommand("eject", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	ctx := context.Background()
+	if err := c.ChangeCDROM(ctx, q, "hd0", "new.iso"); err == nil {
+		t.Errorf("Expected error changing the medium of a disk")
+	}
+	if err := c.EjectCDROM(ctx, q, "cdrom1", false); err == nil {
+		t.Errorf("Expected error ejecting a missing cdrom")
+	}
+	if err := c.ChangeCDROM(ctx, q, "cdrom0", "new.iso"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.BlkDevices[1].File != "new.iso" {
+		t.Errorf("Expected cdrom File new.iso, found %s", c.BlkDevices[1].File)
+	}
+	if err := c.EjectCDROM(ctx, q, "cdrom0", false); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+func TestBlockWriteThreshold(t *testing.T) {
+	c := &Config{
+		BlkDevices: []BlockDevice{
+			{Driver: VirtioBlock, ID: "hd0", File: "disk.qcow2", Format: QCOW2, Interface: NoInterface},
+			{Driver: VVFAT, ID: "vvfat0", VVFATDev: VVFATDev{Directory: "/tmp"}},
+		},
+	}
+	blocks := []BlockInfo{
+		{
+			Device: "hd0",
+			QDev:   "/machine/peripheral/hd0/virtio-backend",
+			Inserted: &BlockDeviceInfo{
+				File:     "disk.qcow2",
+				NodeName: "#block123",
+				Driver:   "qcow2",
+				Image:    &diskimage.ImageInfo{Filename: "disk.qcow2", Format: "qcow2", VirtualSize: 1 << 30},
+			},
+		},
+		{QDev: "/machine/peripheral-anon/device[0]", Inserted: &BlockDeviceInfo{NodeName: "vvfat0", Driver: "vvfat"}},
+		{Device: "pflash0"},
+	}
+
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	stats := []BlockStats{
+		{Device: "hd0", NodeName: "#block123", Parent: &BlockStats{NodeName: "#block045"}},
+		{NodeName: "vvfat0"},
+	}
+	buf.AddCommand("query-block", nil, "return", blocks)
+	buf.AddCommand("query-block", nil, "return", blocks)
+	buf.AddCommand("query-blockstats", nil, "return", stats)
+	args := map[string]interface{}{
+		"node-name":       "#block045",
+		"write-threshold": float64(1 << 29),
+	}
+	buf.AddCommand("block-set-write-threshold", args, "return", nil)
+	buf.AddCommand("query-block", nil, "return", blocks)
+	buf.AddCommand("query-blockstats", nil, "return", stats)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	ctx := context.Background()
+	devices, err := c.QueryBlockDevices(ctx, q)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(devices) != 2 || devices["hd0"].Inserted.Image.VirtualSize != 1<<30 || devices["vvfat0"].Inserted.Driver != "vvfat" {
+		t.Errorf("Unexpected block devices %+v", devices)
+	}
+
+	if err := c.SetBlockWriteThreshold(ctx, q, "hd0", 1<<29); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ev := QMPEvent{
+		Name: "BLOCK_WRITE_THRESHOLD",
+		Data: map[string]interface{}{"node-name": "#block045", "amount-exceeded": 4096, "write-threshold": 1 << 29},
+	}
+	threshold, err := ev.BlockWriteThreshold()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if threshold.AmountExceeded != 4096 || threshold.WriteThreshold != 1<<29 {
+		t.Errorf("Unexpected write threshold event %+v", threshold)
+	}
+	id, err := c.BlockDeviceForNode(ctx, q, threshold.NodeName)
+	if err != nil || id != "hd0" {
+		t.Errorf("Expected BlockDevice hd0, found %s, %v", id, err)
+	}
+
+	if _, err := (QMPEvent{Name: "STOP"}).BlockWriteThreshold(); err == nil {
+		t.Errorf("Expected error for a STOP event")
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
@@ -0,0 +1,217 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BootIndex is the boot order of a device, the firmware tries the devices
+// with a lower index first.  Devices without a BootIndex are tried last.
+type BootIndex int
+
+// MaxBootIndex is the highest BootIndex accepted for a device.
+const MaxBootIndex = 65535
+
+// unsetBootIndex is the BootIndex read from an empty YAML value, the
+// device being read replaces it with a nil BootIndex.
+const unsetBootIndex BootIndex = -1 << 31
+
+// NewBootIndex returns a BootIndex pointer for the device BootIndex fields.
+func NewBootIndex(index int) *BootIndex {
+	bootIndex := BootIndex(index)
+	return &bootIndex
+}
+
+// UnmarshalYAML accepts the BootIndex as an integer or as a string, e.g.
+// bootindex: 1 or bootindex: "1".  An empty string leaves the BootIndex
+// unset, like a missing bootindex.
+func (b *BootIndex) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var indexStr string
+	if err := unmarshal(&indexStr); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(indexStr) == "" {
+		*b = unsetBootIndex
+		return nil
+	}
+
+	index, err := strconv.Atoi(strings.TrimSpace(indexStr))
+	if err != nil {
+		return fmt.Errorf("Invalid BootIndex value: '%s', must be an integer", indexStr)
+	}
+	*b = BootIndex(index)
+
+	return nil
+}
+
+// orNil returns nil for the BootIndex read from an empty YAML value.
+func (b *BootIndex) orNil() *BootIndex {
+	if b != nil && *b == unsetBootIndex {
+		return nil
+	}
+	return b
+}
+
+// UnmarshalYAML reads a BlockDevice, an empty bootindex leaves its BootIndex
+// nil.
+func (blkdev *BlockDevice) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// avoid recursing into this UnmarshalYAML
+	type blockDevice BlockDevice
+	if err := unmarshal((*blockDevice)(blkdev)); err != nil {
+		return err
+	}
+	blkdev.BootIndex = blkdev.BootIndex.orNil()
+
+	return nil
+}
+
+// UnmarshalYAML reads a FloppyDevice, an empty bootindex leaves its
+// BootIndex nil.
+func (fd *FloppyDevice) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// avoid recursing into this UnmarshalYAML
+	type floppyDevice FloppyDevice
+	if err := unmarshal((*floppyDevice)(fd)); err != nil {
+		return err
+	}
+	fd.BootIndex = fd.BootIndex.orNil()
+
+	return nil
+}
+
+// UnmarshalYAML reads a NetDevice, an empty bootindex leaves its BootIndex
+// nil.
+func (netdev *NetDevice) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// avoid recursing into this UnmarshalYAML
+	type netDevice NetDevice
+	if err := unmarshal((*netDevice)(netdev)); err != nil {
+		return err
+	}
+	netdev.BootIndex = netdev.BootIndex.orNil()
+
+	return nil
+}
+
+// param returns the bootindex device parameter, empty for a nil BootIndex.
+func (b *BootIndex) param() string {
+	if b == nil {
+		return ""
+	}
+	return fmt.Sprintf("bootindex=%d", *b)
+}
+
+// bootDevice is a device accepting a BootIndex.
+type bootDevice struct {
+	list      string
+	id        string
+	bootIndex **BootIndex
+}
+
+// bootDevices returns the devices of config accepting a BootIndex.
+func (config *Config) bootDevices() []bootDevice {
+	var devices []bootDevice
+	for i := range config.BlkDevices {
+		blkdev := &config.BlkDevices[i]
+		devices = append(devices, bootDevice{"BlockDevice", blkdev.ID, &blkdev.BootIndex})
+	}
+	for i := range config.FloppyDevices {
+		fd := &config.FloppyDevices[i]
+		devices = append(devices, bootDevice{"FloppyDevice", fd.ID, &fd.BootIndex})
+	}
+	for i := range config.NetDevices {
+		netdev := &config.NetDevices[i]
+		devices = append(devices, bootDevice{"NetDevice", netdev.ID, &netdev.BootIndex})
+	}
+	return devices
+}
+
+// validateBootIndexes checks the BootIndex of the devices are in range and
+// not shared by two devices.
+func (config *Config) validateBootIndexes() error {
+	devices := config.bootDevices()
+	qti := NewQemuTypeIndex()
+	for i, dev := range devices {
+		bootIndex := *dev.bootIndex
+		if bootIndex == nil {
+			continue
+		}
+
+		if *bootIndex < 0 || *bootIndex > MaxBootIndex {
+			return fmt.Errorf("%s ID=%s has BootIndex %d out of range [0, %d]", dev.list, dev.id, *bootIndex, MaxBootIndex)
+		}
+
+		if err := qti.SetBootIndex(int(*bootIndex)); err != nil {
+			for _, other := range devices[:i] {
+				if b := *other.bootIndex; b != nil && *b == *bootIndex {
+					return fmt.Errorf("%s ID=%s has BootIndex %d already used by %s ID=%s", dev.list, dev.id, *bootIndex, other.list, other.id)
+				}
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetBootOrder sets the BootIndex of the devices ids to their position in
+// ids, the first device boots first.  The BootIndex of the other block,
+// floppy and net devices is cleared.
+func (config *Config) SetBootOrder(ids []string) error {
+	devices := config.bootDevices()
+	order := make(map[string]int, len(ids))
+	for i, id := range ids {
+		if _, ok := order[id]; ok {
+			return fmt.Errorf("SetBootOrder has device ID=%s more than once", id)
+		}
+
+		var found []string
+		for _, dev := range devices {
+			if dev.id == id {
+				found = append(found, dev.list)
+			}
+		}
+		if len(found) == 0 {
+			return fmt.Errorf("SetBootOrder has unknown device ID=%s", id)
+		}
+		if len(found) > 1 {
+			return fmt.Errorf("SetBootOrder device ID=%s is ambiguous, it is used by %s", id, strings.Join(found, " and "))
+		}
+
+		order[id] = i
+	}
+
+	for _, dev := range devices {
+		if i, ok := order[dev.id]; ok {
+			*dev.bootIndex = NewBootIndex(i)
+		} else {
+			*dev.bootIndex = nil
+		}
+	}
+
+	return nil
+}
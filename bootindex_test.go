@@ -0,0 +1,160 @@
+package qcli
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestBootIndexYAML(t *testing.T) {
+	var blkdev BlockDevice
+	if err := yaml.Unmarshal([]byte("id: hd0\nbootindex: 1\n"), &blkdev); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if blkdev.BootIndex == nil || *blkdev.BootIndex != 1 {
+		t.Errorf("Expected BootIndex 1, found %v", blkdev.BootIndex)
+	}
+
+	var netdev NetDevice
+	if err := yaml.Unmarshal([]byte("id: net0\nbootindex: \"2\"\n"), &netdev); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if netdev.BootIndex == nil || *netdev.BootIndex != 2 {
+		t.Errorf("Expected BootIndex 2, found %v", netdev.BootIndex)
+	}
+
+	var fd FloppyDevice
+	if err := yaml.Unmarshal([]byte("id: fd0\n"), &fd); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if fd.BootIndex != nil {
+		t.Errorf("Expected no BootIndex, found %d", *fd.BootIndex)
+	}
+
+	// an empty bootindex is unset, as with the former string BootIndex
+	c := &Config{}
+	for _, value := range []string{`""`, `" "`} {
+		doc := []byte("id: dev0\nbootindex: " + value + "\n")
+		var blkdev BlockDevice
+		var netdev NetDevice
+		var fd FloppyDevice
+		for _, dev := range []interface{}{&blkdev, &netdev, &fd} {
+			if err := yaml.Unmarshal(doc, dev); err != nil {
+				t.Fatalf("Unexpected error for bootindex %s: %s", value, err)
+			}
+		}
+		if blkdev.BootIndex != nil || netdev.BootIndex != nil || fd.BootIndex != nil {
+			t.Errorf("Expected no BootIndex for bootindex %s, found %v %v %v", value, blkdev.BootIndex, netdev.BootIndex, fd.BootIndex)
+		}
+		c.BlkDevices = append(c.BlkDevices, blkdev)
+		c.NetDevices = append(c.NetDevices, netdev)
+		c.FloppyDevices = append(c.FloppyDevices, fd)
+	}
+	c.BlkDevices = append(c.BlkDevices, BlockDevice{ID: "hd1", BootIndex: NewBootIndex(0)})
+
+	// the unset BootIndexes are written out as nil and read back
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	var reloaded Config
+	if err := yaml.Unmarshal(data, &reloaded); err != nil {
+		t.Fatalf("Unexpected error reloading:\n%s\n%s", data, err)
+	}
+	if err := reloaded.validateBootIndexes(); err != nil {
+		t.Fatalf("Unexpected error for the reloaded config:\n%s\n%s", data, err)
+	}
+	for _, dev := range reloaded.bootDevices() {
+		bootIndex := *dev.bootIndex
+		if dev.id == "hd1" {
+			if bootIndex == nil || *bootIndex != 0 {
+				t.Errorf("Expected BootIndex 0 for hd1, found %v", bootIndex)
+			}
+		} else if bootIndex != nil {
+			t.Errorf("Expected no BootIndex for %s ID=%s, found %d", dev.list, dev.id, *bootIndex)
+		}
+	}
+
+	if err := yaml.Unmarshal([]byte("id: fd0\nbootindex: first\n"), &fd); err == nil {
+		t.Errorf("Expected error for a non integer BootIndex")
+	}
+}
+
+func TestBadBootIndexes(t *testing.T) {
+	c := &Config{
+		BlkDevices: []BlockDevice{
+			{ID: "hd0", BootIndex: NewBootIndex(0)},
+			{ID: "cd0"},
+		},
+		NetDevices: []NetDevice{
+			{ID: "net0", BootIndex: NewBootIndex(1)},
+		},
+	}
+	if err := c.validateBootIndexes(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	c.NetDevices[0].BootIndex = NewBootIndex(0)
+	if err := c.validateBootIndexes(); err == nil {
+		t.Errorf("Expected error for duplicate BootIndex")
+	}
+
+	c.NetDevices[0].BootIndex = NewBootIndex(-1)
+	if err := c.validateBootIndexes(); err == nil {
+		t.Errorf("Expected error for negative BootIndex")
+	}
+
+	c.NetDevices[0].BootIndex = NewBootIndex(MaxBootIndex + 1)
+	if err := c.validateBootIndexes(); err == nil {
+		t.Errorf("Expected error for BootIndex above MaxBootIndex")
+	}
+}
+
+func TestSetBootOrder(t *testing.T) {
+	c := &Config{
+		BlkDevices: []BlockDevice{
+			{ID: "hd0", BootIndex: NewBootIndex(1)},
+			{ID: "cd0", BootIndex: NewBootIndex(0)},
+		},
+		FloppyDevices: []FloppyDevice{
+			{ID: "fd0", BootIndex: NewBootIndex(2)},
+		},
+		NetDevices: []NetDevice{
+			{ID: "net0"},
+		},
+	}
+	if err := c.SetBootOrder([]string{"hd0", "net0"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := map[string]*BootIndex{
+		"hd0":  NewBootIndex(0),
+		"cd0":  nil,
+		"fd0":  nil,
+		"net0": NewBootIndex(1),
+	}
+	for _, dev := range c.bootDevices() {
+		found := *dev.bootIndex
+		if (found == nil) != (expected[dev.id] == nil) || (found != nil && *found != *expected[dev.id]) {
+			t.Errorf("Unexpected BootIndex for %s: %v", dev.id, found)
+		}
+	}
+	if err := c.validateBootIndexes(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if err := c.SetBootOrder([]string{"cd0", "usb0"}); err == nil {
+		t.Errorf("Expected error for unknown device")
+	}
+	if err := c.SetBootOrder([]string{"cd0", "cd0"}); err == nil {
+		t.Errorf("Expected error for duplicate device")
+	}
+	if c.BlkDevices[1].BootIndex != nil {
+		t.Errorf("Expected boot order to be unchanged on error")
+	}
+
+	c.NetDevices[0].ID = "hd0"
+	if err := c.SetBootOrder([]string{"hd0"}); err == nil {
+		t.Errorf("Expected error for a device ID used by a BlockDevice and a NetDevice")
+	}
+}
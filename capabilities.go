@@ -0,0 +1,276 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities lists the devices, machine types and cpu models supported
+// by a qemu binary.
+type Capabilities struct {
+	// Path is the qemu binary the capabilities were probed from
+	Path string
+
+	// Devices are the -device driver names, including aliases
+	Devices map[string]bool
+
+	// Machines are the -machine type names, including aliases
+	Machines map[string]bool
+
+	// CPUs are the -cpu model names
+	CPUs map[string]bool
+}
+
+type capabilitiesCacheEntry struct {
+	modTime time.Time
+	caps    *Capabilities
+}
+
+var (
+	capabilitiesCacheLock sync.Mutex
+	capabilitiesCache     = make(map[string]capabilitiesCacheEntry)
+)
+
+// GetCapabilities returns the capabilities of the qemu binary at path,
+// probing it with ProbeCapabilities on first use. Results are cached until
+// the binary is modified.
+func GetCapabilities(ctx context.Context, path string) (*Capabilities, error) {
+	if path == "" {
+		path = "qemu-system-x86_64"
+	}
+
+	binPath, err := exec.LookPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find qemu binary %s: %s", path, err)
+	}
+
+	info, err := os.Stat(binPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to stat qemu binary %s: %s", binPath, err)
+	}
+
+	capabilitiesCacheLock.Lock()
+	defer capabilitiesCacheLock.Unlock()
+
+	if entry, ok := capabilitiesCache[binPath]; ok && entry.modTime.Equal(info.ModTime()) {
+		return entry.caps, nil
+	}
+
+	caps, err := ProbeCapabilities(ctx, binPath)
+	if err != nil {
+		return nil, err
+	}
+
+	capabilitiesCache[binPath] = capabilitiesCacheEntry{modTime: info.ModTime(), caps: caps}
+
+	return caps, nil
+}
+
+// ProbeCapabilities runs the qemu binary at path with -device help,
+// -machine help and -cpu help and parses the results. It does not use the
+// cache, see GetCapabilities.
+func ProbeCapabilities(ctx context.Context, path string) (*Capabilities, error) {
+	caps := &Capabilities{Path: path}
+
+	probes := []struct {
+		option string
+		parse  func([]byte) map[string]bool
+		result *map[string]bool
+	}{
+		{"-device", parseDeviceHelp, &caps.Devices},
+		{"-machine", parseMachineHelp, &caps.Machines},
+		{"-cpu", parseCPUHelp, &caps.CPUs},
+	}
+
+	for _, p := range probes {
+		/* #nosec */
+		cmd := exec.CommandContext(ctx, path, "-nodefaults", "-display", "none", p.option, "help")
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to probe %s %s help: %s", path, p.option, err)
+		}
+		*p.result = p.parse(out)
+	}
+
+	return caps, nil
+}
+
+var deviceHelpRegexp = regexp.MustCompile(`^name "([^"]+)"(?:.*alias "([^"]+)")?`)
+
+// parseDeviceHelp parses -device help output lines such as:
+// name "virtio-blk-pci", bus PCI, alias "virtio-blk", desc "..."
+func parseDeviceHelp(out []byte) map[string]bool {
+	devices := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		m := deviceHelpRegexp.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+		devices[m[1]] = true
+		if m[2] != "" {
+			devices[m[2]] = true
+		}
+	}
+
+	return devices
+}
+
+// parseMachineHelp parses -machine help output, the machine type is the
+// first word of each line following the "Supported machines are:" header.
+func parseMachineHelp(out []byte) map[string]bool {
+	machines := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(scanner.Text(), "Supported machines") {
+			continue
+		}
+		machines[fields[0]] = true
+	}
+
+	return machines
+}
+
+// cpuHelpArchPrefixes are the architecture prefixes some targets print in
+// front of each cpu model in -cpu help.
+var cpuHelpArchPrefixes = map[string]bool{
+	"x86":     true,
+	"s390":    true,
+	"PowerPC": true,
+}
+
+// parseCPUHelp parses the "Available CPUs:" section of -cpu help output.
+func parseCPUHelp(out []byte) map[string]bool {
+	cpus := make(map[string]bool)
+	inList := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Available CPUs") {
+			inList = true
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			// the model list ends with a blank line
+			if inList && len(cpus) > 0 {
+				break
+			}
+			continue
+		}
+		if !inList {
+			continue
+		}
+		if cpuHelpArchPrefixes[fields[0]] && len(fields) > 1 {
+			cpus[fields[1]] = true
+		} else {
+			cpus[fields[0]] = true
+		}
+	}
+
+	return cpus
+}
+
+// CheckParams returns an error listing every -device driver, -machine type
+// and -cpu model in params that is not supported by the qemu binary.
+func (caps *Capabilities) CheckParams(params []string) error {
+	var unsupported []string
+
+	for i := 0; i < len(params)-1; i++ {
+		name := strings.SplitN(params[i+1], ",", 2)[0]
+		name = strings.TrimPrefix(name, "driver=")
+		name = strings.TrimPrefix(name, "type=")
+
+		// a -device in JSON syntax, e.g. a virtio-blk with IOThreadVQs
+		if strings.HasPrefix(params[i+1], "{") {
+			var device struct {
+				Driver string `json:"driver"`
+			}
+			if err := json.Unmarshal([]byte(params[i+1]), &device); err == nil {
+				name = device.Driver
+			}
+		}
+
+		switch params[i] {
+		case "-device":
+			if caps.Devices != nil && !caps.Devices[name] {
+				unsupported = append(unsupported, fmt.Sprintf("device %s", name))
+			}
+		case "-machine":
+			// a -machine with only properties, e.g. memory-backend=dimm1
+			if strings.Contains(name, "=") {
+				break
+			}
+			if caps.Machines != nil && !caps.Machines[name] {
+				unsupported = append(unsupported, fmt.Sprintf("machine %s", name))
+			}
+		case "-cpu":
+			if caps.CPUs != nil && !caps.CPUs[name] {
+				unsupported = append(unsupported, fmt.Sprintf("cpu %s", name))
+			}
+		default:
+			continue
+		}
+		i++
+	}
+
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%s does not support: %s", caps.Path, strings.Join(unsupported, ", "))
+	}
+
+	return nil
+}
+
+// checkCapabilities verifies the configured qemu parameters against
+// config.Capabilities. Unsupported parameters are logged, or returned as
+// an error when config.StrictCapabilities is set.
+func (config *Config) checkCapabilities(logger QMPLog) error {
+	if config.Capabilities == nil {
+		return nil
+	}
+
+	err := config.Capabilities.CheckParams(config.qemuParams)
+	if err != nil && !config.StrictCapabilities {
+		logger.Warningf("%s", err)
+		return nil
+	}
+
+	return err
+}
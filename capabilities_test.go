@@ -0,0 +1,176 @@
+package qcli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	deviceHelpOutput = `Controller/Bridge/Hub devices:
+name "pcie-root-port", bus PCI, desc "PCI Express Root Port"
+name "qemu-xhci", bus PCI
+
+Storage devices:
+name "virtio-blk-pci", bus PCI, alias "virtio-blk"
+name "ide-cd", bus IDE, desc "virtual IDE CD-ROM"
+`
+	machineHelpOutput = `Supported machines are:
+microvm              microvm (i386)
+pc                   Standard PC (i440FX + PIIX, 1996) (alias of pc-i440fx-8.2)
+pc-i440fx-8.2        Standard PC (i440FX + PIIX, 1996) (default)
+q35                  Standard PC (Q35 + ICH9, 2009) (alias of pc-q35-8.2)
+none                 empty machine
+`
+	cpuHelpOutputX86 = `Available CPUs:
+x86 486                   (alias configured by machine type)
+x86 Broadwell             Intel Core Processor (Broadwell)
+x86 host                  KVM processor with all supported host features
+x86 max                   Enables all features supported by the accelerator in the current host
+
+Recognized CPUID flags:
+  3dnow 3dnowext 3dnowprefetch abm ace2 ace2-en acpi adx aes amd-no-ssb
+`
+	cpuHelpOutputArm = `Available CPUs:
+  a64fx
+  cortex-a57
+  host
+  max
+`
+)
+
+func TestParseCapabilities(t *testing.T) {
+	devices := parseDeviceHelp([]byte(deviceHelpOutput))
+	for _, d := range []string{"pcie-root-port", "qemu-xhci", "virtio-blk-pci", "virtio-blk", "ide-cd"} {
+		if !devices[d] {
+			t.Errorf("Expected device %s in %v", d, devices)
+		}
+	}
+	if len(devices) != 5 {
+		t.Errorf("Expected 5 devices, found %v", devices)
+	}
+
+	machines := parseMachineHelp([]byte(machineHelpOutput))
+	for _, m := range []string{"microvm", "pc", "pc-i440fx-8.2", "q35", "none"} {
+		if !machines[m] {
+			t.Errorf("Expected machine %s in %v", m, machines)
+		}
+	}
+	if len(machines) != 5 {
+		t.Errorf("Expected 5 machines, found %v", machines)
+	}
+
+	cpus := parseCPUHelp([]byte(cpuHelpOutputX86))
+	for _, c := range []string{"486", "Broadwell", "host", "max"} {
+		if !cpus[c] {
+			t.Errorf("Expected cpu %s in %v", c, cpus)
+		}
+	}
+	if len(cpus) != 4 {
+		t.Errorf("Expected 4 cpus, found %v", cpus)
+	}
+
+	cpus = parseCPUHelp([]byte(cpuHelpOutputArm))
+	for _, c := range []string{"a64fx", "cortex-a57", "host", "max"} {
+		if !cpus[c] {
+			t.Errorf("Expected cpu %s in %v", c, cpus)
+		}
+	}
+}
+
+func writeFakeQemu(t *testing.T) string {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"device.txt":  deviceHelpOutput,
+		"machine.txt": machineHelpOutput,
+		"cpu.txt":     cpuHelpOutputX86,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+
+	script := `#!/bin/sh
+dir=$(dirname "$0")
+case "$*" in
+	*"-device help"*) cat "$dir/device.txt" ;;
+	*"-machine help"*) cat "$dir/machine.txt" ;;
+	*"-cpu help"*) cat "$dir/cpu.txt" ;;
+	*) exit 1 ;;
+esac
+`
+	path := filepath.Join(dir, "qemu-system-fake")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake qemu: %s", err)
+	}
+
+	return path
+}
+
+func TestGetCapabilities(t *testing.T) {
+	path := writeFakeQemu(t)
+
+	caps, err := GetCapabilities(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !caps.Devices["virtio-blk-pci"] || !caps.Machines["q35"] || !caps.CPUs["host"] {
+		t.Fatalf("Unexpected capabilities %+v", caps)
+	}
+
+	cached, err := GetCapabilities(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if cached != caps {
+		t.Fatalf("Expected cached capabilities to be returned")
+	}
+
+	if _, err := GetCapabilities(context.Background(), filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("Expected error for missing qemu binary")
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	caps := &Capabilities{
+		Path:     "qemu-system-fake",
+		Devices:  parseDeviceHelp([]byte(deviceHelpOutput)),
+		Machines: parseMachineHelp([]byte(machineHelpOutput)),
+		CPUs:     parseCPUHelp([]byte(cpuHelpOutputX86)),
+	}
+
+	params := []string{"-machine", "q35,accel=kvm", "-cpu", "host,+vmx", "-device", "virtio-blk-pci,drive=hd0",
+		"-device", `{"driver":"virtio-blk-pci","drive":"hd1","iothread-vq-mapping":[{"iothread":"iot0"}]}`, "-machine", "memory-backend=dimm1"}
+	if err := caps.CheckParams(params); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	params = []string{"-machine", "virt", "-cpu", "cortex-a57", "-device", "virtio-gpu-pci", "-name", "vm0"}
+	expected := "qemu-system-fake does not support: machine virt, cpu cortex-a57, device virtio-gpu-pci"
+	err := caps.CheckParams(params)
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected error %q, got %v", expected, err)
+	}
+
+	c := &Config{
+		Machine: Machine{
+			Type: MachineTypeVirt,
+		},
+		Capabilities: caps,
+	}
+	if _, err := ConfigureParams(c, nil); err != nil {
+		t.Fatalf("Expected warning only, got error: %s", err)
+	}
+
+	c = &Config{
+		Machine: Machine{
+			Type: MachineTypeVirt,
+		},
+		Capabilities:       caps,
+		StrictCapabilities: true,
+	}
+	if _, err := ConfigureParams(c, nil); err == nil {
+		t.Fatalf("Expected error with StrictCapabilities")
+	}
+}
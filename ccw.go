@@ -0,0 +1,159 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CCWCssID is the channel subsystem id used for virtio-ccw devices
+	CCWCssID = 0xfe
+
+	// CCWSsIDMax is the highest subchannel set id
+	CCWSsIDMax = 3
+
+	// CCWDevNoMax is the highest device number in a subchannel set
+	CCWDevNoMax = 0xffff
+)
+
+// CCWBus tracks the virtio-ccw device numbers (devno) in use so devices
+// without an explicit DevNo can be assigned a unique one.
+type CCWBus struct {
+	used map[string]bool
+	next int
+
+	// exhausted is set once GetDevNo had no devno left to allocate
+	exhausted bool
+}
+
+// ParseCCWDevNo parses a devno of the form fe.S.NNNN and returns it in
+// its canonical form, e.g. fe.0.000a.
+func ParseCCWDevNo(devno string) (string, error) {
+	toks := strings.Split(devno, ".")
+	if len(toks) != 3 {
+		return "", fmt.Errorf("Invalid CCW devno %q, must be fe.S.NNNN", devno)
+	}
+
+	cssid, err := strconv.ParseUint(toks[0], 16, 8)
+	if err != nil || cssid != CCWCssID {
+		return "", fmt.Errorf("Invalid CCW devno %q, channel subsystem id must be fe", devno)
+	}
+
+	ssid, err := strconv.ParseUint(toks[1], 16, 8)
+	if err != nil || ssid > CCWSsIDMax {
+		return "", fmt.Errorf("Invalid CCW devno %q, subchannel set id must be 0-%d", devno, CCWSsIDMax)
+	}
+
+	num, err := strconv.ParseUint(toks[2], 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("Invalid CCW devno %q, device number must be 0000-ffff", devno)
+	}
+
+	return fmt.Sprintf("%x.%x.%04x", cssid, ssid, num), nil
+}
+
+// Reserve marks devno as used, returning an error if it is invalid or
+// already in use.
+func (bus *CCWBus) Reserve(devno string) error {
+	canonical, err := ParseCCWDevNo(devno)
+	if err != nil {
+		return err
+	}
+
+	if bus.used == nil {
+		bus.used = make(map[string]bool)
+	}
+
+	if bus.used[canonical] {
+		return fmt.Errorf("CCW devno %s is already in use", devno)
+	}
+	bus.used[canonical] = true
+
+	return nil
+}
+
+// GetDevNo returns devno if set, otherwise the next free devno in
+// subchannel set 0. An empty string is returned if none is left, Err then
+// returns an error.
+func (bus *CCWBus) GetDevNo(devno string) string {
+	if bus.used == nil {
+		bus.used = make(map[string]bool)
+	}
+
+	if devno != "" {
+		if canonical, err := ParseCCWDevNo(devno); err == nil {
+			bus.used[canonical] = true
+		}
+		return devno
+	}
+
+	for ; bus.next <= CCWDevNoMax; bus.next++ {
+		candidate := fmt.Sprintf("%x.0.%04x", CCWCssID, bus.next)
+		if !bus.used[candidate] {
+			bus.used[candidate] = true
+			bus.next++
+			return candidate
+		}
+	}
+
+	bus.exhausted = true
+	return ""
+}
+
+// Err returns an error if a devno could not be allocated by GetDevNo.
+func (bus *CCWBus) Err() error {
+	if bus.exhausted {
+		return fmt.Errorf("No CCW devno left in subchannel set 0, set the DevNo of some devices")
+	}
+	return nil
+}
+
+// reserveCCWDevNos reserves the explicit DevNo of every device so that
+// auto-allocated devnos can not collide with them.
+func (config *Config) reserveCCWDevNos() error {
+	var errors []string
+
+	for _, list := range orderedDeviceLists() {
+		for _, d := range list.devices(config) {
+			devNo := list.identity(config, d).devNo
+			if devNo == "" {
+				continue
+			}
+
+			if err := config.ccwBus.Reserve(devNo); err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Failed to reserve %d CCW devnos: %s", len(errors), strings.Join(errors, ", "))
+	}
+
+	return nil
+}
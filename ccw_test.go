@@ -0,0 +1,107 @@
+package qcli
+
+import "testing"
+
+func TestParseCCWDevNo(t *testing.T) {
+	testCases := map[string]string{
+		"fe.0.0000": "fe.0.0000",
+		"fe.1.1234": "fe.1.1234",
+		"FE.3.a":    "fe.3.000a",
+	}
+
+	for in, expected := range testCases {
+		devno, err := ParseCCWDevNo(in)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %s: %s", in, err)
+		}
+		if devno != expected {
+			t.Fatalf("Expected %s parsing %s, got %s", expected, in, devno)
+		}
+	}
+
+	for _, in := range []string{"", "fe.0", "fd.0.0001", "fe.4.0001", "fe.0.10000", "fe.0.xyz"} {
+		if _, err := ParseCCWDevNo(in); err == nil {
+			t.Errorf("Expected error parsing %q", in)
+		}
+	}
+}
+
+func TestCCWBusAllocation(t *testing.T) {
+	var bus CCWBus
+
+	if err := bus.Reserve("fe.0.0001"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := bus.Reserve("fe.0.1"); err == nil {
+		t.Fatalf("Expected error reserving a devno twice")
+	}
+
+	expected := []string{"fe.0.0000", "fe.0.0002", "fe.0.0003"}
+	for _, e := range expected {
+		if devno := bus.GetDevNo(""); devno != e {
+			t.Fatalf("Expected devno %s, got %s", e, devno)
+		}
+	}
+
+	if devno := bus.GetDevNo("fe.0.0004"); devno != "fe.0.0004" {
+		t.Fatalf("Expected explicit devno to be returned, got %s", devno)
+	}
+	if devno := bus.GetDevNo(""); devno != "fe.0.0005" {
+		t.Fatalf("Expected devno fe.0.0005, got %s", devno)
+	}
+	if err := bus.Err(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	bus.next = CCWDevNoMax
+	if devno := bus.GetDevNo(""); devno != "fe.0.ffff" {
+		t.Fatalf("Expected devno fe.0.ffff, got %s", devno)
+	}
+	if devno := bus.GetDevNo(""); devno != "" {
+		t.Fatalf("Expected no devno left, got %s", devno)
+	}
+	if err := bus.Err(); err == nil {
+		t.Fatalf("Expected error once the devnos are exhausted")
+	}
+}
+
+func TestAppendDevicesCCWDevNo(t *testing.T) {
+	c := &Config{
+		RngDevices: []RngDevice{
+			{
+				ID:        "rng0",
+				Driver:    VirtioRng,
+				Transport: TransportCCW,
+				DevNo:     "fe.0.0000",
+			},
+			{
+				ID:        "rng1",
+				Driver:    VirtioRng,
+				Transport: TransportCCW,
+			},
+		},
+	}
+
+	testConfig(c, "-object rng-random,id=rng0 -device virtio-rng-ccw,rng=rng0,addr=0x1e,devno=fe.0.0000 -object rng-random,id=rng1 -device virtio-rng-ccw,rng=rng1,addr=0x1d,devno=fe.0.0001", t)
+
+	c = &Config{
+		RngDevices: []RngDevice{
+			{
+				ID:        "rng0",
+				Driver:    VirtioRng,
+				Transport: TransportCCW,
+				DevNo:     "fe.0.0000",
+			},
+			{
+				ID:        "rng1",
+				Driver:    VirtioRng,
+				Transport: TransportCCW,
+				DevNo:     "fe.0.0000",
+			},
+		},
+	}
+
+	if err := c.appendDevices(); err == nil {
+		t.Fatalf("Expected error for duplicate CCW devno")
+	}
+}
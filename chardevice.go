@@ -96,6 +96,18 @@ type CharDevice struct {
 
 	// Signal will enable signal processing if 'on', or not if 'off'
 	Signal string `yaml:"signal"`
+
+	// Host is the address a TCP Socket backend listens on, defaults to
+	// all addresses.
+	Host string `yaml:"host"`
+
+	// Port is the TCP port a Socket backend listens on, used instead of
+	// Path.
+	Port string `yaml:"port"`
+
+	// TLSCreds is the ID of a server TLSCredsObject encrypting a TCP
+	// Socket backend.
+	TLSCreds string `yaml:"tls-creds"`
 }
 
 // VirtioSerialTransport is a map of the virtio-serial device name that
@@ -111,9 +123,38 @@ func (cdev CharDevice) Valid() error {
 	if cdev.ID == "" {
 		return fmt.Errorf("CharDevice missing ID value: %+v", cdev)
 	}
-	// Stdio backend does not require a path
-	if cdev.Backend != Stdio && cdev.Path == "" {
-		return fmt.Errorf("CharDevice with Backend='%s' must have Path", cdev.Backend)
+	switch cdev.Backend {
+	case Stdio:
+		// Stdio backend does not require a path
+	case PTY:
+		// the pts is allocated by qemu, see QMP.GetPtsPath
+		if cdev.Path != "" {
+			return fmt.Errorf("CharDevice with Backend='%s' must not have Path", cdev.Backend)
+		}
+	case Socket:
+		if cdev.Path == "" && cdev.Port == "" {
+			return fmt.Errorf("CharDevice with Backend='%s' must have Path or Port", cdev.Backend)
+		}
+		if cdev.Path != "" && (cdev.Port != "" || cdev.Host != "") {
+			return fmt.Errorf("CharDevice with Backend='%s' has Path and Port or Host set, only one allowed", cdev.Backend)
+		}
+	default:
+		if cdev.Path == "" {
+			return fmt.Errorf("CharDevice with Backend='%s' must have Path", cdev.Backend)
+		}
+	}
+	if cdev.Backend != Socket && (cdev.Port != "" || cdev.Host != "") {
+		return fmt.Errorf("CharDevice with Backend='%s' does not support Port or Host", cdev.Backend)
+	}
+	// qemu only supports TLS over TCP sockets
+	if cdev.TLSCreds != "" && cdev.Port == "" {
+		return fmt.Errorf("CharDevice ID=%s with TLSCreds requires a Socket Backend with Port", cdev.ID)
+	}
+	if _, err := getConfigOnOff("Mux", "mux", cdev.Mux); err != nil {
+		return fmt.Errorf("CharDevice ID=%s: %s", cdev.ID, err)
+	}
+	if _, err := getConfigOnOff("Signal", "signal", cdev.Signal); err != nil {
+		return fmt.Errorf("CharDevice ID=%s: %s", cdev.ID, err)
 	}
 
 	return nil
@@ -147,25 +188,34 @@ func (cdev CharDevice) QemuParams(config *Config) []string {
 		if config.Knobs.IOMMUPlatform {
 			deviceParams = append(deviceParams, "iommu_platform=on")
 		}
-		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", cdev.DevNo))
+		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(cdev.DevNo)))
 	}
 
 	cdevParams = append(cdevParams, string(cdev.Backend))
 	cdevParams = append(cdevParams, fmt.Sprintf("id=%s", cdev.ID))
 	switch cdev.Backend {
 	case Socket:
-		cdevParams = append(cdevParams, fmt.Sprintf("path=%s,server=on,wait=off", cdev.Path))
+		if cdev.Port != "" {
+			if cdev.Host != "" {
+				cdevParams = append(cdevParams, fmt.Sprintf("host=%s", cdev.Host))
+			}
+			cdevParams = append(cdevParams, fmt.Sprintf("port=%s,server=on,wait=off", cdev.Port))
+		} else {
+			cdevParams = append(cdevParams, fmt.Sprintf("path=%s,server=on,wait=off", cdev.Path))
+		}
+		if cdev.TLSCreds != "" {
+			cdevParams = append(cdevParams, fmt.Sprintf("tls-creds=%s", cdev.TLSCreds))
+		}
 	case File:
 		cdevParams = append(cdevParams, fmt.Sprintf("path=%s", cdev.Path))
 	}
 
-	cParam := getConfigOnOff("Mux", "mux", cdev.Mux)
-	if cParam != "" {
+	// Mux and Signal values are checked by Valid
+	if cParam, _ := getConfigOnOff("Mux", "mux", cdev.Mux); cParam != "" {
 		cdevParams = append(cdevParams, cParam)
 	}
 
-	cParam = getConfigOnOff("Signal", "signal", cdev.Signal)
-	if cParam != "" {
+	if cParam, _ := getConfigOnOff("Signal", "signal", cdev.Signal); cParam != "" {
 		cdevParams = append(cdevParams, cParam)
 	}
 
@@ -5,6 +5,7 @@ import "testing"
 var (
 	deviceCharDeviceBackendFile     = "-chardev file,id=serial0,path=/tmp/serial.log"
 	deviceCharDeviceBackendSocket   = "-chardev socket,id=serial0,path=/tmp/console.sock,server=on,wait=off"
+	deviceCharDeviceBackendPTY      = "-chardev pty,id=serial0"
 	deviceCharDeviceBackendStdioMux = "-chardev stdio,id=serial0,mux=on,signal=off"
 	deviceCharDeviceMultiple        = "-chardev socket,id=serial0,path=/tmp/console.sock,server=on,wait=off -chardev socket,id=monitor0,path=/tmp/monitor.sock,server=on,wait=off"
 	deviceCharDevicePCIDriver       = "-serial none -chardev socket,id=serial0,path=/tmp/console.sock,server=on,wait=off -device pci-serial,id=pciser0,chardev=serial0"
@@ -42,6 +43,20 @@ func TestAppendCharDeviceFile(t *testing.T) {
 	testAppend(chardev, deviceCharDeviceBackendFile, t)
 }
 
+func TestAppendCharDeviceBackendPTY(t *testing.T) {
+	chardev := CharDevice{
+		Driver:  LegacySerial,
+		Backend: PTY,
+		ID:      "serial0",
+	}
+	testAppend(chardev, deviceCharDeviceBackendPTY, t)
+
+	chardev.Path = "/dev/pts/3"
+	if err := chardev.Valid(); err == nil {
+		t.Errorf("Expected error for PTY CharDevice with Path")
+	}
+}
+
 func TestAppendCharDeviceBackendStdioMux(t *testing.T) {
 	chardev := CharDevice{
 		Driver:  LegacySerial,
@@ -119,3 +134,31 @@ func TestAppendPCIDriver2x1(t *testing.T) {
 	c.SerialDevices = []SerialDevice{pcidev}
 	testConfig(c, deviceCharDevicePCIDriver2x, t)
 }
+
+func TestBadCharDeviceOnOff(t *testing.T) {
+	cdevs := []CharDevice{
+		{ID: "char0", Backend: Stdio, Mux: "enabled"},
+		{ID: "char0", Backend: Stdio, Signal: "no"},
+	}
+
+	for _, cdev := range cdevs {
+		if err := cdev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid CharDevice %+v", cdev)
+		}
+	}
+}
+
+func TestBadCharDeviceSocket(t *testing.T) {
+	cdevs := []CharDevice{
+		{ID: "char0", Backend: Socket},
+		{ID: "char0", Backend: Socket, Path: "/tmp/console.sock", Port: "4555"},
+		{ID: "char0", Backend: Stdio, Port: "4555"},
+		{ID: "char0", Backend: Socket, Path: "/tmp/console.sock", TLSCreds: "tls0"},
+	}
+
+	for _, cdev := range cdevs {
+		if err := cdev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid CharDevice %+v", cdev)
+		}
+	}
+}
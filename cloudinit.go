@@ -0,0 +1,243 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// CloudInitLabel is the volume label cloud-init looks for to find a
+	// NoCloud seed
+	CloudInitLabel = "cidata"
+
+	// CloudInitDeviceID is the ID of the BlockDevice attaching the seed
+	CloudInitDeviceID = "cidata"
+)
+
+// CloudInitISOTools are the commands, in order of preference, used to
+// create a NoCloud seed ISO.
+var CloudInitISOTools = [][]string{
+	{"genisoimage"},
+	{"mkisofs"},
+	{"xorriso", "-as", "mkisofs"},
+}
+
+// CloudInit describes a cloud-init NoCloud seed, each document may be
+// given inline or as a path to a file.  The seed is attached to the VM as a
+// read-only disk labelled cidata.
+type CloudInit struct {
+	UserData     string `yaml:"user-data"`
+	UserDataFile string `yaml:"user-data-file"`
+
+	// MetaData defaults to the instance-id and local-hostname of the VM
+	// Name or UUID
+	MetaData     string `yaml:"meta-data"`
+	MetaDataFile string `yaml:"meta-data-file"`
+
+	NetworkConfig     string `yaml:"network-config"`
+	NetworkConfigFile string `yaml:"network-config-file"`
+
+	// ISO builds an ISO image with one of CloudInitISOTools instead of
+	// exposing the seed directory as a VVFAT disk
+	ISO bool `yaml:"iso"`
+}
+
+// enabled returns true if any cloud-init document is configured.
+func (ci CloudInit) enabled() bool {
+	return ci.UserData != "" || ci.UserDataFile != "" ||
+		ci.MetaData != "" || ci.MetaDataFile != "" ||
+		ci.NetworkConfig != "" || ci.NetworkConfigFile != ""
+}
+
+// Valid returns an error if a document is given both inline and as a file.
+func (ci CloudInit) Valid() error {
+	docs := []struct {
+		name   string
+		inline string
+		file   string
+	}{
+		{"UserData", ci.UserData, ci.UserDataFile},
+		{"MetaData", ci.MetaData, ci.MetaDataFile},
+		{"NetworkConfig", ci.NetworkConfig, ci.NetworkConfigFile},
+	}
+	for _, d := range docs {
+		if d.inline != "" && d.file != "" {
+			return fmt.Errorf("CloudInit %s and %sFile are mutually exclusive", d.name, d.name)
+		}
+	}
+	return nil
+}
+
+// cloudInitDocuments returns the content of the NoCloud seed files by file name.
+func (config *Config) cloudInitDocuments() (map[string][]byte, error) {
+	ci := config.CloudInit
+	docs := make(map[string][]byte)
+
+	read := func(name, inline, file, fallback string) error {
+		switch {
+		case file != "":
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("Failed to read CloudInit %s: %s", name, err)
+			}
+			docs[name] = content
+		case inline != "":
+			docs[name] = []byte(inline)
+		case fallback != "":
+			docs[name] = []byte(fallback)
+		}
+		return nil
+	}
+
+	instanceID := config.Name
+	if instanceID == "" {
+		instanceID = config.UUID
+	}
+	metaData := fmt.Sprintf("instance-id: %s\n", instanceID)
+	if config.Name != "" {
+		metaData += fmt.Sprintf("local-hostname: %s\n", config.Name)
+	}
+
+	if err := read("user-data", ci.UserData, ci.UserDataFile, "#cloud-config\n"); err != nil {
+		return nil, err
+	}
+	if err := read("meta-data", ci.MetaData, ci.MetaDataFile, metaData); err != nil {
+		return nil, err
+	}
+	if err := read("network-config", ci.NetworkConfig, ci.NetworkConfigFile, ""); err != nil {
+		return nil, err
+	}
+
+	return docs, nil
+}
+
+// createCloudInitISO creates the ISO image isoPath holding files with the
+// first available tool of CloudInitISOTools.
+func createCloudInitISO(ctx context.Context, isoPath string, files []string) error {
+	for _, tool := range CloudInitISOTools {
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			continue
+		}
+
+		args := append(append([]string{}, tool[1:]...), "-output", isoPath, "-volid", CloudInitLabel, "-joliet", "-rock")
+		args = append(args, files...)
+
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, tool[0], args...)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %v: %s", tool[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("No tool to create the cloud-init ISO found, install genisoimage, mkisofs or xorriso")
+}
+
+// appendCloudInit writes the NoCloud seed to a temporary directory, removed
+// by Cleanup, and attaches it as a read-only disk.
+func (config *Config) appendCloudInit() error {
+	if !config.CloudInit.enabled() {
+		return nil
+	}
+
+	if err := config.CloudInit.Valid(); err != nil {
+		return err
+	}
+
+	docs, err := config.cloudInitDocuments()
+	if err != nil {
+		return err
+	}
+
+	seedDir, err := os.MkdirTemp(config.StateDir, "cloud-init-")
+	if err != nil {
+		return fmt.Errorf("Failed to create cloud-init seed directory: %s", err)
+	}
+
+	// the directory is removed last, once empty
+	var files []string
+	defer func() {
+		config.tempFiles = append(config.tempFiles, files...)
+		config.tempFiles = append(config.tempFiles, seedDir)
+	}()
+
+	for _, name := range []string{"user-data", "meta-data", "network-config"} {
+		content, ok := docs[name]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(seedDir, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return fmt.Errorf("Failed to write cloud-init %s: %s", name, err)
+		}
+		files = append(files, path)
+	}
+
+	if !config.CloudInit.ISO {
+		config.devices = append(config.devices, BlockDevice{
+			Driver: VVFAT,
+			ID:     CloudInitDeviceID,
+			VVFATDev: VVFATDev{
+				Directory: seedDir,
+				Driver:    VirtioBlock,
+				FATMode:   FATMode32,
+				Label:     strings.ToUpper(CloudInitLabel),
+			},
+		})
+		return nil
+	}
+
+	ctx := config.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	isoPath := filepath.Join(seedDir, "seed.iso")
+	if err := createCloudInitISO(ctx, isoPath, files); err != nil {
+		return err
+	}
+	files = append([]string{isoPath}, files...)
+
+	config.devices = append(config.devices, BlockDevice{
+		Driver:    VirtioBlock,
+		ID:        CloudInitDeviceID,
+		File:      isoPath,
+		Interface: NoInterface,
+		Format:    RAW,
+		Media:     "cdrom",
+		ReadOnly:  true,
+	})
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package qcli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendCloudInitVVFAT(t *testing.T) {
+	c := &Config{
+		Name:     "vm1",
+		StateDir: t.TempDir(),
+		CloudInit: CloudInit{
+			UserData:      "#cloud-config\npassword: passw0rd\n",
+			NetworkConfig: "version: 2\n",
+		},
+	}
+	params, err := ConfigureParams(c, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	seedDir := c.tempFiles[len(c.tempFiles)-1]
+	if filepath.Dir(seedDir) != c.StateDir {
+		t.Fatalf("Expected seed directory in %s, found %s", c.StateDir, seedDir)
+	}
+
+	expected := fmt.Sprintf("-name vm1 -blockdev driver=vvfat,node-name=cidata,dir=%s,fat-type=32,floppy=off,label=CIDATA,read-only=on -device virtio-blk-pci,drive=cidata", seedDir)
+	if result := strings.Join(params, " "); result != expected {
+		t.Fatalf("Failed to append parameters\nexpected[%s]\n!=\n   found[%s]", expected, result)
+	}
+
+	docs := map[string]string{
+		"user-data":      "#cloud-config\npassword: passw0rd\n",
+		"meta-data":      "instance-id: vm1\nlocal-hostname: vm1\n",
+		"network-config": "version: 2\n",
+	}
+	for name, content := range docs {
+		found, err := os.ReadFile(filepath.Join(seedDir, name))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if string(found) != content {
+			t.Errorf("Expected %s content %q, found %q", name, content, found)
+		}
+	}
+
+	if err := c.Cleanup(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if PathExists(seedDir) {
+		t.Errorf("Expected seed directory %s to be removed by Cleanup", seedDir)
+	}
+}
+
+func TestAppendCloudInitISO(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "genisoimage")
+	// genisoimage -output <iso> ...
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > \"$2\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	origTools := CloudInitISOTools
+	CloudInitISOTools = [][]string{{filepath.Join(dir, "missing")}, {script}}
+	t.Cleanup(func() { CloudInitISOTools = origTools })
+
+	userData := filepath.Join(dir, "user-data.yaml")
+	if err := os.WriteFile(userData, []byte("#cloud-config\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{
+		StateDir: dir,
+		UUID:     "a5ab3d6e-8a1a-4b44-8c11-7a8a7c1d3a9f",
+		CloudInit: CloudInit{
+			UserDataFile: userData,
+			ISO:          true,
+		},
+	}
+	if err := c.appendCloudInit(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := c.appendDevices(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	seedDir := c.tempFiles[len(c.tempFiles)-1]
+	iso := filepath.Join(seedDir, "seed.iso")
+	args, _ := os.ReadFile(iso)
+	expectedArgs := fmt.Sprintf("-output %s -volid cidata -joliet -rock %s %s", iso, filepath.Join(seedDir, "user-data"), filepath.Join(seedDir, "meta-data"))
+	if strings.TrimSpace(string(args)) != expectedArgs {
+		t.Errorf("Expected genisoimage args\n%s\nfound\n%s", expectedArgs, args)
+	}
+
+	metaData, _ := os.ReadFile(filepath.Join(seedDir, "meta-data"))
+	if string(metaData) != "instance-id: a5ab3d6e-8a1a-4b44-8c11-7a8a7c1d3a9f\n" {
+		t.Errorf("Unexpected meta-data %q", metaData)
+	}
+
+	expected := fmt.Sprintf("-drive file=%s,id=cidata,if=none,format=raw,media=cdrom,readonly=on -device virtio-blk-pci,drive=cidata,serial=cidata", iso)
+	if result := strings.Join(c.qemuParams, " "); !strings.HasPrefix(result, expected) {
+		t.Fatalf("Failed to append parameters\nexpected[%s...]\n!=\n   found[%s]", expected, result)
+	}
+
+	if err := c.Cleanup(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if PathExists(seedDir) {
+		t.Errorf("Expected seed directory %s to be removed by Cleanup", seedDir)
+	}
+}
+
+func TestBadCloudInit(t *testing.T) {
+	bad := []CloudInit{
+		{UserData: "#cloud-config\n", UserDataFile: "user-data"},
+		{MetaData: "instance-id: vm1\n", MetaDataFile: "meta-data"},
+		{NetworkConfig: "version: 2\n", NetworkConfigFile: "network-config"},
+	}
+	for _, ci := range bad {
+		if err := ci.Valid(); err == nil {
+			t.Errorf("Expected error for invalid CloudInit %+v", ci)
+		}
+	}
+
+	c := &Config{StateDir: t.TempDir(), CloudInit: CloudInit{UserDataFile: "/nonexistent/user-data"}}
+	if err := c.appendCloudInit(); err == nil {
+		t.Errorf("Expected error for missing CloudInit UserDataFile")
+	}
+}
@@ -0,0 +1,179 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ClusterConfig holds several independent VMs sharing defaults, e.g.
+//
+//	defaults:
+//	  memory:
+//	    size-string: 2G
+//	vms:
+//	  - name: vm1
+//	  - name: vm2
+//	    memory:
+//	      size-string: 4G
+//
+// Each VM is its Defaults overridden by its own Config, see VMConfig.
+type ClusterConfig struct {
+	// Defaults are the settings shared by all the VMs
+	Defaults Config `yaml:"defaults"`
+
+	// ReplaceLists makes the lists of a VM replace the ones of Defaults
+	// instead of being appended to them
+	ReplaceLists bool `yaml:"replace-lists"`
+
+	// VMs are the VMs of the cluster, identified by their Name
+	VMs []Config `yaml:"vms"`
+}
+
+// Valid returns an error if a VM has no name or the same name as another.
+func (cluster *ClusterConfig) Valid() error {
+	names := make(map[string]bool)
+	for i, vm := range cluster.VMs {
+		if vm.Name == "" {
+			return fmt.Errorf("ClusterConfig VM %d has empty Name field", i)
+		}
+		if names[vm.Name] {
+			return fmt.Errorf("ClusterConfig VM Name=%s is defined more than once", vm.Name)
+		}
+		names[vm.Name] = true
+	}
+
+	return nil
+}
+
+// VMConfig returns the Config of the named VM, its settings override
+// Defaults as done by MergeConfig: values set by the VM win, settings listed
+// in its Unset are reset and lists are appended unless ReplaceLists is set.
+// The returned Config is independent of the ClusterConfig.
+func (cluster *ClusterConfig) VMConfig(name string) (*Config, error) {
+	for i := range cluster.VMs {
+		if cluster.VMs[i].Name == name {
+			policy := MergeAppend
+			if cluster.ReplaceLists {
+				policy = MergeReplace
+			}
+			return MergeConfig(&cluster.Defaults, &cluster.VMs[i], policy)
+		}
+	}
+
+	return nil, fmt.Errorf("ClusterConfig has no VM Name=%s", name)
+}
+
+// Configs returns the Config of every VM, in the cluster order, or an
+// error if two VMs use the same MAC address. See VMConfig.
+func (cluster *ClusterConfig) Configs() ([]*Config, error) {
+	if err := cluster.Valid(); err != nil {
+		return nil, err
+	}
+
+	var configs []*Config
+	for _, vm := range cluster.VMs {
+		config, err := cluster.VMConfig(vm.Name)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+
+	if err := checkClusterMACAddresses(configs); err != nil {
+		return nil, err
+	}
+
+	return configs, nil
+}
+
+// checkClusterMACAddresses returns an error if two VMs of the cluster use
+// the same MAC address, given or generated.
+func checkClusterMACAddresses(configs []*Config) error {
+	owners := make(map[string]string)
+	for _, config := range configs {
+		macs, err := config.macAddresses()
+		if err != nil {
+			return fmt.Errorf("VM %s: %s", config.Name, err)
+		}
+		for mac, id := range macs {
+			owner := fmt.Sprintf("VM %s NetDevice ID=%s", config.Name, id)
+			if other, ok := owners[mac]; ok {
+				return fmt.Errorf("%s has the MAC address %s of %s", owner, mac, other)
+			}
+			owners[mac] = owner
+		}
+	}
+
+	return nil
+}
+
+// ReadClusterConfig reads and validates a ClusterConfig file.
+func ReadClusterConfig(configFile string) (*ClusterConfig, error) {
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read cluster config file '%s':%s", configFile, err)
+	}
+
+	return UnmarshalClusterConfig(content)
+}
+
+// WriteClusterConfig validates and writes a ClusterConfig file.
+func WriteClusterConfig(configFile string, cluster *ClusterConfig) error {
+	content, err := MarshalClusterConfig(cluster)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal qcli.ClusterConfig: %s", err)
+	}
+
+	return ioutil.WriteFile(configFile, content, 0644)
+}
+
+func MarshalClusterConfig(cluster *ClusterConfig) ([]byte, error) {
+	if err := cluster.Valid(); err != nil {
+		return []byte{}, err
+	}
+
+	content, err := yaml.Marshal(cluster)
+	if err != nil {
+		return []byte{}, err
+	}
+	return content, nil
+}
+
+func UnmarshalClusterConfig(content []byte) (*ClusterConfig, error) {
+	var cluster ClusterConfig
+	if err := yaml.Unmarshal(content, &cluster); err != nil {
+		return nil, err
+	}
+
+	if err := cluster.Valid(); err != nil {
+		return nil, err
+	}
+
+	return &cluster, nil
+}
@@ -0,0 +1,124 @@
+package qcli
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var clusterTestConfig = []byte(`
+defaults:
+  cpu-model: host
+  memory:
+    size-string: 2G
+  qemu-knobs:
+    no-reboot: true
+  global-params:
+  - ICH9-LPC.disable_s3=1
+vms:
+- name: vm1
+- name: vm2
+  unset:
+  - qemu-knobs.no-reboot
+  memory:
+    size-string: 4G
+  global-params:
+  - ICH9-LPC.disable_s4=1
+`)
+
+func TestClusterConfig(t *testing.T) {
+	cluster, err := UnmarshalClusterConfig(clusterTestConfig)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	configs, err := cluster.Configs()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("Expected 2 configs, found %d", len(configs))
+	}
+
+	vm1, vm2 := configs[0], configs[1]
+	if vm1.Name != "vm1" || vm1.CPUModel != "host" || vm1.Memory.Size != "2G" {
+		t.Errorf("Expected vm1 with the defaults, found %+v", vm1)
+	}
+	if vm2.Name != "vm2" || vm2.CPUModel != "host" || vm2.Memory.Size != "4G" {
+		t.Errorf("Expected vm2 overriding the memory size, found %+v", vm2)
+	}
+	if !vm1.Knobs.NoReboot || vm2.Knobs.NoReboot {
+		t.Errorf("Expected vm2 to unset the default NoReboot, found %t and %t", vm1.Knobs.NoReboot, vm2.Knobs.NoReboot)
+	}
+	expected := []string{"ICH9-LPC.disable_s3=1", "ICH9-LPC.disable_s4=1"}
+	if !reflect.DeepEqual(vm2.GlobalParams, expected) {
+		t.Errorf("Expected GlobalParams %v, found %v", expected, vm2.GlobalParams)
+	}
+
+	cluster.ReplaceLists = true
+	vm2, err = cluster.VMConfig("vm2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected = []string{"ICH9-LPC.disable_s4=1"}
+	if !reflect.DeepEqual(vm2.GlobalParams, expected) {
+		t.Errorf("Expected GlobalParams %v, found %v", expected, vm2.GlobalParams)
+	}
+
+	// the merged configs do not alias the cluster
+	vm2.GlobalParams[0] = "changed"
+	if cluster.VMs[1].GlobalParams[0] != "ICH9-LPC.disable_s4=1" {
+		t.Errorf("Expected the cluster to be unchanged, found %v", cluster.VMs[1].GlobalParams)
+	}
+
+	if _, err := cluster.VMConfig("vm3"); err == nil {
+		t.Errorf("Expected error for an unknown VM")
+	}
+
+	path := filepath.Join(t.TempDir(), "cluster.yaml")
+	if err := WriteClusterConfig(path, cluster); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	read, err := ReadClusterConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if read.ReplaceLists != cluster.ReplaceLists || len(read.VMs) != len(cluster.VMs) || read.Defaults.CPUModel != "host" {
+		t.Errorf("Expected %s to match the written cluster, found %+v", path, read)
+	}
+}
+
+func TestBadClusterConfig(t *testing.T) {
+	if _, err := UnmarshalClusterConfig([]byte("vms:\n- name: vm1\n- memory:\n    size: 1G\n")); err == nil {
+		t.Errorf("Expected error for a VM without name")
+	}
+	if _, err := UnmarshalClusterConfig([]byte("vms:\n- name: vm1\n- name: vm1\n")); err == nil {
+		t.Errorf("Expected error for a duplicated VM name")
+	}
+
+	cluster := &ClusterConfig{VMs: []Config{{Name: "vm1"}, {Name: "vm1"}}}
+	if _, err := cluster.Configs(); err == nil {
+		t.Errorf("Expected error for a duplicated VM name")
+	}
+	if err := WriteClusterConfig(filepath.Join(t.TempDir(), "cluster.yaml"), cluster); err == nil {
+		t.Errorf("Expected error writing an invalid cluster")
+	}
+}
+
+func TestClusterConfigMACAddresses(t *testing.T) {
+	cluster := &ClusterConfig{
+		Defaults: Config{
+			NetDevices: []NetDevice{{Type: USER, Driver: E1000, ID: "user0"}},
+		},
+		VMs: []Config{{Name: "vm1"}, {Name: "vm2"}},
+	}
+	if _, err := cluster.Configs(); err != nil {
+		t.Fatalf("Unexpected error for generated MAC addresses: %s", err)
+	}
+
+	mac, _ := GenerateMACAddress("vm1", "user0")
+	cluster.VMs[1].NetDevices = []NetDevice{{Type: USER, Driver: E1000, ID: "user1", MACAddress: mac}}
+	if _, err := cluster.Configs(); err == nil {
+		t.Errorf("Expected error for VMs with the same MAC address")
+	}
+}
@@ -0,0 +1,156 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompatInputPolicy is how qemu treats the input of deprecated or unstable
+// interfaces, e.g. QMP commands and arguments.
+type CompatInputPolicy string
+
+const (
+	// CompatInputAccept accepts the input, the qemu default.
+	CompatInputAccept CompatInputPolicy = "accept"
+
+	// CompatInputReject fails the command with an error.
+	CompatInputReject CompatInputPolicy = "reject"
+
+	// CompatInputCrash aborts qemu, useful to catch deprecated use in CI.
+	CompatInputCrash CompatInputPolicy = "crash"
+)
+
+// CompatOutputPolicy is how qemu treats the output of deprecated or
+// unstable interfaces, e.g. QMP results and events.
+type CompatOutputPolicy string
+
+const (
+	// CompatOutputAccept emits the output, the qemu default.
+	CompatOutputAccept CompatOutputPolicy = "accept"
+
+	// CompatOutputHide leaves the output out.
+	CompatOutputHide CompatOutputPolicy = "hide"
+)
+
+// Compat describes the -compat policies for deprecated and unstable
+// management interfaces.
+type Compat struct {
+	// DeprecatedInput is the policy for deprecated input, qemu 6.0
+	DeprecatedInput CompatInputPolicy `yaml:"deprecated-input"`
+
+	// DeprecatedOutput is the policy for deprecated output, qemu 6.0
+	DeprecatedOutput CompatOutputPolicy `yaml:"deprecated-output"`
+
+	// UnstableInput is the policy for unstable input, qemu 6.2
+	UnstableInput CompatInputPolicy `yaml:"unstable-input"`
+
+	// UnstableOutput is the policy for unstable output, qemu 6.2
+	UnstableOutput CompatOutputPolicy `yaml:"unstable-output"`
+}
+
+func validCompatInput(name string, policy CompatInputPolicy) error {
+	switch policy {
+	case "", CompatInputAccept, CompatInputReject, CompatInputCrash:
+		return nil
+	}
+
+	return fmt.Errorf("Invalid Compat %s value: '%s', must be one of '%s', '%s' or '%s'",
+		name, policy, CompatInputAccept, CompatInputReject, CompatInputCrash)
+}
+
+func validCompatOutput(name string, policy CompatOutputPolicy) error {
+	switch policy {
+	case "", CompatOutputAccept, CompatOutputHide:
+		return nil
+	}
+
+	return fmt.Errorf("Invalid Compat %s value: '%s', must be one of '%s' or '%s'",
+		name, policy, CompatOutputAccept, CompatOutputHide)
+}
+
+// Valid returns an error if the Compat structure is not valid.
+func (compat Compat) Valid() error {
+	if err := validCompatInput("DeprecatedInput", compat.DeprecatedInput); err != nil {
+		return err
+	}
+
+	if err := validCompatOutput("DeprecatedOutput", compat.DeprecatedOutput); err != nil {
+		return err
+	}
+
+	if err := validCompatInput("UnstableInput", compat.UnstableInput); err != nil {
+		return err
+	}
+
+	return validCompatOutput("UnstableOutput", compat.UnstableOutput)
+}
+
+// QemuParams returns the qemu parameters built out of the Compat.
+func (compat Compat) QemuParams() []string {
+	var compatParams []string
+
+	if compat.DeprecatedInput != "" {
+		compatParams = append(compatParams, fmt.Sprintf("deprecated-input=%s", compat.DeprecatedInput))
+	}
+
+	if compat.DeprecatedOutput != "" {
+		compatParams = append(compatParams, fmt.Sprintf("deprecated-output=%s", compat.DeprecatedOutput))
+	}
+
+	if compat.UnstableInput != "" {
+		compatParams = append(compatParams, fmt.Sprintf("unstable-input=%s", compat.UnstableInput))
+	}
+
+	if compat.UnstableOutput != "" {
+		compatParams = append(compatParams, fmt.Sprintf("unstable-output=%s", compat.UnstableOutput))
+	}
+
+	return []string{"-compat", strings.Join(compatParams, ",")}
+}
+
+func (config *Config) appendCompat() error {
+	compat := config.Compat
+	if compat == (Compat{}) {
+		return nil
+	}
+
+	if err := compat.Valid(); err != nil {
+		return err
+	}
+
+	if config.Version.Before(6, 0) {
+		return fmt.Errorf("Compat requires qemu 6.0, found %s", config.Version)
+	}
+
+	if (compat.UnstableInput != "" || compat.UnstableOutput != "") && config.Version.Before(6, 2) {
+		return fmt.Errorf("Compat UnstableInput and UnstableOutput require qemu 6.2, found %s", config.Version)
+	}
+
+	config.qemuParams = append(config.qemuParams, compat.QemuParams()...)
+
+	return nil
+}
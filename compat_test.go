@@ -0,0 +1,65 @@
+package qcli
+
+import "testing"
+
+var (
+	compatDeprecatedString = "-compat deprecated-input=crash,deprecated-output=hide"
+	compatFullString       = "-compat deprecated-input=reject,deprecated-output=accept,unstable-input=reject,unstable-output=hide"
+)
+
+func TestAppendCompat(t *testing.T) {
+	compat := Compat{
+		DeprecatedInput:  CompatInputCrash,
+		DeprecatedOutput: CompatOutputHide,
+	}
+	testAppend(compat, compatDeprecatedString, t)
+
+	compat = Compat{
+		DeprecatedInput:  CompatInputReject,
+		DeprecatedOutput: CompatOutputAccept,
+		UnstableInput:    CompatInputReject,
+		UnstableOutput:   CompatOutputHide,
+	}
+	testAppend(compat, compatFullString, t)
+
+	c := &Config{Compat: compat, Version: Version{Major: 6, Minor: 2}}
+	testConfig(c, compatFullString, t)
+}
+
+func TestBadCompat(t *testing.T) {
+	c := &Config{}
+	if err := c.appendCompat(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(c.qemuParams) != 0 {
+		t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
+	}
+
+	compats := []Compat{
+		{DeprecatedInput: "ignore"},
+		{DeprecatedOutput: CompatOutputPolicy(CompatInputReject)},
+		{UnstableInput: "hide"},
+		{UnstableOutput: "crash"},
+	}
+	for _, compat := range compats {
+		if err := compat.Valid(); err == nil {
+			t.Errorf("Expected error for invalid Compat %+v", compat)
+		}
+	}
+
+	c = &Config{
+		Compat:  Compat{DeprecatedInput: CompatInputReject},
+		Version: Version{Major: 5, Minor: 2},
+	}
+	if err := c.appendCompat(); err == nil {
+		t.Errorf("Expected error for Compat on qemu 5.2")
+	}
+
+	c = &Config{
+		Compat:  Compat{UnstableInput: CompatInputReject},
+		Version: Version{Major: 6, Minor: 1},
+	}
+	if err := c.appendCompat(); err == nil {
+		t.Errorf("Expected error for Compat UnstableInput on qemu 6.1")
+	}
+}
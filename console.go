@@ -0,0 +1,171 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	// ConsoleSocketName is the serial console socket name of the presets
+	ConsoleSocketName = "console.sock"
+
+	// MonitorSocketName is the HMP monitor socket name of the presets
+	MonitorSocketName = "monitor.sock"
+
+	// QMPSocketName is the QMP socket name of the presets
+	QMPSocketName = "qmp.sock"
+)
+
+// ConsolePreset is a consistent set of serial console, HMP monitor and QMP
+// socket devices. Relative socket paths are placed under Config.StateDir
+// by AddConsolePreset.
+type ConsolePreset struct {
+	LegacySerialDevices []LegacySerialDevice
+	MonitorDevices      []MonitorDevice
+	QMPSockets          []QMPSocket
+}
+
+// NewStdioConsolePreset returns a preset multiplexing the serial console
+// and the HMP monitor on stdio, with a QMP unix socket in the state dir.
+func NewStdioConsolePreset() ConsolePreset {
+	return ConsolePreset{
+		LegacySerialDevices: []LegacySerialDevice{
+			{
+				MonMux: true,
+			},
+		},
+		QMPSockets: []QMPSocket{
+			{
+				Type:   Unix,
+				Name:   QMPSocketName,
+				Server: true,
+				NoWait: true,
+			},
+		},
+	}
+}
+
+// NewSocketConsolePreset returns a preset with the serial console, the HMP
+// monitor and QMP on unix sockets in stateDir. If stateDir is empty the
+// Config.StateDir is used.
+func NewSocketConsolePreset(stateDir string) ConsolePreset {
+	return ConsolePreset{
+		LegacySerialDevices: []LegacySerialDevice{
+			{
+				Backend: Socket,
+				Path:    filepath.Join(stateDir, ConsoleSocketName),
+			},
+		},
+		MonitorDevices: []MonitorDevice{
+			{
+				Backend: Socket,
+				Path:    filepath.Join(stateDir, MonitorSocketName),
+			},
+		},
+		QMPSockets: []QMPSocket{
+			{
+				Type:   Unix,
+				Name:   filepath.Join(stateDir, QMPSocketName),
+				Server: true,
+				NoWait: true,
+			},
+		},
+	}
+}
+
+// AddConsolePreset adds the preset devices to the config. An error is
+// returned if a socket path is already used or if stdio would be claimed
+// twice.
+func (config *Config) AddConsolePreset(preset ConsolePreset) error {
+	resolve := func(path string) (string, error) {
+		if path == "" || filepath.IsAbs(path) {
+			return path, nil
+		}
+		if config.StateDir == "" {
+			return "", fmt.Errorf("Console preset socket %s is relative and Config.StateDir is not set", path)
+		}
+		return filepath.Join(config.StateDir, path), nil
+	}
+
+	var err error
+	merged := *config
+	merged.LegacySerialDevices = append([]LegacySerialDevice{}, config.LegacySerialDevices...)
+	merged.MonitorDevices = append([]MonitorDevice{}, config.MonitorDevices...)
+	merged.QMPSockets = append([]QMPSocket{}, config.QMPSockets...)
+
+	for _, dev := range preset.LegacySerialDevices {
+		if dev.Backend == Socket {
+			if dev.Path, err = resolve(dev.Path); err != nil {
+				return err
+			}
+		}
+		merged.LegacySerialDevices = append(merged.LegacySerialDevices, dev)
+	}
+
+	for _, dev := range preset.MonitorDevices {
+		if dev.Backend == Socket {
+			if dev.Path, err = resolve(dev.Path); err != nil {
+				return err
+			}
+		}
+		merged.MonitorDevices = append(merged.MonitorDevices, dev)
+	}
+
+	for _, q := range preset.QMPSockets {
+		if q.Type == Unix {
+			if q.Name, err = resolve(q.Name); err != nil {
+				return err
+			}
+		}
+		merged.QMPSockets = append(merged.QMPSockets, q)
+	}
+
+	sockets, err := GetSocketPaths(&merged)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, s := range sockets {
+		if s == "" {
+			continue
+		}
+		if seen[s] {
+			return fmt.Errorf("Console preset socket %s is already in use", s)
+		}
+		seen[s] = true
+	}
+
+	if err := merged.validateStdio(); err != nil {
+		return err
+	}
+
+	config.LegacySerialDevices = merged.LegacySerialDevices
+	config.MonitorDevices = merged.MonitorDevices
+	config.QMPSockets = merged.QMPSockets
+
+	return nil
+}
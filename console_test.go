@@ -0,0 +1,47 @@
+package qcli
+
+import "testing"
+
+var (
+	consoleStdioPresetString  = "-qmp unix:/run/vm1/qmp.sock,server=on,wait=off -serial mon:stdio"
+	consoleSocketPresetString = "-qmp unix:/run/vm2/qmp.sock,server=on,wait=off -serial unix:/run/vm2/console.sock,server=on,wait=off -monitor unix:/run/vm2/monitor.sock,server=on,wait=off"
+)
+
+func TestAddStdioConsolePreset(t *testing.T) {
+	c := &Config{StateDir: "/run/vm1"}
+	if err := c.AddConsolePreset(NewStdioConsolePreset()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	testConfig(c, consoleStdioPresetString, t)
+
+	// stdio and the qmp socket are already used
+	if err := c.AddConsolePreset(NewStdioConsolePreset()); err == nil {
+		t.Errorf("Expected error adding the stdio console preset twice")
+	}
+	if len(c.LegacySerialDevices) != 1 || len(c.QMPSockets) != 1 {
+		t.Errorf("Expected config to be unchanged on error, found %+v %+v", c.LegacySerialDevices, c.QMPSockets)
+	}
+}
+
+func TestAddSocketConsolePreset(t *testing.T) {
+	c := &Config{}
+	if err := c.AddConsolePreset(NewSocketConsolePreset("/run/vm2")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	testConfig(c, consoleSocketPresetString, t)
+
+	c = &Config{}
+	if err := c.AddConsolePreset(NewSocketConsolePreset("")); err == nil {
+		t.Errorf("Expected error for relative socket paths without StateDir")
+	}
+
+	c = &Config{
+		StateDir: "/run/vm2",
+		QMPSockets: []QMPSocket{
+			{Type: Unix, Name: "/run/vm2/qmp.sock"},
+		},
+	}
+	if err := c.AddConsolePreset(NewSocketConsolePreset("")); err == nil {
+		t.Errorf("Expected error for colliding socket paths")
+	}
+}
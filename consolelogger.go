@@ -0,0 +1,303 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ConsoleTimestampFormat is the format of the timestamp prefixed to each
+// console line when ConsoleLogger.Timestamps is set
+const ConsoleTimestampFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// consoleHistorySize is the amount of console output kept for
+// WaitForPattern
+var consoleHistorySize = 64 * 1024
+
+// ConsoleLogger streams the guest serial console from a unix socket
+// chardev, e.g., the one of NewSocketConsolePreset, to an io.Writer and
+// keeps the recent output to wait for boot messages.
+type ConsoleLogger struct {
+	// SocketPath is the serial console unix socket
+	SocketPath string
+
+	// Output receives the console output, it may be nil
+	Output io.Writer
+
+	// Timestamps prefixes each line written to Output with the time it
+	// was received
+	Timestamps bool
+
+	conn    net.Conn
+	mu      sync.Mutex
+	history []byte
+	matched int
+	newLine bool
+	updated chan struct{}
+	done    chan struct{}
+	err     error
+}
+
+// NewConsoleLogger returns a ConsoleLogger for the console socket
+// socketPath writing to output.
+func NewConsoleLogger(socketPath string, output io.Writer) *ConsoleLogger {
+	return &ConsoleLogger{
+		SocketPath: socketPath,
+		Output:     output,
+	}
+}
+
+// Start connects to the console socket, retrying until it is created by
+// qemu or ctx is done, and streams the console output until Close is called
+// or qemu closes the socket.
+func (c *ConsoleLogger) Start(ctx context.Context) error {
+	if c.conn != nil {
+		return fmt.Errorf("ConsoleLogger for %s is already started", c.SocketPath)
+	}
+
+	var dialer net.Dialer
+	for {
+		conn, err := dialer.DialContext(ctx, "unix", c.SocketPath)
+		if err == nil {
+			c.conn = conn
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Failed to connect to console %s: %v", c.SocketPath, err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	c.newLine = true
+	c.updated = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.readLoop()
+
+	return nil
+}
+
+func (c *ConsoleLogger) readLoop() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.conn.Read(buf)
+		if n > 0 {
+			c.write(buf[:n])
+		}
+		if err != nil {
+			c.mu.Lock()
+			if err != io.EOF {
+				c.err = err
+			}
+			c.mu.Unlock()
+			close(c.done)
+			return
+		}
+	}
+}
+
+// write records data in the history, wakes up the WaitForPattern callers and
+// copies it to Output.
+func (c *ConsoleLogger) write(data []byte) {
+	c.mu.Lock()
+	c.history = append(c.history, data...)
+	if trim := len(c.history) - consoleHistorySize; trim > 0 {
+		c.history = c.history[trim:]
+		c.matched -= trim
+		if c.matched < 0 {
+			c.matched = 0
+		}
+	}
+	close(c.updated)
+	c.updated = make(chan struct{})
+	c.mu.Unlock()
+
+	if c.Output == nil {
+		return
+	}
+
+	if !c.Timestamps {
+		c.Output.Write(data)
+		return
+	}
+
+	var out []byte
+	for _, b := range data {
+		if c.newLine {
+			out = append(out, time.Now().Format(ConsoleTimestampFormat)...)
+			out = append(out, ' ')
+		}
+		out = append(out, b)
+		c.newLine = b == '\n'
+	}
+	c.Output.Write(out)
+}
+
+// WaitForPattern waits up to timeout for console output matching re and
+// returns the matched text. Output matched by a previous call is not
+// matched again, output received before the call is.
+func (c *ConsoleLogger) WaitForPattern(re *regexp.Regexp, timeout time.Duration) (string, error) {
+	if c.conn == nil {
+		return "", fmt.Errorf("ConsoleLogger for %s is not started", c.SocketPath)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		c.mu.Lock()
+		if loc := re.FindIndex(c.history[c.matched:]); loc != nil {
+			match := string(c.history[c.matched+loc[0] : c.matched+loc[1]])
+			c.matched += loc[1]
+			c.mu.Unlock()
+			return match, nil
+		}
+		updated := c.updated
+		c.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-c.done:
+			// match what was received before the socket was closed
+			c.mu.Lock()
+			loc := re.FindIndex(c.history[c.matched:])
+			c.mu.Unlock()
+			if loc == nil {
+				return "", fmt.Errorf("Console %s closed before %q was found", c.SocketPath, re)
+			}
+		case <-timer.C:
+			return "", fmt.Errorf("Timed out after %s waiting for %q on console %s", timeout, re, c.SocketPath)
+		}
+	}
+}
+
+// Close disconnects from the console socket and returns the read error, if
+// any.
+func (c *ConsoleLogger) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	c.conn.Close()
+	<-c.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil && !errors.Is(c.err, net.ErrClosed) {
+		return c.err
+	}
+	return nil
+}
+
+// RotatingFile is an io.WriteCloser appending to Path and rotating it to
+// Path.1, Path.2, ... when it grows over MaxSize bytes, keeping at most
+// MaxFiles rotated files. It may be used as ConsoleLogger.Output.
+type RotatingFile struct {
+	Path     string
+	MaxSize  int64
+	MaxFiles int
+
+	file *os.File
+	size int64
+}
+
+// Write appends p to the file, rotating it first if it would grow over
+// MaxSize.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.MaxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %s", r.Path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("Failed to stat %s: %s", r.Path, err)
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	for i := r.MaxFiles - 1; i > 0; i-- {
+		src := fmt.Sprintf("%s.%d", r.Path, i)
+		if PathExists(src) {
+			if err := os.Rename(src, fmt.Sprintf("%s.%d", r.Path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if r.MaxFiles > 0 {
+		if err := os.Rename(r.Path, r.Path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.Path); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,159 @@
+package qcli
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// fakeConsole listens on a unix socket and returns the first connection
+func fakeConsole(t *testing.T) (string, <-chan net.Conn) {
+	dir, err := os.MkdirTemp("", "qcli-console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, ConsoleSocketName)
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	connCh := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			connCh <- conn
+		}
+	}()
+
+	return socket, connCh
+}
+
+func TestConsoleLogger(t *testing.T) {
+	socket, connCh := fakeConsole(t)
+
+	var out syncBuffer
+	logger := NewConsoleLogger(socket, &out)
+	logger.Timestamps = true
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := logger.Start(ctx); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	conn := <-connCh
+
+	conn.Write([]byte("[    0.000000] Linux version 6.1.0\n[    1.0"))
+	conn.Write([]byte("00000] Run /init as init process\nvm1 login: "))
+
+	match, err := logger.WaitForPattern(regexp.MustCompile(`Run (\S+) as init`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if match != "Run /init as init" {
+		t.Errorf("Expected match 'Run /init as init', found %q", match)
+	}
+
+	if _, err := logger.WaitForPattern(regexp.MustCompile(`login: $`), 5*time.Second); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// the login prompt was consumed by the previous match
+	if _, err := logger.WaitForPattern(regexp.MustCompile(`login: $`), 100*time.Millisecond); err == nil {
+		t.Errorf("Expected timeout waiting for an already matched pattern")
+	}
+
+	conn.Close()
+	if _, err := logger.WaitForPattern(regexp.MustCompile(`Password:`), 5*time.Second); err == nil {
+		t.Errorf("Expected error waiting on a closed console")
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines of output, found %q", out.String())
+	}
+	for i, suffix := range []string{"Linux version 6.1.0", "Run /init as init process", "vm1 login: "} {
+		ts, line, _ := strings.Cut(lines[i], " ")
+		if _, err := time.Parse(ConsoleTimestampFormat, ts); err != nil {
+			t.Errorf("Expected a timestamp on line %q: %v", lines[i], err)
+		}
+		if !strings.HasSuffix(line, suffix) {
+			t.Errorf("Expected line ending with %q, found %q", suffix, line)
+		}
+	}
+}
+
+func TestConsoleLoggerNotStarted(t *testing.T) {
+	logger := NewConsoleLogger("/nonexistent/console.sock", nil)
+	if _, err := logger.WaitForPattern(regexp.MustCompile(`login:`), time.Millisecond); err == nil {
+		t.Errorf("Expected error waiting on a console that is not started")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := logger.Start(ctx); err == nil {
+		t.Errorf("Expected error connecting to a missing console socket")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "console.log")
+	r := &RotatingFile{Path: path, MaxSize: 10, MaxFiles: 2}
+
+	for _, s := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for file, content := range expected {
+		found, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if string(found) != content {
+			t.Errorf("Expected %s content %q, found %q", file, content, found)
+		}
+	}
+	if PathExists(path + ".3") {
+		t.Errorf("Expected at most 2 rotated files")
+	}
+}
@@ -0,0 +1,257 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CPUFeature is a feature flag or property of the -cpu model.
+type CPUFeature struct {
+	// Name is the feature name, e.g. vmx or hv_vendor_id
+	Name string `yaml:"name"`
+
+	// Disable removes the feature, -name, instead of adding it, +name
+	Disable bool `yaml:"disable"`
+
+	// Value sets the feature as a name=value property, e.g. kvm=off
+	Value string `yaml:"value"`
+}
+
+// cpuFeatureName is the syntax of the qemu cpu feature names.
+var cpuFeatureName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// hvVendorIDMaxLen is the maximum length of the hv_vendor_id property.
+const hvVendorIDMaxLen = 12
+
+// Valid returns an error if the CPUFeature structure is not valid and
+// complete.
+func (feature CPUFeature) Valid() error {
+	if feature.Name == "" {
+		return fmt.Errorf("CPUFeature has empty Name field")
+	}
+
+	if !cpuFeatureName.MatchString(feature.Name) {
+		return fmt.Errorf("CPUFeature has invalid Name field: %s", feature.Name)
+	}
+
+	if feature.Value != "" && feature.Disable {
+		return fmt.Errorf("CPUFeature Name=%s has both Value and Disable set", feature.Name)
+	}
+
+	if strings.ContainsAny(feature.Value, ",=") {
+		return fmt.Errorf("CPUFeature Name=%s has invalid Value field: %s", feature.Name, feature.Value)
+	}
+
+	return nil
+}
+
+// param returns the -cpu parameter of the feature.
+func (feature CPUFeature) param() string {
+	switch {
+	case feature.Value != "":
+		return fmt.Sprintf("%s=%s", feature.Name, feature.Value)
+	case feature.Disable:
+		return "-" + feature.Name
+	default:
+		return "+" + feature.Name
+	}
+}
+
+// cpuFlagName returns the feature name of a CPUModelFlags entry, e.g.
+// x2apic for +x2apic or kvm for kvm=off.
+func cpuFlagName(flag string) string {
+	name, _, _ := strings.Cut(flag, "=")
+	return strings.TrimLeft(name, "+-")
+}
+
+// SetCPUFeature adds the cpu feature name, or removes it when enable is
+// false, replacing a previous setting of the feature.
+func (config *Config) SetCPUFeature(name string, enable bool) {
+	config.setCPUFeature(CPUFeature{Name: name, Disable: !enable})
+}
+
+// SetCPUProperty sets the cpu property name to value, replacing a previous
+// setting of the property.
+func (config *Config) SetCPUProperty(name, value string) {
+	config.setCPUFeature(CPUFeature{Name: name, Value: value})
+}
+
+func (config *Config) setCPUFeature(feature CPUFeature) {
+	for i := range config.CPUFeatures {
+		if config.CPUFeatures[i].Name == feature.Name {
+			config.CPUFeatures[i] = feature
+			return
+		}
+	}
+	config.CPUFeatures = append(config.CPUFeatures, feature)
+}
+
+// SetCPUModelInfo sets the CPUModel to model, e.g. a baseline computed with
+// QMP.BaselineCPUModels, and its props as CPUFeatures.  Boolean props add or
+// remove the feature, other props are set as properties.  Any CPUModelFlags
+// and CPUFeatures previously set are replaced.
+func (config *Config) SetCPUModelInfo(model CPUModelInfo) error {
+	if model.Name == "" {
+		return fmt.Errorf("CPUModelInfo has empty Name field")
+	}
+
+	names := make([]string, 0, len(model.Props))
+	for name := range model.Props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	features := make([]CPUFeature, 0, len(names))
+	for _, name := range names {
+		feature := CPUFeature{Name: name}
+		switch v := model.Props[name].(type) {
+		case bool:
+			feature.Disable = !v
+		case string:
+			feature.Value = v
+		case float64:
+			feature.Value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return fmt.Errorf("CPUModelInfo Name=%s has unsupported prop %s: %v", model.Name, name, v)
+		}
+		if err := feature.Valid(); err != nil {
+			return err
+		}
+		features = append(features, feature)
+	}
+
+	config.CPUModel = model.Name
+	config.CPUModelFlags = nil
+	config.CPUFeatures = nil
+	for _, feature := range features {
+		config.setCPUFeature(feature)
+	}
+
+	return nil
+}
+
+// hostCPUVendor returns the vendor_id of the host CPU.
+var hostCPUVendor = func() (string, error) {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, val, found := strings.Cut(scanner.Text(), ":")
+		if found && strings.TrimSpace(key) == "vendor_id" {
+			return strings.TrimSpace(val), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("No vendor_id found in /proc/cpuinfo")
+}
+
+// EnableNestedVirt exposes the host virtualization extension to the guest,
+// vmx on Intel and svm on AMD hosts, so that it can run its own VMs. The
+// CPUModel defaults to host.
+func (config *Config) EnableNestedVirt() error {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "386" {
+		return fmt.Errorf("EnableNestedVirt is not supported on %s", runtime.GOARCH)
+	}
+
+	vendor, err := hostCPUVendor()
+	if err != nil {
+		return fmt.Errorf("Failed to get the host CPU vendor: %v", err)
+	}
+
+	switch vendor {
+	case "GenuineIntel":
+		config.SetCPUFeature("vmx", true)
+	case "AuthenticAMD", "HygonGenuine":
+		config.SetCPUFeature("svm", true)
+	default:
+		return fmt.Errorf("EnableNestedVirt does not support CPU vendor %s", vendor)
+	}
+
+	if config.CPUModel == "" {
+		config.CPUModel = "host"
+	}
+
+	return nil
+}
+
+// HideKVM hides the KVM hypervisor signature from the guest and reports the
+// Hyper-V vendorID instead, e.g. for guest drivers refusing to run in a VM.
+// vendorID is at most 12 characters, no Hyper-V vendor is set when empty.
+func (config *Config) HideKVM(vendorID string) error {
+	if len(vendorID) > hvVendorIDMaxLen {
+		return fmt.Errorf("HideKVM vendorID %s is longer than %d characters", vendorID, hvVendorIDMaxLen)
+	}
+
+	config.SetCPUProperty("kvm", "off")
+	if vendorID != "" {
+		config.SetCPUProperty("hv_vendor_id", vendorID)
+	}
+
+	return nil
+}
+
+// validateCPUFeatures checks the CPUFeatures are valid, have a CPUModel to
+// apply to and are not set twice, including by the CPUModelFlags.
+func (config *Config) validateCPUFeatures() error {
+	if len(config.CPUFeatures) == 0 {
+		return nil
+	}
+
+	if config.CPUModel == "" {
+		return fmt.Errorf("CPUFeatures require a CPUModel")
+	}
+
+	seen := make(map[string]bool)
+	for _, flag := range config.CPUModelFlags {
+		seen[cpuFlagName(flag)] = true
+	}
+
+	for _, feature := range config.CPUFeatures {
+		if err := feature.Valid(); err != nil {
+			return err
+		}
+		if seen[feature.Name] {
+			return fmt.Errorf("CPUFeature Name=%s is set more than once", feature.Name)
+		}
+		seen[feature.Name] = true
+	}
+
+	return nil
+}
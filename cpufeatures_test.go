@@ -0,0 +1,125 @@
+package qcli
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestAppendCPUFeatures(t *testing.T) {
+	c := &Config{
+		CPUModel:      "host",
+		CPUModelFlags: []string{"+x2apic"},
+	}
+	c.SetCPUFeature("pdpe1gb", true)
+	c.SetCPUFeature("hle", false)
+	c.SetCPUFeature("pdpe1gb", false)
+	if err := c.HideKVM("whatever"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := c.validateCPUFeatures(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	c.appendCPUModel()
+	expected := []string{"-cpu", "host,+x2apic,-pdpe1gb,-hle,kvm=off,hv_vendor_id=whatever"}
+	if !reflect.DeepEqual(expected, c.qemuParams) {
+		t.Errorf("Expected %v, found %v", expected, c.qemuParams)
+	}
+}
+
+func TestSetCPUModelInfo(t *testing.T) {
+	c := &Config{
+		CPUModel:      "host",
+		CPUModelFlags: []string{"+x2apic"},
+	}
+	model := CPUModelInfo{
+		Name: "Skylake-Client-v4",
+		Props: map[string]interface{}{
+			"vmx":   false,
+			"pcid":  true,
+			"level": float64(13),
+		},
+	}
+	if err := c.SetCPUModelInfo(model); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := c.validateCPUFeatures(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	c.appendCPUModel()
+	expected := []string{"-cpu", "Skylake-Client-v4,level=13,+pcid,-vmx"}
+	if !reflect.DeepEqual(expected, c.qemuParams) {
+		t.Errorf("Expected %v, found %v", expected, c.qemuParams)
+	}
+
+	if err := c.SetCPUModelInfo(CPUModelInfo{}); err == nil {
+		t.Errorf("Expected error for a model without name")
+	}
+	bad := CPUModelInfo{Name: "max", Props: map[string]interface{}{"vmx": []string{"on"}}}
+	if err := c.SetCPUModelInfo(bad); err == nil {
+		t.Errorf("Expected error for an unsupported prop")
+	}
+	if c.CPUModel != "Skylake-Client-v4" {
+		t.Errorf("Expected CPUModel to be unchanged on error, found %s", c.CPUModel)
+	}
+}
+
+func TestEnableNestedVirt(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("nested virtualization helpers are for x86 hosts")
+	}
+
+	saved := hostCPUVendor
+	defer func() { hostCPUVendor = saved }()
+
+	vendors := map[string]string{
+		"GenuineIntel": "+vmx",
+		"AuthenticAMD": "+svm",
+	}
+	for vendor, flag := range vendors {
+		vendor := vendor
+		hostCPUVendor = func() (string, error) { return vendor, nil }
+		c := &Config{}
+		if err := c.EnableNestedVirt(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		c.appendCPUModel()
+		expected := []string{"-cpu", "host," + flag}
+		if !reflect.DeepEqual(expected, c.qemuParams) {
+			t.Errorf("Expected %v for %s, found %v", expected, vendor, c.qemuParams)
+		}
+	}
+
+	hostCPUVendor = func() (string, error) { return "CentaurHauls", nil }
+	if err := (&Config{}).EnableNestedVirt(); err == nil {
+		t.Errorf("Expected error for unknown CPU vendor")
+	}
+	hostCPUVendor = func() (string, error) { return "", fmt.Errorf("no cpuinfo") }
+	if err := (&Config{}).EnableNestedVirt(); err == nil {
+		t.Errorf("Expected error without CPU vendor")
+	}
+}
+
+func TestBadCPUFeatures(t *testing.T) {
+	if err := (&Config{}).HideKVM("waytoolongvendor"); err == nil {
+		t.Errorf("Expected error for a vendor ID longer than 12 characters")
+	}
+
+	configs := []*Config{
+		{CPUFeatures: []CPUFeature{{Name: "vmx"}}},
+		{CPUModel: "host", CPUFeatures: []CPUFeature{{}}},
+		{CPUModel: "host", CPUFeatures: []CPUFeature{{Name: "+vmx"}}},
+		{CPUModel: "host", CPUFeatures: []CPUFeature{{Name: "kvm", Value: "off", Disable: true}}},
+		{CPUModel: "host", CPUFeatures: []CPUFeature{{Name: "hv_vendor_id", Value: "a,b"}}},
+		{CPUModel: "host", CPUFeatures: []CPUFeature{{Name: "vmx"}, {Name: "vmx", Disable: true}}},
+		{CPUModel: "host", CPUModelFlags: []string{"kvm=off"}, CPUFeatures: []CPUFeature{{Name: "kvm", Value: "on"}}},
+	}
+	for _, c := range configs {
+		if err := c.validateCPUFeatures(); err == nil {
+			t.Errorf("Expected error for invalid CPUFeatures %+v", c)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DebugGDBDefault is the gdb stub address used by the qemu -s shorthand.
+const DebugGDBDefault = "tcp::1234"
+
+// Debug describes the qemu gdb stub and debug logging configuration.
+type Debug struct {
+	// GDB is the gdb stub chardev, e.g. tcp::1234 or unix:/path/gdb.sock
+	GDB string `yaml:"gdb"`
+
+	// WaitForDebugger does not start the guest cpus until a debugger
+	// continues them (-S).
+	WaitForDebugger bool `yaml:"wait-for-debugger"`
+
+	// LogItems are the qemu log items to enable (-d), e.g. int or
+	// cpu_reset. The log is written to Config.LogFile (-D) if set,
+	// stderr otherwise.
+	LogItems []string `yaml:"log-items"`
+}
+
+// Valid returns an error if the Debug structure is not valid.
+func (debug Debug) Valid() error {
+	if debug.WaitForDebugger && debug.GDB == "" {
+		return fmt.Errorf("Debug WaitForDebugger requires GDB")
+	}
+
+	if strings.ContainsAny(debug.GDB, " ") {
+		return fmt.Errorf("Invalid Debug GDB value: '%s'", debug.GDB)
+	}
+
+	for _, item := range debug.LogItems {
+		if item == "" || item == "help" || strings.ContainsAny(item, ", ") {
+			return fmt.Errorf("Invalid Debug LogItems value: '%s'", item)
+		}
+	}
+
+	return nil
+}
+
+func (config *Config) appendDebug() error {
+	debug := config.Debug
+	if debug.GDB == "" && !debug.WaitForDebugger && len(debug.LogItems) == 0 {
+		return nil
+	}
+
+	if err := debug.Valid(); err != nil {
+		return err
+	}
+
+	if debug.GDB != "" {
+		config.qemuParams = append(config.qemuParams, "-gdb")
+		config.qemuParams = append(config.qemuParams, debug.GDB)
+	}
+
+	// -S may already be set by Knobs.Stopped or Incoming
+	if debug.WaitForDebugger && !config.Knobs.Stopped && config.Incoming.MigrationType == 0 {
+		config.qemuParams = append(config.qemuParams, "-S")
+	}
+
+	if len(debug.LogItems) > 0 {
+		config.qemuParams = append(config.qemuParams, "-d")
+		config.qemuParams = append(config.qemuParams, strings.Join(debug.LogItems, ","))
+	}
+
+	return nil
+}
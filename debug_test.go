@@ -0,0 +1,44 @@
+package qcli
+
+import "testing"
+
+var (
+	debugString        = "-D /tmp/qemu.log -gdb tcp::1234 -S -d int,cpu_reset"
+	debugStoppedString = "-S -gdb unix:/tmp/gdb.sock,server=on,wait=off"
+)
+
+func TestAppendDebug(t *testing.T) {
+	c := &Config{
+		LogFile: "/tmp/qemu.log",
+		Debug: Debug{
+			GDB:             DebugGDBDefault,
+			WaitForDebugger: true,
+			LogItems:        []string{"int", "cpu_reset"},
+		},
+	}
+	testConfig(c, debugString, t)
+
+	c = &Config{
+		Knobs: Knobs{Stopped: true},
+		Debug: Debug{
+			GDB:             "unix:/tmp/gdb.sock,server=on,wait=off",
+			WaitForDebugger: true,
+		},
+	}
+	testConfig(c, debugStoppedString, t)
+}
+
+func TestBadDebug(t *testing.T) {
+	debugs := []Debug{
+		{WaitForDebugger: true},
+		{GDB: "tcp::1234 -S"},
+		{LogItems: []string{"int,cpu_reset"}},
+		{LogItems: []string{""}},
+		{LogItems: []string{"help"}},
+	}
+	for _, debug := range debugs {
+		if err := debug.Valid(); err == nil {
+			t.Errorf("Expected error for invalid Debug %+v", debug)
+		}
+	}
+}
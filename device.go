@@ -27,7 +27,6 @@ package qcli
 
 import (
 	"fmt"
-	"reflect"
 	"strings"
 )
 
@@ -47,6 +46,12 @@ const (
 	// NVDIMM is the Non Volatile DIMM device driver.
 	NVDIMM DeviceDriver = "nvdimm"
 
+	// VirtioPmemPCI is the virtio-pmem device driver.
+	VirtioPmemPCI DeviceDriver = "virtio-pmem-pci"
+
+	// VirtioMemPCI is the virtio-mem device driver.
+	VirtioMemPCI DeviceDriver = "virtio-mem-pci"
+
 	// VirtioNet is the virtio networking device driver.
 	VirtioNet DeviceDriver = "virtio-net"
 
@@ -74,6 +79,13 @@ const (
 	// SCSICD is the block device driver
 	SCSICD DeviceDriver = "scsi-cd"
 
+	// SCSIBlock is the SCSI pass-through driver of a host block device
+	SCSIBlock DeviceDriver = "scsi-block"
+
+	// SCSIGeneric is the SCSI pass-through driver of a host SCSI generic
+	// device, e.g. /dev/sg3 for a tape library or an enclosure
+	SCSIGeneric DeviceDriver = "scsi-generic"
+
 	// NVME is the block device driver
 	NVME DeviceDriver = "nvme"
 
@@ -119,6 +131,13 @@ const (
 	//VhostUserFS represents a virtio-fs vhostuser device type
 	VhostUserFS DeviceDriver = "vhost-user-fs"
 
+	//VhostUserGPU represents a virtio-gpu vhostuser device type, its
+	//rendering is done by a separate vhost-user-gpu process
+	VhostUserGPU DeviceDriver = "vhost-user-gpu"
+
+	//VhostUserVGA is the vhost-user-gpu device with VGA compatibility
+	VhostUserVGA DeviceDriver = "vhost-user-vga"
+
 	//VVFAT represents a virtual VFAT block device
 	VVFAT DeviceDriver = "vvfat"
 
@@ -128,6 +147,12 @@ const (
 	// PCIePCIBridgeDriver represents a PCIe to PCI bridge device type.
 	PCIePCIBridgeDriver DeviceDriver = "pcie-pci-bridge"
 
+	// PCIExpanderBridgeDriver represents a PCI expander bridge device type.
+	PCIExpanderBridgeDriver DeviceDriver = "pxb"
+
+	// PCIeExpanderBridgeDriver represents a PCIe expander bridge device type.
+	PCIeExpanderBridgeDriver DeviceDriver = "pxb-pcie"
+
 	// VfioPCI is the vfio driver with PCI transport.
 	VfioPCI DeviceDriver = "vfio-pci"
 
@@ -149,6 +174,15 @@ const (
 	// SpaprTPMProxy is used for enabling guest to run in secure mode on ppc64le.
 	SpaprTPMProxy DeviceDriver = "spapr-tpm-proxy"
 
+	// SpaprVTY is the sPAPR virtual console device driver on ppc64le.
+	SpaprVTY DeviceDriver = "spapr-vty"
+
+	// SpaprVSCSI is the sPAPR virtual SCSI controller driver on ppc64le.
+	SpaprVSCSI DeviceDriver = "spapr-vscsi"
+
+	// SpaprPCIHostBridge is the sPAPR PCI host bridge driver on ppc64le.
+	SpaprPCIHostBridge DeviceDriver = "spapr-pci-host-bridge"
+
 	// PFlash
 	PFlash DeviceDriver = "pflash"
 
@@ -174,77 +208,295 @@ const (
 	PCISerialDevice DeviceDriver = "pci-serial"
 )
 
-func (config *Config) appendDevices() error {
-	// I'd really like to keep the Devices []Device but unmarshaling it is a
-	// huge page, so we'll have a list of each device type in the config and
-	// sort through each devices list and append if valid.
-
-	// FIXME: if I could invoke the fields on config that match a regex then
-	// we could have a single switch case which matches .+Devices and then
-	// appends each device to config.devices.
-	fields := reflect.VisibleFields(reflect.TypeOf(Config{}))
-
-	// insert pci and scsi controllers first
-	for _, field := range fields {
-		switch field.Name {
-		case "PCIeRootPortDevices":
-			for _, d := range config.PCIeRootPortDevices {
-				config.devices = append(config.devices, d)
-			}
-		case "SCSIControllerDevices": // controllers have to be before blkdev
-			for _, d := range config.SCSIControllerDevices {
-				config.devices = append(config.devices, d)
-			}
-		case "IDEControllerDevices": // controllers have to be before blkdev
-			for _, d := range config.IDEControllerDevices {
-				config.devices = append(config.devices, d)
-			}
-		case "USBControllerDevices": // controllers have to be before blkdev
-			for _, d := range config.USBControllerDevices {
-				config.devices = append(config.devices, d)
-			}
-		}
+// deviceClass orders the device lists on the qemu command line, the
+// devices of a class are appended before those of the following classes.
+type deviceClass int
+
+const (
+	// deviceClassController are the bridges, root ports and controllers
+	// providing the buses the storage devices are plugged in.
+	deviceClassController deviceClass = iota
+
+	// deviceClassStorage are the disks, cdroms and floppies.
+	deviceClassStorage
+
+	// deviceClassNetwork are the network interfaces.
+	deviceClassNetwork
+
+	// deviceClassMisc are all the other devices.
+	deviceClassMisc
+
+	deviceClassCount
+)
+
+// deviceIdentity is how a device is known on the qemu command line.
+type deviceIdentity struct {
+	// id is the qemu id of the device, or of its chardev for the legacy
+	// serial and monitor devices
+	id string
+
+	// driver is the -device driver emitted for the device, empty if it
+	// emits none
+	driver string
+
+	// qemuIDs are the id= and node-name= values emitted for the device,
+	// including those of its -chardev, -netdev or -object
+	qemuIDs []string
+
+	// devNo is the explicit CCW devno of the device, if any
+	devNo string
+}
+
+// deviceList is a Config field listing devices of the same type.
+type deviceList struct {
+	// field is the name of the Config field
+	field string
+
+	// class orders the list on the qemu command line
+	class deviceClass
+
+	// devices returns the devices declared in the list
+	devices func(config *Config) []Device
+
+	// implicit returns the devices required by the list that are not
+	// declared in the config, they are appended before the list devices
+	implicit func(config *Config) []Device
+
+	// identity returns the identity of a device of the list
+	identity func(config *Config, d Device) deviceIdentity
+}
+
+// asDevices converts a typed device list to a list of Device.
+func asDevices[T Device](list []T) []Device {
+	devices := make([]Device, 0, len(list))
+	for _, d := range list {
+		devices = append(devices, d)
 	}
+	return devices
+}
 
-	// insert the remaining devices
-	for _, field := range fields {
-		switch field.Name {
-		case "BlkDevices":
-			for _, d := range config.BlkDevices {
-				config.devices = append(config.devices, d)
-			}
-		case "CharDevices":
-			for _, d := range config.CharDevices {
-				config.devices = append(config.devices, d)
-			}
-		case "LegacySerialDevices":
-			for _, d := range config.LegacySerialDevices {
-				config.devices = append(config.devices, d)
+// identifiedBy converts the identity function of a typed device list to
+// the deviceList identity.
+func identifiedBy[T Device](identity func(config *Config, d T) deviceIdentity) func(*Config, Device) deviceIdentity {
+	return func(config *Config, d Device) deviceIdentity {
+		return identity(config, d.(T))
+	}
+}
+
+// deviceRegistry lists the Config device lists appended by appendDevices.
+// Within a class, lists are appended in the registry order and devices in
+// the list order.
+var deviceRegistry = []deviceList{
+	// expander bridges have to be before their root ports
+	{field: "PCIExpanderBridges", class: deviceClassController,
+		devices: func(c *Config) []Device { return asDevices(c.PCIExpanderBridges) },
+		identity: identifiedBy(func(c *Config, d PCIExpanderBridge) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: d.deviceName(), qemuIDs: []string{d.ID}}
+		})},
+	{field: "PCIeRootPortDevices", class: deviceClassController,
+		devices: func(c *Config) []Device { return asDevices(c.PCIeRootPortDevices) },
+		identity: identifiedBy(func(c *Config, d PCIeRootPortDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: string(PCIeRootPort), qemuIDs: []string{d.ID}}
+		})},
+	{field: "SCSIControllerDevices", class: deviceClassController,
+		devices: func(c *Config) []Device { return asDevices(c.SCSIControllerDevices) },
+		identity: identifiedBy(func(c *Config, d SCSIControllerDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: d.deviceName(c), qemuIDs: []string{d.ID, d.IOThread}, devNo: d.DevNo}
+		})},
+	{field: "IDEControllerDevices", class: deviceClassController,
+		devices: func(c *Config) []Device { return asDevices(c.IDEControllerDevices) },
+		identity: identifiedBy(func(c *Config, d IDEControllerDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: d.deviceName(c), qemuIDs: []string{d.ID}}
+		})},
+	{field: "USBControllerDevices", class: deviceClassController,
+		devices: func(c *Config) []Device { return asDevices(c.USBControllerDevices) },
+		identity: identifiedBy(func(c *Config, d USBControllerDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: d.deviceName(c), qemuIDs: []string{d.ID}}
+		})},
+	{field: "SpaprPCIHostBridgeDevices", class: deviceClassController,
+		devices: func(c *Config) []Device { return asDevices(c.SpaprPCIHostBridgeDevices) },
+		identity: identifiedBy(func(c *Config, d SpaprPCIHostBridgeDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: string(SpaprPCIHostBridge), qemuIDs: []string{d.ID}}
+		})},
+
+	// rng devices have always been appended before the disks, moving them
+	// would change the PCI slots allocated to the devices without Addr
+	{field: "RngDevices", class: deviceClassStorage,
+		devices: func(c *Config) []Device { return asDevices(c.RngDevices) },
+		identity: identifiedBy(func(c *Config, d RngDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: d.deviceName(c), qemuIDs: []string{d.ID}, devNo: d.DevNo}
+		})},
+	{field: "BlkDevices", class: deviceClassStorage,
+		devices: func(c *Config) []Device { return asDevices(c.BlkDevices) },
+		identity: identifiedBy(func(c *Config, d BlockDevice) deviceIdentity {
+			identity := deviceIdentity{id: d.ID, driver: d.deviceName(c), devNo: d.DevNo}
+			switch {
+			case d.Driver == VVFAT:
+				identity.driver = d.VVFATDev.deviceName(c)
+			case d.DriveOnly:
+				identity.driver = ""
 			}
-		case "MonitorDevices":
-			for _, d := range config.MonitorDevices {
-				config.devices = append(config.devices, d)
+			identity.qemuIDs = append([]string{d.ID, d.IOThread}, d.IOThreadVQs...)
+			return identity
+		})},
+	{field: "FloppyDevices", class: deviceClassStorage,
+		devices: func(c *Config) []Device { return asDevices(c.FloppyDevices) },
+		implicit: func(c *Config) []Device {
+			if len(c.FloppyDevices) > 0 && c.needsFloppyController() {
+				return []Device{floppyController{ID: floppyControllerID}}
 			}
-		case "NetDevices":
-			for _, d := range config.NetDevices {
-				config.devices = append(config.devices, d)
+			return nil
+		},
+		identity: identifiedBy(func(c *Config, d FloppyDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: string(FloppyDriver), qemuIDs: []string{d.ID}}
+		})},
+
+	{field: "NetDevices", class: deviceClassNetwork,
+		devices: func(c *Config) []Device { return asDevices(c.NetDevices) },
+		identity: identifiedBy(func(c *Config, d NetDevice) deviceIdentity {
+			identity := deviceIdentity{id: d.ID, driver: string(d.Type.QemuDeviceParam(&d, c)), devNo: d.DevNo}
+			identity.qemuIDs = []string{d.ID}
+			for _, f := range d.Filters {
+				identity.qemuIDs = append(identity.qemuIDs, f.ID)
 			}
-		case "RngDevices":
-			for _, d := range config.RngDevices {
-				config.devices = append(config.devices, d)
+			return identity
+		})},
+
+	{field: "CharDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.CharDevices) },
+		identity: identifiedBy(func(c *Config, d CharDevice) deviceIdentity {
+			return deviceIdentity{id: d.DeviceID, driver: d.deviceName(c), qemuIDs: []string{d.ID, d.DeviceID}, devNo: d.DevNo}
+		})},
+	{field: "LegacySerialDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.LegacySerialDevices) },
+		identity: identifiedBy(func(c *Config, d LegacySerialDevice) deviceIdentity {
+			return deviceIdentity{id: d.ChardevID}
+		})},
+	{field: "SerialDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.SerialDevices) },
+		identity: identifiedBy(func(c *Config, d SerialDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: d.deviceName(c), qemuIDs: []string{d.ID}, devNo: d.DevNo}
+		})},
+	{field: "MonitorDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.MonitorDevices) },
+		identity: identifiedBy(func(c *Config, d MonitorDevice) deviceIdentity {
+			// only the multiplexed stdio monitor creates its chardev
+			if d.Mux {
+				return deviceIdentity{id: d.ChardevID, qemuIDs: []string{d.ChardevID}}
 			}
-		case "SerialDevices":
-			for _, d := range config.SerialDevices {
-				config.devices = append(config.devices, d)
+			return deviceIdentity{id: d.ChardevID}
+		})},
+	{field: "UEFIFirmwareDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.UEFIFirmwareDevices) },
+		identity: identifiedBy(func(c *Config, d UEFIFirmwareDevice) deviceIdentity {
+			return deviceIdentity{}
+		})},
+	{field: "WatchdogDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.WatchdogDevices) },
+		identity: identifiedBy(func(c *Config, d WatchdogDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: string(d.Model), qemuIDs: []string{d.ID}}
+		})},
+	{field: "PVPanicDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.PVPanicDevices) },
+		identity: identifiedBy(func(c *Config, d PVPanicDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: string(d.model()), qemuIDs: []string{d.ID}}
+		})},
+	{field: "VFIODevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.VFIODevices) },
+		identity: identifiedBy(func(c *Config, d VFIODevice) deviceIdentity {
+			return deviceIdentity{driver: d.deviceName(c), devNo: d.DevNo}
+		})},
+	{field: "RawDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.RawDevices) },
+		identity: identifiedBy(func(c *Config, d RawDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: d.Driver, qemuIDs: []string{d.ID}}
+		})},
+	{field: "BalloonDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.BalloonDevices) },
+		identity: identifiedBy(func(c *Config, d BalloonDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: d.deviceName(c), qemuIDs: []string{d.ID}, devNo: d.DevNo}
+		})},
+	{field: "VirtioMemDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.VirtioMemDevices) },
+		identity: identifiedBy(func(c *Config, d VirtioMemDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: string(VirtioMemPCI), qemuIDs: []string{d.ID, d.MemDev}}
+		})},
+	{field: "IVShmemDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.IVShmemDevices) },
+		identity: identifiedBy(func(c *Config, d IVShmemDevice) deviceIdentity {
+			identity := deviceIdentity{id: d.ID, driver: string(d.Model)}
+			if d.Model == IVShmemDoorbell {
+				identity.qemuIDs = []string{d.ID, d.chardevID()}
+			} else {
+				identity.qemuIDs = []string{d.ID, d.MemDev}
 			}
-		case "UEFIFirmwareDevices":
-			for _, d := range config.UEFIFirmwareDevices {
-				config.devices = append(config.devices, d)
+			return identity
+		})},
+	{field: "NVDIMMDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.NVDIMMDevices) },
+		identity: identifiedBy(func(c *Config, d NVDIMMDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: string(NVDIMM), qemuIDs: []string{d.ID, d.MemDev}}
+		})},
+	{field: "VirtioPmemDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.VirtioPmemDevices) },
+		identity: identifiedBy(func(c *Config, d VirtioPmemDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: string(VirtioPmemPCI), qemuIDs: []string{d.ID, d.MemDev}}
+		})},
+	{field: "LoaderDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.LoaderDevices) },
+		identity: identifiedBy(func(c *Config, d LoaderDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: string(Loader), qemuIDs: []string{d.ID}}
+		})},
+	{field: "VSOCKDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.VSOCKDevices) },
+		identity: identifiedBy(func(c *Config, d VSOCKDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: d.deviceName(c), qemuIDs: []string{d.ID}, devNo: d.DevNo}
+		})},
+	{field: "VhostUserDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.VhostUserDevices) },
+		identity: identifiedBy(func(c *Config, d VhostUserDevice) deviceIdentity {
+			return deviceIdentity{id: d.TypeDevID, driver: d.deviceName(c), qemuIDs: []string{d.CharDevID, d.TypeDevID}, devNo: d.DevNo}
+		})},
+	{field: "USBRedirDevices", class: deviceClassMisc,
+		devices: func(c *Config) []Device { return asDevices(c.USBRedirDevices) },
+		identity: identifiedBy(func(c *Config, d USBRedirDevice) deviceIdentity {
+			return deviceIdentity{id: d.ID, driver: string(USBRedirDriver), qemuIDs: []string{d.ID, d.chardevID()}}
+		})},
+}
+
+// orderedDeviceLists returns the deviceRegistry lists in the order they
+// are appended to the qemu command line.
+func orderedDeviceLists() []deviceList {
+	lists := make([]deviceList, 0, len(deviceRegistry))
+	for class := deviceClassController; class < deviceClassCount; class++ {
+		for _, list := range deviceRegistry {
+			if list.class == class {
+				lists = append(lists, list)
 			}
 		}
 	}
+	return lists
+}
+
+func (config *Config) appendDevices() error {
+	for _, list := range orderedDeviceLists() {
+		if list.implicit != nil {
+			config.devices = append(config.devices, list.implicit(config)...)
+		}
+		config.devices = append(config.devices, list.devices(config)...)
+	}
 
 	var errors []string
+	if err := config.reserveCCWDevNos(); err != nil {
+		errors = append(errors, err.Error())
+	}
+	if err := config.reservePCISlots(); err != nil {
+		errors = append(errors, err.Error())
+	}
+	if err := config.validatePCIExpanderBridges(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
 	for _, d := range config.devices {
 		if err := d.Valid(); err != nil {
 			errors = append(errors, err.Error())
@@ -254,6 +506,10 @@ func (config *Config) appendDevices() error {
 		config.qemuParams = append(config.qemuParams, d.QemuParams(config)...)
 	}
 
+	if err := config.ccwBus.Err(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
 	if len(errors) > 0 {
 		return fmt.Errorf("Failed to append %d devices: %s", len(errors), strings.Join(errors, ", "))
 	}
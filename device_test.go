@@ -0,0 +1,88 @@
+package qcli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeviceOrder(t *testing.T) {
+	c := &Config{
+		RngDevices: []RngDevice{
+			{ID: "rng0", Driver: VirtioRng, Transport: TransportPCI},
+		},
+		NetDevices: []NetDevice{
+			{Type: USER, Driver: VirtioNetPCI, ID: "user0", User: NetDeviceUser{IPV4: true}},
+		},
+		BlkDevices: []BlockDevice{
+			{Driver: SCSIHD, ID: "hd0", File: "/var/lib/vm.img", Format: QCOW2, Interface: NoInterface, Bus: "scsi0.0"},
+		},
+		SCSIControllerDevices: []SCSIControllerDevice{
+			{ID: "scsi0", Transport: TransportPCI},
+		},
+	}
+	if err := c.appendDevices(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	params := strings.Join(c.qemuParams, " ")
+	expected := []string{"id=scsi0", "id=rng0", "id=hd0", "id=user0"}
+	last := -1
+	for _, id := range expected {
+		i := strings.Index(params, id)
+		if i < 0 {
+			t.Fatalf("Expected %s in %s", id, params)
+		}
+		if i < last {
+			t.Errorf("Expected devices in order %v, found %s", expected, params)
+		}
+		last = i
+	}
+}
+
+func TestDeviceRegistry(t *testing.T) {
+	lists := orderedDeviceLists()
+	if len(lists) != len(deviceRegistry) {
+		t.Fatalf("Expected %d device lists, found %d", len(deviceRegistry), len(lists))
+	}
+	for i := 1; i < len(lists); i++ {
+		if lists[i].class < lists[i-1].class {
+			t.Errorf("Device list %s is ordered before %s", lists[i-1].field, lists[i].field)
+		}
+	}
+
+	registered := make(map[string]bool)
+	c := &Config{}
+	for _, list := range deviceRegistry {
+		if registered[list.field] {
+			t.Errorf("Device list %s is registered twice", list.field)
+		}
+		registered[list.field] = true
+		if list.devices == nil || list.identity == nil {
+			t.Errorf("Device list %s has no devices or identity function", list.field)
+			continue
+		}
+
+		// the explicit CCW devnos are reserved from the identity
+		field, _ := reflect.TypeOf(Config{}).FieldByName(list.field)
+		dev := reflect.New(field.Type.Elem()).Elem()
+		if devNo := dev.FieldByName("DevNo"); devNo.IsValid() {
+			devNo.SetString("fe.0.0001")
+			if identity := list.identity(c, dev.Interface().(Device)); identity.devNo != "fe.0.0001" {
+				t.Errorf("Device list %s identity has no devNo", list.field)
+			}
+		}
+	}
+
+	// every Config list of devices must be registered, the ACPITables
+	// are not devices but satisfy the Device interface
+	deviceType := reflect.TypeOf((*Device)(nil)).Elem()
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(Config{})) {
+		if !field.IsExported() || field.Name == "ACPITables" || field.Type.Kind() != reflect.Slice {
+			continue
+		}
+		if field.Type.Elem().Implements(deviceType) && !registered[field.Name] {
+			t.Errorf("Config device list %s is not registered", field.Name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+)
+
+// DeviceInfo describes a device declared in one of the Config device lists.
+type DeviceInfo struct {
+	// List is the Config field declaring the device, e.g. NetDevices
+	List string
+
+	// Index is the position of the device in List
+	Index int
+
+	// ID is the qemu id of the device, or of its chardev for the legacy
+	// serial and monitor devices. It is empty if the device has no id.
+	ID string
+
+	// Driver is the -device driver emitted for the device, e.g.
+	// virtio-blk-pci for a virtio-blk BlockDevice on the PCI transport. It
+	// is empty if the device emits no -device.
+	Driver string
+
+	// Device is a copy of the declared device
+	Device Device
+}
+
+// ListDevices returns the devices declared in all the Config device lists,
+// in the order they are appended to the qemu command line.
+func (config *Config) ListDevices() []DeviceInfo {
+	var devices []DeviceInfo
+
+	for _, list := range orderedDeviceLists() {
+		for i, d := range list.devices(config) {
+			identity := list.identity(config, d)
+			devices = append(devices, DeviceInfo{
+				List:   list.field,
+				Index:  i,
+				ID:     identity.id,
+				Driver: identity.driver,
+				Device: d,
+			})
+		}
+	}
+
+	return devices
+}
+
+// FindDeviceByID returns the device with the qemu id, whichever Config
+// device list declares it.
+func (config *Config) FindDeviceByID(id string) (DeviceInfo, error) {
+	if id == "" {
+		return DeviceInfo{}, fmt.Errorf("FindDeviceByID requires a device ID")
+	}
+
+	for _, info := range config.ListDevices() {
+		if info.ID == id {
+			return info, nil
+		}
+	}
+
+	return DeviceInfo{}, fmt.Errorf("No device with ID '%s' found in config", id)
+}
@@ -0,0 +1,94 @@
+package qcli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListDevices(t *testing.T) {
+	c := &Config{
+		BlkDevices: []BlockDevice{
+			{Driver: VirtioBlock, ID: "hd0", File: "/var/lib/vm.img"},
+			{Driver: IDECDROM, ID: "cd0", File: "/var/lib/installer.iso"},
+		},
+		NetDevices: []NetDevice{
+			{Type: TAP, Driver: VirtioNetPCI, ID: "net0"},
+		},
+		CharDevices: []CharDevice{
+			{Driver: Console, ID: "charconsole0", DeviceID: "console0"},
+		},
+		VhostUserDevices: []VhostUserDevice{
+			{VhostUserType: VhostUserFS, CharDevID: "char-fs-share", TypeDevID: "fs-share"},
+		},
+		VFIODevices: []VFIODevice{
+			{BDF: "02:10.0"},
+		},
+	}
+
+	expected := []DeviceInfo{
+		{List: "BlkDevices", Index: 0, ID: "hd0", Driver: "virtio-blk-pci", Device: c.BlkDevices[0]},
+		{List: "BlkDevices", Index: 1, ID: "cd0", Driver: "ide-cd", Device: c.BlkDevices[1]},
+		{List: "NetDevices", Index: 0, ID: "net0", Driver: "virtio-net-pci", Device: c.NetDevices[0]},
+		{List: "CharDevices", Index: 0, ID: "console0", Driver: "virtconsole", Device: c.CharDevices[0]},
+		{List: "VFIODevices", Index: 0, Driver: "vfio-pci", Device: c.VFIODevices[0]},
+		{List: "VhostUserDevices", Index: 0, ID: "fs-share", Driver: "vhost-user-fs-pci", Device: c.VhostUserDevices[0]},
+	}
+	devices := c.ListDevices()
+	if !reflect.DeepEqual(expected, devices) {
+		t.Errorf("Expected %+v, found %+v", expected, devices)
+	}
+
+	info, err := c.FindDeviceByID("net0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if info.List != "NetDevices" || info.Device.(NetDevice).Type != TAP {
+		t.Errorf("Unexpected device %+v", info)
+	}
+
+	if _, err := c.FindDeviceByID("net1"); err == nil {
+		t.Errorf("Expected error for unknown device ID")
+	}
+	if _, err := c.FindDeviceByID(""); err == nil {
+		t.Errorf("Expected error for empty device ID")
+	}
+}
+
+func TestListDevicesDriver(t *testing.T) {
+	c := &Config{
+		PCIeRootPortDevices: []PCIeRootPortDevice{{ID: "rp0"}},
+		FloppyDevices:       []FloppyDevice{{ID: "fd0", File: "/var/lib/floppy.img"}},
+		WatchdogDevices:     []WatchdogDevice{{Model: WatchdogI6300ESB, ID: "wdt0"}},
+		PVPanicDevices:      []PVPanicDevice{{ID: "panic0"}},
+		BalloonDevices:      []BalloonDevice{{ID: "balloon0"}},
+		LoaderDevices:       []LoaderDevice{{ID: "loader0", File: "/var/lib/blob.bin"}},
+		VSOCKDevices:        []VSOCKDevice{{ID: "vsock0", ContextID: 3}},
+	}
+
+	expected := map[string]string{
+		"rp0":      "pcie-root-port",
+		"fd0":      "floppy",
+		"wdt0":     "i6300esb",
+		"panic0":   "pvpanic",
+		"balloon0": "virtio-balloon-pci",
+		"loader0":  "loader",
+		"vsock0":   "vhost-vsock-pci",
+	}
+	for _, info := range c.ListDevices() {
+		if info.Driver != expected[info.ID] {
+			t.Errorf("Expected %s ID=%s driver %s, found %s", info.List, info.ID, expected[info.ID], info.Driver)
+		}
+	}
+
+	// the drivers are the ones emitted on the qemu command line
+	if _, err := ConfigureParams(c, nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	params := strings.Join(c.qemuParams, " ")
+	for id, driver := range expected {
+		if !strings.Contains(params, "-device "+driver+",") {
+			t.Errorf("Expected -device %s for ID=%s in %s", driver, id, params)
+		}
+	}
+}
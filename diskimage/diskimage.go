@@ -0,0 +1,126 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package diskimage wraps qemu-img to create, inspect, resize and convert
+// the disk images used by qcli virtual machines.
+package diskimage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// QemuImgPath is the qemu-img binary used by this package
+var QemuImgPath = "qemu-img"
+
+const (
+	// FormatQcow2 is the qemu copy on write v2 image format
+	FormatQcow2 = "qcow2"
+
+	// FormatRaw is the raw image format
+	FormatRaw = "raw"
+)
+
+// ImageInfo is the image information reported by qemu-img info.
+type ImageInfo struct {
+	Filename              string `json:"filename"`
+	Format                string `json:"format"`
+	VirtualSize           int64  `json:"virtual-size"`
+	ActualSize            int64  `json:"actual-size"`
+	ClusterSize           int64  `json:"cluster-size"`
+	BackingFilename       string `json:"backing-filename"`
+	BackingFilenameFormat string `json:"backing-filename-format"`
+	DirtyFlag             bool   `json:"dirty-flag"`
+	Encrypted             bool   `json:"encrypted"`
+}
+
+// run runs qemu-img with args and returns its standard output.
+func run(ctx context.Context, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, QemuImgPath, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("qemu-img %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Create creates the image path with the given format and size, e.g.,
+// "20G". If backingFile is set the image is an overlay of backingFile, whose
+// format is detected with Info, and size may be empty to use the size of
+// backingFile.
+func Create(ctx context.Context, path, format, size, backingFile string) error {
+	args := []string{"create", "-f", format}
+
+	if backingFile != "" {
+		info, err := Info(ctx, backingFile)
+		if err != nil {
+			return err
+		}
+		args = append(args, "-b", backingFile, "-F", info.Format)
+	} else if size == "" {
+		return fmt.Errorf("Creating image %s requires a size or a backing file", path)
+	}
+
+	args = append(args, path)
+	if size != "" {
+		args = append(args, size)
+	}
+
+	_, err := run(ctx, args...)
+	return err
+}
+
+// CreateQcow2 creates the qcow2 image path, see Create.
+func CreateQcow2(ctx context.Context, path, size, backingFile string) error {
+	return Create(ctx, path, FormatQcow2, size, backingFile)
+}
+
+// Resize changes the virtual size of the image path to size, which may be
+// relative, e.g., "+10G". Shrinking an image is refused by qemu-img.
+func Resize(ctx context.Context, path, size string) error {
+	_, err := run(ctx, "resize", path, size)
+	return err
+}
+
+// Info returns the information of the image path.
+func Info(ctx context.Context, path string) (*ImageInfo, error) {
+	out, err := run(ctx, "info", "--output=json", path)
+	if err != nil {
+		return nil, err
+	}
+
+	var info ImageInfo
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("unable to parse qemu-img info output for %s: %v", path, err)
+	}
+
+	return &info, nil
+}
+
+// Convert copies the image src to dst converting it to format, e.g.,
+// flattening a qcow2 overlay into a raw image.
+func Convert(ctx context.Context, src, dst, format string) error {
+	_, err := run(ctx, "convert", "-O", format, src, dst)
+	return err
+}
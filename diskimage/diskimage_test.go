@@ -0,0 +1,124 @@
+package diskimage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fakeInfo = `{
+    "virtual-size": 21474836480,
+    "filename": "base.qcow2",
+    "cluster-size": 65536,
+    "format": "qcow2",
+    "actual-size": 200704,
+    "dirty-flag": false
+}`
+
+// fakeQemuImg installs a qemu-img script logging its arguments to the
+// returned file and printing fakeInfo for info.
+func fakeQemuImg(t *testing.T, fail bool) string {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "qemu-img")
+	body := "#!/bin/sh\necho \"$@\" >> " + logFile + "\n"
+	if fail {
+		body += "echo 'qemu-img: Could not open image' >&2\nexit 1\n"
+	} else {
+		body += "if [ \"$1\" = info ]; then cat <<EOF\n" + fakeInfo + "\nEOF\nfi\n"
+	}
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	origPath := QemuImgPath
+	QemuImgPath = script
+	t.Cleanup(func() { QemuImgPath = origPath })
+
+	return logFile
+}
+
+func readArgs(t *testing.T, logFile string) []string {
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func TestCreateQcow2(t *testing.T) {
+	logFile := fakeQemuImg(t, false)
+	ctx := context.Background()
+
+	if err := CreateQcow2(ctx, "disk.qcow2", "20G", ""); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := CreateQcow2(ctx, "overlay.qcow2", "", "base.qcow2"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := CreateQcow2(ctx, "disk.qcow2", "", ""); err == nil {
+		t.Fatalf("Expected error creating an image without size or backing file")
+	}
+
+	expected := []string{
+		"create -f qcow2 disk.qcow2 20G",
+		"info --output=json base.qcow2",
+		"create -f qcow2 -b base.qcow2 -F qcow2 overlay.qcow2",
+	}
+	if args := readArgs(t, logFile); strings.Join(args, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected qemu-img calls\n%s\nfound\n%s", strings.Join(expected, "\n"), strings.Join(args, "\n"))
+	}
+}
+
+func TestInfo(t *testing.T) {
+	fakeQemuImg(t, false)
+
+	info, err := Info(context.Background(), "base.qcow2")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := ImageInfo{
+		Filename:    "base.qcow2",
+		Format:      FormatQcow2,
+		VirtualSize: 21474836480,
+		ActualSize:  200704,
+		ClusterSize: 65536,
+	}
+	if *info != expected {
+		t.Fatalf("Expected %+v, found %+v", expected, *info)
+	}
+}
+
+func TestResizeConvert(t *testing.T) {
+	logFile := fakeQemuImg(t, false)
+	ctx := context.Background()
+
+	if err := Resize(ctx, "disk.qcow2", "+10G"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := Convert(ctx, "disk.qcow2", "disk.img", FormatRaw); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := []string{
+		"resize disk.qcow2 +10G",
+		"convert -O raw disk.qcow2 disk.img",
+	}
+	if args := readArgs(t, logFile); strings.Join(args, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected qemu-img calls\n%s\nfound\n%s", strings.Join(expected, "\n"), strings.Join(args, "\n"))
+	}
+}
+
+func TestQemuImgFailure(t *testing.T) {
+	fakeQemuImg(t, true)
+
+	_, err := Info(context.Background(), "missing.qcow2")
+	if err == nil {
+		t.Fatalf("Expected error for failed qemu-img")
+	}
+	if !strings.Contains(err.Error(), "Could not open image") {
+		t.Errorf("Expected qemu-img stderr in error, found %v", err)
+	}
+}
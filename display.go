@@ -0,0 +1,140 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DisplayType is the qemu display backend.
+type DisplayType string
+
+const (
+	// DisplayNone shows no display, the guest still has a graphic card.
+	DisplayNone DisplayType = "none"
+
+	// DisplayGTK is the GTK window display.
+	DisplayGTK DisplayType = "gtk"
+
+	// DisplaySDL is the SDL window display.
+	DisplaySDL DisplayType = "sdl"
+
+	// DisplayEGLHeadless renders with OpenGL without showing a window,
+	// e.g. for a virgl guest viewed through spice or vnc.
+	DisplayEGLHeadless DisplayType = "egl-headless"
+
+	// DisplayDBus exports the display on D-Bus.
+	DisplayDBus DisplayType = "dbus"
+)
+
+// Display describes the -display parameter. Unlike Knobs.NoGraphic, which
+// also redirects the serial port and monitor to stdio, it only selects how
+// the guest graphic output is shown.
+type Display struct {
+	// Type is the display backend.
+	Type DisplayType `yaml:"type"`
+
+	// GL enables OpenGL, on|off, for the gtk, sdl and dbus displays.
+	GL string `yaml:"gl"`
+
+	// ShowCursor forces the mouse cursor to be shown, for the gtk and
+	// sdl displays.
+	ShowCursor bool `yaml:"show-cursor"`
+
+	// WindowClose controls whether closing the window quits qemu, on|off,
+	// for the gtk and sdl displays.
+	WindowClose string `yaml:"window-close"`
+}
+
+// Valid returns an error if the Display structure is not valid and
+// complete.
+func (display Display) Valid() error {
+	switch display.Type {
+	case DisplayNone, DisplayGTK, DisplaySDL, DisplayEGLHeadless, DisplayDBus:
+	case "":
+		return fmt.Errorf("Display has empty Type field")
+	default:
+		return fmt.Errorf("Display has unknown Type '%s'", display.Type)
+	}
+
+	windowed := display.Type == DisplayGTK || display.Type == DisplaySDL
+
+	if display.GL != "" {
+		if !windowed && display.Type != DisplayDBus {
+			return fmt.Errorf("Display Type=%s does not support GL", display.Type)
+		}
+		if _, err := getConfigOnOff("Display GL", "gl", display.GL); err != nil {
+			return err
+		}
+	}
+
+	if !windowed && (display.ShowCursor || display.WindowClose != "") {
+		return fmt.Errorf("Display Type=%s does not support ShowCursor or WindowClose, only %s and %s do", display.Type, DisplayGTK, DisplaySDL)
+	}
+
+	if _, err := getConfigOnOff("Display WindowClose", "window-close", display.WindowClose); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the Display.
+func (display Display) QemuParams() []string {
+	var displayParams []string
+
+	displayParams = append(displayParams, string(display.Type))
+
+	if display.GL != "" {
+		displayParams = append(displayParams, fmt.Sprintf("gl=%s", display.GL))
+	}
+	if display.ShowCursor {
+		displayParams = append(displayParams, "show-cursor=on")
+	}
+	if display.WindowClose != "" {
+		displayParams = append(displayParams, fmt.Sprintf("window-close=%s", display.WindowClose))
+	}
+
+	return []string{"-display", strings.Join(displayParams, ",")}
+}
+
+func (config *Config) appendDisplay() error {
+	if config.Display.Type == "" {
+		return nil
+	}
+
+	if config.Knobs.NoGraphic {
+		return fmt.Errorf("Display and Knobs.NoGraphic are mutually exclusive")
+	}
+
+	if err := config.Display.Valid(); err != nil {
+		return err
+	}
+
+	config.qemuParams = append(config.qemuParams, config.Display.QemuParams()...)
+
+	return nil
+}
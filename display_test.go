@@ -0,0 +1,45 @@
+package qcli
+
+import "testing"
+
+var (
+	displayGTKString         = "-display gtk,gl=on,show-cursor=on,window-close=off"
+	displayEGLHeadlessString = "-display egl-headless"
+)
+
+func TestAppendDisplay(t *testing.T) {
+	display := Display{
+		Type:        DisplayGTK,
+		GL:          "on",
+		ShowCursor:  true,
+		WindowClose: "off",
+	}
+	testAppend(display, displayGTKString, t)
+
+	testAppend(Display{Type: DisplayEGLHeadless}, displayEGLHeadlessString, t)
+}
+
+func TestBadDisplay(t *testing.T) {
+	displays := []Display{
+		{GL: "on"},
+		{Type: "vnc"},
+		{Type: DisplaySDL, GL: "yes"},
+		{Type: DisplayNone, GL: "on"},
+		{Type: DisplayEGLHeadless, ShowCursor: true},
+		{Type: DisplayDBus, WindowClose: "on"},
+		{Type: DisplayGTK, WindowClose: "maybe"},
+	}
+	for _, d := range displays {
+		if err := d.Valid(); err == nil {
+			t.Errorf("Expected error for invalid Display %+v", d)
+		}
+	}
+
+	c := &Config{
+		Display: Display{Type: DisplayNone},
+		Knobs:   Knobs{NoGraphic: true},
+	}
+	if err := c.appendDisplay(); err == nil {
+		t.Errorf("Expected error for Display with NoGraphic")
+	}
+}
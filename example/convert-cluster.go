@@ -12,16 +12,16 @@ import (
 )
 
 type QemuDisk struct {
-	File      string `yaml:"file"`
-	Format    string `yaml:"format"`
-	Size      string `yaml:"size"`
-	Attach    string `yaml:"attach"`
-	Type      string `yaml:"type"`
-	BlockSize int    `yaml:"blocksize"`
-	BusAddr   string `yaml:"addr"`
-	BootIndex string `yaml:"bootindex"`
-	ReadOnly  bool   `yaml:"read-only"`
-	Serial    string `yaml:"serial"`
+	File      string          `yaml:"file"`
+	Format    string          `yaml:"format"`
+	Size      string          `yaml:"size"`
+	Attach    string          `yaml:"attach"`
+	Type      string          `yaml:"type"`
+	BlockSize int             `yaml:"blocksize"`
+	BusAddr   string          `yaml:"addr"`
+	BootIndex *qcli.BootIndex `yaml:"bootindex"`
+	ReadOnly  bool            `yaml:"read-only"`
+	Serial    string          `yaml:"serial"`
 }
 
 func (q *QemuDisk) Sanitize(basedir string) error {
@@ -93,12 +93,12 @@ type VMDef struct {
 }
 
 type NicDef struct {
-	BusAddr   string     `yaml:"addr"`
-	Device    string     `yaml:"device"`
-	ID        string     `yaml:"id"`
-	Mac       string     `yaml:"mac"`
-	Ports     []PortRule `yaml:"ports"`
-	BootIndex string     `yaml:"bootindex"`
+	BusAddr   string          `yaml:"addr"`
+	Device    string          `yaml:"device"`
+	ID        string          `yaml:"id"`
+	Mac       string          `yaml:"mac"`
+	Ports     []PortRule      `yaml:"ports"`
+	BootIndex *qcli.BootIndex `yaml:"bootindex"`
 }
 
 type VMNic struct {
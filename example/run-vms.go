@@ -88,7 +88,7 @@ func getFullConfig() qcli.Config {
 				Cache:         qcli.CacheModeUnsafe,
 				Discard:       qcli.DiscardUnmap,
 				DetectZeroes:  qcli.DetectZeroesUnmap,
-				BootIndex:     "0",
+				BootIndex:     qcli.NewBootIndex(0),
 			},
 		},
 		NetDevices: []qcli.NetDevice{
@@ -96,14 +96,16 @@ func getFullConfig() qcli.Config {
 				Driver:     qcli.VirtioNet,
 				Type:       qcli.USER,
 				ID:         "user0",
-				MACAddress: "01:02:de:ad:be:ef",
+				MACAddress: "52:54:00:12:34:56",
 				Bus:        "pcie.0",
 				User: qcli.NetDeviceUser{
 					IPV4: true,
-					HostForward: qcli.PortRule{
-						Protocol: "tcp",
-						Host:     qcli.Port{Port: 22222},
-						Guest:    qcli.Port{Port: 22},
+					HostForward: []qcli.PortRule{
+						{
+							Protocol: "tcp",
+							Host:     qcli.Port{Port: 22222},
+							Guest:    qcli.Port{Port: 22},
+						},
 					},
 				},
 			},
@@ -350,24 +352,23 @@ func BackgroundVM(config *qcli.Config, timeout time.Duration) error {
 	}
 	log.Infof("VM:%s Status:%s Running:%v", vmName, status.Status, status.Running)
 
-	log.Infof("VM:%s Waiting 20 seconds for boot to prompt...", vmName)
-	time.Sleep(time.Second * 20)
+	log.Infof("VM:%s waiting up to 2 minutes for ssh on the forwarded port...", vmName)
+	bootCtx, bootCancel := context.WithTimeout(ctx, 2*time.Minute)
+	err = config.WaitForSSHPort(bootCtx)
+	bootCancel()
+	if err != nil {
+		log.Warnf("VM:%s did not finish booting: %s", vmName, err.Error())
+	}
 
-	// Let's try to shutdown the VM.  If it hasn't shutdown in 10 seconds we'll
-	// send a quit message.
-	log.Infof("VM:%s trying graceful shutdown via system_powerdown (%s timeout before cancelling)..", vmName, timeout.String())
-	err = q.ExecuteSystemPowerdown(ctx)
+	// Let's try to shutdown the VM, escalating to quit and then killing
+	// qemu if it hasn't shutdown within timeout.
+	log.Infof("VM:%s trying graceful shutdown via system_powerdown (%s timeout before escalating)..", vmName, timeout.String())
+	level, err := qcli.Shutdown(ctx, q, timeout, vm.Cmd.Process.Kill)
 	if err != nil {
 		log.Errorf("VM:%s error:%s", vmName, err.Error())
 	}
+	log.Infof("VM:%s stopped by %s", vmName, level)
 
-	select {
-	case <-doneCh:
-		log.Infof("VM:%s has exited without cancel", vmName)
-	case <-time.After(timeout):
-		log.Warnf("VM:%s timed out, killing via cancel context...", vmName)
-		vm.Cancel()
-	}
 	// should be no-op but we need to make sure it's gone
 	wg.Wait()
 	<-disconnectedCh
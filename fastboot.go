@@ -0,0 +1,142 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import "fmt"
+
+const (
+	// DefaultFastBootMemory is the guest memory of NewFastBootConfig when
+	// FastBootOptions.Memory is not set
+	DefaultFastBootMemory = "512M"
+
+	// DefaultVirtioFSTag is the virtio-fs mount tag of NewFastBootConfig
+	// when FastBootOptions.VirtioFSTag is not set
+	DefaultVirtioFSTag = "rootfs"
+
+	// fastBootSharedMemPath is the directory of the guest memory file, the
+	// vhost-user backends map the guest memory from it
+	fastBootSharedMemPath = "/dev/shm"
+)
+
+// FastBootOptions are the knobs of the NewFastBootConfig preset.
+type FastBootOptions struct {
+	// Name is the VM name
+	Name string
+
+	// CPUs is the number of vcpus, 1 when not set
+	CPUs uint32
+
+	// Memory is the guest memory size, DefaultFastBootMemory when not set
+	Memory string
+
+	// Kernel is the directly booted guest kernel, Kernel.Path is required
+	Kernel Kernel
+
+	// Microvm uses the microvm machine type instead of a minimal q35
+	Microvm bool
+
+	// GuestCID is the vsock context ID of the guest, no vsock device is
+	// added when it is 0
+	GuestCID uint64
+
+	// VirtioFSSocket is the vhost-user socket of a running virtiofsd, no
+	// virtio-fs share is added when it is empty
+	VirtioFSSocket string
+
+	// VirtioFSTag is the mount tag of the virtio-fs share,
+	// DefaultVirtioFSTag when not set
+	VirtioFSTag string
+}
+
+// NewFastBootConfig returns a Config preset for secure container style VMs
+// booting a kernel directly: a microvm or minimal q35 machine with no
+// graphics and no default devices, an optional vsock device to talk to an
+// in guest agent and an optional virtio-fs share. The guest memory is
+// shared so vhost-user backends like virtiofsd can map it. A console can be
+// added with AddConsolePreset.
+func NewFastBootConfig(opts FastBootOptions) (*Config, error) {
+	if opts.Kernel.Path == "" {
+		return nil, fmt.Errorf("FastBootOptions has empty Kernel.Path field")
+	}
+
+	var config *Config
+	if opts.Microvm {
+		config = NewMicrovmConfig()
+	} else {
+		config = &Config{
+			Machine: Machine{
+				Type:         MachineTypePC35,
+				Acceleration: MachineAccelerationKVM,
+			},
+			Knobs: Knobs{
+				NoUserConfig: true,
+				NoDefaults:   true,
+				NoGraphic:    true,
+			},
+		}
+	}
+
+	config.Name = opts.Name
+	config.Kernel = opts.Kernel
+
+	config.SMP.CPUs = opts.CPUs
+	if config.SMP.CPUs == 0 {
+		config.SMP.CPUs = 1
+	}
+
+	config.Memory.Size = opts.Memory
+	if config.Memory.Size == "" {
+		config.Memory.Size = DefaultFastBootMemory
+	}
+	config.Memory.Path = fastBootSharedMemPath
+	config.Knobs.FileBackedMem = true
+	config.Knobs.MemShared = true
+
+	if opts.GuestCID != 0 {
+		config.VSOCKDevices = []VSOCKDevice{
+			{
+				ID:        "vsock0",
+				ContextID: opts.GuestCID,
+			},
+		}
+	}
+
+	if opts.VirtioFSSocket != "" {
+		tag := opts.VirtioFSTag
+		if tag == "" {
+			tag = DefaultVirtioFSTag
+		}
+		config.VhostUserDevices = []VhostUserDevice{
+			{
+				SocketPath:    opts.VirtioFSSocket,
+				CharDevID:     "char-fs0",
+				Tag:           tag,
+				VhostUserType: VhostUserFS,
+			},
+		}
+	}
+
+	return config, nil
+}
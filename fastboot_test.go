@@ -0,0 +1,91 @@
+package qcli
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testKernelFile creates an empty kernel image as Kernel.Valid requires
+// the kernel to exist.
+func testKernelFile(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "vmlinuz")
+	if err := os.WriteFile(path, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var fastBootConfigString = "-name agent -machine q35,accel=kvm -m 1G -device vhost-vsock-pci,disable-modern=false,id=vsock0,guest-cid=3 -chardev socket,id=char-fs0,path=/run/virtiofsd.sock -device vhost-user-fs-pci,chardev=char-fs0,tag=rootfs -object memory-backend-file,id=dimm1,size=1G,mem-path=/dev/shm,share=on -numa node,memdev=dimm1 -no-user-config -nodefaults -nographic -kernel KERNEL -append console=hvc0 -smp 2"
+
+func TestNewFastBootConfig(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("the preset machine types are amd64 machine types")
+	}
+
+	kernel := testKernelFile(t)
+	c, err := NewFastBootConfig(FastBootOptions{
+		Name:           "agent",
+		CPUs:           2,
+		Memory:         "1G",
+		Kernel:         Kernel{Path: kernel, Params: "console=hvc0"},
+		GuestCID:       3,
+		VirtioFSSocket: "/run/virtiofsd.sock",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	params, err := ConfigureParams(c, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := strings.Replace(fastBootConfigString, "KERNEL", kernel, 1)
+	if out := strings.Join(params, " "); out != expected {
+		t.Errorf("Expected:\n%s\nfound:\n%s", expected, out)
+	}
+}
+
+func TestNewFastBootConfigMicrovm(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("microvm is an amd64 machine type")
+	}
+
+	kernel := testKernelFile(t)
+	c, err := NewFastBootConfig(FastBootOptions{
+		Kernel:         Kernel{Path: kernel},
+		Microvm:        true,
+		GuestCID:       3,
+		VirtioFSSocket: "/run/virtiofsd.sock",
+		VirtioFSTag:    "share",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	params, err := ConfigureParams(c, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	out := strings.Join(params, " ")
+	for _, expected := range []string{
+		"-machine microvm,",
+		"-m 512M",
+		"vhost-user-fs-device,chardev=char-fs0,tag=share",
+		"vhost-vsock-device,id=vsock0,guest-cid=3",
+		"-machine memory-backend=dimm1",
+		"-smp 1",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %q in microvm params: %s", expected, out)
+		}
+	}
+}
+
+func TestNewFastBootConfigNoKernel(t *testing.T) {
+	if _, err := NewFastBootConfig(FastBootOptions{}); err == nil {
+		t.Errorf("Expected error for a fast boot config without kernel")
+	}
+}
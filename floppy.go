@@ -0,0 +1,165 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// FloppyDriver is the floppy disk drive device driver.
+	FloppyDriver DeviceDriver = "floppy"
+
+	// ISAFloppyController is the ISA floppy disk controller device driver.
+	ISAFloppyController DeviceDriver = "isa-fdc"
+
+	// floppyControllerID is the ID of the isa-fdc added for the floppies of
+	// the machines without an onboard floppy controller.
+	floppyControllerID = "fdc0"
+)
+
+// FloppyDevice represents a floppy disk drive holding a disk image, e.g.
+// to boot an old installer.
+type FloppyDevice struct {
+	// ID is the drive ID
+	ID string `yaml:"id"`
+
+	// File is the floppy disk image
+	File string `yaml:"file"`
+
+	// Format is the image format, defaults to raw
+	Format BlockDeviceFormat `yaml:"format"`
+
+	// Unit is the drive number on the controller, 0 for A: and 1 for B:
+	Unit int `yaml:"unit"`
+
+	// ReadOnly write protects the floppy disk
+	ReadOnly bool `yaml:"read-only"`
+
+	// BootIndex is the boot order of the drive
+	BootIndex *BootIndex `yaml:"bootindex"`
+}
+
+// Valid returns an error if the FloppyDevice structure is not valid and
+// complete.
+func (fd FloppyDevice) Valid() error {
+	if fd.ID == "" {
+		return fmt.Errorf("FloppyDevice has empty ID field")
+	}
+
+	if fd.File == "" {
+		return fmt.Errorf("FloppyDevice ID=%s has empty File field", fd.ID)
+	}
+
+	if fd.Unit != 0 && fd.Unit != 1 {
+		return fmt.Errorf("FloppyDevice ID=%s has invalid Unit field: %d, must be 0 or 1", fd.ID, fd.Unit)
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the FloppyDevice.
+func (fd FloppyDevice) QemuParams(config *Config) []string {
+	var driveParams []string
+	var deviceParams []string
+	var qemuParams []string
+
+	format := fd.Format
+	if format == "" {
+		format = RAW
+	}
+
+	driveParams = append(driveParams, fmt.Sprintf("file=%s", fd.File))
+	driveParams = append(driveParams, fmt.Sprintf("id=%s", fd.ID))
+	driveParams = append(driveParams, "if=none")
+	driveParams = append(driveParams, fmt.Sprintf("format=%s", format))
+	if fd.ReadOnly {
+		driveParams = append(driveParams, "readonly=on")
+	}
+
+	deviceParams = append(deviceParams, string(FloppyDriver))
+	deviceParams = append(deviceParams, fmt.Sprintf("drive=%s", fd.ID))
+	deviceParams = append(deviceParams, fmt.Sprintf("unit=%d", fd.Unit))
+	if p := fd.BootIndex.param(); p != "" {
+		deviceParams = append(deviceParams, p)
+	}
+
+	qemuParams = append(qemuParams, "-drive")
+	qemuParams = append(qemuParams, strings.Join(driveParams, ","))
+	qemuParams = append(qemuParams, "-device")
+	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+
+	return qemuParams
+}
+
+// floppyController is the isa-fdc controller of the floppy drives on the
+// machines without an onboard one.
+type floppyController struct {
+	ID string
+}
+
+// Valid always succeeds, the controller is added by appendDevices.
+func (fdc floppyController) Valid() error {
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the floppyController.
+func (fdc floppyController) QemuParams(config *Config) []string {
+	return []string{"-device", fmt.Sprintf("%s,id=%s", ISAFloppyController, fdc.ID)}
+}
+
+// needsFloppyController returns true if the machine has no onboard floppy
+// controller and an isa-fdc must be added for the floppy drives.
+func (config *Config) needsFloppyController() bool {
+	return strings.Contains(config.Machine.Type, "q35")
+}
+
+// validateFloppies checks the machine has an ISA bus for the floppy drives
+// and that no two drives share a unit.
+func (config *Config) validateFloppies() error {
+	if len(config.FloppyDevices) == 0 {
+		return nil
+	}
+
+	machine := config.Machine.Type
+	if machine != "" && machine != MachineTypePC && !strings.HasPrefix(machine, "pc-") && !strings.Contains(machine, "q35") {
+		return fmt.Errorf("FloppyDevices are not supported by machine type %s", machine)
+	}
+
+	if len(config.FloppyDevices) > 2 {
+		return fmt.Errorf("At most 2 FloppyDevices are supported, found %d", len(config.FloppyDevices))
+	}
+
+	units := make(map[int]string)
+	for _, fd := range config.FloppyDevices {
+		if other, ok := units[fd.Unit]; ok {
+			return fmt.Errorf("FloppyDevice ID=%s and ID=%s have the same Unit %d", other, fd.ID, fd.Unit)
+		}
+		units[fd.Unit] = fd.ID
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package qcli
+
+import "testing"
+
+var (
+	deviceFloppyString    = "-drive file=/var/lib/dos622.img,id=fd0,if=none,format=raw,readonly=on -device floppy,drive=fd0,unit=0,bootindex=0"
+	floppyQ35ConfigString = "-machine q35 -device isa-fdc,id=fdc0 -drive file=disk1.img,id=fd0,if=none,format=raw -device floppy,drive=fd0,unit=0 -drive file=disk2.img,id=fd1,if=none,format=raw -device floppy,drive=fd1,unit=1"
+	floppyPCConfigString  = "-machine pc -drive file=disk1.img,id=fd0,if=none,format=raw -device floppy,drive=fd0,unit=0"
+)
+
+func TestAppendFloppyDevice(t *testing.T) {
+	fd := FloppyDevice{
+		ID:        "fd0",
+		File:      "/var/lib/dos622.img",
+		ReadOnly:  true,
+		BootIndex: NewBootIndex(0),
+	}
+	testAppend(fd, deviceFloppyString, t)
+}
+
+func TestAppendConfigFloppyDevices(t *testing.T) {
+	c := &Config{
+		Machine: Machine{Type: MachineTypePC35},
+		FloppyDevices: []FloppyDevice{
+			{ID: "fd0", File: "disk1.img"},
+			{ID: "fd1", File: "disk2.img", Unit: 1},
+		},
+	}
+	testConfig(c, floppyQ35ConfigString, t)
+
+	c = &Config{
+		Machine: Machine{Type: MachineTypePC},
+		FloppyDevices: []FloppyDevice{
+			{ID: "fd0", File: "disk1.img"},
+		},
+	}
+	testConfig(c, floppyPCConfigString, t)
+}
+
+func TestBadFloppyDevices(t *testing.T) {
+	devices := []FloppyDevice{
+		{File: "disk1.img"},
+		{ID: "fd0"},
+		{ID: "fd0", File: "disk1.img", Unit: 2},
+	}
+	for _, d := range devices {
+		if err := d.Valid(); err == nil {
+			t.Errorf("Expected error for invalid FloppyDevice %+v", d)
+		}
+	}
+
+	fd0 := FloppyDevice{ID: "fd0", File: "disk1.img"}
+	fd1 := FloppyDevice{ID: "fd1", File: "disk2.img", Unit: 1}
+	configs := []*Config{
+		{Machine: Machine{Type: MachineTypeVirt}, FloppyDevices: []FloppyDevice{fd0}},
+		{Machine: Machine{Type: MachineTypeMicrovm}, FloppyDevices: []FloppyDevice{fd0}},
+		{FloppyDevices: []FloppyDevice{fd0, fd0}},
+		{FloppyDevices: []FloppyDevice{fd0, fd1, fd1}},
+	}
+	for _, c := range configs {
+		if err := c.validateFloppies(); err == nil {
+			t.Errorf("Expected error for invalid floppy config %+v", c)
+		}
+	}
+}
@@ -157,7 +157,7 @@ func (fsdev FSDevice) QemuParams(config *Config) []string {
 		if config.Knobs.IOMMUPlatform {
 			deviceParams = append(deviceParams, ",iommu_platform=on")
 		}
-		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", fsdev.DevNo))
+		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(fsdev.DevNo)))
 	}
 
 	fsParams = append(fsParams, string(fsdev.FSDriver))
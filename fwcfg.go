@@ -27,15 +27,29 @@ package qcli
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
 // FwCfg allows QEMU to pass entries to the guest
-// File and Str are mutually exclusive
+// File, Str and Data are mutually exclusive
 type FwCfg struct {
 	Name string `yaml:"name"`
 	File string `yaml:"file"`
 	Str  string `yaml:"string"`
+
+	// Data is written to a temporary file when the qemu parameters are
+	// built. The file is removed by Config.Cleanup.
+	Data []byte `yaml:"-"`
+}
+
+// FwCfgFromBytes returns a FwCfg entry passing data to the guest under name,
+// e.g. opt/com.mycompany/blob.
+func FwCfgFromBytes(name string, data []byte) FwCfg {
+	return FwCfg{
+		Name: name,
+		Data: data,
+	}
 }
 
 // Valid returns true if the FwCfg structure is valid and complete.
@@ -44,15 +58,14 @@ func (fwcfg FwCfg) Valid() bool {
 		return false
 	}
 
-	if fwcfg.File != "" && fwcfg.Str != "" {
-		return false
-	}
-
-	if fwcfg.File == "" && fwcfg.Str == "" {
-		return false
+	sources := 0
+	for _, set := range []bool{fwcfg.File != "", fwcfg.Str != "", fwcfg.Data != nil} {
+		if set {
+			sources++
+		}
 	}
 
-	return true
+	return sources == 1
 }
 
 // QemuParams returns the qemu parameters built out of the FwCfg object
@@ -60,27 +73,44 @@ func (fwcfg FwCfg) QemuParams(config *Config) []string {
 	var fwcfgParams []string
 	var qemuParams []string
 
-	for _, f := range config.FwCfg {
-		if f.Name != "" {
-			fwcfgParams = append(fwcfgParams, fmt.Sprintf("name=%s", f.Name))
+	if fwcfg.Name == "" {
+		return qemuParams
+	}
 
-			if f.File != "" {
-				fwcfgParams = append(fwcfgParams, fmt.Sprintf("file=%s", f.File))
-			}
+	fwcfgParams = append(fwcfgParams, fmt.Sprintf("name=%s", fwcfg.Name))
 
-			if f.Str != "" {
-				fwcfgParams = append(fwcfgParams, fmt.Sprintf("string=%s", f.Str))
-			}
-		}
+	if fwcfg.File != "" {
+		fwcfgParams = append(fwcfgParams, fmt.Sprintf("file=%s", fwcfg.File))
+	}
 
-		qemuParams = append(qemuParams, "-fw_cfg")
-		qemuParams = append(qemuParams, strings.Join(fwcfgParams, ","))
+	if fwcfg.Str != "" {
+		fwcfgParams = append(fwcfgParams, fmt.Sprintf("string=%s", fwcfg.Str))
 	}
 
+	qemuParams = append(qemuParams, "-fw_cfg")
+	qemuParams = append(qemuParams, strings.Join(fwcfgParams, ","))
+
 	return qemuParams
 }
 
-func (config *Config) appendFwCfg(logger QMPLog) {
+// writeData writes the Data of the FwCfg entry to a temporary file and
+// returns the file path.
+func (fwcfg FwCfg) writeData(dir string) (string, error) {
+	f, err := os.CreateTemp(dir, "fw_cfg-")
+	if err != nil {
+		return "", fmt.Errorf("Failed to create fw_cfg file for %s: %s", fwcfg.Name, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(fwcfg.Data); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("Failed to write fw_cfg file for %s: %s", fwcfg.Name, err)
+	}
+
+	return f.Name(), nil
+}
+
+func (config *Config) appendFwCfg(logger QMPLog) error {
 	if logger == nil {
 		logger = qmpNullLogger{}
 	}
@@ -91,6 +121,18 @@ func (config *Config) appendFwCfg(logger QMPLog) {
 			continue
 		}
 
+		if f.Data != nil {
+			path, err := f.writeData(config.StateDir)
+			if err != nil {
+				return err
+			}
+			config.tempFiles = append(config.tempFiles, path)
+			f.File = path
+			f.Data = nil
+		}
+
 		config.qemuParams = append(config.qemuParams, f.QemuParams(config)...)
 	}
+
+	return nil
 }
@@ -1,6 +1,11 @@
 package qcli
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestAppendFwcfg(t *testing.T) {
 	fwcfgString := "-fw_cfg name=opt/com.mycompany/blob,file=./my_blob.bin"
@@ -39,3 +44,57 @@ func TestBadFwcfg(t *testing.T) {
 		t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
 	}
 }
+
+func TestAppendFwcfgFromBytes(t *testing.T) {
+	data := []byte("blob contents")
+	c := &Config{
+		StateDir: t.TempDir(),
+		FwCfg: []FwCfg{
+			FwCfgFromBytes("opt/com.mycompany/blob", data),
+			{
+				Name: "opt/com.mycompany/str",
+				Str:  "foo",
+			},
+		},
+	}
+	c.appendFwCfg(nil)
+
+	if len(c.tempFiles) != 1 {
+		t.Fatalf("Expected 1 temporary file, found %v", c.tempFiles)
+	}
+	path := c.tempFiles[0]
+
+	expected := "-fw_cfg name=opt/com.mycompany/blob,file=" + path + " -fw_cfg name=opt/com.mycompany/str,string=foo"
+	result := strings.Join(c.qemuParams, " ")
+	if result != expected {
+		t.Fatalf("Failed to append parameters [%s] != [%s]", result, expected)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read fw_cfg file: %s", err)
+	}
+	if string(content) != string(data) {
+		t.Fatalf("Expected fw_cfg file content %q, found %q", data, content)
+	}
+
+	if err := c.Cleanup(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be removed by Cleanup", path)
+	}
+}
+
+func TestAppendFwcfgFromBytesError(t *testing.T) {
+	c := &Config{
+		StateDir: filepath.Join(t.TempDir(), "missing"),
+		FwCfg:    []FwCfg{FwCfgFromBytes("opt/com.mycompany/blob", []byte("blob"))},
+	}
+	if err := c.appendFwCfg(nil); err == nil {
+		t.Errorf("Expected error writing fw_cfg data to a missing StateDir")
+	}
+	if _, err := ConfigureParams(c, nil); err == nil {
+		t.Errorf("Expected ConfigureParams error writing fw_cfg data to a missing StateDir")
+	}
+}
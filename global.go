@@ -0,0 +1,196 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GlobalProperty is a -global parameter, it sets the default value of a
+// property for every device created with the given driver.
+type GlobalProperty struct {
+	Driver   string `yaml:"driver"`
+	Property string `yaml:"property"`
+	Value    string `yaml:"value"`
+}
+
+// UnmarshalYAML accepts either the mapping form of a GlobalProperty or the
+// qemu string form, e.g., "ICH9-LPC.disable_s3=1" or
+// "driver=cfi.pflash01,property=secure,value=on".
+func (g *GlobalProperty) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var propStr string
+	if err := unmarshal(&propStr); err == nil {
+		prop, err := ParseGlobalProperty(propStr)
+		if err != nil {
+			return err
+		}
+		*g = prop
+		return nil
+	}
+
+	// avoid recursing into this UnmarshalYAML
+	type globalProperty GlobalProperty
+	var prop globalProperty
+	if err := unmarshal(&prop); err != nil {
+		return err
+	}
+	*g = GlobalProperty(prop)
+
+	return nil
+}
+
+// ParseGlobalProperty parses a -global parameter in either the
+// driver.property=value or the driver=D,property=P,value=V form.  As in
+// qemu, the short form splits the driver from the property at the first
+// '.', drivers with a '.' in their name need the long form.
+func ParseGlobalProperty(param string) (GlobalProperty, error) {
+	var g GlobalProperty
+
+	if strings.HasPrefix(param, "driver=") {
+		for _, opt := range splitParams(param) {
+			key, val, found := strings.Cut(opt, "=")
+			if !found {
+				return g, fmt.Errorf("Invalid GlobalProperty %q: option %q is missing '='", param, opt)
+			}
+			switch key {
+			case "driver":
+				g.Driver = val
+			case "property":
+				g.Property = val
+			case "value":
+				g.Value = val
+			default:
+				return g, fmt.Errorf("Invalid GlobalProperty %q: unknown option %q", param, key)
+			}
+		}
+	} else {
+		key, val, found := strings.Cut(param, "=")
+		if !found {
+			return g, fmt.Errorf("Invalid GlobalProperty %q: missing '='", param)
+		}
+		g.Driver, g.Property, _ = strings.Cut(key, ".")
+		g.Value = val
+	}
+
+	if err := g.Valid(); err != nil {
+		return GlobalProperty{}, fmt.Errorf("Invalid GlobalProperty %q: %s", param, err)
+	}
+
+	return g, nil
+}
+
+// splitParams splits a qemu option string on ',' keeping escaped ',,'
+// inside the values.
+func splitParams(param string) []string {
+	var opts []string
+	var opt strings.Builder
+
+	for i := 0; i < len(param); i++ {
+		if param[i] != ',' {
+			opt.WriteByte(param[i])
+			continue
+		}
+		if i+1 < len(param) && param[i+1] == ',' {
+			opt.WriteByte(',')
+			i++
+			continue
+		}
+		opts = append(opts, opt.String())
+		opt.Reset()
+	}
+
+	return append(opts, opt.String())
+}
+
+// Valid returns an error if the GlobalProperty is not complete.
+func (g GlobalProperty) Valid() error {
+	if g.Driver == "" {
+		return fmt.Errorf("GlobalProperty has empty Driver field")
+	}
+	if g.Property == "" {
+		return fmt.Errorf("GlobalProperty Driver=%s has empty Property field", g.Driver)
+	}
+	return nil
+}
+
+// String returns the -global parameter value of the GlobalProperty.
+func (g GlobalProperty) String() string {
+	return fmt.Sprintf("driver=%s,property=%s,value=%s", escapeParam(g.Driver), escapeParam(g.Property), escapeParam(g.Value))
+}
+
+// appendGlobalParams emits the legacy GlobalParams strings verbatim followed
+// by the GlobalProperties.  Setting the same driver property more than once
+// with different values is an error, identical repeats are emitted once.
+func (config *Config) appendGlobalParams() error {
+	var params []string
+	values := make(map[string]string)
+
+	// seen reports whether g was already set, it fails if it was set to
+	// a different value
+	seen := func(g GlobalProperty) (bool, error) {
+		key := g.Driver + "." + g.Property
+		val, ok := values[key]
+		if ok && val != g.Value {
+			return true, fmt.Errorf("GlobalProperty %s=%s conflicts with previous value '%s'", key, g.Value, val)
+		}
+		values[key] = g.Value
+		return ok, nil
+	}
+
+	for _, param := range config.GlobalParams {
+		// strings that do not parse are passed as is and left for qemu
+		// to report
+		if g, err := ParseGlobalProperty(param); err == nil {
+			dup, err := seen(g)
+			if err != nil {
+				return err
+			}
+			if dup {
+				continue
+			}
+		}
+		params = append(params, "-global", param)
+	}
+
+	for _, g := range config.GlobalProperties {
+		if err := g.Valid(); err != nil {
+			return err
+		}
+		dup, err := seen(g)
+		if err != nil {
+			return err
+		}
+		if dup {
+			continue
+		}
+		params = append(params, "-global", g.String())
+	}
+
+	config.qemuParams = append(config.qemuParams, params...)
+
+	return nil
+}
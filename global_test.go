@@ -0,0 +1,98 @@
+package qcli
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseGlobalProperty(t *testing.T) {
+	testCases := []struct {
+		param    string
+		expected GlobalProperty
+	}{
+		{"ICH9-LPC.disable_s3=1", GlobalProperty{Driver: "ICH9-LPC", Property: "disable_s3", Value: "1"}},
+		{"driver=cfi.pflash01,property=secure,value=on", GlobalProperty{Driver: "cfi.pflash01", Property: "secure", Value: "on"}},
+		{"driver=virtio-blk-pci,property=serial,value=a,,b", GlobalProperty{Driver: "virtio-blk-pci", Property: "serial", Value: "a,b"}},
+		{"isa-fdc.driveA=", GlobalProperty{Driver: "isa-fdc", Property: "driveA", Value: ""}},
+	}
+
+	for _, tc := range testCases {
+		g, err := ParseGlobalProperty(tc.param)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %q: %v", tc.param, err)
+		}
+		if !reflect.DeepEqual(g, tc.expected) {
+			t.Errorf("Expected %+v for %q, got %+v", tc.expected, tc.param, g)
+		}
+	}
+
+	bad := []string{"param1", "ICH9-LPC=1", "driver=ICH9-LPC,value=1", "driver=ICH9-LPC,property=disable_s3,bogus=1"}
+	for _, param := range bad {
+		if _, err := ParseGlobalProperty(param); err == nil {
+			t.Errorf("Expected error for invalid GlobalProperty %q", param)
+		}
+	}
+}
+
+func TestAppendGlobalProperties(t *testing.T) {
+	c := &Config{
+		GlobalParams: []string{"ICH9-LPC.disable_s3=1", "param1"},
+		GlobalProperties: []GlobalProperty{
+			{Driver: "ICH9-LPC", Property: "disable_s3", Value: "1"},
+			{Driver: "cfi.pflash01", Property: "secure", Value: "on"},
+			{Driver: "virtio-blk-pci", Property: "serial", Value: "a,b"},
+		},
+	}
+	expected := []string{
+		"-global", "ICH9-LPC.disable_s3=1",
+		"-global", "param1",
+		"-global", "driver=cfi.pflash01,property=secure,value=on",
+		"-global", "driver=virtio-blk-pci,property=serial,value=a,,b",
+	}
+	if err := c.appendGlobalParams(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(expected, c.qemuParams) {
+		t.Errorf("Expected %v, found %v", expected, c.qemuParams)
+	}
+
+	bad := []*Config{
+		{
+			GlobalParams:     []string{"ICH9-LPC.disable_s3=1"},
+			GlobalProperties: []GlobalProperty{{Driver: "ICH9-LPC", Property: "disable_s3", Value: "0"}},
+		},
+		{
+			GlobalParams: []string{"ICH9-LPC.disable_s3=1", "driver=ICH9-LPC,property=disable_s3,value=0"},
+		},
+		{
+			GlobalProperties: []GlobalProperty{{Property: "disable_s3", Value: "0"}},
+		},
+	}
+	for _, c := range bad {
+		if err := c.appendGlobalParams(); err == nil {
+			t.Errorf("Expected error for invalid global properties %v %+v", c.GlobalParams, c.GlobalProperties)
+		}
+	}
+}
+
+func TestGlobalPropertyYAML(t *testing.T) {
+	content := []byte(`global-properties:
+- ICH9-LPC.disable_s3=1
+- driver: cfi.pflash01
+  property: secure
+  value: "on"
+`)
+	var config Config
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []GlobalProperty{
+		{Driver: "ICH9-LPC", Property: "disable_s3", Value: "1"},
+		{Driver: "cfi.pflash01", Property: "secure", Value: "on"},
+	}
+	if !reflect.DeepEqual(config.GlobalProperties, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, config.GlobalProperties)
+	}
+}
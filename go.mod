@@ -3,14 +3,15 @@ module github.com/project-machine/qcli
 go 1.19
 
 require (
+	github.com/Microsoft/go-winio v0.5.2
 	github.com/sirupsen/logrus v1.9.0
 	github.com/yourbasic/bit v0.0.0-20180313074424-45a4409f4082
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8
 	gopkg.in/yaml.v2 v2.4.0
 	gopkg.in/yaml.v3 v3.0.0-20220521103104-8f96da9f5d5e
 )
 
 require (
 	github.com/kr/pretty v0.2.0 // indirect
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 )
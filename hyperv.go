@@ -0,0 +1,189 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hvSpinlocksMin is the minimum number of spinlock retries hv_spinlocks
+// accepts.
+const hvSpinlocksMin = 0xfff
+
+// HyperV describes the Hyper-V enlightenments exposed to the guest through
+// the hv_* cpu flags. They improve the performance of Windows guests.
+type HyperV struct {
+	// Relaxed disables the guest watchdog timeouts, hv_relaxed
+	Relaxed bool `yaml:"relaxed"`
+
+	// VAPIC enables the virtual APIC assist page, hv_vapic
+	VAPIC bool `yaml:"vapic"`
+
+	// SpinlockRetries is the number of spinlock retries before the guest
+	// notifies the hypervisor, hv_spinlocks. At least 0xfff when set.
+	SpinlockRetries uint32 `yaml:"spinlock-retries"`
+
+	// VPIndex enables the virtual processor index MSR, hv_vpindex
+	VPIndex bool `yaml:"vpindex"`
+
+	// Runtime enables the virtual processor run time MSR, hv_runtime
+	Runtime bool `yaml:"runtime"`
+
+	// Time enables the Hyper-V reference time counter and TSC page,
+	// hv_time
+	Time bool `yaml:"time"`
+
+	// SynIC enables the synthetic interrupt controller, hv_synic.
+	// Requires VPIndex.
+	SynIC bool `yaml:"synic"`
+
+	// STimer enables the synthetic timers, hv_stimer. Requires SynIC and
+	// Time.
+	STimer bool `yaml:"stimer"`
+
+	// Reset enables the guest reset MSR, hv_reset
+	Reset bool `yaml:"reset"`
+
+	// Frequencies exposes the TSC and APIC frequency MSRs, hv_frequencies
+	Frequencies bool `yaml:"frequencies"`
+
+	// Reenlightenment notifies the guest of TSC frequency changes on
+	// migration, hv_reenlightenment. Requires Frequencies.
+	Reenlightenment bool `yaml:"reenlightenment"`
+
+	// TLBFlush enables the paravirtualized TLB flush, hv_tlbflush.
+	// Requires VPIndex.
+	TLBFlush bool `yaml:"tlbflush"`
+
+	// EVMCS enables the enlightened VMCS for nested Hyper-V, hv_evmcs.
+	// Requires VAPIC and an Intel host.
+	EVMCS bool `yaml:"evmcs"`
+}
+
+// Enabled returns true if any of the Hyper-V enlightenments is set.
+func (hv HyperV) Enabled() bool {
+	return hv != HyperV{}
+}
+
+// Valid returns an error if the HyperV structure is not valid and its
+// enlightenments miss one they depend on.
+func (hv HyperV) Valid() error {
+	if hv.SpinlockRetries != 0 && hv.SpinlockRetries < hvSpinlocksMin {
+		return fmt.Errorf("HyperV SpinlockRetries %d is less than the minimum %d", hv.SpinlockRetries, hvSpinlocksMin)
+	}
+
+	deps := []struct {
+		enabled  bool
+		name     string
+		required bool
+		requires string
+	}{
+		{hv.SynIC, "SynIC", hv.VPIndex, "VPIndex"},
+		{hv.STimer, "STimer", hv.SynIC, "SynIC"},
+		{hv.STimer, "STimer", hv.Time, "Time"},
+		{hv.Reenlightenment, "Reenlightenment", hv.Frequencies, "Frequencies"},
+		{hv.TLBFlush, "TLBFlush", hv.VPIndex, "VPIndex"},
+		{hv.EVMCS, "EVMCS", hv.VAPIC, "VAPIC"},
+	}
+	for _, dep := range deps {
+		if dep.enabled && !dep.required {
+			return fmt.Errorf("HyperV %s requires %s", dep.name, dep.requires)
+		}
+	}
+
+	return nil
+}
+
+// cpuParams returns the hv_* cpu flags of the enabled enlightenments.
+func (hv HyperV) cpuParams() []string {
+	var params []string
+
+	flags := []struct {
+		enabled bool
+		name    string
+	}{
+		{hv.Relaxed, "hv_relaxed"},
+		{hv.VAPIC, "hv_vapic"},
+		{hv.VPIndex, "hv_vpindex"},
+		{hv.Runtime, "hv_runtime"},
+		{hv.Time, "hv_time"},
+		{hv.SynIC, "hv_synic"},
+		{hv.STimer, "hv_stimer"},
+		{hv.Reset, "hv_reset"},
+		{hv.Frequencies, "hv_frequencies"},
+		{hv.Reenlightenment, "hv_reenlightenment"},
+		{hv.TLBFlush, "hv_tlbflush"},
+		{hv.EVMCS, "hv_evmcs"},
+	}
+	for _, flag := range flags {
+		if flag.enabled {
+			params = append(params, flag.name)
+		}
+	}
+	if hv.SpinlockRetries != 0 {
+		params = append(params, fmt.Sprintf("hv_spinlocks=0x%x", hv.SpinlockRetries))
+	}
+
+	return params
+}
+
+// hvFlagName normalizes the hv-* spelling of the Hyper-V cpu flags to hv_*.
+func hvFlagName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// validateHyperV checks the HyperV enlightenments are valid, have a CPUModel
+// to apply to and are not also set by the CPUModelFlags or CPUFeatures.
+func (config *Config) validateHyperV() error {
+	if !config.HyperV.Enabled() {
+		return nil
+	}
+
+	if err := config.HyperV.Valid(); err != nil {
+		return err
+	}
+
+	if config.CPUModel == "" {
+		return fmt.Errorf("HyperV requires a CPUModel")
+	}
+
+	set := make(map[string]bool)
+	for _, param := range config.HyperV.cpuParams() {
+		set[cpuFlagName(param)] = true
+	}
+	for _, flag := range config.CPUModelFlags {
+		if set[hvFlagName(cpuFlagName(flag))] {
+			return fmt.Errorf("CPUModelFlags %s is also set by HyperV", flag)
+		}
+	}
+	for _, feature := range config.CPUFeatures {
+		if set[hvFlagName(feature.Name)] {
+			return fmt.Errorf("CPUFeature Name=%s is also set by HyperV", feature.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package qcli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAppendHyperV(t *testing.T) {
+	c := &Config{
+		CPUModel: "host",
+		HyperV: HyperV{
+			Relaxed:         true,
+			VAPIC:           true,
+			SpinlockRetries: 0x1fff,
+			VPIndex:         true,
+			Time:            true,
+			SynIC:           true,
+			STimer:          true,
+			Frequencies:     true,
+			Reenlightenment: true,
+			TLBFlush:        true,
+		},
+	}
+	if err := c.validateHyperV(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	c.appendCPUModel()
+	expected := []string{"-cpu", "host,hv_relaxed,hv_vapic,hv_vpindex,hv_time,hv_synic,hv_stimer,hv_frequencies,hv_reenlightenment,hv_tlbflush,hv_spinlocks=0x1fff"}
+	if !reflect.DeepEqual(expected, c.qemuParams) {
+		t.Errorf("Expected %v, found %v", expected, c.qemuParams)
+	}
+}
+
+func TestBadHyperV(t *testing.T) {
+	configs := []*Config{
+		{HyperV: HyperV{Relaxed: true}},
+		{CPUModel: "host", HyperV: HyperV{SpinlockRetries: 10}},
+		{CPUModel: "host", HyperV: HyperV{SynIC: true}},
+		{CPUModel: "host", HyperV: HyperV{VPIndex: true, SynIC: true, STimer: true}},
+		{CPUModel: "host", HyperV: HyperV{Time: true, STimer: true}},
+		{CPUModel: "host", HyperV: HyperV{Reenlightenment: true}},
+		{CPUModel: "host", HyperV: HyperV{TLBFlush: true}},
+		{CPUModel: "host", HyperV: HyperV{EVMCS: true}},
+		{CPUModel: "host", CPUModelFlags: []string{"hv-relaxed"}, HyperV: HyperV{Relaxed: true}},
+		{CPUModel: "host", CPUFeatures: []CPUFeature{{Name: "hv_vapic"}}, HyperV: HyperV{VAPIC: true}},
+	}
+	for _, c := range configs {
+		if err := c.validateHyperV(); err == nil {
+			t.Errorf("Expected error for invalid HyperV %+v", c.HyperV)
+		}
+	}
+
+	if err := (&Config{}).validateHyperV(); err != nil {
+		t.Errorf("Unexpected error without HyperV: %s", err)
+	}
+}
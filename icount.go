@@ -0,0 +1,157 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ICountRRMode is the qemu record/replay mode.
+type ICountRRMode string
+
+const (
+	// ICountRecord records the non-deterministic events to RRFile.
+	ICountRecord ICountRRMode = "record"
+
+	// ICountReplay replays the events recorded in RRFile.
+	ICountReplay ICountRRMode = "replay"
+)
+
+// ICountShiftAuto lets qemu adjust the instruction counter shift.
+const ICountShiftAuto = "auto"
+
+// ICount describes the -icount instruction counting configuration, it
+// makes the guest execution deterministic and enables record/replay.
+type ICount struct {
+	// Shift is the virtual cpu speed, 2^Shift ns per instruction, 0-10
+	// or auto.
+	Shift string `yaml:"shift"`
+
+	// Align delays the virtual cpu to keep it in sync with the host
+	// clock, on|off
+	Align string `yaml:"align"`
+
+	// Sleep lets the virtual cpu sleep when idle, on|off
+	Sleep string `yaml:"sleep"`
+
+	// RR is the record/replay mode
+	RR ICountRRMode `yaml:"rr"`
+
+	// RRFile is the record/replay log file
+	RRFile string `yaml:"rr-file"`
+
+	// RRSnapshot is the name of the snapshot created when recording
+	// starts and loaded when replaying.
+	RRSnapshot string `yaml:"rr-snapshot"`
+}
+
+// Valid returns an error if the ICount structure is not valid and complete.
+func (icount ICount) Valid() error {
+	if icount.Shift == "" && icount.RR == "" {
+		return fmt.Errorf("ICount requires Shift or RR")
+	}
+
+	if icount.Shift != "" && icount.Shift != ICountShiftAuto {
+		shift, err := strconv.Atoi(icount.Shift)
+		if err != nil || shift < 0 || shift > 10 {
+			return fmt.Errorf("Invalid ICount Shift value: '%s', must be 0-10 or '%s'", icount.Shift, ICountShiftAuto)
+		}
+	}
+
+	if _, err := getConfigOnOff("Align", "align", icount.Align); err != nil {
+		return err
+	}
+
+	if _, err := getConfigOnOff("Sleep", "sleep", icount.Sleep); err != nil {
+		return err
+	}
+
+	if icount.Align == "on" {
+		if icount.Shift == ICountShiftAuto {
+			return fmt.Errorf("ICount Shift=auto and Align=on are incompatible")
+		}
+		if icount.Sleep == "off" {
+			return fmt.Errorf("ICount Align=on and Sleep=off are incompatible")
+		}
+	}
+
+	switch icount.RR {
+	case "":
+		if icount.RRFile != "" || icount.RRSnapshot != "" {
+			return fmt.Errorf("ICount RRFile and RRSnapshot require RR")
+		}
+	case ICountRecord, ICountReplay:
+		if icount.RRFile == "" {
+			return fmt.Errorf("ICount RR=%s requires RRFile", icount.RR)
+		}
+	default:
+		return fmt.Errorf("Invalid ICount RR value: '%s', must be one of '%s' or '%s'", icount.RR, ICountRecord, ICountReplay)
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the ICount.
+func (icount ICount) QemuParams() []string {
+	var icountParams []string
+
+	if icount.Shift != "" {
+		icountParams = append(icountParams, fmt.Sprintf("shift=%s", icount.Shift))
+	}
+
+	if p, _ := getConfigOnOff("Align", "align", icount.Align); p != "" {
+		icountParams = append(icountParams, p)
+	}
+
+	if p, _ := getConfigOnOff("Sleep", "sleep", icount.Sleep); p != "" {
+		icountParams = append(icountParams, p)
+	}
+
+	if icount.RR != "" {
+		icountParams = append(icountParams, fmt.Sprintf("rr=%s", icount.RR))
+		icountParams = append(icountParams, fmt.Sprintf("rrfile=%s", icount.RRFile))
+		if icount.RRSnapshot != "" {
+			icountParams = append(icountParams, fmt.Sprintf("rrsnapshot=%s", icount.RRSnapshot))
+		}
+	}
+
+	return []string{"-icount", strings.Join(icountParams, ",")}
+}
+
+func (config *Config) appendICount() error {
+	if config.ICount == (ICount{}) {
+		return nil
+	}
+
+	if err := config.ICount.Valid(); err != nil {
+		return err
+	}
+
+	config.qemuParams = append(config.qemuParams, config.ICount.QemuParams()...)
+
+	return nil
+}
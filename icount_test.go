@@ -0,0 +1,52 @@
+package qcli
+
+import "testing"
+
+var (
+	icountShiftString  = "-icount shift=7,align=on,sleep=on"
+	icountRecordString = "-icount shift=auto,rr=record,rrfile=/tmp/replay.bin,rrsnapshot=init"
+)
+
+func TestAppendICount(t *testing.T) {
+	icount := ICount{
+		Shift: "7",
+		Align: "on",
+		Sleep: "on",
+	}
+	testAppend(icount, icountShiftString, t)
+
+	icount = ICount{
+		Shift:      ICountShiftAuto,
+		RR:         ICountRecord,
+		RRFile:     "/tmp/replay.bin",
+		RRSnapshot: "init",
+	}
+	testAppend(icount, icountRecordString, t)
+}
+
+func TestBadICount(t *testing.T) {
+	c := &Config{}
+	if err := c.appendICount(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(c.qemuParams) != 0 {
+		t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
+	}
+
+	icounts := []ICount{
+		{Sleep: "on"},
+		{Shift: "11"},
+		{Shift: "fast"},
+		{Shift: "1", Align: "yes"},
+		{Shift: ICountShiftAuto, Align: "on"},
+		{Shift: "1", Align: "on", Sleep: "off"},
+		{Shift: "1", RRFile: "/tmp/replay.bin"},
+		{RR: ICountReplay},
+		{RR: "rewind", RRFile: "/tmp/replay.bin"},
+	}
+	for _, icount := range icounts {
+		if err := icount.Valid(); err == nil {
+			t.Errorf("Expected error for invalid ICount %+v", icount)
+		}
+	}
+}
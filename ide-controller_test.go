@@ -52,7 +52,7 @@ func TestAppendDeviceIDEControllerAndIDECDROM(t *testing.T) {
 				Format:    RAW,
 				ReadOnly:  true,
 				Media:     "cdrom",
-				BootIndex: "0",
+				BootIndex: NewBootIndex(0),
 				Bus:       "ide.0",
 			},
 		},
@@ -0,0 +1,184 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IVShmemModel is the ivshmem device flavor.
+type IVShmemModel string
+
+const (
+	// IVShmemPlain maps a shared memory backend file into the guest.
+	IVShmemPlain IVShmemModel = "ivshmem-plain"
+
+	// IVShmemDoorbell gets the shared memory and the interrupt
+	// eventfds of its peers from an ivshmem-server.
+	IVShmemDoorbell IVShmemModel = "ivshmem-doorbell"
+)
+
+// IVShmemDevice represents an inter-VM shared memory device, a PCI BAR
+// backed by host memory shared with the other VMs mapping the same file
+// or connected to the same ivshmem-server.
+type IVShmemDevice struct {
+	// ID is the device ID
+	ID string `yaml:"id"`
+
+	// Model is the ivshmem flavor.
+	Model IVShmemModel `yaml:"model"`
+
+	// MemDev is the ID of the memory-backend-file object created for an
+	// ivshmem-plain device
+	MemDev string `yaml:"memdev"`
+
+	// Size is the shared memory size of an ivshmem-plain device, e.g., 64M
+	Size string `yaml:"size"`
+
+	// MemPath is the file shared by the VMs, e.g., under /dev/shm or a
+	// hugetlbfs mount
+	MemPath string `yaml:"mem-path"`
+
+	// ServerSocket is the ivshmem-server unix socket of an
+	// ivshmem-doorbell device
+	ServerSocket string `yaml:"server-socket"`
+
+	// Vectors is the number of MSI-X interrupt vectors of an
+	// ivshmem-doorbell device
+	Vectors int `yaml:"vectors"`
+
+	// IOEventFD makes doorbell writes signal the peers through an
+	// eventfd instead of a qemu exit
+	IOEventFD bool `yaml:"ioeventfd"`
+
+	// Master marks the VM owning the shared memory content, only a master
+	// may be migrated
+	Master bool `yaml:"master"`
+
+	// Bus is the bus path name of the device
+	Bus string `yaml:"bus"`
+
+	// Addr is the PCI address of the device
+	Addr string `yaml:"address"`
+}
+
+// Valid returns an error if the IVShmemDevice structure is not valid and
+// complete.
+func (dev IVShmemDevice) Valid() error {
+	if dev.ID == "" {
+		return fmt.Errorf("IVShmemDevice has empty ID field")
+	}
+
+	switch dev.Model {
+	case IVShmemPlain:
+		if dev.MemDev == "" {
+			return fmt.Errorf("IVShmemDevice ID=%s has empty MemDev field", dev.ID)
+		}
+		if dev.MemPath == "" {
+			return fmt.Errorf("IVShmemDevice ID=%s has empty MemPath field", dev.ID)
+		}
+		if _, err := ParseMemorySize(dev.Size); err != nil {
+			return fmt.Errorf("IVShmemDevice ID=%s invalid Size: %v", dev.ID, err)
+		}
+		if dev.ServerSocket != "" || dev.Vectors != 0 || dev.IOEventFD {
+			return fmt.Errorf("IVShmemDevice ID=%s model %s does not support ServerSocket, Vectors or IOEventFD", dev.ID, dev.Model)
+		}
+	case IVShmemDoorbell:
+		if dev.ServerSocket == "" {
+			return fmt.Errorf("IVShmemDevice ID=%s has empty ServerSocket field", dev.ID)
+		}
+		if dev.Vectors < 0 {
+			return fmt.Errorf("IVShmemDevice ID=%s has invalid Vectors %d", dev.ID, dev.Vectors)
+		}
+		if dev.MemDev != "" || dev.Size != "" || dev.MemPath != "" {
+			return fmt.Errorf("IVShmemDevice ID=%s model %s does not support MemDev, Size or MemPath", dev.ID, dev.Model)
+		}
+	case "":
+		return fmt.Errorf("IVShmemDevice ID=%s has empty Model field", dev.ID)
+	default:
+		return fmt.Errorf("IVShmemDevice ID=%s has invalid Model field: %s", dev.ID, dev.Model)
+	}
+
+	return nil
+}
+
+// chardevID returns the id of the chardev connecting a doorbell device to
+// its ServerSocket.
+func (dev IVShmemDevice) chardevID() string {
+	return "chr" + dev.ID
+}
+
+// QemuParams returns the qemu parameters built out of the IVShmemDevice.
+func (dev IVShmemDevice) QemuParams(config *Config) []string {
+	var qemuParams []string
+	var deviceParams []string
+
+	deviceParams = append(deviceParams, string(dev.Model))
+	deviceParams = append(deviceParams, fmt.Sprintf("id=%s", dev.ID))
+
+	if dev.Model == IVShmemDoorbell {
+		chardevID := dev.chardevID()
+		qemuParams = append(qemuParams, "-chardev")
+		qemuParams = append(qemuParams, fmt.Sprintf("socket,id=%s,path=%s", chardevID, dev.ServerSocket))
+
+		deviceParams = append(deviceParams, fmt.Sprintf("chardev=%s", chardevID))
+		if dev.Vectors > 0 {
+			deviceParams = append(deviceParams, fmt.Sprintf("vectors=%d", dev.Vectors))
+		}
+		if dev.IOEventFD {
+			deviceParams = append(deviceParams, "ioeventfd=on")
+		}
+	} else {
+		objectParams := []string{
+			string(MemoryBackendFile),
+			fmt.Sprintf("id=%s", dev.MemDev),
+			fmt.Sprintf("size=%s", dev.Size),
+			fmt.Sprintf("mem-path=%s", dev.MemPath),
+			"share=on",
+		}
+		qemuParams = append(qemuParams, "-object")
+		qemuParams = append(qemuParams, strings.Join(objectParams, ","))
+
+		deviceParams = append(deviceParams, fmt.Sprintf("memdev=%s", dev.MemDev))
+	}
+
+	if dev.Master {
+		deviceParams = append(deviceParams, "master=on")
+	}
+	if dev.Bus != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", dev.Bus))
+	}
+	addr := config.pciBusSlots.GetSlot(dev.Addr)
+	if addr > 0 {
+		deviceParams = append(deviceParams, fmt.Sprintf("addr=0x%02x", addr))
+	}
+
+	qemuParams = append(qemuParams, "-device")
+	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+
+	return qemuParams
+}
@@ -0,0 +1,51 @@
+package qcli
+
+import "testing"
+
+func TestAppendIVShmemDevice(t *testing.T) {
+	testCases := []struct {
+		dev Device
+		out string
+	}{
+		{
+			IVShmemDevice{ID: "shm0", Model: IVShmemPlain, MemDev: "shmmem0", Size: "64M", MemPath: "/dev/shm/dpdk0", Master: true, Addr: "8"},
+			"-object memory-backend-file,id=shmmem0,size=64M,mem-path=/dev/shm/dpdk0,share=on -device ivshmem-plain,id=shm0,memdev=shmmem0,master=on,addr=0x08",
+		},
+		{
+			IVShmemDevice{ID: "shm1", Model: IVShmemDoorbell, ServerSocket: "/run/ivshmem.sock", Vectors: 4, IOEventFD: true, Bus: "pcie.0", Addr: "9"},
+			"-chardev socket,id=chrshm1,path=/run/ivshmem.sock -device ivshmem-doorbell,id=shm1,chardev=chrshm1,vectors=4,ioeventfd=on,bus=pcie.0,addr=0x09",
+		},
+	}
+
+	for _, tc := range testCases {
+		testAppend(tc.dev, tc.out, t)
+	}
+}
+
+func TestIVShmemDeviceValid(t *testing.T) {
+	for _, dev := range []IVShmemDevice{
+		{Model: IVShmemPlain, MemDev: "shmmem0", Size: "64M", MemPath: "/dev/shm/dpdk0"},
+		{ID: "shm0", MemDev: "shmmem0", Size: "64M", MemPath: "/dev/shm/dpdk0"},
+		{ID: "shm0", Model: "ivshmem", ServerSocket: "/run/ivshmem.sock"},
+		{ID: "shm0", Model: IVShmemPlain, Size: "64M", MemPath: "/dev/shm/dpdk0"},
+		{ID: "shm0", Model: IVShmemPlain, MemDev: "shmmem0", Size: "64M"},
+		{ID: "shm0", Model: IVShmemPlain, MemDev: "shmmem0", Size: "64Q", MemPath: "/dev/shm/dpdk0"},
+		{ID: "shm0", Model: IVShmemPlain, MemDev: "shmmem0", Size: "64M", MemPath: "/dev/shm/dpdk0", Vectors: 2},
+		{ID: "shm1", Model: IVShmemDoorbell},
+		{ID: "shm1", Model: IVShmemDoorbell, ServerSocket: "/run/ivshmem.sock", Vectors: -1},
+		{ID: "shm1", Model: IVShmemDoorbell, ServerSocket: "/run/ivshmem.sock", Size: "64M"},
+	} {
+		if err := dev.Valid(); err == nil {
+			t.Errorf("Expected error for %+v", dev)
+		}
+	}
+}
+
+func TestAppendIVShmemDevices(t *testing.T) {
+	config := Config{
+		IVShmemDevices: []IVShmemDevice{
+			{ID: "shm1", Model: IVShmemDoorbell, ServerSocket: "/run/ivshmem.sock"},
+		},
+	}
+	testConfig(&config, "-chardev socket,id=chrshm1,path=/run/ivshmem.sock -device ivshmem-doorbell,id=shm1,chardev=chrshm1,addr=0x1e", t)
+}
@@ -0,0 +1,123 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// LaunchResult describes how a qemu instance launched by
+// LaunchCustomQemuResult exited.
+type LaunchResult struct {
+	// Path is the qemu executable
+	Path string
+
+	// Params are the qemu parameters
+	Params []string
+
+	// ExitCode is the qemu exit status, -1 if qemu did not start or was
+	// killed by a signal
+	ExitCode int
+
+	// Signal is the signal killing qemu, 0 if qemu exited
+	Signal syscall.Signal
+
+	// Stderr is the tail of the qemu error output, up to
+	// LaunchStderrTailSize bytes, when qemu exited with an error
+	Stderr string
+}
+
+// LaunchStderrTailSize is the amount of qemu error output kept in
+// LaunchResult.Stderr.
+var LaunchStderrTailSize = 64 * 1024
+
+func newLaunchResult(path string, params []string, state *os.ProcessState) *LaunchResult {
+	result := &LaunchResult{
+		Path:     path,
+		Params:   params,
+		ExitCode: -1,
+	}
+	if state == nil {
+		return result
+	}
+
+	result.ExitCode = state.ExitCode()
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.Signal = status.Signal()
+	}
+
+	return result
+}
+
+// CommandLine returns the qemu command line, quoting the parameters
+// containing spaces.
+func (r *LaunchResult) CommandLine() string {
+	args := []string{r.Path}
+	for _, param := range r.Params {
+		if strings.ContainsAny(param, " \t\n'\"") {
+			param = fmt.Sprintf("%q", param)
+		}
+		args = append(args, param)
+	}
+	return strings.Join(args, " ")
+}
+
+// LaunchError is the error returned when qemu fails to start or exits with
+// an error. Err is the underlying os/exec error.
+type LaunchError struct {
+	Result *LaunchResult
+	Err    error
+}
+
+func (e *LaunchError) Error() string {
+	var status string
+	switch {
+	case e.Result.Signal != 0:
+		status = fmt.Sprintf("killed by signal %s", e.Result.Signal)
+	case e.Result.ExitCode >= 0:
+		status = fmt.Sprintf("exited with status %d", e.Result.ExitCode)
+	default:
+		status = fmt.Sprintf("failed to start: %v", e.Err)
+	}
+
+	msg := fmt.Sprintf("qemu %s %s", e.Result.Path, status)
+	if line := lastLine(e.Result.Stderr); line != "" {
+		msg += ": " + line
+	}
+	return msg
+}
+
+func (e *LaunchError) Unwrap() error {
+	return e.Err
+}
+
+// lastLine returns the last non empty line of output.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,102 @@
+package qcli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestLaunchCustomQemuResult(t *testing.T) {
+	params := []string{"-c", "echo starting >&2; echo 'bad option' >&2; exit 3"}
+	result, err := LaunchCustomQemuResult(context.Background(), "/bin/sh", params, nil, nil, nil)
+
+	var launchErr *LaunchError
+	if !errors.As(err, &launchErr) {
+		t.Fatalf("Expected a LaunchError, found %v", err)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("Expected LaunchError to wrap the exec.ExitError")
+	}
+	if launchErr.Result != result || result.ExitCode != 3 || result.Signal != 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if result.Stderr != "starting\nbad option\n" {
+		t.Errorf("Unexpected stderr %q", result.Stderr)
+	}
+	if msg := err.Error(); msg != "qemu /bin/sh exited with status 3: bad option" {
+		t.Errorf("Unexpected error message %q", msg)
+	}
+	if cmdline := result.CommandLine(); cmdline != `/bin/sh -c "echo starting >&2; echo 'bad option' >&2; exit 3"` {
+		t.Errorf("Unexpected command line %s", cmdline)
+	}
+
+	result, err = LaunchCustomQemuResult(context.Background(), "/bin/sh", []string{"-c", "kill -KILL $$"}, nil, nil, nil)
+	if err == nil || result.Signal != syscall.SIGKILL || result.ExitCode != -1 {
+		t.Errorf("Expected qemu killed by SIGKILL, found %+v, %v", result, err)
+	}
+
+	result, err = LaunchCustomQemuResult(context.Background(), "/nonexistent/qemu", nil, nil, nil, nil)
+	if err == nil || result.ExitCode != -1 || !strings.Contains(err.Error(), "failed to start") {
+		t.Errorf("Expected qemu failing to start, found %+v, %v", result, err)
+	}
+
+	result, err = LaunchCustomQemuResult(context.Background(), "/bin/sh", []string{"-c", "exit 0"}, nil, nil, nil)
+	if err != nil || result.ExitCode != 0 {
+		t.Errorf("Unexpected result %+v, %v", result, err)
+	}
+}
+
+func TestLaunchStderrTail(t *testing.T) {
+	saved := LaunchStderrTailSize
+	defer func() { LaunchStderrTailSize = saved }()
+	LaunchStderrTailSize = 8
+
+	errStr, err := LaunchCustomQemu(context.Background(), "/bin/sh", []string{"-c", "echo 0123456789 >&2; exit 1"}, nil, nil, nil)
+	if err == nil {
+		t.Fatalf("Expected error for failing command")
+	}
+	if errStr != "3456789\n" {
+		t.Errorf("Expected stderr tail %q, found %q", "3456789\n", errStr)
+	}
+}
+
+func TestLaunchQemuDaemonizeCleanup(t *testing.T) {
+	dir := t.TempDir()
+	qemu := filepath.Join(dir, "qemu")
+	if err := os.WriteFile(qemu, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	seed := filepath.Join(dir, "seed")
+	if err := os.WriteFile(seed, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the daemonized qemu still uses the temporary files
+	c := &Config{Path: qemu, Name: "vm1", Knobs: Knobs{Daemonize: true}, tempFiles: []string{seed}}
+	if _, err := LaunchQemuResult(c, nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !PathExists(seed) {
+		t.Errorf("Expected %s to be kept for the daemonized qemu", seed)
+	}
+	if err := c.Cleanup(); err != nil || PathExists(seed) {
+		t.Errorf("Expected Cleanup to remove %s: %v", seed, err)
+	}
+
+	c = &Config{Path: qemu, Name: "vm1", tempFiles: []string{seed}}
+	if err := os.WriteFile(seed, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LaunchQemuResult(c, nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if PathExists(seed) {
+		t.Errorf("Expected %s to be removed once qemu exited", seed)
+	}
+}
@@ -0,0 +1,626 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package libvirt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/project-machine/qcli"
+)
+
+// converter accumulates the Config converted from a Domain and the notes
+// on what was not converted.
+type converter struct {
+	config      *qcli.Config
+	unsupported []string
+}
+
+// flag records a domain element or setting without a qcli equivalent.
+func (c *converter) flag(format string, args ...interface{}) {
+	c.unsupported = append(c.unsupported, fmt.Sprintf(format, args...))
+}
+
+// flagOther records the unknown child elements of path.
+func (c *converter) flagOther(path string, other []anyElement) {
+	for _, e := range other {
+		c.flag("%s/%s is not supported", path, e.XMLName.Local)
+	}
+}
+
+// Convert parses the libvirt domain XML data and returns the equivalent
+// Config along with a description of each element or setting that was not
+// converted, or only approximated.
+func Convert(data []byte) (*qcli.Config, []string, error) {
+	var dom Domain
+	if err := xml.Unmarshal(data, &dom); err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse the domain XML: %v", err)
+	}
+
+	return ConvertDomain(&dom)
+}
+
+// ConvertDomain returns the Config equivalent to the libvirt Domain along
+// with a description of each element or setting that was not converted, or
+// only approximated.
+func ConvertDomain(dom *Domain) (*qcli.Config, []string, error) {
+	if dom.OS.Type.Type != "" && dom.OS.Type.Type != "hvm" {
+		return nil, nil, fmt.Errorf("Domain os type %s is not supported, only hvm is", dom.OS.Type.Type)
+	}
+
+	c := &converter{
+		config: &qcli.Config{
+			Name: dom.Name,
+			UUID: dom.UUID,
+			Path: dom.Devices.Emulator,
+		},
+	}
+
+	steps := []func(*Domain) error{
+		c.convertMachine,
+		c.convertMemory,
+		c.convertCPU,
+		c.convertOS,
+		c.convertFeatures,
+		c.convertDisks,
+		c.convertInterfaces,
+		c.convertSerials,
+		c.convertDevices,
+	}
+	for _, step := range steps {
+		if err := step(dom); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return c.config, c.unsupported, nil
+}
+
+func (c *converter) convertMachine(dom *Domain) error {
+	c.config.Machine.Type = dom.OS.Type.Machine
+
+	switch dom.Type {
+	case "kvm":
+		c.config.Machine.Acceleration = qcli.MachineAccelerationKVM
+	case "qemu":
+		c.config.Machine.Acceleration = "tcg"
+	default:
+		return fmt.Errorf("Domain type %s is not supported, only kvm and qemu are", dom.Type)
+	}
+
+	switch dom.OnReboot {
+	case "", "restart":
+	case "destroy":
+		c.config.Knobs.NoReboot = true
+	default:
+		c.flag("on_reboot %s is not supported", dom.OnReboot)
+	}
+	if dom.OnPoweroff != "" && dom.OnPoweroff != "destroy" {
+		c.flag("on_poweroff %s is not supported", dom.OnPoweroff)
+	}
+	if dom.OnCrash != "" && dom.OnCrash != "destroy" {
+		c.flag("on_crash %s is not supported, see qcli.PVPanicDevice", dom.OnCrash)
+	}
+
+	c.flagOther("domain", dom.Other)
+
+	return nil
+}
+
+// scaledBytes returns the size in bytes of a libvirt scaled integer.
+func scaledBytes(s ScaledInteger) (uint64, error) {
+	units := map[string]uint64{
+		"b": 1, "bytes": 1,
+		"KB": 1000, "k": 1 << 10, "KiB": 1 << 10, "": 1 << 10,
+		"MB": 1000 * 1000, "M": 1 << 20, "MiB": 1 << 20,
+		"GB": 1000 * 1000 * 1000, "G": 1 << 30, "GiB": 1 << 30,
+		"TB": 1000 * 1000 * 1000 * 1000, "T": 1 << 40, "TiB": 1 << 40,
+	}
+	unit, ok := units[s.Unit]
+	if !ok {
+		return 0, fmt.Errorf("Unknown memory unit %s", s.Unit)
+	}
+	return s.Value * unit, nil
+}
+
+// memorySize returns the qemu size string of a size in bytes, rounded down
+// to MiB.
+func memorySize(size uint64) string {
+	if size%(1<<30) == 0 {
+		return fmt.Sprintf("%dG", size>>30)
+	}
+	return fmt.Sprintf("%dM", size>>20)
+}
+
+func (c *converter) convertMemory(dom *Domain) error {
+	size, err := scaledBytes(dom.Memory)
+	if err != nil {
+		return err
+	}
+	if size%(1<<20) != 0 {
+		c.flag("memory of %d bytes is rounded down to MiB", size)
+	}
+	c.config.Memory.Size = memorySize(size)
+
+	if dom.CurrentMemory.Value != 0 {
+		current, err := scaledBytes(dom.CurrentMemory)
+		if err != nil {
+			return err
+		}
+		if current != size {
+			c.flag("currentMemory is not supported, see qcli.BalloonDevice")
+		}
+	}
+
+	if dom.MaxMemory != nil {
+		maxMem, err := scaledBytes(dom.MaxMemory.ScaledInteger)
+		if err != nil {
+			return err
+		}
+		c.config.Memory.MaxMem = memorySize(maxMem)
+		c.config.Memory.Slots = dom.MaxMemory.Slots
+	}
+
+	return nil
+}
+
+func (c *converter) convertCPU(dom *Domain) error {
+	c.config.SMP.CPUs = dom.VCPU.Count
+	if dom.VCPU.Current != 0 && dom.VCPU.Current != dom.VCPU.Count {
+		c.config.SMP.CPUs = dom.VCPU.Current
+		c.config.SMP.MaxCPUs = dom.VCPU.Count
+	}
+
+	cpu := dom.CPU
+	if cpu == nil {
+		return nil
+	}
+
+	switch cpu.Mode {
+	case "host-passthrough", "maximum":
+		c.config.CPUModel = "host"
+		if cpu.Mode == "maximum" {
+			c.config.CPUModel = "max"
+		}
+	case "host-model":
+		c.config.CPUModel = "host"
+		c.flag("cpu mode host-model is converted to host, the guest cpu may differ across hosts")
+	case "", "custom":
+		c.config.CPUModel = cpu.Model
+	default:
+		c.flag("cpu mode %s is not supported", cpu.Mode)
+	}
+
+	for _, feature := range cpu.Features {
+		switch feature.Policy {
+		case "", "require", "force":
+			c.config.SetCPUFeature(feature.Name, true)
+		case "disable", "forbid":
+			c.config.SetCPUFeature(feature.Name, false)
+		default:
+			c.flag("cpu feature %s policy %s is not supported", feature.Name, feature.Policy)
+		}
+	}
+
+	if t := cpu.Topology; t != nil {
+		c.config.SMP.Sockets = t.Sockets
+		c.config.SMP.Cores = t.Cores
+		c.config.SMP.Threads = t.Threads
+		if t.Dies > 1 {
+			c.flag("cpu topology dies=%d is not supported", t.Dies)
+		}
+	}
+
+	c.flagOther("cpu", cpu.Other)
+
+	return nil
+}
+
+func (c *converter) convertOS(dom *Domain) error {
+	os := dom.OS
+
+	if os.Loader != nil {
+		switch os.Loader.Type {
+		case "", "rom":
+			c.config.Bios = os.Loader.Path
+		case "pflash":
+			c.config.UEFIFirmwareDevices = append(c.config.UEFIFirmwareDevices, qcli.UEFIFirmwareDevice{
+				Code: os.Loader.Path,
+				Vars: os.NVRAM,
+			})
+		default:
+			c.flag("os/loader type %s is not supported", os.Loader.Type)
+		}
+		if os.Loader.Secure == "yes" {
+			c.config.Machine.SMM = "on"
+		}
+	} else if os.NVRAM != "" {
+		c.flag("os/nvram without os/loader is not supported")
+	}
+
+	c.config.Kernel = qcli.Kernel{
+		Path:       os.Kernel,
+		InitrdPath: os.Initrd,
+		Params:     os.Cmdline,
+		DTBPath:    os.DTB,
+	}
+
+	for _, boot := range os.Boot {
+		c.flag("os/boot dev=%s is not supported, use the device boot order", boot.Dev)
+	}
+
+	c.flagOther("os", os.Other)
+
+	return nil
+}
+
+func (c *converter) convertFeatures(dom *Domain) error {
+	features := dom.Features
+	if features == nil {
+		features = &Features{}
+	}
+
+	// libvirt x86 domains have no ACPI unless it is listed
+	switch dom.OS.Type.Arch {
+	case "x86_64", "i686":
+		if features.ACPI == nil {
+			c.config.Knobs.NoACPI = true
+		}
+	}
+
+	if features.VMPort != nil {
+		c.config.Machine.VMPort = features.VMPort.State
+	}
+	if features.SMM != nil {
+		c.config.Machine.SMM = features.SMM.State
+	}
+
+	if hv := features.HyperV; hv != nil {
+		on := func(s *State) bool { return s != nil && s.State == "on" }
+		c.config.HyperV = qcli.HyperV{
+			Relaxed:         on(hv.Relaxed),
+			VAPIC:           on(hv.VAPIC),
+			VPIndex:         on(hv.VPIndex),
+			Runtime:         on(hv.Runtime),
+			SynIC:           on(hv.SynIC),
+			STimer:          on(hv.STimer),
+			Reset:           on(hv.Reset),
+			Frequencies:     on(hv.Frequencies),
+			Reenlightenment: on(hv.Reenlightenment),
+			TLBFlush:        on(hv.TLBFlush),
+			EVMCS:           on(hv.EVMCS),
+		}
+		if hv.Spinlocks != nil && hv.Spinlocks.State == "on" {
+			c.config.HyperV.SpinlockRetries = hv.Spinlocks.Retries
+		}
+		if hv.VendorID != nil && hv.VendorID.State == "on" {
+			c.config.SetCPUProperty("hv_vendor_id", hv.VendorID.Value)
+		}
+		// qemu also requires hv_time for the synthetic timers, libvirt
+		// enables it through the hypervclock timer
+		if c.config.HyperV.STimer {
+			c.config.HyperV.Time = true
+		}
+		c.flagOther("features/hyperv", hv.Other)
+	}
+
+	if kvm := features.KVM; kvm != nil {
+		if kvm.Hidden != nil && kvm.Hidden.State == "on" {
+			c.config.SetCPUProperty("kvm", "off")
+		}
+		c.flagOther("features/kvm", kvm.Other)
+	}
+
+	if c.config.CPUModel == "" && (c.config.HyperV.Enabled() || len(c.config.CPUFeatures) > 0) {
+		c.config.CPUModel = "max"
+		c.flag("cpu model is not set, using max for the hyperv and kvm features")
+	}
+
+	c.flagOther("features", features.Other)
+
+	return nil
+}
+
+func bootIndex(boot *BootOrder) *qcli.BootIndex {
+	if boot == nil {
+		return nil
+	}
+	return qcli.NewBootIndex(boot.Order)
+}
+
+func (c *converter) convertDisks(dom *Domain) error {
+	for _, disk := range dom.Devices.Disks {
+		id := disk.Target.Dev
+		path := fmt.Sprintf("devices/disk target=%s", id)
+
+		var file string
+		switch disk.Type {
+		case "file":
+			file = disk.Source.File
+		case "block":
+			file = disk.Source.Dev
+		default:
+			c.flag("%s type %s is not supported", path, disk.Type)
+			continue
+		}
+		if file == "" {
+			c.flag("%s has no source, empty drives are not supported", path)
+			continue
+		}
+
+		format := qcli.BlockDeviceFormat(disk.Driver.Type)
+		switch format {
+		case qcli.QCOW2, qcli.RAW:
+		case "":
+			format = qcli.RAW
+		default:
+			c.flag("%s format %s is not a known qcli format", path, format)
+		}
+
+		if disk.Device == "floppy" {
+			// the floppy targets are fda and fdb
+			if len(id) != 3 || !strings.HasPrefix(id, "fd") {
+				c.flag("%s floppy target must be fda or fdb", path)
+				continue
+			}
+			unit := int(id[len(id)-1]) - 'a'
+			if unit < 0 || unit > 1 {
+				c.flag("%s floppy target must be fda or fdb", path)
+				continue
+			}
+			c.config.FloppyDevices = append(c.config.FloppyDevices, qcli.FloppyDevice{
+				ID:        id,
+				File:      file,
+				Format:    format,
+				Unit:      unit,
+				ReadOnly:  disk.ReadOnly != nil,
+				BootIndex: bootIndex(disk.Boot),
+			})
+			continue
+		}
+
+		blkdev := qcli.BlockDevice{
+			ID:        id,
+			File:      file,
+			Format:    format,
+			Interface: qcli.NoInterface,
+			ReadOnly:  disk.ReadOnly != nil,
+			ShareRW:   disk.Sharable != nil,
+			Serial:    disk.Serial,
+			BootIndex: bootIndex(disk.Boot),
+		}
+
+		cdrom := disk.Device == "cdrom"
+		switch disk.Target.Bus {
+		case "virtio":
+			blkdev.Driver = qcli.VirtioBlock
+		case "sata", "ide":
+			blkdev.Driver = qcli.IDEHardDisk
+			if cdrom {
+				blkdev.Driver = qcli.IDECDROM
+			}
+		case "scsi":
+			blkdev.Driver = qcli.SCSIHD
+			if cdrom {
+				blkdev.Driver = qcli.SCSICD
+			}
+			controller := "0"
+			if disk.Address != nil && disk.Address.Controller != "" {
+				controller = disk.Address.Controller
+			}
+			blkdev.Bus = fmt.Sprintf("scsi%s.0", controller)
+		case "usb":
+			blkdev.Driver = qcli.USBStorage
+		default:
+			c.flag("%s bus %s is not supported", path, disk.Target.Bus)
+			continue
+		}
+		if cdrom {
+			blkdev.Media = "cdrom"
+		}
+
+		switch disk.Driver.Cache {
+		case "", "default":
+		default:
+			blkdev.Cache = qcli.CacheMode(disk.Driver.Cache)
+		}
+		switch disk.Driver.IO {
+		case "":
+		case "native":
+			blkdev.AIO = qcli.Native
+		case "threads":
+			blkdev.AIO = qcli.Threads
+		default:
+			c.flag("%s io %s is not supported", path, disk.Driver.IO)
+		}
+		switch disk.Driver.Discard {
+		case "":
+		case "unmap":
+			blkdev.Discard = qcli.DiscardUnmap
+		case "ignore":
+			blkdev.Discard = qcli.DiscardIgnore
+		default:
+			c.flag("%s discard %s is not supported", path, disk.Driver.Discard)
+		}
+
+		c.config.BlkDevices = append(c.config.BlkDevices, blkdev)
+		c.flagOther(path, disk.Other)
+	}
+
+	return nil
+}
+
+func (c *converter) convertInterfaces(dom *Domain) error {
+	for i, iface := range dom.Devices.Interfaces {
+		id := fmt.Sprintf("net%d", i)
+		path := fmt.Sprintf("devices/interface %s", id)
+
+		netdev := qcli.NetDevice{
+			ID:        id,
+			BootIndex: bootIndex(iface.Boot),
+		}
+		if iface.MAC != nil {
+			netdev.MACAddress = iface.MAC.Address
+		}
+
+		switch iface.Type {
+		case "user":
+			netdev.Type = qcli.USER
+			netdev.User.IPV4 = true
+		case "bridge", "network", "ethernet":
+			netdev.Type = qcli.TAP
+			if iface.Target != nil {
+				netdev.Tap.IFName = iface.Target.Dev
+			}
+			switch {
+			case iface.Source.Bridge != "":
+				c.flag("%s bridge %s must be attached with a tap script", path, iface.Source.Bridge)
+			case iface.Source.Network != "":
+				c.flag("%s libvirt network %s must be attached with a tap script", path, iface.Source.Network)
+			}
+		default:
+			c.flag("%s type %s is not supported", path, iface.Type)
+			continue
+		}
+
+		model := "virtio"
+		if iface.Model != nil {
+			model = iface.Model.Type
+		}
+		switch model {
+		case "virtio":
+			netdev.Driver = qcli.VirtioNet
+		case "e1000":
+			netdev.Driver = qcli.E1000
+		default:
+			c.flag("%s model %s is not supported, using virtio", path, model)
+			netdev.Driver = qcli.VirtioNet
+		}
+
+		c.config.NetDevices = append(c.config.NetDevices, netdev)
+		c.flagOther(path, iface.Other)
+	}
+
+	return nil
+}
+
+// serialDevice returns the -serial equivalent of a libvirt serial port.
+func serialDevice(serial Serial) (qcli.LegacySerialDevice, error) {
+	src := serial.Source
+	if src == nil {
+		src = &SerialSource{}
+	}
+
+	switch serial.Type {
+	case "pty":
+		return qcli.LegacySerialDevice{Name: "pty"}, nil
+	case "stdio":
+		return qcli.LegacySerialDevice{Name: "stdio"}, nil
+	case "null":
+		return qcli.LegacySerialDevice{Name: "null"}, nil
+	case "file":
+		return qcli.LegacySerialDevice{Name: "file:" + src.Path}, nil
+	case "unix":
+		if src.Mode != "bind" {
+			return qcli.LegacySerialDevice{}, fmt.Errorf("unix mode %s is not supported", src.Mode)
+		}
+		return qcli.LegacySerialDevice{Backend: qcli.Socket, Path: src.Path}, nil
+	case "tcp":
+		name := fmt.Sprintf("tcp:%s:%s", src.Host, src.Service)
+		if src.Mode == "bind" {
+			name += ",server=on,wait=off"
+		}
+		return qcli.LegacySerialDevice{Name: name}, nil
+	}
+	return qcli.LegacySerialDevice{}, fmt.Errorf("type %s is not supported", serial.Type)
+}
+
+func (c *converter) convertSerials(dom *Domain) error {
+	for i, serial := range dom.Devices.Serials {
+		if serial.Target != nil && serial.Target.Type != "" && serial.Target.Type != "isa-serial" {
+			c.flag("devices/serial %d target %s is not supported", i, serial.Target.Type)
+			continue
+		}
+		dev, err := serialDevice(serial)
+		if err != nil {
+			c.flag("devices/serial %d %v", i, err)
+			continue
+		}
+		c.config.LegacySerialDevices = append(c.config.LegacySerialDevices, dev)
+	}
+
+	// libvirt lists the first serial port as a console too
+	for i, console := range dom.Devices.Consoles {
+		if console.Target != nil && console.Target.Type == "serial" && len(dom.Devices.Serials) > 0 {
+			continue
+		}
+		c.flag("devices/console %d is not supported, only serial consoles are", i)
+	}
+
+	return nil
+}
+
+func (c *converter) convertDevices(dom *Domain) error {
+	devices := dom.Devices
+
+	for _, ctrl := range devices.Controllers {
+		switch {
+		case ctrl.Type == "pci" || ctrl.Type == "ide" || ctrl.Type == "sata" || ctrl.Type == "fdc":
+			// built in the machine type or created by qemu
+		case ctrl.Type == "scsi" && ctrl.Model == "virtio-scsi":
+			c.config.SCSIControllerDevices = append(c.config.SCSIControllerDevices, qcli.SCSIControllerDevice{
+				ID:     "scsi" + ctrl.Index,
+				Driver: qcli.VirtioScsi,
+			})
+		case ctrl.Type == "usb" && (ctrl.Model == "qemu-xhci" || ctrl.Model == "nec-xhci"):
+			c.config.USBControllerDevices = append(c.config.USBControllerDevices, qcli.USBControllerDevice{
+				ID:     "usb" + ctrl.Index,
+				Driver: qcli.USBXHCIController,
+			})
+		case ctrl.Type == "usb" && ctrl.Model == "none":
+		default:
+			c.flag("devices/controller type=%s model=%s is not supported", ctrl.Type, ctrl.Model)
+		}
+	}
+
+	if balloon := devices.MemBalloon; balloon != nil {
+		switch balloon.Model {
+		case "none":
+		case "virtio":
+			c.config.BalloonDevices = append(c.config.BalloonDevices, qcli.BalloonDevice{ID: "balloon0"})
+		default:
+			c.flag("devices/memballoon model %s is not supported", balloon.Model)
+		}
+	}
+
+	for i, rng := range devices.RNGs {
+		if rng.Model != "virtio" || rng.Backend.Model != "random" {
+			c.flag("devices/rng %d model %s backend %s is not supported", i, rng.Model, rng.Backend.Model)
+			continue
+		}
+		c.config.RngDevices = append(c.config.RngDevices, qcli.RngDevice{
+			ID:       fmt.Sprintf("rng%d", i),
+			Driver:   qcli.VirtioRng,
+			Filename: strings.TrimSpace(rng.Backend.Path),
+		})
+	}
+
+	c.flagOther("devices", devices.Other)
+
+	return nil
+}
@@ -0,0 +1,272 @@
+package libvirt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/project-machine/qcli"
+)
+
+var domainXML = `<domain type='kvm'>
+  <name>win10</name>
+  <uuid>5d1f2b3c-7d6e-4a8b-9c0d-1e2f3a4b5c6d</uuid>
+  <memory unit='KiB'>8388608</memory>
+  <currentMemory unit='KiB'>8388608</currentMemory>
+  <vcpu placement='static'>4</vcpu>
+  <os>
+    <type arch='x86_64' machine='pc-q35-6.2'>hvm</type>
+    <loader readonly='yes' secure='yes' type='pflash'>/usr/share/OVMF/OVMF_CODE.secboot.fd</loader>
+    <nvram>/var/lib/libvirt/qemu/nvram/win10_VARS.fd</nvram>
+    <boot dev='hd'/>
+  </os>
+  <features>
+    <acpi/>
+    <apic/>
+    <hyperv mode='custom'>
+      <relaxed state='on'/>
+      <vapic state='on'/>
+      <spinlocks state='on' retries='8191'/>
+      <vpindex state='on'/>
+      <synic state='on'/>
+      <stimer state='on'/>
+      <vendor_id state='on' value='KVMKVMKVM'/>
+    </hyperv>
+    <kvm>
+      <hidden state='on'/>
+    </kvm>
+    <vmport state='off'/>
+    <smm state='on'/>
+  </features>
+  <cpu mode='host-passthrough' check='none'>
+    <topology sockets='1' dies='1' cores='2' threads='2'/>
+    <feature policy='disable' name='hypervisor'/>
+  </cpu>
+  <clock offset='localtime'/>
+  <on_poweroff>destroy</on_poweroff>
+  <on_reboot>restart</on_reboot>
+  <on_crash>destroy</on_crash>
+  <devices>
+    <emulator>/usr/bin/qemu-system-x86_64</emulator>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2' cache='none' io='native' discard='unmap'/>
+      <source file='/var/lib/libvirt/images/win10.qcow2'/>
+      <target dev='sda' bus='scsi'/>
+      <boot order='1'/>
+      <address type='drive' controller='0' bus='0' target='0' unit='0'/>
+    </disk>
+    <disk type='file' device='cdrom'>
+      <driver name='qemu' type='raw'/>
+      <source file='/var/lib/libvirt/images/virtio-win.iso'/>
+      <target dev='sdb' bus='sata'/>
+      <readonly/>
+    </disk>
+    <disk type='network' device='disk'>
+      <source protocol='rbd' name='pool/image'/>
+      <target dev='vdb' bus='virtio'/>
+    </disk>
+    <controller type='scsi' index='0' model='virtio-scsi'/>
+    <controller type='usb' index='0' model='qemu-xhci'/>
+    <controller type='pci' index='0' model='pcie-root'/>
+    <interface type='bridge'>
+      <mac address='52:54:00:ab:cd:ef'/>
+      <source bridge='br0'/>
+      <target dev='vnet0'/>
+      <model type='virtio'/>
+    </interface>
+    <interface type='user'>
+      <model type='rtl8139'/>
+    </interface>
+    <serial type='pty'>
+      <target type='isa-serial' port='0'/>
+    </serial>
+    <console type='pty'>
+      <target type='serial' port='0'/>
+    </console>
+    <graphics type='spice' autoport='yes'/>
+    <memballoon model='virtio'/>
+    <rng model='virtio'>
+      <backend model='random'>/dev/urandom</backend>
+    </rng>
+  </devices>
+</domain>`
+
+func TestConvert(t *testing.T) {
+	config, unsupported, err := Convert([]byte(domainXML))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if config.Name != "win10" || config.Path != "/usr/bin/qemu-system-x86_64" {
+		t.Errorf("Unexpected name or path: %s %s", config.Name, config.Path)
+	}
+	expectedMachine := qcli.Machine{Type: "pc-q35-6.2", Acceleration: "kvm", SMM: "on", VMPort: "off"}
+	if !reflect.DeepEqual(config.Machine, expectedMachine) {
+		t.Errorf("Expected machine %+v, found %+v", expectedMachine, config.Machine)
+	}
+	if config.Memory.Size != "8G" {
+		t.Errorf("Expected 8G of memory, found %s", config.Memory.Size)
+	}
+	expectedSMP := qcli.SMP{CPUs: 4, Sockets: 1, Cores: 2, Threads: 2}
+	if !reflect.DeepEqual(config.SMP, expectedSMP) {
+		t.Errorf("Expected smp %+v, found %+v", expectedSMP, config.SMP)
+	}
+	if config.Knobs.NoACPI {
+		t.Errorf("Expected ACPI to be enabled")
+	}
+
+	expectedFeatures := []qcli.CPUFeature{
+		{Name: "hypervisor", Disable: true},
+		{Name: "hv_vendor_id", Value: "KVMKVMKVM"},
+		{Name: "kvm", Value: "off"},
+	}
+	if config.CPUModel != "host" || !reflect.DeepEqual(config.CPUFeatures, expectedFeatures) {
+		t.Errorf("Unexpected cpu %s %+v", config.CPUModel, config.CPUFeatures)
+	}
+	expectedHyperV := qcli.HyperV{Relaxed: true, VAPIC: true, SpinlockRetries: 8191, VPIndex: true, Time: true, SynIC: true, STimer: true}
+	if config.HyperV != expectedHyperV {
+		t.Errorf("Expected hyperv %+v, found %+v", expectedHyperV, config.HyperV)
+	}
+
+	expectedUEFI := []qcli.UEFIFirmwareDevice{{Code: "/usr/share/OVMF/OVMF_CODE.secboot.fd", Vars: "/var/lib/libvirt/qemu/nvram/win10_VARS.fd"}}
+	if !reflect.DeepEqual(config.UEFIFirmwareDevices, expectedUEFI) {
+		t.Errorf("Expected firmware %+v, found %+v", expectedUEFI, config.UEFIFirmwareDevices)
+	}
+
+	expectedDisks := []qcli.BlockDevice{
+		{
+			Driver: qcli.SCSIHD, ID: "sda", File: "/var/lib/libvirt/images/win10.qcow2", Format: qcli.QCOW2,
+			Interface: qcli.NoInterface, Bus: "scsi0.0", BootIndex: qcli.NewBootIndex(1),
+			Cache: qcli.CacheModeNone, AIO: qcli.Native, Discard: qcli.DiscardUnmap,
+		},
+		{
+			Driver: qcli.IDECDROM, ID: "sdb", File: "/var/lib/libvirt/images/virtio-win.iso", Format: qcli.RAW,
+			Interface: qcli.NoInterface, Media: "cdrom", ReadOnly: true,
+		},
+	}
+	if !reflect.DeepEqual(config.BlkDevices, expectedDisks) {
+		t.Errorf("Expected disks %+v, found %+v", expectedDisks, config.BlkDevices)
+	}
+	if len(config.SCSIControllerDevices) != 1 || config.SCSIControllerDevices[0].ID != "scsi0" ||
+		len(config.USBControllerDevices) != 1 {
+		t.Errorf("Unexpected controllers %+v %+v", config.SCSIControllerDevices, config.USBControllerDevices)
+	}
+
+	if len(config.NetDevices) != 2 {
+		t.Fatalf("Expected 2 interfaces, found %+v", config.NetDevices)
+	}
+	tap := config.NetDevices[0]
+	if tap.Type != qcli.TAP || tap.Tap.IFName != "vnet0" || tap.MACAddress != "52:54:00:ab:cd:ef" || tap.Driver != qcli.VirtioNet {
+		t.Errorf("Unexpected tap interface %+v", tap)
+	}
+	if config.NetDevices[1].Type != qcli.USER {
+		t.Errorf("Unexpected user interface %+v", config.NetDevices[1])
+	}
+
+	if len(config.LegacySerialDevices) != 1 || config.LegacySerialDevices[0].Name != "pty" {
+		t.Errorf("Unexpected serial ports %+v", config.LegacySerialDevices)
+	}
+	if len(config.BalloonDevices) != 1 || len(config.RngDevices) != 1 || config.RngDevices[0].Filename != "/dev/urandom" {
+		t.Errorf("Unexpected balloon or rng %+v %+v", config.BalloonDevices, config.RngDevices)
+	}
+
+	expectedUnsupported := []string{
+		"domain/clock is not supported",
+		"os/boot dev=hd is not supported, use the device boot order",
+		"devices/disk target=vdb type network is not supported",
+		"devices/interface net0 bridge br0 must be attached with a tap script",
+		"devices/interface net1 model rtl8139 is not supported, using virtio",
+		"devices/graphics is not supported",
+	}
+	if !reflect.DeepEqual(unsupported, expectedUnsupported) {
+		t.Errorf("Expected unsupported:\n%s\nfound:\n%s", strings.Join(expectedUnsupported, "\n"), strings.Join(unsupported, "\n"))
+	}
+}
+
+func TestConvertNoACPI(t *testing.T) {
+	xml := `<domain type='qemu'>
+  <name>tiny</name>
+  <memory unit='MiB'>512</memory>
+  <maxMemory slots='4' unit='GiB'>4</maxMemory>
+  <vcpu current='1'>2</vcpu>
+  <os>
+    <type arch='x86_64' machine='q35'>hvm</type>
+    <kernel>/boot/vmlinuz</kernel>
+    <cmdline>console=ttyS0</cmdline>
+  </os>
+  <on_reboot>destroy</on_reboot>
+</domain>`
+
+	config, unsupported, err := Convert([]byte(xml))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(unsupported) != 0 {
+		t.Errorf("Unexpected unsupported elements %v", unsupported)
+	}
+	if !config.Knobs.NoACPI || !config.Knobs.NoReboot || config.Machine.Acceleration != "tcg" {
+		t.Errorf("Unexpected knobs %+v or machine %+v", config.Knobs, config.Machine)
+	}
+	expectedMemory := qcli.Memory{Size: "512M", Slots: 4, MaxMem: "4G"}
+	if config.Memory != expectedMemory {
+		t.Errorf("Expected memory %+v, found %+v", expectedMemory, config.Memory)
+	}
+	if config.SMP.CPUs != 1 || config.SMP.MaxCPUs != 2 {
+		t.Errorf("Unexpected smp %+v", config.SMP)
+	}
+	if config.Kernel.Path != "/boot/vmlinuz" || config.Kernel.Params != "console=ttyS0" {
+		t.Errorf("Unexpected kernel %+v", config.Kernel)
+	}
+}
+
+func TestConvertFloppies(t *testing.T) {
+	xml := `<domain type='kvm'>
+  <name>dos</name>
+  <devices>
+    <disk type='file' device='floppy'>
+      <source file='/var/lib/libvirt/images/boot.img'/>
+      <target dev='fda' bus='fdc'/>
+    </disk>
+    <disk type='file' device='floppy'>
+      <source file='/var/lib/libvirt/images/data.img'/>
+      <target dev='fdb' bus='fdc'/>
+      <readonly/>
+    </disk>
+    <disk type='file' device='floppy'>
+      <source file='/var/lib/libvirt/images/extra.img'/>
+      <target dev='fdc' bus='fdc'/>
+    </disk>
+  </devices>
+</domain>`
+
+	config, unsupported, err := Convert([]byte(xml))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expectedFloppies := []qcli.FloppyDevice{
+		{ID: "fda", File: "/var/lib/libvirt/images/boot.img", Format: qcli.RAW, Unit: 0},
+		{ID: "fdb", File: "/var/lib/libvirt/images/data.img", Format: qcli.RAW, Unit: 1, ReadOnly: true},
+	}
+	if !reflect.DeepEqual(config.FloppyDevices, expectedFloppies) {
+		t.Errorf("Expected floppies %+v, found %+v", expectedFloppies, config.FloppyDevices)
+	}
+	expectedUnsupported := []string{"devices/disk target=fdc floppy target must be fda or fdb"}
+	if !reflect.DeepEqual(unsupported, expectedUnsupported) {
+		t.Errorf("Expected unsupported %v, found %v", expectedUnsupported, unsupported)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	domains := []string{
+		`<domain type='kvm'><name>bad`,
+		`<domain type='xen'><memory>1024</memory></domain>`,
+		`<domain type='kvm'><os><type>exe</type></os></domain>`,
+		`<domain type='kvm'><memory unit='parsecs'>1</memory></domain>`,
+	}
+	for _, dom := range domains {
+		if _, _, err := Convert([]byte(dom)); err == nil {
+			t.Errorf("Expected error for domain %s", dom)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package libvirt converts libvirt domain XML definitions to qcli Configs,
+// reporting the elements that have no qcli equivalent so that a migration
+// off libvirt can be audited.
+package libvirt
+
+import (
+	"encoding/xml"
+)
+
+// anyElement captures an XML element the converter does not know.
+type anyElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+}
+
+// Domain is the subset of the libvirt domain XML the converter reads.
+type Domain struct {
+	XMLName       xml.Name      `xml:"domain"`
+	Type          string        `xml:"type,attr"`
+	Name          string        `xml:"name"`
+	UUID          string        `xml:"uuid"`
+	Memory        ScaledInteger `xml:"memory"`
+	CurrentMemory ScaledInteger `xml:"currentMemory"`
+	MaxMemory     *MaxMemory    `xml:"maxMemory"`
+	VCPU          VCPU          `xml:"vcpu"`
+	OS            OS            `xml:"os"`
+	Features      *Features     `xml:"features"`
+	CPU           *CPU          `xml:"cpu"`
+	OnPoweroff    string        `xml:"on_poweroff"`
+	OnReboot      string        `xml:"on_reboot"`
+	OnCrash       string        `xml:"on_crash"`
+	Devices       Devices       `xml:"devices"`
+	Other         []anyElement  `xml:",any"`
+}
+
+// ScaledInteger is a libvirt size with its unit, KiB when not set.
+type ScaledInteger struct {
+	Unit  string `xml:"unit,attr"`
+	Value uint64 `xml:",chardata"`
+}
+
+// MaxMemory is the memory hotplug limit of the domain.
+type MaxMemory struct {
+	ScaledInteger
+	Slots uint8 `xml:"slots,attr"`
+}
+
+// VCPU is the vcpu count, Current vcpus are online at boot.
+type VCPU struct {
+	Current uint32 `xml:"current,attr"`
+	Count   uint32 `xml:",chardata"`
+}
+
+// OS describes how the domain boots.
+type OS struct {
+	Type    OSType       `xml:"type"`
+	Loader  *Loader      `xml:"loader"`
+	NVRAM   string       `xml:"nvram"`
+	Kernel  string       `xml:"kernel"`
+	Initrd  string       `xml:"initrd"`
+	Cmdline string       `xml:"cmdline"`
+	DTB     string       `xml:"dtb"`
+	Boot    []BootDevice `xml:"boot"`
+	Other   []anyElement `xml:",any"`
+}
+
+// OSType is the guest type along with its architecture and machine type.
+type OSType struct {
+	Arch    string `xml:"arch,attr"`
+	Machine string `xml:"machine,attr"`
+	Type    string `xml:",chardata"`
+}
+
+// Loader is the firmware, a pflash code image or a rom.
+type Loader struct {
+	Type     string `xml:"type,attr"`
+	ReadOnly string `xml:"readonly,attr"`
+	Secure   string `xml:"secure,attr"`
+	Path     string `xml:",chardata"`
+}
+
+// BootDevice is an entry of the legacy boot order.
+type BootDevice struct {
+	Dev string `xml:"dev,attr"`
+}
+
+// State is a libvirt on|off setting.
+type State struct {
+	State string `xml:"state,attr"`
+}
+
+// Features are the hypervisor features of the domain.
+type Features struct {
+	ACPI   *struct{}    `xml:"acpi"`
+	APIC   *struct{}    `xml:"apic"`
+	PAE    *struct{}    `xml:"pae"`
+	HyperV *HyperV      `xml:"hyperv"`
+	KVM    *KVMFeatures `xml:"kvm"`
+	VMPort *State       `xml:"vmport"`
+	SMM    *State       `xml:"smm"`
+	Other  []anyElement `xml:",any"`
+}
+
+// HyperV are the Hyper-V enlightenments of the domain.
+type HyperV struct {
+	Relaxed         *State       `xml:"relaxed"`
+	VAPIC           *State       `xml:"vapic"`
+	Spinlocks       *Spinlocks   `xml:"spinlocks"`
+	VPIndex         *State       `xml:"vpindex"`
+	Runtime         *State       `xml:"runtime"`
+	SynIC           *State       `xml:"synic"`
+	STimer          *State       `xml:"stimer"`
+	Reset           *State       `xml:"reset"`
+	VendorID        *VendorID    `xml:"vendor_id"`
+	Frequencies     *State       `xml:"frequencies"`
+	Reenlightenment *State       `xml:"reenlightenment"`
+	TLBFlush        *State       `xml:"tlbflush"`
+	EVMCS           *State       `xml:"evmcs"`
+	Other           []anyElement `xml:",any"`
+}
+
+// Spinlocks is the Hyper-V spinlock retries setting.
+type Spinlocks struct {
+	State   string `xml:"state,attr"`
+	Retries uint32 `xml:"retries,attr"`
+}
+
+// VendorID is the Hyper-V vendor reported to the guest.
+type VendorID struct {
+	State string `xml:"state,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// KVMFeatures are the KVM specific features of the domain.
+type KVMFeatures struct {
+	Hidden *State       `xml:"hidden"`
+	Other  []anyElement `xml:",any"`
+}
+
+// CPU is the guest cpu model and topology.
+type CPU struct {
+	Mode     string       `xml:"mode,attr"`
+	Model    string       `xml:"model"`
+	Topology *Topology    `xml:"topology"`
+	Features []CPUFeature `xml:"feature"`
+	Other    []anyElement `xml:",any"`
+}
+
+// Topology is the guest cpu topology.
+type Topology struct {
+	Sockets uint32 `xml:"sockets,attr"`
+	Dies    uint32 `xml:"dies,attr"`
+	Cores   uint32 `xml:"cores,attr"`
+	Threads uint32 `xml:"threads,attr"`
+}
+
+// CPUFeature is a cpu feature with its policy, e.g. require or disable.
+type CPUFeature struct {
+	Policy string `xml:"policy,attr"`
+	Name   string `xml:"name,attr"`
+}
+
+// Devices are the devices of the domain.
+type Devices struct {
+	Emulator    string       `xml:"emulator"`
+	Disks       []Disk       `xml:"disk"`
+	Controllers []Controller `xml:"controller"`
+	Interfaces  []Interface  `xml:"interface"`
+	Serials     []Serial     `xml:"serial"`
+	Consoles    []Serial     `xml:"console"`
+	MemBalloon  *MemBalloon  `xml:"memballoon"`
+	RNGs        []RNG        `xml:"rng"`
+	Other       []anyElement `xml:",any"`
+}
+
+// Disk is a disk, cdrom or floppy of the domain.
+type Disk struct {
+	Type     string       `xml:"type,attr"`
+	Device   string       `xml:"device,attr"`
+	Driver   DiskDriver   `xml:"driver"`
+	Source   DiskSource   `xml:"source"`
+	Target   DiskTarget   `xml:"target"`
+	ReadOnly *struct{}    `xml:"readonly"`
+	Sharable *struct{}    `xml:"shareable"`
+	Serial   string       `xml:"serial"`
+	Boot     *BootOrder   `xml:"boot"`
+	Address  *Address     `xml:"address"`
+	Other    []anyElement `xml:",any"`
+}
+
+// DiskDriver is the backend driver of a disk.
+type DiskDriver struct {
+	Name    string `xml:"name,attr"`
+	Type    string `xml:"type,attr"`
+	Cache   string `xml:"cache,attr"`
+	IO      string `xml:"io,attr"`
+	Discard string `xml:"discard,attr"`
+}
+
+// DiskSource is the host file or block device of a disk.
+type DiskSource struct {
+	File string `xml:"file,attr"`
+	Dev  string `xml:"dev,attr"`
+}
+
+// DiskTarget is the guest bus of a disk.
+type DiskTarget struct {
+	Dev string `xml:"dev,attr"`
+	Bus string `xml:"bus,attr"`
+}
+
+// BootOrder is the per-device boot order.
+type BootOrder struct {
+	Order int `xml:"order,attr"`
+}
+
+// Address is a device address on a bus.
+type Address struct {
+	Type       string `xml:"type,attr"`
+	Controller string `xml:"controller,attr"`
+	Bus        string `xml:"bus,attr"`
+	Slot       string `xml:"slot,attr"`
+	Unit       string `xml:"unit,attr"`
+}
+
+// Controller is a bus controller of the domain.
+type Controller struct {
+	Type  string `xml:"type,attr"`
+	Index string `xml:"index,attr"`
+	Model string `xml:"model,attr"`
+}
+
+// Interface is a network interface of the domain.
+type Interface struct {
+	Type   string           `xml:"type,attr"`
+	MAC    *MACAddress      `xml:"mac"`
+	Source InterfaceSource  `xml:"source"`
+	Target *InterfaceTarget `xml:"target"`
+	Model  *InterfaceModel  `xml:"model"`
+	Boot   *BootOrder       `xml:"boot"`
+	Other  []anyElement     `xml:",any"`
+}
+
+// MACAddress is the guest MAC address of an interface.
+type MACAddress struct {
+	Address string `xml:"address,attr"`
+}
+
+// InterfaceSource is the host network of an interface.
+type InterfaceSource struct {
+	Network string `xml:"network,attr"`
+	Bridge  string `xml:"bridge,attr"`
+	Dev     string `xml:"dev,attr"`
+}
+
+// InterfaceTarget is the host tap device of an interface.
+type InterfaceTarget struct {
+	Dev string `xml:"dev,attr"`
+}
+
+// InterfaceModel is the guest NIC model.
+type InterfaceModel struct {
+	Type string `xml:"type,attr"`
+}
+
+// Serial is a serial port or console of the domain.
+type Serial struct {
+	Type   string        `xml:"type,attr"`
+	Source *SerialSource `xml:"source"`
+	Target *SerialTarget `xml:"target"`
+}
+
+// SerialSource is the host side of a serial port.
+type SerialSource struct {
+	Mode    string `xml:"mode,attr"`
+	Path    string `xml:"path,attr"`
+	Host    string `xml:"host,attr"`
+	Service string `xml:"service,attr"`
+}
+
+// SerialTarget is the guest side of a serial port.
+type SerialTarget struct {
+	Type string `xml:"type,attr"`
+	Port string `xml:"port,attr"`
+}
+
+// MemBalloon is the memory balloon device.
+type MemBalloon struct {
+	Model string `xml:"model,attr"`
+}
+
+// RNG is a random number generator device.
+type RNG struct {
+	Model   string     `xml:"model,attr"`
+	Backend RNGBackend `xml:"backend"`
+}
+
+// RNGBackend is the host entropy source of an RNG.
+type RNGBackend struct {
+	Model string `xml:"model,attr"`
+	Path  string `xml:",chardata"`
+}
@@ -27,23 +27,62 @@ package qcli
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
-// LoaderDevice represents a qemu loader device.
+// LoaderDevice represents a qemu generic loader device. It places a file,
+// an ELF, uImage or raw blob, in guest memory and optionally points a CPU
+// at it, or with no File only sets the program counter of a CPU to Addr.
 type LoaderDevice struct {
+	// File is the image to load, ELF and uImage files are loaded at their
+	// own addresses unless ForceRaw is set
 	File string `yaml:"file"`
-	ID   string `yaml:"id"`
+
+	// ID is the device ID
+	ID string `yaml:"id"`
+
+	// Addr is the guest physical address a raw File is loaded at, or the
+	// program counter set for CPUNum, e.g. 0x40000000
+	Addr string `yaml:"addr"`
+
+	// CPUNum is the CPU whose program counter is set to the image entry
+	// point, or to Addr when there is no File
+	CPUNum *int `yaml:"cpu-num"`
+
+	// ForceRaw loads File as a raw image at Addr even if it is an ELF or
+	// uImage file
+	ForceRaw bool `yaml:"force-raw"`
 }
 
 // Valid returns true if there is a valid structure defined for LoaderDevice
 func (dev LoaderDevice) Valid() error {
+	if dev.ID == "" {
+		return fmt.Errorf("LoaderDevice has empty ID field")
+	}
+
+	if dev.Addr != "" {
+		if _, err := strconv.ParseUint(dev.Addr, 0, 64); err != nil {
+			return fmt.Errorf("LoaderDevice ID=%s has invalid Addr field: %s", dev.ID, dev.Addr)
+		}
+	}
+
+	if dev.CPUNum != nil && *dev.CPUNum < 0 {
+		return fmt.Errorf("LoaderDevice ID=%s has invalid CPUNum field: %d", dev.ID, *dev.CPUNum)
+	}
+
 	if dev.File == "" {
-		return fmt.Errorf("LoaderDevice has empty File field")
+		// setting the program counter of a cpu needs both
+		if dev.Addr == "" || dev.CPUNum == nil {
+			return fmt.Errorf("LoaderDevice ID=%s has empty File field", dev.ID)
+		}
+		if dev.ForceRaw {
+			return fmt.Errorf("LoaderDevice ID=%s ForceRaw requires a File", dev.ID)
+		}
 	}
 
-	if dev.ID == "" {
-		return fmt.Errorf("LoaderDevice has empty ID field")
+	if dev.ForceRaw && dev.Addr == "" {
+		return fmt.Errorf("LoaderDevice ID=%s ForceRaw requires an Addr", dev.ID)
 	}
 
 	return nil
@@ -54,9 +93,20 @@ func (dev LoaderDevice) QemuParams(config *Config) []string {
 	var qemuParams []string
 	var deviceParams []string
 
-	deviceParams = append(deviceParams, "loader")
-	deviceParams = append(deviceParams, fmt.Sprintf("file=%s", dev.File))
+	deviceParams = append(deviceParams, string(Loader))
+	if dev.File != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("file=%s", dev.File))
+	}
 	deviceParams = append(deviceParams, fmt.Sprintf("id=%s", dev.ID))
+	if dev.Addr != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("addr=%s", dev.Addr))
+	}
+	if dev.CPUNum != nil {
+		deviceParams = append(deviceParams, fmt.Sprintf("cpu-num=%d", *dev.CPUNum))
+	}
+	if dev.ForceRaw {
+		deviceParams = append(deviceParams, "force-raw=on")
+	}
 
 	qemuParams = append(qemuParams, "-device")
 	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
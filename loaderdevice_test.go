@@ -3,11 +3,14 @@ package qcli
 import "testing"
 
 func TestLoaderDevice(t *testing.T) {
+	cpu := 0
 	testCases := []struct {
 		dev Device
 		out string
 	}{
 		{LoaderDevice{File: "f", ID: "id"}, "-device loader,file=f,id=id"},
+		{LoaderDevice{File: "fw.bin", ID: "fw", Addr: "0x40000000", CPUNum: &cpu, ForceRaw: true}, "-device loader,file=fw.bin,id=fw,addr=0x40000000,cpu-num=0,force-raw=on"},
+		{LoaderDevice{ID: "pc", Addr: "0x40000000", CPUNum: &cpu}, "-device loader,id=pc,addr=0x40000000,cpu-num=0"},
 	}
 
 	for _, tc := range testCases {
@@ -29,3 +32,27 @@ func TestLoaderDeviceInvalid(t *testing.T) {
 		t.Fatalf("A LoaderDevice with empty Field field is NOT valid")
 	}
 }
+
+func TestLoaderDeviceInvalidFields(t *testing.T) {
+	cpu := 0
+	devices := []LoaderDevice{
+		{ID: "id", File: "f", Addr: "0xZZ"},
+		{ID: "id", File: "f", ForceRaw: true},
+		{ID: "id", Addr: "0x1000"},
+		{ID: "id", Addr: "0x1000", CPUNum: &cpu, ForceRaw: true},
+	}
+	for _, dev := range devices {
+		if err := dev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid LoaderDevice %+v", dev)
+		}
+	}
+}
+
+func TestAppendConfigLoaderDevices(t *testing.T) {
+	c := &Config{
+		LoaderDevices: []LoaderDevice{
+			{ID: "fw", File: "fw.elf"},
+		},
+	}
+	testConfig(c, "-device loader,file=fw.elf,id=fw", t)
+}
@@ -0,0 +1,148 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net"
+)
+
+// MACAddressOUI is the prefix of the MAC addresses generated by
+// GenerateMACAddress, the locally administered prefix used by qemu and
+// libvirt by default.
+var MACAddressOUI = "52:54:00"
+
+// GenerateMACAddress returns a MAC address under MACAddressOUI derived from
+// the VM name and the NetDevice ID, so that a VM keeps the same MAC address
+// across restarts. It is used for the NetDevices without MACAddress.
+func GenerateMACAddress(vmName, netdevID string) (string, error) {
+	oui, err := net.ParseMAC(MACAddressOUI + ":00:00:00")
+	if err != nil || len(oui) != 6 {
+		return "", fmt.Errorf("Invalid MACAddressOUI value: '%s', must be 3 bytes like 52:54:00", MACAddressOUI)
+	}
+	if oui[0]&1 != 0 {
+		return "", fmt.Errorf("Invalid MACAddressOUI value: '%s', the multicast bit is set", MACAddressOUI)
+	}
+
+	sum := sha256.Sum256([]byte(vmName + "/" + netdevID))
+	copy(oui[3:], sum[:3])
+
+	return oui.String(), nil
+}
+
+// generateMACAddress returns the MAC address of the NetDevice id generated by
+// GenerateMACAddress. A VM without Name gets a random MAC address under
+// MACAddressOUI instead, so that unnamed VMs on the same network do not share
+// MAC addresses, which is kept until the Config is launched again.
+func (config *Config) generateMACAddress(netdevID string) (string, error) {
+	if config.Name != "" {
+		return GenerateMACAddress(config.Name, netdevID)
+	}
+
+	if mac, ok := config.randomMACs[netdevID]; ok {
+		return mac, nil
+	}
+
+	oui, err := GenerateMACAddress("", netdevID)
+	if err != nil {
+		return "", err
+	}
+	hw, _ := net.ParseMAC(oui)
+	if _, err := rand.Read(hw[3:]); err != nil {
+		return "", fmt.Errorf("Failed to generate a random MAC address for NetDevice ID=%s: %s", netdevID, err)
+	}
+
+	if config.randomMACs == nil {
+		config.randomMACs = make(map[string]string)
+	}
+	config.randomMACs[netdevID] = hw.String()
+
+	return hw.String(), nil
+}
+
+// validMACAddress returns an error if mac is not a 6 bytes unicast MAC
+// address usable by a guest network device.
+func validMACAddress(mac string) error {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 {
+		return fmt.Errorf("invalid MAC address %s, must be 6 bytes like 52:54:00:12:34:56", mac)
+	}
+	if hw[0]&1 != 0 {
+		return fmt.Errorf("invalid MAC address %s, the multicast bit is set", mac)
+	}
+	if hw.String() == "00:00:00:00:00:00" {
+		return fmt.Errorf("invalid MAC address %s, it is all zeros", mac)
+	}
+
+	return nil
+}
+
+// macAddress returns the MACAddress of the NetDevice, or the address
+// generated for the NetDevice ID when it is not set.
+func (netdev NetDevice) macAddress(config *Config) string {
+	if netdev.MACAddress != "" || config == nil {
+		return netdev.MACAddress
+	}
+
+	// validateMACAddresses reported a bad MACAddressOUI
+	mac, _ := config.generateMACAddress(netdev.ID)
+	return mac
+}
+
+// macAddresses returns the NetDevice ID using each MAC address of the
+// config, generated addresses included, or an error if two NetDevices
+// share a MAC address.
+func (config *Config) macAddresses() (map[string]string, error) {
+	macs := make(map[string]string)
+	for _, netdev := range config.NetDevices {
+		if netdev.MACAddress == "" {
+			if _, err := config.generateMACAddress(netdev.ID); err != nil {
+				return nil, err
+			}
+		}
+
+		// normalize the case and separators of the address
+		mac := netdev.macAddress(config)
+		if hw, err := net.ParseMAC(mac); err == nil {
+			mac = hw.String()
+		}
+
+		if id, ok := macs[mac]; ok {
+			return nil, fmt.Errorf("NetDevice ID=%s has the MAC address %s of NetDevice ID=%s", netdev.ID, mac, id)
+		}
+		macs[mac] = netdev.ID
+	}
+
+	return macs, nil
+}
+
+// validateMACAddresses checks the MAC addresses of the NetDevices are
+// unique and can be generated when not set.
+func (config *Config) validateMACAddresses() error {
+	_, err := config.macAddresses()
+	return err
+}
@@ -0,0 +1,99 @@
+package qcli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateMACAddress(t *testing.T) {
+	mac, err := GenerateMACAddress("vm1", "net0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(mac, "52:54:00:") || len(mac) != 17 {
+		t.Errorf("Expected a 52:54:00 MAC address, found %s", mac)
+	}
+
+	if again, _ := GenerateMACAddress("vm1", "net0"); again != mac {
+		t.Errorf("Expected the same MAC address %s, found %s", mac, again)
+	}
+	if other, _ := GenerateMACAddress("vm2", "net0"); other == mac {
+		t.Errorf("Expected another VM to get another MAC address than %s", mac)
+	}
+	if other, _ := GenerateMACAddress("vm1", "net1"); other == mac {
+		t.Errorf("Expected another NetDevice to get another MAC address than %s", mac)
+	}
+
+	orig := MACAddressOUI
+	t.Cleanup(func() { MACAddressOUI = orig })
+
+	MACAddressOUI = "02:AB:CD"
+	if mac, _ := GenerateMACAddress("vm1", "net0"); !strings.HasPrefix(mac, "02:ab:cd:") {
+		t.Errorf("Expected a 02:ab:cd MAC address, found %s", mac)
+	}
+
+	for _, oui := range []string{"", "52:54", "52:54:00:00", "zz:54:00", "01:00:5e"} {
+		MACAddressOUI = oui
+		if _, err := GenerateMACAddress("vm1", "net0"); err == nil {
+			t.Errorf("Expected error for MACAddressOUI %s", oui)
+		}
+	}
+}
+
+func TestNetDeviceGeneratedMACAddress(t *testing.T) {
+	mac, _ := GenerateMACAddress("vm1", "user0")
+	c := &Config{
+		Name: "vm1",
+		NetDevices: []NetDevice{
+			{
+				Type:   USER,
+				Driver: E1000,
+				ID:     "user0",
+			},
+		},
+	}
+	testConfig(c, "-name vm1 -netdev user,id=user0,ipv4=off -device e1000,netdev=user0,mac="+mac, t)
+}
+
+func TestBadNetDeviceMACAddresses(t *testing.T) {
+	mac, _ := GenerateMACAddress("vm1", "user0")
+	c := &Config{
+		Name: "vm1",
+		NetDevices: []NetDevice{
+			{Type: USER, Driver: E1000, ID: "user0"},
+			{Type: USER, Driver: E1000, ID: "user1", MACAddress: strings.ToUpper(mac)},
+		},
+	}
+	if _, err := ConfigureParams(c, nil); err == nil {
+		t.Errorf("Expected error for NetDevices with the same MAC address")
+	}
+
+	orig := MACAddressOUI
+	t.Cleanup(func() { MACAddressOUI = orig })
+	MACAddressOUI = "bad"
+	c = &Config{NetDevices: []NetDevice{{Type: USER, Driver: E1000, ID: "user0"}}}
+	if _, err := ConfigureParams(c, nil); err == nil {
+		t.Errorf("Expected error for an invalid MACAddressOUI")
+	}
+}
+
+func TestNetDeviceRandomMACAddress(t *testing.T) {
+	vm1 := &Config{NetDevices: []NetDevice{{Type: USER, Driver: E1000, ID: "user0"}}}
+	vm2 := &Config{NetDevices: []NetDevice{{Type: USER, Driver: E1000, ID: "user0"}}}
+
+	params, err := ConfigureParams(vm1, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	mac := vm1.NetDevices[0].macAddress(vm1)
+	if !strings.HasPrefix(mac, MACAddressOUI+":") || !strings.Contains(strings.Join(params, " "), "mac="+mac) {
+		t.Errorf("Expected a %s MAC address in %s, found %s", MACAddressOUI, params, mac)
+	}
+
+	if _, err := ConfigureParams(vm2, nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if other := vm2.NetDevices[0].macAddress(vm2); other == mac {
+		t.Errorf("Expected VMs without Name to get different MAC addresses, found %s", mac)
+	}
+}
@@ -27,7 +27,7 @@ package qcli
 
 import (
 	"fmt"
-	"log"
+	"sort"
 	"strings"
 )
 
@@ -41,9 +41,14 @@ type Machine struct {
 
 	// Options are options for the machine type
 	// For example gic-version=host and usb=off
-	// FIXME: remove this
+	// Deprecated: use Properties
 	Options string `yaml:"options"`
 
+	// Properties are machine type properties without a dedicated field,
+	// e.g. gic-version, its, usb or hmat. They are emitted sorted by key
+	// and must not set a property already set by another field.
+	Properties map[string]string `yaml:"properties"`
+
 	// on|off
 	SMM string `yaml:"smm"`
 
@@ -87,94 +92,143 @@ const (
 	MachineTypePC      string = "pc"
 	MachineTypeVirt    string = "virt"
 
+	// MachineTypePseries is the QEMU sPAPR machine type for ppc64le
+	MachineTypePseries string = "pseries"
+
 	MachineAccelerationKVM string = "kvm"
 )
 
-func (config *Config) appendMachine() {
-	if config.Machine.Type != "" {
-		var machineParams []string
+func (config *Config) appendMachine() error {
+	if config.Machine.Type == "" {
+		return nil
+	}
 
-		machineParams = append(machineParams, config.Machine.Type)
+	var machineParams []string
+	var errors []string
 
-		if config.Machine.Acceleration != "" {
-			machineParams = append(machineParams, fmt.Sprintf("accel=%s", config.Machine.Acceleration))
-		}
+	machineParams = append(machineParams, config.Machine.Type)
 
-		chip := config.Machine.KernelIRQChip
-		if chip != "" {
-			switch chip {
-			case "on", "off", "split":
-				machineParams = append(machineParams, fmt.Sprintf("kernel_irqchip=%s", chip))
-			default:
-				log.Fatalf("Invalid KernealIRQChip value: '%s', must be one of 'on', 'off', or 'split'", chip)
-			}
-		}
+	if config.Machine.Acceleration != "" {
+		machineParams = append(machineParams, fmt.Sprintf("accel=%s", config.Machine.Acceleration))
+	}
 
-		vmport := config.Machine.VMPort
-		if vmport != "" {
-			switch vmport {
-			case "on", "off", "auto":
-				machineParams = append(machineParams, fmt.Sprintf("vmport=%s", vmport))
-			default:
-				log.Fatalf("Invalid VMPort value: '%s', must be one of 'on', 'off', or 'auto'", vmport)
-			}
+	chip := config.Machine.KernelIRQChip
+	if chip != "" {
+		switch chip {
+		case "on", "off", "split":
+			machineParams = append(machineParams, fmt.Sprintf("kernel_irqchip=%s", chip))
+		default:
+			errors = append(errors, fmt.Sprintf("Invalid KernelIRQChip value: '%s', must be one of 'on', 'off', or 'split'", chip))
 		}
+	}
 
-		if config.Machine.KVMShadowMemSizeBytes > 0 {
-			machineParams = append(machineParams, fmt.Sprintf("kvm_shadow_mem=%d", config.Machine.KVMShadowMemSizeBytes))
+	vmport := config.Machine.VMPort
+	if vmport != "" {
+		switch vmport {
+		case "on", "off", "auto":
+			machineParams = append(machineParams, fmt.Sprintf("vmport=%s", vmport))
+		default:
+			errors = append(errors, fmt.Sprintf("Invalid VMPort value: '%s', must be one of 'on', 'off', or 'auto'", vmport))
 		}
+	}
 
-		mParam := getConfigOnOff("SMM", "smm", config.Machine.SMM)
-		if mParam != "" {
-			machineParams = append(machineParams, mParam)
-		}
+	if config.Machine.KVMShadowMemSizeBytes > 0 {
+		machineParams = append(machineParams, fmt.Sprintf("kvm_shadow_mem=%d", config.Machine.KVMShadowMemSizeBytes))
+	}
 
-		mParam = getConfigOnOff("DumpGuestCore", "dump-guest-core", config.Machine.DumpGuestCore)
-		if mParam != "" {
-			machineParams = append(machineParams, mParam)
-		}
+	onOffParams := []struct {
+		name string
+		key  string
+		val  string
+	}{
+		{"SMM", "smm", config.Machine.SMM},
+		{"DumpGuestCore", "dump-guest-core", config.Machine.DumpGuestCore},
+		{"MemoryMerge", "mem-merge", config.Machine.MemoryMerge},
+		{"IGDPassthrough", "igd-passthrough", config.Machine.IGDPassthrough},
+		{"AESKeyWrap", "aes-key-wrap", config.Machine.AESKeyWrap},
+		{"DEAKeyWrap", "dea-key-wrap", config.Machine.DEAKeyWrap},
+		{"SuppresVMDescription", "suppress-vmdesc", config.Machine.SuppressVMDescription},
+		{"NVDIMM", "nvdimm", config.Machine.NVDIMM},
+		{"EnforceConfigSection", "enforce-config-section", config.Machine.EnforceConfigSection},
+	}
 
-		mParam = getConfigOnOff("MemoryMerge", "mem-merge", config.Machine.MemoryMerge)
-		if mParam != "" {
-			machineParams = append(machineParams, mParam)
+	for _, p := range onOffParams {
+		mParam, err := getConfigOnOff(p.name, p.key, p.val)
+		if err != nil {
+			errors = append(errors, err.Error())
+			continue
 		}
-
-		mParam = getConfigOnOff("IGDPassthrough", "igd-passthrough", config.Machine.IGDPassthrough)
 		if mParam != "" {
 			machineParams = append(machineParams, mParam)
 		}
+	}
 
-		mParam = getConfigOnOff("AESKeyWrap", "aes-key-wrap", config.Machine.AESKeyWrap)
-		if mParam != "" {
-			machineParams = append(machineParams, mParam)
-		}
+	if config.Knobs.NoHPET && config.useMachineHPET() {
+		machineParams = append(machineParams, "hpet=off")
+	}
 
-		mParam = getConfigOnOff("DEAKeyWrap", "dea-key-wrap", config.Machine.DEAKeyWrap)
-		if mParam != "" {
-			machineParams = append(machineParams, mParam)
-		}
+	if config.Knobs.NoACPI && config.useMachineACPI() {
+		machineParams = append(machineParams, "acpi=off")
+	}
 
-		mParam = getConfigOnOff("SuppresVMDescription", "suppress-vmdesc", config.Machine.SuppressVMDescription)
-		if mParam != "" {
-			machineParams = append(machineParams, mParam)
-		}
+	if config.Machine.Options != "" {
+		machineParams = append(machineParams, config.Machine.Options)
+	}
 
-		mParam = getConfigOnOff("NVDIMM", "nvdimm", config.Machine.NVDIMM)
-		if mParam != "" {
-			machineParams = append(machineParams, mParam)
+	var keys []string
+	for key := range config.Machine.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "" {
+			errors = append(errors, "Machine Properties has an empty key")
+			continue
 		}
+		machineParams = append(machineParams, fmt.Sprintf("%s=%s", key, escapeParam(config.Machine.Properties[key])))
+	}
 
-		mParam = getConfigOnOff("EnforceConfigSection", "enforce-config-section", config.Machine.EnforceConfigSection)
-		if mParam != "" {
-			machineParams = append(machineParams, mParam)
-		}
+	if err := checkDuplicateMachineParams(machineParams[1:]); err != nil {
+		errors = append(errors, err.Error())
+	}
 
-		// FIXME: catch all for any options, might trigger duplicates though
-		if config.Machine.Options != "" {
-			machineParams = append(machineParams, config.Machine.Options)
-		}
+	if len(errors) > 0 {
+		return fmt.Errorf("Failed to append Machine: %s", strings.Join(errors, ", "))
+	}
+
+	config.qemuParams = append(config.qemuParams, "-machine")
+	config.qemuParams = append(config.qemuParams, strings.Join(machineParams, ","))
+
+	return nil
+}
 
-		config.qemuParams = append(config.qemuParams, "-machine")
-		config.qemuParams = append(config.qemuParams, strings.Join(machineParams, ","))
+// checkDuplicateMachineParams returns an error if a machine property is set
+// more than once, qemu would silently use the last value.
+func checkDuplicateMachineParams(params []string) error {
+	seen := make(map[string]bool)
+	for _, param := range params {
+		for _, opt := range splitParams(param) {
+			key, _, _ := strings.Cut(opt, "=")
+			// qemu accepts both spellings, e.g. kernel_irqchip and
+			// kernel-irqchip
+			key = strings.ReplaceAll(key, "_", "-")
+			if seen[key] {
+				return fmt.Errorf("Machine property '%s' is set more than once", key)
+			}
+			seen[key] = true
+		}
 	}
+	return nil
+}
+
+// useMachineHPET returns true if the HPET must be disabled with the hpet
+// machine property rather than the deprecated -no-hpet option.
+func (config *Config) useMachineHPET() bool {
+	return config.Version.AtLeast(8, 0)
+}
+
+// useMachineACPI returns true if ACPI must be disabled with the acpi machine
+// property rather than the deprecated -no-acpi option.
+func (config *Config) useMachineACPI() bool {
+	return config.Version.AtLeast(8, 0)
 }
@@ -39,6 +39,61 @@ func TestAppendMachine(t *testing.T) {
 	testAppend(machine, machineString, t)
 }
 
+func TestAppendMachineProperties(t *testing.T) {
+	machineString := "-machine virt,accel=kvm,gic-version=host,its=off,usb=off"
+	machine := Machine{
+		Type:         MachineTypeVirt,
+		Acceleration: MachineAccelerationKVM,
+		Properties: map[string]string{
+			"usb":         "off",
+			"gic-version": "host",
+			"its":         "off",
+		},
+	}
+	testAppend(machine, machineString, t)
+
+	machineString = "-machine q35,smm=on,hmat=on,memory-backend=ram,,0"
+	machine = Machine{
+		Type:    MachineTypePC35,
+		SMM:     "on",
+		Options: "hmat=on",
+		Properties: map[string]string{
+			"memory-backend": "ram,0",
+		},
+	}
+	testAppend(machine, machineString, t)
+}
+
+func TestDuplicateMachineProperties(t *testing.T) {
+	machines := []Machine{
+		{Type: MachineTypePC35, SMM: "on", Properties: map[string]string{"smm": "off"}},
+		{Type: MachineTypePC35, Acceleration: MachineAccelerationKVM, Properties: map[string]string{"accel": "tcg"}},
+		{Type: MachineTypePC35, KernelIRQChip: "on", Properties: map[string]string{"kernel-irqchip": "off"}},
+		{Type: MachineTypePC35, Options: "usb=off", Properties: map[string]string{"usb": "on"}},
+		{Type: MachineTypePC35, Options: "usb=off,usb=on"},
+		{Type: MachineTypePC35, Properties: map[string]string{"": "on"}},
+	}
+
+	for _, m := range machines {
+		c := &Config{Machine: m}
+		if err := c.appendMachine(); err == nil {
+			t.Errorf("Expected error for invalid Machine %+v", m)
+		}
+		if len(c.qemuParams) != 0 {
+			t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
+		}
+	}
+
+	c := &Config{
+		Machine: Machine{Type: MachineTypePC35, Properties: map[string]string{"hpet": "on"}},
+		Knobs:   Knobs{NoHPET: true},
+		Version: Version{Major: 8},
+	}
+	if err := c.appendMachine(); err == nil {
+		t.Errorf("Expected error for hpet property with NoHPET")
+	}
+}
+
 func TestAppendEmptyMachine(t *testing.T) {
 	machine := Machine{}
 
@@ -53,6 +108,30 @@ func TestBadMachine(t *testing.T) {
 	}
 }
 
+func TestBadMachineValues(t *testing.T) {
+	machines := []Machine{
+		{Type: MachineTypePC35, KernelIRQChip: "maybe"},
+		{Type: MachineTypePC35, VMPort: "yes"},
+		{Type: MachineTypePC35, SMM: "true"},
+		{Type: MachineTypePC35, NVDIMM: "1"},
+	}
+
+	for _, m := range machines {
+		c := &Config{Machine: m}
+		if err := c.appendMachine(); err == nil {
+			t.Errorf("Expected error for invalid Machine %+v", m)
+		}
+		if len(c.qemuParams) != 0 {
+			t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
+		}
+	}
+
+	c := &Config{Machine: machines[0]}
+	if _, err := ConfigureParams(c, nil); err == nil {
+		t.Errorf("Expected ConfigureParams error for invalid Machine")
+	}
+}
+
 func TestAppendMachineAarch64Virt(t *testing.T) {
 	machineString := "-machine virt,accel=kvm"
 	machine := Machine{
@@ -0,0 +1,133 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	// sysClassNet is where the host network interfaces are listed
+	sysClassNet = "/sys/class/net"
+
+	// macvtapDevDir is where the macvtap character devices are created
+	macvtapDevDir = "/dev"
+
+	// vhostNetDev is the vhost-net character device
+	vhostNetDev = "/dev/vhost-net"
+)
+
+// MacvtapDevicePath returns the /dev/tapN character device of the existing
+// macvtap interface ifname.
+func MacvtapDevicePath(ifname string) (string, error) {
+	if ifname == "" || strings.ContainsAny(ifname, "/") {
+		return "", fmt.Errorf("invalid interface name '%s'", ifname)
+	}
+
+	content, err := os.ReadFile(filepath.Join(sysClassNet, ifname, "ifindex"))
+	if err != nil {
+		return "", fmt.Errorf("unable to find interface %s: %v", ifname, err)
+	}
+
+	ifindex, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return "", fmt.Errorf("invalid ifindex for interface %s: %v", ifname, err)
+	}
+
+	return filepath.Join(macvtapDevDir, fmt.Sprintf("tap%d", ifindex)), nil
+}
+
+// OpenMacvtapFDs opens queues file descriptors on the macvtap interface
+// ifname and, if vhost is set, as many vhost-net file descriptors. The
+// caller owns the returned files and must close them once qemu started.
+func OpenMacvtapFDs(ifname string, queues int, vhost bool) ([]*os.File, []*os.File, error) {
+	if queues < 1 {
+		return nil, nil, fmt.Errorf("invalid number of queues %d", queues)
+	}
+
+	path, err := MacvtapDevicePath(ifname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fds, err := openFiles(path, queues)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !vhost {
+		return fds, nil, nil
+	}
+
+	vhostFDs, err := openFiles(vhostNetDev, queues)
+	if err != nil {
+		closeFiles(fds)
+		return nil, nil, err
+	}
+
+	return fds, vhostFDs, nil
+}
+
+// OpenMacvtap resolves the macvtap interface ifname and populates the
+// NetDevice FDs, and VhostFDs when VHost is enabled without VHostQemuOpen,
+// with queues file descriptors each.
+func (netdev *NetDevice) OpenMacvtap(ifname string, queues int) error {
+	if netdev.Type != MACVTAP {
+		return fmt.Errorf("NetDevice ID=%s Type=%s is not a macvtap device", netdev.ID, netdev.Type)
+	}
+
+	fds, vhostFDs, err := OpenMacvtapFDs(ifname, queues, netdev.VHost && !netdev.VHostQemuOpen)
+	if err != nil {
+		return err
+	}
+
+	netdev.FDs = fds
+	netdev.VhostFDs = vhostFDs
+
+	return nil
+}
+
+func openFiles(path string, count int) ([]*os.File, error) {
+	var files []*os.File
+	for i := 0; i < count; i++ {
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			closeFiles(files)
+			return nil, fmt.Errorf("unable to open %s: %v", path, err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
@@ -0,0 +1,98 @@
+package qcli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	deviceNetworkMacvtapString = "-netdev tap,id=mvtap0,vhost=on,vhostfds=3:4,fds=5:6 -device virtio-net-pci,netdev=mvtap0,mac=52:54:00:12:34:56,disable-modern=false,mq=on,vectors=6"
+)
+
+func setupMacvtapTest(t *testing.T) {
+	dir := t.TempDir()
+
+	savedSysClassNet, savedDevDir, savedVhostNet := sysClassNet, macvtapDevDir, vhostNetDev
+	t.Cleanup(func() {
+		sysClassNet, macvtapDevDir, vhostNetDev = savedSysClassNet, savedDevDir, savedVhostNet
+	})
+
+	sysClassNet = filepath.Join(dir, "sys")
+	macvtapDevDir = filepath.Join(dir, "dev")
+	vhostNetDev = filepath.Join(macvtapDevDir, "vhost-net")
+
+	if err := os.MkdirAll(filepath.Join(sysClassNet, "mvtap0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sysClassNet, "mvtap0", "ifindex"), []byte("42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(macvtapDevDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, dev := range []string{"tap42", "vhost-net"} {
+		if err := os.WriteFile(filepath.Join(macvtapDevDir, dev), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMacvtapDevicePath(t *testing.T) {
+	setupMacvtapTest(t)
+
+	path, err := MacvtapDevicePath("mvtap0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if expected := filepath.Join(macvtapDevDir, "tap42"); path != expected {
+		t.Errorf("Expected %s, found %s", expected, path)
+	}
+
+	for _, ifname := range []string{"", "../mvtap0", "eth0"} {
+		if _, err := MacvtapDevicePath(ifname); err == nil {
+			t.Errorf("Expected error for interface '%s'", ifname)
+		}
+	}
+}
+
+func TestOpenMacvtap(t *testing.T) {
+	setupMacvtapTest(t)
+
+	netdev := NetDevice{
+		Driver:     VirtioNet,
+		Type:       MACVTAP,
+		ID:         "mvtap0",
+		VHost:      true,
+		MACAddress: "52:54:00:12:34:56",
+	}
+	if err := netdev.OpenMacvtap("mvtap0", 2); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer closeFiles(netdev.FDs)
+	defer closeFiles(netdev.VhostFDs)
+
+	if len(netdev.FDs) != 2 || len(netdev.VhostFDs) != 2 {
+		t.Fatalf("Expected 2 fds and 2 vhost fds, found %d and %d", len(netdev.FDs), len(netdev.VhostFDs))
+	}
+
+	testAppend(netdev, deviceNetworkMacvtapString, t)
+
+	qemuOpen := NetDevice{Driver: VirtioNet, Type: MACVTAP, ID: "mvtap1", VHost: true, VHostQemuOpen: true}
+	if err := qemuOpen.OpenMacvtap("mvtap0", 2); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer closeFiles(qemuOpen.FDs)
+	if len(qemuOpen.FDs) != 2 || len(qemuOpen.VhostFDs) != 0 {
+		t.Errorf("Expected 2 fds and no vhost fds, found %d and %d", len(qemuOpen.FDs), len(qemuOpen.VhostFDs))
+	}
+
+	if _, _, err := OpenMacvtapFDs("mvtap0", 0, false); err == nil {
+		t.Errorf("Expected error for 0 queues")
+	}
+
+	tap := NetDevice{Type: TAP, ID: "tap0"}
+	if err := tap.OpenMacvtap("mvtap0", 1); err == nil {
+		t.Errorf("Expected error for non macvtap NetDevice")
+	}
+}
@@ -0,0 +1,149 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strconv"
+)
+
+const (
+	// mcastNetworkPortBase is the first port assigned to a McastNetwork
+	// without Port, the port is picked in a range of mcastNetworkPorts
+	mcastNetworkPortBase = 20000
+	mcastNetworkPorts    = 10000
+)
+
+// McastNetwork is a virtual network connecting several VMs through a
+// MCASTSOCKET NetDevice in each of them, all joining the same multicast
+// group.
+type McastNetwork struct {
+	// Name is the network name, it is the ID of the NetDevice added to
+	// each VM
+	Name string
+
+	// Address is the multicast group, an organization-local 239.255.x.y
+	// group derived from Name when empty
+	Address string
+
+	// Port is the multicast UDP port, derived from Name when empty
+	Port string
+
+	// Driver is the guest network device, VirtioNet when empty
+	Driver DeviceDriver
+}
+
+// Valid returns an error if the McastNetwork is not usable.
+func (network McastNetwork) Valid() error {
+	if network.Name == "" {
+		return fmt.Errorf("McastNetwork has empty Name field")
+	}
+
+	if network.Address != "" {
+		ip := net.ParseIP(network.Address)
+		if ip == nil || ip.To4() == nil || !ip.IsMulticast() {
+			return fmt.Errorf("McastNetwork Name=%s has invalid Address: %s, must be an IPv4 multicast address", network.Name, network.Address)
+		}
+	}
+
+	if network.Port != "" {
+		port, err := strconv.Atoi(network.Port)
+		if err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("McastNetwork Name=%s has invalid Port: %s", network.Name, network.Port)
+		}
+	}
+
+	return nil
+}
+
+// withDefaults returns the network with the Address, Port and Driver
+// derived from its name when unset, so that the same name always gives
+// the same group.
+func (network McastNetwork) withDefaults() McastNetwork {
+	h := fnv.New32a()
+	h.Write([]byte(network.Name))
+	sum := h.Sum32()
+
+	if network.Address == "" {
+		network.Address = fmt.Sprintf("239.255.%d.%d", byte(sum>>8), byte(sum)|1)
+	}
+	if network.Port == "" {
+		network.Port = strconv.Itoa(mcastNetworkPortBase + int(sum>>16)%mcastNetworkPorts)
+	}
+	if network.Driver == "" {
+		network.Driver = VirtioNet
+	}
+
+	return network
+}
+
+// AddMcastNetwork connects the configs to the network: each of them gets a
+// MCASTSOCKET NetDevice named after the network, joining the shared
+// multicast group with a MAC address generated from the VM name, see
+// GenerateMACAddress, or a random one for a VM without Name. The network
+// with its Address and Port filled in is returned, so that other VMs can
+// join it later. Nothing is changed when an error is returned.
+func AddMcastNetwork(configs []*Config, network McastNetwork) (McastNetwork, error) {
+	if err := network.Valid(); err != nil {
+		return network, err
+	}
+
+	macs := make(map[string]string)
+	for _, config := range configs {
+		for _, netdev := range config.NetDevices {
+			if netdev.ID == network.Name {
+				return network, fmt.Errorf("VM %s already has a NetDevice ID=%s", config.Name, network.Name)
+			}
+		}
+
+		mac, err := config.generateMACAddress(network.Name)
+		if err != nil {
+			return network, err
+		}
+		if other, ok := macs[mac]; ok {
+			return network, fmt.Errorf("VM %s has the MAC address %s of VM %s on McastNetwork Name=%s", config.Name, mac, other, network.Name)
+		}
+		macs[mac] = config.Name
+	}
+
+	network = network.withDefaults()
+	for _, config := range configs {
+		mac, _ := config.generateMACAddress(network.Name)
+		config.NetDevices = append(config.NetDevices, NetDevice{
+			Type:       MCASTSOCKET,
+			Driver:     network.Driver,
+			ID:         network.Name,
+			MACAddress: mac,
+			McastSocket: NetDeviceMcastSocket{
+				Address: network.Address,
+				Port:    network.Port,
+			},
+		})
+	}
+
+	return network, nil
+}
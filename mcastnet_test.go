@@ -0,0 +1,76 @@
+package qcli
+
+import (
+	"testing"
+)
+
+func TestAddMcastNetwork(t *testing.T) {
+	vm1, vm2 := &Config{Name: "vm1"}, &Config{Name: "vm2"}
+
+	network, err := AddMcastNetwork([]*Config{vm1, vm2}, McastNetwork{Name: "lan0"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if network.Address == "" || network.Port == "" || network.Driver != VirtioNet {
+		t.Fatalf("Expected the network defaults to be filled in, found %+v", network)
+	}
+	if err := network.Valid(); err != nil {
+		t.Fatalf("Unexpected error for the filled in network: %s", err)
+	}
+
+	again, _ := AddMcastNetwork([]*Config{{Name: "vm3"}}, McastNetwork{Name: "lan0"})
+	if again.Address != network.Address || again.Port != network.Port {
+		t.Errorf("Expected the same network %+v for the same name, found %+v", network, again)
+	}
+
+	macs := make(map[string]bool)
+	for _, config := range []*Config{vm1, vm2} {
+		if len(config.NetDevices) != 1 {
+			t.Fatalf("Expected 1 NetDevice in %s, found %+v", config.Name, config.NetDevices)
+		}
+		netdev := config.NetDevices[0]
+		if err := netdev.Valid(); err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+		if netdev.ID != "lan0" || netdev.Type != MCASTSOCKET {
+			t.Errorf("Expected MCASTSOCKET NetDevice lan0, found %+v", netdev)
+		}
+		if netdev.McastSocket.Address != network.Address || netdev.McastSocket.Port != network.Port {
+			t.Errorf("Expected group %s:%s, found %+v", network.Address, network.Port, netdev.McastSocket)
+		}
+		if macs[netdev.MACAddress] {
+			t.Errorf("Expected unique MAC addresses, %s is duplicated", netdev.MACAddress)
+		}
+		macs[netdev.MACAddress] = true
+	}
+
+	vm1.NetDevices = nil
+	network, err = AddMcastNetwork([]*Config{vm1}, McastNetwork{Name: "lan1", Address: "230.0.0.1", Port: "1234"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	testConfig(&Config{NetDevices: vm1.NetDevices}, "-netdev socket,id=lan1,mcast=230.0.0.1:1234 -device virtio-net-pci,netdev=lan1,mac="+vm1.NetDevices[0].MACAddress+",disable-modern=false", t)
+}
+
+func TestBadAddMcastNetwork(t *testing.T) {
+	vm := &Config{Name: "vm1", NetDevices: []NetDevice{{ID: "lan0"}}}
+
+	for _, network := range []McastNetwork{
+		{},
+		{Name: "lan1", Address: "10.0.0.1"},
+		{Name: "lan1", Address: "ff02::1"},
+		{Name: "lan1", Port: "http"},
+		{Name: "lan1", Port: "70000"},
+		{Name: "lan0"},
+	} {
+		if _, err := AddMcastNetwork([]*Config{vm}, network); err == nil {
+			t.Errorf("Expected error for %+v", network)
+		}
+	}
+	if _, err := AddMcastNetwork([]*Config{{Name: "vm2"}, {Name: "vm2"}}, McastNetwork{Name: "lan1"}); err == nil {
+		t.Errorf("Expected error for VMs with the same generated MAC address")
+	}
+	if len(vm.NetDevices) != 1 {
+		t.Errorf("Expected the config to be unchanged, found %+v", vm.NetDevices)
+	}
+}
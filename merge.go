@@ -0,0 +1,223 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// MergePolicy controls how lists are combined by MergeConfig.
+type MergePolicy int
+
+const (
+	// MergeAppend appends the overlay list entries to the base list.
+	MergeAppend MergePolicy = iota
+
+	// MergeReplace replaces the base list with a non-empty overlay list.
+	MergeReplace
+)
+
+// MergeConfig deep-merges overlay on top of base and returns a new Config
+// sharing no mutable state with them. Neither base nor overlay are modified.
+//
+// Values set in overlay win over base. Since zero values are treated as unset
+// an overlay resets a base value to its zero value (e.g. false or "") by
+// listing it in its Unset field. Maps are merged key by key and lists are
+// combined according to policy. Open files and the Ctx are shared rather
+// than copied. Internal state built by ConfigureParams is not carried over.
+func MergeConfig(base, overlay *Config, policy MergePolicy) (*Config, error) {
+	if base == nil || overlay == nil {
+		return nil, fmt.Errorf("MergeConfig requires a non-nil base and overlay")
+	}
+
+	if policy != MergeAppend && policy != MergeReplace {
+		return nil, fmt.Errorf("MergeConfig invalid policy: %d", policy)
+	}
+
+	merged := &Config{}
+	dst := reflect.ValueOf(merged).Elem()
+	mergeValue(dst, reflect.ValueOf(base).Elem(), policy)
+	for _, path := range overlay.Unset {
+		if err := resetValue(dst, path); err != nil {
+			return nil, fmt.Errorf("MergeConfig can not unset %q: %s", path, err)
+		}
+	}
+	mergeValue(dst, reflect.ValueOf(overlay).Elem(), policy)
+	merged.Unset = nil
+
+	return merged, nil
+}
+
+func mergeValue(dst, src reflect.Value, policy MergePolicy) {
+	switch src.Kind() {
+	case reflect.Struct:
+		// time.Time only has unexported fields, merge it as a value
+		if src.Type() == reflect.TypeOf(time.Time{}) {
+			if !src.IsZero() {
+				dst.Set(src)
+			}
+			return
+		}
+		for i := 0; i < src.NumField(); i++ {
+			// skip unexported fields
+			if !dst.Field(i).CanSet() {
+				continue
+			}
+			mergeValue(dst.Field(i), src.Field(i), policy)
+		}
+	case reflect.Slice:
+		if src.Len() == 0 {
+			return
+		}
+		if policy == MergeAppend {
+			merged := reflect.MakeSlice(src.Type(), 0, dst.Len()+src.Len())
+			merged = reflect.AppendSlice(merged, dst)
+			dst.Set(reflect.AppendSlice(merged, copyValue(src)))
+		} else {
+			dst.Set(copyValue(src))
+		}
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		merged := reflect.MakeMapWithSize(src.Type(), dst.Len()+src.Len())
+		for _, m := range []reflect.Value{dst, src} {
+			iter := m.MapRange()
+			for iter.Next() {
+				merged.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+			}
+		}
+		dst.Set(merged)
+	default:
+		if !src.IsZero() {
+			dst.Set(copyValue(src))
+		}
+	}
+}
+
+// copyValue returns a deep copy of v. Interfaces, e.g. the Ctx, and
+// pointers to types without exported fields, e.g. an *os.File, are handles
+// which are shared rather than copied.
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || !hasExportedFields(v.Type().Elem()) {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValue(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// hasExportedFields returns true if t is a struct with an exported field.
+func hasExportedFields(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return t.Kind() != reflect.Func && t.Kind() != reflect.Chan
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+// resetValue sets the field at the dot separated YAML key path, e.g.,
+// qemu-knobs.no-reboot, of the struct v to its zero value.
+func resetValue(v reflect.Value, path string) error {
+	for _, key := range strings.Split(path, ".") {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("%s is not a setting of a mapping", key)
+		}
+
+		field, ok := yamlField(v, key)
+		if !ok {
+			return fmt.Errorf("unknown setting %s", key)
+		}
+		v = field
+	}
+
+	v.Set(reflect.Zero(v.Type()))
+	return nil
+}
+
+// yamlField returns the exported field of the struct v with the YAML key.
+func yamlField(v reflect.Value, key string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if name == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
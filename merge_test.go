@@ -0,0 +1,154 @@
+package qcli
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mergeTestBase() *Config {
+	return &Config{
+		Name:     "base",
+		CPUModel: "host",
+		Machine: Machine{
+			Type:         MachineTypePC35,
+			Acceleration: MachineAccelerationKVM,
+		},
+		Memory: Memory{
+			Size: "2G",
+		},
+		SMP: SMP{
+			CPUs: 2,
+		},
+		GlobalParams: []string{"ICH9-LPC.disable_s3=1"},
+		NetDevices: []NetDevice{
+			{
+				Type: USER,
+				ID:   "user0",
+			},
+		},
+	}
+}
+
+func TestMergeConfigAppend(t *testing.T) {
+	base := mergeTestBase()
+	overlay := &Config{
+		Name: "vm1",
+		Memory: Memory{
+			Size: "4G",
+		},
+		RTC: RTC{
+			BaseDateTime: time.Date(2006, 6, 17, 16, 1, 21, 0, time.UTC),
+		},
+		GlobalParams: []string{"ICH9-LPC.disable_s4=1"},
+		BlkDevices: []BlockDevice{
+			{
+				ID:   "hd0",
+				File: "/var/lib/vm1.qcow2",
+			},
+		},
+	}
+
+	merged, err := MergeConfig(base, overlay, MergeAppend)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if merged.Name != "vm1" {
+		t.Errorf("Expected Name vm1, got %s", merged.Name)
+	}
+	if merged.CPUModel != "host" {
+		t.Errorf("Expected CPUModel host, got %s", merged.CPUModel)
+	}
+	if merged.Machine.Type != MachineTypePC35 || merged.Machine.Acceleration != MachineAccelerationKVM {
+		t.Errorf("Expected base Machine to be kept, got %+v", merged.Machine)
+	}
+	if merged.Memory.Size != "4G" || merged.SMP.CPUs != 2 {
+		t.Errorf("Expected Memory 4G and 2 CPUs, got %+v %+v", merged.Memory, merged.SMP)
+	}
+
+	if !merged.RTC.BaseDateTime.Equal(overlay.RTC.BaseDateTime) {
+		t.Errorf("Expected RTC BaseDateTime %s, got %s", overlay.RTC.BaseDateTime, merged.RTC.BaseDateTime)
+	}
+
+	expectedParams := []string{"ICH9-LPC.disable_s3=1", "ICH9-LPC.disable_s4=1"}
+	if !reflect.DeepEqual(merged.GlobalParams, expectedParams) {
+		t.Errorf("Expected GlobalParams %v, got %v", expectedParams, merged.GlobalParams)
+	}
+	if len(merged.NetDevices) != 1 || len(merged.BlkDevices) != 1 {
+		t.Errorf("Expected 1 NetDevice and 1 BlkDevice, got %+v %+v", merged.NetDevices, merged.BlkDevices)
+	}
+
+	// inputs are left untouched
+	if !reflect.DeepEqual(base, mergeTestBase()) {
+		t.Errorf("MergeConfig modified the base config")
+	}
+	if len(overlay.GlobalParams) != 1 {
+		t.Errorf("MergeConfig modified the overlay config")
+	}
+}
+
+func TestMergeConfigReplace(t *testing.T) {
+	overlay := &Config{
+		GlobalParams: []string{"ICH9-LPC.disable_s4=1"},
+	}
+
+	merged, err := MergeConfig(mergeTestBase(), overlay, MergeReplace)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(merged.GlobalParams, overlay.GlobalParams) {
+		t.Errorf("Expected GlobalParams %v, got %v", overlay.GlobalParams, merged.GlobalParams)
+	}
+	if len(merged.NetDevices) != 1 {
+		t.Errorf("Expected base NetDevices to be kept, got %+v", merged.NetDevices)
+	}
+}
+
+func TestMergeConfigDeepCopy(t *testing.T) {
+	ipv6 := true
+	base := mergeTestBase()
+	base.NetDevices[0].User.IPV6 = &ipv6
+	base.Knobs.NoReboot = true
+
+	merged, err := MergeConfig(base, &Config{Name: "vm1"}, MergeAppend)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	*merged.NetDevices[0].User.IPV6 = false
+	merged.GlobalParams[0] = "ICH9-LPC.disable_s4=1"
+	if !*base.NetDevices[0].User.IPV6 || base.GlobalParams[0] != "ICH9-LPC.disable_s3=1" {
+		t.Errorf("Expected merged config not to share state with the base config")
+	}
+
+	overlay := &Config{Unset: []string{"qemu-knobs.no-reboot", "cpu-model"}}
+	merged, err = MergeConfig(base, overlay, MergeAppend)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if merged.Knobs.NoReboot || merged.CPUModel != "" || merged.Name != "base" {
+		t.Errorf("Expected NoReboot and CPUModel to be unset, got %+v %s", merged.Knobs, merged.CPUModel)
+	}
+	if len(merged.Unset) != 0 {
+		t.Errorf("Expected Unset not to be merged, got %v", merged.Unset)
+	}
+}
+
+func TestBadMergeConfig(t *testing.T) {
+	if _, err := MergeConfig(nil, &Config{}, MergeAppend); err == nil {
+		t.Errorf("Expected error merging nil base")
+	}
+	if _, err := MergeConfig(&Config{}, nil, MergeAppend); err == nil {
+		t.Errorf("Expected error merging nil overlay")
+	}
+	for _, path := range []string{"qemu-knobs.no-such-knob", "cpu-model.size", "net-devices.id"} {
+		if _, err := MergeConfig(&Config{}, &Config{Unset: []string{path}}, MergeAppend); err == nil {
+			t.Errorf("Expected error unsetting %s", path)
+		}
+	}
+	if _, err := MergeConfig(&Config{}, &Config{}, MergePolicy(42)); err == nil {
+		t.Errorf("Expected error merging with invalid policy")
+	}
+}
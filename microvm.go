@@ -0,0 +1,120 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// NewMicrovmConfig returns a Config preset for a minimal footprint microvm
+// machine: no option roms, no legacy PIT, PIC and CMOS RTC and no default
+// devices. Virtio devices default to the MMIO transport on this machine
+// type. The caller adds the name, cpus, memory, kernel and devices; the
+// microvm firmware does not boot disks so a Kernel is usually needed.
+func NewMicrovmConfig() *Config {
+	return &Config{
+		Machine: Machine{
+			Type:         MachineTypeMicrovm,
+			Acceleration: MachineAccelerationKVM,
+			Properties: map[string]string{
+				"x-option-roms": "off",
+				"pit":           "off",
+				"pic":           "off",
+				"rtc":           "off",
+			},
+		},
+		Knobs: Knobs{
+			NoUserConfig: true,
+			NoDefaults:   true,
+			NoGraphic:    true,
+		},
+	}
+}
+
+// microvmHasPCIe returns true if the microvm machine has its optional PCIe
+// host bridge enabled.
+func (config *Config) microvmHasPCIe() bool {
+	if config.Machine.Properties["pcie"] == "on" {
+		return true
+	}
+	for _, opt := range splitParams(config.Machine.Options) {
+		if opt == "pcie=on" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMicrovm returns an error if a microvm machine without PCIe has
+// devices which need a PCI bus.
+func (config *Config) validateMicrovm() error {
+	if config.Machine.Type != MachineTypeMicrovm || config.microvmHasPCIe() {
+		return nil
+	}
+
+	var errors []string
+	for _, d := range config.devices {
+		if isPCIOnlyDevice(d) {
+			errors = append(errors, fmt.Sprintf("%T", d))
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Machine type %s without pcie=on does not support PCI devices: %s", MachineTypeMicrovm, strings.Join(errors, ", "))
+	}
+
+	return nil
+}
+
+// isPCIOnlyDevice returns true if the device can only be plugged on a PCI
+// bus, either by its type or because its virtio Transport is set to pci.
+func isPCIOnlyDevice(d Device) bool {
+	switch dev := d.(type) {
+	case PCIeRootPortDevice, PCIExpanderBridge, SpaprPCIHostBridgeDevice,
+		IDEControllerDevice, USBControllerDevice, IVShmemDevice, VirtioPmemDevice:
+		return true
+	case PVPanicDevice:
+		return dev.Model == PVPanicPCI
+	case WatchdogDevice:
+		return dev.Model == WatchdogI6300ESB
+	case VhostUserDevice:
+		return dev.VhostUserType == VhostUserGPU
+	case VFIODevice:
+		// only vfio-ccw is not a PCI device
+		return dev.Transport != TransportCCW
+	case RawDevice:
+		// Addr is a PCI slot, assume other drivers are not PCI devices
+		return dev.Addr != "" || strings.HasSuffix(dev.Driver, "-pci")
+	}
+
+	v := reflect.ValueOf(d)
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+	transport := v.FieldByName("Transport")
+	return transport.IsValid() && transport.Type() == reflect.TypeOf(TransportPCI) && transport.Interface() == TransportPCI
+}
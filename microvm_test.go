@@ -0,0 +1,83 @@
+package qcli
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNewMicrovmConfig(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("microvm is an amd64 machine type")
+	}
+
+	c := NewMicrovmConfig()
+	c.BlkDevices = []BlockDevice{
+		{
+			Driver:    VirtioBlock,
+			ID:        "hd0",
+			File:      "/var/lib/vm.img",
+			Interface: NoInterface,
+			AIO:       Threads,
+			Format:    QCOW2,
+		},
+	}
+	c.RngDevices = []RngDevice{
+		{ID: "rng0", Driver: VirtioRng, Filename: RngDevUrandom},
+	}
+
+	params, err := ConfigureParams(c, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error for microvm preset: %s", err)
+	}
+	out := strings.Join(params, " ")
+	for _, expected := range []string{
+		"-machine microvm,accel=kvm,pic=off,pit=off,rtc=off,x-option-roms=off",
+		"virtio-blk-device",
+		"virtio-rng-device",
+		"-nodefaults",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %q in microvm params: %s", expected, out)
+		}
+	}
+}
+
+func TestMicrovmPCIDevices(t *testing.T) {
+	devices := []Device{
+		PCIeRootPortDevice{ID: "rp0"},
+		IVShmemDevice{ID: "shm0"},
+		PVPanicDevice{Model: PVPanicPCI},
+		WatchdogDevice{Model: WatchdogI6300ESB},
+		RngDevice{ID: "rng0", Transport: TransportPCI},
+		NetDevice{ID: "net0", Transport: TransportPCI},
+		VhostUserDevice{CharDevID: "char0", VhostUserType: VhostUserGPU},
+		VFIODevice{BDF: "02:10.0"},
+		RawDevice{Driver: "virtio-sound-pci"},
+		RawDevice{Driver: "nvme", Addr: "5"},
+	}
+	for _, d := range devices {
+		c := NewMicrovmConfig()
+		c.devices = []Device{d}
+		if err := c.validateMicrovm(); err == nil {
+			t.Errorf("Expected error for PCI device %+v on microvm", d)
+		}
+
+		c.Machine.Properties["pcie"] = "on"
+		if err := c.validateMicrovm(); err != nil {
+			t.Errorf("Unexpected error for PCI device %+v on microvm with pcie: %s", d, err)
+		}
+	}
+
+	c := NewMicrovmConfig()
+	c.devices = []Device{
+		PVPanicDevice{Model: PVPanicISA},
+		WatchdogDevice{Model: WatchdogIB700},
+		RngDevice{ID: "rng0", Transport: TransportMMIO},
+		RngDevice{ID: "rng1"},
+		RawDevice{Driver: "virtio-sound-device"},
+	}
+	if err := c.validateMicrovm(); err != nil {
+		t.Errorf("Unexpected error for microvm devices: %s", err)
+	}
+}
@@ -36,11 +36,38 @@ type MonitorDevice struct {
 	ChardevID string            `yaml:"chardev-id"`
 	Backend   CharDeviceBackend `yaml:"backend"`
 	Path      string            `yaml:"path"`
+
+	// Host and Port select a TCP socket when Backend is Socket.
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	// Mux multiplexes the stdio monitor with a serial port. The mux
+	// chardev is created with ChardevID so a LegacySerialDevice can
+	// attach to it.
+	Mux bool `yaml:"mux"`
+
+	// ReadOnly only exposes the monitor output. QEMU's HMP does not
+	// have a read-only mode so this writes the monitor to the file at Path.
+	ReadOnly bool `yaml:"read-only"`
 }
 
 // Valid returns true if the MonitorDevice structure is valid and complete.
 func (dev MonitorDevice) Valid() error {
-	if dev.Backend == "" {
+	if dev.ReadOnly {
+		if dev.Backend != "" && dev.Backend != File {
+			return fmt.Errorf("MonitorDevice ReadOnly only supports Backend='file'")
+		}
+		if dev.Path == "" {
+			return fmt.Errorf("MonitorDevice with ReadOnly must have Path")
+		}
+		if dev.Mux {
+			return fmt.Errorf("MonitorDevice ReadOnly and Mux are mutually exclusive")
+		}
+		return nil
+	}
+
+	switch dev.Backend {
+	case "":
 		// One must be set
 		if dev.Name == "" && dev.ChardevID == "" {
 			return fmt.Errorf("MonitorDevice requires either Name or ChardevID field to be set")
@@ -50,13 +77,26 @@ func (dev MonitorDevice) Valid() error {
 		if dev.Name != "" && dev.ChardevID != "" {
 			return fmt.Errorf("MonitorDevice Name and ChardevID field are mutually exclusive")
 		}
-	} else {
-		if dev.Backend != Socket {
-			return fmt.Errorf("MonitorDevice only supports Backend='unix'")
+	case Socket:
+		if dev.Path == "" && dev.Port == 0 {
+			return fmt.Errorf("MonitorDevice with Backend must have Path or Port")
 		}
-		if dev.Path == "" {
-			return fmt.Errorf("MonitorDevice with Backend must have Path")
+		if dev.Path != "" && dev.Port != 0 {
+			return fmt.Errorf("MonitorDevice Path and Port field are mutually exclusive")
+		}
+		if dev.Port < 0 || dev.Port > 65535 {
+			return fmt.Errorf("MonitorDevice has invalid Port field: %d", dev.Port)
+		}
+	case Stdio:
+		if dev.Mux && dev.ChardevID == "" {
+			return fmt.Errorf("MonitorDevice with Mux must have ChardevID")
 		}
+	default:
+		return fmt.Errorf("MonitorDevice only supports Backend='socket' or Backend='stdio'")
+	}
+
+	if dev.Mux && dev.Backend != Stdio {
+		return fmt.Errorf("MonitorDevice Mux requires Backend='stdio'")
 	}
 
 	return nil
@@ -67,9 +107,24 @@ func (dev MonitorDevice) QemuParams(config *Config) []string {
 	var qemuParams []string
 	var monParams []string
 
-	if dev.Backend == Socket {
+	if dev.Mux {
+		qemuParams = append(qemuParams, "-chardev")
+		qemuParams = append(qemuParams, fmt.Sprintf("stdio,id=%s,mux=on,signal=off", dev.ChardevID))
+		qemuParams = append(qemuParams, "-mon")
+		qemuParams = append(qemuParams, fmt.Sprintf("chardev=%s,mode=readline", dev.ChardevID))
+		return qemuParams
+	}
+
+	switch {
+	case dev.ReadOnly:
+		monParams = append(monParams, fmt.Sprintf("file:%s", dev.Path))
+	case dev.Backend == Socket && dev.Port != 0:
+		monParams = append(monParams, fmt.Sprintf("tcp:%s:%d,server=on,wait=off", dev.Host, dev.Port))
+	case dev.Backend == Socket:
 		monParams = append(monParams, fmt.Sprintf("unix:%s,server=on,wait=off", dev.Path))
-	} else {
+	case dev.Backend == Stdio:
+		monParams = append(monParams, "stdio")
+	default:
 		if dev.Name != "" && dev.ChardevID == "" {
 			monParams = append(monParams, dev.Name)
 		}
@@ -83,3 +138,31 @@ func (dev MonitorDevice) QemuParams(config *Config) []string {
 
 	return qemuParams
 }
+
+// validateStdio returns an error if more than one monitor, QMP or HMP,
+// claims the qemu process stdio.
+func (config *Config) validateStdio() error {
+	var owners []string
+
+	for _, q := range config.QMPSockets {
+		if q.Type == QMPStdio {
+			owners = append(owners, "QMPSocket")
+		}
+	}
+	for _, m := range config.MonitorDevices {
+		if m.Backend == Stdio && !m.ReadOnly {
+			owners = append(owners, "MonitorDevice")
+		}
+	}
+	for _, s := range config.LegacySerialDevices {
+		if s.MonMux {
+			owners = append(owners, "LegacySerialDevice MonMux")
+		}
+	}
+
+	if len(owners) > 1 {
+		return fmt.Errorf("Only one monitor may use stdio, found: %s", strings.Join(owners, ", "))
+	}
+
+	return nil
+}
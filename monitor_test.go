@@ -6,6 +6,10 @@ var (
 	deviceMonitorString          = "-monitor chardev:char0"
 	deviceMonitorSerialMuxString = "-monitor chardev:char0 -serial chardev:char0 -chardev stdio,id=char0,mux=on,signal=off"
 	deviceMonitorSocketString    = "-monitor unix:/tmp/mon.sock,server=on,wait=off"
+	deviceMonitorTCPString       = "-monitor tcp:127.0.0.1:5555,server=on,wait=off"
+	deviceMonitorStdioString     = "-monitor stdio"
+	deviceMonitorStdioMuxString  = "-chardev stdio,id=mux0,mux=on,signal=off -mon chardev=mux0,mode=readline -serial chardev:mux0"
+	deviceMonitorReadOnlyString  = "-monitor file:/tmp/mon.log"
 )
 
 func TestAppendMonitor(t *testing.T) {
@@ -46,3 +50,118 @@ func TestAppendMonitorSocket(t *testing.T) {
 	}
 	testAppend(mon, deviceMonitorSocketString, t)
 }
+
+func TestAppendMonitorTCP(t *testing.T) {
+	mon := MonitorDevice{
+		Backend: Socket,
+		Host:    "127.0.0.1",
+		Port:    5555,
+	}
+	testAppend(mon, deviceMonitorTCPString, t)
+}
+
+func TestAppendMonitorStdio(t *testing.T) {
+	mon := MonitorDevice{
+		Backend: Stdio,
+	}
+	testAppend(mon, deviceMonitorStdioString, t)
+}
+
+func TestAppendMonitorStdioMux(t *testing.T) {
+	mon := MonitorDevice{
+		Backend:   Stdio,
+		ChardevID: "mux0",
+		Mux:       true,
+	}
+
+	serial := LegacySerialDevice{
+		ChardevID: "mux0",
+	}
+
+	c := &Config{}
+	c.devices = []Device{mon, serial}
+
+	testConfig(c, deviceMonitorStdioMuxString, t)
+}
+
+func TestAppendMonitorReadOnly(t *testing.T) {
+	mon := MonitorDevice{
+		Path:     "/tmp/mon.log",
+		ReadOnly: true,
+	}
+	testAppend(mon, deviceMonitorReadOnlyString, t)
+}
+
+func TestBadMonitor(t *testing.T) {
+	bad := []MonitorDevice{
+		{},
+		{Name: "stdio", ChardevID: "char0"},
+		{Backend: Socket},
+		{Backend: Socket, Path: "/tmp/mon.sock", Port: 5555},
+		{Backend: Stdio, Mux: true},
+		{Backend: Socket, Path: "/tmp/mon.sock", Mux: true},
+		{Backend: Pipe, Path: "/tmp/mon"},
+		{ReadOnly: true},
+		{Backend: Socket, Path: "/tmp/mon.log", ReadOnly: true},
+	}
+
+	for _, mon := range bad {
+		if err := mon.Valid(); err == nil {
+			t.Errorf("Expected error for invalid MonitorDevice %+v", mon)
+		}
+	}
+}
+
+func TestMonitorStdioConflict(t *testing.T) {
+	c := &Config{
+		QMPSockets: []QMPSocket{
+			{
+				Type: QMPStdio,
+			},
+		},
+		MonitorDevices: []MonitorDevice{
+			{
+				Backend: Stdio,
+			},
+		},
+	}
+
+	if _, err := ConfigureParams(c, nil); err == nil {
+		t.Fatalf("Expected error when QMP and HMP both use stdio")
+	}
+
+	c = &Config{
+		MonitorDevices: []MonitorDevice{
+			{
+				Backend: Stdio,
+			},
+		},
+		LegacySerialDevices: []LegacySerialDevice{
+			{
+				MonMux: true,
+			},
+		},
+	}
+
+	if err := c.validateStdio(); err == nil {
+		t.Fatalf("Expected error when two monitors use stdio")
+	}
+
+	c = &Config{
+		QMPSockets: []QMPSocket{
+			{
+				Type: QMPStdio,
+			},
+		},
+		MonitorDevices: []MonitorDevice{
+			{
+				Backend: Socket,
+				Path:    "/tmp/mon.sock",
+			},
+		},
+	}
+
+	if err := c.validateStdio(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
@@ -27,7 +27,6 @@ package qcli
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"strconv"
 	"strings"
@@ -43,6 +42,14 @@ const (
 	// MCASTSOCKET is a socket networking device type
 	MCASTSOCKET NetDeviceType = "mcastsocket"
 
+	// STREAM is a stream socket networking device type, it replaces the
+	// socket connect= and listen= networking since qemu 7.2
+	STREAM NetDeviceType = "stream"
+
+	// DGRAM is a datagram socket networking device type, it replaces the
+	// socket mcast= and udp= networking since qemu 7.2
+	DGRAM NetDeviceType = "dgram"
+
 	// TAP is a TAP networking device type.
 	TAP NetDeviceType = "tap"
 
@@ -61,6 +68,9 @@ const (
 	// VHOSTUSER is a vhost-user port (socket)
 	VHOSTUSER NetDeviceType = "vhostuser"
 
+	// VHOSTVDPA is a vDPA device driven through the vhost-vdpa kernel backend
+	VHOSTVDPA NetDeviceType = "vhost-vdpa"
+
 	DisabledNetDeviceROMFile = "off"
 )
 
@@ -75,18 +85,22 @@ func (n NetDeviceType) QemuNetdevParam(netdev *NetDevice, config *Config) string
 		return "user"
 	case MCASTSOCKET:
 		return "socket"
+	case STREAM:
+		return "stream"
+	case DGRAM:
+		return "dgram"
 	case TAP, MACVTAP, IPVTAP, VETHTAP:
 		return "tap" // -netdev tap,<props> -device virtio-net-pci
 	case VFIO:
-		if netdev.Transport == TransportMMIO {
-			log.Fatal("vfio devices are not support with the MMIO transport")
-		}
 		return "" // -device vfio-pci (no netdev)
 	case VHOSTUSER:
 		if netdev.Transport == TransportCCW {
-			log.Fatal("vhost-user devices are not supported on IBM Z")
+			// not supported on IBM Z, see NetDevice.Valid
+			return ""
 		}
 		return "vhost-user" // -netdev vhost-user,<props> (no device)
+	case VHOSTVDPA:
+		return "vhost-vdpa" // -netdev vhost-vdpa,<props> -device virtio-net-pci
 	default:
 		return ""
 
@@ -107,7 +121,7 @@ func (n NetDeviceType) QemuDeviceParam(netdev *NetDevice, config *Config) Device
 	var device string
 
 	switch n {
-	case MCASTSOCKET:
+	case MCASTSOCKET, STREAM, DGRAM:
 		device = "virtio-net"
 	case USER:
 		device = "virtio-net"
@@ -119,15 +133,15 @@ func (n NetDeviceType) QemuDeviceParam(netdev *NetDevice, config *Config) Device
 		device = "virtio-net"
 	case VETHTAP:
 		device = "virtio-net" // -netdev type=tap -device virtio-net-pci
+	case VHOSTVDPA:
+		device = "virtio-net"
 	case VFIO:
 		if netdev.Transport == TransportMMIO {
-			log.Fatal("vfio devices are not support with the MMIO transport")
+			// not supported with the MMIO transport, see NetDevice.Valid
+			return ""
 		}
 		device = "vfio" // -device vfio-pci (no netdev)
 	case VHOSTUSER:
-		if netdev.Transport == TransportCCW {
-			log.Fatal("vhost-user devices are not supported on IBM Z")
-		}
 		return "" // -netdev type=vhost-user (no device)
 	default:
 		return ""
@@ -168,68 +182,135 @@ type PortRule struct {
 	Guest    Port   `yaml:"guest-port"`
 }
 
-/*
+// UnmarshalYAML accepts either the verbose mapping form of a PortRule or the
+// qemu hostfwd string form, e.g. "tcp:0.0.0.0:2222-:22".
 func (p *PortRule) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	DefaultPortProtocol := "tcp"
-	DefaultPortHostAddress := ""
-	DefaultPortGuestAddress := ""
-	var ruleVal map[string]string
-	var err error
+	var ruleStr string
+	if err := unmarshal(&ruleStr); err == nil {
+		rule, err := ParsePortRule(ruleStr)
+		if err != nil {
+			return err
+		}
+		*p = rule
+		return nil
+	}
 
-	if err = unmarshal(&ruleVal); err != nil {
+	// avoid recursing into this UnmarshalYAML
+	type portRule PortRule
+	var rule portRule
+	if err := unmarshal(&rule); err != nil {
 		return err
 	}
+	*p = PortRule(rule)
 
-	for hostVal, guestVal := range ruleVal {
-		hostToks := strings.Split(hostVal, ":")
-		if len(hostToks) == 3 {
-			p.Protocol = hostToks[0]
-			p.Host.Address = hostToks[1]
-			p.Host.Port, err = strconv.Atoi(hostToks[2])
-			if err != nil {
-				return err
-			}
-		} else if len(hostToks) == 2 {
-			p.Protocol = DefaultPortProtocol
-			p.Host.Address = hostToks[0]
-			p.Host.Port, err = strconv.Atoi(hostToks[1])
-			if err != nil {
-				return err
-			}
-		} else {
-			p.Protocol = DefaultPortProtocol
-			p.Host.Address = DefaultPortHostAddress
-			p.Host.Port, err = strconv.Atoi(hostToks[0])
-			if err != nil {
-				return err
-			}
+	return p.Valid()
+}
+
+// Valid returns an error if the PortRule has an unknown Protocol or a port
+// out of range.
+func (p PortRule) Valid() error {
+	switch p.Protocol {
+	case "", "tcp", "udp":
+	default:
+		return fmt.Errorf("PortRule has invalid Protocol field: %s", p.Protocol)
+	}
+
+	for _, port := range []int{p.Host.Port, p.Guest.Port} {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("PortRule has port %d out of range", port)
 		}
-		guestToks := strings.Split(guestVal, ":")
-		if len(guestToks) == 2 {
-			p.Guest.Address = guestToks[0]
-			p.Guest.Port, err = strconv.Atoi(guestToks[1])
-			if err != nil {
-				return err
-			}
-		} else {
-			p.Guest.Address = DefaultPortGuestAddress
-			p.Guest.Port, err = strconv.Atoi(guestToks[0])
-			if err != nil {
-				return err
-			}
+	}
+
+	return nil
+}
+
+// ParsePortRule parses a qemu hostfwd rule of the form
+// [tcp|udp:][hostaddr]:hostport-[guestaddr]:guestport. The protocol defaults
+// to tcp and IPv6 addresses must be enclosed in brackets.
+func ParsePortRule(rule string) (PortRule, error) {
+	var p PortRule
+
+	hostVal, guestVal, found := strings.Cut(rule, "-")
+	if !found {
+		return p, fmt.Errorf("Invalid PortRule %q: missing '-' between host and guest", rule)
+	}
+
+	p.Protocol = "tcp"
+	for _, proto := range []string{"tcp:", "udp:"} {
+		if strings.HasPrefix(hostVal, proto) {
+			p.Protocol = strings.TrimSuffix(proto, ":")
+			hostVal = strings.TrimPrefix(hostVal, proto)
+			break
 		}
-		break
 	}
-	if p.Protocol != "tcp" && p.Protocol != "udp" {
-		return fmt.Errorf("Invalid PortRule.Protocol value: %s . Must be 'tcp' or 'udp'", p.Protocol)
+
+	var err error
+	if p.Host, err = parsePort(hostVal); err != nil {
+		return p, fmt.Errorf("Invalid PortRule %q host: %s", rule, err)
 	}
-	return nil
+	if p.Guest, err = parsePort(guestVal); err != nil {
+		return p, fmt.Errorf("Invalid PortRule %q guest: %s", rule, err)
+	}
+	if p.Guest.Port == 0 {
+		return p, fmt.Errorf("Invalid PortRule %q: guest port is required", rule)
+	}
+
+	return p, nil
+}
+
+// parsePort parses an [address:]port string where an IPv6 address is
+// enclosed in brackets.
+func parsePort(val string) (Port, error) {
+	var p Port
+	var portStr string
+
+	if strings.HasPrefix(val, "[") {
+		end := strings.Index(val, "]")
+		if end < 0 {
+			return p, fmt.Errorf("missing ']' in %q", val)
+		}
+		p.Address = val[1:end]
+		rest := val[end+1:]
+		if !strings.HasPrefix(rest, ":") {
+			return p, fmt.Errorf("missing port in %q", val)
+		}
+		portStr = rest[1:]
+	} else if idx := strings.LastIndex(val, ":"); idx >= 0 {
+		p.Address = val[:idx]
+		portStr = val[idx+1:]
+	} else {
+		portStr = val
+	}
+
+	if strings.Contains(p.Address, ":") && !strings.HasPrefix(val, "[") {
+		return p, fmt.Errorf("IPv6 address in %q must be enclosed in brackets", val)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return p, fmt.Errorf("invalid port %q", portStr)
+	}
+	if port < 0 || port > 65535 {
+		return p, fmt.Errorf("port %d out of range", port)
+	}
+	p.Port = port
+
+	return p, nil
 }
-*/
 
 func (p PortRule) String() string {
 	return fmt.Sprintf("%s:%s:%d-%s:%d", p.Protocol,
-		p.Host.Address, p.Host.Port, p.Guest.Address, p.Guest.Port)
+		hostfwdAddress(p.Host.Address), p.Host.Port,
+		hostfwdAddress(p.Guest.Address), p.Guest.Port)
+}
+
+// hostfwdAddress wraps IPv6 addresses in brackets as required by the slirp
+// hostfwd syntax.
+func hostfwdAddress(addr string) string {
+	if strings.Contains(addr, ":") && !strings.HasPrefix(addr, "[") {
+		return fmt.Sprintf("[%s]", addr)
+	}
+	return addr
 }
 
 const EmptyPortRule = "::0-:0"
@@ -239,6 +320,35 @@ type NetDeviceUser struct {
 	IPV4        bool       `yaml:"ipv4-enable"`
 	IPV4NetAddr string     `yaml:"ipv4-network-address"`
 	HostForward []PortRule `yaml:"host-port-rules"`
+
+	// IPV4Host is the guest visible address of the host
+	IPV4Host string `yaml:"ipv4-host-address"`
+	// IPV4DNS is the guest visible address of the virtual nameserver
+	IPV4DNS string `yaml:"ipv4-dns-address"`
+	// IPV4DHCPStart is the first of the 16 addresses the DHCP server hands out
+	IPV4DHCPStart string `yaml:"ipv4-dhcp-start"`
+
+	// IPV6 enables or disables IPv6, qemu enables it when unset
+	IPV6 *bool `yaml:"ipv6-enable"`
+	// IPV6NetAddr is the guest visible IPv6 prefix, e.g. fd00::/64
+	IPV6NetAddr string `yaml:"ipv6-network-address"`
+	// IPV6Host is the guest visible IPv6 address of the host
+	IPV6Host string `yaml:"ipv6-host-address"`
+	// IPV6DNS is the guest visible IPv6 address of the virtual nameserver
+	IPV6DNS string `yaml:"ipv6-dns-address"`
+}
+
+// -netdev vhost-vdpa,
+type NetDeviceVhostVDPA struct {
+	// VhostDev is the vhost-vdpa character device, e.g. /dev/vhost-vdpa-0
+	VhostDev string `yaml:"vhostdev"`
+
+	// FD is an already open vhost-vdpa device, used instead of VhostDev
+	FD *os.File `yaml:"-"`
+
+	// Queues is the number of queue pairs, multi-queue is enabled when > 1.
+	// Prefer NetDevice.Queues.
+	Queues int `yaml:"queues"`
 }
 
 // -netdev socket,listen=
@@ -272,10 +382,25 @@ type NetDevice struct {
 	FDs      []*os.File
 	VhostFDs []*os.File
 
+	// Queues is the number of queue pairs, multi-queue is enabled when > 1.
+	// qemu opens the queues of a TAP device itself when there are no FDs,
+	// otherwise it must match the number of FDs.
+	Queues int `yaml:"queues"`
+
 	// VHost enables virtio device emulation from the host kernel instead of from qemu.
 	VHost bool `yaml:"vhost-enable"`
 
-	// MACAddress is the networking device interface MAC address.
+	// VHostForce uses vhost-net even for guests without MSI-X support.
+	VHostForce bool `yaml:"vhost-force"`
+
+	// VHostQemuOpen lets qemu open /dev/vhost-net itself instead of being
+	// given VhostFDs, e.g. when the tap is set up without privileges and
+	// only qemu can access /dev/vhost-net. OpenMacvtap then only opens
+	// the tap FDs.
+	VHostQemuOpen bool `yaml:"vhost-qemu-open"`
+
+	// MACAddress is the networking device interface MAC address, it is
+	// generated from the VM name and ID by GenerateMACAddress when empty.
 	MACAddress string `yaml:"macaddress"`
 
 	// DisableModern prevents qemu from relying on fast MMIO.
@@ -299,8 +424,20 @@ type NetDevice struct {
 	// -netdev socket,mcast=
 	McastSocket NetDeviceMcastSocket `yaml:"mcast-socket"`
 
+	// -netdev stream,.*
+	Stream NetDeviceStream `yaml:"stream"`
+
+	// -netdev dgram,.*
+	Dgram NetDeviceDgram `yaml:"dgram"`
+
+	// -netdev vhost-vdpa,.*
+	VhostVDPA NetDeviceVhostVDPA `yaml:"vhost-vdpa-device"`
+
 	// bootindex
-	BootIndex string `yaml:"bootindex"`
+	BootIndex *BootIndex `yaml:"bootindex"`
+
+	// Filters are netfilter objects attached to this netdev
+	Filters []NetFilter `yaml:"filters"`
 }
 
 // VirtioNetTransport is a map of the virtio-net device name that corresponds
@@ -321,13 +458,30 @@ func (netdev NetDevice) Valid() error {
 		return fmt.Errorf("NetDevice has empty Type field")
 	}
 
+	transport := netdev.Transport
+	if transport == "" {
+		transport = transport.defaultTransport(nil)
+	}
+	if netdev.Type == VFIO && transport == TransportMMIO {
+		return fmt.Errorf("NetDevice ID=%s vfio devices are not supported with the MMIO transport", netdev.ID)
+	}
+	if netdev.Type == VHOSTUSER && transport == TransportCCW {
+		return fmt.Errorf("NetDevice ID=%s vhost-user devices are not supported on IBM Z", netdev.ID)
+	}
+
 	switch netdev.Type {
-	case USER, MCASTSOCKET, TAP, MACVTAP:
+	case USER, MCASTSOCKET, STREAM, DGRAM, TAP, MACVTAP, VHOSTVDPA:
 		break
 	default:
 		return fmt.Errorf("NetDevice has Unknown Type value: %s", netdev.Type)
 	}
 
+	if netdev.MACAddress != "" {
+		if err := validMACAddress(netdev.MACAddress); err != nil {
+			return fmt.Errorf("NetDevice ID=%s has %s", netdev.ID, err)
+		}
+	}
+
 	if netdev.Type == TAP && netdev.Tap.IFName == "" {
 		return fmt.Errorf("Netdevice Type=TAP has empty IFName field")
 	}
@@ -341,14 +495,138 @@ func (netdev NetDevice) Valid() error {
 		}
 	}
 
+	if netdev.Type == STREAM {
+		if err := netdev.Stream.valid(); err != nil {
+			return err
+		}
+	}
+
+	if netdev.Type == DGRAM {
+		if err := netdev.Dgram.valid(); err != nil {
+			return err
+		}
+	}
+
+	if netdev.Type == VHOSTVDPA {
+		if (netdev.VhostVDPA.VhostDev == "") == (netdev.VhostVDPA.FD == nil) {
+			return fmt.Errorf("Netdevice Type=VHOSTVDPA requires one of VhostDev or FD")
+		}
+		if netdev.VhostVDPA.Queues < 0 {
+			return fmt.Errorf("Netdevice Type=VHOSTVDPA has invalid Queues: %d", netdev.VhostVDPA.Queues)
+		}
+		if netdev.Queues > 0 && netdev.VhostVDPA.Queues > 0 && netdev.Queues != netdev.VhostVDPA.Queues {
+			return fmt.Errorf("Netdevice Type=VHOSTVDPA has Queues %d and VhostVDPA.Queues %d", netdev.Queues, netdev.VhostVDPA.Queues)
+		}
+	}
+
+	if err := netdev.validQueues(); err != nil {
+		return err
+	}
+
+	if err := netdev.validVHost(); err != nil {
+		return err
+	}
+
+	if netdev.Type == USER {
+		ipv6 := netdev.User.IPV6 == nil || *netdev.User.IPV6
+		if !netdev.User.IPV4 && !ipv6 {
+			return fmt.Errorf("Netdevice Type=USER has both IPv4 and IPv6 disabled")
+		}
+		if !ipv6 && (netdev.User.IPV6NetAddr != "" || netdev.User.IPV6Host != "" || netdev.User.IPV6DNS != "") {
+			return fmt.Errorf("Netdevice Type=USER has IPv6 addresses with IPv6 disabled")
+		}
+		for _, rule := range netdev.User.HostForward {
+			if err := rule.Valid(); err != nil {
+				return fmt.Errorf("Netdevice ID=%s: %s", netdev.ID, err)
+			}
+		}
+	}
+
+	for _, f := range netdev.Filters {
+		if err := f.Valid(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validQueues checks Queues is usable by the netdev type and matches the
+// file descriptors given to qemu.
+func (netdev NetDevice) validQueues() error {
+	if netdev.Queues < 0 {
+		return fmt.Errorf("NetDevice ID=%s has invalid Queues: %d", netdev.ID, netdev.Queues)
+	}
+
+	if netdev.Queues > 1 {
+		switch netdev.Type {
+		case TAP, MACVTAP, VHOSTVDPA:
+		default:
+			return fmt.Errorf("NetDevice ID=%s Type=%s does not support multiple Queues", netdev.ID, netdev.Type)
+		}
+	}
+
+	if len(netdev.FDs) > 0 && netdev.Queues > 0 && netdev.Queues != len(netdev.FDs) {
+		return fmt.Errorf("NetDevice ID=%s has Queues %d but %d FDs", netdev.ID, netdev.Queues, len(netdev.FDs))
+	}
+
+	if len(netdev.VhostFDs) > 0 {
+		if !netdev.VHost {
+			return fmt.Errorf("NetDevice ID=%s has VhostFDs without VHost", netdev.ID)
+		}
+		if netdev.VHostQemuOpen {
+			return fmt.Errorf("NetDevice ID=%s has VhostFDs with VHostQemuOpen", netdev.ID)
+		}
+		queues := netdev.queues()
+		if queues == 0 {
+			queues = 1
+		}
+		if len(netdev.VhostFDs) != queues {
+			return fmt.Errorf("NetDevice ID=%s has %d VhostFDs for %d queues", netdev.ID, len(netdev.VhostFDs), queues)
+		}
+	}
+
+	return nil
+}
+
+// validVHost checks vhost-net is only enabled for the tap based netdev
+// types and that its options are only given with VHost.
+func (netdev NetDevice) validVHost() error {
+	if !netdev.VHost {
+		if netdev.VHostForce || netdev.VHostQemuOpen {
+			return fmt.Errorf("NetDevice ID=%s has VHostForce or VHostQemuOpen without VHost", netdev.ID)
+		}
+		return nil
+	}
+
+	switch netdev.Type {
+	case TAP, MACVTAP:
+	default:
+		return fmt.Errorf("NetDevice ID=%s Type=%s does not support VHost", netdev.ID, netdev.Type)
+	}
+
 	return nil
 }
 
+// queues returns the number of queue pairs of the netdev, 0 when not set
+func (netdev NetDevice) queues() int {
+	if len(netdev.FDs) > 0 {
+		return len(netdev.FDs)
+	}
+	if netdev.Queues > 0 {
+		return netdev.Queues
+	}
+	if netdev.Type == VHOSTVDPA {
+		return netdev.VhostVDPA.Queues
+	}
+	return 0
+}
+
 // mqParameter returns the parameters for multi-queue driver. If the driver is a PCI device then the
 // vector flag is required. If the driver is a CCW type than the vector flag is not implemented and only
 // multi-queue option mq needs to be activated. See comment in libvirt code at
 // https://github.com/libvirt/libvirt/blob/6e7e965dcd3d885739129b1454ce19e819b54c25/src/qemu/qemu_command.c#L3633
-func (netdev NetDevice) mqParameter(config *Config) string {
+func (netdev NetDevice) mqParameter(config *Config, queues int) string {
 	p := []string{"mq=on"}
 
 	if netdev.Transport.isVirtioPCI(config) {
@@ -361,7 +639,7 @@ func (netdev NetDevice) mqParameter(config *Config) string {
 		// Clearlinux automatically sets up the queues properly
 		// The agent implementation should do this to ensure that it is
 		// always set
-		vectors := len(netdev.FDs)*2 + 2
+		vectors := queues*2 + 2
 		p = append(p, fmt.Sprintf("vectors=%d", vectors))
 	}
 
@@ -379,7 +657,7 @@ func (netdev NetDevice) QemuDeviceParams(config *Config) []string {
 
 	deviceParams = append(deviceParams, fmt.Sprintf("%s", driver))
 	deviceParams = append(deviceParams, fmt.Sprintf("netdev=%s", netdev.ID))
-	deviceParams = append(deviceParams, fmt.Sprintf("mac=%s", netdev.MACAddress))
+	deviceParams = append(deviceParams, fmt.Sprintf("mac=%s", netdev.macAddress(config)))
 
 	if netdev.Bus != "" {
 		deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", netdev.Bus))
@@ -392,8 +670,8 @@ func (netdev NetDevice) QemuDeviceParams(config *Config) []string {
 		}
 	}
 
-	if netdev.BootIndex != "" {
-		deviceParams = append(deviceParams, fmt.Sprintf("bootindex=%s", netdev.BootIndex))
+	if p := netdev.BootIndex.param(); p != "" {
+		deviceParams = append(deviceParams, p)
 	}
 
 	if strings.HasPrefix(string(driver), "virtio") {
@@ -404,7 +682,9 @@ func (netdev NetDevice) QemuDeviceParams(config *Config) []string {
 
 	if len(netdev.FDs) > 0 {
 		// Note: We are appending to the device params here
-		deviceParams = append(deviceParams, netdev.mqParameter(config))
+		deviceParams = append(deviceParams, netdev.mqParameter(config, len(netdev.FDs)))
+	} else if queues := netdev.queues(); queues > 1 {
+		deviceParams = append(deviceParams, netdev.mqParameter(config, queues))
 	}
 
 	if netdev.Transport.isVirtioPCI(config) && netdev.ROMFile != "" {
@@ -420,7 +700,7 @@ func (netdev NetDevice) QemuDeviceParams(config *Config) []string {
 		if config.Knobs.IOMMUPlatform {
 			deviceParams = append(deviceParams, "iommu_platform=on")
 		}
-		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", netdev.DevNo))
+		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(netdev.DevNo)))
 	}
 
 	return deviceParams
@@ -440,6 +720,9 @@ func (netdev NetDevice) QemuNetdevParams(config *Config) []string {
 
 	if netdev.VHost {
 		netdevParams = append(netdevParams, "vhost=on")
+		if netdev.VHostForce {
+			netdevParams = append(netdevParams, "vhostforce=on")
+		}
 		if len(netdev.VhostFDs) > 0 {
 			var fdParams []string
 			qemuFDs := config.appendFDs(netdev.VhostFDs)
@@ -451,7 +734,7 @@ func (netdev NetDevice) QemuNetdevParams(config *Config) []string {
 	}
 
 	switch netdev.Type {
-	case TAP:
+	case TAP, MACVTAP:
 		if len(netdev.FDs) > 0 {
 			var fdParams []string
 
@@ -464,6 +747,9 @@ func (netdev NetDevice) QemuNetdevParams(config *Config) []string {
 
 		} else {
 			netdevParams = append(netdevParams, fmt.Sprintf("ifname=%s", netdev.Tap.IFName))
+			if netdev.Queues > 1 {
+				netdevParams = append(netdevParams, fmt.Sprintf("queues=%d", netdev.Queues))
+			}
 			if netdev.Tap.DownScript != "" {
 				netdevParams = append(netdevParams, fmt.Sprintf("downscript=%s", netdev.Tap.DownScript))
 			}
@@ -488,11 +774,57 @@ func (netdev NetDevice) QemuNetdevParams(config *Config) []string {
 		if netdev.User.IPV4NetAddr != "" {
 			netdevParams = append(netdevParams, fmt.Sprintf("net=%s", netdev.User.IPV4NetAddr))
 		}
+
+		if netdev.User.IPV4Host != "" {
+			netdevParams = append(netdevParams, fmt.Sprintf("host=%s", netdev.User.IPV4Host))
+		}
+
+		if netdev.User.IPV4DNS != "" {
+			netdevParams = append(netdevParams, fmt.Sprintf("dns=%s", netdev.User.IPV4DNS))
+		}
+
+		if netdev.User.IPV4DHCPStart != "" {
+			netdevParams = append(netdevParams, fmt.Sprintf("dhcpstart=%s", netdev.User.IPV4DHCPStart))
+		}
+
+		if netdev.User.IPV6 != nil {
+			if *netdev.User.IPV6 {
+				netdevParams = append(netdevParams, "ipv6=on")
+			} else {
+				netdevParams = append(netdevParams, "ipv6=off")
+			}
+		}
+
+		if netdev.User.IPV6NetAddr != "" {
+			netdevParams = append(netdevParams, fmt.Sprintf("ipv6-net=%s", netdev.User.IPV6NetAddr))
+		}
+
+		if netdev.User.IPV6Host != "" {
+			netdevParams = append(netdevParams, fmt.Sprintf("ipv6-host=%s", netdev.User.IPV6Host))
+		}
+
+		if netdev.User.IPV6DNS != "" {
+			netdevParams = append(netdevParams, fmt.Sprintf("ipv6-dns=%s", netdev.User.IPV6DNS))
+		}
+	case VHOSTVDPA:
+		if netdev.VhostVDPA.FD != nil {
+			qemuFDs := config.appendFDs([]*os.File{netdev.VhostVDPA.FD})
+			netdevParams = append(netdevParams, fmt.Sprintf("vhostfd=%d", qemuFDs[0]))
+		} else {
+			netdevParams = append(netdevParams, fmt.Sprintf("vhostdev=%s", netdev.VhostVDPA.VhostDev))
+		}
+		if queues := netdev.queues(); queues > 1 {
+			netdevParams = append(netdevParams, fmt.Sprintf("queues=%d", queues))
+		}
 	case MCASTSOCKET:
 		var mcastParam string
 
 		mcastParam = fmt.Sprintf("mcast=%s:%s", netdev.McastSocket.Address, netdev.McastSocket.Port)
 		netdevParams = append(netdevParams, mcastParam)
+	case STREAM:
+		netdevParams = append(netdevParams, netdev.Stream.qemuParams(config)...)
+	case DGRAM:
+		netdevParams = append(netdevParams, netdev.Dgram.qemuParams(config)...)
 	}
 
 	return netdevParams
@@ -525,5 +857,12 @@ func (netdev NetDevice) QemuParams(config *Config) []string {
 		}
 	}
 
+	// filters can only be attached to a netdev
+	if netdevParams != nil {
+		for _, f := range netdev.Filters {
+			qemuParams = append(qemuParams, f.QemuParams(netdev.ID)...)
+		}
+	}
+
 	return qemuParams
 }
@@ -3,18 +3,27 @@ package qcli
 import (
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v2"
 )
 
 var (
-	deviceNetworkPCIString         = "-netdev tap,id=tap0,vhost=on,ifname=ceth0,downscript=no,script=no -device virtio-net-pci,netdev=tap0,mac=01:02:de:ad:be:ef,bus=/pci-bus/pcie.0,addr=0xff,disable-modern=true,romfile=efi-virtio.rom"
-	deviceNetworkPCIStringLowAddr  = "-netdev tap,id=tap0,vhost=on,ifname=ceth0,downscript=no,script=no -device virtio-net-pci,netdev=tap0,mac=01:02:de:ad:be:ef,bus=/pci-bus/pcie.0,addr=0x03,disable-modern=true,romfile=efi-virtio.rom"
-	deviceNetworkPCIStringMq       = "-netdev tap,id=tap0,vhost=on,fds=3:4 -device virtio-net-pci,netdev=tap0,mac=01:02:de:ad:be:ef,bus=/pci-bus/pcie.0,addr=0xff,disable-modern=true,mq=on,vectors=6,romfile=efi-virtio.rom"
-	deviceNetworkString            = "-netdev tap,id=tap0,vhost=on,ifname=ceth0,downscript=no,script=no -device virtio-net-pci,netdev=tap0,mac=01:02:de:ad:be:ef,disable-modern=true,romfile=efi-virtio.rom"
-	deviceNetworkUserString        = "-netdev user,id=user0,ipv4=on,net=10.0.2.15/24 -device e1000,netdev=user0,mac=01:02:de:ad:be:ef,romfile="
-	deviceNetworkUserHostFwdString = "-netdev user,id=user0,ipv4=on,hostfwd=tcp::22222-:22,hostfwd=tcp::8080-:80 -device virtio-net-pci,netdev=user0,mac=01:02:de:ad:be:ef,disable-modern=false"
-	deviceNetworkMcastSocketString = "-netdev socket,id=sock0,mcast=230.0.0.1:1234 -device virtio-net-pci,netdev=sock0,mac=01:02:de:ad:be:ef,disable-modern=true"
-	deviceNetworkTapMqString       = "-netdev tap,id=tap0,vhost=on,fds=3:4 -device virtio-net-pci,netdev=tap0,mac=01:02:de:ad:be:ef,disable-modern=true,mq=on,vectors=6,romfile=efi-virtio.rom"
+	deviceNetworkPCIString         = "-netdev tap,id=tap0,vhost=on,ifname=ceth0,downscript=no,script=no -device virtio-net-pci,netdev=tap0,mac=52:54:00:12:34:56,bus=/pci-bus/pcie.0,addr=0xff,disable-modern=true,romfile=efi-virtio.rom"
+	deviceNetworkPCIStringLowAddr  = "-netdev tap,id=tap0,vhost=on,ifname=ceth0,downscript=no,script=no -device virtio-net-pci,netdev=tap0,mac=52:54:00:12:34:56,bus=/pci-bus/pcie.0,addr=0x03,disable-modern=true,romfile=efi-virtio.rom"
+	deviceNetworkPCIStringMq       = "-netdev tap,id=tap0,vhost=on,fds=3:4 -device virtio-net-pci,netdev=tap0,mac=52:54:00:12:34:56,bus=/pci-bus/pcie.0,addr=0xff,disable-modern=true,mq=on,vectors=6,romfile=efi-virtio.rom"
+	deviceNetworkString            = "-netdev tap,id=tap0,vhost=on,ifname=ceth0,downscript=no,script=no -device virtio-net-pci,netdev=tap0,mac=52:54:00:12:34:56,disable-modern=true,romfile=efi-virtio.rom"
+	deviceNetworkUserString        = "-netdev user,id=user0,ipv4=on,net=10.0.2.15/24 -device e1000,netdev=user0,mac=52:54:00:12:34:56,romfile="
+	deviceNetworkUserHostFwdString = "-netdev user,id=user0,ipv4=on,hostfwd=tcp::22222-:22,hostfwd=tcp::8080-:80 -device virtio-net-pci,netdev=user0,mac=52:54:00:12:34:56,disable-modern=false"
+	deviceNetworkUserIPv6String    = "-netdev user,id=user0,ipv4=off,hostfwd=tcp:[::1]:2222-:22,ipv6=on,ipv6-net=fd00::/64,ipv6-host=fd00::2,ipv6-dns=fd00::3 -device e1000,netdev=user0,mac=52:54:00:12:34:56"
+	deviceNetworkUserIPv4String    = "-netdev user,id=user0,ipv4=on,net=10.0.2.0/24,host=10.0.2.2,dns=10.0.2.3,dhcpstart=10.0.2.15,ipv6=off -device e1000,netdev=user0,mac=52:54:00:12:34:56"
+	deviceNetworkMcastSocketString = "-netdev socket,id=sock0,mcast=230.0.0.1:1234 -device virtio-net-pci,netdev=sock0,mac=52:54:00:12:34:56,disable-modern=true"
+	deviceNetworkVhostVDPAString   = "-netdev vhost-vdpa,id=vdpa0,vhostdev=/dev/vhost-vdpa-0,queues=4 -device virtio-net-pci,netdev=vdpa0,mac=52:54:00:12:34:56,disable-modern=false,mq=on,vectors=10"
+	deviceNetworkVhostVDPAFDString = "-netdev vhost-vdpa,id=vdpa0,vhostfd=3 -device virtio-net-pci,netdev=vdpa0,mac=52:54:00:12:34:56,disable-modern=false"
+	deviceNetworkTapMqString       = "-netdev tap,id=tap0,vhost=on,fds=3:4 -device virtio-net-pci,netdev=tap0,mac=52:54:00:12:34:56,disable-modern=true,mq=on,vectors=6,romfile=efi-virtio.rom"
+	deviceNetworkTapQueuesString   = "-netdev tap,id=tap0,vhost=on,ifname=ceth0,queues=4,downscript=no,script=no -device virtio-net-pci,netdev=tap0,mac=52:54:00:12:34:56,disable-modern=true,mq=on,vectors=10,romfile=efi-virtio.rom"
 )
 
 func TestAppendDeviceNetworkTap(t *testing.T) {
@@ -23,7 +32,7 @@ func TestAppendDeviceNetworkTap(t *testing.T) {
 		Type:          TAP,
 		ID:            "tap0",
 		VHost:         true,
-		MACAddress:    "01:02:de:ad:be:ef",
+		MACAddress:    "52:54:00:12:34:56",
 		DisableModern: true,
 		ROMFile:       "efi-virtio.rom",
 		Tap: NetDeviceTap{
@@ -45,7 +54,7 @@ func TestAppendDeviceNetworkUser(t *testing.T) {
 		Driver:     E1000,
 		Type:       USER,
 		ID:         "user0",
-		MACAddress: "01:02:de:ad:be:ef",
+		MACAddress: "52:54:00:12:34:56",
 		ROMFile:    DisabledNetDeviceROMFile,
 		User: NetDeviceUser{
 			IPV4:        true,
@@ -56,13 +65,66 @@ func TestAppendDeviceNetworkUser(t *testing.T) {
 	testAppend(netdev, deviceNetworkUserString, t)
 }
 
+func TestAppendDeviceNetworkUserIPv6(t *testing.T) {
+	ipv6 := true
+	netdev := NetDevice{
+		Driver:     E1000,
+		Type:       USER,
+		ID:         "user0",
+		MACAddress: "52:54:00:12:34:56",
+		User: NetDeviceUser{
+			IPV6:        &ipv6,
+			IPV6NetAddr: "fd00::/64",
+			IPV6Host:    "fd00::2",
+			IPV6DNS:     "fd00::3",
+			HostForward: []PortRule{
+				{
+					Protocol: "tcp",
+					Host:     Port{Address: "::1", Port: 2222},
+					Guest:    Port{Port: 22},
+				},
+			},
+		},
+	}
+
+	testAppend(netdev, deviceNetworkUserIPv6String, t)
+
+	ipv4Only := false
+	netdev.User = NetDeviceUser{
+		IPV4:          true,
+		IPV4NetAddr:   "10.0.2.0/24",
+		IPV4Host:      "10.0.2.2",
+		IPV4DNS:       "10.0.2.3",
+		IPV4DHCPStart: "10.0.2.15",
+		IPV6:          &ipv4Only,
+	}
+
+	testAppend(netdev, deviceNetworkUserIPv4String, t)
+
+	netdev.User = NetDeviceUser{
+		IPV6: &ipv4Only,
+	}
+	if err := netdev.Valid(); err == nil {
+		t.Fatalf("Expected error with both IPv4 and IPv6 disabled")
+	}
+
+	netdev.User = NetDeviceUser{
+		IPV4:        true,
+		IPV6:        &ipv4Only,
+		IPV6NetAddr: "fd00::/64",
+	}
+	if err := netdev.Valid(); err == nil {
+		t.Fatalf("Expected error with IPv6 addresses and IPv6 disabled")
+	}
+}
+
 func TestAppendDeviceNetworkUserHostForward(t *testing.T) {
 	netdev := NetDevice{
 		Driver:        VirtioNet,
 		Type:          USER,
 		ID:            "user0",
 		DisableModern: false,
-		MACAddress:    "01:02:de:ad:be:ef",
+		MACAddress:    "52:54:00:12:34:56",
 		User: NetDeviceUser{
 			IPV4: true,
 			HostForward: []PortRule{
@@ -89,7 +151,7 @@ func TestAppendDeviceNetworkMcastSocket(t *testing.T) {
 		Type:          MCASTSOCKET,
 		ID:            "sock0",
 		DisableModern: true,
-		MACAddress:    "01:02:de:ad:be:ef",
+		MACAddress:    "52:54:00:12:34:56",
 		McastSocket: NetDeviceMcastSocket{
 			Address: "230.0.0.1",
 			Port:    "1234",
@@ -99,6 +161,31 @@ func TestAppendDeviceNetworkMcastSocket(t *testing.T) {
 	testAppend(netdev, deviceNetworkMcastSocketString, t)
 }
 
+func TestAppendDeviceNetworkVhostVDPA(t *testing.T) {
+	netdev := NetDevice{
+		Driver:     VirtioNet,
+		Type:       VHOSTVDPA,
+		ID:         "vdpa0",
+		MACAddress: "52:54:00:12:34:56",
+		VhostVDPA: NetDeviceVhostVDPA{
+			VhostDev: "/dev/vhost-vdpa-0",
+			Queues:   4,
+		},
+	}
+
+	testAppend(netdev, deviceNetworkVhostVDPAString, t)
+
+	netdev.VhostVDPA = NetDeviceVhostVDPA{FD: os.Stdin}
+	testAppend(netdev, deviceNetworkVhostVDPAFDString, t)
+
+	for _, vdpa := range []NetDeviceVhostVDPA{{}, {VhostDev: "/dev/vhost-vdpa-0", FD: os.Stdin}, {VhostDev: "/dev/vhost-vdpa-0", Queues: -1}} {
+		netdev.VhostVDPA = vdpa
+		if err := netdev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid NetDevice %+v", netdev)
+		}
+	}
+}
+
 func TestAppendDeviceNetworkTapMq(t *testing.T) {
 	foo, _ := ioutil.TempFile(os.TempDir(), "govmm-qemu-test")
 	bar, _ := ioutil.TempFile(os.TempDir(), "govmm-qemu-test")
@@ -116,7 +203,7 @@ func TestAppendDeviceNetworkTapMq(t *testing.T) {
 		ID:            "tap0",
 		FDs:           []*os.File{foo, bar},
 		VHost:         true,
-		MACAddress:    "01:02:de:ad:be:ef",
+		MACAddress:    "52:54:00:12:34:56",
 		DisableModern: true,
 		ROMFile:       "efi-virtio.rom",
 		Tap: NetDeviceTap{
@@ -132,6 +219,86 @@ func TestAppendDeviceNetworkTapMq(t *testing.T) {
 	testAppend(netdev, deviceNetworkTapMqString, t)
 }
 
+func TestAppendDeviceNetworkTapQueues(t *testing.T) {
+	netdev := NetDevice{
+		Driver:        VirtioNet,
+		Type:          TAP,
+		ID:            "tap0",
+		VHost:         true,
+		Queues:        4,
+		MACAddress:    "52:54:00:12:34:56",
+		DisableModern: true,
+		ROMFile:       "efi-virtio.rom",
+		Tap: NetDeviceTap{
+			IFName:     "ceth0",
+			Script:     "no",
+			DownScript: "no",
+		},
+	}
+	if netdev.Transport.isVirtioCCW(nil) {
+		netdev.DevNo = DevNo
+	}
+
+	testAppend(netdev, deviceNetworkTapQueuesString, t)
+}
+
+func TestAppendDeviceNetworkTapVHostForce(t *testing.T) {
+	netdev := NetDevice{
+		Type:       TAP,
+		ID:         "tap0",
+		VHost:      true,
+		VHostForce: true,
+		Tap: NetDeviceTap{
+			IFName: "ceth0",
+		},
+	}
+
+	params := netdev.QemuNetdevParams(&Config{})
+	expected := "tap,id=tap0,vhost=on,vhostforce=on,ifname=ceth0"
+	if p := strings.Join(params, ","); p != expected {
+		t.Errorf("Expected %s, found %s", expected, p)
+	}
+}
+
+func TestBadNetDeviceVHost(t *testing.T) {
+	netdevs := []NetDevice{
+		{ID: "user0", Type: USER, User: NetDeviceUser{IPV4: true}, VHost: true},
+		{ID: "sock0", Type: MCASTSOCKET, McastSocket: NetDeviceMcastSocket{Address: "230.0.0.1", Port: "1234"}, VHost: true},
+		{ID: "tap0", Type: TAP, Tap: NetDeviceTap{IFName: "ceth0"}, VHostForce: true},
+		{ID: "tap0", Type: TAP, Tap: NetDeviceTap{IFName: "ceth0"}, VHostQemuOpen: true},
+		{ID: "tap0", Type: TAP, Tap: NetDeviceTap{IFName: "ceth0"}, VHost: true, VHostQemuOpen: true, VhostFDs: []*os.File{os.Stdin}},
+	}
+
+	for _, netdev := range netdevs {
+		if err := netdev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid NetDevice %+v", netdev)
+		}
+	}
+}
+
+func TestBadNetDeviceQueues(t *testing.T) {
+	tap := NetDeviceTap{IFName: "ceth0"}
+	netdevs := []NetDevice{
+		{ID: "tap0", Type: TAP, Tap: tap, Queues: -1},
+		{ID: "user0", Type: USER, User: NetDeviceUser{IPV4: true}, Queues: 2},
+		{ID: "tap0", Type: TAP, Tap: tap, Queues: 4, FDs: []*os.File{os.Stdin, os.Stdout}},
+		{ID: "tap0", Type: TAP, Tap: tap, Queues: 2, VhostFDs: []*os.File{os.Stdin, os.Stdout}},
+		{ID: "tap0", Type: TAP, Tap: tap, Queues: 2, VHost: true, VhostFDs: []*os.File{os.Stdin}},
+		{ID: "vdpa0", Type: VHOSTVDPA, Queues: 2, VhostVDPA: NetDeviceVhostVDPA{VhostDev: "/dev/vhost-vdpa-0", Queues: 4}},
+	}
+
+	for _, netdev := range netdevs {
+		if err := netdev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid NetDevice %+v", netdev)
+		}
+	}
+
+	valid := NetDevice{ID: "tap0", Type: TAP, Tap: tap, Queues: 2, VHost: true, VhostFDs: []*os.File{os.Stdin, os.Stdout}}
+	if err := valid.Valid(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
 func TestAppendDeviceNetworkPCI(t *testing.T) {
 
 	netdev := NetDevice{
@@ -141,7 +308,7 @@ func TestAppendDeviceNetworkPCI(t *testing.T) {
 		Bus:           "/pci-bus/pcie.0",
 		Addr:          "255",
 		VHost:         true,
-		MACAddress:    "01:02:de:ad:be:ef",
+		MACAddress:    "52:54:00:12:34:56",
 		DisableModern: true,
 		ROMFile:       romfile,
 		Tap: NetDeviceTap{
@@ -167,7 +334,7 @@ func TestAppendDeviceNetworkPCILowAddr(t *testing.T) {
 		Bus:           "/pci-bus/pcie.0",
 		Addr:          "3",
 		VHost:         true,
-		MACAddress:    "01:02:de:ad:be:ef",
+		MACAddress:    "52:54:00:12:34:56",
 		DisableModern: true,
 		ROMFile:       romfile,
 		Tap: NetDeviceTap{
@@ -203,7 +370,7 @@ func TestAppendDeviceNetworkPCIMq(t *testing.T) {
 		Addr:          "255",
 		FDs:           []*os.File{foo, bar},
 		VHost:         true,
-		MACAddress:    "01:02:de:ad:be:ef",
+		MACAddress:    "52:54:00:12:34:56",
 		DisableModern: true,
 		ROMFile:       romfile,
 		Tap: NetDeviceTap{
@@ -219,3 +386,142 @@ func TestAppendDeviceNetworkPCIMq(t *testing.T) {
 
 	testAppend(netdev, deviceNetworkPCIStringMq, t)
 }
+
+func TestParsePortRule(t *testing.T) {
+	testCases := []struct {
+		rule     string
+		expected PortRule
+	}{
+		{"tcp:0.0.0.0:2222-:22", PortRule{Protocol: "tcp", Host: Port{Address: "0.0.0.0", Port: 2222}, Guest: Port{Port: 22}}},
+		{"udp::5353-10.0.2.15:53", PortRule{Protocol: "udp", Host: Port{Port: 5353}, Guest: Port{Address: "10.0.2.15", Port: 53}}},
+		{"8080-:80", PortRule{Protocol: "tcp", Host: Port{Port: 8080}, Guest: Port{Port: 80}}},
+		{"tcp:[::1]:2222-[fd00::15]:22", PortRule{Protocol: "tcp", Host: Port{Address: "::1", Port: 2222}, Guest: Port{Address: "fd00::15", Port: 22}}},
+	}
+
+	for _, tc := range testCases {
+		rule, err := ParsePortRule(tc.rule)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %q: %s", tc.rule, err)
+		}
+		if rule != tc.expected {
+			t.Fatalf("Expected %+v parsing %q, got %+v", tc.expected, tc.rule, rule)
+		}
+	}
+
+	bad := []string{
+		"",
+		"tcp::2222",
+		"tcp::2222-:",
+		"tcp::2222-:0",
+		"tcp::port-:22",
+		"tcp::2222-:70000",
+		"tcp:::1:2222-:22",
+		"tcp:[::1:2222-:22",
+	}
+
+	for _, rule := range bad {
+		if _, err := ParsePortRule(rule); err == nil {
+			t.Errorf("Expected error parsing %q", rule)
+		}
+	}
+}
+
+func TestUnmarshalPortRule(t *testing.T) {
+	content := []byte(`
+config:
+  net-devices:
+    - id: user0
+      type: user
+      user-device:
+        host-port-rules:
+          - tcp::22222-:22
+          - protocol: udp
+            host-port:
+              port: 5353
+            guest-port:
+              port: 53
+`)
+
+	var container VMConfigContainer
+	if err := yaml.Unmarshal(content, &container); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	rules := container.VMConfig.NetDevices[0].User.HostForward
+	expected := []PortRule{
+		{Protocol: "tcp", Host: Port{Port: 22222}, Guest: Port{Port: 22}},
+		{Protocol: "udp", Host: Port{Port: 5353}, Guest: Port{Port: 53}},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, rules)
+	}
+
+	bad := []byte(`
+- tcp::22222
+`)
+	var badRules []PortRule
+	if err := yaml.Unmarshal(bad, &badRules); err == nil {
+		t.Fatalf("Expected error unmarshaling invalid PortRule")
+	}
+
+	bad = []byte(`
+- protocol: sctp
+  host-port:
+    port: 2222
+  guest-port:
+    port: 22
+`)
+	if err := yaml.Unmarshal(bad, &badRules); err == nil {
+		t.Fatalf("Expected error unmarshaling PortRule with unknown protocol")
+	}
+
+	netdev := NetDevice{Type: USER, ID: "user0", User: NetDeviceUser{IPV4: true}}
+	netdev.User.HostForward = []PortRule{{Protocol: "TCP", Host: Port{Port: 2222}, Guest: Port{Port: 22}}}
+	if err := netdev.Valid(); err == nil {
+		t.Errorf("Expected error for PortRule with unknown protocol")
+	}
+}
+
+func TestBadNetDeviceTransport(t *testing.T) {
+	netdevs := []NetDevice{
+		{ID: "vfio0", Type: VFIO, Transport: TransportMMIO},
+		{ID: "vhost0", Type: VHOSTUSER, Transport: TransportCCW},
+	}
+
+	for _, netdev := range netdevs {
+		if err := netdev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid NetDevice %+v", netdev)
+		}
+		if p := netdev.Type.QemuNetdevParam(&netdev, nil); p != "" {
+			t.Errorf("Expected empty netdev param for %+v, found %s", netdev, p)
+		}
+		if p := netdev.Type.QemuDeviceParam(&netdev, nil); p != "" {
+			t.Errorf("Expected empty device param for %+v, found %s", netdev, p)
+		}
+	}
+}
+
+func TestNetDeviceMACAddress(t *testing.T) {
+	netdev := NetDevice{Type: USER, ID: "user0", User: NetDeviceUser{IPV4: true}}
+
+	for _, mac := range []string{"52:54:00:12:34:56", "02-00-00-00-00-01", "5254.0012.3456"} {
+		netdev.MACAddress = mac
+		if err := netdev.Valid(); err != nil {
+			t.Errorf("Unexpected error for MAC address %s: %s", mac, err)
+		}
+	}
+
+	for _, mac := range []string{
+		"52:54:00:12:34",
+		"52:54:00:12:34:zz",
+		"52:54:00:12:34:56:78:9a",
+		"01:02:de:ad:be:ef",
+		"ff:ff:ff:ff:ff:ff",
+		"00:00:00:00:00:00",
+	} {
+		netdev.MACAddress = mac
+		if err := netdev.Valid(); err == nil {
+			t.Errorf("Expected error for MAC address %s", mac)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NetFilterType is the qemu netfilter object type.
+type NetFilterType string
+
+const (
+	// FilterBuffer holds packets and releases them every Interval
+	// microseconds, it can be used to pace a netdev's traffic.
+	FilterBuffer NetFilterType = "filter-buffer"
+
+	// FilterDump dumps the netdev traffic to a pcap File.
+	FilterDump NetFilterType = "filter-dump"
+
+	// FilterMirror mirrors the netdev traffic to the OutDev chardev.
+	FilterMirror NetFilterType = "filter-mirror"
+
+	// FilterRedirector redirects the netdev traffic from InDev and to OutDev.
+	FilterRedirector NetFilterType = "filter-redirector"
+
+	// FilterRewriter rewrites tcp packet sequence numbers for COLO.
+	FilterRewriter NetFilterType = "filter-rewriter"
+)
+
+// NetFilterQueue selects which direction of netdev traffic is filtered.
+type NetFilterQueue string
+
+const (
+	// NetFilterQueueAll filters both directions
+	NetFilterQueueAll NetFilterQueue = "all"
+
+	// NetFilterQueueRX filters packets received by the netdev
+	NetFilterQueueRX NetFilterQueue = "rx"
+
+	// NetFilterQueueTX filters packets transmitted by the netdev
+	NetFilterQueueTX NetFilterQueue = "tx"
+)
+
+// NetFilter represents a qemu netfilter object attached to a netdev.
+type NetFilter struct {
+	// Type is the filter object type
+	Type NetFilterType `yaml:"type"`
+
+	// ID is the filter object id
+	ID string `yaml:"id"`
+
+	// Queue is the traffic direction to filter, qemu defaults to all
+	Queue NetFilterQueue `yaml:"queue"`
+
+	// Interval is the filter-buffer release interval in microseconds
+	Interval uint64 `yaml:"interval"`
+
+	// File is the filter-dump pcap output file
+	File string `yaml:"file"`
+
+	// MaxLen is the filter-dump maximum captured packet length
+	MaxLen uint64 `yaml:"max-len"`
+
+	// InDev is the filter-redirector input chardev id
+	InDev string `yaml:"indev"`
+
+	// OutDev is the filter-mirror and filter-redirector output chardev id
+	OutDev string `yaml:"outdev"`
+
+	// Disabled creates the filter with status=off
+	Disabled bool `yaml:"disabled"`
+}
+
+// Valid returns an error if the NetFilter structure is not valid and complete.
+func (f NetFilter) Valid() error {
+	if f.ID == "" {
+		return fmt.Errorf("NetFilter has empty ID field")
+	}
+
+	switch f.Queue {
+	case "", NetFilterQueueAll, NetFilterQueueRX, NetFilterQueueTX:
+	default:
+		return fmt.Errorf("NetFilter ID=%s has invalid Queue field: %s", f.ID, f.Queue)
+	}
+
+	switch f.Type {
+	case FilterBuffer:
+		if f.Interval == 0 {
+			return fmt.Errorf("NetFilter ID=%s Type=%s requires Interval", f.ID, f.Type)
+		}
+	case FilterDump:
+		if f.File == "" {
+			return fmt.Errorf("NetFilter ID=%s Type=%s requires File", f.ID, f.Type)
+		}
+	case FilterMirror:
+		if f.OutDev == "" {
+			return fmt.Errorf("NetFilter ID=%s Type=%s requires OutDev", f.ID, f.Type)
+		}
+	case FilterRedirector:
+		if f.InDev == "" && f.OutDev == "" {
+			return fmt.Errorf("NetFilter ID=%s Type=%s requires InDev or OutDev", f.ID, f.Type)
+		}
+	case FilterRewriter:
+	case "":
+		return fmt.Errorf("NetFilter ID=%s has empty Type field", f.ID)
+	default:
+		return fmt.Errorf("NetFilter ID=%s has invalid Type field: %s", f.ID, f.Type)
+	}
+
+	return nil
+}
+
+// QemuParams returns the -object parameters attaching this filter to the
+// netdev with the given id.
+func (f NetFilter) QemuParams(netdevID string) []string {
+	var objectParams []string
+
+	objectParams = append(objectParams, string(f.Type))
+	objectParams = append(objectParams, fmt.Sprintf("id=%s", f.ID))
+	objectParams = append(objectParams, fmt.Sprintf("netdev=%s", netdevID))
+
+	if f.Queue != "" {
+		objectParams = append(objectParams, fmt.Sprintf("queue=%s", f.Queue))
+	}
+
+	if f.Interval > 0 {
+		objectParams = append(objectParams, fmt.Sprintf("interval=%d", f.Interval))
+	}
+
+	if f.File != "" {
+		objectParams = append(objectParams, fmt.Sprintf("file=%s", f.File))
+	}
+
+	if f.MaxLen > 0 {
+		objectParams = append(objectParams, fmt.Sprintf("maxlen=%d", f.MaxLen))
+	}
+
+	if f.InDev != "" {
+		objectParams = append(objectParams, fmt.Sprintf("indev=%s", f.InDev))
+	}
+
+	if f.OutDev != "" {
+		objectParams = append(objectParams, fmt.Sprintf("outdev=%s", f.OutDev))
+	}
+
+	if f.Disabled {
+		objectParams = append(objectParams, "status=off")
+	}
+
+	return []string{"-object", strings.Join(objectParams, ",")}
+}
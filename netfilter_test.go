@@ -0,0 +1,55 @@
+package qcli
+
+import "testing"
+
+var (
+	deviceNetworkFilterBufferString = "-netdev user,id=user0,ipv4=on -device e1000,netdev=user0,mac=52:54:00:12:34:56 -object filter-buffer,id=f0,netdev=user0,queue=tx,interval=1000 -object filter-dump,id=f1,netdev=user0,file=/tmp/user0.pcap,maxlen=128,status=off"
+)
+
+func TestAppendNetFilters(t *testing.T) {
+	netdev := NetDevice{
+		Driver:     E1000,
+		Type:       USER,
+		ID:         "user0",
+		MACAddress: "52:54:00:12:34:56",
+		User: NetDeviceUser{
+			IPV4: true,
+		},
+		Filters: []NetFilter{
+			{
+				Type:     FilterBuffer,
+				ID:       "f0",
+				Queue:    NetFilterQueueTX,
+				Interval: 1000,
+			},
+			{
+				Type:     FilterDump,
+				ID:       "f1",
+				File:     "/tmp/user0.pcap",
+				MaxLen:   128,
+				Disabled: true,
+			},
+		},
+	}
+
+	testAppend(netdev, deviceNetworkFilterBufferString, t)
+}
+
+func TestBadNetFilters(t *testing.T) {
+	bad := []NetFilter{
+		{Type: FilterBuffer},
+		{ID: "f0"},
+		{ID: "f0", Type: NetFilterType("filter-drop")},
+		{ID: "f0", Type: FilterBuffer},
+		{ID: "f0", Type: FilterDump},
+		{ID: "f0", Type: FilterMirror},
+		{ID: "f0", Type: FilterRedirector},
+		{ID: "f0", Type: FilterRewriter, Queue: NetFilterQueue("both")},
+	}
+
+	for _, f := range bad {
+		if err := f.Valid(); err == nil {
+			t.Errorf("Expected error for invalid NetFilter %+v", f)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// NetSocketAddressType is the type of a stream or dgram netdev address.
+type NetSocketAddressType string
+
+const (
+	// NetSocketInet is an IPv4 or IPv6 address and port
+	NetSocketInet NetSocketAddressType = "inet"
+
+	// NetSocketUnix is a unix socket path
+	NetSocketUnix NetSocketAddressType = "unix"
+
+	// NetSocketFD is an already open socket
+	NetSocketFD NetSocketAddressType = "fd"
+)
+
+// NetSocketAddress is an address of a STREAM or DGRAM NetDevice.
+type NetSocketAddress struct {
+	// Type is the address type, the address is unset when empty
+	Type NetSocketAddressType `yaml:"type"`
+
+	// Host and Port are the NetSocketInet address
+	Host string `yaml:"host"`
+	Port string `yaml:"port"`
+
+	// Path is the NetSocketUnix socket path
+	Path string `yaml:"path"`
+
+	// FD is the NetSocketFD socket
+	FD *os.File `yaml:"-"`
+}
+
+// valid returns an error if the address is not complete, name is the
+// address field name used in the error.
+func (addr NetSocketAddress) valid(name string) error {
+	switch addr.Type {
+	case NetSocketInet:
+		if addr.Host == "" || addr.Port == "" {
+			return fmt.Errorf("%s Type=inet requires Host and Port", name)
+		}
+	case NetSocketUnix:
+		if addr.Path == "" {
+			return fmt.Errorf("%s Type=unix has empty Path field", name)
+		}
+	case NetSocketFD:
+		if addr.FD == nil {
+			return fmt.Errorf("%s Type=fd has empty FD field", name)
+		}
+	default:
+		return fmt.Errorf("Invalid %s Type value: '%s', must be one of '%s', '%s', '%s'",
+			name, addr.Type, NetSocketInet, NetSocketUnix, NetSocketFD)
+	}
+
+	return nil
+}
+
+// qemuParams returns the netdev parameters of the address, prefixed by
+// the netdev option name, e.g. addr.type=unix,addr.path=<path>
+func (addr NetSocketAddress) qemuParams(prefix string, config *Config) []string {
+	params := []string{fmt.Sprintf("%s.type=%s", prefix, addr.Type)}
+
+	switch addr.Type {
+	case NetSocketInet:
+		params = append(params, fmt.Sprintf("%s.host=%s", prefix, addr.Host))
+		params = append(params, fmt.Sprintf("%s.port=%s", prefix, addr.Port))
+	case NetSocketUnix:
+		params = append(params, fmt.Sprintf("%s.path=%s", prefix, addr.Path))
+	case NetSocketFD:
+		qemuFDs := config.appendFDs([]*os.File{addr.FD})
+		params = append(params, fmt.Sprintf("%s.str=%d", prefix, qemuFDs[0]))
+	}
+
+	return params
+}
+
+// -netdev stream,
+type NetDeviceStream struct {
+	// Server listens on Addr instead of connecting to it
+	Server bool `yaml:"server"`
+
+	// Addr is the address to listen on or connect to
+	Addr NetSocketAddress `yaml:"addr"`
+
+	// Reconnect is the delay in seconds before reconnecting a client
+	// whose connection was lost, qemu does not reconnect when 0
+	Reconnect uint32 `yaml:"reconnect"`
+}
+
+// valid returns an error if the stream netdev is not usable.
+func (stream NetDeviceStream) valid() error {
+	if err := stream.Addr.valid("Netdevice Type=STREAM Addr"); err != nil {
+		return err
+	}
+	if stream.Server && stream.Reconnect > 0 {
+		return fmt.Errorf("Netdevice Type=STREAM Reconnect is only supported by clients")
+	}
+
+	return nil
+}
+
+func (stream NetDeviceStream) qemuParams(config *Config) []string {
+	var params []string
+
+	if stream.Server {
+		params = append(params, "server=on")
+	} else {
+		params = append(params, "server=off")
+	}
+	params = append(params, stream.Addr.qemuParams("addr", config)...)
+	if stream.Reconnect > 0 {
+		params = append(params, fmt.Sprintf("reconnect=%d", stream.Reconnect))
+	}
+
+	return params
+}
+
+// -netdev dgram,
+type NetDeviceDgram struct {
+	// Local is the address packets are received on
+	Local NetSocketAddress `yaml:"local"`
+
+	// Remote is the address packets are sent to, an inet multicast
+	// group is joined
+	Remote NetSocketAddress `yaml:"remote"`
+}
+
+// valid returns an error if the dgram netdev is not usable, qemu requires
+// a Local address unless Remote is a multicast group.
+func (dgram NetDeviceDgram) valid() error {
+	if dgram.Local.Type != "" {
+		if err := dgram.Local.valid("Netdevice Type=DGRAM Local"); err != nil {
+			return err
+		}
+	}
+
+	if dgram.Remote.Type != "" {
+		if err := dgram.Remote.valid("Netdevice Type=DGRAM Remote"); err != nil {
+			return err
+		}
+		if dgram.Remote.Type == NetSocketFD {
+			return fmt.Errorf("Netdevice Type=DGRAM Remote can not be an fd")
+		}
+		if dgram.Local.Type != "" && dgram.Local.Type != NetSocketFD && dgram.Local.Type != dgram.Remote.Type {
+			return fmt.Errorf("Netdevice Type=DGRAM Local and Remote must have the same Type")
+		}
+	}
+
+	if dgram.Local.Type == "" {
+		multicast := false
+		if dgram.Remote.Type == NetSocketInet {
+			ip := net.ParseIP(dgram.Remote.Host)
+			multicast = ip != nil && ip.IsMulticast()
+		}
+		if !multicast {
+			return fmt.Errorf("Netdevice Type=DGRAM requires a Local address unless Remote is a multicast group")
+		}
+	}
+
+	return nil
+}
+
+func (dgram NetDeviceDgram) qemuParams(config *Config) []string {
+	var params []string
+
+	if dgram.Remote.Type != "" {
+		params = append(params, dgram.Remote.qemuParams("remote", config)...)
+	}
+	if dgram.Local.Type != "" {
+		params = append(params, dgram.Local.qemuParams("local", config)...)
+	}
+
+	return params
+}
+
+// validateNetSockets checks the qemu version supports the STREAM and
+// DGRAM NetDevices.
+func (config *Config) validateNetSockets() error {
+	for _, netdev := range config.NetDevices {
+		if netdev.Type != STREAM && netdev.Type != DGRAM {
+			continue
+		}
+		if config.Version.Before(7, 2) {
+			return fmt.Errorf("NetDevice ID=%s Type=%s requires qemu 7.2, found %s", netdev.ID, netdev.Type, config.Version)
+		}
+	}
+
+	return nil
+}
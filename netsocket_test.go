@@ -0,0 +1,113 @@
+package qcli
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAppendDeviceNetworkStream(t *testing.T) {
+	netdev := NetDevice{
+		Driver:     VirtioNet,
+		Type:       STREAM,
+		ID:         "link0",
+		MACAddress: "52:54:00:12:34:56",
+		Stream: NetDeviceStream{
+			Server: true,
+			Addr: NetSocketAddress{
+				Type: NetSocketUnix,
+				Path: "/run/vm1/link0.sock",
+			},
+		},
+	}
+	if netdev.Transport.isVirtioCCW(nil) {
+		t.Skip("expected strings are for the pci transport")
+	}
+
+	c := &Config{NetDevices: []NetDevice{netdev}}
+	testConfig(c, "-netdev stream,id=link0,server=on,addr.type=unix,addr.path=/run/vm1/link0.sock -device virtio-net-pci,netdev=link0,mac=52:54:00:12:34:56,disable-modern=false", t)
+
+	netdev.Stream = NetDeviceStream{
+		Addr: NetSocketAddress{
+			Type: NetSocketInet,
+			Host: "127.0.0.1",
+			Port: "1234",
+		},
+		Reconnect: 5,
+	}
+	c = &Config{NetDevices: []NetDevice{netdev}}
+	testConfig(c, "-netdev stream,id=link0,server=off,addr.type=inet,addr.host=127.0.0.1,addr.port=1234,reconnect=5 -device virtio-net-pci,netdev=link0,mac=52:54:00:12:34:56,disable-modern=false", t)
+
+	netdev.Stream = NetDeviceStream{
+		Addr: NetSocketAddress{
+			Type: NetSocketFD,
+			FD:   os.Stdin,
+		},
+	}
+	c = &Config{NetDevices: []NetDevice{netdev}}
+	testConfig(c, "-netdev stream,id=link0,server=off,addr.type=fd,addr.str=3 -device virtio-net-pci,netdev=link0,mac=52:54:00:12:34:56,disable-modern=false", t)
+}
+
+func TestAppendDeviceNetworkDgram(t *testing.T) {
+	netdev := NetDevice{
+		Driver:     VirtioNet,
+		Type:       DGRAM,
+		ID:         "link0",
+		MACAddress: "52:54:00:12:34:56",
+		Dgram: NetDeviceDgram{
+			Local: NetSocketAddress{
+				Type: NetSocketUnix,
+				Path: "/run/vm1/link0.sock",
+			},
+			Remote: NetSocketAddress{
+				Type: NetSocketUnix,
+				Path: "/run/vm2/link0.sock",
+			},
+		},
+	}
+	if netdev.Transport.isVirtioCCW(nil) {
+		t.Skip("expected strings are for the pci transport")
+	}
+
+	c := &Config{NetDevices: []NetDevice{netdev}}
+	testConfig(c, "-netdev dgram,id=link0,remote.type=unix,remote.path=/run/vm2/link0.sock,local.type=unix,local.path=/run/vm1/link0.sock -device virtio-net-pci,netdev=link0,mac=52:54:00:12:34:56,disable-modern=false", t)
+
+	netdev.Dgram = NetDeviceDgram{
+		Remote: NetSocketAddress{
+			Type: NetSocketInet,
+			Host: "230.0.0.1",
+			Port: "1234",
+		},
+	}
+	c = &Config{NetDevices: []NetDevice{netdev}}
+	testConfig(c, "-netdev dgram,id=link0,remote.type=inet,remote.host=230.0.0.1,remote.port=1234 -device virtio-net-pci,netdev=link0,mac=52:54:00:12:34:56,disable-modern=false", t)
+}
+
+func TestBadNetDeviceSockets(t *testing.T) {
+	unix := NetSocketAddress{Type: NetSocketUnix, Path: "/run/vm1/link0.sock"}
+	netdevs := []NetDevice{
+		{ID: "link0", Type: STREAM},
+		{ID: "link0", Type: STREAM, Stream: NetDeviceStream{Addr: NetSocketAddress{Type: NetSocketUnix}}},
+		{ID: "link0", Type: STREAM, Stream: NetDeviceStream{Addr: NetSocketAddress{Type: NetSocketInet, Host: "::1"}}},
+		{ID: "link0", Type: STREAM, Stream: NetDeviceStream{Addr: NetSocketAddress{Type: NetSocketFD}}},
+		{ID: "link0", Type: STREAM, Stream: NetDeviceStream{Addr: unix, Server: true, Reconnect: 1}},
+		{ID: "link0", Type: DGRAM},
+		{ID: "link0", Type: DGRAM, Dgram: NetDeviceDgram{Remote: unix}},
+		{ID: "link0", Type: DGRAM, Dgram: NetDeviceDgram{Remote: NetSocketAddress{Type: NetSocketInet, Host: "10.0.0.1", Port: "1234"}}},
+		{ID: "link0", Type: DGRAM, Dgram: NetDeviceDgram{Local: unix, Remote: NetSocketAddress{Type: NetSocketFD, FD: os.Stdin}}},
+		{ID: "link0", Type: DGRAM, Dgram: NetDeviceDgram{Local: unix, Remote: NetSocketAddress{Type: NetSocketInet, Host: "10.0.0.1", Port: "1234"}}},
+	}
+
+	for _, netdev := range netdevs {
+		if err := netdev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid NetDevice %+v", netdev)
+		}
+	}
+
+	c := &Config{
+		Version:    Version{Major: 7, Minor: 1},
+		NetDevices: []NetDevice{{ID: "link0", Type: STREAM, Driver: VirtioNet, Stream: NetDeviceStream{Addr: unix}}},
+	}
+	if _, err := ConfigureParams(c, nil); err == nil {
+		t.Errorf("Expected error for a STREAM NetDevice with qemu 7.1")
+	}
+}
@@ -112,7 +112,6 @@ func (object Object) Valid() bool {
 	case PEFGuest:
 		return object.ID != "" && object.File != ""
 	case LegacyMemPath:
-		panic("LegacyMemPath")
 		return object.MemPath != ""
 
 	default:
@@ -44,8 +44,8 @@ const PCISlotOffset = 3
 type PCIBus [PCISlotMax]bool
 
 func (bus *PCIBus) SetSlot(slot int) error {
-	if slot > PCISlotMax {
-		return fmt.Errorf("Slot %d must be < %d", slot, PCISlotMax)
+	if slot < 0 || slot >= PCISlotMax {
+		return fmt.Errorf("Slot %d must be >= 0 and < %d", slot, PCISlotMax)
 	}
 	bus[slot] = true
 	log.Debugf("PCIBus: allocated slot %s", fmt.Sprintf("0x%02x", slot))
@@ -56,7 +56,7 @@ func (bus *PCIBus) GetSlot(busAddr string) int {
 	// see if supplised busAddr string is set, if so use that
 	if busAddr != "" {
 		slot, _ := parseBusAddrString(busAddr)
-		if slot > 0 {
+		if slot > 0 && slot < PCISlotMax {
 			status := bus[slot]
 			if !status {
 				if err := bus.SetSlot(slot); err != nil {
@@ -104,6 +104,91 @@ func parseBusAddrString(addr string) (int, error) {
 	return addrInt, nil
 }
 
+// parsePCIAddr parses a pci addr of the form slot[.function], where slot
+// and function are decimal or 0x prefixed hex, and returns the slot and the
+// function, -1 if the addr has none.
+func parsePCIAddr(addr string) (int, int, error) {
+	slotString, functionString, hasFunction := strings.Cut(addr, ".")
+
+	slot, err := parsePCIAddrNumber(slotString)
+	if err != nil || slot < 0 || slot > PCISlotMax {
+		return -1, -1, fmt.Errorf("Invalid PCI addr %q, slot must be 0-%d", addr, PCISlotMax)
+	}
+
+	function := -1
+	if hasFunction {
+		function, err = parsePCIAddrNumber(functionString)
+		if err != nil || function < 0 || function > 7 {
+			return -1, -1, fmt.Errorf("Invalid PCI addr %q, function must be 0-7", addr)
+		}
+	}
+
+	return slot, function, nil
+}
+
+func parsePCIAddrNumber(val string) (int, error) {
+	if strings.HasPrefix(val, "0x") || strings.HasPrefix(val, "0X") {
+		n, err := strconv.ParseInt(val[2:], 16, 32)
+		return int(n), err
+	}
+	return strconv.Atoi(val)
+}
+
+// pciAddrParam returns the qemu addr property value, always hex, of a slot
+// and function parsed by parsePCIAddr.
+func pciAddrParam(slot, function int) string {
+	if function < 0 {
+		return fmt.Sprintf("0x%02x", slot)
+	}
+	return fmt.Sprintf("0x%x.0x%x", slot, function)
+}
+
+// isRootPCIBus returns true if bus is the root pci bus whose slots are
+// tracked by Config.pciBusSlots.
+func isRootPCIBus(bus string) bool {
+	return bus == "" || bus == "pcie.0" || bus == "pci.0"
+}
+
+// reservePCISlots reserves the root bus slot of the devices with an
+// explicit Addr given as is to qemu, before any slot is auto-allocated, so
+// that auto-allocated slots can not collide with them.
+func (config *Config) reservePCISlots() error {
+	var errors []string
+
+	for _, d := range config.devices {
+		var bus, addr string
+		switch dev := d.(type) {
+		case RawDevice:
+			bus, addr = dev.Bus, dev.Addr
+		case VFIODevice:
+			if !dev.Transport.isVirtioPCI(config) {
+				continue
+			}
+			bus, addr = dev.Bus, dev.Addr
+		default:
+			continue
+		}
+		if addr == "" || !isRootPCIBus(bus) {
+			continue
+		}
+
+		slot, _, err := parsePCIAddr(addr)
+		if err != nil {
+			errors = append(errors, err.Error())
+			continue
+		}
+		if slot < PCISlotMax {
+			config.pciBusSlots[slot] = true
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Failed to reserve %d PCI slots: %s", len(errors), strings.Join(errors, ", "))
+	}
+
+	return nil
+}
+
 // PCIeRootPortDevice represents a memory balloon device.
 type PCIeRootPortDevice struct {
 	ID string `yaml:"id"` // format: rp{n}, n>=0
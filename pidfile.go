@@ -0,0 +1,128 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errProcessUnsupported is returned when the command line or the statistics
+// of a process cannot be read on this platform
+var errProcessUnsupported = errors.New("reading process information is not supported")
+
+// ReadPidFile returns the process ID written by qemu to the -pidfile path.
+func ReadPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("Invalid pid file %s: %q", path, strings.TrimSpace(string(data)))
+	}
+	return pid, nil
+}
+
+// MatchesCmdline returns true if cmdline is the command line of a qemu
+// launched from config. The -uuid, or else the -name, or else the -pidfile
+// parameter must match.
+func (config *Config) MatchesCmdline(cmdline []string) bool {
+	flag, value := "-pidfile", config.PidFile
+	if config.UUID != "" {
+		flag, value = "-uuid", config.UUID
+	} else if config.Name != "" {
+		flag, value = "-name", config.Name
+	}
+	if value == "" {
+		return false
+	}
+	for i := 0; i+1 < len(cmdline); i++ {
+		if cmdline[i] == flag && cmdline[i+1] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RunningPid returns the process ID of the qemu instance of config
+// according to its PidFile, or 0 if it is not running. stale is set when
+// the pid file exists but its process is gone or is not this VM.
+func (config *Config) RunningPid() (pid int, stale bool, err error) {
+	if config.PidFile == "" {
+		return 0, false, fmt.Errorf("Config has no PidFile")
+	}
+
+	pid, err = ReadPidFile(config.PidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	cmdline, err := processCmdline(pid)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, true, nil
+		}
+		return 0, false, err
+	}
+	if !config.MatchesCmdline(cmdline) {
+		return 0, true, nil
+	}
+	return pid, false, nil
+}
+
+// CheckPidFile returns an error if the PidFile of config belongs to a
+// running qemu instance of this VM and removes it if it is stale. It does
+// nothing if PidFile is not set or the process cannot be checked on this
+// platform.
+func (config *Config) CheckPidFile() error {
+	if config.PidFile == "" {
+		return nil
+	}
+
+	pid, stale, err := config.RunningPid()
+	if err != nil {
+		if errors.Is(err, errProcessUnsupported) {
+			return nil
+		}
+		return err
+	}
+	if pid != 0 {
+		return fmt.Errorf("VM %s is already running with pid %d according to %s", config.Name, pid, config.PidFile)
+	}
+	if stale {
+		if err := os.Remove(config.PidFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to remove stale pid file %s: %v", config.PidFile, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package qcli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func tempPidFile(t *testing.T, content string) string {
+	dir, err := os.MkdirTemp("", "qcli-pidfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "qemu.pid")
+	if content != "" {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestReadPidFile(t *testing.T) {
+	pid, err := ReadPidFile(tempPidFile(t, "1234\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if pid != 1234 {
+		t.Errorf("Expected pid 1234, found %d", pid)
+	}
+
+	for _, content := range []string{"qemu\n", "-1\n"} {
+		if _, err := ReadPidFile(tempPidFile(t, content)); err == nil {
+			t.Errorf("Expected error for pid file content %q", content)
+		}
+	}
+}
+
+func TestMatchesCmdline(t *testing.T) {
+	cmdline := []string{"qemu-system-x86_64", "-name", "vm1", "-uuid", "a1b2", "-pidfile", "/run/vm1.pid"}
+
+	for _, tc := range []struct {
+		config Config
+		match  bool
+	}{
+		{Config{UUID: "a1b2", Name: "other"}, true},
+		{Config{UUID: "c3d4", Name: "vm1"}, false},
+		{Config{Name: "vm1"}, true},
+		{Config{Name: "vm2"}, false},
+		{Config{PidFile: "/run/vm1.pid"}, true},
+		{Config{}, false},
+	} {
+		if match := tc.config.MatchesCmdline(cmdline); match != tc.match {
+			t.Errorf("Expected match %v for %+v, found %v", tc.match, tc.config, match)
+		}
+	}
+}
+
+func TestCheckPidFile(t *testing.T) {
+	if _, err := os.Stat("/proc/self/cmdline"); err != nil {
+		t.Skip("no /proc on this platform")
+	}
+
+	// a process which already exited leaves a stale pid file
+	done := exec.Command("true")
+	if err := done.Run(); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Name: "vm1", PidFile: tempPidFile(t, fmt.Sprintf("%d\n", done.Process.Pid))}
+	if pid, stale, err := config.RunningPid(); err != nil || pid != 0 || !stale {
+		t.Errorf("Expected a stale pid file, found pid=%d stale=%v err=%v", pid, stale, err)
+	}
+	if err := config.CheckPidFile(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if PathExists(config.PidFile) {
+		t.Errorf("Expected the stale pid file to be removed")
+	}
+
+	// no pid file, not running
+	if pid, stale, err := config.RunningPid(); err != nil || pid != 0 || stale {
+		t.Errorf("Expected no running VM, found pid=%d stale=%v err=%v", pid, stale, err)
+	}
+
+	// a running process with the VM name is this VM
+	running := exec.Command("sh", "-c", "sleep 30; true", "-name", "vm1")
+	if err := running.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		running.Process.Kill()
+		running.Wait()
+	}()
+	if err := os.WriteFile(config.PidFile, []byte(fmt.Sprintf("%d\n", running.Process.Pid)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pid, _, err := config.RunningPid(); err != nil || pid != running.Process.Pid {
+		t.Errorf("Expected running pid %d, found %d (%v)", running.Process.Pid, pid, err)
+	}
+	if err := config.CheckPidFile(); err == nil {
+		t.Errorf("Expected error for a VM already running")
+	}
+	if _, err := LaunchQemu(&config, nil); err == nil {
+		t.Errorf("Expected LaunchQemu to refuse a VM already running")
+	}
+
+	// a running process of another VM makes the pid file stale
+	other := Config{Name: "vm2", PidFile: config.PidFile}
+	if pid, stale, err := other.RunningPid(); err != nil || pid != 0 || !stale {
+		t.Errorf("Expected a stale pid file, found pid=%d stale=%v err=%v", pid, stale, err)
+	}
+}
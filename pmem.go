@@ -0,0 +1,221 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NVDIMMDevice represents an emulated non volatile DIMM backed by a file,
+// exposed to the guest as persistent memory.
+type NVDIMMDevice struct {
+	// ID is the device ID
+	ID string `yaml:"id"`
+
+	// MemDev is the ID of the memory-backend-file object created for the
+	// device
+	MemDev string `yaml:"memdev"`
+
+	// MemPath is the backing file or DAX device of the nvdimm
+	MemPath string `yaml:"mem-path"`
+
+	// Size is the memory backend size, including the label area, e.g. 4G
+	Size string `yaml:"size"`
+
+	// LabelSize is the size of the label storage area carved out of the
+	// end of the backend, at least 128K when set
+	LabelSize string `yaml:"label-size"`
+
+	// Unarmed tells the guest the nvdimm does not persist writes, required
+	// for a read only backend
+	Unarmed bool `yaml:"unarmed"`
+
+	// ReadOnly maps the backing file read only
+	ReadOnly bool `yaml:"readonly"`
+
+	// PMem tells qemu the backing file is real persistent memory so it
+	// guarantees the persistence of writes
+	PMem bool `yaml:"pmem"`
+
+	// Node is the guest NUMA node the memory is assigned to
+	Node *int `yaml:"node"`
+}
+
+// nvdimmMinLabelSize is the smallest label area qemu accepts.
+const nvdimmMinLabelSize = 128 << 10
+
+// Valid returns an error if the NVDIMMDevice structure is not valid and
+// complete.
+func (nvdimm NVDIMMDevice) Valid() error {
+	if nvdimm.ID == "" {
+		return fmt.Errorf("NVDIMMDevice has empty ID field")
+	}
+
+	if nvdimm.MemDev == "" {
+		return fmt.Errorf("NVDIMMDevice ID=%s has empty MemDev field", nvdimm.ID)
+	}
+
+	if nvdimm.MemPath == "" {
+		return fmt.Errorf("NVDIMMDevice ID=%s has empty MemPath field", nvdimm.ID)
+	}
+
+	size, err := ParseMemorySize(nvdimm.Size)
+	if err != nil {
+		return fmt.Errorf("NVDIMMDevice ID=%s invalid Size: %v", nvdimm.ID, err)
+	}
+
+	if nvdimm.LabelSize != "" {
+		label, err := ParseMemorySize(nvdimm.LabelSize)
+		if err != nil {
+			return fmt.Errorf("NVDIMMDevice ID=%s invalid LabelSize: %v", nvdimm.ID, err)
+		}
+		if label < nvdimmMinLabelSize || label >= size {
+			return fmt.Errorf("NVDIMMDevice ID=%s LabelSize %s must be at least 128K and smaller than Size %s", nvdimm.ID, nvdimm.LabelSize, nvdimm.Size)
+		}
+	}
+
+	if nvdimm.ReadOnly && !nvdimm.Unarmed {
+		return fmt.Errorf("NVDIMMDevice ID=%s ReadOnly requires Unarmed", nvdimm.ID)
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the NVDIMMDevice.
+func (nvdimm NVDIMMDevice) QemuParams(config *Config) []string {
+	var objectParams []string
+	var deviceParams []string
+	var qemuParams []string
+
+	objectParams = append(objectParams, string(MemoryBackendFile))
+	objectParams = append(objectParams, fmt.Sprintf("id=%s", nvdimm.MemDev))
+	objectParams = append(objectParams, fmt.Sprintf("size=%s", nvdimm.Size))
+	objectParams = append(objectParams, fmt.Sprintf("mem-path=%s", nvdimm.MemPath))
+	objectParams = append(objectParams, "share=on")
+	if nvdimm.ReadOnly {
+		objectParams = append(objectParams, "readonly=on")
+	}
+	if nvdimm.PMem {
+		objectParams = append(objectParams, "pmem=on")
+	}
+
+	deviceParams = append(deviceParams, string(NVDIMM))
+	deviceParams = append(deviceParams, fmt.Sprintf("id=%s", nvdimm.ID))
+	deviceParams = append(deviceParams, fmt.Sprintf("memdev=%s", nvdimm.MemDev))
+	if nvdimm.LabelSize != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("label-size=%s", nvdimm.LabelSize))
+	}
+	if nvdimm.Unarmed {
+		deviceParams = append(deviceParams, "unarmed=on")
+	}
+	if nvdimm.Node != nil {
+		deviceParams = append(deviceParams, fmt.Sprintf("node=%d", *nvdimm.Node))
+	}
+
+	qemuParams = append(qemuParams, "-object")
+	qemuParams = append(qemuParams, strings.Join(objectParams, ","))
+	qemuParams = append(qemuParams, "-device")
+	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+
+	return qemuParams
+}
+
+// VirtioPmemDevice represents a virtio-pmem device, a paravirtualized
+// persistent memory region backed by a host file.
+type VirtioPmemDevice struct {
+	// ID is the device ID
+	ID string `yaml:"id"`
+
+	// MemDev is the ID of the memory-backend-file object created for the
+	// device
+	MemDev string `yaml:"memdev"`
+
+	// MemPath is the backing file of the device
+	MemPath string `yaml:"mem-path"`
+
+	// Size is the memory backend size, e.g. 4G
+	Size string `yaml:"size"`
+
+	// Bus is the bus path name of the device
+	Bus string `yaml:"bus"`
+
+	// Addr is the PCI address of the device
+	Addr string `yaml:"address"`
+}
+
+// Valid returns an error if the VirtioPmemDevice structure is not valid
+// and complete.
+func (pmem VirtioPmemDevice) Valid() error {
+	if pmem.ID == "" {
+		return fmt.Errorf("VirtioPmemDevice has empty ID field")
+	}
+
+	if pmem.MemDev == "" {
+		return fmt.Errorf("VirtioPmemDevice ID=%s has empty MemDev field", pmem.ID)
+	}
+
+	if pmem.MemPath == "" {
+		return fmt.Errorf("VirtioPmemDevice ID=%s has empty MemPath field", pmem.ID)
+	}
+
+	if _, err := ParseMemorySize(pmem.Size); err != nil {
+		return fmt.Errorf("VirtioPmemDevice ID=%s invalid Size: %v", pmem.ID, err)
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the
+// VirtioPmemDevice.
+func (pmem VirtioPmemDevice) QemuParams(config *Config) []string {
+	var objectParams []string
+	var deviceParams []string
+	var qemuParams []string
+
+	objectParams = append(objectParams, string(MemoryBackendFile))
+	objectParams = append(objectParams, fmt.Sprintf("id=%s", pmem.MemDev))
+	objectParams = append(objectParams, fmt.Sprintf("size=%s", pmem.Size))
+	objectParams = append(objectParams, fmt.Sprintf("mem-path=%s", pmem.MemPath))
+	objectParams = append(objectParams, "share=on")
+
+	deviceParams = append(deviceParams, string(VirtioPmemPCI))
+	deviceParams = append(deviceParams, fmt.Sprintf("id=%s", pmem.ID))
+	deviceParams = append(deviceParams, fmt.Sprintf("memdev=%s", pmem.MemDev))
+	if pmem.Bus != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", pmem.Bus))
+	}
+	addr := config.pciBusSlots.GetSlot(pmem.Addr)
+	if addr > 0 {
+		deviceParams = append(deviceParams, fmt.Sprintf("addr=0x%02x", addr))
+	}
+
+	qemuParams = append(qemuParams, "-object")
+	qemuParams = append(qemuParams, strings.Join(objectParams, ","))
+	qemuParams = append(qemuParams, "-device")
+	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+
+	return qemuParams
+}
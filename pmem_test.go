@@ -0,0 +1,93 @@
+package qcli
+
+import "testing"
+
+var (
+	deviceNVDIMMDeviceString = "-object memory-backend-file,id=nv0-mem,size=4G,mem-path=/var/lib/nv0.img,share=on,readonly=on -device nvdimm,id=nv0,memdev=nv0-mem,label-size=128K,unarmed=on,node=0"
+	deviceVirtioPmemString   = "-object memory-backend-file,id=pmem0-mem,size=2G,mem-path=/var/lib/pmem0.img,share=on -device virtio-pmem-pci,id=pmem0,memdev=pmem0-mem,addr=0x05"
+	nvdimmPmemConfigString   = "-machine q35,nvdimm=on -m 4G,slots=1,maxmem=10G -object memory-backend-file,id=nv0-mem,size=4G,mem-path=/var/lib/nv0.img,share=on,pmem=on -device nvdimm,id=nv0,memdev=nv0-mem -object memory-backend-file,id=pmem0-mem,size=2G,mem-path=/var/lib/pmem0.img,share=on -device virtio-pmem-pci,id=pmem0,memdev=pmem0-mem,addr=0x1e -object memory-backend-ram,id=dimm1,size=4G -numa node,memdev=dimm1"
+)
+
+func TestAppendNVDIMMDevice(t *testing.T) {
+	node := 0
+	nvdimm := NVDIMMDevice{
+		ID:        "nv0",
+		MemDev:    "nv0-mem",
+		MemPath:   "/var/lib/nv0.img",
+		Size:      "4G",
+		LabelSize: "128K",
+		Unarmed:   true,
+		ReadOnly:  true,
+		Node:      &node,
+	}
+	testAppend(nvdimm, deviceNVDIMMDeviceString, t)
+}
+
+func TestAppendVirtioPmemDevice(t *testing.T) {
+	pmem := VirtioPmemDevice{
+		ID:      "pmem0",
+		MemDev:  "pmem0-mem",
+		MemPath: "/var/lib/pmem0.img",
+		Size:    "2G",
+		Addr:    "5",
+	}
+	testAppend(pmem, deviceVirtioPmemString, t)
+}
+
+func TestAppendConfigNVDIMMPmemDevices(t *testing.T) {
+	c := &Config{
+		Machine: Machine{
+			Type:   MachineTypePC35,
+			NVDIMM: "on",
+		},
+		Memory: Memory{
+			Size:   "4G",
+			Slots:  1,
+			MaxMem: "10G",
+		},
+		NVDIMMDevices: []NVDIMMDevice{
+			{ID: "nv0", MemDev: "nv0-mem", MemPath: "/var/lib/nv0.img", Size: "4G", PMem: true},
+		},
+		VirtioPmemDevices: []VirtioPmemDevice{
+			{ID: "pmem0", MemDev: "pmem0-mem", MemPath: "/var/lib/pmem0.img", Size: "2G"},
+		},
+	}
+	testConfig(c, nvdimmPmemConfigString, t)
+}
+
+func TestBadPmemDevices(t *testing.T) {
+	devices := []Device{
+		NVDIMMDevice{MemDev: "nv0-mem", MemPath: "/nv0", Size: "4G"},
+		NVDIMMDevice{ID: "nv0", MemPath: "/nv0", Size: "4G"},
+		NVDIMMDevice{ID: "nv0", MemDev: "nv0-mem", Size: "4G"},
+		NVDIMMDevice{ID: "nv0", MemDev: "nv0-mem", MemPath: "/nv0", Size: "4X"},
+		NVDIMMDevice{ID: "nv0", MemDev: "nv0-mem", MemPath: "/nv0", Size: "4G", LabelSize: "64K"},
+		NVDIMMDevice{ID: "nv0", MemDev: "nv0-mem", MemPath: "/nv0", Size: "4G", ReadOnly: true},
+		VirtioPmemDevice{MemDev: "pmem0-mem", MemPath: "/pmem0", Size: "2G"},
+		VirtioPmemDevice{ID: "pmem0", MemPath: "/pmem0", Size: "2G"},
+		VirtioPmemDevice{ID: "pmem0", MemDev: "pmem0-mem", Size: "2G"},
+		VirtioPmemDevice{ID: "pmem0", MemDev: "pmem0-mem", MemPath: "/pmem0"},
+	}
+	for _, d := range devices {
+		if err := d.Valid(); err == nil {
+			t.Errorf("Expected error for invalid device %+v", d)
+		}
+	}
+
+	nvdimm := NVDIMMDevice{ID: "nv0", MemDev: "nv0-mem", MemPath: "/nv0", Size: "4G"}
+	pmem := VirtioPmemDevice{ID: "pmem0", MemDev: "pmem0-mem", MemPath: "/pmem0", Size: "2G"}
+	configs := []*Config{
+		// nvdimm not enabled on the machine
+		{Memory: Memory{Size: "4G", Slots: 1, MaxMem: "16G"}, NVDIMMDevices: []NVDIMMDevice{nvdimm}},
+		// no memory slot for the nvdimm
+		{Machine: Machine{NVDIMM: "on"}, Memory: Memory{Size: "4G", MaxMem: "16G"}, NVDIMMDevices: []NVDIMMDevice{nvdimm}},
+		// nvdimm and virtio-pmem exceed maxmem
+		{Machine: Machine{NVDIMM: "on"}, Memory: Memory{Size: "4G", Slots: 1, MaxMem: "8G"}, NVDIMMDevices: []NVDIMMDevice{nvdimm}, VirtioPmemDevices: []VirtioPmemDevice{pmem}},
+		{Memory: Memory{Size: "4G"}, VirtioPmemDevices: []VirtioPmemDevice{pmem}},
+	}
+	for _, c := range configs {
+		if err := c.validateDeviceMemory(); err == nil {
+			t.Errorf("Expected error for invalid device memory config %+v", c)
+		}
+	}
+}
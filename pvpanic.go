@@ -25,20 +25,116 @@
 
 package qcli
 
-// PVPanicDevice represents a qemu pvpanic device.
+import (
+	"fmt"
+	"strings"
+)
+
+// PVPanicModel is the pvpanic device variant.
+type PVPanicModel string
+
+const (
+	// PVPanicISA is the ISA pvpanic device, the default.
+	PVPanicISA PVPanicModel = "pvpanic"
+
+	// PVPanicPCI is the PCI pvpanic device, e.g., for arm64 virt machines
+	// which have no ISA bus.
+	PVPanicPCI PVPanicModel = "pvpanic-pci"
+)
+
+// PVPanicDevice represents a qemu pvpanic device. A guest kernel panic
+// reported through it raises the GUEST_PANICKED QMP event, see
+// QMPEvent.GuestPanicked.
 type PVPanicDevice struct {
+	// ID is the device ID
+	ID string `yaml:"id"`
+
+	// Model is the pvpanic variant, PVPanicISA if empty
+	Model PVPanicModel `yaml:"model"`
+
+	// IOPort is the ISA I/O port of the device, 0x505 if empty
+	IOPort string `yaml:"ioport"`
+
+	// Bus is the bus path name of a PCI device.
+	Bus string `yaml:"bus"`
+
+	// Addr is the address offset of a PCI device on the bus.
+	Addr string `yaml:"address"`
+
+	// NoShutdown keeps qemu running once the guest shut down, so that a
+	// panicked guest can be inspected, like Knobs.NoShutdown
 	NoShutdown bool `yaml:"no-shutdown-enable"`
 }
 
-// Valid always returns true for pvpanic device
+// Valid returns an error if the PVPanicDevice structure is not valid.
 func (dev PVPanicDevice) Valid() error {
+	switch dev.Model {
+	case "", PVPanicISA:
+		if dev.Bus != "" || dev.Addr != "" {
+			return fmt.Errorf("PVPanicDevice model %s does not support Bus or Addr", PVPanicISA)
+		}
+	case PVPanicPCI:
+		if dev.IOPort != "" {
+			return fmt.Errorf("PVPanicDevice model %s does not support IOPort", PVPanicPCI)
+		}
+	default:
+		return fmt.Errorf("PVPanicDevice has invalid Model field: %s", dev.Model)
+	}
 	return nil
 }
 
-// QemuParams returns the qemu parameters built out of this serial device.
+// model returns the pvpanic Model, PVPanicISA if none is set.
+func (dev PVPanicDevice) model() PVPanicModel {
+	if dev.Model == "" {
+		return PVPanicISA
+	}
+	return dev.Model
+}
+
+// QemuParams returns the qemu parameters built out of this pvpanic device.
 func (dev PVPanicDevice) QemuParams(config *Config) []string {
-	if dev.NoShutdown {
-		return []string{"-device", "pvpanic", "-no-shutdown"}
+	var qemuParams []string
+	var deviceParams []string
+
+	model := dev.model()
+	deviceParams = append(deviceParams, string(model))
+
+	if dev.ID != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("id=%s", dev.ID))
+	}
+
+	if dev.IOPort != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("ioport=%s", dev.IOPort))
+	}
+
+	if dev.Bus != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", dev.Bus))
+	}
+
+	if model == PVPanicPCI {
+		addr := config.pciBusSlots.GetSlot(dev.Addr)
+		if addr > 0 {
+			deviceParams = append(deviceParams, fmt.Sprintf("addr=0x%02x", addr))
+		}
+	}
+
+	qemuParams = append(qemuParams, "-device")
+	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+
+	// -no-shutdown is emitted once by appendKnobs, see noShutdown
+	return qemuParams
+}
+
+// noShutdown returns true if Knobs.NoShutdown or the NoShutdown field of
+// a PVPanicDevice is set.
+func (config *Config) noShutdown() bool {
+	if config.Knobs.NoShutdown {
+		return true
+	}
+	for _, dev := range config.PVPanicDevices {
+		if dev.NoShutdown {
+			return true
+		}
 	}
-	return []string{"-device", "pvpanic"}
+	return false
 }
@@ -1,6 +1,9 @@
 package qcli
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestAppendPVPanicDevice(t *testing.T) {
 	testCases := []struct {
@@ -9,10 +12,84 @@ func TestAppendPVPanicDevice(t *testing.T) {
 	}{
 		{nil, ""},
 		{PVPanicDevice{}, "-device pvpanic"},
-		{PVPanicDevice{NoShutdown: true}, "-device pvpanic -no-shutdown"},
+		{PVPanicDevice{NoShutdown: true}, "-device pvpanic"},
+		{PVPanicDevice{ID: "panic0", Model: PVPanicISA, IOPort: "0x506"}, "-device pvpanic,id=panic0,ioport=0x506"},
+		{PVPanicDevice{ID: "panic0", Model: PVPanicPCI, Bus: "pcie.0", Addr: "5"}, "-device pvpanic-pci,id=panic0,bus=pcie.0,addr=0x05"},
 	}
 
 	for _, tc := range testCases {
 		testAppend(tc.dev, tc.out, t)
 	}
 }
+
+func TestPVPanicDeviceValid(t *testing.T) {
+	for _, dev := range []PVPanicDevice{
+		{Model: "pvpanic-mmio"},
+		{Model: PVPanicISA, Bus: "pcie.0"},
+		{Model: PVPanicPCI, IOPort: "0x505"},
+	} {
+		if err := dev.Valid(); err == nil {
+			t.Errorf("Expected error for %+v", dev)
+		}
+	}
+}
+
+func TestAppendPVPanicDevices(t *testing.T) {
+	config := Config{
+		PVPanicDevices: []PVPanicDevice{
+			{Model: PVPanicPCI, ID: "panic0"},
+		},
+	}
+	testConfig(&config, "-device pvpanic-pci,id=panic0,addr=0x1e", t)
+}
+
+func TestPVPanicNoShutdown(t *testing.T) {
+	config := Config{
+		Knobs: Knobs{NoShutdown: true},
+		PVPanicDevices: []PVPanicDevice{
+			{ID: "panic0", NoShutdown: true},
+		},
+	}
+	testConfig(&config, "-device pvpanic,id=panic0 --no-shutdown", t)
+
+	config = Config{
+		PVPanicDevices: []PVPanicDevice{
+			{ID: "panic0", NoShutdown: true},
+		},
+	}
+	testConfig(&config, "-device pvpanic,id=panic0 --no-shutdown", t)
+}
+
+func TestQMPEventGuestPanicked(t *testing.T) {
+	ev := QMPEvent{
+		Name: "GUEST_PANICKED",
+		Data: map[string]interface{}{
+			"action": "pause",
+			"info": map[string]interface{}{
+				"type": "hyper-v",
+				"arg1": float64(0x1e),
+				"arg2": float64(0xc0000005),
+			},
+		},
+		Timestamp: time.Now(),
+	}
+
+	panicked, err := ev.GuestPanicked()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if panicked.Action != "pause" || panicked.Info == nil || panicked.Info.Type != "hyper-v" ||
+		panicked.Info.Arg1 != 0x1e || panicked.Info.Arg2 != 0xc0000005 {
+		t.Errorf("Unexpected panic information %+v %+v", panicked, panicked.Info)
+	}
+	if state, ok := ev.RunState(); !ok || state != RunStateGuestPanicked {
+		t.Errorf("Expected run state %s, found %s", RunStateGuestPanicked, state)
+	}
+
+	if _, err := (QMPEvent{Name: "SHUTDOWN"}).GuestPanicked(); err == nil {
+		t.Errorf("Expected error for a SHUTDOWN event")
+	}
+	if _, ok := (QMPEvent{Name: "DEVICE_DELETED"}).RunState(); ok {
+		t.Errorf("Expected no run state for DEVICE_DELETED")
+	}
+}
@@ -0,0 +1,132 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PCIExpanderBridge represents a qemu PCI expander bridge, pxb or
+// pxb-pcie, an extra PCI root bus which may be associated with a guest
+// NUMA node. Devices are placed behind it with their Bus set to its ID,
+// for pxb-pcie through PCIeRootPortDevices, e.g., created with
+// NewPCIeRootMultifunctionPortRange.
+type PCIExpanderBridge struct {
+	// ID is used to identify the bridge in qemu
+	ID string `yaml:"id"`
+
+	// Type of the bridge, PCIEBridge for a pxb-pcie on q35
+	Type BridgeType `yaml:"type"`
+
+	// Bus where the bridge is plugged, pcie.0 or pci.0 by default
+	Bus string `yaml:"bus"`
+
+	// BusNr is the first bus number of the new root bus, the buses below
+	// BusNr are left to the main root bus and the lower expander bridges
+	BusNr int `yaml:"bus-number"`
+
+	// NUMANode is the guest NUMA node of the root bus
+	NUMANode *int `yaml:"numa-node"`
+
+	// Addr is the address of the bridge on Bus
+	Addr string `yaml:"address"`
+}
+
+// Valid returns nil if the PCIExpanderBridge structure is valid and complete.
+func (pxb PCIExpanderBridge) Valid() error {
+	if pxb.Type != PCIBridge && pxb.Type != PCIEBridge {
+		return fmt.Errorf("PCIExpanderBridge has invalid Type: %d", pxb.Type)
+	}
+
+	if pxb.ID == "" {
+		return fmt.Errorf("PCIExpanderBridge has empty ID field")
+	}
+
+	if pxb.BusNr < 1 || pxb.BusNr > 255 {
+		return fmt.Errorf("PCIExpanderBridge %s has invalid BusNr %d, must be between 1 and 255", pxb.ID, pxb.BusNr)
+	}
+
+	if pxb.NUMANode != nil && *pxb.NUMANode < 0 {
+		return fmt.Errorf("PCIExpanderBridge %s has invalid NUMANode %d", pxb.ID, *pxb.NUMANode)
+	}
+
+	return nil
+}
+
+// deviceName returns the QEMU device name for the bridge Type.
+func (pxb PCIExpanderBridge) deviceName() string {
+	if pxb.Type == PCIEBridge {
+		return string(PCIeExpanderBridgeDriver)
+	}
+	return string(PCIExpanderBridgeDriver)
+}
+
+// QemuParams returns the qemu parameters built out of the PCIExpanderBridge.
+func (pxb PCIExpanderBridge) QemuParams(config *Config) []string {
+	var qemuParams []string
+	var deviceParams []string
+
+	driver, bus := pxb.deviceName(), "pci.0"
+	if pxb.Type == PCIEBridge {
+		bus = "pcie.0"
+	}
+	if pxb.Bus != "" {
+		bus = pxb.Bus
+	}
+	deviceParams = append(deviceParams, fmt.Sprintf("%s,id=%s,bus=%s,bus_nr=%d", driver, pxb.ID, bus, pxb.BusNr))
+
+	if pxb.NUMANode != nil {
+		deviceParams = append(deviceParams, fmt.Sprintf("numa_node=%d", *pxb.NUMANode))
+	}
+
+	if pxb.Addr != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("addr=%s", pxb.Addr))
+	}
+
+	qemuParams = append(qemuParams, "-device")
+	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+	return qemuParams
+}
+
+// validatePCIExpanderBridges checks the bus numbers of the expander
+// bridges do not overlap.
+func (config *Config) validatePCIExpanderBridges() error {
+	var errors []string
+	busNrs := map[int]string{}
+	for _, pxb := range config.PCIExpanderBridges {
+		if other, ok := busNrs[pxb.BusNr]; ok {
+			errors = append(errors, fmt.Sprintf("PCIExpanderBridge %s and %s have the same BusNr %d", other, pxb.ID, pxb.BusNr))
+			continue
+		}
+		busNrs[pxb.BusNr] = pxb.ID
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Invalid PCI expander bridges:\n%s", strings.Join(errors, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package qcli
+
+import "testing"
+
+func TestAppendPCIExpanderBridge(t *testing.T) {
+	node := 1
+	testCases := []struct {
+		dev Device
+		out string
+	}{
+		{PCIExpanderBridge{ID: "pxb1", Type: PCIEBridge, BusNr: 32, NUMANode: &node}, "-device pxb-pcie,id=pxb1,bus=pcie.0,bus_nr=32,numa_node=1"},
+		{PCIExpanderBridge{ID: "pxb2", BusNr: 64, Addr: "0x9"}, "-device pxb,id=pxb2,bus=pci.0,bus_nr=64,addr=0x9"},
+	}
+
+	for _, tc := range testCases {
+		testAppend(tc.dev, tc.out, t)
+	}
+}
+
+func TestPCIExpanderBridgeValid(t *testing.T) {
+	node := -1
+	for _, pxb := range []PCIExpanderBridge{
+		{BusNr: 32},
+		{ID: "pxb1"},
+		{ID: "pxb1", BusNr: 256},
+		{ID: "pxb1", BusNr: 32, Type: BridgeType(5)},
+		{ID: "pxb1", BusNr: 32, NUMANode: &node},
+	} {
+		if err := pxb.Valid(); err == nil {
+			t.Errorf("Expected error for %+v", pxb)
+		}
+	}
+}
+
+func TestAppendPCIExpanderBridges(t *testing.T) {
+	node := 1
+	config := Config{
+		PCIExpanderBridges: []PCIExpanderBridge{
+			{ID: "pxb1", Type: PCIEBridge, BusNr: 32, NUMANode: &node},
+		},
+		PCIeRootPortDevices: []PCIeRootPortDevice{
+			{ID: "rp1", Bus: "pxb1"},
+		},
+	}
+	testConfig(&config, "-device pxb-pcie,id=pxb1,bus=pcie.0,bus_nr=32,numa_node=1 "+
+		"-device pcie-root-port,id=rp1,bus=pxb1,chassis=0x00,slot=0x00,addr=0x00,multifunction=off", t)
+
+	config.PCIExpanderBridges = append(config.PCIExpanderBridges, PCIExpanderBridge{ID: "pxb2", Type: PCIEBridge, BusNr: 32})
+	if _, err := ConfigureParams(&config, nil); err == nil {
+		t.Errorf("Expected error for expander bridges with the same BusNr")
+	}
+}
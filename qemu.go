@@ -26,10 +26,8 @@
 package qcli
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
 	"runtime"
@@ -100,11 +98,67 @@ type Kernel struct {
 	// InitrdPath is the guest initrd path on the host filesystem.
 	InitrdPath string `yaml:"initrd-path"`
 
-	// Params is the kernel parameters string.
+	// Params is the kernel parameters string. Values with spaces must be
+	// double quoted, e.g. foo="a b".
 	Params string `yaml:"params-string"`
+
+	// DTBPath is the device tree blob passed to the guest kernel, e.g. on
+	// arm virt machines.
+	DTBPath string `yaml:"dtb-path"`
+}
+
+// Valid returns an error if the Kernel Path is missing or if the Params are
+// not safely quoted. An empty Kernel is valid.
+func (kernel Kernel) Valid() error {
+	if kernel.Path == "" {
+		if kernel.InitrdPath != "" || kernel.Params != "" || kernel.DTBPath != "" {
+			return fmt.Errorf("Kernel has empty Path field")
+		}
+		return nil
+	}
+
+	if strings.ContainsAny(kernel.Params, "\x00\n") {
+		return fmt.Errorf("Kernel Params must not contain newline or NUL characters")
+	}
+
+	// the kernel has no escape for a double quote, an unbalanced one
+	// swallows the rest of the command line
+	if strings.Count(kernel.Params, `"`)%2 != 0 {
+		return fmt.Errorf("Kernel Params has unbalanced double quotes: %s", kernel.Params)
+	}
+
+	return nil
+}
+
+// checkFiles returns an error if the kernel, initrd or dtb file does not
+// exist on this host, it is called at launch time.
+func (kernel Kernel) checkFiles() error {
+	var missing []string
+	for _, path := range []string{kernel.Path, kernel.InitrdPath, kernel.DTBPath} {
+		if path != "" && !PathExists(path) {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Kernel files not found: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
 }
 
 // Knobs regroups a set of qemu boolean settings
+// Overcommit controls how guest memory and CPUs may be overcommitted on
+// the host (-overcommit parameter).
+type Overcommit struct {
+	// MemLock locks the guest memory in host RAM, mem-lock=on
+	MemLock bool `yaml:"mem-lock"`
+
+	// CPUPM passes the CPU power management instructions, e.g., HLT and
+	// MWAIT, through to the guest, cpu-pm=on. It suits guests whose vcpus
+	// are pinned to dedicated host CPUs and requires qemu 3.1.
+	CPUPM bool `yaml:"cpu-pm"`
+}
+
 type Knobs struct {
 	// NoUserConfig prevents qemu from loading user config files.
 	NoUserConfig bool `yaml:"no-user-config"`
@@ -115,7 +169,8 @@ type Knobs struct {
 	// NoGraphic completely disables graphic output.
 	NoGraphic bool `yaml:"no-graphic"`
 
-	// Daemonize will turn the qemu process into a daemon
+	// Daemonize will turn the qemu process into a daemon, see
+	// LaunchQemuResult for cleaning up after it
 	Daemonize bool `yaml:"daemonize"`
 
 	// Both HugePages and MemPrealloc require the Memory.Size of the VM
@@ -138,9 +193,13 @@ type Knobs struct {
 	// MemShared will set the memory device as shared.
 	MemShared bool `yaml:"mem-shared"`
 
-	// Mlock will control locking of memory
+	// Mlock will control locking of memory, it is the same as
+	// Overcommit.MemLock
 	Mlock bool `yaml:"mlock"`
 
+	// Overcommit is the -overcommit host resource configuration
+	Overcommit Overcommit `yaml:"overcommit"`
+
 	// Stopped will not start guest CPU at startup
 	Stopped bool `yaml:"create-but-do-not-start"`
 
@@ -154,11 +213,19 @@ type Knobs struct {
 	// IOMMUPlatform will enable IOMMU for supported devices
 	IOMMUPlatform bool `yaml:"iommu-platform-enable"`
 
-	// Disable the HPET clocksource
+	// Disable the HPET clocksource, with -no-hpet or -machine hpet=off
+	// depending on Version
 	NoHPET bool `yaml:"no-hpet-clocksource"`
 
+	// Disable the ACPI tables, with -no-acpi or -machine acpi=off
+	// depending on Version
+	NoACPI bool `yaml:"no-acpi"`
+
 	// Snapshot will create temporary writable disks to avoid modifying originals
 	Snapshot bool `yaml:"snapshot-enable"`
+
+	// MsgTimestamp prefixes the qemu error messages with a timestamp
+	MsgTimestamp bool `yaml:"msg-timestamp"`
 }
 
 // IOThread allows IO to be performed on a separate thread.
@@ -209,6 +276,9 @@ type Config struct {
 	Gid uint32 `yaml:"group-id,omitempty"`
 	// Supplementary group IDs.
 	Groups []uint32 `yaml:"groups,omitempty"`
+	// RunAs selects how qemu is run as Uid, Gid and Groups, qemu runs as
+	// the calling user when empty.
+	RunAs RunAsMode `yaml:"run-as,omitempty"`
 
 	// Name is the qemu guest name
 	Name string `yaml:"name"`
@@ -222,15 +292,37 @@ type Config struct {
 	// CPUModelFlags auguments the capabilities of the cpu
 	CPUModelFlags []string `yaml:"cpu-model-flags"`
 
+	// CPUFeatures are typed CPUModel feature flags and properties, see
+	// SetCPUFeature, EnableNestedVirt and HideKVM
+	CPUFeatures []CPUFeature `yaml:"cpu-features"`
+
+	// HyperV are the Hyper-V enlightenments for Windows guests
+	HyperV HyperV `yaml:"hyperv"`
+
 	// SeccompSandbox is the qemu function which enables the seccomp feature
 	SeccompSandbox string `yaml:"seccomp-sandbox"`
 
+	// Sandbox confines the qemu process with namespaces, no new privileges
+	// and a seccomp profile
+	Sandbox Sandbox `yaml:"sandbox"`
+
 	// Machine
 	Machine Machine `yaml:"machine"`
 
+	// Accels is the list of -accel parameters, in order of preference
+	Accels []Accel `yaml:"accelerators"`
+
 	// SMBIOS
 	SMBIOS SMBIOSInfo `yaml:"smbios"`
 
+	// Secrets is a list of -object secret used by encrypted disks and
+	// other objects that need passwords or keys
+	Secrets []SecretObject `yaml:"secrets"`
+
+	// TLSCreds is a list of -object tls-creds-x509 referenced by ID from
+	// spice, NBD and migration
+	TLSCreds []TLSCredsObject `yaml:"tls-creds"`
+
 	// QMPSockets is a slice of QMP socket description.
 	QMPSockets []QMPSocket `yaml:"qmp-sockets"`
 
@@ -244,11 +336,28 @@ type Config struct {
 	LegacySerialDevices   []LegacySerialDevice   `yaml:"legacy-serial-devices"`
 	SerialDevices         []SerialDevice         `yaml:"serial-devices"`
 	MonitorDevices        []MonitorDevice        `yaml:"monitor-devices"`
+	PCIExpanderBridges    []PCIExpanderBridge    `yaml:"pci-expander-bridges"`
 	PCIeRootPortDevices   []PCIeRootPortDevice   `yaml:"pcie-root-port-devices"`
 	UEFIFirmwareDevices   []UEFIFirmwareDevice   `yaml:"uefi-firmware-devices"`
 	SCSIControllerDevices []SCSIControllerDevice `yaml:"scsi-controller-devices"`
 	IDEControllerDevices  []IDEControllerDevice  `yaml:"ide-controller-devices"`
 	USBControllerDevices  []USBControllerDevice  `yaml:"usb-controller-devices"`
+	WatchdogDevices       []WatchdogDevice       `yaml:"watchdog-devices"`
+	PVPanicDevices        []PVPanicDevice        `yaml:"pvpanic-devices"`
+	VFIODevices           []VFIODevice           `yaml:"vfio-devices"`
+	RawDevices            []RawDevice            `yaml:"raw-devices"`
+	BalloonDevices        []BalloonDevice        `yaml:"balloon-devices"`
+	VirtioMemDevices      []VirtioMemDevice      `yaml:"virtio-mem-devices"`
+	IVShmemDevices        []IVShmemDevice        `yaml:"ivshmem-devices"`
+	NVDIMMDevices         []NVDIMMDevice         `yaml:"nvdimm-devices"`
+	VirtioPmemDevices     []VirtioPmemDevice     `yaml:"virtio-pmem-devices"`
+	LoaderDevices         []LoaderDevice         `yaml:"loader-devices"`
+	VSOCKDevices          []VSOCKDevice          `yaml:"vsock-devices"`
+	VhostUserDevices      []VhostUserDevice      `yaml:"vhost-user-devices"`
+	FloppyDevices         []FloppyDevice         `yaml:"floppy-devices"`
+	USBRedirDevices       []USBRedirDevice       `yaml:"usb-redir-devices"`
+
+	SpaprPCIHostBridgeDevices []SpaprPCIHostBridgeDevice `yaml:"spapr-pci-host-bridge-devices"`
 
 	// RTC is the qemu Real Time Clock configuration
 	RTC RTC `yaml:"real-time-clock"`
@@ -256,12 +365,18 @@ type Config struct {
 	// VGA is the qemu VGA mode.
 	VGA string `yaml:"vga-mode"`
 
+	// Display is the qemu display backend, exclusive with Knobs.NoGraphic
+	Display Display `yaml:"display"`
+
 	// SpiceDevice is the qemu spice protocol device for remote display
 	SpiceDevice SpiceDevice `yaml:"spice"`
 
 	// TPMDevice is a QEMU TPM device for guest OS use
 	TPM TPMDevice `yaml:"tpm"`
 
+	// CloudInit is the cloud-init NoCloud seed attached to the VM
+	CloudInit CloudInit `yaml:"cloud-init"`
+
 	// Kernel is the guest kernel configuration.
 	Kernel Kernel `yaml:"kernel"`
 
@@ -271,9 +386,16 @@ type Config struct {
 	// SMP is the quest multi processors configuration.
 	SMP SMP `yaml:"smp"`
 
-	// GlobalParams is for -global parameter
+	// CPUAffinity pins the vcpu and emulator threads to host CPUs, it is
+	// applied by ApplyCPUAffinity once qemu runs
+	CPUAffinity CPUAffinity `yaml:"cpu-affinity"`
+
+	// GlobalParams is for -global parameter, prefer GlobalProperties
 	GlobalParams []string `yaml:"global-params"`
 
+	// GlobalProperties is a list of typed -global parameters
+	GlobalProperties []GlobalProperty `yaml:"global-properties"`
+
 	// Knobs is a set of qemu boolean settings.
 	Knobs Knobs `yaml:"qemu-knobs"`
 
@@ -286,24 +408,87 @@ type Config struct {
 	// Incoming controls migration source preparation
 	Incoming Incoming `yaml:"incoming"`
 
+	// LoadVM is the name of an internal snapshot the VM starts from
+	LoadVM string `yaml:"loadvm"`
+
+	// ICount is the -icount instruction counting and record/replay
+	// configuration
+	ICount ICount `yaml:"icount"`
+
+	// Compat sets the -compat policies for deprecated and unstable
+	// QMP commands, arguments and output
+	Compat Compat `yaml:"compat"`
+
 	// fds is a list of open file descriptors to be passed to the spawned qemu process
 	fds []*os.File
 
 	// FwCfg is the -fw_cfg parameter
 	FwCfg []FwCfg `yaml:"firmware-config"`
 
+	// ACPITables is a list of -acpitable parameters
+	ACPITables []ACPITable `yaml:"acpi-tables"`
+
+	// Version is the qemu version the parameters are built for, some
+	// arguments are spelled differently depending on the version
+	Version Version `yaml:"qemu-version"`
+
+	// Capabilities of the qemu binary, when set ConfigureParams checks
+	// the devices, machine type and cpu model against it
+	Capabilities *Capabilities `yaml:"-"`
+
+	// StrictCapabilities makes ConfigureParams fail instead of warn when
+	// the configuration is not supported by Capabilities
+	StrictCapabilities bool `yaml:"strict-capabilities"`
+
+	// Unset lists the settings, by their YAML key path, e.g.,
+	// qemu-knobs.no-reboot, that MergeConfig resets to their zero value before
+	// applying this Config on top of a base Config
+	Unset []string `yaml:"unset,omitempty"`
+
+	// tempFiles is a list of files created while building the qemu
+	// parameters which are removed by Cleanup
+	tempFiles []string
+
+	// randomMACs are the MAC addresses generated for the NetDevices of a
+	// Config without Name, by NetDevice ID
+	randomMACs map[string]string
+
+	// swtpm is the TPM emulator started by StartTPMEmulator, it is
+	// stopped by Cleanup
+	swtpm *SwTPM
+
+	// virtiofsds are the virtiofsd processes started by StartVirtiofsd,
+	// they are stopped by Cleanup
+	virtiofsds []*Virtiofsd
+
 	IOThreads []IOThread `yaml:"iothreads"`
 
+	// ioThreadObjects tracks the iothread objects already emitted so that
+	// an iothread referenced by several devices is only created once
+	ioThreadObjects map[string]bool
+
+	// watchdogAction is the -watchdog-action already emitted for one of
+	// the WatchdogDevices
+	watchdogAction WatchdogAction
+
 	// PidFile is the -pidfile parameter
 	PidFile string `yaml:"pid-file"`
 
 	// LogFile is the -D parameter
 	LogFile string `yaml:"log-file"`
 
+	// Debug is the gdb stub and debug logging configuration
+	Debug Debug `yaml:"debug"`
+
+	// Trace is the -trace event configuration
+	Trace Trace `yaml:"trace"`
+
 	// SM-BIOS Info TBD
 
 	pciBusSlots PCIBus
 
+	ccwBus CCWBus
+
 	qemuParams []string
 }
 
@@ -328,9 +513,9 @@ func (config *Config) appendFDs(fds []*os.File) []int {
 }
 
 func (config *Config) appendSeccompSandbox() {
-	if config.SeccompSandbox != "" {
+	if sandbox := config.seccompSandboxParam(); sandbox != "" {
 		config.qemuParams = append(config.qemuParams, "-sandbox")
-		config.qemuParams = append(config.qemuParams, config.SeccompSandbox)
+		config.qemuParams = append(config.qemuParams, sandbox)
 	}
 }
 
@@ -342,16 +527,16 @@ func (config *Config) appendName() {
 }
 
 // ConfigFieldName, QemuParamName, ConfigFieldValue
-func getConfigOnOff(paramName, paramKey, paramVal string) string {
+func getConfigOnOff(paramName, paramKey, paramVal string) (string, error) {
 	if paramVal != "" {
 		switch paramVal {
 		case "on", "off":
-			return fmt.Sprintf("%s=%s", paramKey, paramVal)
+			return fmt.Sprintf("%s=%s", paramKey, paramVal), nil
 		default:
-			log.Fatalf("Invalid %s value: '%s', must be one of 'on', 'off'", paramName, paramVal)
+			return "", fmt.Errorf("Invalid %s value: '%s', must be one of 'on', 'off'", paramName, paramVal)
 		}
 	}
-	return ""
+	return "", nil
 }
 
 func (config *Config) appendCPUModel() {
@@ -362,6 +547,10 @@ func (config *Config) appendCPUModel() {
 		if len(config.CPUModelFlags) > 0 {
 			cpuParams = append(cpuParams, config.CPUModelFlags...)
 		}
+		for _, feature := range config.CPUFeatures {
+			cpuParams = append(cpuParams, feature.param())
+		}
+		cpuParams = append(cpuParams, config.HyperV.cpuParams()...)
 		config.qemuParams = append(config.qemuParams, "-cpu")
 		config.qemuParams = append(config.qemuParams, strings.Join(cpuParams, ","))
 	}
@@ -427,15 +616,6 @@ func (config *Config) appendCPUs() error {
 	return nil
 }
 
-func (config *Config) appendGlobalParams() {
-	if len(config.GlobalParams) > 0 {
-		for _, param := range config.GlobalParams {
-			config.qemuParams = append(config.qemuParams, "-global")
-			config.qemuParams = append(config.qemuParams, param)
-		}
-	}
-}
-
 func (config *Config) appendPFlashParam() {
 	for _, p := range config.PFlash {
 		config.qemuParams = append(config.qemuParams, "-pflash")
@@ -451,7 +631,7 @@ func (config *Config) appendVGA() {
 }
 
 func (config *Config) appendSpice() {
-	if config.SpiceDevice.Port != "" || config.SpiceDevice.TLSPort != "" {
+	if config.SpiceDevice.Port != "" || config.SpiceDevice.TLSPort != "" || config.SpiceDevice.UnixSocket != "" {
 		config.devices = append(config.devices, config.SpiceDevice)
 	}
 }
@@ -472,6 +652,11 @@ func (config *Config) appendKernel() {
 			config.qemuParams = append(config.qemuParams, config.Kernel.InitrdPath)
 		}
 
+		if config.Kernel.DTBPath != "" {
+			config.qemuParams = append(config.qemuParams, "-dtb")
+			config.qemuParams = append(config.qemuParams, config.Kernel.DTBPath)
+		}
+
 		if config.Kernel.Params != "" {
 			config.qemuParams = append(config.qemuParams, "-append")
 			config.qemuParams = append(config.qemuParams, config.Kernel.Params)
@@ -479,12 +664,15 @@ func (config *Config) appendKernel() {
 	}
 }
 
+// memoryBackendID is the id of the memory backend object of Memory.
+const memoryBackendID = "dimm1"
+
 func (config *Config) appendMemoryKnobs() {
 	if config.Memory.Size == "" {
 		return
 	}
 	var objMemParam, numaMemParam string
-	dimmName := "dimm1"
+	dimmName := memoryBackendID
 	if config.Knobs.HugePages {
 		objMemParam = "memory-backend-file,id=" + dimmName + ",size=" + config.Memory.Size + ",mem-path=/dev/hugepages"
 		numaMemParam = "node,memdev=" + dimmName
@@ -534,7 +722,7 @@ func (config *Config) appendKnobs() {
 		config.qemuParams = append(config.qemuParams, "--no-reboot")
 	}
 
-	if config.Knobs.NoShutdown {
+	if config.noShutdown() {
 		config.qemuParams = append(config.qemuParams, "--no-shutdown")
 	}
 
@@ -542,22 +730,77 @@ func (config *Config) appendKnobs() {
 		config.qemuParams = append(config.qemuParams, "-daemonize")
 	}
 
-	if config.Knobs.Mlock {
-		config.qemuParams = append(config.qemuParams, "-overcommit")
-		config.qemuParams = append(config.qemuParams, "mem-lock=on")
-	}
+	config.appendOvercommit()
 
 	if config.Knobs.Stopped {
 		config.qemuParams = append(config.qemuParams, "-S")
 	}
 
+	// -no-hpet and -no-acpi are deprecated since qemu 8.0 in favor of
+	// -machine hpet=off and acpi=off, which appendMachine emits when a
+	// machine type is set
+	var machineParams []string
 	if config.Knobs.NoHPET {
-		config.qemuParams = append(config.qemuParams, "-no-hpet")
+		if !config.useMachineHPET() {
+			config.qemuParams = append(config.qemuParams, "-no-hpet")
+		} else if config.Machine.Type == "" {
+			machineParams = append(machineParams, "hpet=off")
+		}
+	}
+	if config.Knobs.NoACPI {
+		if !config.useMachineACPI() {
+			config.qemuParams = append(config.qemuParams, "-no-acpi")
+		} else if config.Machine.Type == "" {
+			machineParams = append(machineParams, "acpi=off")
+		}
+	}
+	if len(machineParams) > 0 {
+		config.qemuParams = append(config.qemuParams, "-machine")
+		config.qemuParams = append(config.qemuParams, strings.Join(machineParams, ","))
 	}
 
 	if config.Knobs.Snapshot {
 		config.qemuParams = append(config.qemuParams, "-snapshot")
 	}
+
+	if config.Knobs.MsgTimestamp {
+		config.qemuParams = append(config.qemuParams, "-msg")
+		config.qemuParams = append(config.qemuParams, "timestamp=on")
+	}
+}
+
+// validateOvercommit checks the Overcommit settings are supported by the
+// qemu version, -realtime only provides mlock.
+func (config *Config) validateOvercommit() error {
+	if config.Knobs.Overcommit.CPUPM && config.Version.Before(3, 1) {
+		return fmt.Errorf("Overcommit CPUPM requires qemu 3.1, found %s", config.Version)
+	}
+	return nil
+}
+
+func (config *Config) appendOvercommit() {
+	memLock := config.Knobs.Mlock || config.Knobs.Overcommit.MemLock
+
+	// -realtime was replaced by -overcommit in qemu 3.1
+	if config.Version.Before(3, 1) {
+		if memLock {
+			config.qemuParams = append(config.qemuParams, "-realtime")
+			config.qemuParams = append(config.qemuParams, "mlock=on")
+		}
+		return
+	}
+
+	var overcommitParams []string
+	if memLock {
+		overcommitParams = append(overcommitParams, "mem-lock=on")
+	}
+	if config.Knobs.Overcommit.CPUPM {
+		overcommitParams = append(overcommitParams, "cpu-pm=on")
+	}
+	if len(overcommitParams) > 0 {
+		config.qemuParams = append(config.qemuParams, "-overcommit")
+		config.qemuParams = append(config.qemuParams, strings.Join(overcommitParams, ","))
+	}
 }
 
 func (config *Config) appendBios() {
@@ -567,11 +810,28 @@ func (config *Config) appendBios() {
 	}
 }
 
+// ioThreadParams returns the -object parameters creating the iothread id
+// with the given properties, or nothing if this iothread object has already
+// been emitted for the configuration.
+func (config *Config) ioThreadParams(id string, props ...string) []string {
+	if config.ioThreadObjects == nil {
+		config.ioThreadObjects = make(map[string]bool)
+	}
+	if config.ioThreadObjects[id] {
+		return []string{}
+	}
+	config.ioThreadObjects[id] = true
+
+	objectParams := append([]string{"iothread"}, props...)
+	objectParams = append(objectParams, fmt.Sprintf("id=%s", id))
+
+	return []string{"-object", strings.Join(objectParams, ",")}
+}
+
 func (config *Config) appendIOThreads() {
 	for _, t := range config.IOThreads {
 		if t.ID != "" {
-			config.qemuParams = append(config.qemuParams, "-object")
-			config.qemuParams = append(config.qemuParams, fmt.Sprintf("iothread,id=%s", t.ID))
+			config.qemuParams = append(config.qemuParams, config.ioThreadParams(t.ID)...)
 		}
 	}
 }
@@ -644,39 +904,145 @@ func ConfigureParams(config *Config, logger QMPLog) ([]string, error) {
 	}
 	config.appendName()
 	config.appendUUID()
-	config.appendMachine()
+	if err := config.appendMachine(); err != nil {
+		return []string{}, err
+	}
+	if err := config.appendAccels(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateCPUFeatures(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateHyperV(); err != nil {
+		return []string{}, err
+	}
 	config.appendCPUModel()
 	config.appendSpice()
 	config.appendTPM()
 	if err := config.appendSMBIOSInfo(); err != nil {
 		return []string{}, err
 	}
+	if err := config.validateStdio(); err != nil {
+		return []string{}, err
+	}
 	err = config.appendQMPSockets()
 	if err != nil {
 		return []string{}, err
 	}
 	config.appendMemory()
+	if err := config.appendSecrets(); err != nil {
+		return []string{}, err
+	}
+	if err := config.appendTLSCreds(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateSpice(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateDeviceMemory(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateBlockQueues(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateSCSIPassthrough(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateFloppies(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateWatchdogs(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateUSBRedir(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateVhostUserGPU(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateMACAddresses(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateNetSockets(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateBootIndexes(); err != nil {
+		return []string{}, err
+	}
+	if err := config.appendCloudInit(); err != nil {
+		return []string{}, err
+	}
 	err = config.appendDevices()
 	if err != nil {
 		return []string{}, err
 	}
-	config.appendRTC()
-	config.appendGlobalParams()
+	if err := config.validateMicrovm(); err != nil {
+		return []string{}, err
+	}
+	if err := config.appendRTC(); err != nil {
+		return []string{}, err
+	}
+	if err := config.appendGlobalParams(); err != nil {
+		return []string{}, err
+	}
 	config.appendPFlashParam()
 	config.appendVGA()
+	if err := config.appendDisplay(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateOvercommit(); err != nil {
+		return []string{}, err
+	}
 	config.appendKnobs()
+	if err := config.Kernel.Valid(); err != nil {
+		return []string{}, err
+	}
 	config.appendKernel()
 	config.appendBios()
 	config.appendIOThreads()
 	config.appendIncoming()
+	if err := config.appendLoadVM(); err != nil {
+		return []string{}, err
+	}
+	if err := config.appendICount(); err != nil {
+		return []string{}, err
+	}
+	if err := config.appendCompat(); err != nil {
+		return []string{}, err
+	}
 	config.appendPidFile()
 	config.appendLogFile()
-	config.appendFwCfg(logger)
+	if err := config.appendDebug(); err != nil {
+		return []string{}, err
+	}
+	if err := config.appendTrace(); err != nil {
+		return []string{}, err
+	}
+	if err := config.appendFwCfg(logger); err != nil {
+		return []string{}, err
+	}
+	if err := config.appendACPITables(); err != nil {
+		return []string{}, err
+	}
+	if err := config.validateSandbox(); err != nil {
+		return []string{}, err
+	}
 	config.appendSeccompSandbox()
 
 	if err := config.appendCPUs(); err != nil {
 		return []string{}, err
 	}
+	if err := config.validateCPUAffinity(); err != nil {
+		return []string{}, err
+	}
+
+	if err := config.verifyParams(); err != nil {
+		return []string{}, err
+	}
+
+	if err := config.checkCapabilities(logger); err != nil {
+		return []string{}, err
+	}
 
 	return config.qemuParams, nil
 }
@@ -715,23 +1081,114 @@ func UnmarshalConfig(content []byte) (*Config, error) {
 	return &cfg, err
 }
 
+// Cleanup removes any temporary files created by ConfigureParams and stops
+// the TPM emulator started by StartTPMEmulator and the virtiofsd processes
+// started by StartVirtiofsd. It is called by LaunchQemu
+// once qemu exits, callers using LaunchCustomQemu with the result of
+// ConfigureParams should call it themselves.
+func (config *Config) Cleanup() error {
+	var errors []string
+	for _, path := range config.tempFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errors = append(errors, err.Error())
+		}
+	}
+	config.tempFiles = nil
+
+	if config.swtpm != nil {
+		if err := config.swtpm.Stop(); err != nil {
+			errors = append(errors, err.Error())
+		}
+		config.swtpm = nil
+	}
+
+	for _, virtiofsd := range config.virtiofsds {
+		if err := virtiofsd.Stop(); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+	config.virtiofsds = nil
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Failed to clean up %d resources: %s", len(errors), strings.Join(errors, ", "))
+	}
+
+	return nil
+}
+
+// unconfigured returns a copy of the Config without the state accumulated
+// by ConfigureParams and without the helper processes and temporary files,
+// so that the copy can be configured and cleaned up without changing config.
+func (config *Config) unconfigured() *Config {
+	c := *config
+	c.devices = nil
+	c.fds = nil
+	c.tempFiles = nil
+	c.randomMACs = nil
+	c.swtpm = nil
+	c.virtiofsds = nil
+	c.ioThreadObjects = nil
+	c.watchdogAction = ""
+	c.pciBusSlots = PCIBus{}
+	c.ccwBus = CCWBus{}
+	c.qemuParams = nil
+	return &c
+}
+
 // LaunchQemu can be used to launch a new qemu instance.
 //
 // The Config parameter contains a set of qemu parameters and settings.
+// If Config.PidFile belongs to a running instance of the VM the launch is
+// refused, a stale pid file is removed.
 //
 // This function writes its log output via logger parameter.
 //
 // The function will block until the launched qemu process exits.  "", nil
 // will be returned if the launch succeeds.  Otherwise a string containing
-// the contents of stderr + a Go error object will be returned.
+// the tail of stderr + a Go error object will be returned, see
+// LaunchQemuResult for the exit status.
 func LaunchQemu(config *Config, logger QMPLog) (string, error) {
+	result, err := LaunchQemuResult(config, logger)
+	if err != nil && result != nil {
+		return result.Stderr, err
+	}
+	return "", err
+}
+
+// LaunchQemuResult launches a new qemu instance like LaunchQemu and returns
+// how it exited. The error is a *LaunchError when qemu failed to start or
+// exited with an error, the LaunchResult is nil when the Config is rejected
+// before qemu is started.
+//
+// The helper processes and temporary files of the Config are cleaned up
+// once qemu exits. With Knobs.Daemonize LaunchQemuResult returns while the
+// daemonized qemu still uses them, the caller must then call Config.Cleanup
+// once qemu has exited.
+func LaunchQemuResult(config *Config, logger QMPLog) (result *LaunchResult, err error) {
+	defer func() {
+		if err != nil || !config.Knobs.Daemonize {
+			config.Cleanup()
+		}
+	}()
+
+	if err := config.CheckPidFile(); err != nil {
+		return nil, err
+	}
+
+	if err := config.validateRunAs(logger); err != nil {
+		return nil, err
+	}
+
+	if err := config.Kernel.checkFiles(); err != nil {
+		return nil, err
+	}
 
 	if _, err := ConfigureParams(config, logger); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if len(config.qemuParams) == 0 {
-		return "", fmt.Errorf("Failed to configure qemu parameters")
+		return nil, fmt.Errorf("Failed to configure qemu parameters")
 	}
 
 	ctx := config.Ctx
@@ -739,16 +1196,10 @@ func LaunchQemu(config *Config, logger QMPLog) (string, error) {
 		ctx = context.Background()
 	}
 
-	attr := syscall.SysProcAttr{}
-	attr.Credential = &syscall.Credential{
-		Uid:    config.Uid,
-		Gid:    config.Gid,
-		Groups: config.Groups,
-	}
-	logger.Infof("Running VM as: uid=%d gid=%d", config.Uid, config.Gid)
+	attr := config.sysProcAttr(logger)
+	path, params := config.launchCommand()
 
-	return LaunchCustomQemu(ctx, config.Path, config.qemuParams,
-		config.fds, &attr, logger)
+	return LaunchCustomQemuResult(ctx, path, params, config.fds, attr, logger)
 }
 
 // LaunchCustomQemu can be used to launch a new qemu instance.
@@ -761,21 +1212,34 @@ func LaunchQemu(config *Config, logger QMPLog) (string, error) {
 // newly created qemu process, such as the user and group under which it
 // runs.  It may be nil.
 //
-// This function writes its log output via logger parameter.
+// This function writes its log output via logger parameter, each line qemu
+// writes to stderr is logged as it is written, prefixed with the -name of
+// the guest.
 //
 // The function will block until the launched qemu process exits.  "", nil
 // will be returned if the launch succeeds.  Otherwise a string containing
-// the contents of stderr + a Go error object will be returned.
+// the tail of stderr + a Go error object will be returned, see
+// LaunchCustomQemuResult for the exit status.
 func LaunchCustomQemu(ctx context.Context, path string, params []string, fds []*os.File,
 	attr *syscall.SysProcAttr, logger QMPLog) (string, error) {
+	result, err := LaunchCustomQemuResult(ctx, path, params, fds, attr, logger)
+	if err != nil {
+		return result.Stderr, err
+	}
+	return "", nil
+}
+
+// LaunchCustomQemuResult launches a new qemu instance like LaunchCustomQemu
+// and returns how it exited. The error is a *LaunchError when qemu failed
+// to start or exited with an error.
+func LaunchCustomQemuResult(ctx context.Context, path string, params []string, fds []*os.File,
+	attr *syscall.SysProcAttr, logger QMPLog) (*LaunchResult, error) {
 	if logger == nil {
 		logger = qmpNullLogger{}
 	}
 
-	errStr := ""
-
 	if path == "" {
-		path = "qemu-system-x86_64"
+		path = defaultQemuPath
 	}
 
 	/* #nosec */
@@ -785,19 +1249,22 @@ func LaunchCustomQemu(ctx context.Context, path string, params []string, fds []*
 		cmd.ExtraFiles = fds
 	}
 
-	// FIXME: non-root user can't run with this set?
-	// cmd.SysProcAttr = attr
+	cmd.SysProcAttr = attr
 
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	stderr := newStderrLogger(logger, params)
+	cmd.Stderr = stderr
 	logger.Infof("launching %s with: %v", path, params)
 
 	err := cmd.Run()
+	stderr.Flush()
+
+	result := newLaunchResult(path, params, cmd.ProcessState)
 	if err != nil {
 		logger.Errorf("Unable to launch %s: %v", path, err)
-		errStr = stderr.String()
-		logger.Errorf("%s", errStr)
+		result.Stderr = stderr.String()
+		logger.Errorf("%s", result.Stderr)
+		err = &LaunchError{Result: result, Err: err}
 	}
 	logger.Infof("LaunchCustomQemu returns")
-	return errStr, err
+	return result, err
 }
@@ -0,0 +1,164 @@
+//go:build !windows
+// +build !windows
+
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultQemuPath is the qemu binary used when Config.Path is not set.
+const defaultQemuPath = "qemu-system-x86_64"
+
+// sysProcAttr returns the process attributes qemu is launched with, the
+// process runs in the Sandbox namespaces and with the configured user and
+// group credentials when RunAs is RunAsCredential.
+func (config *Config) sysProcAttr(logger QMPLog) *syscall.SysProcAttr {
+	attr := syscall.SysProcAttr{}
+	config.Sandbox.applySysProcAttr(&attr)
+	if config.RunAs != RunAsCredential {
+		return &attr
+	}
+
+	attr.Credential = &syscall.Credential{
+		Uid:    config.Uid,
+		Gid:    config.Gid,
+		Groups: config.Groups,
+	}
+	logger.Infof("Running VM as: uid=%d gid=%d groups=%v", config.Uid, config.Gid, config.Groups)
+
+	return &attr
+}
+
+// checkKVMAccess returns an error if the current user cannot open /dev/kvm
+// read-write, taking ACLs into account.
+func checkKVMAccess() error {
+	if err := unix.Access(kvmDevice, unix.R_OK|unix.W_OK); err != nil {
+		return fmt.Errorf("%s is not readable and writable: %v", kvmDevice, err)
+	}
+	return nil
+}
+
+// checkKVMUserAccess returns an error if the user uid, with the groups gid
+// and groups, may not open /dev/kvm read-write. Only the mode bits are
+// checked, ACLs are ignored.
+func checkKVMUserAccess(uid, gid uint32, groups []uint32) error {
+	info, err := os.Stat(kvmDevice)
+	if err != nil {
+		return fmt.Errorf("Failed to access %s: %v", kvmDevice, err)
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || uid == 0 {
+		return nil
+	}
+
+	mode := info.Mode().Perm()
+	inGroup := st.Gid == gid
+	for _, g := range groups {
+		inGroup = inGroup || st.Gid == g
+	}
+
+	switch {
+	case st.Uid == uid:
+		mode >>= 6
+	case inGroup:
+		mode >>= 3
+	}
+	if mode&06 != 06 {
+		return fmt.Errorf("%s is not readable and writable by uid=%d gid=%d groups=%v", kvmDevice, uid, gid, groups)
+	}
+
+	return nil
+}
+
+// processCmdline returns the command line of the process pid, read from
+// /proc. It returns an error satisfying os.IsNotExist if the process does
+// not exist.
+func processCmdline(pid int) ([]string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		if os.IsNotExist(err) && !PathExists("/proc/self/cmdline") {
+			return nil, errProcessUnsupported
+		}
+		return nil, err
+	}
+	// a zombie has an empty command line
+	if len(data) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return strings.Split(string(bytes.TrimRight(data, "\x00")), "\x00"), nil
+}
+
+// userHZ is the unit of the /proc cpu times, USER_HZ on linux.
+const userHZ = 100
+
+// readProcessStats returns the cpu times and memory usage of the process
+// pid, read from /proc/<pid>/stat.
+func readProcessStats(pid int) (ProcessStats, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		if os.IsNotExist(err) && !PathExists("/proc/self/stat") {
+			return ProcessStats{}, errProcessUnsupported
+		}
+		return ProcessStats{}, err
+	}
+
+	// the command name may contain spaces and parentheses, the fields
+	// following it start after the last parenthesis with the state field
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return ProcessStats{}, fmt.Errorf("Failed to parse /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return ProcessStats{}, fmt.Errorf("Failed to parse /proc/%d/stat: %d fields", pid, len(fields))
+	}
+
+	var values [4]uint64
+	// utime, stime, num_threads and rss
+	for i, field := range []int{11, 12, 17, 21} {
+		values[i], err = strconv.ParseUint(fields[field], 10, 64)
+		if err != nil {
+			return ProcessStats{}, fmt.Errorf("Failed to parse /proc/%d/stat: %v", pid, err)
+		}
+	}
+
+	return ProcessStats{
+		UserTime:   time.Duration(values[0]) * time.Second / userHZ,
+		SystemTime: time.Duration(values[1]) * time.Second / userHZ,
+		Threads:    int(values[2]),
+		RSS:        values[3] * uint64(os.Getpagesize()),
+	}, nil
+}
@@ -0,0 +1,62 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"syscall"
+)
+
+// defaultQemuPath is the qemu binary used when Config.Path is not set.
+const defaultQemuPath = "qemu-system-x86_64.exe"
+
+// sysProcAttr returns the process attributes qemu is launched with. Windows
+// has no uid/gid credentials, qemu runs as the calling user.
+func (config *Config) sysProcAttr(logger QMPLog) *syscall.SysProcAttr {
+	if config.Uid != 0 || config.Gid != 0 || len(config.Groups) > 0 {
+		logger.Warningf("Ignoring uid=%d gid=%d groups=%v, not supported on windows", config.Uid, config.Gid, config.Groups)
+	}
+
+	return &syscall.SysProcAttr{}
+}
+
+// checkKVMAccess always succeeds, windows has no kvm.
+func checkKVMAccess() error {
+	return nil
+}
+
+// checkKVMUserAccess always succeeds, windows has no kvm.
+func checkKVMUserAccess(uid, gid uint32, groups []uint32) error {
+	return nil
+}
+
+// processCmdline is not supported on windows.
+func processCmdline(pid int) ([]string, error) {
+	return nil, errProcessUnsupported
+}
+
+// readProcessStats is not supported on windows.
+func readProcessStats(pid int) (ProcessStats, error) {
+	return ProcessStats{}, errProcessUnsupported
+}
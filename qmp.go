@@ -26,11 +26,13 @@ import (
 	"net"
 	"os"
 	"strconv"
-	"syscall"
+	"sync"
 	"time"
 
 	"context"
 	"strings"
+
+	"github.com/project-machine/qcli/diskimage"
 )
 
 // QMPLog is a logging interface used by the qemu package to log various
@@ -87,8 +89,43 @@ type QMPConfig struct {
 
 	// specify the capacity of buffer used by receive QMP response.
 	MaxCapacity int
+
+	// Timeout, if non-zero, is applied to every QMP command whose
+	// context does not already carry a deadline so that a hung monitor
+	// cannot block callers forever.
+	Timeout time.Duration
+
+	// Reconnect causes the QMP loop started by QMPStart to redial the
+	// socket when the connection is lost rather than closing the
+	// disconnectedCh.  Commands outstanding when the connection breaks
+	// fail, and qmp_capabilities is re-sent once the new connection has
+	// been greeted so that later commands can proceed.
+	Reconnect bool
+
+	// ReconnectDelay is the time to wait between attempts to redial the
+	// socket.  It defaults to DefaultQMPReconnectDelay.
+	ReconnectDelay time.Duration
+
+	// ReconnectTimeout bounds the time spent redialing the socket after
+	// the connection is lost.  Once it expires the QMP loop exits and
+	// the disconnectedCh is closed.  It defaults to
+	// DefaultQMPReconnectTimeout so that callers do not wait forever
+	// for a qemu instance which has exited.
+	ReconnectTimeout time.Duration
+
+	// AllowHMP enables ExecuteHumanMonitorCommand.  HMP output is not a
+	// stable interface, so callers must opt in to using it.
+	AllowHMP bool
 }
 
+// DefaultQMPReconnectDelay is the delay between attempts to redial a QMP
+// socket when QMPConfig.ReconnectDelay is not set.
+const DefaultQMPReconnectDelay = 500 * time.Millisecond
+
+// DefaultQMPReconnectTimeout is the time spent redialing a QMP socket when
+// QMPConfig.ReconnectTimeout is not set.
+const DefaultQMPReconnectTimeout = 30 * time.Second
+
 type qmpEventFilter struct {
 	eventName string
 	dataKey   string
@@ -113,6 +150,108 @@ type QMPEvent struct {
 	Timestamp time.Time
 }
 
+// GuestPanicInfo is the hypervisor specific panic information of a
+// GUEST_PANICKED event.
+type GuestPanicInfo struct {
+	// Type is the kind of information, hyper-v or s390
+	Type string `json:"type"`
+
+	// Arg1 to Arg5 are the Hyper-V crash parameters
+	Arg1 uint64 `json:"arg1,omitempty"`
+	Arg2 uint64 `json:"arg2,omitempty"`
+	Arg3 uint64 `json:"arg3,omitempty"`
+	Arg4 uint64 `json:"arg4,omitempty"`
+	Arg5 uint64 `json:"arg5,omitempty"`
+
+	// Core, PSWMask, PSWAddr and Reason describe an s390 crash
+	Core    uint32 `json:"core,omitempty"`
+	PSWMask uint64 `json:"psw-mask,omitempty"`
+	PSWAddr uint64 `json:"psw-addr,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// GuestPanickedEvent is the data of a GUEST_PANICKED or GUEST_CRASHLOADED
+// event, raised by the pvpanic device, Hyper-V crash MSRs or s390 diag.
+type GuestPanickedEvent struct {
+	// Action is what qemu did with the guest: pause, poweroff or run
+	Action string `json:"action"`
+
+	// Info is the panic information, if the hypervisor interface
+	// provides it
+	Info *GuestPanicInfo `json:"info,omitempty"`
+}
+
+// GuestPanicked returns the panic details of a GUEST_PANICKED or
+// GUEST_CRASHLOADED event.
+func (ev QMPEvent) GuestPanicked() (*GuestPanickedEvent, error) {
+	if ev.Name != "GUEST_PANICKED" && ev.Name != "GUEST_CRASHLOADED" {
+		return nil, fmt.Errorf("%s is not a guest panic event", ev.Name)
+	}
+
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract guest panic information: %v", err)
+	}
+
+	var panicked GuestPanickedEvent
+	if err = json.Unmarshal(data, &panicked); err != nil {
+		return nil, fmt.Errorf("unable to convert json to guest panic information: %v", err)
+	}
+
+	return &panicked, nil
+}
+
+// BlockWriteThresholdEvent is the data of a BLOCK_WRITE_THRESHOLD event,
+// raised once when the guest writes past the threshold set with
+// ExecuteBlockSetWriteThreshold.
+type BlockWriteThresholdEvent struct {
+	// NodeName is the block node whose threshold was exceeded
+	NodeName string `json:"node-name"`
+
+	// AmountExceeded is the number of bytes written past the threshold
+	AmountExceeded uint64 `json:"amount-exceeded"`
+
+	// WriteThreshold is the threshold that was exceeded
+	WriteThreshold uint64 `json:"write-threshold"`
+}
+
+// BlockWriteThreshold returns the details of a BLOCK_WRITE_THRESHOLD event.
+func (ev QMPEvent) BlockWriteThreshold() (*BlockWriteThresholdEvent, error) {
+	if ev.Name != "BLOCK_WRITE_THRESHOLD" {
+		return nil, fmt.Errorf("%s is not a block write threshold event", ev.Name)
+	}
+
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract write threshold information: %v", err)
+	}
+
+	var threshold BlockWriteThresholdEvent
+	if err = json.Unmarshal(data, &threshold); err != nil {
+		return nil, fmt.Errorf("unable to convert json to write threshold information: %v", err)
+	}
+
+	return &threshold, nil
+}
+
+// RunState returns the run state the guest enters on this event and true,
+// or false if the event does not change the run state.
+func (ev QMPEvent) RunState() (RunState, bool) {
+	switch ev.Name {
+	case "STOP":
+		return RunStatePaused, true
+	case "RESUME", "WAKEUP":
+		return RunStateRunning, true
+	case "SUSPEND", "SUSPEND_DISK":
+		return RunStateSuspended, true
+	case "SHUTDOWN":
+		return RunStateShutdown, true
+	case "GUEST_PANICKED":
+		return RunStateGuestPanicked, true
+	}
+	return RunStateUnknown, false
+}
+
 type qmpResult struct {
 	response interface{}
 	err      error
@@ -136,7 +275,53 @@ type QMP struct {
 	cfg            QMPConfig
 	connectedCh    chan<- *QMPVersion
 	disconnectedCh chan struct{}
-	version        *QMPVersion
+	socket         string
+
+	// version is refreshed from the greeting of each new connection
+	versionLock sync.Mutex
+	version     *QMPVersion
+}
+
+// QMPErrorClass is the class of an error returned by a QMP command.
+type QMPErrorClass string
+
+const (
+	// QMPErrorGeneric is the class of most errors, only Desc tells them
+	// apart.
+	QMPErrorGeneric QMPErrorClass = "GenericError"
+	// QMPErrorCommandNotFound is returned for a command unknown to qemu,
+	// e.g. a command added by a later qemu version.
+	QMPErrorCommandNotFound QMPErrorClass = "CommandNotFound"
+	// QMPErrorDeviceNotFound is returned when the device or node given to
+	// the command does not exist.
+	QMPErrorDeviceNotFound QMPErrorClass = "DeviceNotFound"
+	// QMPErrorDeviceNotActive is returned when the device given to the
+	// command is not enabled, e.g. a balloon without driver.
+	QMPErrorDeviceNotActive QMPErrorClass = "DeviceNotActive"
+	// QMPErrorKVMMissingCap is returned when the command needs a KVM
+	// capability missing on the host.
+	QMPErrorKVMMissingCap QMPErrorClass = "KVMMissingCap"
+)
+
+// QMPError is the error returned by the QMP methods when qemu reports the
+// command failed.
+type QMPError struct {
+	// Command is the failed QMP command
+	Command string `json:"-"`
+	// Class is the error class
+	Class QMPErrorClass `json:"class"`
+	// Desc is the human readable error description
+	Desc string `json:"desc"`
+}
+
+func (e *QMPError) Error() string {
+	return fmt.Sprintf("QMP command failed: %s", e.Desc)
+}
+
+// IsQMPError returns true if err is, or wraps, a QMPError of the class.
+func IsQMPError(err error, class QMPErrorClass) bool {
+	var qmpErr *QMPError
+	return errors.As(err, &qmpErr) && qmpErr.Class == class
 }
 
 // QMPVersion contains the version number and the capabailities of a QEMU
@@ -155,6 +340,13 @@ type CPUProperties struct {
 	Die    int `json:"die-id"`
 	Core   int `json:"core-id"`
 	Thread int `json:"thread-id"`
+
+	// Cluster is the cluster of the core on arm
+	Cluster int `json:"cluster-id,omitempty"`
+
+	// Book and Drawer are the s390x topology containers of the socket
+	Book   int `json:"book-id,omitempty"`
+	Drawer int `json:"drawer-id,omitempty"`
 }
 
 // HotpluggableCPU represents a hotpluggable CPU
@@ -197,12 +389,235 @@ type CPUInfo struct {
 
 // CPUInfoFast represents information about each virtual CPU
 type CPUInfoFast struct {
-	CPUIndex int           `json:"cpu-index"`
-	QomPath  string        `json:"qom-path"`
-	Arch     string        `json:"arch"`
+	CPUIndex int    `json:"cpu-index"`
+	QomPath  string `json:"qom-path"`
+	// Arch is only returned before qemu 6.0, use Target
+	Arch string `json:"arch"`
+	// ThreadID is the host thread running the vcpu
 	ThreadID int           `json:"thread-id"`
 	Target   string        `json:"target"`
 	Props    CPUProperties `json:"props"`
+
+	// CPUState is the s390x cpu state, e.g. operating or stopped
+	CPUState string `json:"cpu-state,omitempty"`
+}
+
+// CPUDefinition represents a CPU model supported by the qemu binary, as
+// returned by query-cpu-definitions
+type CPUDefinition struct {
+	Name          string `json:"name"`
+	MigrationSafe bool   `json:"migration-safe,omitempty"`
+	Static        bool   `json:"static"`
+	// UnavailableFeatures lists the features preventing the model from
+	// running on this host, the model is usable when it is empty
+	UnavailableFeatures []string `json:"unavailable-features,omitempty"`
+	TypeName            string   `json:"typename"`
+	AliasOf             string   `json:"alias-of,omitempty"`
+	Deprecated          bool     `json:"deprecated"`
+}
+
+// Usable returns true if the CPU model can run on the host it was
+// queried from.
+func (def CPUDefinition) Usable() bool {
+	return len(def.UnavailableFeatures) == 0
+}
+
+// CPUModelInfo represents a CPU model and the properties overriding its
+// defaults, e.g. {"name": "Skylake-Client", "props": {"vmx": false}}
+type CPUModelInfo struct {
+	Name  string                 `json:"name"`
+	Props map[string]interface{} `json:"props,omitempty"`
+}
+
+// CPUModelExpansionType is the kind of expansion done by
+// query-cpu-model-expansion.
+type CPUModelExpansionType string
+
+const (
+	// CPUModelExpansionStatic expands to a static base model and the
+	// properties changed from it, the result is migration safe.
+	CPUModelExpansionStatic CPUModelExpansionType = "static"
+
+	// CPUModelExpansionFull expands to the model with all its properties.
+	CPUModelExpansionFull CPUModelExpansionType = "full"
+)
+
+// ChardevInfo represents a character device backend
+type ChardevInfo struct {
+	Label        string `json:"label"`
+	Filename     string `json:"filename"`
+	FrontendOpen bool   `json:"frontend-open"`
+}
+
+// BalloonInfo represents the guest memory size with the balloon applied
+type BalloonInfo struct {
+	Actual int64 `json:"actual"`
+}
+
+// BlockDeviceStats represents the I/O counters of a block device
+type BlockDeviceStats struct {
+	ReadBytes             uint64 `json:"rd_bytes"`
+	WriteBytes            uint64 `json:"wr_bytes"`
+	ReadOperations        uint64 `json:"rd_operations"`
+	WriteOperations       uint64 `json:"wr_operations"`
+	FlushOperations       uint64 `json:"flush_operations"`
+	ReadTotalTimeNs       uint64 `json:"rd_total_time_ns"`
+	WriteTotalTimeNs      uint64 `json:"wr_total_time_ns"`
+	FlushTotalTimeNs      uint64 `json:"flush_total_time_ns"`
+	WriteHighestOffset    uint64 `json:"wr_highest_offset"`
+	FailedReadOperations  uint64 `json:"failed_rd_operations"`
+	FailedWriteOperations uint64 `json:"failed_wr_operations"`
+}
+
+// BlockDeviceInfo represents the block node inserted in a block device,
+// as returned by query-block and query-named-block-nodes
+type BlockDeviceInfo struct {
+	File           string               `json:"file"`
+	NodeName       string               `json:"node-name"`
+	ReadOnly       bool                 `json:"ro"`
+	Driver         string               `json:"drv"`
+	BackingFile    string               `json:"backing_file"`
+	Encrypted      bool                 `json:"encrypted"`
+	WriteThreshold uint64               `json:"write_threshold"`
+	Image          *diskimage.ImageInfo `json:"image"`
+}
+
+// BlockInfo represents a block device returned by query-block
+type BlockInfo struct {
+	Device    string           `json:"device"`
+	QDev      string           `json:"qdev"`
+	Type      string           `json:"type"`
+	Removable bool             `json:"removable"`
+	Locked    bool             `json:"locked"`
+	TrayOpen  bool             `json:"tray_open"`
+	Inserted  *BlockDeviceInfo `json:"inserted"`
+}
+
+// BlockStats represents the statistics of a block device returned by
+// query-blockstats
+type BlockStats struct {
+	Device   string           `json:"device"`
+	NodeName string           `json:"node-name"`
+	QDev     string           `json:"qdev"`
+	Stats    BlockDeviceStats `json:"stats"`
+
+	// Parent is the protocol node the node stores its data in, e.g.
+	// the file child of a qcow2 node
+	Parent *BlockStats `json:"parent"`
+}
+
+// RxFilterInfo represents the receive filter of a guest NIC
+type RxFilterInfo struct {
+	Name              string   `json:"name"`
+	Promiscuous       bool     `json:"promiscuous"`
+	Multicast         string   `json:"multicast"`
+	Unicast           string   `json:"unicast"`
+	VLAN              string   `json:"vlan"`
+	BroadcastAllowed  bool     `json:"broadcast-allowed"`
+	MulticastOverflow bool     `json:"multicast-overflow"`
+	UnicastOverflow   bool     `json:"unicast-overflow"`
+	MainMAC           string   `json:"main-mac"`
+	VLANTable         []int    `json:"vlan-table"`
+	UnicastTable      []string `json:"unicast-table"`
+	MulticastTable    []string `json:"multicast-table"`
+}
+
+// TraceEventInfo represents the state of a trace event
+type TraceEventInfo struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	VCPU  bool   `json:"vcpu"`
+}
+
+// NBDServerAddr is the address the built-in NBD server listens on,
+// either a unix socket Path or a TCP Host and Port.
+type NBDServerAddr struct {
+	Path string
+	Host string
+	Port string
+}
+
+// BlockDirtyBitmap describes a dirty bitmap tracking the writes to a
+// block node, used for incremental backups.
+type BlockDirtyBitmap struct {
+	// Node is the block device or node name the bitmap is attached to.
+	Node string
+	// Name is the bitmap name, unique per Node.
+	Name string
+	// Granularity is the bitmap granularity in bytes, must be a power of
+	// 2, 0 lets qemu pick one.
+	Granularity uint32
+	// Persistent stores the bitmap in the qcow2 image on shutdown.
+	Persistent bool
+	// Disabled creates the bitmap without recording writes.
+	Disabled bool
+}
+
+// BackupSyncMode is the sync mode of a blockdev-backup job.
+type BackupSyncMode string
+
+const (
+	// BackupSyncFull copies the whole disk.
+	BackupSyncFull BackupSyncMode = "full"
+	// BackupSyncTop copies only the sectors allocated in the top image.
+	BackupSyncTop BackupSyncMode = "top"
+	// BackupSyncNone copies only the sectors written while the job runs.
+	BackupSyncNone BackupSyncMode = "none"
+	// BackupSyncIncremental copies the sectors marked dirty in Bitmap and
+	// clears the bitmap on success.
+	BackupSyncIncremental BackupSyncMode = "incremental"
+	// BackupSyncBitmap copies the sectors marked dirty in Bitmap and
+	// handles the bitmap according to BitmapMode.
+	BackupSyncBitmap BackupSyncMode = "bitmap"
+)
+
+// BlockdevBackup describes a blockdev-backup job.
+type BlockdevBackup struct {
+	// JobID identifies the block job.
+	JobID string
+	// Device is the block device or node name to back up.
+	Device string
+	// Target is the node name of the backup destination.
+	Target string
+	// Sync is the backup sync mode.
+	Sync BackupSyncMode
+	// Bitmap is the dirty bitmap name, required by
+	// BackupSyncIncremental and BackupSyncBitmap.
+	Bitmap string
+	// BitmapMode is the bitmap handling after the job, one of
+	// on-success, never or always, only used with BackupSyncBitmap.
+	BitmapMode string
+}
+
+// JobInfo represents the state of a background job, e.g., snapshot-save
+type JobInfo struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	Status          string `json:"status"`
+	CurrentProgress int64  `json:"current-progress"`
+	TotalProgress   int64  `json:"total-progress"`
+	Error           string `json:"error,omitempty"`
+}
+
+// DumpGuestMemoryFormat is the file format of a guest memory dump
+type DumpGuestMemoryFormat string
+
+const (
+	// DumpFormatELF is an ELF core file, readable by gdb and crash
+	DumpFormatELF DumpGuestMemoryFormat = "elf"
+	// DumpFormatKdumpZlib is a zlib compressed kdump file, readable by crash
+	DumpFormatKdumpZlib DumpGuestMemoryFormat = "kdump-zlib"
+	// DumpFormatKdumpLZO is a lzo compressed kdump file
+	DumpFormatKdumpLZO DumpGuestMemoryFormat = "kdump-lzo"
+	// DumpFormatKdumpSnappy is a snappy compressed kdump file
+	DumpFormatKdumpSnappy DumpGuestMemoryFormat = "kdump-snappy"
+)
+
+// DumpInfo represents the progress of a detached guest memory dump
+type DumpInfo struct {
+	Status    string `json:"status"`
+	Completed int64  `json:"completed"`
+	Total     int64  `json:"total"`
 }
 
 // MigrationRAM represents migration ram status
@@ -342,6 +757,9 @@ func (q *QMP) finaliseCommandWithResponse(cmdEl *list.Element, cmdQueue *list.Li
 	default:
 		if succeeded {
 			cmd.res <- qmpResult{response: response}
+		} else if qmpErr, ok := response.(*QMPError); ok {
+			qmpErr.Command = cmd.name
+			cmd.res <- qmpResult{err: qmpErr}
 		} else {
 			cmd.res <- qmpResult{err: fmt.Errorf("QMP command failed: %v", response)}
 		}
@@ -355,21 +773,21 @@ func (q *QMP) finaliseCommand(cmdEl *list.Element, cmdQueue *list.List, succeede
 	q.finaliseCommandWithResponse(cmdEl, cmdQueue, succeeded, nil)
 }
 
-func (q *QMP) errorDesc(errorData interface{}) (string, error) {
+func (q *QMP) qmpError(errorData interface{}) (*QMPError, error) {
 	// convert error to json
 	data, err := json.Marshal(errorData)
 	if err != nil {
-		return "", fmt.Errorf("unable to extract error information: %v", err)
+		return nil, fmt.Errorf("unable to extract error information: %v", err)
 	}
 
 	// see: https://github.com/qemu/qemu/blob/stable-2.12/qapi/qmp-dispatch.c#L125
-	var qmpErr map[string]string
+	var qmpErr QMPError
 	// convert json to qmpError
 	if err = json.Unmarshal(data, &qmpErr); err != nil {
-		return "", fmt.Errorf("unable to convert json to qmpError: %v", err)
+		return nil, fmt.Errorf("unable to convert json to qmpError: %v", err)
 	}
 
-	return qmpErr["desc"], nil
+	return &qmpErr, nil
 }
 
 func (q *QMP) processQMPInput(line []byte, cmdQueue *list.List) {
@@ -401,11 +819,11 @@ func (q *QMP) processQMPInput(line []byte, cmdQueue *list.List) {
 	cmd := cmdEl.Value.(*qmpCommand)
 	if failed || cmd.filter == nil {
 		if errData != nil {
-			desc, err := q.errorDesc(errData)
+			qmpErr, err := q.qmpError(errData)
 			if err != nil {
 				q.cfg.Logger.Infof("Get error description failed: %v", err)
 			} else {
-				response = desc
+				response = qmpErr
 			}
 		}
 		q.finaliseCommandWithResponse(cmdEl, cmdQueue, succeeded, response)
@@ -454,13 +872,11 @@ func (q *QMP) writeNextQMPCommand(cmdQueue *list.List) {
 	}
 }
 
-func failOutstandingCommands(cmdQueue *list.List) {
+func failOutstandingCommands(cmdQueue *list.List, err error) {
 	for e := cmdQueue.Front(); e != nil; e = e.Next() {
 		cmd := e.Value.(*qmpCommand)
 		select {
-		case cmd.res <- qmpResult{
-			err: errors.New("exitting QMP loop, command cancelled"),
-		}:
+		case cmd.res <- qmpResult{err: err}:
 		case <-cmd.ctx.Done():
 		}
 	}
@@ -547,20 +963,33 @@ func (q *QMP) mainLoop() {
 	fromVMCh := make(chan []byte)
 	go q.readLoop(fromVMCh)
 
+	var reconnectCh <-chan io.ReadWriteCloser
+	reconnectCtx, cancelReconnect := context.WithCancel(context.Background())
+
 	defer func() {
+		cancelReconnect()
+		if reconnectCh != nil {
+			if conn, ok := <-reconnectCh; ok {
+				/* #nosec */
+				_ = conn.Close()
+			}
+		}
 		if q.cfg.EventCh != nil {
 			close(q.cfg.EventCh)
 		}
 		/* #nosec */
 		_ = q.conn.Close()
-		<-fromVMCh
-		failOutstandingCommands(cmdQueue)
+		if fromVMCh != nil {
+			<-fromVMCh
+		}
+		failOutstandingCommands(cmdQueue, errors.New("exitting QMP loop, command cancelled"))
 		close(q.disconnectedCh)
 	}()
 
 	var cmdDoneCh <-chan struct{}
 	var version *QMPVersion
 	ready := false
+	reconnected := false
 
 	for {
 		select {
@@ -581,7 +1010,19 @@ func (q *QMP) mainLoop() {
 
 		case line, ok := <-fromVMCh:
 			if !ok {
-				return
+				if !q.cfg.Reconnect || q.socket == "" {
+					return
+				}
+				q.cfg.Logger.Warningf("Lost connection to QMP socket (%s), reconnecting", q.socket)
+				fromVMCh = nil
+				/* #nosec */
+				_ = q.conn.Close()
+				failOutstandingCommands(cmdQueue, errors.New("lost connection to QMP socket, command cancelled"))
+				cmdQueue.Init()
+				cmdDoneCh = nil
+				ready = false
+				reconnectCh = q.reconnect(reconnectCtx)
+				break
 			}
 
 			if !ready {
@@ -590,17 +1031,45 @@ func (q *QMP) mainLoop() {
 				// hence it's not a guarantee that the first data read from
 				// the channel is the QMP version.
 				version = q.parseVersion(line)
-				if version != nil {
+				if version == nil {
+					// Do not process QMP input to avoid deadlocks.
+					break
+				}
+				ready = true
+				if !reconnected {
 					q.connectedCh <- version
-					ready = true
+					break
 				}
-				// Do not process QMP input to avoid deadlocks.
+
+				q.setVersion(version)
+
+				// A new connection must negotiate capabilities
+				// before any of the queued commands can run.
+				cmdQueue.PushFront(&qmpCommand{
+					ctx:  context.Background(),
+					res:  make(chan qmpResult, 1),
+					name: "qmp_capabilities",
+				})
+				q.writeNextQMPCommand(cmdQueue)
+				cmdDoneCh = currentCommandDoneCh(cmdQueue)
 				break
 			}
 
 			q.processQMPInput(line, cmdQueue)
 			cmdDoneCh = currentCommandDoneCh(cmdQueue)
 
+		case conn, ok := <-reconnectCh:
+			reconnectCh = nil
+			if !ok {
+				q.cfg.Logger.Errorf("Unable to reconnect to QMP socket (%s)", q.socket)
+				return
+			}
+			q.cfg.Logger.Infof("Reconnected to QMP socket (%s)", q.socket)
+			q.conn = conn
+			reconnected = true
+			fromVMCh = make(chan []byte)
+			go q.readLoop(fromVMCh)
+
 		case <-cmdDoneCh:
 			q.cancelCurrentCommand(cmdQueue)
 			cmdDoneCh = currentCommandDoneCh(cmdQueue)
@@ -608,14 +1077,59 @@ func (q *QMP) mainLoop() {
 	}
 }
 
+// reconnect redials the QMP socket in the background until it succeeds,
+// ctx is cancelled or QMPConfig.ReconnectTimeout expires.  The new
+// connection is sent on the returned channel, which is closed without a
+// value if the socket could not be redialed.
+func (q *QMP) reconnect(ctx context.Context) <-chan io.ReadWriteCloser {
+	connCh := make(chan io.ReadWriteCloser, 1)
+	delay := q.cfg.ReconnectDelay
+	if delay <= 0 {
+		delay = DefaultQMPReconnectDelay
+	}
+
+	timeout := q.cfg.ReconnectTimeout
+	if timeout <= 0 {
+		timeout = DefaultQMPReconnectTimeout
+	}
+
+	go func() {
+		defer close(connCh)
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		for {
+			conn, err := dialQMP(ctx, q.socket)
+			if err == nil {
+				connCh <- conn
+				return
+			}
+			q.cfg.Logger.Infof("Unable to reconnect to QMP socket (%s): %v", q.socket, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+	}()
+	return connCh
+}
+
 func startQMPLoop(conn io.ReadWriteCloser, cfg QMPConfig,
 	connectedCh chan<- *QMPVersion, disconnectedCh chan struct{}) *QMP {
+	return startQMPLoopWithSocket(conn, cfg, connectedCh, disconnectedCh, "")
+}
+
+// startQMPLoopWithSocket is startQMPLoop for a connection dialed from
+// socket, which is redialed when QMPConfig.Reconnect is set.
+func startQMPLoopWithSocket(conn io.ReadWriteCloser, cfg QMPConfig,
+	connectedCh chan<- *QMPVersion, disconnectedCh chan struct{}, socket string) *QMP {
 	q := &QMP{
 		cmdCh:          make(chan qmpCommand),
 		conn:           conn,
 		cfg:            cfg,
 		connectedCh:    connectedCh,
 		disconnectedCh: disconnectedCh,
+		socket:         socket,
 	}
 	go q.mainLoop()
 	return q
@@ -625,8 +1139,15 @@ func (q *QMP) executeCommandWithResponse(ctx context.Context, name string, args
 	oob []byte, filter *qmpEventFilter) (interface{}, error) {
 	var err error
 	var response interface{}
+	if _, ok := ctx.Deadline(); !ok && q.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.cfg.Timeout)
+		defer cancel()
+	}
 	resCh := make(chan qmpResult)
 	select {
+	case <-ctx.Done():
+		err = ctx.Err()
 	case <-q.disconnectedCh:
 		err = errors.New("exitting QMP loop, command cancelled")
 	case q.cmdCh <- qmpCommand{
@@ -676,6 +1197,8 @@ func (q *QMP) executeCommand(ctx context.Context, name string, args map[string]i
 // by the caller.  It is closed when an error occurs openning or writing to
 // or reading from the unix domain socket.  This implies that the QEMU instance
 // that opened the socket has closed.
+// If cfg.Reconnect is set the socket is instead redialed, and disconnectedCh
+// is only closed once cfg.ReconnectTimeout expires without a new connection.
 //
 // If this function returns without error, callers should call QMP.Shutdown
 // when they wish to stop monitoring the QMP instance.  This is not strictly
@@ -696,17 +1219,17 @@ func QMPStart(ctx context.Context, socket string, cfg QMPConfig, disconnectedCh
 	if cfg.Logger == nil {
 		cfg.Logger = qmpNullLogger{}
 	}
-	dialer := net.Dialer{Cancel: ctx.Done()}
-	conn, err := dialer.Dial("unix", socket)
+	conn, err := dialQMP(ctx, socket)
 	if err != nil {
-		cfg.Logger.Warningf("Unable to connect to unix socket (%s): %v", socket, err)
+		cfg.Logger.Warningf("Unable to connect to QMP socket (%s): %v", socket, err)
 		close(disconnectedCh)
 		return nil, nil, err
 	}
 
 	connectedCh := make(chan *QMPVersion)
 
-	q := startQMPLoop(conn, cfg, connectedCh, disconnectedCh)
+	q := startQMPLoopWithSocket(conn, cfg, connectedCh, disconnectedCh, socket)
+	var version *QMPVersion
 	select {
 	case <-ctx.Done():
 		q.Shutdown()
@@ -714,17 +1237,34 @@ func QMPStart(ctx context.Context, socket string, cfg QMPConfig, disconnectedCh
 		return nil, nil, fmt.Errorf("canceled by caller")
 	case <-disconnectedCh:
 		return nil, nil, fmt.Errorf("lost connection to VM")
-	case q.version = <-connectedCh:
-		if q.version == nil {
+	case version = <-connectedCh:
+		if version == nil {
 			return nil, nil, fmt.Errorf("failed to find QMP version information")
 		}
 	}
 
-	if q.version.Major < 4 {
-		return nil, nil, fmt.Errorf("requires qemu version 4.0 or later, this is qemu (%d.%d)", q.version.Major, q.version.Minor)
+	if version.Major < 4 {
+		return nil, nil, fmt.Errorf("requires qemu version 4.0 or later, this is qemu (%d.%d)", version.Major, version.Minor)
 	}
+	q.setVersion(version)
+
+	return q, version, nil
+}
+
+// qemuVersion returns the version of the qemu instance greeting the
+// current connection.
+func (q *QMP) qemuVersion() *QMPVersion {
+	q.versionLock.Lock()
+	defer q.versionLock.Unlock()
 
-	return q, q.version, nil
+	return q.version
+}
+
+func (q *QMP) setVersion(version *QMPVersion) {
+	q.versionLock.Lock()
+	defer q.versionLock.Unlock()
+
+	q.version = version
 }
 
 // Shutdown closes the domain socket used to monitor a QEMU instance and
@@ -929,6 +1469,34 @@ func (q *QMP) ExecuteBlockdevDel(ctx context.Context, blockdevID string) error {
 	return q.executeCommand(ctx, "blockdev-del", args, nil)
 }
 
+// ExecuteBlockdevChangeMedium replaces the medium of the removable drive
+// device, e.g. a cdrom, with filename using the blockdev-change-medium
+// command. format is the image format, probed by qemu when empty.
+func (q *QMP) ExecuteBlockdevChangeMedium(ctx context.Context, device, filename, format string) error {
+	args := map[string]interface{}{
+		"device":   device,
+		"filename": filename,
+	}
+	if format != "" {
+		args["format"] = format
+	}
+
+	return q.executeCommand(ctx, "blockdev-change-medium", args, nil)
+}
+
+// ExecuteEject ejects the medium of the removable drive device. force
+// ejects it even if the guest locked the tray.
+func (q *QMP) ExecuteEject(ctx context.Context, device string, force bool) error {
+	args := map[string]interface{}{
+		"device": device,
+	}
+	if force {
+		args["force"] = true
+	}
+
+	return q.executeCommand(ctx, "eject", args, nil)
+}
+
 // ExecuteChardevDel deletes a char device by sending a chardev-remove command.
 // chardevID is the id of the char device to be deleted. Typically, this will
 // match the id passed to ExecuteCharDevUnixSocketAdd. It must be a valid QMP id.
@@ -1309,6 +1877,21 @@ func (q *QMP) ExecSetMigrateArguments(ctx context.Context, url string) error {
 	return q.executeCommand(ctx, "migrate", args, nil)
 }
 
+// ExecuteMigrationSetTLS sets the TLS credentials used by the migration
+// channel, credsID is the ID of a TLSCredsObject defined in Config with
+// Endpoint=client on the source and Endpoint=server on the destination.
+// hostname is used to validate the destination certificate, it may be
+// empty if the migration uri contains a hostname.  An empty credsID
+// disables TLS.
+func (q *QMP) ExecuteMigrationSetTLS(ctx context.Context, credsID, hostname string) error {
+	args := map[string]interface{}{
+		"tls-creds":    credsID,
+		"tls-hostname": hostname,
+	}
+
+	return q.executeCommand(ctx, "migrate-set-parameters", args, nil)
+}
+
 // ExecQueryMemoryDevices returns a slice with the list of memory devices
 func (q *QMP) ExecQueryMemoryDevices(ctx context.Context) ([]MemoryDevices, error) {
 	response, err := q.executeCommandWithResponse(ctx, "query-memory-devices", nil, nil, nil)
@@ -1334,6 +1917,8 @@ func (q *QMP) ExecQueryMemoryDevices(ctx context.Context) ([]MemoryDevices, erro
 // ExecQueryCpus returns a slice with the list of `CpuInfo`
 // Since qemu 2.12, we have `query-cpus-fast` as a better choice in production
 // we can still choose `ExecQueryCpus` for compatibility though not recommended.
+//
+// Deprecated: query-cpus was removed in qemu 6.0, use ExecQueryCpusFast.
 func (q *QMP) ExecQueryCpus(ctx context.Context) ([]CPUInfo, error) {
 	response, err := q.executeCommandWithResponse(ctx, "query-cpus", nil, nil, nil)
 	if err != nil {
@@ -1343,7 +1928,7 @@ func (q *QMP) ExecQueryCpus(ctx context.Context) ([]CPUInfo, error) {
 	// convert response to json
 	data, err := json.Marshal(response)
 	if err != nil {
-		return nil, fmt.Errorf("unable to extract memory devices information: %v", err)
+		return nil, fmt.Errorf("unable to extract cpu information: %v", err)
 	}
 
 	var cpuInfo []CPUInfo
@@ -1367,7 +1952,7 @@ func (q *QMP) ExecQueryCpusFast(ctx context.Context) ([]CPUInfoFast, error) {
 	// convert response to json
 	data, err := json.Marshal(response)
 	if err != nil {
-		return nil, fmt.Errorf("unable to extract memory devices information: %v", err)
+		return nil, fmt.Errorf("unable to extract cpu information: %v", err)
 	}
 
 	var cpuInfoFast []CPUInfoFast
@@ -1379,6 +1964,118 @@ func (q *QMP) ExecQueryCpusFast(ctx context.Context) ([]CPUInfoFast, error) {
 	return cpuInfoFast, nil
 }
 
+// ExecQueryCPUDefinitions returns the CPU models supported by the qemu
+// binary and, for each of them, the features missing on this host.
+func (q *QMP) ExecQueryCPUDefinitions(ctx context.Context) ([]CPUDefinition, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-cpu-definitions", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract cpu definitions: %v", err)
+	}
+
+	var defs []CPUDefinition
+	if err = json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("unable to convert json to CPUDefinition: %v", err)
+	}
+
+	return defs, nil
+}
+
+// ExecQueryCPUModelExpansion expands model into the properties it enables
+// on this host, see CPUModelExpansionType.
+func (q *QMP) ExecQueryCPUModelExpansion(ctx context.Context, expansion CPUModelExpansionType, model CPUModelInfo) (*CPUModelInfo, error) {
+	args := map[string]interface{}{
+		"type":  expansion,
+		"model": model,
+	}
+
+	return q.executeCPUModelCommand(ctx, "query-cpu-model-expansion", args)
+}
+
+// ExecQueryCPUModelBaseline returns a CPU model that is a subset of both
+// modelA and modelB, e.g. the host models of two different hosts. qemu only
+// implements query-cpu-model-baseline on s390x, other targets fail with a
+// QMPErrorCommandNotFound error.
+func (q *QMP) ExecQueryCPUModelBaseline(ctx context.Context, modelA, modelB CPUModelInfo) (*CPUModelInfo, error) {
+	args := map[string]interface{}{
+		"modela": modelA,
+		"modelb": modelB,
+	}
+
+	model, err := q.executeCPUModelCommand(ctx, "query-cpu-model-baseline", args)
+	if IsQMPError(err, QMPErrorCommandNotFound) {
+		return nil, fmt.Errorf("query-cpu-model-baseline is only supported by qemu on s390x: %w", err)
+	}
+
+	return model, err
+}
+
+// BaselineCPUModels folds ExecQueryCPUModelBaseline over models, typically
+// the static expansions of the host model of each host in a cluster, and
+// returns a CPU model that runs on all of them. Like
+// ExecQueryCPUModelBaseline it is only supported by qemu on s390x.
+func (q *QMP) BaselineCPUModels(ctx context.Context, models []CPUModelInfo) (*CPUModelInfo, error) {
+	if len(models) == 0 {
+		return nil, fmt.Errorf("no CPU models to baseline")
+	}
+
+	baseline := models[0]
+	for _, model := range models[1:] {
+		result, err := q.ExecQueryCPUModelBaseline(ctx, baseline, model)
+		if err != nil {
+			return nil, err
+		}
+		baseline = *result
+	}
+
+	return &baseline, nil
+}
+
+func (q *QMP) executeCPUModelCommand(ctx context.Context, name string, args map[string]interface{}) (*CPUModelInfo, error) {
+	response, err := q.executeCommandWithResponse(ctx, name, args, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract cpu model: %v", err)
+	}
+
+	var result struct {
+		Model CPUModelInfo `json:"model"`
+	}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("unable to convert json to CPUModelInfo: %v", err)
+	}
+
+	if result.Model.Name == "" {
+		return nil, fmt.Errorf("%s returned no CPU model", name)
+	}
+
+	return &result.Model, nil
+}
+
+// ExecQueryVCPUThreads returns the host thread id of each vcpu, indexed by
+// the vcpu index, as reported by query-cpus-fast.
+func (q *QMP) ExecQueryVCPUThreads(ctx context.Context) (map[int]int, error) {
+	cpus, err := q.ExecQueryCpusFast(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	threads := make(map[int]int, len(cpus))
+	for _, cpu := range cpus {
+		threads[cpu.CPUIndex] = cpu.ThreadID
+	}
+
+	return threads, nil
+}
+
 // ExecMemdevAdd adds size of MiB memory device to the guest
 func (q *QMP) ExecMemdevAdd(ctx context.Context, qomtype, id, mempath string, size int, share bool, driver, driverID, addr, bus string) error {
 	args := map[string]interface{}{
@@ -1479,6 +2176,30 @@ func (q *QMP) ExecuteBalloon(ctx context.Context, bytes uint64) error {
 	return q.executeCommand(ctx, "balloon", args, nil)
 }
 
+// ExecuteQueryBalloon returns the current guest memory size in bytes, as
+// seen through the balloon device.
+func (q *QMP) ExecuteQueryBalloon(ctx context.Context) (BalloonInfo, error) {
+	var info BalloonInfo
+
+	response, err := q.executeCommandWithResponse(ctx, "query-balloon", nil, nil, nil)
+	if err != nil {
+		return info, err
+	}
+
+	// convert response to json
+	data, err := json.Marshal(response)
+	if err != nil {
+		return info, fmt.Errorf("unable to extract balloon information: %v", err)
+	}
+
+	// convert json to BalloonInfo
+	if err = json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("unable to convert json to BalloonInfo: %v", err)
+	}
+
+	return info, nil
+}
+
 // ExecutePCIVSockAdd adds a vhost-vsock-pci bus
 // disableModern indicates if virtio version 1.0 should be replaced by the
 // former version 0.9, as there is a KVM bug that occurs when using virtio
@@ -1506,12 +2227,15 @@ func (q *QMP) ExecutePCIVSockAdd(ctx context.Context, id, guestCID, vhostfd, add
 
 // ExecuteGetFD sends a file descriptor via SCM rights and assigns it a name
 func (q *QMP) ExecuteGetFD(ctx context.Context, fdname string, fd *os.File) error {
-	oob := syscall.UnixRights(int(fd.Fd()))
+	oob, err := fdRights(fd)
+	if err != nil {
+		return err
+	}
 	args := map[string]interface{}{
 		"fdname": fdname,
 	}
 
-	_, err := q.executeCommandWithResponse(ctx, "getfd", args, oob, nil)
+	_, err = q.executeCommandWithResponse(ctx, "getfd", args, oob, nil)
 	return err
 }
 
@@ -1558,6 +2282,48 @@ func (q *QMP) ExecuteVirtSerialPortAdd(ctx context.Context, id, name, chardev st
 	return q.executeCommand(ctx, "device_add", args, nil)
 }
 
+// ExecuteVirtSerialPortChannelAdd hotplugs a virtserialport channel backed
+// by a listening unix socket.  A chardev with id "chr<id>" is created at
+// path and then a virtserialport with the given id and guest visible name is
+// attached to bus, e.g., the value returned by Config.VirtioSerialBus.  If
+// the device cannot be added the chardev is removed again.
+func (q *QMP) ExecuteVirtSerialPortChannelAdd(ctx context.Context, id, name, path, bus string) error {
+	chardevID := fmt.Sprintf("chr%s", id)
+	if err := q.ExecuteCharDevUnixSocketAdd(ctx, chardevID, path, false, true); err != nil {
+		return err
+	}
+
+	args := map[string]interface{}{
+		"driver":  VirtioSerialPort,
+		"id":      id,
+		"name":    name,
+		"chardev": chardevID,
+	}
+	if bus != "" {
+		args["bus"] = bus
+	}
+
+	if err := q.executeCommand(ctx, "device_add", args, nil); err != nil {
+		if rerr := q.ExecuteChardevDel(ctx, chardevID); rerr != nil {
+			return fmt.Errorf("%v (failed to remove chardev %s: %v)", err, chardevID, rerr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ExecuteVirtSerialPortChannelDel removes a virtserialport channel that was
+// previously added with ExecuteVirtSerialPortChannelAdd.  It blocks until the
+// device has been deleted and then removes the backing chardev.
+func (q *QMP) ExecuteVirtSerialPortChannelDel(ctx context.Context, id string) error {
+	if err := q.ExecuteDeviceDel(ctx, id); err != nil {
+		return err
+	}
+
+	return q.ExecuteChardevDel(ctx, fmt.Sprintf("chr%s", id))
+}
+
 // ExecuteQueryMigration queries migration progress.
 func (q *QMP) ExecuteQueryMigration(ctx context.Context) (MigrationStatus, error) {
 	response, err := q.executeCommandWithResponse(ctx, "query-migrate", nil, nil, nil)
@@ -1586,32 +2352,624 @@ func (q *QMP) ExecuteMigrationIncoming(ctx context.Context, uri string) error {
 	return q.executeCommand(ctx, "migrate-incoming", args, nil)
 }
 
-// ExecQueryQmpSchema query all QMP wire ABI and returns a slice
-func (q *QMP) ExecQueryQmpSchema(ctx context.Context) ([]SchemaInfo, error) {
-	response, err := q.executeCommandWithResponse(ctx, "query-qmp-schema", nil, nil, nil)
-	if err != nil {
-		return nil, err
-	}
+// ExecuteNBDServerStart starts the built-in NBD server listening on addr.
+// tlsCreds is the ID of a server TLSCredsObject defined in Config, it may
+// be empty to disable TLS.
+func (q *QMP) ExecuteNBDServerStart(ctx context.Context, addr NBDServerAddr, tlsCreds string) error {
+	var sockAddr map[string]interface{}
 
-	// convert response to json
-	data, err := json.Marshal(response)
-	if err != nil {
-		return nil, fmt.Errorf("unable to extract memory devices information: %v", err)
+	switch {
+	case addr.Path != "" && (addr.Host != "" || addr.Port != ""):
+		return fmt.Errorf("NBD server address Path and Host/Port are mutually exclusive")
+	case addr.Path != "":
+		sockAddr = map[string]interface{}{
+			"type": "unix",
+			"data": map[string]interface{}{
+				"path": addr.Path,
+			},
+		}
+	case addr.Host != "" && addr.Port != "":
+		sockAddr = map[string]interface{}{
+			"type": "inet",
+			"data": map[string]interface{}{
+				"host": addr.Host,
+				"port": addr.Port,
+			},
+		}
+	default:
+		return fmt.Errorf("NBD server address requires either Path or Host and Port")
 	}
 
-	var schemaInfo []SchemaInfo
-	if err = json.Unmarshal(data, &schemaInfo); err != nil {
-		return nil, fmt.Errorf("unable to convert json to schemaInfo: %v", err)
+	args := map[string]interface{}{
+		"addr": sockAddr,
+	}
+	if tlsCreds != "" {
+		args["tls-creds"] = tlsCreds
 	}
 
-	return schemaInfo, nil
+	return q.executeCommand(ctx, "nbd-server-start", args, nil)
 }
 
-// ExecuteQueryStatus queries guest status
-func (q *QMP) ExecuteQueryStatus(ctx context.Context) (StatusInfo, error) {
-	response, err := q.executeCommandWithResponse(ctx, "query-status", nil, nil, nil)
-	if err != nil {
-		return StatusInfo{}, err
+// ExecuteNBDServerStop stops the built-in NBD server and removes all of
+// its exports.
+func (q *QMP) ExecuteNBDServerStop(ctx context.Context) error {
+	return q.executeCommand(ctx, "nbd-server-stop", nil, nil)
+}
+
+// ExecuteNBDServerAdd exports the block device or node device read-only on
+// the NBD server as name using the legacy nbd-server-add command. bitmap is
+// the name of a dirty bitmap of device to export along with the data, it
+// may be empty. Newer qemu versions should use ExecuteBlockExportAdd.
+func (q *QMP) ExecuteNBDServerAdd(ctx context.Context, device, name, bitmap string) error {
+	args := map[string]interface{}{
+		"device":   device,
+		"writable": false,
+	}
+	if name != "" {
+		args["name"] = name
+	}
+	if bitmap != "" {
+		args["bitmap"] = bitmap
+	}
+
+	return q.executeCommand(ctx, "nbd-server-add", args, nil)
+}
+
+// ExecuteBlockExportAdd exports the block node nodeName read-only on the
+// NBD server as name, id identifies the export for ExecuteBlockExportDel.
+// bitmaps are the names of dirty bitmaps of nodeName to export along with
+// the data.
+func (q *QMP) ExecuteBlockExportAdd(ctx context.Context, id, nodeName, name string, bitmaps []string) error {
+	args := map[string]interface{}{
+		"type":      "nbd",
+		"id":        id,
+		"node-name": nodeName,
+		"writable":  false,
+	}
+	if name != "" {
+		args["name"] = name
+	}
+	if len(bitmaps) > 0 {
+		args["bitmaps"] = bitmaps
+	}
+
+	return q.executeCommand(ctx, "block-export-add", args, nil)
+}
+
+// ExecuteBlockExportDel removes the export id previously added with
+// ExecuteBlockExportAdd. This method blocks until a BLOCK_EXPORT_DELETED
+// event is received for id.
+func (q *QMP) ExecuteBlockExportDel(ctx context.Context, id string) error {
+	args := map[string]interface{}{
+		"id": id,
+	}
+	filter := &qmpEventFilter{
+		eventName: "BLOCK_EXPORT_DELETED",
+		dataKey:   "id",
+		dataValue: id,
+	}
+	return q.executeCommand(ctx, "block-export-del", args, filter)
+}
+
+// ExecuteBlockDirtyBitmapAdd adds a dirty bitmap to a block node.
+func (q *QMP) ExecuteBlockDirtyBitmapAdd(ctx context.Context, bitmap BlockDirtyBitmap) error {
+	args, err := dirtyBitmapAddArgs(bitmap)
+	if err != nil {
+		return err
+	}
+
+	return q.executeCommand(ctx, "block-dirty-bitmap-add", args, nil)
+}
+
+func dirtyBitmapAddArgs(bitmap BlockDirtyBitmap) (map[string]interface{}, error) {
+	if bitmap.Granularity&(bitmap.Granularity-1) != 0 {
+		return nil, fmt.Errorf("BlockDirtyBitmap Granularity %d must be a power of 2", bitmap.Granularity)
+	}
+
+	args := map[string]interface{}{
+		"node": bitmap.Node,
+		"name": bitmap.Name,
+	}
+	if bitmap.Granularity > 0 {
+		args["granularity"] = bitmap.Granularity
+	}
+	if bitmap.Persistent {
+		args["persistent"] = true
+	}
+	if bitmap.Disabled {
+		args["disabled"] = true
+	}
+
+	return args, nil
+}
+
+// ExecuteBlockDirtyBitmapRemove removes the dirty bitmap name from node.
+func (q *QMP) ExecuteBlockDirtyBitmapRemove(ctx context.Context, node, name string) error {
+	return q.executeCommand(ctx, "block-dirty-bitmap-remove", dirtyBitmapArgs(node, name), nil)
+}
+
+// ExecuteBlockDirtyBitmapClear resets all the bits of the dirty bitmap
+// name on node.
+func (q *QMP) ExecuteBlockDirtyBitmapClear(ctx context.Context, node, name string) error {
+	return q.executeCommand(ctx, "block-dirty-bitmap-clear", dirtyBitmapArgs(node, name), nil)
+}
+
+// ExecuteBlockDirtyBitmapEnable starts recording writes in the dirty
+// bitmap name on node.
+func (q *QMP) ExecuteBlockDirtyBitmapEnable(ctx context.Context, node, name string) error {
+	return q.executeCommand(ctx, "block-dirty-bitmap-enable", dirtyBitmapArgs(node, name), nil)
+}
+
+// ExecuteBlockDirtyBitmapDisable stops recording writes in the dirty
+// bitmap name on node.
+func (q *QMP) ExecuteBlockDirtyBitmapDisable(ctx context.Context, node, name string) error {
+	return q.executeCommand(ctx, "block-dirty-bitmap-disable", dirtyBitmapArgs(node, name), nil)
+}
+
+// ExecuteBlockDirtyBitmapMerge merges the dirty bitmaps sources into the
+// bitmap target, all of them attached to node.
+func (q *QMP) ExecuteBlockDirtyBitmapMerge(ctx context.Context, node, target string, sources []string) error {
+	args, err := dirtyBitmapMergeArgs(node, target, sources)
+	if err != nil {
+		return err
+	}
+
+	return q.executeCommand(ctx, "block-dirty-bitmap-merge", args, nil)
+}
+
+func dirtyBitmapMergeArgs(node, target string, sources []string) (map[string]interface{}, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("block-dirty-bitmap-merge requires at least one source bitmap")
+	}
+
+	return map[string]interface{}{
+		"node":    node,
+		"target":  target,
+		"bitmaps": sources,
+	}, nil
+}
+
+func dirtyBitmapArgs(node, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"node": node,
+		"name": name,
+	}
+}
+
+// ExecuteBlockdevBackup starts a blockdev-backup job. The method returns
+// once the job is created, its completion is reported by the
+// BLOCK_JOB_COMPLETED event.
+func (q *QMP) ExecuteBlockdevBackup(ctx context.Context, backup BlockdevBackup) error {
+	args, err := blockdevBackupArgs(backup)
+	if err != nil {
+		return err
+	}
+
+	return q.executeCommand(ctx, "blockdev-backup", args, nil)
+}
+
+func blockdevBackupArgs(backup BlockdevBackup) (map[string]interface{}, error) {
+	switch backup.Sync {
+	case BackupSyncFull, BackupSyncTop, BackupSyncNone:
+	case BackupSyncIncremental, BackupSyncBitmap:
+		if backup.Bitmap == "" {
+			return nil, fmt.Errorf("BlockdevBackup with Sync=%s requires Bitmap", backup.Sync)
+		}
+	default:
+		return nil, fmt.Errorf("Invalid BlockdevBackup Sync value: '%s'", backup.Sync)
+	}
+
+	if backup.BitmapMode != "" && backup.Sync != BackupSyncBitmap {
+		return nil, fmt.Errorf("BlockdevBackup BitmapMode requires Sync=%s", BackupSyncBitmap)
+	}
+
+	args := map[string]interface{}{
+		"device": backup.Device,
+		"target": backup.Target,
+		"sync":   backup.Sync,
+	}
+	if backup.JobID != "" {
+		args["job-id"] = backup.JobID
+	}
+	if backup.Bitmap != "" {
+		args["bitmap"] = backup.Bitmap
+	}
+	if backup.BitmapMode != "" {
+		args["bitmap-mode"] = backup.BitmapMode
+	}
+
+	return args, nil
+}
+
+// TransactionCompletionMode is how the block jobs started by a
+// Transaction complete.
+type TransactionCompletionMode string
+
+const (
+	// TransactionIndividual lets each block job complete on its own, it
+	// is qemu's default.
+	TransactionIndividual TransactionCompletionMode = "individual"
+	// TransactionGrouped cancels all the block jobs if one of them fails.
+	TransactionGrouped TransactionCompletionMode = "grouped"
+)
+
+// Transaction groups block actions run atomically by ExecuteTransaction,
+// e.g. to take a crash-consistent snapshot of several disks. The actions
+// are added with the builder methods, an invalid action is reported by
+// ExecuteTransaction.
+type Transaction struct {
+	// CompletionMode is how the block jobs of the transaction complete,
+	// qemu's default when empty.
+	CompletionMode TransactionCompletionMode
+
+	actions []map[string]interface{}
+	err     error
+}
+
+// NewTransaction returns an empty Transaction.
+func NewTransaction() *Transaction {
+	return &Transaction{}
+}
+
+func (t *Transaction) add(action string, args map[string]interface{}, err error) *Transaction {
+	if err != nil {
+		if t.err == nil {
+			t.err = err
+		}
+		return t
+	}
+
+	t.actions = append(t.actions, map[string]interface{}{
+		"type": action,
+		"data": args,
+	})
+	return t
+}
+
+// BlockdevSnapshotSync adds the creation of the external snapshot
+// snapshotFile, in format, on top of the block device.
+func (t *Transaction) BlockdevSnapshotSync(device, snapshotFile, format string) *Transaction {
+	args := map[string]interface{}{
+		"device":        device,
+		"snapshot-file": snapshotFile,
+	}
+	if format != "" {
+		args["format"] = format
+	}
+
+	var err error
+	if device == "" || snapshotFile == "" {
+		err = fmt.Errorf("blockdev-snapshot-sync requires a device and a snapshot file")
+	}
+	return t.add("blockdev-snapshot-sync", args, err)
+}
+
+// BlockdevSnapshot adds the node overlay, already added with blockdev-add,
+// as an external snapshot on top of node.
+func (t *Transaction) BlockdevSnapshot(node, overlay string) *Transaction {
+	args := map[string]interface{}{
+		"node":    node,
+		"overlay": overlay,
+	}
+
+	var err error
+	if node == "" || overlay == "" {
+		err = fmt.Errorf("blockdev-snapshot requires a node and an overlay")
+	}
+	return t.add("blockdev-snapshot", args, err)
+}
+
+// BlockDirtyBitmapAdd adds the creation of a dirty bitmap, see
+// ExecuteBlockDirtyBitmapAdd.
+func (t *Transaction) BlockDirtyBitmapAdd(bitmap BlockDirtyBitmap) *Transaction {
+	args, err := dirtyBitmapAddArgs(bitmap)
+	return t.add("block-dirty-bitmap-add", args, err)
+}
+
+// BlockDirtyBitmapRemove adds the removal of the dirty bitmap name.
+func (t *Transaction) BlockDirtyBitmapRemove(node, name string) *Transaction {
+	return t.add("block-dirty-bitmap-remove", dirtyBitmapArgs(node, name), nil)
+}
+
+// BlockDirtyBitmapClear adds the reset of the dirty bitmap name, e.g. when
+// a full backup starts.
+func (t *Transaction) BlockDirtyBitmapClear(node, name string) *Transaction {
+	return t.add("block-dirty-bitmap-clear", dirtyBitmapArgs(node, name), nil)
+}
+
+// BlockDirtyBitmapEnable adds the start of the recording of writes in the
+// dirty bitmap name.
+func (t *Transaction) BlockDirtyBitmapEnable(node, name string) *Transaction {
+	return t.add("block-dirty-bitmap-enable", dirtyBitmapArgs(node, name), nil)
+}
+
+// BlockDirtyBitmapDisable adds the stop of the recording of writes in the
+// dirty bitmap name.
+func (t *Transaction) BlockDirtyBitmapDisable(node, name string) *Transaction {
+	return t.add("block-dirty-bitmap-disable", dirtyBitmapArgs(node, name), nil)
+}
+
+// BlockDirtyBitmapMerge adds the merge of the dirty bitmaps sources into
+// target, see ExecuteBlockDirtyBitmapMerge.
+func (t *Transaction) BlockDirtyBitmapMerge(node, target string, sources []string) *Transaction {
+	args, err := dirtyBitmapMergeArgs(node, target, sources)
+	return t.add("block-dirty-bitmap-merge", args, err)
+}
+
+// BlockdevBackup adds the start of a blockdev-backup job, see
+// ExecuteBlockdevBackup.
+func (t *Transaction) BlockdevBackup(backup BlockdevBackup) *Transaction {
+	args, err := blockdevBackupArgs(backup)
+	return t.add("blockdev-backup", args, err)
+}
+
+// args returns the transaction command arguments.
+func (t *Transaction) args() (map[string]interface{}, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	if len(t.actions) == 0 {
+		return nil, fmt.Errorf("Transaction has no actions")
+	}
+
+	args := map[string]interface{}{
+		"actions": t.actions,
+	}
+
+	switch t.CompletionMode {
+	case "":
+	case TransactionIndividual, TransactionGrouped:
+		args["properties"] = map[string]interface{}{
+			"completion-mode": t.CompletionMode,
+		}
+	default:
+		return nil, fmt.Errorf("Invalid Transaction CompletionMode value: '%s', must be one of '%s', '%s'",
+			t.CompletionMode, TransactionIndividual, TransactionGrouped)
+	}
+
+	return args, nil
+}
+
+// ExecuteTransaction runs the actions of the Transaction atomically: if
+// one of them fails none of them is applied. The block jobs started by the
+// transaction complete according to its CompletionMode, see the
+// BLOCK_JOB_COMPLETED event.
+func (q *QMP) ExecuteTransaction(ctx context.Context, t *Transaction) error {
+	args, err := t.args()
+	if err != nil {
+		return err
+	}
+
+	return q.executeCommand(ctx, "transaction", args, nil)
+}
+
+// ExecuteQueryJobs returns the background jobs of the VM.
+func (q *QMP) ExecuteQueryJobs(ctx context.Context) ([]JobInfo, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-jobs", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract job information: %v", err)
+	}
+
+	var jobs []JobInfo
+	if err = json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("unable to convert json to job information: %v", err)
+	}
+
+	return jobs, nil
+}
+
+// ExecuteJobDismiss removes a concluded job from the job list.
+func (q *QMP) ExecuteJobDismiss(ctx context.Context, id string) error {
+	args := map[string]interface{}{
+		"id": id,
+	}
+
+	return q.executeCommand(ctx, "job-dismiss", args, nil)
+}
+
+// ExecuteSnapshotSave starts the job jobID saving the internal snapshot
+// tag. The VM state is saved in the block node vmstate and the disks in
+// devices, which are all the writable disks if empty.
+func (q *QMP) ExecuteSnapshotSave(ctx context.Context, jobID, tag, vmstate string, devices []string) error {
+	return q.executeCommand(ctx, "snapshot-save", snapshotArgs(jobID, tag, vmstate, devices), nil)
+}
+
+// ExecuteSnapshotLoad starts the job jobID loading the internal snapshot
+// tag, see ExecuteSnapshotSave.
+func (q *QMP) ExecuteSnapshotLoad(ctx context.Context, jobID, tag, vmstate string, devices []string) error {
+	return q.executeCommand(ctx, "snapshot-load", snapshotArgs(jobID, tag, vmstate, devices), nil)
+}
+
+// ExecuteSnapshotDelete starts the job jobID deleting the internal
+// snapshot tag from devices.
+func (q *QMP) ExecuteSnapshotDelete(ctx context.Context, jobID, tag string, devices []string) error {
+	return q.executeCommand(ctx, "snapshot-delete", snapshotArgs(jobID, tag, "", devices), nil)
+}
+
+func snapshotArgs(jobID, tag, vmstate string, devices []string) map[string]interface{} {
+	args := map[string]interface{}{
+		"job-id":  jobID,
+		"tag":     tag,
+		"devices": devices,
+	}
+	if devices == nil {
+		args["devices"] = []string{}
+	}
+	if vmstate != "" {
+		args["vmstate"] = vmstate
+	}
+	return args
+}
+
+// jobPollInterval is the interval between query-jobs when waiting for a
+// job to conclude
+var jobPollInterval = 100 * time.Millisecond
+
+// waitJob waits for the job id to conclude, dismisses it and returns its
+// error if any.
+func (q *QMP) waitJob(ctx context.Context, id string) error {
+	for {
+		jobs, err := q.ExecuteQueryJobs(ctx)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, job := range jobs {
+			if job.ID != id {
+				continue
+			}
+			found = true
+			if job.Status != "concluded" {
+				break
+			}
+			if err := q.ExecuteJobDismiss(ctx, id); err != nil {
+				return err
+			}
+			if job.Error != "" {
+				return fmt.Errorf("job %s failed: %s", id, job.Error)
+			}
+			return nil
+		}
+		if !found {
+			return fmt.Errorf("job %s not found", id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// SaveSnapshot saves the internal snapshot tag of the whole VM, its state
+// and all its writable disks, and waits for it to complete. The VM state
+// is stored in the first writable disk. qemu versions older than 6.0 do
+// not have snapshot-save, the HMP savevm command is used instead.
+func (q *QMP) SaveSnapshot(ctx context.Context, tag string) error {
+	if version := q.qemuVersion(); version != nil && version.Major < 6 {
+		return q.executeHMPSnapshot(ctx, "savevm", tag)
+	}
+
+	jobID := fmt.Sprintf("snapshot-save-%s", tag)
+	if err := q.ExecuteSnapshotSave(ctx, jobID, tag, "", nil); err != nil {
+		return err
+	}
+
+	return q.waitJob(ctx, jobID)
+}
+
+// LoadSnapshot reverts the whole VM to the internal snapshot tag and waits
+// for it to complete, see SaveSnapshot.
+func (q *QMP) LoadSnapshot(ctx context.Context, tag string) error {
+	if version := q.qemuVersion(); version != nil && version.Major < 6 {
+		return q.executeHMPSnapshot(ctx, "loadvm", tag)
+	}
+
+	jobID := fmt.Sprintf("snapshot-load-%s", tag)
+	if err := q.ExecuteSnapshotLoad(ctx, jobID, tag, "", nil); err != nil {
+		return err
+	}
+
+	return q.waitJob(ctx, jobID)
+}
+
+// DeleteSnapshot deletes the internal snapshot tag from all the disks and
+// waits for it to complete, see SaveSnapshot.
+func (q *QMP) DeleteSnapshot(ctx context.Context, tag string) error {
+	if version := q.qemuVersion(); version != nil && version.Major < 6 {
+		return q.executeHMPSnapshot(ctx, "delvm", tag)
+	}
+
+	jobID := fmt.Sprintf("snapshot-delete-%s", tag)
+	if err := q.ExecuteSnapshotDelete(ctx, jobID, tag, nil); err != nil {
+		return err
+	}
+
+	return q.waitJob(ctx, jobID)
+}
+
+// executeHMPSnapshot runs the HMP snapshot command savevm, loadvm or delvm,
+// these report errors as text output rather than as a QMP error.
+func (q *QMP) executeHMPSnapshot(ctx context.Context, command, tag string) error {
+	output, err := q.executeHMP(ctx, fmt.Sprintf("%s %s", command, tag))
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(output) != "" {
+		return fmt.Errorf("%s %s failed: %s", command, tag, strings.TrimSpace(output))
+	}
+
+	return nil
+}
+
+// ExecuteHumanMonitorCommand runs the HMP command cmd through
+// human-monitor-command and returns its raw text output.  It is intended
+// for the few operations QMP does not cover and must be enabled with
+// QMPConfig.AllowHMP.
+func (q *QMP) ExecuteHumanMonitorCommand(ctx context.Context, cmd string) (string, error) {
+	if !q.cfg.AllowHMP {
+		return "", fmt.Errorf("human monitor commands are disabled, set QMPConfig.AllowHMP to enable them")
+	}
+
+	if cmd == "" {
+		return "", fmt.Errorf("human monitor command is empty")
+	}
+
+	return q.executeHMP(ctx, cmd)
+}
+
+func (q *QMP) executeHMP(ctx context.Context, cmd string) (string, error) {
+	args := map[string]interface{}{
+		"command-line": cmd,
+	}
+
+	response, err := q.executeCommandWithResponse(ctx, "human-monitor-command", args, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	output, ok := response.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected human-monitor-command output: %v", response)
+	}
+
+	return output, nil
+}
+
+// ExecQueryQmpSchema query all QMP wire ABI and returns a slice
+func (q *QMP) ExecQueryQmpSchema(ctx context.Context) ([]SchemaInfo, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-qmp-schema", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert response to json
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract memory devices information: %v", err)
+	}
+
+	var schemaInfo []SchemaInfo
+	if err = json.Unmarshal(data, &schemaInfo); err != nil {
+		return nil, fmt.Errorf("unable to convert json to schemaInfo: %v", err)
+	}
+
+	return schemaInfo, nil
+}
+
+// ExecuteQueryStatus queries guest status
+func (q *QMP) ExecuteQueryStatus(ctx context.Context) (StatusInfo, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-status", nil, nil, nil)
+	if err != nil {
+		return StatusInfo{}, err
 	}
 
 	data, err := json.Marshal(response)
@@ -1638,6 +2996,13 @@ func (q *QMP) ExecQomSet(ctx context.Context, path, property string, value uint6
 	return q.executeCommand(ctx, "qom-set", args, nil)
 }
 
+// ExecuteVirtioMemResize changes the memory a virtio-mem device provides
+// to the guest, requestedSize is in bytes and must be a multiple of the
+// device block size.
+func (q *QMP) ExecuteVirtioMemResize(ctx context.Context, id string, requestedSize uint64) error {
+	return q.ExecQomSet(ctx, fmt.Sprintf("/machine/peripheral/%s", id), "requested-size", requestedSize)
+}
+
 // ExecQomGet qom-get path property
 func (q *QMP) ExecQomGet(ctx context.Context, path, property string) (interface{}, error) {
 	args := map[string]interface{}{
@@ -1663,3 +3028,278 @@ func (q *QMP) ExecuteDumpGuestMemory(ctx context.Context, protocol string, pagin
 
 	return q.executeCommand(ctx, "dump-guest-memory", args, nil)
 }
+
+// ExecuteDumpGuestMemoryDetach starts dumping the guest memory to protocol,
+// "file:<path>" or "fd:<name>", in the background. paging dumps the guest
+// virtual memory mappings, it is only supported by DumpFormatELF. The
+// progress is reported by ExecuteQueryDump and the DUMP_COMPLETED event.
+func (q *QMP) ExecuteDumpGuestMemoryDetach(ctx context.Context, protocol string, paging bool, format DumpGuestMemoryFormat) error {
+	switch format {
+	case DumpFormatELF:
+	case DumpFormatKdumpZlib, DumpFormatKdumpLZO, DumpFormatKdumpSnappy:
+		if paging {
+			return fmt.Errorf("dump-guest-memory paging is not supported with format %s", format)
+		}
+	default:
+		return fmt.Errorf("Invalid dump-guest-memory format: '%s'", format)
+	}
+
+	args := map[string]interface{}{
+		"protocol": protocol,
+		"paging":   paging,
+		"format":   format,
+		"detach":   true,
+	}
+
+	return q.executeCommand(ctx, "dump-guest-memory", args, nil)
+}
+
+// ExecuteQueryDump returns the progress of the guest memory dump.
+func (q *QMP) ExecuteQueryDump(ctx context.Context) (DumpInfo, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-dump", nil, nil, nil)
+	if err != nil {
+		return DumpInfo{}, err
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return DumpInfo{}, fmt.Errorf("unable to extract dump information: %v", err)
+	}
+
+	var info DumpInfo
+	if err = json.Unmarshal(data, &info); err != nil {
+		return DumpInfo{}, fmt.Errorf("unable to convert json to dump information: %v", err)
+	}
+
+	return info, nil
+}
+
+// DumpGuestMemoryToFile dumps the guest memory to path and waits for the
+// dump to complete, see ExecuteDumpGuestMemoryDetach. progress, if not
+// nil, is called with the dump progress while waiting.
+func (q *QMP) DumpGuestMemoryToFile(ctx context.Context, path string, paging bool, format DumpGuestMemoryFormat, progress func(DumpInfo)) error {
+	if err := q.ExecuteDumpGuestMemoryDetach(ctx, "file:"+path, paging, format); err != nil {
+		return err
+	}
+
+	for {
+		info, err := q.ExecuteQueryDump(ctx)
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(info)
+		}
+
+		switch info.Status {
+		case "completed":
+			return nil
+		case "failed":
+			return fmt.Errorf("guest memory dump to %s failed", path)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// ExecuteTraceEventSetState enables or disables the trace events matching
+// name, which may be a pattern.
+func (q *QMP) ExecuteTraceEventSetState(ctx context.Context, name string, enable bool) error {
+	args := map[string]interface{}{
+		"name":   name,
+		"enable": enable,
+	}
+
+	return q.executeCommand(ctx, "trace-event-set-state", args, nil)
+}
+
+// ExecuteTraceEventGetState returns the state of the trace events matching
+// name, which may be a pattern.
+func (q *QMP) ExecuteTraceEventGetState(ctx context.Context, name string) ([]TraceEventInfo, error) {
+	args := map[string]interface{}{
+		"name": name,
+	}
+
+	response, err := q.executeCommandWithResponse(ctx, "trace-event-get-state", args, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert response to json
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract trace event information: %v", err)
+	}
+
+	var events []TraceEventInfo
+	// convert json to []TraceEventInfo
+	if err = json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("unable to convert json to TraceEventInfo: %v", err)
+	}
+
+	return events, nil
+}
+
+// ExecuteQueryChardev returns the character device backends of the VM
+func (q *QMP) ExecuteQueryChardev(ctx context.Context) ([]ChardevInfo, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-chardev", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert response to json
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract chardev information: %v", err)
+	}
+
+	var chardevs []ChardevInfo
+	// convert json to []ChardevInfo
+	if err = json.Unmarshal(data, &chardevs); err != nil {
+		return nil, fmt.Errorf("unable to convert json to ChardevInfo: %v", err)
+	}
+
+	return chardevs, nil
+}
+
+// GetPtsPath returns the pts path qemu allocated for the pty character
+// device chardevID, e.g. /dev/pts/3
+func (q *QMP) GetPtsPath(ctx context.Context, chardevID string) (string, error) {
+	chardevs, err := q.ExecuteQueryChardev(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, c := range chardevs {
+		if c.Label != chardevID {
+			continue
+		}
+		if !strings.HasPrefix(c.Filename, "pty:") {
+			return "", fmt.Errorf("chardev %s is not a pty: %s", chardevID, c.Filename)
+		}
+		return strings.TrimPrefix(c.Filename, "pty:"), nil
+	}
+
+	return "", fmt.Errorf("chardev %s not found", chardevID)
+}
+
+// ExecuteQueryBlockstats returns the I/O statistics of the block devices
+func (q *QMP) ExecuteQueryBlockstats(ctx context.Context) ([]BlockStats, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-blockstats", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert response to json
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract block statistics: %v", err)
+	}
+
+	var stats []BlockStats
+	// convert json to []BlockStats
+	if err = json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("unable to convert json to BlockStats: %v", err)
+	}
+
+	return stats, nil
+}
+
+// ExecuteQueryRxFilter returns the receive filter of the guest NIC name, or
+// of all the NICs supporting it when name is empty
+func (q *QMP) ExecuteQueryRxFilter(ctx context.Context, name string) ([]RxFilterInfo, error) {
+	var args map[string]interface{}
+	if name != "" {
+		args = map[string]interface{}{
+			"name": name,
+		}
+	}
+
+	response, err := q.executeCommandWithResponse(ctx, "query-rx-filter", args, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert response to json
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract rx filter information: %v", err)
+	}
+
+	var filters []RxFilterInfo
+	// convert json to []RxFilterInfo
+	if err = json.Unmarshal(data, &filters); err != nil {
+		return nil, fmt.Errorf("unable to convert json to RxFilterInfo: %v", err)
+	}
+
+	return filters, nil
+}
+
+// ExecuteQueryBlock returns the block devices of the VM along with the
+// block node inserted in them
+func (q *QMP) ExecuteQueryBlock(ctx context.Context) ([]BlockInfo, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-block", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert response to json
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract block information: %v", err)
+	}
+
+	var blocks []BlockInfo
+	// convert json to []BlockInfo
+	if err = json.Unmarshal(data, &blocks); err != nil {
+		return nil, fmt.Errorf("unable to convert json to BlockInfo: %v", err)
+	}
+
+	return blocks, nil
+}
+
+// ExecuteQueryNamedBlockNodes returns the named block nodes of the VM,
+// flat returns only the nodes without their backing chain images
+func (q *QMP) ExecuteQueryNamedBlockNodes(ctx context.Context, flat bool) ([]BlockDeviceInfo, error) {
+	var args map[string]interface{}
+	if flat {
+		args = map[string]interface{}{
+			"flat": true,
+		}
+	}
+
+	response, err := q.executeCommandWithResponse(ctx, "query-named-block-nodes", args, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert response to json
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract block node information: %v", err)
+	}
+
+	var nodes []BlockDeviceInfo
+	// convert json to []BlockDeviceInfo
+	if err = json.Unmarshal(data, &nodes); err != nil {
+		return nil, fmt.Errorf("unable to convert json to BlockDeviceInfo: %v", err)
+	}
+
+	return nodes, nil
+}
+
+// ExecuteBlockSetWriteThreshold sets the write threshold of the block node
+// nodeName, a BLOCK_WRITE_THRESHOLD event is raised when the guest writes
+// past it. A threshold of 0 disables it.
+func (q *QMP) ExecuteBlockSetWriteThreshold(ctx context.Context, nodeName string, threshold uint64) error {
+	args := map[string]interface{}{
+		"node-name":       nodeName,
+		"write-threshold": threshold,
+	}
+
+	return q.executeCommand(ctx, "block-set-write-threshold", args, nil)
+}
@@ -17,13 +17,17 @@
 package qcli
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -755,6 +759,238 @@ func TestQMPDeviceDelTimeout(t *testing.T) {
 	wg.Wait()
 }
 
+// Checks the CPU model probing commands
+func TestQMPCPUModels(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("query-cpu-definitions", nil, "return", []interface{}{
+		map[string]interface{}{
+			"name": "Skylake-Client", "typename": "Skylake-Client-x86_64-cpu",
+			"static": false, "migration-safe": true, "deprecated": false,
+			"unavailable-features": []interface{}{},
+		},
+		map[string]interface{}{
+			"name": "Icelake-Server", "typename": "Icelake-Server-x86_64-cpu",
+			"static": false, "migration-safe": true, "deprecated": false,
+			"unavailable-features": []interface{}{"avx512vbmi"},
+		},
+	})
+	buf.AddCommand("query-cpu-model-expansion", nil, "return", map[string]interface{}{
+		"model": map[string]interface{}{"name": "base", "props": map[string]interface{}{"vmx": true}},
+	})
+	buf.AddCommand("query-cpu-model-baseline", nil, "return", map[string]interface{}{
+		"model": map[string]interface{}{"name": "Skylake-Client"},
+	})
+	buf.AddCommand("query-cpu-model-baseline", nil, "return", map[string]interface{}{
+		"model": map[string]interface{}{"name": "Haswell", "props": map[string]interface{}{"pcid": false}},
+	})
+	buf.AddCommand("query-cpu-model-baseline", nil, "error", map[string]interface{}{
+		"class": "GenericError", "desc": "baseline unsupported",
+	})
+	buf.AddCommand("query-cpu-model-baseline", nil, "error", map[string]interface{}{
+		"class": "CommandNotFound", "desc": "The command query-cpu-model-baseline has not been found",
+	})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	defs, err := q.ExecQueryCPUDefinitions(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(defs) != 2 || !defs[0].Usable() || defs[1].Usable() || !defs[1].MigrationSafe {
+		t.Fatalf("Unexpected cpu definitions %+v", defs)
+	}
+
+	model, err := q.ExecQueryCPUModelExpansion(context.Background(), CPUModelExpansionStatic, CPUModelInfo{Name: "host"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if model.Name != "base" || model.Props["vmx"] != true {
+		t.Fatalf("Unexpected cpu model %+v", model)
+	}
+
+	models := []CPUModelInfo{{Name: "host"}, {Name: "Skylake-Server"}, {Name: "Haswell"}}
+	model, err = q.BaselineCPUModels(context.Background(), models)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if model.Name != "Haswell" || model.Props["pcid"] != false {
+		t.Fatalf("Unexpected cpu model %+v", model)
+	}
+
+	if _, err := q.BaselineCPUModels(context.Background(), nil); err == nil {
+		t.Fatalf("Expected error for no cpu models")
+	}
+	if _, err := q.ExecQueryCPUModelBaseline(context.Background(), models[0], models[1]); err == nil {
+		t.Fatalf("Expected error for failed baseline")
+	}
+	_, err = q.ExecQueryCPUModelBaseline(context.Background(), models[0], models[1])
+	if !IsQMPError(err, QMPErrorCommandNotFound) || !strings.Contains(err.Error(), "s390x") {
+		t.Fatalf("Expected an s390x only error for an unsupported baseline, found %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that QMPConfig.Timeout bounds commands issued without a deadline.
+//
+// We start a QMPLoop with a 100ms timeout and send the device_del command
+// with a background context.  No DEVICE_DELETED event is sent.
+//
+// The device_del command should fail with context.DeadlineExceeded and
+// the QMP loop should exit gracefully.
+func TestQMPConfigTimeout(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("device_del", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}, Timeout: 100 * time.Millisecond}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteDeviceDel(context.Background(),
+		fmt.Sprintf("device_%s", volumeUUID))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Timeout expected found %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// qmpTestServer serves a QMP greeting and answers every command with an
+// empty return on each connection accepted from l.  The names of the
+// commands received are sent on cmdCh.  The first connection is dropped
+// after closeAfter commands, or kept open if closeAfter is zero.
+func qmpTestServer(t *testing.T, l net.Listener, closeAfter int, cmdCh chan<- string) {
+	const greeting = `{"QMP": {"version": {"qemu": {"micro": 0, "minor": 2, "major": 7}, "package": ""}, "capabilities": []}}` + "\n"
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn, closeAfter int) {
+			defer conn.Close()
+			if _, err := conn.Write([]byte(greeting)); err != nil {
+				return
+			}
+			scanner := bufio.NewScanner(conn)
+			for n := 1; scanner.Scan(); n++ {
+				var cmd map[string]interface{}
+				if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
+					t.Errorf("Invalid QMP command %s", scanner.Text())
+					return
+				}
+				name, _ := cmd["execute"].(string)
+				cmdCh <- name
+				if closeAfter > 0 && n == closeAfter {
+					return
+				}
+				if _, err := conn.Write([]byte(`{"return": {}}` + "\n")); err != nil {
+					return
+				}
+			}
+		}(conn, closeAfter)
+		closeAfter = 0
+	}
+}
+
+// Checks that QMPConfig.Reconnect redials a broken QMP socket.
+//
+// We start a QMP server that drops the first connection on receipt of its
+// second command, connect with QMPStart and send qmp_capabilities followed
+// by stop.
+//
+// The stop command should fail as the connection is dropped.  The QMP
+// loop should reconnect, renegotiate capabilities and a subsequent cont
+// command should succeed.  The qemu version is refreshed from the new
+// greeting.
+func TestQMPReconnect(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "qmp.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Unable to listen on %s: %v", socket, err)
+	}
+	defer l.Close()
+	cmdCh := make(chan string, 8)
+	go qmpTestServer(t, l, 2, cmdCh)
+
+	cfg := QMPConfig{
+		Logger:         qmpTestLogger{},
+		Timeout:        5 * time.Second,
+		Reconnect:      true,
+		ReconnectDelay: 10 * time.Millisecond,
+	}
+	disconnectedCh := make(chan struct{})
+	q, _, err := QMPStart(context.Background(), socket, cfg, disconnectedCh)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	// the version is refreshed from the greeting of the new connection
+	q.setVersion(&QMPVersion{Major: 4})
+	if err := q.ExecuteQMPCapabilities(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := q.ExecuteStop(context.Background()); err == nil {
+		t.Fatalf("Expected stop to fail on a broken connection")
+	}
+	if err := q.ExecuteCont(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if version := q.qemuVersion(); version.Major != 7 || version.Minor != 2 {
+		t.Errorf("Expected qemu version 7.2 after reconnecting, found %d.%d", version.Major, version.Minor)
+	}
+
+	expected := []string{"qmp_capabilities", "stop", "qmp_capabilities", "cont"}
+	for _, e := range expected {
+		if got := <-cmdCh; got != e {
+			t.Fatalf("Expected command %s, got %s", e, got)
+		}
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the QMP loop exits once QMPConfig.ReconnectTimeout expires.
+//
+// We connect with QMPStart to a QMP server that drops the connection on
+// receipt of the first command, and then stop listening.
+//
+// The QMP loop should give up redialing and close the disconnectedCh.
+func TestQMPReconnectTimeout(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "qmp.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Unable to listen on %s: %v", socket, err)
+	}
+	cmdCh := make(chan string, 8)
+	go qmpTestServer(t, l, 1, cmdCh)
+
+	cfg := QMPConfig{
+		Logger:           qmpTestLogger{},
+		Reconnect:        true,
+		ReconnectDelay:   10 * time.Millisecond,
+		ReconnectTimeout: 100 * time.Millisecond,
+	}
+	disconnectedCh := make(chan struct{})
+	q, _, err := QMPStart(context.Background(), socket, cfg, disconnectedCh)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	l.Close()
+	if err := q.ExecuteQMPCapabilities(context.Background()); err == nil {
+		t.Fatalf("Expected qmp_capabilities to fail on a broken connection")
+	}
+
+	select {
+	case <-disconnectedCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the QMP loop to exit")
+	}
+}
+
 // Checks that contexts can be used to cancel a command.
 //
 // We start a QMPLoop and send two qmp_capabilities commands, cancelling
@@ -1287,6 +1523,55 @@ func TestQMPExecuteQueryCpusFast(t *testing.T) {
 	<-disconnectedCh
 }
 
+// Checks that the vcpu threads are listed by vcpu index
+func TestQMPExecuteQueryVCPUThreads(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("query-cpus-fast", nil, "return", []interface{}{
+		map[string]interface{}{
+			"cpu-index": 0,
+			"qom-path":  "/machine/unattached/device[0]",
+			"thread-id": 4001,
+			"target":    "s390x",
+			"cpu-state": "operating",
+			"props":     map[string]interface{}{"core-id": 0, "book-id": 1, "drawer-id": 2},
+		},
+		map[string]interface{}{
+			"cpu-index": 1,
+			"qom-path":  "/machine/unattached/device[1]",
+			"thread-id": 4002,
+			"target":    "s390x",
+			"cpu-state": "stopped",
+			"props":     map[string]interface{}{"core-id": 1, "book-id": 1, "drawer-id": 2},
+		},
+	})
+	buf.AddCommand("query-cpus-fast", nil, "return", []interface{}{
+		map[string]interface{}{"cpu-index": 0, "thread-id": 4001, "target": "s390x", "cpu-state": "operating", "props": map[string]interface{}{"book-id": 1}},
+	})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	threads, err := q.ExecQueryVCPUThreads(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[int]int{0: 4001, 1: 4002}
+	if !reflect.DeepEqual(threads, expected) {
+		t.Fatalf("Expected %v, found %v", expected, threads)
+	}
+
+	cpus, err := q.ExecQueryCpusFast(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cpus[0].CPUState != "operating" || cpus[0].Props.Book != 1 {
+		t.Errorf("Expected cpu-state operating in book 1, found %+v", cpus[0])
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
 // Checks that migrate capabilities can be set
 func TestExecSetMigrationCaps(t *testing.T) {
 	connectedCh := make(chan *QMPVersion)
@@ -1536,28 +1821,22 @@ func TestExecuteBalloon(t *testing.T) {
 	<-disconnectedCh
 }
 
-func TestErrorDesc(t *testing.T) {
-	errDesc := "Somthing err messages"
-	errData := map[string]string{
-		"class": "GenericError",
-		"desc":  errDesc,
-	}
-
+func TestExecuteQueryBalloon(t *testing.T) {
 	connectedCh := make(chan *QMPVersion)
 	disconnectedCh := make(chan struct{})
 	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("query-balloon", nil, "return", map[string]interface{}{"actual": 1073741824})
 	cfg := QMPConfig{Logger: qmpTestLogger{}}
+
 	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
 	checkVersion(t, connectedCh)
-
-	desc, err := q.errorDesc(errData)
+	info, err := q.ExecuteQueryBalloon(context.Background())
 	if err != nil {
-		t.Fatalf("Unexpected error '%v'", err)
+		t.Fatalf("Unexpected error %v", err)
 	}
-	if desc != errDesc {
-		t.Fatalf("expected '%v'\n got '%v'", errDesc, desc)
+	if info.Actual != 1073741824 {
+		t.Fatalf("Expected actual 1073741824, got %d", info.Actual)
 	}
-
 	q.Shutdown()
 	<-disconnectedCh
 }
@@ -1587,6 +1866,15 @@ func TestExecCommandFailed(t *testing.T) {
 		t.Fatalf("expected '%v' but got '%v'", expectedString, err)
 	}
 
+	var qmpErr *QMPError
+	if !errors.As(err, &qmpErr) {
+		t.Fatalf("expected a QMPError but got %T", err)
+	}
+	expected := QMPError{Command: "object-add", Class: QMPErrorGeneric, Desc: errDesc}
+	if *qmpErr != expected {
+		t.Fatalf("expected %+v but got %+v", expected, *qmpErr)
+	}
+
 	q.Shutdown()
 	<-disconnectedCh
 }
@@ -1804,3 +2092,705 @@ func TestExecuteDumpGuestMemory(t *testing.T) {
 	q.Shutdown()
 	<-disconnectedCh
 }
+
+// Checks trace-event-set-state
+func TestExecuteTraceEventSetState(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("trace-event-set-state", map[string]interface{}{"name": "virtio_blk_*", "enable": true}, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	err := q.ExecuteTraceEventSetState(context.Background(), "virtio_blk_*", true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks trace-event-get-state
+func TestExecuteTraceEventGetState(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	eventInfo := TraceEventInfo{
+		Name:  "virtio_blk_req_complete",
+		State: "enabled",
+	}
+	buf.AddCommand("trace-event-get-state", nil, "return", []interface{}{eventInfo})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	events, err := q.ExecuteTraceEventGetState(context.Background(), "virtio_blk_*")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 || !reflect.DeepEqual(events[0], eventInfo) {
+		t.Fatalf("Expected %v equals to %v", events, eventInfo)
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks virtio-mem resize through qom-set
+func TestExecuteVirtioMemResize(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	args := map[string]interface{}{
+		"path":     "/machine/peripheral/vmem0",
+		"property": "requested-size",
+		"value":    float64(1 << 30),
+	}
+	buf.AddCommand("qom-set", args, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	err := q.ExecuteVirtioMemResize(context.Background(), "vmem0", 1<<30)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks pts path discovery through query-chardev
+func TestGetPtsPath(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	chardevs := []interface{}{
+		ChardevInfo{Label: "monitor0", Filename: "unix:/tmp/monitor.sock,server=on"},
+		ChardevInfo{Label: "serial0", Filename: "pty:/dev/pts/3", FrontendOpen: true},
+	}
+	buf.AddCommand("query-chardev", nil, "return", chardevs)
+	buf.AddCommand("query-chardev", nil, "return", chardevs)
+	buf.AddCommand("query-chardev", nil, "return", chardevs)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	path, err := q.GetPtsPath(context.Background(), "serial0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if path != "/dev/pts/3" {
+		t.Fatalf("Expected /dev/pts/3, got %s", path)
+	}
+
+	if _, err := q.GetPtsPath(context.Background(), "monitor0"); err == nil {
+		t.Fatalf("Expected error for non pty chardev")
+	}
+
+	if _, err := q.GetPtsPath(context.Background(), "serial1"); err == nil {
+		t.Fatalf("Expected error for unknown chardev")
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks virtserialport channel hotplug
+func TestExecuteVirtSerialPortChannelAdd(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("chardev-add", nil, "return", nil)
+	buf.AddCommand("device_add", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteVirtSerialPortChannelAdd(context.Background(), "agent0",
+		"org.qemu.guest_agent.0", "/tmp/agent0.sock", "serial0.0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the chardev is removed if the virtserialport cannot be added
+func TestExecuteVirtSerialPortChannelAddFailed(t *testing.T) {
+	errData := map[string]string{
+		"class": "GenericError",
+		"desc":  "Bus 'serial0.0' not found",
+	}
+
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("chardev-add", nil, "return", nil)
+	buf.AddCommand("device_add", nil, "error", errData)
+	buf.AddCommand("chardev-remove", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteVirtSerialPortChannelAdd(context.Background(), "agent0",
+		"org.qemu.guest_agent.0", "/tmp/agent0.sock", "serial0.0")
+	if err == nil {
+		t.Fatalf("expected error but got nil")
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks virtserialport channel hot unplug
+func TestExecuteVirtSerialPortChannelDel(t *testing.T) {
+	var wg sync.WaitGroup
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("device_del", nil, "return", nil)
+	buf.AddEvent("DEVICE_DELETED", time.Millisecond*200,
+		map[string]interface{}{
+			"device": "agent0",
+		},
+		map[string]interface{}{
+			"seconds":      int64(1352167040730),
+			"microseconds": 123456,
+		})
+	buf.AddCommand("chardev-remove", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	buf.startEventLoop(&wg)
+	err := q.ExecuteVirtSerialPortChannelDel(context.Background(), "agent0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+	wg.Wait()
+}
+
+// Checks migration TLS credentials
+func TestExecuteMigrationSetTLS(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("migrate-set-parameters", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteMigrationSetTLS(context.Background(), "tls1", "dest.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks the NBD server is started on a unix socket or a TCP address
+func TestExecuteNBDServerStart(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("nbd-server-start", nil, "return", nil)
+	buf.AddCommand("nbd-server-start", nil, "return", nil)
+	buf.AddCommand("nbd-server-stop", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteNBDServerStart(context.Background(), NBDServerAddr{Path: "/run/vm/nbd.sock"}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	err = q.ExecuteNBDServerStart(context.Background(), NBDServerAddr{Host: "0.0.0.0", Port: "10809"}, "tls0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	bad := []NBDServerAddr{
+		{},
+		{Host: "0.0.0.0"},
+		{Path: "/run/vm/nbd.sock", Port: "10809"},
+	}
+	for _, addr := range bad {
+		if err := q.ExecuteNBDServerStart(context.Background(), addr, ""); err == nil {
+			t.Errorf("Expected error for invalid NBD server address %+v", addr)
+		}
+	}
+	err = q.ExecuteNBDServerStop(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks a disk is exported with nbd-server-add
+func TestExecuteNBDServerAdd(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("nbd-server-add", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteNBDServerAdd(context.Background(), "drive0", "disk0", "bitmap0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks a disk export is added and removed with block-export-add/del
+func TestExecuteBlockExport(t *testing.T) {
+	var wg sync.WaitGroup
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("block-export-add", nil, "return", nil)
+	buf.AddCommand("block-export-del", nil, "return", nil)
+	buf.AddEvent("BLOCK_EXPORT_DELETED", time.Millisecond*200,
+		map[string]interface{}{
+			"id": "export0",
+		},
+		map[string]interface{}{
+			"seconds":      int64(1352167040730),
+			"microseconds": 123456,
+		})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteBlockExportAdd(context.Background(), "export0", "drive0", "disk0", []string{"bitmap0"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	buf.startEventLoop(&wg)
+	err = q.ExecuteBlockExportDel(context.Background(), "export0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+	wg.Wait()
+}
+
+// Checks the dirty bitmap management commands
+func TestExecuteBlockDirtyBitmap(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("block-dirty-bitmap-add", nil, "return", nil)
+	buf.AddCommand("block-dirty-bitmap-disable", nil, "return", nil)
+	buf.AddCommand("block-dirty-bitmap-enable", nil, "return", nil)
+	buf.AddCommand("block-dirty-bitmap-merge", nil, "return", nil)
+	buf.AddCommand("block-dirty-bitmap-clear", nil, "return", nil)
+	buf.AddCommand("block-dirty-bitmap-remove", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	ctx := context.Background()
+	bitmap := BlockDirtyBitmap{
+		Node:        "drive0",
+		Name:        "bitmap0",
+		Granularity: 65536,
+		Persistent:  true,
+	}
+	if err := q.ExecuteBlockDirtyBitmapAdd(ctx, bitmap); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	bitmap.Granularity = 1000
+	if err := q.ExecuteBlockDirtyBitmapAdd(ctx, bitmap); err == nil {
+		t.Errorf("Expected error for invalid BlockDirtyBitmap %+v", bitmap)
+	}
+	if err := q.ExecuteBlockDirtyBitmapDisable(ctx, "drive0", "bitmap0"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := q.ExecuteBlockDirtyBitmapEnable(ctx, "drive0", "bitmap0"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := q.ExecuteBlockDirtyBitmapMerge(ctx, "drive0", "bitmap0", []string{"bitmap1"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := q.ExecuteBlockDirtyBitmapMerge(ctx, "drive0", "bitmap0", nil); err == nil {
+		t.Errorf("Expected error for block-dirty-bitmap-merge without sources")
+	}
+	if err := q.ExecuteBlockDirtyBitmapClear(ctx, "drive0", "bitmap0"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := q.ExecuteBlockDirtyBitmapRemove(ctx, "drive0", "bitmap0"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks an incremental blockdev-backup job is started
+func TestExecuteBlockdevBackup(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("blockdev-backup", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	backup := BlockdevBackup{
+		JobID:  "backup0",
+		Device: "drive0",
+		Target: "inc0",
+		Sync:   BackupSyncIncremental,
+		Bitmap: "bitmap0",
+	}
+	if err := q.ExecuteBlockdevBackup(context.Background(), backup); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	bad := []BlockdevBackup{
+		{Device: "drive0", Target: "inc0"},
+		{Device: "drive0", Target: "inc0", Sync: BackupSyncIncremental},
+		{Device: "drive0", Target: "inc0", Sync: BackupSyncFull, BitmapMode: "always"},
+	}
+	for _, backup := range bad {
+		if err := q.ExecuteBlockdevBackup(context.Background(), backup); err == nil {
+			t.Errorf("Expected error for invalid BlockdevBackup %+v", backup)
+		}
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks an internal snapshot is saved, loaded and deleted with the
+// snapshot jobs
+func TestQMPSnapshot(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("snapshot-save", nil, "return", nil)
+	buf.AddCommand("query-jobs", nil, "return", []map[string]interface{}{
+		{"id": "snapshot-save-warm", "type": "snapshot-save", "status": "running"},
+	})
+	buf.AddCommand("query-jobs", nil, "return", []map[string]interface{}{
+		{"id": "snapshot-save-warm", "type": "snapshot-save", "status": "concluded"},
+	})
+	buf.AddCommand("job-dismiss", nil, "return", nil)
+	buf.AddCommand("snapshot-load", nil, "return", nil)
+	buf.AddCommand("query-jobs", nil, "return", []map[string]interface{}{
+		{"id": "snapshot-load-warm", "type": "snapshot-load", "status": "concluded", "error": "Snapshot 'warm' does not exist"},
+	})
+	buf.AddCommand("job-dismiss", nil, "return", nil)
+	buf.AddCommand("snapshot-delete", nil, "return", nil)
+	buf.AddCommand("query-jobs", nil, "return", []map[string]interface{}{})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	jobPollInterval = time.Millisecond
+	if err := q.SaveSnapshot(context.Background(), "warm"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := q.LoadSnapshot(context.Background(), "warm"); err == nil {
+		t.Fatalf("Expected error for failed snapshot-load job")
+	}
+	if err := q.DeleteSnapshot(context.Background(), "warm"); err == nil {
+		t.Fatalf("Expected error for missing snapshot-delete job")
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks internal snapshots fall back to HMP on qemu older than 6.0
+func TestQMPSnapshotHMP(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("human-monitor-command", nil, "return", "")
+	buf.AddCommand("human-monitor-command", nil, "return", "Error: Device 'hd0' is writable but does not support snapshots\r\n")
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	q.version = checkVersion(t, connectedCh)
+	if err := q.SaveSnapshot(context.Background(), "warm"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := q.SaveSnapshot(context.Background(), "warm"); err == nil {
+		t.Fatalf("Expected error for failed savevm")
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks HMP commands are only passed through once enabled
+func TestQMPExecuteHumanMonitorCommand(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	if _, err := q.ExecuteHumanMonitorCommand(context.Background(), "info mtree"); err == nil {
+		t.Fatalf("Expected error for disabled human monitor commands")
+	}
+	q.Shutdown()
+	<-disconnectedCh
+
+	connectedCh = make(chan *QMPVersion)
+	disconnectedCh = make(chan struct{})
+	buf = newQMPTestCommandBuffer(t)
+	buf.AddCommand("human-monitor-command", nil, "return", "address-space: memory\r\n")
+	cfg = QMPConfig{Logger: qmpTestLogger{}, AllowHMP: true}
+	q = startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	if _, err := q.ExecuteHumanMonitorCommand(context.Background(), ""); err == nil {
+		t.Fatalf("Expected error for empty human monitor command")
+	}
+	output, err := q.ExecuteHumanMonitorCommand(context.Background(), "info mtree")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if output != "address-space: memory\r\n" {
+		t.Fatalf("Unexpected output %q", output)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks a detached guest memory dump is started and followed to completion
+func TestQMPDumpGuestMemoryToFile(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("dump-guest-memory", nil, "return", nil)
+	buf.AddCommand("query-dump", nil, "return", map[string]interface{}{
+		"status": "active", "completed": 1024, "total": 4096,
+	})
+	buf.AddCommand("query-dump", nil, "return", map[string]interface{}{
+		"status": "completed", "completed": 4096, "total": 4096,
+	})
+	buf.AddCommand("dump-guest-memory", nil, "return", nil)
+	buf.AddCommand("query-dump", nil, "return", map[string]interface{}{
+		"status": "failed", "completed": 0, "total": 4096,
+	})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	jobPollInterval = time.Millisecond
+
+	var infos []DumpInfo
+	err := q.DumpGuestMemoryToFile(context.Background(), "/tmp/vm.dump", false, DumpFormatKdumpZlib,
+		func(info DumpInfo) { infos = append(infos, info) })
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []DumpInfo{
+		{Status: "active", Completed: 1024, Total: 4096},
+		{Status: "completed", Completed: 4096, Total: 4096},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Fatalf("Expected progress %+v, got %+v", expected, infos)
+	}
+
+	if err := q.DumpGuestMemoryToFile(context.Background(), "/tmp/vm.dump", true, DumpFormatELF, nil); err == nil {
+		t.Fatalf("Expected error for failed dump")
+	}
+
+	if err := q.ExecuteDumpGuestMemoryDetach(context.Background(), "file:/tmp/vm.dump", true, DumpFormatKdumpZlib); err == nil {
+		t.Errorf("Expected error for paging with kdump format")
+	}
+	if err := q.ExecuteDumpGuestMemoryDetach(context.Background(), "file:/tmp/vm.dump", false, "vmcore"); err == nil {
+		t.Errorf("Expected error for invalid dump format")
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks the cdrom medium change and eject commands
+func TestExecuteBlockdevChangeMediumEject(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("blockdev-change-medium", map[string]interface{}{
+		"device":   "cdrom0",
+		"filename": "/var/lib/install.iso",
+		"format":   "raw",
+	}, "return", nil)
+	buf.AddCommand("eject", map[string]interface{}{
+		"device": "cdrom0",
+		"force":  true,
+	}, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteBlockdevChangeMedium(context.Background(), "cdrom0", "/var/lib/install.iso", "raw")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	err = q.ExecuteEject(context.Background(), "cdrom0", true)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks query-blockstats and query-rx-filter
+func TestExecuteQueryBlockstatsRxFilter(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	blockStats := BlockStats{
+		Device: "drive0",
+		QDev:   "/machine/peripheral/disk0/virtio-backend",
+		Stats: BlockDeviceStats{
+			ReadBytes:       4096,
+			WriteBytes:      8192,
+			ReadOperations:  1,
+			WriteOperations: 2,
+		},
+	}
+	rxFilter := RxFilterInfo{
+		Name:         "net0",
+		Multicast:    "normal",
+		Unicast:      "normal",
+		VLAN:         "normal",
+		MainMAC:      "52:54:00:12:34:56",
+		VLANTable:    []int{},
+		UnicastTable: []string{},
+	}
+	buf.AddCommand("query-blockstats", nil, "return", []interface{}{blockStats})
+	buf.AddCommand("query-rx-filter", map[string]interface{}{"name": "net0"}, "return", []interface{}{rxFilter})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	stats, err := q.ExecuteQueryBlockstats(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stats) != 1 || !reflect.DeepEqual(stats[0], blockStats) {
+		t.Fatalf("Expected %v equals to %v", stats, blockStats)
+	}
+
+	filters, err := q.ExecuteQueryRxFilter(context.Background(), "net0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(filters) != 1 || !reflect.DeepEqual(filters[0], rxFilter) {
+		t.Fatalf("Expected %v equals to %v", filters, rxFilter)
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks query-named-block-nodes
+func TestExecuteQueryNamedBlockNodes(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	node := BlockDeviceInfo{
+		File:           "disk.qcow2",
+		NodeName:       "disk0",
+		Driver:         "qcow2",
+		WriteThreshold: 1 << 29,
+	}
+	buf.AddCommand("query-named-block-nodes", map[string]interface{}{"flat": true}, "return", []interface{}{node})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	nodes, err := q.ExecuteQueryNamedBlockNodes(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(nodes) != 1 || !reflect.DeepEqual(nodes[0], node) {
+		t.Fatalf("Expected %v equals to %v", nodes, node)
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the transaction actions are built and executed
+func TestQMPExecuteTransaction(t *testing.T) {
+	tr := NewTransaction().
+		BlockDirtyBitmapClear("disk0", "bitmap0").
+		BlockdevSnapshotSync("drive0", "/var/lib/vm1/snap.qcow2", "qcow2").
+		BlockdevBackup(BlockdevBackup{JobID: "backup0", Device: "disk1", Target: "target1", Sync: BackupSyncFull})
+	tr.CompletionMode = TransactionGrouped
+
+	args, err := tr.args()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"actions": []map[string]interface{}{
+			{
+				"type": "block-dirty-bitmap-clear",
+				"data": map[string]interface{}{"node": "disk0", "name": "bitmap0"},
+			},
+			{
+				"type": "blockdev-snapshot-sync",
+				"data": map[string]interface{}{"device": "drive0", "snapshot-file": "/var/lib/vm1/snap.qcow2", "format": "qcow2"},
+			},
+			{
+				"type": "blockdev-backup",
+				"data": map[string]interface{}{"job-id": "backup0", "device": "disk1", "target": "target1", "sync": BackupSyncFull},
+			},
+		},
+		"properties": map[string]interface{}{"completion-mode": TransactionGrouped},
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected %v, found %v", expected, args)
+	}
+
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("transaction", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	if err := q.ExecuteTransaction(context.Background(), tr); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	bad := []*Transaction{
+		NewTransaction(),
+		NewTransaction().BlockdevSnapshotSync("", "/var/lib/vm1/snap.qcow2", ""),
+		NewTransaction().BlockDirtyBitmapAdd(BlockDirtyBitmap{Node: "disk0", Name: "bitmap0", Granularity: 3}),
+		NewTransaction().BlockDirtyBitmapMerge("disk0", "bitmap0", nil),
+		NewTransaction().BlockdevBackup(BlockdevBackup{Device: "disk1", Target: "target1", Sync: BackupSyncIncremental}),
+		{CompletionMode: "sometimes", actions: tr.actions},
+	}
+	for i, tr := range bad {
+		if err := q.ExecuteTransaction(context.Background(), tr); err == nil {
+			t.Errorf("Expected error for transaction %d", i)
+		}
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+func TestExecCommandFailedClass(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("device_del", nil, "error", map[string]string{
+		"class": "DeviceNotFound",
+		"desc":  "Device 'disk9' not found",
+	})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	err := q.ExecuteDeviceDel(context.Background(), "disk9")
+	if !IsQMPError(err, QMPErrorDeviceNotFound) {
+		t.Fatalf("expected a DeviceNotFound QMPError but got %v", err)
+	}
+	if IsQMPError(err, QMPErrorGeneric) {
+		t.Fatalf("expected %v not to be a GenericError", err)
+	}
+	if IsQMPError(fmt.Errorf("QMP command failed: Device 'disk9' not found"), QMPErrorDeviceNotFound) {
+		t.Fatalf("expected a plain error not to be a QMPError")
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// dialQMP connects to the qemu QMP unix domain socket at path.
+func dialQMP(ctx context.Context, path string) (io.ReadWriteCloser, error) {
+	dialer := net.Dialer{Cancel: ctx.Done()}
+	return dialer.Dial("unix", path)
+}
+
+// fdRights returns the SCM_RIGHTS control message used to pass fd to qemu.
+func fdRights(fd *os.File) ([]byte, error) {
+	return syscall.UnixRights(int(fd.Fd())), nil
+}
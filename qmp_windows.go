@@ -0,0 +1,57 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// namedPipePrefix is the namespace windows named pipes live in.
+const namedPipePrefix = `\\.\pipe\`
+
+// dialQMP connects to the qemu QMP named pipe. The name may be given with or
+// without the \\.\pipe\ prefix, matching a QMPSocket of type pipe. The
+// pipe is opened for overlapped I/O so that the QMP loop can read and write
+// it concurrently, ctx cancels a dial waiting for the pipe.
+func dialQMP(ctx context.Context, name string) (io.ReadWriteCloser, error) {
+	path := name
+	if !strings.HasPrefix(path, namedPipePrefix) {
+		path = namedPipePrefix + path
+	}
+
+	return winio.DialPipeContext(ctx, path)
+}
+
+// fdRights is not supported on windows, file descriptors can't be passed
+// over a named pipe.
+func fdRights(fd *os.File) ([]byte, error) {
+	return nil, fmt.Errorf("passing file descriptors is not supported on windows")
+}
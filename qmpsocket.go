@@ -27,6 +27,7 @@ package qcli
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
@@ -36,6 +37,19 @@ type QMPSocketType string
 const (
 	// Unix socket for QMP.
 	Unix QMPSocketType = "unix"
+
+	// QMPTCP is a TCP socket for QMP.
+	QMPTCP QMPSocketType = "tcp"
+
+	// QMPFD is an already open (listening) socket passed to qemu for QMP.
+	QMPFD QMPSocketType = "fd"
+
+	// QMPStdio uses the qemu process stdio for QMP.
+	QMPStdio QMPSocketType = "stdio"
+
+	// QMPPipe is a named pipe for QMP, on Windows hosts qemu creates
+	// \\.\pipe\<Name> for it.
+	QMPPipe QMPSocketType = "pipe"
 )
 
 // QMPSocket represents a qemu QMP socket configuration.
@@ -43,9 +57,20 @@ type QMPSocket struct {
 	// Type is the socket type (e.g. "unix").
 	Type QMPSocketType `yaml:"type" default:"unix"`
 
-	// Name is the socket name.
+	// Name is the socket name. For the unix type this is the socket path,
+	// for the pipe type the pipe name and for the fd type it is used as
+	// the chardev id.
 	Name string `yaml:"name"`
 
+	// Host is the address to listen on or connect to for the tcp type.
+	Host string `yaml:"host"`
+
+	// Port is the port to listen on or connect to for the tcp type.
+	Port int `yaml:"port"`
+
+	// FD is the pre-created socket handed to qemu for the fd type.
+	FD *os.File `yaml:"-"`
+
 	// Server tells if this is a server socket.
 	Server bool `yaml:"server"`
 
@@ -58,16 +83,53 @@ func (qmp QMPSocket) Valid() error {
 	if qmp.Type == "" {
 		return fmt.Errorf("QMPSocket has empty Type field")
 	}
-	if qmp.Name == "" {
-		return fmt.Errorf("QMPSocket has empty Name field")
-	}
-	if qmp.Type != Unix {
+
+	switch qmp.Type {
+	case Unix:
+		if qmp.Name == "" {
+			return fmt.Errorf("QMPSocket has empty Name field")
+		}
+	case QMPTCP:
+		if qmp.Port <= 0 || qmp.Port > 65535 {
+			return fmt.Errorf("QMPSocket has invalid Port field: %d", qmp.Port)
+		}
+	case QMPFD:
+		if qmp.Name == "" {
+			return fmt.Errorf("QMPSocket has empty Name field")
+		}
+		if qmp.FD == nil {
+			return fmt.Errorf("QMPSocket of type fd has nil FD field")
+		}
+	case QMPStdio:
+		if qmp.Server {
+			return fmt.Errorf("QMPSocket of type stdio cannot be a server")
+		}
+	case QMPPipe:
+		if qmp.Name == "" {
+			return fmt.Errorf("QMPSocket has empty Name field")
+		}
+		if qmp.Server {
+			return fmt.Errorf("QMPSocket of type pipe cannot be a server")
+		}
+	default:
 		return fmt.Errorf("QMPSocket has invalid Type field: %s", qmp.Type)
 	}
 
 	return nil
 }
 
+// serverParams returns the server and wait toggles for the socket.
+func (qmp QMPSocket) serverParams() []string {
+	var params []string
+	if qmp.Server {
+		params = append(params, "server=on")
+		if qmp.NoWait {
+			params = append(params, "wait=off")
+		}
+	}
+	return params
+}
+
 func (config *Config) appendQMPSockets() error {
 	var errors []string
 	for _, q := range config.QMPSockets {
@@ -76,13 +138,30 @@ func (config *Config) appendQMPSockets() error {
 			continue
 		}
 
-		qmpParams := append([]string{}, fmt.Sprintf("%s:%s", q.Type, q.Name))
-		if q.Server {
-			qmpParams = append(qmpParams, "server=on")
-			if q.NoWait {
-				qmpParams = append(qmpParams, "wait=off")
-			}
+		if q.Type == QMPFD {
+			// -qmp has no legacy syntax for fd passing, create the
+			// socket chardev explicitly and attach a control monitor.
+			qemuFDs := config.appendFDs([]*os.File{q.FD})
+			chardevParams := []string{"socket", fmt.Sprintf("id=%s", q.Name), fmt.Sprintf("fd=%d", qemuFDs[0])}
+			chardevParams = append(chardevParams, q.serverParams()...)
+
+			config.qemuParams = append(config.qemuParams, "-chardev")
+			config.qemuParams = append(config.qemuParams, strings.Join(chardevParams, ","))
+			config.qemuParams = append(config.qemuParams, "-mon")
+			config.qemuParams = append(config.qemuParams, fmt.Sprintf("chardev=%s,mode=control", q.Name))
+			continue
+		}
+
+		var qmpParams []string
+		switch q.Type {
+		case QMPStdio:
+			qmpParams = append(qmpParams, string(q.Type))
+		case QMPTCP:
+			qmpParams = append(qmpParams, fmt.Sprintf("%s:%s:%d", q.Type, q.Host, q.Port))
+		default:
+			qmpParams = append(qmpParams, fmt.Sprintf("%s:%s", q.Type, q.Name))
 		}
+		qmpParams = append(qmpParams, q.serverParams()...)
 
 		config.qemuParams = append(config.qemuParams, "-qmp")
 		config.qemuParams = append(config.qemuParams, strings.Join(qmpParams, ","))
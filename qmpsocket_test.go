@@ -1,11 +1,19 @@
 package qcli
 
-import "testing"
+import (
+	"os"
+	"testing"
+)
 
 var (
 	qmpSingleSocketServerString = "-qmp unix:cc-qmp,server=on,wait=off"
 	qmpSingleSocketString       = "-qmp unix:cc-qmp"
 	qmpSocketServerString       = "-qmp unix:cc-qmp-1,server=on,wait=off -qmp unix:cc-qmp-2,server=on,wait=off"
+	qmpTCPSocketServerString    = "-qmp tcp:127.0.0.1:4444,server=on,wait=off"
+	qmpTCPSocketClientString    = "-qmp tcp:mgmt.example.com:4444"
+	qmpStdioString              = "-qmp stdio"
+	qmpPipeString               = "-qmp pipe:qemu-qmp"
+	qmpFDSocketString           = "-chardev socket,id=qmp0,fd=3,server=on,wait=off -mon chardev=qmp0,mode=control"
 )
 
 func TestAppendSingleQMPSocketServer(t *testing.T) {
@@ -48,6 +56,60 @@ func TestAppendQMPSocketServer(t *testing.T) {
 	testAppend(qmp, qmpSocketServerString, t)
 }
 
+func TestAppendTCPQMPSocket(t *testing.T) {
+	qmp := QMPSocket{
+		Type:   QMPTCP,
+		Host:   "127.0.0.1",
+		Port:   4444,
+		Server: true,
+		NoWait: true,
+	}
+
+	testAppend(qmp, qmpTCPSocketServerString, t)
+
+	qmp = QMPSocket{
+		Type: QMPTCP,
+		Host: "mgmt.example.com",
+		Port: 4444,
+	}
+
+	testAppend(qmp, qmpTCPSocketClientString, t)
+}
+
+func TestAppendStdioQMPSocket(t *testing.T) {
+	qmp := QMPSocket{
+		Type: QMPStdio,
+	}
+
+	testAppend(qmp, qmpStdioString, t)
+}
+
+func TestAppendPipeQMPSocket(t *testing.T) {
+	qmp := QMPSocket{
+		Type: QMPPipe,
+		Name: "qemu-qmp",
+	}
+
+	testAppend(qmp, qmpPipeString, t)
+
+	qmp.Server = true
+	if err := qmp.Valid(); err == nil {
+		t.Errorf("Expected error for pipe QMPSocket with Server")
+	}
+}
+
+func TestAppendFDQMPSocket(t *testing.T) {
+	qmp := QMPSocket{
+		Type:   QMPFD,
+		Name:   "qmp0",
+		FD:     os.Stdin,
+		Server: true,
+		NoWait: true,
+	}
+
+	testAppend(qmp, qmpFDSocketString, t)
+}
+
 func TestBadQMPSockets(t *testing.T) {
 	c := &Config{}
 	c.appendQMPSockets()
@@ -86,4 +148,22 @@ func TestBadQMPSockets(t *testing.T) {
 	if len(c.qemuParams) != 0 {
 		t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
 	}
+
+	c = &Config{
+		QMPSockets: []QMPSocket{
+			{
+				Type: QMPTCP,
+				Host: "127.0.0.1",
+			},
+			{
+				Type: QMPFD,
+				Name: "qmp0",
+			},
+		},
+	}
+
+	c.appendQMPSockets()
+	if len(c.qemuParams) != 0 {
+		t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
+	}
 }
@@ -0,0 +1,165 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RawDeviceProp is a single key=value property of a RawDevice.
+type RawDeviceProp struct {
+	Key   string
+	Value string
+}
+
+// RawDeviceProps is an ordered list of device properties. In YAML it is
+// written as a mapping and the order of the keys is preserved.
+type RawDeviceProps []RawDeviceProp
+
+// UnmarshalYAML reads the properties from a YAML mapping keeping the key order.
+func (props *RawDeviceProps) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items yaml.MapSlice
+	if err := unmarshal(&items); err != nil {
+		return err
+	}
+
+	*props = RawDeviceProps{}
+	for _, item := range items {
+		value := fmt.Sprintf("%v", item.Value)
+		// YAML reads on/off as booleans, qemu expects on/off
+		if b, ok := item.Value.(bool); ok {
+			value = "off"
+			if b {
+				value = "on"
+			}
+		}
+		*props = append(*props, RawDeviceProp{
+			Key:   fmt.Sprintf("%v", item.Key),
+			Value: value,
+		})
+	}
+
+	return nil
+}
+
+// MarshalYAML writes the properties as a YAML mapping keeping the key order.
+func (props RawDeviceProps) MarshalYAML() (interface{}, error) {
+	var items yaml.MapSlice
+	for _, p := range props {
+		items = append(items, yaml.MapItem{Key: p.Key, Value: p.Value})
+	}
+	return items, nil
+}
+
+// RawDevice is a generic -device for drivers which are not modeled by this
+// package. The properties are passed to qemu as-is, in order.
+type RawDevice struct {
+	// Driver is the qemu device driver
+	Driver string `yaml:"driver"`
+
+	// ID is the device ID
+	ID string `yaml:"id"`
+
+	// Bus is the bus path name of a this device.
+	Bus string `yaml:"bus"`
+
+	// Addr is the pci slot[.function] of this device on the bus, decimal
+	// or 0x prefixed hex, e.g., 5 or 0x5.0x1
+	Addr string `yaml:"address"`
+
+	// Props are the remaining driver properties.
+	Props RawDeviceProps `yaml:"properties"`
+}
+
+// Valid returns an error if the RawDevice structure is not valid and complete.
+func (dev RawDevice) Valid() error {
+	if dev.Driver == "" {
+		return fmt.Errorf("RawDevice has empty Driver field")
+	}
+
+	if strings.Contains(dev.Driver, ",") {
+		return fmt.Errorf("RawDevice Driver %q must not contain ','", dev.Driver)
+	}
+
+	if dev.Addr != "" {
+		if _, _, err := parsePCIAddr(dev.Addr); err != nil {
+			return fmt.Errorf("RawDevice %s has %s", dev.Driver, err)
+		}
+	}
+
+	reserved := map[string]bool{"driver": true, "id": true, "bus": true, "addr": true}
+	seen := make(map[string]bool)
+	for _, p := range dev.Props {
+		if p.Key == "" {
+			return fmt.Errorf("RawDevice %s has a property with an empty key", dev.Driver)
+		}
+		if strings.ContainsAny(p.Key, ",=") {
+			return fmt.Errorf("RawDevice %s property key %q must not contain ',' or '='", dev.Driver, p.Key)
+		}
+		if reserved[p.Key] {
+			return fmt.Errorf("RawDevice %s property %q must be set with its field", dev.Driver, p.Key)
+		}
+		if seen[p.Key] {
+			return fmt.Errorf("RawDevice %s has duplicate property %q", dev.Driver, p.Key)
+		}
+		seen[p.Key] = true
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the RawDevice.
+func (dev RawDevice) QemuParams(config *Config) []string {
+	var deviceParams []string
+
+	deviceParams = append(deviceParams, dev.Driver)
+
+	if dev.ID != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("id=%s", escapeParam(dev.ID)))
+	}
+
+	if dev.Bus != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", escapeParam(dev.Bus)))
+	}
+
+	// the slot is reserved by reservePCISlots
+	if slot, function, err := parsePCIAddr(dev.Addr); err == nil {
+		deviceParams = append(deviceParams, fmt.Sprintf("addr=%s", pciAddrParam(slot, function)))
+	}
+
+	for _, p := range dev.Props {
+		deviceParams = append(deviceParams, fmt.Sprintf("%s=%s", p.Key, escapeParam(p.Value)))
+	}
+
+	return []string{"-device", strings.Join(deviceParams, ",")}
+}
+
+// escapeParam escapes commas in a qemu option value by doubling them.
+func escapeParam(val string) string {
+	return strings.ReplaceAll(val, ",", ",,")
+}
@@ -0,0 +1,115 @@
+package qcli
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	deviceRawString = "-device virtio-sound-pci,id=snd0,bus=pcie.0,addr=0x07,streams=2,audiodev=audio0,,backup"
+)
+
+func TestAppendRawDevice(t *testing.T) {
+	dev := RawDevice{
+		Driver: "virtio-sound-pci",
+		ID:     "snd0",
+		Bus:    "pcie.0",
+		Addr:   "7",
+		Props: RawDeviceProps{
+			{Key: "streams", Value: "2"},
+			{Key: "audiodev", Value: "audio0,backup"},
+		},
+	}
+
+	testAppend(dev, deviceRawString, t)
+}
+
+func TestRawDevicePCISlot(t *testing.T) {
+	// the watchdog is appended first and must not be auto-allocated the
+	// top slot, 0x1e, given to the raw device
+	c := &Config{
+		WatchdogDevices: []WatchdogDevice{{Model: WatchdogI6300ESB}},
+		RawDevices: []RawDevice{
+			{Driver: "virtio-sound-pci", Addr: "30"},
+			{Driver: "edu", Addr: "0x4.0x1"},
+		},
+	}
+	expected := "-device i6300esb,addr=0x1d -device virtio-sound-pci,addr=0x1e -device edu,addr=0x4.0x1"
+
+	params, err := ConfigureParams(c, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if result := strings.Join(params, " "); result != expected {
+		t.Errorf("Expected %q, found %q", expected, result)
+	}
+}
+
+func TestBadRawDevice(t *testing.T) {
+	bad := []RawDevice{
+		{},
+		{Driver: "virtio-sound-pci,id=snd0"},
+		{Driver: "virtio-sound-pci", Props: RawDeviceProps{{Key: "", Value: "2"}}},
+		{Driver: "virtio-sound-pci", Props: RawDeviceProps{{Key: "id", Value: "snd0"}}},
+		{Driver: "virtio-sound-pci", Props: RawDeviceProps{{Key: "a=b", Value: "2"}}},
+		{Driver: "virtio-sound-pci", Props: RawDeviceProps{{Key: "streams", Value: "2"}, {Key: "streams", Value: "3"}}},
+		{Driver: "virtio-sound-pci", Addr: "-1"},
+		{Driver: "virtio-sound-pci", Addr: "32"},
+		{Driver: "virtio-sound-pci", Addr: "0x20"},
+		{Driver: "virtio-sound-pci", Addr: "0x5.0x8"},
+		{Driver: "virtio-sound-pci", Addr: "slot5"},
+	}
+
+	for _, dev := range bad {
+		if err := dev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid RawDevice %+v", dev)
+		}
+	}
+}
+
+func TestRawDevicePropsYAML(t *testing.T) {
+	content := []byte(`
+driver: virtio-sound-pci
+id: snd0
+properties:
+  streams: 2
+  audiodev: audio0
+  jack: on
+`)
+
+	var dev RawDevice
+	if err := yaml.Unmarshal(content, &dev); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := RawDeviceProps{
+		{Key: "streams", Value: "2"},
+		{Key: "audiodev", Value: "audio0"},
+		{Key: "jack", Value: "on"},
+	}
+	if len(dev.Props) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, dev.Props)
+	}
+	for i := range expected {
+		if dev.Props[i] != expected[i] {
+			t.Fatalf("Expected %+v, got %+v", expected, dev.Props)
+		}
+	}
+
+	out, err := yaml.Marshal(dev)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	var roundTrip RawDevice
+	if err := yaml.Unmarshal(out, &roundTrip); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for i := range expected {
+		if roundTrip.Props[i] != expected[i] {
+			t.Fatalf("Expected %+v after round trip, got %+v", expected, roundTrip.Props)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SSHBanner is the prefix of the identification string an ssh server sends
+// on connect
+const SSHBanner = "SSH-"
+
+// LoginPromptPattern matches a getty login prompt on the serial console
+var LoginPromptPattern = regexp.MustCompile(`(?m)login:\s*$`)
+
+// readinessPollInterval is the delay between two readiness probes
+var readinessPollInterval = 500 * time.Millisecond
+
+// readinessProbeTimeout bounds a single readiness probe
+var readinessProbeTimeout = 2 * time.Second
+
+// WaitForLogin waits up to timeout for a login prompt on the serial console
+// streamed by console.
+func WaitForLogin(console *ConsoleLogger, timeout time.Duration) error {
+	_, err := console.WaitForPattern(LoginPromptPattern, timeout)
+	return err
+}
+
+// HostForwardAddr returns the host address forwarded to the tcp guestPort
+// by a user-mode netdev hostfwd rule, e.g., 127.0.0.1:2222 for a
+// tcp::2222-:22 rule and guestPort 22.
+func (config *Config) HostForwardAddr(guestPort int) (string, error) {
+	for _, netdev := range config.NetDevices {
+		if netdev.Type != USER {
+			continue
+		}
+		for _, rule := range netdev.User.HostForward {
+			if rule.Guest.Port != guestPort || (rule.Protocol != "" && rule.Protocol != "tcp") {
+				continue
+			}
+			if rule.Host.Port == 0 {
+				return "", fmt.Errorf("Netdevice %s forwards guest port %d from an unknown host port", netdev.ID, guestPort)
+			}
+			host := rule.Host.Address
+			if host == "" || host == "0.0.0.0" {
+				host = "127.0.0.1"
+			} else if host == "::" {
+				host = "::1"
+			}
+			return net.JoinHostPort(host, fmt.Sprintf("%d", rule.Host.Port)), nil
+		}
+	}
+	return "", fmt.Errorf("No user netdev forwards a host port to guest tcp port %d", guestPort)
+}
+
+// WaitForTCPPort dials addr until it accepts a connection or ctx is done.
+// If banner is not empty the peer must also send a line starting with
+// banner, which tells a guest service answering through a user-mode
+// hostfwd from qemu accepting and dropping the connection.
+func WaitForTCPPort(ctx context.Context, addr string, banner string) error {
+	var dialer net.Dialer
+	for {
+		err := probeTCPPort(ctx, &dialer, addr, banner)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Timed out waiting for %s: %v", addr, err)
+		case <-time.After(readinessPollInterval):
+		}
+	}
+}
+
+func probeTCPPort(ctx context.Context, dialer *net.Dialer, addr string, banner string) error {
+	probeCtx, cancel := context.WithTimeout(ctx, readinessProbeTimeout)
+	defer cancel()
+
+	conn, err := dialer.DialContext(probeCtx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if banner == "" {
+		return nil
+	}
+
+	conn.SetReadDeadline(time.Now().Add(readinessProbeTimeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no banner from %s: %v", addr, err)
+	}
+	if !strings.HasPrefix(line, banner) {
+		return fmt.Errorf("unexpected banner from %s: %q", addr, strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// WaitForSSHPort waits until the guest ssh server answers on the host port
+// forwarded to the guest port 22 or ctx is done.
+func (config *Config) WaitForSSHPort(ctx context.Context) error {
+	addr, err := config.HostForwardAddr(22)
+	if err != nil {
+		return err
+	}
+	return WaitForTCPPort(ctx, addr, SSHBanner)
+}
+
+// WaitForGuestAgent waits until the qemu guest agent answers a guest-sync
+// on socketPath, the unix socket of its virtserialport chardev, e.g., the
+// one added by ExecuteVirtSerialPortChannelAdd, or ctx is done.
+func WaitForGuestAgent(ctx context.Context, socketPath string) error {
+	var dialer net.Dialer
+	for id := 1; ; id++ {
+		err := probeGuestAgent(ctx, &dialer, socketPath, id)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Timed out waiting for guest agent on %s: %v", socketPath, err)
+		case <-time.After(readinessPollInterval):
+		}
+	}
+}
+
+func probeGuestAgent(ctx context.Context, dialer *net.Dialer, socketPath string, id int) error {
+	probeCtx, cancel := context.WithTimeout(ctx, readinessProbeTimeout)
+	defer cancel()
+
+	conn, err := dialer.DialContext(probeCtx, "unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := probeCtx.Deadline()
+	conn.SetDeadline(deadline)
+
+	// answers to the syncs of earlier probes may still be queued, only
+	// the one echoing this id counts
+	if _, err := fmt.Fprintf(conn, "{\"execute\":\"guest-sync\",\"arguments\":{\"id\":%d}}\n", id); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var resp struct {
+			Return *int `json:"return"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &resp) == nil && resp.Return != nil && *resp.Return == id {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("guest agent socket %s closed", socketPath)
+}
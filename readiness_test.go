@@ -0,0 +1,218 @@
+package qcli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitForLogin(t *testing.T) {
+	socket, connCh := fakeConsole(t)
+
+	logger := NewConsoleLogger(socket, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := logger.Start(ctx); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer logger.Close()
+	conn := <-connCh
+	defer conn.Close()
+
+	conn.Write([]byte("Welcome to Ubuntu 22.04\r\n\r\nvm1 login: "))
+	if err := WaitForLogin(logger, 5*time.Second); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := WaitForLogin(logger, 50*time.Millisecond); err == nil {
+		t.Errorf("Expected timeout waiting for a second login prompt")
+	}
+}
+
+func TestHostForwardAddr(t *testing.T) {
+	config := Config{
+		NetDevices: []NetDevice{
+			{
+				Type: TAP,
+				ID:   "tap0",
+			},
+			{
+				Type: USER,
+				ID:   "user0",
+				User: NetDeviceUser{
+					HostForward: []PortRule{
+						{Protocol: "udp", Host: Port{Port: 5353}, Guest: Port{Port: 22}},
+						{Protocol: "tcp", Host: Port{Port: 22222}, Guest: Port{Port: 22}},
+						{Protocol: "tcp", Host: Port{Address: "::", Port: 8080}, Guest: Port{Port: 80}},
+						{Protocol: "tcp", Guest: Port{Port: 443}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		guestPort int
+		addr      string
+		fail      bool
+	}{
+		{22, "127.0.0.1:22222", false},
+		{80, "[::1]:8080", false},
+		{443, "", true},
+		{25, "", true},
+	} {
+		addr, err := config.HostForwardAddr(tc.guestPort)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("Expected error for guest port %d", tc.guestPort)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if addr != tc.addr {
+			t.Errorf("Expected address %s for guest port %d, found %s", tc.addr, tc.guestPort, addr)
+		}
+	}
+}
+
+// fakeTCPService listens on localhost, sending banner to each connection
+// accepted after ready is closed and dropping the earlier ones like qemu
+// hostfwd does while the guest service is not up.
+func fakeTCPService(t *testing.T, banner string, ready <-chan struct{}) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			select {
+			case <-ready:
+				conn.Write([]byte(banner))
+			default:
+			}
+			conn.Close()
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestWaitForSSHPort(t *testing.T) {
+	saved := readinessPollInterval
+	readinessPollInterval = time.Millisecond
+	defer func() { readinessPollInterval = saved }()
+
+	ready := make(chan struct{})
+	port := fakeTCPService(t, "SSH-2.0-OpenSSH_8.9\r\n", ready)
+	config := Config{
+		NetDevices: []NetDevice{
+			{
+				Type: USER,
+				ID:   "user0",
+				User: NetDeviceUser{
+					HostForward: []PortRule{
+						{Protocol: "tcp", Host: Port{Port: port}, Guest: Port{Port: 22}},
+					},
+				},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	if err := config.WaitForSSHPort(ctx); err == nil {
+		t.Errorf("Expected timeout while the connections are dropped")
+	}
+	cancel()
+
+	close(ready)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := config.WaitForSSHPort(ctx); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
+func TestWaitForTCPPortBanner(t *testing.T) {
+	ready := make(chan struct{})
+	close(ready)
+	port := fakeTCPService(t, "220 smtp ready\r\n", ready)
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := WaitForTCPPort(ctx, addr, ""); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := WaitForTCPPort(ctx, addr, SSHBanner); err == nil {
+		t.Errorf("Expected error for a non ssh banner")
+	}
+}
+
+func TestWaitForGuestAgent(t *testing.T) {
+	saved := readinessPollInterval
+	readinessPollInterval = time.Millisecond
+	defer func() { readinessPollInterval = saved }()
+
+	dir, err := os.MkdirTemp("", "qcli-qga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "qga.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var cmd struct {
+				Execute   string `json:"execute"`
+				Arguments struct {
+					ID int `json:"id"`
+				} `json:"arguments"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &cmd) != nil || cmd.Execute != "guest-sync" {
+				return
+			}
+			// a stale answer to an earlier sync precedes the real one
+			fmt.Fprintf(conn, "{\"return\": %d}\n{\"return\": %d}\n", cmd.Arguments.ID+100, cmd.Arguments.ID)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := WaitForGuestAgent(ctx, socket); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := WaitForGuestAgent(ctx, filepath.Join(dir, "missing.sock")); err == nil {
+		t.Errorf("Expected error for a missing guest agent socket")
+	}
+}
@@ -117,7 +117,7 @@ func (r RngDevice) QemuParams(config *Config) []string {
 		if config.Knobs.IOMMUPlatform {
 			deviceParams = append(deviceParams, "iommu_platform=on")
 		}
-		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", r.DevNo))
+		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(r.DevNo)))
 	}
 
 	if r.Filename != "" {
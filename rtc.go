@@ -28,6 +28,7 @@ package qcli
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // RTCBaseType is the qemu RTC base time type.
@@ -66,48 +67,80 @@ const (
 	NoDriftFix RTCDriftFix = "none"
 )
 
+// RTCDateTimeFormat is the layout of a custom RTC base date and time.
+const RTCDateTimeFormat = "2006-01-02T15:04:05"
+
 // RTC represents a qemu Real Time Clock configuration.
 type RTC struct {
-	// Base is the RTC start time.
-	Base RTCBaseType
+	// Base is the RTC start time, utc or localtime.
+	Base RTCBaseType `yaml:"base"`
+
+	// BaseDateTime is a custom RTC start time, in UTC, mutually
+	// exclusive with Base.
+	BaseDateTime time.Time `yaml:"base-datetime,omitempty"`
 
 	// Clock is the is the RTC clock driver.
-	Clock RTCClock
+	Clock RTCClock `yaml:"clock"`
 
 	// DriftFix is the drift fixing mechanism.
-	DriftFix RTCDriftFix
+	DriftFix RTCDriftFix `yaml:"driftfix"`
 }
 
-// Valid returns true if the RTC structure is valid and complete.
-func (rtc RTC) Valid() bool {
-	if rtc.Clock != Host && rtc.Clock != RT && rtc.Clock != VM {
-		return false
+// Valid returns an error if the RTC structure is not valid.
+func (rtc RTC) Valid() error {
+	switch rtc.Base {
+	case "", UTC, LocalTime:
+	default:
+		return fmt.Errorf("Invalid RTC Base value: '%s', must be one of '%s' or '%s'", rtc.Base, UTC, LocalTime)
+	}
+
+	if rtc.Base != "" && !rtc.BaseDateTime.IsZero() {
+		return fmt.Errorf("RTC Base and BaseDateTime are mutually exclusive")
+	}
+
+	switch rtc.Clock {
+	case "", Host, RT, VM:
+	default:
+		return fmt.Errorf("Invalid RTC Clock value: '%s', must be one of '%s', '%s' or '%s'", rtc.Clock, Host, RT, VM)
 	}
 
-	if rtc.DriftFix != Slew && rtc.DriftFix != NoDriftFix {
-		return false
+	switch rtc.DriftFix {
+	case "", Slew, NoDriftFix:
+	default:
+		return fmt.Errorf("Invalid RTC DriftFix value: '%s', must be one of '%s' or '%s'", rtc.DriftFix, Slew, NoDriftFix)
 	}
 
-	return true
+	return nil
 }
 
-func (config *Config) appendRTC() {
-	if !config.RTC.Valid() {
-		return
+func (config *Config) appendRTC() error {
+	rtc := config.RTC
+	if rtc == (RTC{}) {
+		return nil
+	}
+
+	if err := rtc.Valid(); err != nil {
+		return err
 	}
 
 	var RTCParams []string
 
-	RTCParams = append(RTCParams, fmt.Sprintf("base=%s", string(config.RTC.Base)))
+	if !rtc.BaseDateTime.IsZero() {
+		RTCParams = append(RTCParams, fmt.Sprintf("base=%s", rtc.BaseDateTime.UTC().Format(RTCDateTimeFormat)))
+	} else if rtc.Base != "" {
+		RTCParams = append(RTCParams, fmt.Sprintf("base=%s", string(rtc.Base)))
+	}
 
-	if config.RTC.DriftFix != "" {
-		RTCParams = append(RTCParams, fmt.Sprintf("driftfix=%s", config.RTC.DriftFix))
+	if rtc.DriftFix != "" {
+		RTCParams = append(RTCParams, fmt.Sprintf("driftfix=%s", rtc.DriftFix))
 	}
 
-	if config.RTC.Clock != "" {
-		RTCParams = append(RTCParams, fmt.Sprintf("clock=%s", config.RTC.Clock))
+	if rtc.Clock != "" {
+		RTCParams = append(RTCParams, fmt.Sprintf("clock=%s", rtc.Clock))
 	}
 
 	config.qemuParams = append(config.qemuParams, "-rtc")
 	config.qemuParams = append(config.qemuParams, strings.Join(RTCParams, ","))
+
+	return nil
 }
@@ -1,9 +1,16 @@
 package qcli
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
 
 var (
-	rtcString = "-rtc base=utc,driftfix=slew,clock=host"
+	rtcString         = "-rtc base=utc,driftfix=slew,clock=host"
+	rtcDateTimeString = "-rtc base=2006-06-17T16:01:21,clock=vm"
 )
 
 func TestAppendRTC(t *testing.T) {
@@ -14,11 +21,45 @@ func TestAppendRTC(t *testing.T) {
 	}
 
 	testAppend(rtc, rtcString, t)
+
+	rtc = RTC{
+		BaseDateTime: time.Date(2006, 6, 17, 16, 1, 21, 0, time.UTC),
+		Clock:        VM,
+	}
+
+	testAppend(rtc, rtcDateTimeString, t)
+}
+
+func TestRTCYAML(t *testing.T) {
+	var rtc RTC
+	content := []byte("base-datetime: 2006-06-17T16:01:21Z\nclock: vm\n")
+	if err := yaml.Unmarshal(content, &rtc); err != nil {
+		t.Fatalf("Failed to unmarshal RTC: %s", err)
+	}
+
+	c := &Config{RTC: rtc}
+	if err := c.appendRTC(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if result := strings.Join(c.qemuParams, " "); result != rtcDateTimeString {
+		t.Errorf("Expected %s, found %s", rtcDateTimeString, result)
+	}
+
+	// an unset BaseDateTime is not written as 0001-01-01
+	out, err := yaml.Marshal(RTC{Base: UTC})
+	if err != nil {
+		t.Fatalf("Failed to marshal RTC: %s", err)
+	}
+	if strings.Contains(string(out), "base-datetime") {
+		t.Errorf("Expected no base-datetime for an unset BaseDateTime, found %s", out)
+	}
 }
 
 func TestBadRTC(t *testing.T) {
 	c := &Config{}
-	c.appendRTC()
+	if err := c.appendRTC(); err != nil {
+		t.Errorf("Unexpected error for empty RTC: %s", err)
+	}
 	if len(c.qemuParams) != 0 {
 		t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
 	}
@@ -43,4 +84,16 @@ func TestBadRTC(t *testing.T) {
 	if len(c.qemuParams) != 0 {
 		t.Errorf("Expected empty qemuParams, found %s", c.qemuParams)
 	}
+
+	rtcs := []RTC{
+		{Base: RTCBaseType("gmt")},
+		{Base: UTC, BaseDateTime: time.Now()},
+		{Clock: RTCClock("invalid")},
+		{DriftFix: RTCDriftFix("invalid")},
+	}
+	for _, rtc := range rtcs {
+		if err := rtc.Valid(); err == nil {
+			t.Errorf("Expected error for invalid RTC %+v", rtc)
+		}
+	}
 }
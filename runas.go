@@ -0,0 +1,175 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// RunAsMode selects how qemu is run as the Config Uid, Gid and Groups.
+type RunAsMode string
+
+const (
+	// RunAsCredential sets the qemu process credentials directly, it
+	// requires the caller to be root.
+	RunAsCredential RunAsMode = "credential"
+
+	// RunAsSudo launches qemu with sudo -u, which must not prompt for a
+	// password. The supplementary groups are the ones of the uid in the
+	// group database, Groups must be empty. When file descriptors are
+	// passed to qemu, sudo is run with -C so that it keeps them open,
+	// which requires closefrom_override in sudoers.
+	RunAsSudo RunAsMode = "sudo"
+
+	// RunAsSetpriv launches qemu with the util-linux setpriv helper, e.g.
+	// when the caller has CAP_SETUID and CAP_SETGID but is not root.
+	RunAsSetpriv RunAsMode = "setpriv"
+)
+
+// kvmDevice is the kvm device qemu opens for the kvm accelerator.
+var kvmDevice = "/dev/kvm"
+
+// validateRunAs checks the RunAs mode is supported and that the qemu user
+// has access to /dev/kvm when the kvm accelerator is required. The access of
+// another user is only guessed from the /dev/kvm mode bits, so that a
+// failure is logged as a warning.
+func (config *Config) validateRunAs(logger QMPLog) error {
+	if logger == nil {
+		logger = qmpNullLogger{}
+	}
+
+	switch config.RunAs {
+	case "":
+	case RunAsCredential, RunAsSudo, RunAsSetpriv:
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("RunAs %s is not supported on windows", config.RunAs)
+		}
+		if config.RunAs == RunAsCredential && os.Getuid() != 0 {
+			return fmt.Errorf("RunAs %s requires root, use %s or %s", config.RunAs, RunAsSudo, RunAsSetpriv)
+		}
+		if config.RunAs == RunAsSudo && len(config.Groups) > 0 {
+			return fmt.Errorf("RunAs %s does not support Groups, they are set from the group database", config.RunAs)
+		}
+	default:
+		return fmt.Errorf("Invalid RunAs value: '%s', must be one of '%s', '%s', or '%s'", config.RunAs, RunAsCredential, RunAsSudo, RunAsSetpriv)
+	}
+
+	for _, helper := range config.launchHelpers() {
+		if _, err := exec.LookPath(helper); err != nil {
+			return fmt.Errorf("Launch helper %s not found: %v", helper, err)
+		}
+	}
+
+	if config.requiresKVM() {
+		if config.RunAs == "" {
+			if err := checkKVMAccess(); err != nil {
+				return err
+			}
+		} else if err := checkKVMUserAccess(config.Uid, config.Gid, config.Groups); err != nil {
+			logger.Warningf("%s, qemu may fail to start", err)
+		}
+	}
+
+	return nil
+}
+
+// requiresKVM returns true if qemu cannot start without the kvm accelerator,
+// i.e., kvm is configured without a fallback accelerator.
+func (config *Config) requiresKVM() bool {
+	if len(config.Accels) > 0 {
+		for _, accel := range config.Accels {
+			if accel.Type != AccelKVM {
+				return false
+			}
+		}
+		return true
+	}
+	return config.Machine.Acceleration == MachineAccelerationKVM
+}
+
+// launchHelpers returns the helpers wrapping qemu, outermost first.
+func (config *Config) launchHelpers() []string {
+	var helpers []string
+	if config.RunAs == RunAsSudo {
+		helpers = append(helpers, "sudo")
+	}
+	if config.RunAs == RunAsSetpriv || config.Sandbox.NoNewPrivileges {
+		helpers = append(helpers, "setpriv")
+	}
+	return helpers
+}
+
+// launchCommand returns the command launching qemu with the Config
+// parameters, wrapped by the RunAs and Sandbox helpers if any.
+func (config *Config) launchCommand() (string, []string) {
+	helpers := config.launchHelpers()
+	if len(helpers) == 0 {
+		return config.Path, config.qemuParams
+	}
+
+	path := config.Path
+	if path == "" {
+		path = defaultQemuPath
+	}
+
+	var cmd []string
+	for _, helper := range helpers {
+		cmd = append(cmd, helper)
+		switch helper {
+		case "sudo":
+			cmd = append(cmd, "-n", "-u", fmt.Sprintf("#%d", config.Uid), "-g", fmt.Sprintf("#%d", config.Gid))
+			// sudo closes every file descriptor from 3 by default
+			if len(config.fds) > 0 {
+				cmd = append(cmd, "-C", strconv.Itoa(3+len(config.fds)))
+			}
+		case "setpriv":
+			if config.RunAs == RunAsSetpriv {
+				cmd = append(cmd, fmt.Sprintf("--reuid=%d", config.Uid), fmt.Sprintf("--regid=%d", config.Gid))
+				if len(config.Groups) == 0 {
+					cmd = append(cmd, "--clear-groups")
+				} else {
+					var groups []string
+					for _, g := range config.Groups {
+						groups = append(groups, strconv.FormatUint(uint64(g), 10))
+					}
+					cmd = append(cmd, "--groups="+strings.Join(groups, ","))
+				}
+			}
+			if config.Sandbox.NoNewPrivileges {
+				cmd = append(cmd, "--no-new-privs")
+			}
+		}
+		cmd = append(cmd, "--")
+	}
+	cmd = append(cmd, path)
+	cmd = append(cmd, config.qemuParams...)
+
+	return cmd[0], cmd[1:]
+}
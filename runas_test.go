@@ -0,0 +1,168 @@
+//go:build !windows
+// +build !windows
+
+package qcli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestRunAsLaunchCommand(t *testing.T) {
+	c := &Config{
+		Path:       "/usr/bin/qemu-system-x86_64",
+		Uid:        1000,
+		Gid:        100,
+		Groups:     []uint32{36, 107},
+		qemuParams: []string{"-m", "1G"},
+	}
+
+	path, params := c.launchCommand()
+	if path != c.Path || !reflect.DeepEqual(params, c.qemuParams) {
+		t.Errorf("Unexpected command %s %v", path, params)
+	}
+
+	c.RunAs = RunAsSetpriv
+	path, params = c.launchCommand()
+	expected := []string{"--reuid=1000", "--regid=100", "--groups=36,107", "--", "/usr/bin/qemu-system-x86_64", "-m", "1G"}
+	if path != "setpriv" || !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected setpriv %v, found %s %v", expected, path, params)
+	}
+
+	c.RunAs = RunAsSudo
+	c.Groups = nil
+	path, params = c.launchCommand()
+	expected = []string{"-n", "-u", "#1000", "-g", "#100", "--", "/usr/bin/qemu-system-x86_64", "-m", "1G"}
+	if path != "sudo" || !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected sudo %v, found %s %v", expected, path, params)
+	}
+
+	c.fds = []*os.File{os.Stdin, os.Stdout}
+	path, params = c.launchCommand()
+	expected = []string{"-n", "-u", "#1000", "-g", "#100", "-C", "5", "--", "/usr/bin/qemu-system-x86_64", "-m", "1G"}
+	if path != "sudo" || !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected sudo %v, found %s %v", expected, path, params)
+	}
+
+	attr := (&Config{RunAs: RunAsCredential, Uid: 1000, Gid: 100}).sysProcAttr(qmpTestLogger{})
+	if attr.Credential == nil || attr.Credential.Uid != 1000 || attr.Credential.Gid != 100 {
+		t.Errorf("Expected credential uid=1000 gid=100, found %+v", attr.Credential)
+	}
+	if attr := (&Config{Uid: 1000}).sysProcAttr(qmpTestLogger{}); attr.Credential != nil {
+		t.Errorf("Expected no credential without RunAs, found %+v", attr.Credential)
+	}
+}
+
+func TestRunAsSecretOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("chown to another user requires root")
+	}
+
+	c := &Config{
+		StateDir: t.TempDir(),
+		RunAs:    RunAsSetpriv,
+		Uid:      1000,
+		Gid:      100,
+		Secrets:  []SecretObject{{ID: "sec0", Data: "letmein"}},
+	}
+	if err := c.appendSecrets(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer c.Cleanup()
+
+	info, err := os.Stat(c.tempFiles[0])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	if stat.Uid != c.Uid || stat.Gid != c.Gid {
+		t.Errorf("Expected secret file owner %d:%d, found %d:%d", c.Uid, c.Gid, stat.Uid, stat.Gid)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected secret file mode 0600, found %v", info.Mode().Perm())
+	}
+}
+
+func TestBadRunAs(t *testing.T) {
+	configs := []*Config{
+		{RunAs: "su"},
+		{RunAs: RunAsSudo, Groups: []uint32{36}},
+	}
+	if os.Getuid() != 0 {
+		configs = append(configs, &Config{RunAs: RunAsCredential})
+	}
+	for _, c := range configs {
+		if err := c.validateRunAs(qmpTestLogger{}); err == nil {
+			t.Errorf("Expected error for RunAs %s", c.RunAs)
+		}
+	}
+}
+
+func TestCheckKVMAccess(t *testing.T) {
+	saved := kvmDevice
+	defer func() { kvmDevice = saved }()
+	kvmDevice = filepath.Join(t.TempDir(), "kvm")
+
+	if err := os.WriteFile(kvmDevice, nil, 0660); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(kvmDevice, 0660); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(kvmDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	other := st.Uid + 1000
+	otherGroup := st.Gid + 1000
+
+	if err := checkKVMAccess(); err != nil {
+		t.Errorf("Unexpected error for the current user: %s", err)
+	}
+	if err := checkKVMUserAccess(st.Uid, otherGroup, nil); err != nil {
+		t.Errorf("Unexpected error for the owner: %s", err)
+	}
+	if err := checkKVMUserAccess(other, otherGroup, []uint32{st.Gid}); err != nil {
+		t.Errorf("Unexpected error for a group member: %s", err)
+	}
+	if err := checkKVMUserAccess(other, otherGroup, nil); err == nil {
+		t.Errorf("Expected error for a user without access")
+	}
+
+	// the access of another user is a guess, only warn about it
+	c := &Config{Machine: Machine{Acceleration: MachineAccelerationKVM}, RunAs: RunAsSetpriv, Uid: other, Gid: otherGroup}
+	if _, err := os.Stat("/usr/bin/setpriv"); err == nil {
+		if err := c.validateRunAs(qmpTestLogger{}); err != nil {
+			t.Errorf("Unexpected error for a kvm user without access: %s", err)
+		}
+	}
+
+	c = &Config{Machine: Machine{Acceleration: MachineAccelerationKVM}}
+	if err := c.validateRunAs(qmpTestLogger{}); err != nil {
+		t.Errorf("Unexpected error for the current user: %s", err)
+	}
+	if os.Getuid() != 0 {
+		if err := os.Chmod(kvmDevice, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.validateRunAs(qmpTestLogger{}); err == nil {
+			t.Errorf("Expected error for a current user without access")
+		}
+	}
+	c.Accels = []Accel{{Type: AccelKVM}, {Type: AccelTCG}}
+	if c.requiresKVM() {
+		t.Errorf("Expected kvm with tcg fallback not to be required")
+	}
+
+	kvmDevice = filepath.Join(t.TempDir(), "missing")
+	if err := checkKVMAccess(); err == nil {
+		t.Errorf("Expected error for a missing kvm device")
+	}
+	if err := checkKVMUserAccess(other, otherGroup, nil); err == nil {
+		t.Errorf("Expected error for a missing kvm device")
+	}
+}
@@ -0,0 +1,132 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"os"
+)
+
+// SeccompProfile is a predefined qemu -sandbox seccomp profile.
+type SeccompProfile string
+
+const (
+	// SeccompDefault enables the qemu seccomp filter with its defaults.
+	SeccompDefault SeccompProfile = "default"
+
+	// SeccompStrict also denies the obsolete system calls, gaining
+	// privileges, spawning processes and changing resource limits.
+	SeccompStrict SeccompProfile = "strict"
+)
+
+// seccompProfileParams maps the seccomp profiles to their -sandbox value.
+var seccompProfileParams = map[SeccompProfile]string{
+	SeccompDefault: "on",
+	SeccompStrict:  "on,obsolete=deny,elevateprivileges=deny,spawn=deny,resourcecontrol=deny",
+}
+
+// Sandbox confines the qemu process, e.g. when qcli is used as a
+// lightweight hypervisor agent. The namespaces require root or a
+// UserNamespace.
+type Sandbox struct {
+	// UserNamespace runs qemu in a new user namespace mapping the calling
+	// user, which lets a non-root user create the other namespaces, linux
+	// only
+	UserNamespace bool `yaml:"user-namespace"`
+
+	// MountNamespace runs qemu in a private mount namespace, linux only
+	MountNamespace bool `yaml:"mount-namespace"`
+
+	// NetworkNamespace runs qemu in a new network namespace with only a
+	// loopback interface, linux only. Tap NetDevices must be passed as
+	// FDs opened outside of the namespace.
+	NetworkNamespace bool `yaml:"network-namespace"`
+
+	// NoNewPrivileges prevents qemu and its helpers from gaining
+	// privileges through setuid binaries, it launches qemu with setpriv.
+	NoNewPrivileges bool `yaml:"no-new-privileges"`
+
+	// Seccomp is the seccomp profile, exclusive with SeccompSandbox
+	Seccomp SeccompProfile `yaml:"seccomp"`
+}
+
+// Valid returns an error if the Sandbox structure is not valid and
+// complete.
+func (sandbox Sandbox) Valid() error {
+	if sandbox.Seccomp != "" {
+		if _, ok := seccompProfileParams[sandbox.Seccomp]; !ok {
+			return fmt.Errorf("Invalid Sandbox Seccomp value: '%s', must be one of '%s' or '%s'", sandbox.Seccomp, SeccompDefault, SeccompStrict)
+		}
+	}
+
+	namespaces := sandbox.MountNamespace || sandbox.NetworkNamespace
+	if (namespaces || sandbox.UserNamespace) && !namespacesSupported {
+		return fmt.Errorf("Sandbox namespaces are only supported on linux")
+	}
+
+	// creating namespaces requires CAP_SYS_ADMIN, which a non-root user
+	// only has in its own user namespace
+	if namespaces && !sandbox.UserNamespace && os.Geteuid() != 0 {
+		return fmt.Errorf("Sandbox MountNamespace and NetworkNamespace require root or UserNamespace")
+	}
+
+	return nil
+}
+
+// validateSandbox checks the Sandbox is valid and compatible with the
+// Config.
+func (config *Config) validateSandbox() error {
+	if err := config.Sandbox.Valid(); err != nil {
+		return err
+	}
+
+	if config.Sandbox.Seccomp != "" && config.SeccompSandbox != "" {
+		return fmt.Errorf("Sandbox Seccomp and SeccompSandbox are mutually exclusive")
+	}
+
+	// the user namespace only maps the calling user
+	if config.Sandbox.UserNamespace && config.RunAs != "" {
+		return fmt.Errorf("Sandbox UserNamespace does not support RunAs %s", config.RunAs)
+	}
+
+	if config.Sandbox.NetworkNamespace {
+		for _, netdev := range config.NetDevices {
+			if netdev.Type == TAP && len(netdev.FDs) == 0 {
+				return fmt.Errorf("NetDevice ID=%s requires FDs with Sandbox NetworkNamespace", netdev.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// seccompSandboxParam returns the -sandbox value of the SeccompSandbox or
+// the Sandbox Seccomp profile.
+func (config *Config) seccompSandboxParam() string {
+	if config.SeccompSandbox != "" {
+		return config.SeccompSandbox
+	}
+	return seccompProfileParams[config.Sandbox.Seccomp]
+}
@@ -0,0 +1,52 @@
+//go:build linux
+// +build linux
+
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"os"
+	"syscall"
+)
+
+// namespacesSupported is true if the Sandbox namespaces can be created.
+const namespacesSupported = true
+
+// applySysProcAttr sets the namespaces of the Sandbox in attr.
+func (sandbox Sandbox) applySysProcAttr(attr *syscall.SysProcAttr) {
+	if sandbox.UserNamespace {
+		// the other namespaces are unshared in the new user namespace
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	}
+	if sandbox.MountNamespace {
+		attr.Unshareflags |= syscall.CLONE_NEWNS
+	}
+	if sandbox.NetworkNamespace {
+		attr.Unshareflags |= syscall.CLONE_NEWNET
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package qcli
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestSandboxNamespaces(t *testing.T) {
+	c := &Config{Sandbox: Sandbox{MountNamespace: true, NetworkNamespace: true}}
+	attr := c.sysProcAttr(qmpTestLogger{})
+	if attr.Unshareflags != syscall.CLONE_NEWNS|syscall.CLONE_NEWNET {
+		t.Errorf("Expected mount and network namespaces, found %#x", attr.Unshareflags)
+	}
+}
+
+func TestSandboxUserNamespace(t *testing.T) {
+	c := &Config{Sandbox: Sandbox{UserNamespace: true, NetworkNamespace: true}}
+	if err := c.validateSandbox(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	attr := c.sysProcAttr(qmpTestLogger{})
+	if attr.Cloneflags != syscall.CLONE_NEWUSER || attr.Unshareflags != syscall.CLONE_NEWNET {
+		t.Errorf("Expected user and network namespaces, found %#x %#x", attr.Cloneflags, attr.Unshareflags)
+	}
+	if len(attr.UidMappings) != 1 || attr.UidMappings[0].HostID != os.Getuid() {
+		t.Errorf("Expected the current uid mapping, found %+v", attr.UidMappings)
+	}
+
+	c.RunAs = RunAsSetpriv
+	if err := c.validateSandbox(); err == nil {
+		t.Errorf("Expected error for UserNamespace with RunAs")
+	}
+
+	c = &Config{Sandbox: Sandbox{NetworkNamespace: true}}
+	err := c.validateSandbox()
+	if os.Geteuid() == 0 && err != nil {
+		t.Errorf("Unexpected error for root: %s", err)
+	}
+	if os.Geteuid() != 0 && err == nil {
+		t.Errorf("Expected error for namespaces without root or UserNamespace")
+	}
+}
@@ -0,0 +1,67 @@
+package qcli
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestAppendSandboxSeccomp(t *testing.T) {
+	c := &Config{Sandbox: Sandbox{Seccomp: SeccompStrict}}
+	if err := c.validateSandbox(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	c.appendSeccompSandbox()
+	expected := []string{"-sandbox", "on,obsolete=deny,elevateprivileges=deny,spawn=deny,resourcecontrol=deny"}
+	if !reflect.DeepEqual(expected, c.qemuParams) {
+		t.Errorf("Expected %v, found %v", expected, c.qemuParams)
+	}
+}
+
+func TestSandboxLaunchCommand(t *testing.T) {
+	c := &Config{
+		Path:       "/usr/bin/qemu-system-x86_64",
+		Uid:        1000,
+		Gid:        100,
+		RunAs:      RunAsSudo,
+		Sandbox:    Sandbox{NoNewPrivileges: true},
+		qemuParams: []string{"-m", "1G"},
+	}
+	path, params := c.launchCommand()
+	expected := []string{"-n", "-u", "#1000", "-g", "#100", "--", "setpriv", "--no-new-privs", "--", "/usr/bin/qemu-system-x86_64", "-m", "1G"}
+	if path != "sudo" || !reflect.DeepEqual(expected, params) {
+		t.Errorf("Expected sudo %v, found %s %v", expected, path, params)
+	}
+
+	c.RunAs = RunAsSetpriv
+	path, params = c.launchCommand()
+	expected = []string{"--reuid=1000", "--regid=100", "--clear-groups", "--no-new-privs", "--", "/usr/bin/qemu-system-x86_64", "-m", "1G"}
+	if path != "setpriv" || !reflect.DeepEqual(expected, params) {
+		t.Errorf("Expected setpriv %v, found %s %v", expected, path, params)
+	}
+}
+
+func TestBadSandbox(t *testing.T) {
+	configs := []*Config{
+		{Sandbox: Sandbox{Seccomp: "paranoid"}},
+		{SeccompSandbox: "on", Sandbox: Sandbox{Seccomp: SeccompDefault}},
+		{
+			Sandbox:    Sandbox{NetworkNamespace: true},
+			NetDevices: []NetDevice{{Type: TAP, ID: "tap0"}},
+		},
+	}
+	for _, c := range configs {
+		if err := c.validateSandbox(); err == nil {
+			t.Errorf("Expected error for invalid Sandbox %+v", c.Sandbox)
+		}
+	}
+
+	c := &Config{
+		Sandbox:    Sandbox{UserNamespace: true, NetworkNamespace: true},
+		NetDevices: []NetDevice{{Type: TAP, ID: "tap0", FDs: []*os.File{os.Stdin}}},
+	}
+	if err := c.validateSandbox(); err != nil && runtime.GOOS == "linux" {
+		t.Errorf("Unexpected error for tap with FDs: %s", err)
+	}
+}
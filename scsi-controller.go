@@ -34,6 +34,10 @@ import (
 type SCSIControllerDevice struct {
 	ID string `yaml:"id"`
 
+	// Driver is the controller driver, defaults to virtio-scsi. Set to
+	// spapr-vscsi for the pseries machine virtual SCSI controller.
+	Driver DeviceDriver `yaml:"driver,omitempty"`
+
 	// Bus on which the SCSI controller is attached, this is optional
 	Bus string `yaml:"bus,omitempty"`
 
@@ -74,6 +78,9 @@ func (scsiCon SCSIControllerDevice) Valid() error {
 	if scsiCon.ID == "" {
 		return fmt.Errorf("SCSIController has empty ID field")
 	}
+	if scsiCon.Driver == SpaprVSCSI && (scsiCon.Addr != "" || scsiCon.IOThread != "") {
+		return fmt.Errorf("SCSIController ID=%s Driver=%s does not support Addr or IOThread", scsiCon.ID, scsiCon.Driver)
+	}
 	return nil
 }
 
@@ -85,6 +92,14 @@ func (scsiCon SCSIControllerDevice) QemuParams(config *Config) []string {
 
 	driver := scsiCon.deviceName(config)
 	deviceParams = append(deviceParams, fmt.Sprintf("%s,id=%s", driver, scsiCon.ID))
+
+	// spapr-vscsi is a VIO device, none of the virtio options apply
+	if scsiCon.Driver == SpaprVSCSI {
+		qemuParams = append(qemuParams, "-device")
+		qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+		return qemuParams
+	}
+
 	addr := config.pciBusSlots.GetSlot(scsiCon.Addr)
 	if addr > 0 {
 		deviceParams = append(deviceParams, fmt.Sprintf("addr=0x%02x", addr))
@@ -100,7 +115,7 @@ func (scsiCon SCSIControllerDevice) QemuParams(config *Config) []string {
 	if scsiCon.IOThread != "" {
 		deviceParams = append(deviceParams, fmt.Sprintf("iothread=%s", scsiCon.IOThread))
 		// FIXME, add in tuneables
-		objectParams = append(objectParams, fmt.Sprintf("iothread,poll-max-ns=32,id=%s", scsiCon.IOThread))
+		objectParams = config.ioThreadParams(scsiCon.IOThread, "poll-max-ns=32")
 	}
 	if scsiCon.Transport.isVirtioPCI(config) && scsiCon.ROMFile != "" {
 		deviceParams = append(deviceParams, fmt.Sprintf("romfile=%s", scsiCon.ROMFile))
@@ -110,21 +125,22 @@ func (scsiCon SCSIControllerDevice) QemuParams(config *Config) []string {
 		if config.Knobs.IOMMUPlatform {
 			deviceParams = append(deviceParams, "iommu_platform=on")
 		}
-		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", scsiCon.DevNo))
+		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(scsiCon.DevNo)))
 	}
 
 	qemuParams = append(qemuParams, "-device")
 	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
-	if len(objectParams) > 0 {
-		qemuParams = append(qemuParams, "-object")
-		qemuParams = append(qemuParams, strings.Join(objectParams, ","))
-	}
+	qemuParams = append(qemuParams, objectParams...)
 	return qemuParams
 }
 
 // deviceName returns the QEMU device name for the current combination of
 // driver and transport.
 func (scsiCon SCSIControllerDevice) deviceName(config *Config) string {
+	if scsiCon.Driver != "" && scsiCon.Driver != VirtioScsi {
+		return string(scsiCon.Driver)
+	}
+
 	if scsiCon.Transport == "" {
 		scsiCon.Transport = scsiCon.Transport.defaultTransport(config)
 	}
@@ -0,0 +1,257 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretFormat is the encoding of the data held by a SecretObject.
+type SecretFormat string
+
+const (
+	// SecretFormatRaw means the secret data is used as is.
+	SecretFormatRaw SecretFormat = "raw"
+
+	// SecretFormatBase64 means the secret data is base64 encoded.
+	SecretFormatBase64 SecretFormat = "base64"
+)
+
+// SecretObject describes a -object secret, which provides passwords and
+// keys, e.g., the LUKS passphrase of an encrypted disk, to other objects
+// and devices by ID.
+type SecretObject struct {
+	// ID is the secret identifier referenced by its users.
+	ID string `yaml:"id"`
+
+	// Data is the secret value, mutually exclusive with File. It is
+	// written to a private file under Config.StateDir so that it is not
+	// visible in the qemu command line. With Config.RunAs the file is
+	// owned by Config.Uid and Config.Gid, which the caller must be allowed
+	// to chown to.
+	Data string `yaml:"data"`
+
+	// File is the path to a file holding the secret value, mutually
+	// exclusive with Data.
+	File string `yaml:"file"`
+
+	// Format is the encoding of Data or of the File contents.
+	Format SecretFormat `yaml:"format"`
+
+	// KeyID is the ID of another secret used to decrypt this secret
+	// with AES-256-CBC.
+	KeyID string `yaml:"keyid"`
+
+	// IV is the base64 encoded initialization vector used to decrypt the
+	// secret, required when KeyID is set.
+	IV string `yaml:"iv"`
+}
+
+// Valid returns an error if the SecretObject structure is not valid and
+// complete.
+func (secret SecretObject) Valid() error {
+	if secret.ID == "" {
+		return fmt.Errorf("SecretObject has empty ID field")
+	}
+
+	if secret.Data == "" && secret.File == "" {
+		return fmt.Errorf("SecretObject ID=%s requires either Data or File field to be set", secret.ID)
+	}
+
+	if secret.Data != "" && secret.File != "" {
+		return fmt.Errorf("SecretObject ID=%s Data and File field are mutually exclusive", secret.ID)
+	}
+
+	switch secret.Format {
+	case "", SecretFormatRaw, SecretFormatBase64:
+	default:
+		return fmt.Errorf("Invalid SecretObject Format value: '%s', must be one of '%s' or '%s'", secret.Format, SecretFormatRaw, SecretFormatBase64)
+	}
+
+	if secret.KeyID != "" && secret.IV == "" {
+		return fmt.Errorf("SecretObject ID=%s with KeyID must have IV", secret.ID)
+	}
+
+	if secret.KeyID == "" && secret.IV != "" {
+		return fmt.Errorf("SecretObject ID=%s with IV must have KeyID", secret.ID)
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the SecretObject.
+func (secret SecretObject) QemuParams() []string {
+	var objectParams []string
+
+	objectParams = append(objectParams, "secret")
+	objectParams = append(objectParams, fmt.Sprintf("id=%s", secret.ID))
+
+	if secret.Data != "" {
+		objectParams = append(objectParams, fmt.Sprintf("data=%s", secret.Data))
+	}
+	if secret.File != "" {
+		objectParams = append(objectParams, fmt.Sprintf("file=%s", secret.File))
+	}
+	if secret.Format != "" {
+		objectParams = append(objectParams, fmt.Sprintf("format=%s", secret.Format))
+	}
+	if secret.KeyID != "" {
+		objectParams = append(objectParams, fmt.Sprintf("keyid=%s", secret.KeyID))
+		objectParams = append(objectParams, fmt.Sprintf("iv=%s", secret.IV))
+	}
+
+	return []string{"-object", strings.Join(objectParams, ",")}
+}
+
+// validateSecretRefs checks that every secret referenced by the
+// configuration, either by another secret or by an encrypted block
+// device, is defined in Secrets.
+func (config *Config) validateSecretRefs() error {
+	ids := make(map[string]bool)
+	for _, secret := range config.Secrets {
+		if ids[secret.ID] {
+			return fmt.Errorf("SecretObject ID=%s is defined more than once", secret.ID)
+		}
+		ids[secret.ID] = true
+	}
+
+	for _, secret := range config.Secrets {
+		if secret.KeyID != "" && !ids[secret.KeyID] {
+			return fmt.Errorf("SecretObject ID=%s references unknown KeyID '%s'", secret.ID, secret.KeyID)
+		}
+	}
+
+	for _, blkdev := range config.BlkDevices {
+		if blkdev.KeySecret != "" && !ids[blkdev.KeySecret] {
+			return fmt.Errorf("BlockDevice ID=%s references unknown KeySecret '%s'", blkdev.ID, blkdev.KeySecret)
+		}
+	}
+
+	return nil
+}
+
+// writeData writes the Data of the SecretObject to a temporary file,
+// only readable by its owner, and returns the file path. The file is owned
+// by uid and gid, -1 keeps the current user or group.
+func (secret SecretObject) writeData(dir string, uid, gid int) (string, error) {
+	f, err := os.CreateTemp(dir, "secret-")
+	if err != nil {
+		return "", fmt.Errorf("Failed to create secret file for %s: %s", secret.ID, err)
+	}
+	defer f.Close()
+
+	if err := f.Chmod(0600); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("Failed to set secret file mode for %s: %s", secret.ID, err)
+	}
+
+	if uid != -1 || gid != -1 {
+		if err := f.Chown(uid, gid); err != nil {
+			os.Remove(f.Name())
+			return "", fmt.Errorf("Failed to set secret file owner for %s: %s", secret.ID, err)
+		}
+	}
+
+	if _, err := f.WriteString(secret.Data); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("Failed to write secret file for %s: %s", secret.ID, err)
+	}
+
+	return f.Name(), nil
+}
+
+// orderSecrets returns the secrets ordered so that each secret comes after
+// the secret referenced by its KeyID, as qemu resolves the KeyID when the
+// object is created.
+func orderSecrets(secrets []SecretObject) ([]SecretObject, error) {
+	var ordered []SecretObject
+	added := make(map[string]bool)
+	for len(ordered) < len(secrets) {
+		progress := false
+		for _, secret := range secrets {
+			if added[secret.ID] || (secret.KeyID != "" && !added[secret.KeyID]) {
+				continue
+			}
+			ordered = append(ordered, secret)
+			added[secret.ID] = true
+			progress = true
+		}
+		if !progress {
+			return nil, fmt.Errorf("SecretObject KeyID references form a cycle")
+		}
+	}
+
+	return ordered, nil
+}
+
+func (config *Config) appendSecrets() error {
+	var errors []string
+	for _, secret := range config.Secrets {
+		if err := secret.Valid(); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Failed to append %d SecretObject(s):\n%s", len(errors), strings.Join(errors, "\n"))
+	}
+
+	if err := config.validateSecretRefs(); err != nil {
+		return err
+	}
+
+	secrets, err := orderSecrets(config.Secrets)
+	if err != nil {
+		return err
+	}
+
+	// qemu must be able to read the secret files when it runs as another
+	// user
+	uid, gid := -1, -1
+	if config.RunAs != "" {
+		uid, gid = int(config.Uid), int(config.Gid)
+	}
+
+	var params []string
+	for _, secret := range secrets {
+		if secret.Data != "" {
+			path, err := secret.writeData(config.StateDir, uid, gid)
+			if err != nil {
+				return err
+			}
+			config.tempFiles = append(config.tempFiles, path)
+			secret.File = path
+			secret.Data = ""
+		}
+		params = append(params, secret.QemuParams()...)
+	}
+
+	config.qemuParams = append(config.qemuParams, params...)
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package qcli
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+var (
+	secretFileString  = "-object secret,id=sec0,file=/run/vm/luks.key,format=base64"
+	secretKeyIDString = "-object secret,id=master0,file=/run/vm/master.key,format=base64 -object secret,id=sec0,file=/run/vm/luks.key,format=base64,keyid=master0,iv=MTIzNDU2Nzg5MGFiY2RlZg=="
+)
+
+func TestAppendSecretObject(t *testing.T) {
+	secret := SecretObject{
+		ID:     "sec0",
+		File:   "/run/vm/luks.key",
+		Format: SecretFormatBase64,
+	}
+	testConfigAppend(&Config{}, secret, secretFileString, t)
+}
+
+func TestAppendSecretObjectData(t *testing.T) {
+	c := &Config{
+		StateDir: t.TempDir(),
+		Secrets:  []SecretObject{{ID: "sec0", Data: "letmein"}},
+	}
+	if err := c.appendSecrets(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	result := strings.Join(c.qemuParams, " ")
+	if strings.Contains(result, "letmein") {
+		t.Fatalf("Secret data found in the qemu parameters: %s", result)
+	}
+	if len(c.tempFiles) != 1 {
+		t.Fatalf("Expected one secret file, found %v", c.tempFiles)
+	}
+
+	path := c.tempFiles[0]
+	expected := "-object secret,id=sec0,file=" + path
+	if result != expected {
+		t.Fatalf("Failed to append parameters\nexpected[%s]\n!=\n   found[%s]", expected, result)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected secret file mode 0600, found %v", info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(data) != "letmein" {
+		t.Fatalf("Expected secret file content 'letmein', found '%s'", data)
+	}
+
+	if err := c.Cleanup(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be removed", path)
+	}
+}
+
+func TestAppendSecretObjectKeyID(t *testing.T) {
+	// sec0 is listed first but must be created after master0
+	config := &Config{
+		Secrets: []SecretObject{
+			{
+				ID:     "sec0",
+				File:   "/run/vm/luks.key",
+				Format: SecretFormatBase64,
+				KeyID:  "master0",
+				IV:     "MTIzNDU2Nzg5MGFiY2RlZg==",
+			},
+			{
+				ID:     "master0",
+				File:   "/run/vm/master.key",
+				Format: SecretFormatBase64,
+			},
+		},
+	}
+	if err := config.appendSecrets(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	result := strings.Join(config.qemuParams, " ")
+	if result != secretKeyIDString {
+		t.Fatalf("Failed to append parameters\nexpected[%s]\n!=\n   found[%s]", secretKeyIDString, result)
+	}
+}
+
+func TestBadSecretObject(t *testing.T) {
+	bad := []SecretObject{
+		{Data: "letmein"},
+		{ID: "sec0"},
+		{ID: "sec0", Data: "letmein", File: "/run/vm/luks.key"},
+		{ID: "sec0", Data: "letmein", Format: "hex"},
+		{ID: "sec0", Data: "letmein", KeyID: "master0"},
+		{ID: "sec0", Data: "letmein", IV: "MTIzNDU2Nzg5MGFiY2RlZg=="},
+	}
+	for _, secret := range bad {
+		if err := secret.Valid(); err == nil {
+			t.Errorf("Expected error for invalid SecretObject %+v", secret)
+		}
+	}
+}
+
+func TestSecretObjectRefs(t *testing.T) {
+	blkdev := BlockDevice{
+		Driver:    VirtioBlock,
+		ID:        "hd0",
+		File:      "/var/lib/vm.img",
+		Format:    QCOW2,
+		Interface: NoInterface,
+		KeySecret: "sec0",
+	}
+
+	config := &Config{
+		Secrets:    []SecretObject{{ID: "sec0", Data: "letmein"}},
+		BlkDevices: []BlockDevice{blkdev},
+	}
+	if err := config.appendSecrets(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	bad := []*Config{
+		{
+			Secrets:    []SecretObject{{ID: "sec1", Data: "letmein"}},
+			BlkDevices: []BlockDevice{blkdev},
+		},
+		{
+			Secrets: []SecretObject{{ID: "sec0", Data: "letmein"}, {ID: "sec0", Data: "letmein"}},
+		},
+		{
+			Secrets: []SecretObject{{ID: "sec0", Data: "Zm9vYmFy", KeyID: "master0", IV: "MTIzNDU2Nzg5MGFiY2RlZg=="}},
+		},
+		{
+			Secrets: []SecretObject{
+				{ID: "sec0", File: "/run/vm/luks.key", KeyID: "sec1", IV: "MTIzNDU2Nzg5MGFiY2RlZg=="},
+				{ID: "sec1", File: "/run/vm/master.key", KeyID: "sec0", IV: "MTIzNDU2Nzg5MGFiY2RlZg=="},
+			},
+		},
+	}
+	for _, config := range bad {
+		if err := config.appendSecrets(); err == nil {
+			t.Errorf("Expected error for invalid secret references %+v", config.Secrets)
+		}
+		if len(config.qemuParams) != 0 {
+			t.Errorf("Expected no parameters on error, got %v", config.qemuParams)
+		}
+	}
+}
@@ -190,7 +190,7 @@ func (dev SerialDevice) QemuParams(config *Config) []string {
 			if config.Knobs.IOMMUPlatform {
 				deviceParams = append(deviceParams, "iommu_platform=on")
 			}
-			deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", dev.DevNo))
+			deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(dev.DevNo)))
 		}
 	case PCISerialDevice:
 		if dev.MaxPorts == 1 {
@@ -238,3 +238,21 @@ func (dev SerialDevice) deviceName(config *Config) string {
 	}
 	return devNameStr
 }
+
+// VirtioSerialBus returns the bus name that virtserialport devices should
+// use to attach to the virtio-serial controller with the given id.  If id
+// is empty, the first virtio-serial controller found in config is used.
+func (config *Config) VirtioSerialBus(id string) (string, error) {
+	for _, dev := range config.SerialDevices {
+		if dev.Driver != VirtioSerial {
+			continue
+		}
+		if id == "" || dev.ID == id {
+			return fmt.Sprintf("%s.0", dev.ID), nil
+		}
+	}
+	if id != "" {
+		return "", fmt.Errorf("No virtio-serial controller with ID '%s' found in config", id)
+	}
+	return "", fmt.Errorf("No virtio-serial controller found in config")
+}
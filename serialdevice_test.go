@@ -169,3 +169,37 @@ func TestAppendLongPCISerialDeviceChardevIDs(t *testing.T) {
 		t.Fatalf("SerialDevice should not have ChardevIDs list of length > 4")
 	}
 }
+
+func TestVirtioSerialBus(t *testing.T) {
+	config := &Config{
+		SerialDevices: []SerialDevice{
+			{Driver: PCISerialDevice, ID: "pciser0", ChardevIDs: []string{"serial0"}, MaxPorts: 1},
+			{Driver: VirtioSerial, ID: "serial0"},
+			{Driver: VirtioSerial, ID: "serial1"},
+		},
+	}
+
+	bus, err := config.VirtioSerialBus("")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if bus != "serial0.0" {
+		t.Fatalf("Expected bus serial0.0, got %s", bus)
+	}
+
+	bus, err = config.VirtioSerialBus("serial1")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if bus != "serial1.0" {
+		t.Fatalf("Expected bus serial1.0, got %s", bus)
+	}
+
+	if _, err := config.VirtioSerialBus("pciser0"); err == nil {
+		t.Fatalf("Expected error for non virtio-serial controller")
+	}
+
+	if _, err := (&Config{}).VirtioSerialBus(""); err == nil {
+		t.Fatalf("Expected error for config without virtio-serial controller")
+	}
+}
@@ -0,0 +1,158 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ShutdownLevel is the step of the Shutdown escalation which stopped the
+// guest.
+type ShutdownLevel int
+
+const (
+	// ShutdownFailed means qemu is still running after every step
+	ShutdownFailed ShutdownLevel = iota
+
+	// ShutdownPowerdown means the guest shut down on system_powerdown
+	ShutdownPowerdown
+
+	// ShutdownQuit means qemu exited on the quit command
+	ShutdownQuit
+
+	// ShutdownKill means qemu exited once killed
+	ShutdownKill
+)
+
+func (l ShutdownLevel) String() string {
+	switch l {
+	case ShutdownPowerdown:
+		return "powerdown"
+	case ShutdownQuit:
+		return "quit"
+	case ShutdownKill:
+		return "kill"
+	}
+	return "failed"
+}
+
+// shutdownPollInterval is the delay between two run state queries while
+// waiting for the guest to shut down
+var shutdownPollInterval = 250 * time.Millisecond
+
+// Shutdown stops the qemu instance managed by q, escalating from an ACPI
+// powerdown request, to the quit command and finally to kill, which is
+// typically the Kill method of the qemu os.Process or the cancel function
+// of the context qemu was launched with. kill may be nil. Each step is
+// given timeout to take effect and the level of the successful one is
+// returned.
+//
+// The guest is considered down when qemu exits, closing the QMP socket,
+// or when it reports the shutdown run state, as it does when launched
+// with -no-shutdown.
+//
+// Shutdown must not be called concurrently with QMP.Shutdown.
+func Shutdown(ctx context.Context, q *QMP, timeout time.Duration, kill func() error) (ShutdownLevel, error) {
+	var errs []error
+
+	powerdownCtx, cancel := context.WithTimeout(ctx, timeout)
+	err := q.ExecuteSystemPowerdown(powerdownCtx)
+	if err == nil || q.disconnected() {
+		err = q.waitShutdown(powerdownCtx, true)
+	}
+	cancel()
+	if err == nil {
+		return ShutdownPowerdown, nil
+	}
+	errs = append(errs, fmt.Errorf("system_powerdown: %v", err))
+	if ctx.Err() != nil {
+		return ShutdownFailed, ctx.Err()
+	}
+
+	quitCtx, cancel := context.WithTimeout(ctx, timeout)
+	// qemu may exit before answering quit, only its exit tells
+	quitErr := q.ExecuteQuit(quitCtx)
+	err = q.waitShutdown(quitCtx, false)
+	cancel()
+	if err != nil && quitErr != nil {
+		err = quitErr
+	}
+	if err == nil {
+		return ShutdownQuit, nil
+	}
+	errs = append(errs, fmt.Errorf("quit: %v", err))
+	if ctx.Err() != nil {
+		return ShutdownFailed, ctx.Err()
+	}
+
+	if kill == nil {
+		return ShutdownFailed, fmt.Errorf("Failed to shut down qemu: %v", errs)
+	}
+	if err := kill(); err != nil {
+		errs = append(errs, fmt.Errorf("kill: %v", err))
+		return ShutdownFailed, fmt.Errorf("Failed to shut down qemu: %v", errs)
+	}
+	killCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := q.waitShutdown(killCtx, false); err != nil {
+		errs = append(errs, fmt.Errorf("kill: %v", err))
+		return ShutdownFailed, fmt.Errorf("Failed to shut down qemu: %v", errs)
+	}
+	return ShutdownKill, nil
+}
+
+// disconnected returns true once the QMP connection is closed
+func (q *QMP) disconnected() bool {
+	select {
+	case <-q.disconnectedCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitShutdown waits until qemu closes the QMP connection or, if
+// pollStatus is set, reports the shutdown run state.
+func (q *QMP) waitShutdown(ctx context.Context, pollStatus bool) error {
+	for {
+		if pollStatus && !q.disconnected() {
+			status, err := q.ExecuteQueryStatus(ctx)
+			if err == nil && ToRunState(status.Status) == RunStateShutdown {
+				return nil
+			}
+		}
+
+		select {
+		case <-q.disconnectedCh:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("qemu is still running: %v", ctx.Err())
+		case <-time.After(shutdownPollInterval):
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package qcli
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Checks that a guest shutting down on system_powerdown stops the
+// escalation.
+func TestShutdownPowerdown(t *testing.T) {
+	var wg sync.WaitGroup
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("system_powerdown", nil, "return", nil)
+	buf.AddEvent("POWERDOWN", time.Millisecond*10, nil, nil)
+	buf.AddCommand("query-status", nil, "return", map[string]interface{}{
+		"running":    false,
+		"singlestep": false,
+		"status":     "shutdown",
+	})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	buf.startEventLoop(&wg)
+
+	level, err := Shutdown(context.Background(), q, time.Second, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if level != ShutdownPowerdown {
+		t.Errorf("Expected level %s, found %s", ShutdownPowerdown, level)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+	wg.Wait()
+}
+
+// Checks that quit is sent when system_powerdown fails and that qemu
+// closing the connection completes the shutdown.
+func TestShutdownQuit(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("system_powerdown", nil, "error", nil)
+	buf.AddCommand("quit", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(buf.forceFail)
+	}()
+
+	level, err := Shutdown(context.Background(), q, time.Second, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if level != ShutdownQuit {
+		t.Errorf("Expected level %s, found %s", ShutdownQuit, level)
+	}
+	<-disconnectedCh
+}
+
+// Checks that the kill function is called when qemu ignores quit.
+func TestShutdownKill(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("system_powerdown", nil, "error", nil)
+	buf.AddCommand("quit", nil, "error", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	killed := false
+	kill := func() error {
+		killed = true
+		close(buf.forceFail)
+		return nil
+	}
+	level, err := Shutdown(context.Background(), q, 50*time.Millisecond, kill)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if level != ShutdownKill || !killed {
+		t.Errorf("Expected level %s, found %s", ShutdownKill, level)
+	}
+	<-disconnectedCh
+}
+
+// Checks that Shutdown fails when qemu keeps running and cannot be killed.
+func TestShutdownFailed(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("system_powerdown", nil, "error", nil)
+	buf.AddCommand("quit", nil, "error", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	level, err := Shutdown(context.Background(), q, 50*time.Millisecond, nil)
+	if err == nil {
+		t.Errorf("Expected error without a kill function")
+	}
+	if level != ShutdownFailed {
+		t.Errorf("Expected level %s, found %s", ShutdownFailed, level)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
@@ -0,0 +1,58 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"fmt"
+)
+
+// appendLoadVM starts the VM from the internal snapshot LoadVM, which must
+// have been saved in the qcow2 disks of the configuration, e.g., with
+// QMP.SaveSnapshot.
+func (config *Config) appendLoadVM() error {
+	if config.LoadVM == "" {
+		return nil
+	}
+
+	if config.Incoming.MigrationType != 0 {
+		return fmt.Errorf("LoadVM and Incoming are mutually exclusive")
+	}
+
+	hasQCOW2 := false
+	for _, blkdev := range config.BlkDevices {
+		if blkdev.Format == QCOW2 && !blkdev.ReadOnly {
+			hasQCOW2 = true
+			break
+		}
+	}
+	if !hasQCOW2 {
+		return fmt.Errorf("LoadVM requires a writable qcow2 BlockDevice holding the snapshot")
+	}
+
+	config.qemuParams = append(config.qemuParams, "-loadvm", config.LoadVM)
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package qcli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAppendLoadVM(t *testing.T) {
+	c := &Config{
+		LoadVM: "warm",
+		BlkDevices: []BlockDevice{
+			{Driver: VirtioBlock, ID: "hd0", File: "/var/lib/vm.img", Format: QCOW2, Interface: NoInterface},
+		},
+	}
+	if err := c.appendLoadVM(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if result := strings.Join(c.qemuParams, " "); result != "-loadvm warm" {
+		t.Fatalf("Failed to append parameters\nexpected[-loadvm warm]\n!=\n   found[%s]", result)
+	}
+
+	bad := []*Config{
+		{LoadVM: "warm"},
+		{
+			LoadVM: "warm",
+			BlkDevices: []BlockDevice{
+				{Driver: VirtioBlock, ID: "hd0", File: "/var/lib/vm.img", Format: RAW, Interface: NoInterface},
+			},
+		},
+		{
+			LoadVM: "warm",
+			BlkDevices: []BlockDevice{
+				{Driver: VirtioBlock, ID: "hd0", File: "/var/lib/vm.img", Format: QCOW2, Interface: NoInterface},
+			},
+			Incoming: Incoming{MigrationType: MigrationDefer},
+		},
+	}
+	for _, c := range bad {
+		if err := c.appendLoadVM(); err == nil {
+			t.Errorf("Expected error for invalid LoadVM config %+v", c)
+		}
+	}
+}
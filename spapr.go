@@ -0,0 +1,72 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SpaprPCIHostBridgeDevice represents an additional PCI host bridge (PHB)
+// on the pseries machine. The machine always provides PHB index 0.
+type SpaprPCIHostBridgeDevice struct {
+	// ID is the bridge id, devices are attached to it with bus=<ID>
+	ID string `yaml:"id"`
+
+	// Index is the unique PHB index, 1 and up
+	Index int `yaml:"index"`
+
+	// NUMANode is the NUMA node associated with the bridge
+	NUMANode *int `yaml:"numa-node"`
+}
+
+// Valid returns an error if the SpaprPCIHostBridgeDevice structure is not
+// valid and complete.
+func (phb SpaprPCIHostBridgeDevice) Valid() error {
+	if phb.ID == "" {
+		return fmt.Errorf("SpaprPCIHostBridgeDevice has empty ID field")
+	}
+
+	if phb.Index < 1 {
+		return fmt.Errorf("SpaprPCIHostBridgeDevice ID=%s Index must be >= 1, index 0 is the default bridge", phb.ID)
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of this host bridge.
+func (phb SpaprPCIHostBridgeDevice) QemuParams(config *Config) []string {
+	var deviceParams []string
+
+	deviceParams = append(deviceParams, string(SpaprPCIHostBridge))
+	deviceParams = append(deviceParams, fmt.Sprintf("index=%d", phb.Index))
+	deviceParams = append(deviceParams, fmt.Sprintf("id=%s", phb.ID))
+
+	if phb.NUMANode != nil {
+		deviceParams = append(deviceParams, fmt.Sprintf("numa_node=%d", *phb.NUMANode))
+	}
+
+	return []string{"-device", strings.Join(deviceParams, ",")}
+}
@@ -0,0 +1,48 @@
+package qcli
+
+import "testing"
+
+var (
+	deviceSpaprPHBString   = "-device spapr-pci-host-bridge,index=1,id=pci.1,numa_node=0"
+	deviceSpaprVSCSIString = "-device spapr-vscsi,id=scsi0"
+	deviceSpaprVTYString   = "-device spapr-vty,chardev=char0,id=vty0 -chardev stdio,id=char0"
+)
+
+func TestAppendSpaprPCIHostBridge(t *testing.T) {
+	node := 0
+	phb := SpaprPCIHostBridgeDevice{
+		ID:       "pci.1",
+		Index:    1,
+		NUMANode: &node,
+	}
+	testAppend(phb, deviceSpaprPHBString, t)
+
+	for _, bad := range []SpaprPCIHostBridgeDevice{{Index: 1}, {ID: "pci.0"}} {
+		if err := bad.Valid(); err == nil {
+			t.Errorf("Expected error for invalid SpaprPCIHostBridgeDevice %+v", bad)
+		}
+	}
+}
+
+func TestAppendSpaprVSCSI(t *testing.T) {
+	scsiCon := SCSIControllerDevice{
+		ID:     "scsi0",
+		Driver: SpaprVSCSI,
+	}
+	testAppend(scsiCon, deviceSpaprVSCSIString, t)
+
+	scsiCon.IOThread = "iothread0"
+	if err := scsiCon.Valid(); err == nil {
+		t.Errorf("Expected error for spapr-vscsi with IOThread")
+	}
+}
+
+func TestAppendSpaprVTY(t *testing.T) {
+	cdev := CharDevice{
+		Driver:   SpaprVTY,
+		Backend:  Stdio,
+		ID:       "char0",
+		DeviceID: "vty0",
+	}
+	testAppend(cdev, deviceSpaprVTYString, t)
+}
@@ -17,17 +17,92 @@ type SpiceDevice struct {
 	HostAddress      string `yaml:"host-address"`
 	TLSPort          string `yaml:"tls-port"`
 	DisableTicketing bool   `yaml:"disable-ticketing"`
-	// FIXME: implement the rest of -spice
+	// TLSCreds is the ID of a server TLSCredsObject, spice does not
+	// use tls-creds objects so its Dir is passed as x509-dir
+	TLSCreds string `yaml:"tls-creds"`
+
+	// UnixSocket is the path of a unix socket spice listens on instead
+	// of Port or TLSPort, e.g. for local clients using GL
+	UnixSocket string `yaml:"unix-socket"`
+
+	// PasswordSecret is the ID of the SecretObject holding the client
+	// password, requires qemu 7.0
+	PasswordSecret string `yaml:"password-secret"`
+
+	// ImageCompression is the lossless image compression, one of
+	// auto_glz, auto_lz, quic, glz, lz or off
+	ImageCompression string `yaml:"image-compression"`
+
+	// StreamingVideo is the video stream detection, one of off, all or
+	// filter
+	StreamingVideo string `yaml:"streaming-video"`
+
+	// AgentMouse uses the vdagent mouse in client mode, on|off
+	AgentMouse string `yaml:"agent-mouse"`
+
+	// SeamlessMigration keeps the client connected across a live
+	// migration, on|off
+	SeamlessMigration string `yaml:"seamless-migration"`
+
+	// GL enables the OpenGL display, only supported with UnixSocket
+	GL bool `yaml:"gl"`
+
+	// RenderNode is the DRM render node used by GL, e.g.
+	// /dev/dri/renderD128
+	RenderNode string `yaml:"rendernode"`
 }
 
 // Valid returns true if there is a valid structure defined for SpiceDevice
 func (dev SpiceDevice) Valid() error {
-	if dev.Port == "" && dev.TLSPort == "" {
-		return fmt.Errorf("SpiceDevice 'Port' or 'TLSPort' value is required")
+	if dev.UnixSocket != "" {
+		if dev.Port != "" || dev.TLSPort != "" || dev.HostAddress != "" || dev.TLSCreds != "" {
+			return fmt.Errorf("SpiceDevice with 'UnixSocket' does not support 'Port', 'TLSPort', 'HostAddress' or 'TLSCreds'")
+		}
+	} else {
+		if dev.Port == "" && dev.TLSPort == "" {
+			return fmt.Errorf("SpiceDevice 'Port', 'TLSPort' or 'UnixSocket' value is required")
+		}
+
+		if dev.Port != "" && dev.TLSPort != "" {
+			return fmt.Errorf("SpiceDevice has 'Port' and 'TLSPort' set, only one allowed")
+		}
+	}
+
+	if dev.TLSCreds != "" && dev.TLSPort == "" {
+		return fmt.Errorf("SpiceDevice with 'TLSCreds' requires 'TLSPort'")
+	}
+
+	if dev.PasswordSecret != "" && dev.DisableTicketing {
+		return fmt.Errorf("SpiceDevice has 'PasswordSecret' and 'DisableTicketing' set, only one allowed")
+	}
+
+	switch dev.ImageCompression {
+	case "", "auto_glz", "auto_lz", "quic", "glz", "lz", "off":
+	default:
+		return fmt.Errorf("Invalid SpiceDevice ImageCompression value: '%s', must be one of 'auto_glz', 'auto_lz', 'quic', 'glz', 'lz' or 'off'", dev.ImageCompression)
+	}
+
+	switch dev.StreamingVideo {
+	case "", "off", "all", "filter":
+	default:
+		return fmt.Errorf("Invalid SpiceDevice StreamingVideo value: '%s', must be one of 'off', 'all' or 'filter'", dev.StreamingVideo)
+	}
+
+	if _, err := getConfigOnOff("SpiceDevice AgentMouse", "agent-mouse", dev.AgentMouse); err != nil {
+		return err
+	}
+
+	if _, err := getConfigOnOff("SpiceDevice SeamlessMigration", "seamless-migration", dev.SeamlessMigration); err != nil {
+		return err
+	}
+
+	// qemu only supports spice GL for local clients
+	if dev.GL && dev.UnixSocket == "" {
+		return fmt.Errorf("SpiceDevice with 'GL' requires 'UnixSocket'")
 	}
 
-	if dev.Port != "" && dev.TLSPort != "" {
-		return fmt.Errorf("SpiceDevice has 'Port' and 'TLSPort' set, only one allowed")
+	if dev.RenderNode != "" && !dev.GL {
+		return fmt.Errorf("SpiceDevice with 'RenderNode' requires 'GL'")
 	}
 
 	return nil
@@ -40,22 +115,54 @@ func (dev SpiceDevice) QemuParams(config *Config) []string {
 	var virtportParams []string
 	var chardevParams []string
 
-	if dev.Port != "" {
-		deviceParams = append(deviceParams, fmt.Sprintf("port=%s", dev.Port))
-	}
-	if dev.TLSPort != "" {
-		deviceParams = append(deviceParams, fmt.Sprintf("tls-port=%s", dev.TLSPort))
+	if dev.UnixSocket != "" {
+		deviceParams = append(deviceParams, "unix=on")
+		deviceParams = append(deviceParams, fmt.Sprintf("addr=%s", dev.UnixSocket))
+	} else {
+		if dev.Port != "" {
+			deviceParams = append(deviceParams, fmt.Sprintf("port=%s", dev.Port))
+		}
+		if dev.TLSPort != "" {
+			deviceParams = append(deviceParams, fmt.Sprintf("tls-port=%s", dev.TLSPort))
+		}
+
+		addr := "127.0.0.1"
+		if dev.HostAddress != "" {
+			addr = dev.HostAddress
+		}
+		deviceParams = append(deviceParams, fmt.Sprintf("addr=%s", addr))
 	}
 
-	addr := "127.0.0.1"
-	if dev.HostAddress != "" {
-		addr = dev.HostAddress
+	if dev.TLSCreds != "" {
+		if creds, ok := config.findTLSCreds(dev.TLSCreds); ok {
+			deviceParams = append(deviceParams, fmt.Sprintf("x509-dir=%s", creds.Dir))
+		}
 	}
-	deviceParams = append(deviceParams, fmt.Sprintf("addr=%s", addr))
 
 	if dev.DisableTicketing {
 		deviceParams = append(deviceParams, fmt.Sprintf("disable-ticketing=on"))
 	}
+	if dev.PasswordSecret != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("password-secret=%s", dev.PasswordSecret))
+	}
+	if dev.ImageCompression != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("image-compression=%s", dev.ImageCompression))
+	}
+	if dev.StreamingVideo != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("streaming-video=%s", dev.StreamingVideo))
+	}
+	if dev.AgentMouse != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("agent-mouse=%s", dev.AgentMouse))
+	}
+	if dev.SeamlessMigration != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("seamless-migration=%s", dev.SeamlessMigration))
+	}
+	if dev.GL {
+		deviceParams = append(deviceParams, "gl=on")
+	}
+	if dev.RenderNode != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("rendernode=%s", dev.RenderNode))
+	}
 
 	// add the virtserialport to enable copy-paste if guest is configured
 	//  -device virtserialport,chardev=spicechannel0,name=com.redhat.spice.0
@@ -79,3 +186,24 @@ func (dev SpiceDevice) QemuParams(config *Config) []string {
 
 	return qemuParams
 }
+
+// validateSpice checks the SpiceDevice PasswordSecret is defined in
+// Secrets and supported by the qemu version.
+func (config *Config) validateSpice() error {
+	id := config.SpiceDevice.PasswordSecret
+	if id == "" {
+		return nil
+	}
+
+	if config.Version.Before(7, 0) {
+		return fmt.Errorf("SpiceDevice PasswordSecret requires qemu 7.0, found %s", config.Version)
+	}
+
+	for _, secret := range config.Secrets {
+		if secret.ID == id {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("SpiceDevice references unknown PasswordSecret '%s'", id)
+}
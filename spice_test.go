@@ -8,6 +8,8 @@ func TestSpiceDevice(t *testing.T) {
 		out string
 	}{
 		{SpiceDevice{Port: "5901"}, "-spice port=5901,addr=127.0.0.1 -device virtio-serial-pci -device virtserialport,chardev=spicechannel0,name=com.redhat.spice.0 -chardev spicevmc,id=spicechannel0,name=vdagent"},
+		{SpiceDevice{Port: "5903", PasswordSecret: "spicepw", ImageCompression: "auto_glz", StreamingVideo: "filter", AgentMouse: "on", SeamlessMigration: "on"}, "-spice port=5903,addr=127.0.0.1,password-secret=spicepw,image-compression=auto_glz,streaming-video=filter,agent-mouse=on,seamless-migration=on -device virtio-serial-pci -device virtserialport,chardev=spicechannel0,name=com.redhat.spice.0 -chardev spicevmc,id=spicechannel0,name=vdagent"},
+		{SpiceDevice{UnixSocket: "/run/vm0/spice.sock", DisableTicketing: true, GL: true, RenderNode: "/dev/dri/renderD128"}, "-spice unix=on,addr=/run/vm0/spice.sock,disable-ticketing=on,gl=on,rendernode=/dev/dri/renderD128 -device virtio-serial-pci -device virtserialport,chardev=spicechannel0,name=com.redhat.spice.0 -chardev spicevmc,id=spicechannel0,name=vdagent"},
 		{SpiceDevice{TLSPort: "5902", HostAddress: "0.0.0.0", DisableTicketing: true}, "-spice tls-port=5902,addr=0.0.0.0,disable-ticketing=on -device virtio-serial-pci -device virtserialport,chardev=spicechannel0,name=com.redhat.spice.0 -chardev spicevmc,id=spicechannel0,name=vdagent"},
 	}
 
@@ -29,4 +31,42 @@ func TestSpiceDeviceInvalid(t *testing.T) {
 	if err := dev.Valid(); err == nil {
 		t.Fatalf("A SpiceDevice with both Port and TLSPort fields is NOT valid")
 	}
+
+	dev.TLSPort = ""
+	dev.TLSCreds = "tls0"
+
+	if err := dev.Valid(); err == nil {
+		t.Fatalf("A SpiceDevice with TLSCreds and without TLSPort is NOT valid")
+	}
+}
+
+func TestSpiceDeviceInvalidOptions(t *testing.T) {
+	devices := []SpiceDevice{
+		{UnixSocket: "/run/spice.sock", Port: "5901"},
+		{Port: "5901", PasswordSecret: "pw", DisableTicketing: true},
+		{Port: "5901", ImageCompression: "jpeg"},
+		{Port: "5901", StreamingVideo: "some"},
+		{Port: "5901", AgentMouse: "yes"},
+		{Port: "5901", SeamlessMigration: "true"},
+		{Port: "5901", GL: true},
+		{UnixSocket: "/run/spice.sock", RenderNode: "/dev/dri/renderD128"},
+	}
+	for _, dev := range devices {
+		if err := dev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid SpiceDevice %+v", dev)
+		}
+	}
+
+	c := &Config{SpiceDevice: SpiceDevice{Port: "5901", PasswordSecret: "pw"}}
+	if err := c.validateSpice(); err == nil {
+		t.Errorf("Expected error for unknown PasswordSecret")
+	}
+	c.Secrets = []SecretObject{{ID: "pw", Data: "secret"}}
+	if err := c.validateSpice(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	c.Version = Version{Major: 6, Minor: 2}
+	if err := c.validateSpice(); err == nil {
+		t.Errorf("Expected error for PasswordSecret with qemu 6.2")
+	}
 }
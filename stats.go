@@ -0,0 +1,218 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultStatsInterval is the sampling interval of a StatsCollector when
+// Interval is not set.
+const DefaultStatsInterval = 10 * time.Second
+
+// ProcessStats are the resource usage counters of the qemu process.
+type ProcessStats struct {
+	// UserTime is the cpu time spent in user mode, including the guest
+	UserTime time.Duration
+
+	// SystemTime is the cpu time spent in kernel mode
+	SystemTime time.Duration
+
+	// RSS is the resident memory in bytes
+	RSS uint64
+
+	// Threads is the number of threads, vcpus included
+	Threads int
+}
+
+// VMStats is a sample of the resource usage of a VM.
+type VMStats struct {
+	// Time is when the sample was taken
+	Time time.Time
+
+	// Pid is the qemu process ID
+	Pid int
+
+	// Process are the qemu process counters
+	Process ProcessStats
+
+	// CPUPercent is the cpu usage since the previous sample, 100 per
+	// fully used host cpu. It is 0 for the first sample.
+	CPUPercent float64
+
+	// Blocks are the block device statistics, nil without QMP
+	Blocks []BlockStats
+
+	// RxFilters are the guest NIC receive filters, nil without QMP
+	RxFilters []RxFilterInfo
+}
+
+// Metric is a VMStats value in a form that maps directly to a Prometheus
+// metric, e.g. for a prometheus.Collector wrapping a StatsCollector.
+type Metric struct {
+	// Name is the metric name, e.g. qemu_memory_rss_bytes
+	Name string
+
+	// Labels identify the device the metric is about, if any
+	Labels map[string]string
+
+	// Value is the metric value
+	Value float64
+
+	// Counter is set for the metrics that only increase
+	Counter bool
+}
+
+// Metrics returns the VMStats as a list of metrics.
+func (s VMStats) Metrics() []Metric {
+	metrics := []Metric{
+		{Name: "qemu_cpu_seconds_total", Labels: map[string]string{"mode": "user"}, Value: s.Process.UserTime.Seconds(), Counter: true},
+		{Name: "qemu_cpu_seconds_total", Labels: map[string]string{"mode": "system"}, Value: s.Process.SystemTime.Seconds(), Counter: true},
+		{Name: "qemu_memory_rss_bytes", Value: float64(s.Process.RSS)},
+		{Name: "qemu_threads", Value: float64(s.Process.Threads)},
+	}
+
+	for _, block := range s.Blocks {
+		device := block.Device
+		if device == "" {
+			device = block.QDev
+		}
+		labels := map[string]string{"device": device}
+		metrics = append(metrics,
+			Metric{Name: "qemu_block_read_bytes_total", Labels: labels, Value: float64(block.Stats.ReadBytes), Counter: true},
+			Metric{Name: "qemu_block_write_bytes_total", Labels: labels, Value: float64(block.Stats.WriteBytes), Counter: true},
+			Metric{Name: "qemu_block_read_operations_total", Labels: labels, Value: float64(block.Stats.ReadOperations), Counter: true},
+			Metric{Name: "qemu_block_write_operations_total", Labels: labels, Value: float64(block.Stats.WriteOperations), Counter: true},
+			Metric{Name: "qemu_block_flush_operations_total", Labels: labels, Value: float64(block.Stats.FlushOperations), Counter: true},
+		)
+	}
+
+	for _, filter := range s.RxFilters {
+		promiscuous := 0.0
+		if filter.Promiscuous {
+			promiscuous = 1
+		}
+		metrics = append(metrics, Metric{
+			Name:   "qemu_nic_promiscuous",
+			Labels: map[string]string{"nic": filter.Name, "mac": filter.MainMAC},
+			Value:  promiscuous,
+		})
+	}
+
+	return metrics
+}
+
+// StatsCollector samples the resource usage of a running VM from /proc and,
+// when QMP is set, from query-blockstats and query-rx-filter.
+type StatsCollector struct {
+	// Pid is the qemu process ID, see Config.RunningPid
+	Pid int
+
+	// QMP is the connection used for the device statistics, it may be nil
+	QMP *QMP
+
+	// Interval is the sampling interval, DefaultStatsInterval when 0
+	Interval time.Duration
+
+	previous *VMStats
+}
+
+// NewStatsCollector returns a StatsCollector for the qemu process pid,
+// querying the device statistics through q if it is not nil.
+func NewStatsCollector(pid int, q *QMP) *StatsCollector {
+	return &StatsCollector{
+		Pid: pid,
+		QMP: q,
+	}
+}
+
+// Sample returns the current VMStats.
+func (c *StatsCollector) Sample(ctx context.Context) (VMStats, error) {
+	stats := VMStats{
+		Time: time.Now(),
+		Pid:  c.Pid,
+	}
+
+	var err error
+	stats.Process, err = readProcessStats(c.Pid)
+	if err != nil {
+		return stats, fmt.Errorf("Failed to read the statistics of process %d: %v", c.Pid, err)
+	}
+
+	if c.QMP != nil {
+		if stats.Blocks, err = c.QMP.ExecuteQueryBlockstats(ctx); err != nil {
+			return stats, fmt.Errorf("Failed to query the block statistics: %v", err)
+		}
+		if stats.RxFilters, err = c.QMP.ExecuteQueryRxFilter(ctx, ""); err != nil {
+			return stats, fmt.Errorf("Failed to query the rx filters: %v", err)
+		}
+	}
+
+	if prev := c.previous; prev != nil {
+		elapsed := stats.Time.Sub(prev.Time)
+		used := stats.Process.UserTime + stats.Process.SystemTime - prev.Process.UserTime - prev.Process.SystemTime
+		if elapsed > 0 {
+			stats.CPUPercent = 100 * used.Seconds() / elapsed.Seconds()
+		}
+	}
+	c.previous = &stats
+
+	return stats, nil
+}
+
+// Run sends a VMStats sample to statsCh every Interval until ctx is done or
+// a sample fails, e.g. because qemu exited. It closes statsCh when it
+// returns.
+func (c *StatsCollector) Run(ctx context.Context, statsCh chan<- VMStats) error {
+	defer close(statsCh)
+
+	interval := c.Interval
+	if interval == 0 {
+		interval = DefaultStatsInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := c.Sample(ctx)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case statsCh <- stats:
+		case <-ctx.Done():
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
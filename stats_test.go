@@ -0,0 +1,92 @@
+package qcli
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestStatsCollector(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process statistics are read from /proc")
+	}
+
+	c := NewStatsCollector(os.Getpid(), nil)
+	c.Interval = 10 * time.Millisecond
+
+	statsCh := make(chan VMStats)
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		errCh <- c.Run(ctx, statsCh)
+	}()
+
+	first := <-statsCh
+	second := <-statsCh
+	cancel()
+	for range statsCh {
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if first.Pid != os.Getpid() || first.Process.RSS == 0 || first.Process.Threads == 0 {
+		t.Errorf("Unexpected process statistics %+v", first)
+	}
+	if first.CPUPercent != 0 || second.CPUPercent < 0 || !second.Time.After(first.Time) {
+		t.Errorf("Unexpected samples %+v and %+v", first, second)
+	}
+	if first.Blocks != nil || first.RxFilters != nil {
+		t.Errorf("Expected no device statistics without QMP")
+	}
+
+	c = NewStatsCollector(-1, nil)
+	if err := c.Run(context.Background(), make(chan VMStats)); err == nil {
+		t.Errorf("Expected error for a missing process")
+	}
+}
+
+func TestVMStatsMetrics(t *testing.T) {
+	stats := VMStats{
+		Process: ProcessStats{
+			UserTime:   3 * time.Second,
+			SystemTime: time.Second,
+			RSS:        1 << 30,
+			Threads:    4,
+		},
+		Blocks: []BlockStats{
+			{Device: "drive0", Stats: BlockDeviceStats{ReadBytes: 4096, WriteBytes: 512}},
+		},
+		RxFilters: []RxFilterInfo{
+			{Name: "net0", MainMAC: "52:54:00:12:34:56", Promiscuous: true},
+		},
+	}
+
+	values := make(map[string]float64)
+	for _, m := range stats.Metrics() {
+		key := m.Name
+		for _, label := range []string{"mode", "device", "nic"} {
+			if v, ok := m.Labels[label]; ok {
+				key += "{" + v + "}"
+			}
+		}
+		values[key] = m.Value
+	}
+
+	expected := map[string]float64{
+		"qemu_cpu_seconds_total{user}":         3,
+		"qemu_cpu_seconds_total{system}":       1,
+		"qemu_memory_rss_bytes":                1 << 30,
+		"qemu_threads":                         4,
+		"qemu_block_read_bytes_total{drive0}":  4096,
+		"qemu_block_write_bytes_total{drive0}": 512,
+		"qemu_nic_promiscuous{net0}":           1,
+	}
+	for key, value := range expected {
+		if values[key] != value {
+			t.Errorf("Expected %s %v, found %v", key, value, values[key])
+		}
+	}
+}
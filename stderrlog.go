@@ -0,0 +1,112 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// stderrLogger is the qemu stderr writer of LaunchCustomQemu, it logs each
+// line as it is written and keeps the last LaunchStderrTailSize bytes of the
+// output for the caller.
+type stderrLogger struct {
+	logger  QMPLog
+	prefix  string
+	mu      sync.Mutex
+	output  bytes.Buffer
+	partial []byte
+}
+
+// newStderrLogger returns a stderrLogger prefixing the lines with the guest
+// name given in the qemu params, if any.
+func newStderrLogger(logger QMPLog, params []string) *stderrLogger {
+	prefix := "qemu"
+	if name := paramsGuestName(params); name != "" {
+		prefix = "qemu " + name
+	}
+
+	return &stderrLogger{
+		logger: logger,
+		prefix: prefix,
+	}
+}
+
+// paramsGuestName returns the guest name of the -name parameter in params.
+func paramsGuestName(params []string) string {
+	for i := 0; i < len(params)-1; i++ {
+		if params[i] != "-name" {
+			continue
+		}
+		name, _, _ := strings.Cut(params[i+1], ",")
+		return strings.TrimPrefix(name, "guest=")
+	}
+	return ""
+}
+
+func (s *stderrLogger) Write(data []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.output.Write(data)
+	if trim := s.output.Len() - LaunchStderrTailSize; trim > 0 {
+		s.output.Next(trim)
+	}
+	s.partial = append(s.partial, data...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		s.logLine(s.partial[:i])
+		s.partial = s.partial[i+1:]
+	}
+
+	return len(data), nil
+}
+
+// Flush logs the last line when qemu exits without ending it.
+func (s *stderrLogger) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.partial) > 0 {
+		s.logLine(s.partial)
+		s.partial = nil
+	}
+}
+
+func (s *stderrLogger) logLine(line []byte) {
+	s.logger.Warningf("%s: %s", s.prefix, strings.TrimRight(string(line), "\r"))
+}
+
+// String returns the tail of the stderr output.
+func (s *stderrLogger) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.output.String()
+}
@@ -0,0 +1,62 @@
+package qcli
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type recordingLogger struct {
+	qmpTestLogger
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (l *recordingLogger) Warningf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, fmt.Sprintf(format, v...))
+}
+
+func TestStderrLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	s := newStderrLogger(logger, []string{"-name", "guest=vm1,debug-threads=on"})
+
+	s.Write([]byte("first li"))
+	if len(logger.warnings) != 0 {
+		t.Errorf("Expected partial line not to be logged, found %v", logger.warnings)
+	}
+	s.Write([]byte("ne\r\nsecond line\nlast"))
+	s.Flush()
+
+	expected := []string{"qemu vm1: first line", "qemu vm1: second line", "qemu vm1: last"}
+	if !reflect.DeepEqual(expected, logger.warnings) {
+		t.Errorf("Expected %v, found %v", expected, logger.warnings)
+	}
+	if s.String() != "first line\r\nsecond line\nlast" {
+		t.Errorf("Unexpected stderr output %q", s.String())
+	}
+
+	if name := paramsGuestName([]string{"-m", "1G"}); name != "" {
+		t.Errorf("Expected no guest name, found %s", name)
+	}
+}
+
+func TestLaunchCustomQemuStderr(t *testing.T) {
+	logger := &recordingLogger{}
+	params := []string{"-c", "echo oops >&2; exit 1", "-name", "vm1"}
+
+	errStr, err := LaunchCustomQemu(context.Background(), "/bin/sh", params, nil, nil, logger)
+	if err == nil {
+		t.Fatalf("Expected error for failing command")
+	}
+	if errStr != "oops\n" {
+		t.Errorf("Expected stderr %q, found %q", "oops\n", errStr)
+	}
+	expected := []string{"qemu vm1: oops"}
+	if !reflect.DeepEqual(expected, logger.warnings) {
+		t.Errorf("Expected %v, found %v", expected, logger.warnings)
+	}
+}
@@ -0,0 +1,448 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RestartPolicy tells a VMSupervisor when to launch qemu again once it
+// has exited.
+type RestartPolicy string
+
+const (
+	// RestartNever never restarts qemu.
+	RestartNever RestartPolicy = "never"
+
+	// RestartOnFailure restarts qemu when it crashed, see VMExit.Crashed.
+	RestartOnFailure RestartPolicy = "on-failure"
+
+	// RestartAlways restarts qemu whatever the reason it exited.
+	RestartAlways RestartPolicy = "always"
+)
+
+const (
+	// DefaultRestartBackoff is the delay before the first restart
+	DefaultRestartBackoff = time.Second
+
+	// DefaultMaxRestartBackoff is the longest delay between two restarts
+	DefaultMaxRestartBackoff = time.Minute
+)
+
+// qmpGracePeriod is how long the QMP events still in flight are read
+// once qemu has exited
+var qmpGracePeriod = time.Second
+
+// VMExit records why a qemu instance run by a VMSupervisor exited.
+type VMExit struct {
+	// Err is the error returned by LaunchQemu, nil if qemu exited cleanly
+	Err error
+
+	// Stderr is the qemu error output when Err is set
+	Stderr string
+
+	// ShutdownReason is the reason of the QMP SHUTDOWN event, e.g.,
+	// guest-shutdown, host-qmp-quit or host-signal. It is empty if no
+	// SHUTDOWN event was received.
+	ShutdownReason string
+
+	// Guest is set when the shutdown was requested by the guest
+	Guest bool
+
+	// Panicked is set when a GUEST_PANICKED event was received
+	Panicked bool
+
+	// Time is when qemu exited
+	Time time.Time
+}
+
+// Crashed returns true if qemu failed or the guest panicked, as opposed to
+// a shutdown requested by the guest or the host.
+func (e VMExit) Crashed() bool {
+	return e.Err != nil || e.Panicked || e.ShutdownReason == "guest-panic"
+}
+
+// VMSupervisor launches qemu with LaunchQemu and launches it again when it
+// exits according to its RestartPolicy. When the Config has a QMP socket
+// the supervisor connects to it to track the run state and the shutdown
+// reason of the guest.
+type VMSupervisor struct {
+	// Config is the configuration of the supervised qemu instance, it is
+	// copied for each launch
+	Config *Config
+
+	// Policy is the restart policy
+	Policy RestartPolicy
+
+	// MaxRestarts is the maximum number of restarts, 0 means no limit
+	MaxRestarts int
+
+	// Backoff is the delay before the first restart, doubled for each
+	// consecutive crash up to MaxBackoff. It defaults to
+	// DefaultRestartBackoff.
+	Backoff time.Duration
+
+	// MaxBackoff is the longest delay between two restarts. It defaults
+	// to DefaultMaxRestartBackoff.
+	MaxBackoff time.Duration
+
+	// StateCh receives each run state transition if set. It must be
+	// drained by the caller and is closed when Run returns.
+	StateCh chan<- RunState
+
+	// Logger is used to log the supervisor and QMP activity
+	Logger QMPLog
+
+	mu       sync.Mutex
+	state    RunState
+	exits    []VMExit
+	cancel   context.CancelFunc
+	stopped  bool
+	restarts int
+
+	// swtpm and virtiofsds are the helpers started for the Config, swtpm
+	// exits with qemu and virtiofsd once qemu disconnects so they are
+	// started again for each restart
+	swtpm      *SwTPM
+	virtiofsds []*Virtiofsd
+}
+
+// NewVMSupervisor returns a supervisor for config with the restart policy
+// policy.
+func NewVMSupervisor(config *Config, policy RestartPolicy, logger QMPLog) *VMSupervisor {
+	return &VMSupervisor{
+		Config: config,
+		Policy: policy,
+		Logger: logger,
+		state:  RunStatePreLaunch,
+	}
+}
+
+// Valid returns an error if the supervisor is not usable.
+func (s *VMSupervisor) Valid() error {
+	if s.Config == nil {
+		return fmt.Errorf("VMSupervisor has no Config")
+	}
+	switch s.Policy {
+	case RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("Invalid RestartPolicy value: '%s', must be one of: %s, %s, %s",
+			s.Policy, RestartNever, RestartOnFailure, RestartAlways)
+	}
+	if s.MaxRestarts < 0 {
+		return fmt.Errorf("Invalid VMSupervisor MaxRestarts %d, must not be negative", s.MaxRestarts)
+	}
+	return nil
+}
+
+// State returns the current run state of the supervised instance.
+func (s *VMSupervisor) State() RunState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Exits returns the exit records of every launch, oldest first.
+func (s *VMSupervisor) Exits() []VMExit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]VMExit(nil), s.exits...)
+}
+
+// Restarts returns the number of times qemu was restarted.
+func (s *VMSupervisor) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+// Stop kills the running qemu instance, if any, and makes Run return
+// without restarting it.
+func (s *VMSupervisor) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+func (s *VMSupervisor) setState(state RunState) {
+	s.mu.Lock()
+	changed := s.state != state
+	s.state = state
+	s.mu.Unlock()
+
+	if changed && s.StateCh != nil {
+		s.StateCh <- state
+	}
+}
+
+// Run launches qemu and blocks until it exited and is not to be restarted,
+// Stop is called or ctx is done. It returns the error of the last launch.
+func (s *VMSupervisor) Run(ctx context.Context) error {
+	if s.StateCh != nil {
+		defer close(s.StateCh)
+	}
+	if err := s.Valid(); err != nil {
+		return err
+	}
+	if s.Logger == nil {
+		s.Logger = qmpNullLogger{}
+	}
+	// the first launch takes over the helpers started for the Config,
+	// they are only left to stop if it never happens
+	s.swtpm, s.virtiofsds = s.Config.swtpm, s.Config.virtiofsds
+	defer s.Config.Cleanup()
+
+	failures := 0
+	for {
+		exit := s.launch(ctx)
+
+		s.mu.Lock()
+		s.exits = append(s.exits, exit)
+		stopped := s.stopped
+		restarts := s.restarts
+		s.mu.Unlock()
+
+		if exit.Panicked {
+			s.setState(RunStateGuestPanicked)
+		} else {
+			s.setState(RunStateShutdown)
+		}
+
+		if exit.Crashed() {
+			failures++
+		} else {
+			failures = 0
+		}
+
+		if stopped || ctx.Err() != nil || !s.shouldRestart(exit, restarts) {
+			return exit.Err
+		}
+
+		delay := s.backoff(failures)
+		s.Logger.Infof("qemu exited (reason: %q, error: %v), restarting in %s", exit.ShutdownReason, exit.Err, delay)
+		select {
+		case <-ctx.Done():
+			return exit.Err
+		case <-time.After(delay):
+		}
+
+		s.mu.Lock()
+		s.restarts++
+		s.mu.Unlock()
+	}
+}
+
+func (s *VMSupervisor) shouldRestart(exit VMExit, restarts int) bool {
+	if s.MaxRestarts > 0 && restarts >= s.MaxRestarts {
+		return false
+	}
+	switch s.Policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return exit.Crashed()
+	}
+	return false
+}
+
+func (s *VMSupervisor) backoff(failures int) time.Duration {
+	delay := s.Backoff
+	if delay <= 0 {
+		delay = DefaultRestartBackoff
+	}
+	maxDelay := s.MaxBackoff
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxRestartBackoff
+	}
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// launchConfig returns a copy of the supervised Config without the state
+// accumulated by a previous ConfigureParams, with its own helpers
+func (s *VMSupervisor) launchConfig(ctx context.Context) (*Config, error) {
+	config := s.Config.unconfigured()
+	config.Ctx = ctx
+
+	// the helpers started for the Config serve the first launch
+	if s.Config.swtpm != nil || len(s.Config.virtiofsds) > 0 {
+		config.swtpm, config.virtiofsds = s.Config.swtpm, s.Config.virtiofsds
+		s.Config.swtpm, s.Config.virtiofsds = nil, nil
+		return config, nil
+	}
+
+	if s.swtpm != nil {
+		swtpm, err := startSwTPM(ctx, s.swtpm.StateDir)
+		if err != nil {
+			return nil, err
+		}
+		config.swtpm = swtpm
+	}
+	for _, virtiofsd := range s.virtiofsds {
+		restarted, err := startVirtiofsd(ctx, virtiofsd.opts, virtiofsd.SocketPath)
+		if err != nil {
+			config.Cleanup()
+			return nil, err
+		}
+		config.virtiofsds = append(config.virtiofsds, restarted)
+	}
+
+	return config, nil
+}
+
+// launch runs qemu once and returns why it exited
+func (s *VMSupervisor) launch(ctx context.Context) VMExit {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return VMExit{Err: fmt.Errorf("VMSupervisor is stopped"), Time: time.Now()}
+	}
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.setState(RunStatePreLaunch)
+
+	config, err := s.launchConfig(runCtx)
+	if err != nil {
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+		return VMExit{Err: err, Time: time.Now()}
+	}
+
+	var exit VMExit
+	exitedCh := make(chan struct{})
+	monitorDone := make(chan struct{})
+	go func() {
+		s.monitor(runCtx, &exit, exitedCh)
+		close(monitorDone)
+	}()
+
+	stderr, err := LaunchQemu(config, s.Logger)
+	close(exitedCh)
+	<-monitorDone
+
+	s.mu.Lock()
+	s.cancel = nil
+	s.mu.Unlock()
+
+	exit.Err = err
+	exit.Stderr = stderr
+	exit.Time = time.Now()
+	return exit
+}
+
+// monitor follows the QMP events of the running instance until exitedCh
+// is closed, recording the shutdown reason in exit
+func (s *VMSupervisor) monitor(ctx context.Context, exit *VMExit, exitedCh <-chan struct{}) {
+	// only a unix server socket can be dialed by its Name
+	socket := ""
+	for _, qmp := range s.Config.QMPSockets {
+		if qmp.Type == Unix && qmp.Server {
+			socket = qmp.Name
+			break
+		}
+	}
+	if socket == "" {
+		s.setState(RunStateRunning)
+		return
+	}
+
+	var q *QMP
+	var eventCh chan QMPEvent
+	for q == nil {
+		eventCh = make(chan QMPEvent)
+		cfg := QMPConfig{
+			EventCh: eventCh,
+			Logger:  s.Logger,
+		}
+		disconnectedCh := make(chan struct{})
+		var err error
+		q, _, err = QMPStart(ctx, socket, cfg, disconnectedCh)
+		if err == nil {
+			break
+		}
+		select {
+		case <-exitedCh:
+			return
+		case <-time.After(readinessPollInterval):
+		}
+	}
+
+	if err := q.ExecuteQMPCapabilities(ctx); err == nil {
+		if status, err := q.ExecuteQueryStatus(ctx); err == nil {
+			s.setState(ToRunState(status.Status))
+		}
+	}
+
+	var grace <-chan time.Time
+	for {
+		select {
+		case ev, ok := <-eventCh:
+			if !ok {
+				return
+			}
+			s.handleEvent(ev, exit)
+		case <-exitedCh:
+			// qemu is gone, read the events it sent before closing
+			// the socket
+			exitedCh = nil
+			grace = time.After(qmpGracePeriod)
+		case <-grace:
+			q.Shutdown()
+			grace = nil
+		}
+	}
+}
+
+func (s *VMSupervisor) handleEvent(ev QMPEvent, exit *VMExit) {
+	switch ev.Name {
+	case "GUEST_PANICKED":
+		exit.Panicked = true
+	case "SHUTDOWN":
+		exit.ShutdownReason, _ = ev.Data["reason"].(string)
+		exit.Guest, _ = ev.Data["guest"].(bool)
+	}
+	state, ok := ev.RunState()
+	// a guest paused on panic stays in the panicked state
+	if ok && !(state == RunStatePaused && s.State() == RunStateGuestPanicked) {
+		s.setState(state)
+	}
+}
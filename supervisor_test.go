@@ -0,0 +1,231 @@
+package qcli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeQemu writes a shell script standing in for the qemu binary
+func fakeQemu(t *testing.T, script string) (string, string) {
+	dir, err := os.MkdirTemp("", "qcli-supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "qemu")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir, path
+}
+
+func TestVMSupervisorOnFailure(t *testing.T) {
+	dir, path := fakeQemu(t, "echo run >> \"$(dirname $0)/runs\"\n"+
+		"[ $(wc -l < \"$(dirname $0)/runs\") -gt 2 ] || { echo crashed >&2; exit 1; }\n")
+
+	config := &Config{Name: "vm1", Path: path}
+	s := NewVMSupervisor(config, RestartOnFailure, nil)
+	s.Backoff = time.Millisecond
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	exits := s.Exits()
+	if len(exits) != 3 || s.Restarts() != 2 {
+		t.Fatalf("Expected 3 launches and 2 restarts, found %d and %d", len(exits), s.Restarts())
+	}
+	for i, exit := range exits[:2] {
+		if !exit.Crashed() || !strings.Contains(exit.Stderr, "crashed") {
+			t.Errorf("Expected launch %d to crash with stderr output, found %+v", i, exit)
+		}
+	}
+	if exits[2].Crashed() {
+		t.Errorf("Expected the last launch to exit cleanly, found %+v", exits[2])
+	}
+	if s.State() != RunStateShutdown {
+		t.Errorf("Expected state %s, found %s", RunStateShutdown, s.State())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "runs")); err != nil {
+		t.Errorf("Expected the fake qemu to run: %v", err)
+	}
+}
+
+func TestVMSupervisorMaxRestarts(t *testing.T) {
+	_, path := fakeQemu(t, "exit 0\n")
+
+	config := &Config{Name: "vm1", Path: path}
+	s := NewVMSupervisor(config, RestartAlways, nil)
+	s.Backoff = time.Millisecond
+	s.MaxRestarts = 2
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(s.Exits()) != 3 {
+		t.Errorf("Expected 3 launches, found %d", len(s.Exits()))
+	}
+}
+
+func TestVMSupervisorStop(t *testing.T) {
+	_, path := fakeQemu(t, "exec sleep 30\n")
+
+	config := &Config{Name: "vm1", Path: path}
+	s := NewVMSupervisor(config, RestartAlways, nil)
+	s.Backoff = time.Millisecond
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.Stop()
+	}()
+
+	start := time.Now()
+	if err := s.Run(context.Background()); err == nil {
+		t.Errorf("Expected error for a killed qemu")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("Expected Stop to kill qemu")
+	}
+	if len(s.Exits()) != 1 {
+		t.Errorf("Expected no restart after Stop, found %d launches", len(s.Exits()))
+	}
+}
+
+func TestVMSupervisorInvalid(t *testing.T) {
+	s := NewVMSupervisor(&Config{}, RestartPolicy("sometimes"), nil)
+	if err := s.Run(context.Background()); err == nil {
+		t.Errorf("Expected error for an invalid restart policy")
+	}
+
+	s = NewVMSupervisor(nil, RestartNever, nil)
+	if err := s.Valid(); err == nil {
+		t.Errorf("Expected error for a supervisor without config")
+	}
+}
+
+// fakeQMPServer accepts one QMP connection on socket, answers the
+// capabilities and status queries, sends the SHUTDOWN event and creates
+// the marker file the fake qemu waits for to exit.
+func fakeQMPServer(t *testing.T, socket, marker string) {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "{\"QMP\": {\"version\": {\"qemu\": {\"micro\": 0, \"minor\": 2, \"major\": 6}, \"package\": \"\"}, \"capabilities\": []}}\n")
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			switch {
+			case strings.Contains(scanner.Text(), "qmp_capabilities"):
+				fmt.Fprintf(conn, "{\"return\": {}}\n")
+			case strings.Contains(scanner.Text(), "query-status"):
+				fmt.Fprintf(conn, "{\"return\": {\"status\": \"running\", \"singlestep\": false, \"running\": true}}\n")
+				fmt.Fprintf(conn, "{\"event\": \"SHUTDOWN\", \"data\": {\"guest\": true, \"reason\": \"guest-shutdown\"}, \"timestamp\": {\"seconds\": 1, \"microseconds\": 0}}\n")
+				os.WriteFile(marker, nil, 0644)
+				return
+			}
+		}
+	}()
+}
+
+func TestVMSupervisorShutdownReason(t *testing.T) {
+	saved := readinessPollInterval
+	readinessPollInterval = time.Millisecond
+	defer func() { readinessPollInterval = saved }()
+
+	dir, path := fakeQemu(t, "while [ ! -e \"$(dirname $0)/shutdown\" ]; do sleep 0.01; done\n")
+	socket := filepath.Join(dir, QMPSocketName)
+	fakeQMPServer(t, socket, filepath.Join(dir, "shutdown"))
+
+	config := &Config{
+		Name: "vm1",
+		Path: path,
+		QMPSockets: []QMPSocket{
+			// the supervisor follows the first unix socket
+			{
+				Type:   QMPTCP,
+				Host:   "127.0.0.1",
+				Port:   4444,
+				Server: true,
+				NoWait: true,
+			},
+			{
+				Type:   Unix,
+				Name:   socket,
+				Server: true,
+				NoWait: true,
+			},
+		},
+	}
+	stateCh := make(chan RunState, 16)
+	s := NewVMSupervisor(config, RestartOnFailure, nil)
+	s.StateCh = stateCh
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Run(ctx); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	exits := s.Exits()
+	if len(exits) != 1 {
+		t.Fatalf("Expected a single launch, found %d", len(exits))
+	}
+	if exits[0].ShutdownReason != "guest-shutdown" || !exits[0].Guest || exits[0].Crashed() {
+		t.Errorf("Expected a guest shutdown, found %+v", exits[0])
+	}
+
+	var states []string
+	for state := range stateCh {
+		states = append(states, state.String())
+	}
+	if strings.Join(states, " ") != "running shutdown" {
+		t.Errorf("Expected states 'running shutdown', found %q", states)
+	}
+}
+
+func TestVMSupervisorRestartsHelpers(t *testing.T) {
+	// count the starts, then create the ctrl socket given as type=unixio,path=<socket>
+	fakeSwTPM(t, "echo start >> \"${6#type=unixio,path=}.starts\"\ntouch \"${6#type=unixio,path=}\"\nexec sleep 60\n")
+
+	config := &Config{Name: "vm1", StateDir: t.TempDir()}
+	socket, err := StartTPMEmulator(config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// swtpm exits with qemu, each launch needs its own
+	_, path := fakeQemu(t, fmt.Sprintf("[ -e %q ] || { echo no TPM socket >&2; exit 1; }\n", socket))
+	config.Path = path
+	s := NewVMSupervisor(config, RestartAlways, nil)
+	s.Backoff = time.Millisecond
+	s.MaxRestarts = 2
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for i, exit := range s.Exits() {
+		if exit.Crashed() {
+			t.Errorf("Expected launch %d to find the TPM socket, found %+v", i, exit)
+		}
+	}
+	starts, _ := os.ReadFile(socket + ".starts")
+	if n := strings.Count(string(starts), "start"); n != 3 {
+		t.Errorf("Expected swtpm to be started for each of the 3 launches, found %d starts", n)
+	}
+	if PathExists(socket) {
+		t.Errorf("Expected the TPM socket to be removed once Run returned")
+	}
+}
@@ -0,0 +1,192 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// SwTPMPath is the swtpm binary used by StartTPMEmulator
+	SwTPMPath = "swtpm"
+
+	// SwTPMSocketTimeout is how long StartTPMEmulator waits for the swtpm
+	// control socket to appear
+	SwTPMSocketTimeout = 10 * time.Second
+)
+
+const (
+	// SwTPMStateDirName is the swtpm state directory under Config.StateDir
+	SwTPMStateDirName = "tpm"
+
+	// SwTPMSocketName is the swtpm control socket name in the state dir
+	SwTPMSocketName = "swtpm.sock"
+
+	// SwTPMLogName is the swtpm log file name in the state dir
+	SwTPMLogName = "swtpm.log"
+)
+
+// SwTPM is a running swtpm emulator process backing a TPMDevice.
+type SwTPM struct {
+	// StateDir is the directory holding the TPM state
+	StateDir string
+
+	// SocketPath is the control socket qemu connects to
+	SocketPath string
+
+	cmd  *exec.Cmd
+	done chan error
+}
+
+// StartTPMEmulator launches a TPM 2.0 swtpm for the VM with its state under
+// Config.StateDir, waits for its control socket and points Config.TPM at
+// it. The emulator is stopped by Config.Cleanup, i.e. when LaunchQemu
+// returns, a VMSupervisor starts it again for each restart. The socket path
+// is returned.
+func StartTPMEmulator(config *Config) (string, error) {
+	if config.StateDir == "" {
+		return "", fmt.Errorf("Config.StateDir is required to start the TPM emulator")
+	}
+	if config.swtpm != nil {
+		return "", fmt.Errorf("TPM emulator already started with socket %s", config.swtpm.SocketPath)
+	}
+
+	ctx := config.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	stateDir := filepath.Join(config.StateDir, SwTPMStateDirName)
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return "", fmt.Errorf("Failed to create TPM state dir %s: %s", stateDir, err)
+	}
+
+	swtpm, err := startSwTPM(ctx, stateDir)
+	if err != nil {
+		return "", err
+	}
+
+	config.swtpm = swtpm
+	config.TPM.Type = TPMEmulatorDevice
+	config.TPM.Path = swtpm.SocketPath
+	if config.TPM.ID == "" {
+		config.TPM.ID = "tpm0"
+	}
+	if config.TPM.Driver == "" {
+		config.TPM.Driver = TPMTISDevice
+	}
+
+	return swtpm.SocketPath, nil
+}
+
+// startSwTPM launches swtpm with its state and control socket in stateDir
+// and waits for the socket.
+func startSwTPM(ctx context.Context, stateDir string) (*SwTPM, error) {
+	swtpm := &SwTPM{
+		StateDir:   stateDir,
+		SocketPath: filepath.Join(stateDir, SwTPMSocketName),
+		done:       make(chan error, 1),
+	}
+
+	// a stale socket would be mistaken for the new one
+	if err := os.Remove(swtpm.SocketPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Failed to remove stale TPM socket %s: %s", swtpm.SocketPath, err)
+	}
+
+	args := []string{
+		"socket", "--tpm2",
+		"--tpmstate", fmt.Sprintf("dir=%s", stateDir),
+		"--ctrl", fmt.Sprintf("type=unixio,path=%s", swtpm.SocketPath),
+		"--log", fmt.Sprintf("file=%s", filepath.Join(stateDir, SwTPMLogName)),
+		"--terminate",
+	}
+
+	/* #nosec */
+	swtpm.cmd = exec.CommandContext(ctx, SwTPMPath, args...)
+	if err := swtpm.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Failed to start %s: %s", SwTPMPath, err)
+	}
+	go func() {
+		swtpm.done <- swtpm.cmd.Wait()
+	}()
+
+	if err := swtpm.waitForSocket(SwTPMSocketTimeout); err != nil {
+		swtpm.Stop()
+		return nil, err
+	}
+
+	return swtpm, nil
+}
+
+func (swtpm *SwTPM) waitForSocket(timeout time.Duration) error {
+	return waitForHelperSocket(SwTPMPath, "TPM", swtpm.SocketPath, swtpm.done, timeout)
+}
+
+// waitForHelperSocket waits for the socket of a helper process started with
+// the given binary, or for the process to exit without creating it. The
+// exit status read from done is put back for the process Stop method.
+func waitForHelperSocket(binary, kind, socket string, done chan error, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if PathExists(socket) {
+			return nil
+		}
+
+		select {
+		case err := <-done:
+			done <- err
+			return fmt.Errorf("%s exited before creating %s: %v", binary, socket, err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for %s socket %s", kind, socket)
+		}
+	}
+}
+
+// Stop kills the swtpm process, if still running, and removes its socket.
+// The TPM state is kept.
+func (swtpm *SwTPM) Stop() error {
+	select {
+	case <-swtpm.done:
+	default:
+		if err := swtpm.cmd.Process.Kill(); err != nil {
+			return fmt.Errorf("Failed to stop %s: %s", SwTPMPath, err)
+		}
+		<-swtpm.done
+	}
+
+	if err := os.Remove(swtpm.SocketPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package qcli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDaemon points the helper binary path, e.g. SwTPMPath, at a shell
+// script running body and shortens its socket timeout for the test.
+func fakeDaemon(t *testing.T, path *string, timeout *time.Duration, body string) {
+	script := filepath.Join(t.TempDir(), filepath.Base(*path))
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	origPath, origTimeout := *path, *timeout
+	*path = script
+	*timeout = 2 * time.Second
+	t.Cleanup(func() {
+		*path, *timeout = origPath, origTimeout
+	})
+}
+
+func fakeSwTPM(t *testing.T, body string) {
+	fakeDaemon(t, &SwTPMPath, &SwTPMSocketTimeout, body)
+}
+
+func TestStartTPMEmulator(t *testing.T) {
+	// record the args, then create the ctrl socket given as type=unixio,path=<socket>
+	fakeSwTPM(t, "echo \"$@\" > \"${6#type=unixio,path=}.args\"\ntouch \"${6#type=unixio,path=}\"\nexec sleep 60\n")
+
+	c := &Config{StateDir: t.TempDir()}
+	socket, err := StartTPMEmulator(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	stateDir := filepath.Join(c.StateDir, SwTPMStateDirName)
+	if expected := filepath.Join(stateDir, SwTPMSocketName); socket != expected {
+		t.Errorf("Expected socket %s, found %s", expected, socket)
+	}
+
+	args, _ := os.ReadFile(socket + ".args")
+	expected := fmt.Sprintf("socket --tpm2 --tpmstate dir=%s --ctrl type=unixio,path=%s --log file=%s --terminate", stateDir, socket, filepath.Join(stateDir, SwTPMLogName))
+	if strings.TrimSpace(string(args)) != expected {
+		t.Errorf("Expected swtpm args\n%s\nfound\n%s", expected, args)
+	}
+
+	expectedTPM := TPMDevice{ID: "tpm0", Driver: TPMTISDevice, Type: TPMEmulatorDevice, Path: socket}
+	if c.TPM != expectedTPM {
+		t.Errorf("Expected TPM %+v, found %+v", expectedTPM, c.TPM)
+	}
+
+	if _, err := StartTPMEmulator(c); err == nil {
+		t.Errorf("Expected error starting the TPM emulator twice")
+	}
+
+	if err := c.Cleanup(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if PathExists(socket) {
+		t.Errorf("Expected socket %s to be removed by Cleanup", socket)
+	}
+}
+
+func TestBadStartTPMEmulator(t *testing.T) {
+	fakeSwTPM(t, "exit 1\n")
+
+	if _, err := StartTPMEmulator(&Config{}); err == nil {
+		t.Errorf("Expected error without StateDir")
+	}
+
+	c := &Config{StateDir: t.TempDir()}
+	if _, err := StartTPMEmulator(c); err == nil {
+		t.Errorf("Expected error when swtpm exits")
+	}
+	if c.TPM.Path != "" {
+		t.Errorf("Expected TPM to be unset, found %+v", c.TPM)
+	}
+}
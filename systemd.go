@@ -0,0 +1,237 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SystemdUnitOptions are the service settings of GenerateSystemdUnit.
+type SystemdUnitOptions struct {
+	// Description is the unit description, "qemu VM <Name>" by default
+	Description string
+
+	// ExecStart replaces the qemu command line, e.g. with a runner
+	// launching the VM from its YAML config with LaunchQemu
+	ExecStart []string
+
+	// User and Group are the account the service runs as, they default
+	// to the Config Uid and Gid when RunAs is set
+	User  string
+	Group string
+
+	// Restart is the service restart policy, on-failure by default
+	Restart string
+
+	// WantedBy is the install target, multi-user.target by default
+	WantedBy string
+
+	// HelperUnits maps the sockets of the emulated TPM and of the
+	// vhost-user devices to the units serving them, e.g. a swtpm or a
+	// virtiofsd service. Each of these sockets needs a helper unit.
+	HelperUnits map[string]string
+
+	// Requires are other units the VM needs, e.g. a network bridge
+	Requires []string
+}
+
+// systemdQuote quotes arg for an ExecStart command line, escaping the
+// systemd specifiers and environment variable expansion.
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+		return arg
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + replacer.Replace(arg) + `"`
+}
+
+// helperSockets returns the sockets served by host helper processes that
+// qemu connects to.
+func (config *Config) helperSockets() []string {
+	var sockets []string
+	if config.TPM.Type == TPMEmulatorDevice {
+		sockets = append(sockets, config.TPM.Path)
+	}
+	for _, dev := range config.VhostUserDevices {
+		sockets = append(sockets, dev.SocketPath)
+	}
+	return sockets
+}
+
+// serviceDirectives returns the [Service] directives running the qemu
+// command line with the RunAs credentials and in the Sandbox, which systemd
+// applies instead of the launch helpers and namespaces of LaunchQemu.
+func (config *Config) serviceDirectives(opts SystemdUnitOptions) ([]string, error) {
+	var directives []string
+
+	user, group := opts.User, opts.Group
+	if config.RunAs != "" {
+		uid, gid := strconv.FormatUint(uint64(config.Uid), 10), strconv.FormatUint(uint64(config.Gid), 10)
+		if (user != "" && user != uid) || (group != "" && group != gid) {
+			return nil, fmt.Errorf("SystemdUnitOptions User and Group conflict with RunAs uid=%s gid=%s", uid, gid)
+		}
+		user, group = uid, gid
+	}
+	if user != "" {
+		directives = append(directives, "User="+user)
+	}
+	if group != "" {
+		directives = append(directives, "Group="+group)
+	}
+	if config.RunAs != "" && len(config.Groups) > 0 {
+		var groups []string
+		for _, g := range config.Groups {
+			groups = append(groups, strconv.FormatUint(uint64(g), 10))
+		}
+		directives = append(directives, "SupplementaryGroups="+strings.Join(groups, " "))
+	}
+
+	if config.Sandbox.UserNamespace {
+		directives = append(directives, "PrivateUsers=yes")
+	}
+	if config.Sandbox.MountNamespace {
+		directives = append(directives, "PrivateMounts=yes")
+	}
+	if config.Sandbox.NetworkNamespace {
+		directives = append(directives, "PrivateNetwork=yes")
+	}
+	if config.Sandbox.NoNewPrivileges {
+		directives = append(directives, "NoNewPrivileges=yes")
+	}
+
+	return directives, nil
+}
+
+// GenerateSystemdUnit renders a systemd service unit running the VM, so that
+// a VM defined in YAML can be installed as a host service. The unit runs the
+// qemu command line of the Config unless ExecStart is set, and depends on
+// the HelperUnits serving the sockets of the emulated TPM and vhost-user
+// devices. The RunAs credentials and the Sandbox are set with the service
+// directives for the qemu command line, an ExecStart runner applies them
+// itself.
+func GenerateSystemdUnit(config *Config, opts SystemdUnitOptions) (string, error) {
+	requires := make(map[string]bool)
+	for _, socket := range config.helperSockets() {
+		unit, ok := opts.HelperUnits[socket]
+		if !ok {
+			return "", fmt.Errorf("No helper unit serves socket %s", socket)
+		}
+		requires[unit] = true
+	}
+	for _, unit := range opts.Requires {
+		requires[unit] = true
+	}
+	var units []string
+	for unit := range requires {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+
+	// an ExecStart runner applies the RunAs and Sandbox settings itself
+	service := config
+	if len(opts.ExecStart) > 0 {
+		service = &Config{}
+	}
+	directives, err := service.serviceDirectives(opts)
+	if err != nil {
+		return "", err
+	}
+
+	execStart := opts.ExecStart
+	if len(execStart) == 0 {
+		// configure a copy, config can still be launched afterwards
+		unit := config.unconfigured()
+		defer unit.Cleanup()
+
+		params, err := ConfigureParams(unit, nil)
+		if err != nil {
+			return "", err
+		}
+		if len(unit.fds) > 0 {
+			return "", fmt.Errorf("A systemd unit cannot pass file descriptors to qemu, use ExecStart")
+		}
+		// e.g. the cloud-init seed, removed once the unit is generated
+		if len(unit.tempFiles) > 0 {
+			return "", fmt.Errorf("The qemu command line uses temporary files, use ExecStart")
+		}
+		path := config.Path
+		if path == "" {
+			path = defaultQemuPath
+		}
+		execStart = append([]string{path}, params...)
+	}
+
+	description := opts.Description
+	if description == "" {
+		description = "qemu VM " + config.Name
+	}
+	restart := opts.Restart
+	if restart == "" {
+		restart = "on-failure"
+	}
+	wantedBy := opts.WantedBy
+	if wantedBy == "" {
+		wantedBy = "multi-user.target"
+	}
+
+	var unit strings.Builder
+	unit.WriteString("[Unit]\n")
+	fmt.Fprintf(&unit, "Description=%s\n", description)
+	if len(units) > 0 {
+		fmt.Fprintf(&unit, "Requires=%s\n", strings.Join(units, " "))
+	}
+	fmt.Fprintf(&unit, "After=%s\n", strings.Join(append([]string{"network.target"}, units...), " "))
+
+	unit.WriteString("\n[Service]\n")
+	if config.Knobs.Daemonize {
+		if config.PidFile == "" {
+			return "", fmt.Errorf("A daemonized qemu requires a PidFile for its systemd unit")
+		}
+		unit.WriteString("Type=forking\n")
+		fmt.Fprintf(&unit, "PIDFile=%s\n", config.PidFile)
+	} else {
+		unit.WriteString("Type=simple\n")
+	}
+	for _, directive := range directives {
+		fmt.Fprintf(&unit, "%s\n", directive)
+	}
+	var args []string
+	for _, arg := range execStart {
+		args = append(args, systemdQuote(arg))
+	}
+	fmt.Fprintf(&unit, "ExecStart=%s\n", strings.Join(args, " "))
+	fmt.Fprintf(&unit, "Restart=%s\n", restart)
+
+	unit.WriteString("\n[Install]\n")
+	fmt.Fprintf(&unit, "WantedBy=%s\n", wantedBy)
+
+	return unit.String(), nil
+}
@@ -0,0 +1,147 @@
+package qcli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateSystemdUnit(t *testing.T) {
+	c := &Config{
+		Path:   "/usr/bin/qemu-system-x86_64",
+		Name:   "web server",
+		Memory: Memory{Size: "1G"},
+		TPM: TPMDevice{
+			ID:     "tpm0",
+			Driver: TPMTISDevice,
+			Type:   TPMEmulatorDevice,
+			Path:   "/run/vm1/swtpm.sock",
+		},
+	}
+	opts := SystemdUnitOptions{
+		User:        "qemu",
+		HelperUnits: map[string]string{"/run/vm1/swtpm.sock": "swtpm@vm1.service"},
+		Requires:    []string{"br0.netdev"},
+	}
+
+	if _, err := GenerateSystemdUnit(c, SystemdUnitOptions{}); err == nil {
+		t.Errorf("Expected error without a helper unit for the TPM emulator")
+	}
+
+	unit, err := GenerateSystemdUnit(c, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := `[Unit]
+Description=qemu VM web server
+Requires=br0.netdev swtpm@vm1.service
+After=network.target br0.netdev swtpm@vm1.service
+
+[Service]
+Type=simple
+User=qemu
+ExecStart=/usr/bin/qemu-system-x86_64 -name "web server" -m 1G ` +
+		`-chardev socket,id=chrtpm0,path=/run/vm1/swtpm.sock -tpmdev emulator,id=tpm0,chardev=chrtpm0 -device tpm-tis,tpmdev=tpm0 ` +
+		`-object memory-backend-ram,id=dimm1,size=1G -numa node,memdev=dimm1
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`
+	if unit != expected {
+		t.Errorf("Expected unit:\n%s\nfound:\n%s", expected, unit)
+	}
+
+	// the Config is left as it was, it can still be launched
+	if again, err := GenerateSystemdUnit(c, opts); err != nil || again != unit {
+		t.Errorf("Expected the same unit again, found %s: %v", again, err)
+	}
+	if _, err := ConfigureParams(c, nil); err != nil {
+		t.Errorf("Unexpected error configuring the Config after generating its unit: %s", err)
+	}
+}
+
+func TestGenerateSystemdUnitExecStart(t *testing.T) {
+	c := &Config{
+		Name:    "vm2",
+		PidFile: "/run/vm2.pid",
+		Knobs:   Knobs{Daemonize: true},
+	}
+	opts := SystemdUnitOptions{
+		ExecStart: []string{"/usr/bin/vm-runner", "--config", "/etc/vms/vm2.yaml", "--label", "50% $HOME"},
+		Restart:   "always",
+	}
+
+	unit, err := GenerateSystemdUnit(c, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, line := range []string{
+		"Type=forking\n",
+		"PIDFile=/run/vm2.pid\n",
+		`ExecStart=/usr/bin/vm-runner --config /etc/vms/vm2.yaml --label "50%% $$HOME"` + "\n",
+		"Restart=always\n",
+	} {
+		if !strings.Contains(unit, line) {
+			t.Errorf("Expected %q in unit:\n%s", line, unit)
+		}
+	}
+
+	c.PidFile = ""
+	if _, err := GenerateSystemdUnit(c, opts); err == nil {
+		t.Errorf("Expected error for a daemonized qemu without PidFile")
+	}
+}
+
+func TestGenerateSystemdUnitRunAs(t *testing.T) {
+	c := &Config{
+		Path:    "/usr/bin/qemu-system-x86_64",
+		RunAs:   RunAsSudo,
+		Uid:     107,
+		Gid:     107,
+		Groups:  []uint32{36},
+		Sandbox: Sandbox{NoNewPrivileges: true},
+	}
+
+	unit, err := GenerateSystemdUnit(c, SystemdUnitOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, line := range []string{
+		"User=107\n",
+		"Group=107\n",
+		"SupplementaryGroups=36\n",
+		"NoNewPrivileges=yes\n",
+		"ExecStart=/usr/bin/qemu-system-x86_64\n",
+	} {
+		if !strings.Contains(unit, line) {
+			t.Errorf("Expected %q in unit:\n%s", line, unit)
+		}
+	}
+	if strings.Contains(unit, "sudo") || strings.Contains(unit, "setpriv") {
+		t.Errorf("Unexpected launch helper in unit:\n%s", unit)
+	}
+
+	sandboxed := &Config{Sandbox: Sandbox{UserNamespace: true, NetworkNamespace: true}}
+	unit, err = GenerateSystemdUnit(sandboxed, SystemdUnitOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, line := range []string{"PrivateUsers=yes\n", "PrivateNetwork=yes\n"} {
+		if !strings.Contains(unit, line) {
+			t.Errorf("Expected %q in unit:\n%s", line, unit)
+		}
+	}
+
+	if _, err := GenerateSystemdUnit(c, SystemdUnitOptions{User: "qemu"}); err == nil {
+		t.Errorf("Expected error for a User conflicting with RunAs")
+	}
+
+	unit, err = GenerateSystemdUnit(c, SystemdUnitOptions{ExecStart: []string{"/usr/bin/vm-runner"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if strings.Contains(unit, "User=") || strings.Contains(unit, "NoNewPrivileges") {
+		t.Errorf("Unexpected RunAs or Sandbox directives for an ExecStart runner:\n%s", unit)
+	}
+}
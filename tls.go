@@ -0,0 +1,207 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TLSEndpoint is the side of the connection a TLSCredsObject is used on.
+type TLSEndpoint string
+
+const (
+	// TLSEndpointServer is used by listening services, e.g., spice or
+	// an incoming migration.
+	TLSEndpointServer TLSEndpoint = "server"
+
+	// TLSEndpointClient is used by outgoing connections, e.g., an
+	// outgoing migration.
+	TLSEndpointClient TLSEndpoint = "client"
+)
+
+// TLSCredsObject describes a -object tls-creds-x509 loaded from a
+// directory holding ca-cert.pem, server-cert.pem, server-key.pem and/or
+// client-cert.pem, client-key.pem.  Services reference it by ID.
+type TLSCredsObject struct {
+	// ID is the credentials identifier referenced by its users.
+	ID string `yaml:"id"`
+
+	// Dir is the directory holding the x509 certificates and keys.
+	Dir string `yaml:"dir"`
+
+	// Endpoint is whether the credentials are used by a client or a
+	// server, defaults to server.
+	Endpoint TLSEndpoint `yaml:"endpoint"`
+
+	// NoVerifyPeer does not require the peer to present a valid
+	// certificate. By default qemu verifies the peer.
+	NoVerifyPeer bool `yaml:"no-verify-peer"`
+
+	// Priority is the GNUTLS priority string.
+	Priority string `yaml:"priority"`
+
+	// PasswordID is the ID of the SecretObject holding the password of
+	// the private key.
+	PasswordID string `yaml:"password-id"`
+}
+
+// Valid returns an error if the TLSCredsObject structure is not valid and
+// complete.
+func (creds TLSCredsObject) Valid() error {
+	if creds.ID == "" {
+		return fmt.Errorf("TLSCredsObject has empty ID field")
+	}
+
+	if creds.Dir == "" {
+		return fmt.Errorf("TLSCredsObject ID=%s has empty Dir field", creds.ID)
+	}
+
+	switch creds.Endpoint {
+	case "", TLSEndpointServer, TLSEndpointClient:
+	default:
+		return fmt.Errorf("Invalid TLSCredsObject Endpoint value: '%s', must be one of '%s' or '%s'", creds.Endpoint, TLSEndpointServer, TLSEndpointClient)
+	}
+
+	return nil
+}
+
+// endpoint returns the configured endpoint or the qemu default.
+func (creds TLSCredsObject) endpoint() TLSEndpoint {
+	if creds.Endpoint == "" {
+		return TLSEndpointServer
+	}
+	return creds.Endpoint
+}
+
+// QemuParams returns the qemu parameters built out of the TLSCredsObject.
+func (creds TLSCredsObject) QemuParams() []string {
+	var objectParams []string
+
+	objectParams = append(objectParams, "tls-creds-x509")
+	objectParams = append(objectParams, fmt.Sprintf("id=%s", creds.ID))
+	objectParams = append(objectParams, fmt.Sprintf("dir=%s", creds.Dir))
+	objectParams = append(objectParams, fmt.Sprintf("endpoint=%s", creds.endpoint()))
+
+	if creds.NoVerifyPeer {
+		objectParams = append(objectParams, "verify-peer=off")
+	}
+	if creds.Priority != "" {
+		objectParams = append(objectParams, fmt.Sprintf("priority=%s", creds.Priority))
+	}
+	if creds.PasswordID != "" {
+		objectParams = append(objectParams, fmt.Sprintf("passwordid=%s", creds.PasswordID))
+	}
+
+	return []string{"-object", strings.Join(objectParams, ",")}
+}
+
+// findTLSCreds returns the TLSCredsObject with the given ID.
+func (config *Config) findTLSCreds(id string) (TLSCredsObject, bool) {
+	for _, creds := range config.TLSCreds {
+		if creds.ID == id {
+			return creds, true
+		}
+	}
+	return TLSCredsObject{}, false
+}
+
+// validateTLSCredsRefs checks that every TLS credentials referenced by the
+// configuration is defined in TLSCreds with a suitable endpoint.
+func (config *Config) validateTLSCredsRefs() error {
+	ids := make(map[string]bool)
+	for _, creds := range config.TLSCreds {
+		if ids[creds.ID] {
+			return fmt.Errorf("TLSCredsObject ID=%s is defined more than once", creds.ID)
+		}
+		ids[creds.ID] = true
+	}
+
+	for _, creds := range config.TLSCreds {
+		if creds.PasswordID == "" {
+			continue
+		}
+		found := false
+		for _, secret := range config.Secrets {
+			if secret.ID == creds.PasswordID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("TLSCredsObject ID=%s references unknown PasswordID '%s'", creds.ID, creds.PasswordID)
+		}
+	}
+
+	for _, cdev := range config.CharDevices {
+		if cdev.TLSCreds == "" {
+			continue
+		}
+		creds, ok := config.findTLSCreds(cdev.TLSCreds)
+		if !ok {
+			return fmt.Errorf("CharDevice ID=%s references unknown TLSCreds '%s'", cdev.ID, cdev.TLSCreds)
+		}
+		if creds.endpoint() != TLSEndpointServer {
+			return fmt.Errorf("CharDevice ID=%s TLSCreds '%s' must have Endpoint=%s", cdev.ID, cdev.TLSCreds, TLSEndpointServer)
+		}
+	}
+
+	if id := config.SpiceDevice.TLSCreds; id != "" {
+		creds, ok := config.findTLSCreds(id)
+		if !ok {
+			return fmt.Errorf("SpiceDevice references unknown TLSCreds '%s'", id)
+		}
+		if creds.endpoint() != TLSEndpointServer {
+			return fmt.Errorf("SpiceDevice TLSCreds '%s' must have Endpoint=%s", id, TLSEndpointServer)
+		}
+	}
+
+	return nil
+}
+
+func (config *Config) appendTLSCreds() error {
+	var errors []string
+	var params []string
+	for _, creds := range config.TLSCreds {
+		if err := creds.Valid(); err != nil {
+			errors = append(errors, err.Error())
+			continue
+		}
+		params = append(params, creds.QemuParams()...)
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Failed to append %d TLSCredsObject(s):\n%s", len(errors), strings.Join(errors, "\n"))
+	}
+
+	if err := config.validateTLSCredsRefs(); err != nil {
+		return err
+	}
+
+	config.qemuParams = append(config.qemuParams, params...)
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package qcli
+
+import (
+	"testing"
+)
+
+var (
+	tlsCredsServerString  = "-object tls-creds-x509,id=tls0,dir=/etc/pki/qemu,endpoint=server"
+	tlsCredsClientString  = "-object tls-creds-x509,id=tls1,dir=/etc/pki/qemu-client,endpoint=client,verify-peer=off,priority=NORMAL"
+	tlsCredsCharDevString = "-object tls-creds-x509,id=tls0,dir=/etc/pki/qemu,endpoint=server -chardev socket,id=serial0,host=127.0.0.1,port=4555,server=on,wait=off,tls-creds=tls0"
+	tlsCredsSpiceString   = "-object secret,id=keypass0,file=/run/vm/key.pass -object tls-creds-x509,id=tls0,dir=/etc/pki/qemu,endpoint=server,passwordid=keypass0 -spice tls-port=5902,addr=127.0.0.1,x509-dir=/etc/pki/qemu -device virtio-serial-pci -device virtserialport,chardev=spicechannel0,name=com.redhat.spice.0 -chardev spicevmc,id=spicechannel0,name=vdagent"
+)
+
+func TestAppendTLSCredsObject(t *testing.T) {
+	creds := TLSCredsObject{
+		ID:  "tls0",
+		Dir: "/etc/pki/qemu",
+	}
+	testAppend(creds, tlsCredsServerString, t)
+
+	creds = TLSCredsObject{
+		ID:           "tls1",
+		Dir:          "/etc/pki/qemu-client",
+		Endpoint:     TLSEndpointClient,
+		NoVerifyPeer: true,
+		Priority:     "NORMAL",
+	}
+	testAppend(creds, tlsCredsClientString, t)
+}
+
+func TestBadTLSCredsObject(t *testing.T) {
+	bad := []TLSCredsObject{
+		{Dir: "/etc/pki/qemu"},
+		{ID: "tls0"},
+		{ID: "tls0", Dir: "/etc/pki/qemu", Endpoint: "peer"},
+	}
+	for _, creds := range bad {
+		if err := creds.Valid(); err == nil {
+			t.Errorf("Expected error for invalid TLSCredsObject %+v", creds)
+		}
+	}
+}
+
+func TestTLSCredsSpice(t *testing.T) {
+	config := &Config{
+		Secrets: []SecretObject{{ID: "keypass0", File: "/run/vm/key.pass"}},
+		TLSCreds: []TLSCredsObject{
+			{ID: "tls0", Dir: "/etc/pki/qemu", PasswordID: "keypass0"},
+		},
+		SpiceDevice: SpiceDevice{TLSPort: "5902", TLSCreds: "tls0"},
+	}
+	testConfig(config, tlsCredsSpiceString, t)
+}
+
+func TestTLSCredsCharDevice(t *testing.T) {
+	config := &Config{
+		TLSCreds: []TLSCredsObject{{ID: "tls0", Dir: "/etc/pki/qemu"}},
+		CharDevices: []CharDevice{
+			{Driver: LegacySerial, Backend: Socket, ID: "serial0", Host: "127.0.0.1", Port: "4555", TLSCreds: "tls0"},
+		},
+	}
+	testConfig(config, tlsCredsCharDevString, t)
+}
+
+func TestTLSCredsRefs(t *testing.T) {
+	bad := []*Config{
+		{
+			TLSCreds: []TLSCredsObject{
+				{ID: "tls0", Dir: "/etc/pki/qemu"},
+				{ID: "tls0", Dir: "/etc/pki/qemu"},
+			},
+		},
+		{
+			TLSCreds: []TLSCredsObject{
+				{ID: "tls0", Dir: "/etc/pki/qemu", PasswordID: "keypass0"},
+			},
+		},
+		{
+			TLSCreds:    []TLSCredsObject{{ID: "tls0", Dir: "/etc/pki/qemu"}},
+			SpiceDevice: SpiceDevice{TLSPort: "5902", TLSCreds: "tls1"},
+		},
+		{
+			TLSCreds: []TLSCredsObject{
+				{ID: "tls0", Dir: "/etc/pki/qemu", Endpoint: TLSEndpointClient},
+			},
+			SpiceDevice: SpiceDevice{TLSPort: "5902", TLSCreds: "tls0"},
+		},
+		{
+			TLSCreds: []TLSCredsObject{{ID: "tls0", Dir: "/etc/pki/qemu"}},
+			CharDevices: []CharDevice{
+				{Backend: Socket, ID: "serial0", Port: "4555", TLSCreds: "tls1"},
+			},
+		},
+		{
+			TLSCreds: []TLSCredsObject{
+				{ID: "tls0", Dir: "/etc/pki/qemu", Endpoint: TLSEndpointClient},
+			},
+			CharDevices: []CharDevice{
+				{Backend: Socket, ID: "serial0", Port: "4555", TLSCreds: "tls0"},
+			},
+		},
+	}
+	for _, config := range bad {
+		if err := config.appendTLSCreds(); err == nil {
+			t.Errorf("Expected error for invalid TLS credentials references %+v", config.TLSCreds)
+		}
+		if len(config.qemuParams) != 0 {
+			t.Errorf("Expected no parameters on error, got %v", config.qemuParams)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Trace describes the qemu -trace configuration.
+type Trace struct {
+	// Events are trace event names or patterns to enable, e.g.
+	// virtio_blk_* or kvm_run_exit
+	Events []string `yaml:"events"`
+
+	// EventsFile is a file listing the trace events to enable, one per line
+	EventsFile string `yaml:"events-file"`
+
+	// File is the trace output file, only used by the simple and log
+	// trace backends
+	File string `yaml:"file"`
+}
+
+// Valid returns an error if the Trace structure is not valid.
+func (trace Trace) Valid() error {
+	for _, event := range trace.Events {
+		if event == "" || strings.ContainsAny(event, ", ") {
+			return fmt.Errorf("Invalid Trace Events value: '%s'", event)
+		}
+	}
+
+	if strings.Contains(trace.EventsFile, ",") || strings.Contains(trace.File, ",") {
+		return fmt.Errorf("Trace EventsFile and File must not contain ','")
+	}
+
+	return nil
+}
+
+func (config *Config) appendTrace() error {
+	trace := config.Trace
+	if len(trace.Events) == 0 && trace.EventsFile == "" && trace.File == "" {
+		return nil
+	}
+
+	if err := trace.Valid(); err != nil {
+		return err
+	}
+
+	for _, event := range trace.Events {
+		config.qemuParams = append(config.qemuParams, "-trace")
+		config.qemuParams = append(config.qemuParams, fmt.Sprintf("enable=%s", event))
+	}
+
+	var traceParams []string
+	if trace.EventsFile != "" {
+		traceParams = append(traceParams, fmt.Sprintf("events=%s", trace.EventsFile))
+	}
+	if trace.File != "" {
+		traceParams = append(traceParams, fmt.Sprintf("file=%s", trace.File))
+	}
+	if len(traceParams) > 0 {
+		config.qemuParams = append(config.qemuParams, "-trace")
+		config.qemuParams = append(config.qemuParams, strings.Join(traceParams, ","))
+	}
+
+	return nil
+}
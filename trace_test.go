@@ -0,0 +1,31 @@
+package qcli
+
+import "testing"
+
+var (
+	traceString = "-trace enable=virtio_blk_* -trace enable=kvm_run_exit -trace events=/tmp/events,file=/tmp/trace.out"
+)
+
+func TestAppendTrace(t *testing.T) {
+	c := &Config{
+		Trace: Trace{
+			Events:     []string{"virtio_blk_*", "kvm_run_exit"},
+			EventsFile: "/tmp/events",
+			File:       "/tmp/trace.out",
+		},
+	}
+	testConfig(c, traceString, t)
+}
+
+func TestBadTrace(t *testing.T) {
+	traces := []Trace{
+		{Events: []string{""}},
+		{Events: []string{"virtio_blk_*,kvm_*"}},
+		{File: "/tmp/trace,out"},
+	}
+	for _, trace := range traces {
+		if err := trace.Valid(); err == nil {
+			t.Errorf("Expected error for invalid Trace %+v", trace)
+		}
+	}
+}
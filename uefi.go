@@ -1,7 +1,10 @@
 package qcli
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -10,16 +13,24 @@ import (
 type UEFIFirmwareDevice struct {
 	Code string `yaml:"uefi-code"`
 	Vars string `yaml:"uefi-vars"`
+
+	// ResetVars makes EnsureVars overwrite existing per-VM vars with a
+	// fresh copy of the template.
+	ResetVars bool `yaml:"reset-vars"`
 }
 
 var VMFHostPrefix = "/usr/share"
 
+// VirtFwVarsPath is the virt-fw-vars binary used to enroll UEFI keys
+var VirtFwVarsPath = "virt-fw-vars"
+
 const (
 	UEFIVarsFileName = "uefi-nvram.fd"
 	VMFCode          = "VMF_CODE" // OVMF_CODE , AAVMF_CODE
 	VMFVars          = "VMF_VARS"
 	VMFMs            = ".ms"
 	VMFSecboot       = ".secboot"
+	VMFSnakeoil      = ".snakeoil"
 	VMF4MB           = "_4M"
 	VMFSuffix        = ".fd"
 	VMF32Bit         = "32"
@@ -98,13 +109,108 @@ func (u UEFIFirmwareDevice) Exists() (bool, error) {
 	return false, fmt.Errorf("Failed to find UEFIFirmwareDevice paths: %s", strings.Join(missing, ", "))
 }
 
+// EnsureVars makes sure the per-VM vars file at targetPath exists, copying
+// it from the Vars template if missing or if ResetVars is set, and points
+// Vars at it. An existing targetPath whose size differs from the template,
+// e.g. 2M vars used with 4M code, is an error unless ResetVars is set.
+// targetPath is usually filepath.Join(stateDir, UEFIVarsFileName).
+func (u *UEFIFirmwareDevice) EnsureVars(targetPath string) error {
+	if u.Vars == "" {
+		return fmt.Errorf("UEFIFirmwareDevice.Vars is empty: %+v", u)
+	}
+	if targetPath == "" {
+		return fmt.Errorf("UEFIFirmwareDevice vars target path is empty")
+	}
+
+	if u.Vars == targetPath {
+		if !PathExists(targetPath) {
+			return fmt.Errorf("UEFIFirmwareDevice vars %q not found", targetPath)
+		}
+		return nil
+	}
+
+	template, err := os.Stat(u.Vars)
+	if err != nil {
+		return fmt.Errorf("Failed to find UEFI vars template: %s", err)
+	}
+
+	target, err := os.Stat(targetPath)
+	switch {
+	case err == nil && !u.ResetVars:
+		if target.Size() != template.Size() {
+			return fmt.Errorf("UEFI vars %q size %d does not match template %q size %d, reset required",
+				targetPath, target.Size(), u.Vars, template.Size())
+		}
+	case err == nil || os.IsNotExist(err):
+		if err := CopyFileBits(u.Vars, targetPath); err != nil {
+			return fmt.Errorf("Failed to copy UEFI vars template %q to %q: %s", u.Vars, targetPath, err)
+		}
+	default:
+		return fmt.Errorf("Failed to check UEFI vars %q: %s", targetPath, err)
+	}
+
+	u.Vars = targetPath
+
+	return nil
+}
+
 // NewSystemUEFIFirmwareDevice looks at the local system to collect expected
 // OVMF firmware files, callers will need to make a copy of the of the Vars
 // template file before using it in a running VM.
 func NewSystemUEFIFirmwareDevice(useSecureBoot bool) (*UEFIFirmwareDevice, error) {
+	return NewSystemUEFIFirmwareDeviceWithOptions(UEFIFirmwareOptions{SecureBoot: useSecureBoot})
+}
+
+// UEFIFirmwareOptions selects the system firmware variant returned by
+// NewSystemUEFIFirmwareDeviceWithOptions.
+type UEFIFirmwareOptions struct {
+	// SecureBoot selects secure boot capable firmware.
+	SecureBoot bool
+
+	// Snakeoil prefers vars with the distro snakeoil test keys enrolled
+	// and secure boot enabled, for testing signed boot chains. It
+	// implies SecureBoot.
+	Snakeoil bool
+}
+
+// NewSystemUEFIFirmwareDeviceWithOptions looks at the local system to
+// collect the OVMF firmware files matching opts. See
+// NewSystemUEFIFirmwareDevice.
+func NewSystemUEFIFirmwareDeviceWithOptions(opts UEFIFirmwareOptions) (*UEFIFirmwareDevice, error) {
 
 	pfx := VMFPrefix()
 	pathBase := VMFPathBase()
+	useSecureBoot := opts.SecureBoot || opts.Snakeoil
+
+	if opts.Snakeoil {
+		var candidates []UEFIFirmwareDevice
+		// 4M  and .secboot variants are only on x86
+		switch runtime.GOARCH {
+		case "amd64", "x86_64":
+			candidates = append(candidates,
+				UEFIFirmwareDevice{
+					Code: filepath.Join(pathBase, pfx+VMFCode+VMF4MB+VMFSecboot+VMFSuffix),  // OVMF_CODE_4M.secboot.fd
+					Vars: filepath.Join(pathBase, pfx+VMFVars+VMF4MB+VMFSnakeoil+VMFSuffix), // OVMF_VARS_4M.snakeoil.fd
+				},
+				UEFIFirmwareDevice{
+					Code: filepath.Join(pathBase, pfx+VMFCode+VMFSecboot+VMFSuffix),  // OVMF_CODE.secboot.fd
+					Vars: filepath.Join(pathBase, pfx+VMFVars+VMFSnakeoil+VMFSuffix), // OVMF_VARS.snakeoil.fd
+				})
+		}
+		candidates = append(candidates, UEFIFirmwareDevice{
+			Code: filepath.Join(pathBase, pfx+VMFCode+VMFSnakeoil+VMFSuffix), // {O,AA}VMF_CODE.snakeoil.fd
+			Vars: filepath.Join(pathBase, pfx+VMFVars+VMFSnakeoil+VMFSuffix), // {O,AA}VMF_VARS.snakeoil.fd
+		})
+
+		for _, c := range candidates {
+			if found, _ := c.Exists(); found {
+				c := c
+				return &c, nil
+			}
+		}
+
+		return &UEFIFirmwareDevice{}, fmt.Errorf("%sVMF snakeoil code,vars missing, check: %s", pfx, pathBase)
+	}
 
 	// SecureBoot+4M
 	secBoot4M := UEFIFirmwareDevice{
@@ -195,3 +301,65 @@ func NewSystemUEFIFirmwareDevice(useSecureBoot bool) (*UEFIFirmwareDevice, error
 
 	return &UEFIFirmwareDevice{}, fmt.Errorf("%sVMF code,vars missing, check: %s", pfx, pathBase)
 }
+
+// UEFIKeys are the secure boot certificates enrolled by EnrollKeys.
+type UEFIKeys struct {
+	// OwnerGUID is the signature owner of the enrolled certificates
+	OwnerGUID string
+
+	// PK is the platform key certificate file (PEM)
+	PK string
+
+	// KEK are the key exchange key certificate files (PEM)
+	KEK []string
+
+	// DB are the signature database certificate files (PEM)
+	DB []string
+
+	// SecureBoot enables secure boot once the keys are enrolled
+	SecureBoot bool
+}
+
+// EnrollKeys enrolls custom PK/KEK/DB certificates into the Vars file using
+// virt-fw-vars. The system vars templates are never modified, call
+// EnsureVars first to get a per-VM copy.
+func (u UEFIFirmwareDevice) EnrollKeys(ctx context.Context, keys UEFIKeys) error {
+	if u.Vars == "" {
+		return fmt.Errorf("UEFIFirmwareDevice.Vars is empty: %+v", u)
+	}
+	if strings.HasPrefix(filepath.Clean(u.Vars), filepath.Clean(VMFHostPrefix)+string(filepath.Separator)) {
+		return fmt.Errorf("Refusing to enroll keys into system vars template %q, use EnsureVars", u.Vars)
+	}
+	if keys.OwnerGUID == "" {
+		return fmt.Errorf("UEFIKeys has empty OwnerGUID field")
+	}
+	if keys.PK == "" {
+		return fmt.Errorf("UEFIKeys has empty PK field")
+	}
+
+	output := u.Vars + ".enroll"
+	args := []string{"--input", u.Vars, "--output", output, "--set-pk", keys.OwnerGUID, keys.PK}
+	for _, kek := range keys.KEK {
+		args = append(args, "--add-kek", keys.OwnerGUID, kek)
+	}
+	for _, db := range keys.DB {
+		args = append(args, "--add-db", keys.OwnerGUID, db)
+	}
+	if keys.SecureBoot {
+		args = append(args, "--secure-boot")
+	}
+
+	/* #nosec */
+	cmd := exec.CommandContext(ctx, VirtFwVarsPath, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		_ = os.Remove(output)
+		return fmt.Errorf("Failed to enroll UEFI keys into %q: %s: %s", u.Vars, err, strings.TrimSpace(string(out)))
+	}
+
+	if err := os.Rename(output, u.Vars); err != nil {
+		_ = os.Remove(output)
+		return fmt.Errorf("Failed to update UEFI vars %q: %s", u.Vars, err)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package qcli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -167,3 +168,145 @@ func TestAppendUEFIFirmwareDeviceConfig(t *testing.T) {
 }
 
 // TODO: add system tests to handle different distros
+
+func TestUEFIFirmwareDeviceEnsureVars(t *testing.T) {
+	dir := t.TempDir()
+	template2M := filepath.Join(dir, "OVMF_VARS.fd")
+	template4M := filepath.Join(dir, "OVMF_VARS_4M.fd")
+	target := filepath.Join(dir, "vm1", UEFIVarsFileName)
+
+	if err := os.WriteFile(template2M, make([]byte, 128), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(template4M, make([]byte, 512), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	udev := UEFIFirmwareDevice{Code: "OVMF_CODE.fd", Vars: template2M}
+	if err := udev.EnsureVars(target); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if udev.Vars != target {
+		t.Fatalf("Expected Vars %s, found %s", target, udev.Vars)
+	}
+
+	// per-VM vars are kept
+	if err := os.WriteFile(target, append(make([]byte, 127), 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	udev = UEFIFirmwareDevice{Code: "OVMF_CODE.fd", Vars: template2M}
+	if err := udev.EnsureVars(target); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if content, _ := os.ReadFile(target); content[127] != 1 {
+		t.Errorf("Expected existing vars to be kept")
+	}
+
+	// size mismatch with the 4M template requires a reset
+	udev = UEFIFirmwareDevice{Code: "OVMF_CODE_4M.fd", Vars: template4M}
+	if err := udev.EnsureVars(target); err == nil {
+		t.Fatalf("Expected error for vars size mismatch")
+	}
+
+	udev.ResetVars = true
+	if err := udev.EnsureVars(target); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if info, _ := os.Stat(target); info.Size() != 512 {
+		t.Errorf("Expected vars to be reset to the 4M template, found size %d", info.Size())
+	}
+
+	udev = UEFIFirmwareDevice{Code: "OVMF_CODE.fd", Vars: filepath.Join(dir, "missing.fd")}
+	if err := udev.EnsureVars(target); err == nil {
+		t.Errorf("Expected error for missing vars template")
+	}
+}
+
+func TestNewUEFIFIrmwareDeviceSnakeoil(t *testing.T) {
+	origVMFHostPrefix := VMFHostPrefix
+	VMFHostPrefix = t.TempDir()
+	defer func() {
+		VMFHostPrefix = origVMFHostPrefix
+	}()
+
+	basePath := VMFPathBase()
+	files := ubuntuVMFFiles()
+	if err := createTree(basePath, files); err != nil {
+		t.Fatalf("Failed to create directory structure for test: %s", err)
+	}
+
+	udev, err := NewSystemUEFIFirmwareDeviceWithOptions(UEFIFirmwareOptions{Snakeoil: true})
+	if err != nil {
+		t.Fatalf("Invalid New UEFI Firwmare device: %s", err)
+	}
+	codePath := ""
+	varsPath := ""
+	switch runtime.GOARCH {
+	case "amd64", "x86_64":
+		codePath = filepath.Join(basePath, "OVMF_CODE.secboot.fd")
+		varsPath = filepath.Join(basePath, "OVMF_VARS.snakeoil.fd")
+	case "arm64", "aarch64":
+		codePath = filepath.Join(basePath, "AAVMF_CODE.snakeoil.fd")
+		varsPath = filepath.Join(basePath, "AAVMF_VARS.snakeoil.fd")
+	}
+	expected := fmt.Sprintf("-drive if=pflash,format=raw,readonly=on,file=%s -drive if=pflash,format=raw,file=%s", codePath, varsPath)
+	testAppend(*udev, expected, t)
+}
+
+func TestUEFIFirmwareDeviceEnrollKeys(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "virt-fw-vars")
+	content := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\ncp \"$2\" \"$4\"\n", argsFile)
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	origVirtFwVarsPath := VirtFwVarsPath
+	VirtFwVarsPath = script
+	defer func() {
+		VirtFwVarsPath = origVirtFwVarsPath
+	}()
+
+	vars := filepath.Join(dir, UEFIVarsFileName)
+	if err := os.WriteFile(vars, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	udev := UEFIFirmwareDevice{Code: "OVMF_CODE.secboot.fd", Vars: vars}
+	keys := UEFIKeys{
+		OwnerGUID:  "a0baa8a3-041d-48a8-bc87-c36d121b5e3d",
+		PK:         "pk.pem",
+		KEK:        []string{"kek.pem"},
+		DB:         []string{"db1.pem", "db2.pem"},
+		SecureBoot: true,
+	}
+	if err := udev.EnrollKeys(context.Background(), keys); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guid := keys.OwnerGUID
+	expected := fmt.Sprintf("--input %s --output %s.enroll --set-pk %s pk.pem --add-kek %s kek.pem --add-db %s db1.pem --add-db %s db2.pem --secure-boot\n", vars, vars, guid, guid, guid, guid)
+	if string(args) != expected {
+		t.Errorf("Expected virt-fw-vars args\n%s\nfound\n%s", expected, args)
+	}
+	if PathExists(vars + ".enroll") {
+		t.Errorf("Expected enroll output to be renamed to the vars file")
+	}
+
+	system := UEFIFirmwareDevice{Vars: filepath.Join(VMFPathBase(), "OVMF_VARS.fd")}
+	if err := system.EnrollKeys(context.Background(), keys); err == nil {
+		t.Errorf("Expected error enrolling keys into the system vars template")
+	}
+
+	if err := udev.EnrollKeys(context.Background(), UEFIKeys{PK: "pk.pem"}); err == nil {
+		t.Errorf("Expected error for UEFIKeys without OwnerGUID")
+	}
+}
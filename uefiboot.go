@@ -0,0 +1,378 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// UEFIBootEntry is a Boot#### load option of the UEFI vars.
+type UEFIBootEntry struct {
+	// Number is the #### of the Boot#### variable
+	Number uint16
+
+	// Description is the boot menu label, e.g. UEFI QEMU DVD-ROM QM00003
+	Description string
+
+	// Active is false for entries the firmware skips
+	Active bool
+
+	// CDROM is true for cdrom drives and media, e.g. an installer ISO
+	CDROM bool
+}
+
+func (e UEFIBootEntry) String() string {
+	return fmt.Sprintf("Boot%04X %s", e.Number, e.Description)
+}
+
+var (
+	// efiGlobalVariableGUID is 8be4df61-93ca-11d2-aa0d-00e098032b8c
+	efiGlobalVariableGUID = []byte{0x61, 0xdf, 0xe4, 0x8b, 0xca, 0x93, 0xd2, 0x11,
+		0xaa, 0x0d, 0x00, 0xe0, 0x98, 0x03, 0x2b, 0x8c}
+
+	// efiAuthenticatedVariableGUID is aaf32c78-947b-439a-a180-2e144ec37792
+	efiAuthenticatedVariableGUID = []byte{0x78, 0x2c, 0xf3, 0xaa, 0x7b, 0x94, 0x9a, 0x43,
+		0xa1, 0x80, 0x2e, 0x14, 0x4e, 0xc3, 0x77, 0x92}
+
+	// efiVariableGUID is ddcf3616-3275-4164-98b6-fe85707ffe7d
+	efiVariableGUID = []byte{0x16, 0x36, 0xcf, 0xdd, 0x75, 0x32, 0x64, 0x41,
+		0x98, 0xb6, 0xfe, 0x85, 0x70, 0x7f, 0xfe, 0x7d}
+)
+
+const (
+	efiFVSignatureOffset    = 40
+	efiFVHeaderLengthOffset = 48
+	efiVarStoreHeaderSize   = 28
+	efiVarStartID           = 0x55aa
+	efiVarAdded             = 0x3f
+	efiVarInDeleteTransit   = 0x3e
+	efiAuthVarHeaderSize    = 60
+	efiVarHeaderSize        = 32
+	efiLoadOptionActive     = 0x1
+)
+
+// efiVariable locates a variable in the vars file.
+type efiVariable struct {
+	name       string
+	guid       []byte
+	state      byte
+	dataOffset int
+	dataSize   int
+}
+
+// parseUEFIVars returns the valid variables of the OVMF/AAVMF vars file
+// data, a firmware volume holding an edk2 variable store.
+func parseUEFIVars(data []byte) ([]efiVariable, error) {
+	if len(data) < efiFVHeaderLengthOffset+2 || string(data[efiFVSignatureOffset:efiFVSignatureOffset+4]) != "_FVH" {
+		return nil, fmt.Errorf("UEFI vars is not a firmware volume")
+	}
+
+	store := int(binary.LittleEndian.Uint16(data[efiFVHeaderLengthOffset:]))
+	if len(data) < store+efiVarStoreHeaderSize {
+		return nil, fmt.Errorf("UEFI vars is truncated")
+	}
+
+	var headerSize int
+	switch {
+	case bytes.Equal(data[store:store+16], efiAuthenticatedVariableGUID):
+		headerSize = efiAuthVarHeaderSize
+	case bytes.Equal(data[store:store+16], efiVariableGUID):
+		headerSize = efiVarHeaderSize
+	default:
+		return nil, fmt.Errorf("UEFI vars has unknown variable store format")
+	}
+
+	end := store + int(binary.LittleEndian.Uint32(data[store+16:]))
+	if end > len(data) {
+		end = len(data)
+	}
+
+	var vars []efiVariable
+	offset := store + efiVarStoreHeaderSize
+	for offset+headerSize <= end && binary.LittleEndian.Uint16(data[offset:]) == efiVarStartID {
+		state := data[offset+2]
+		nameSize := int(binary.LittleEndian.Uint32(data[offset+headerSize-24:]))
+		dataSize := int(binary.LittleEndian.Uint32(data[offset+headerSize-20:]))
+		guid := data[offset+headerSize-16 : offset+headerSize]
+
+		nameOffset := offset + headerSize
+		dataOffset := nameOffset + nameSize
+		if nameSize < 0 || dataSize < 0 || dataOffset+dataSize > end {
+			return nil, fmt.Errorf("UEFI vars has a truncated variable at offset %d", offset)
+		}
+
+		if state == efiVarAdded || state == efiVarInDeleteTransit {
+			vars = append(vars, efiVariable{
+				name:       decodeUTF16(data[nameOffset:dataOffset]),
+				guid:       guid,
+				state:      state,
+				dataOffset: dataOffset,
+				dataSize:   dataSize,
+			})
+		}
+
+		offset = (dataOffset + dataSize + 3) &^ 3
+	}
+
+	return vars, nil
+}
+
+// decodeUTF16 decodes a NUL terminated UTF-16LE string.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
+
+// findGlobalVariable returns the EFI global variable name, preferring the
+// added one over one in the middle of being replaced.
+func findGlobalVariable(vars []efiVariable, name string) (efiVariable, bool) {
+	var found efiVariable
+	ok := false
+	for _, v := range vars {
+		if v.name != name || !bytes.Equal(v.guid, efiGlobalVariableGUID) {
+			continue
+		}
+		if !ok || v.state == efiVarAdded {
+			found = v
+			ok = true
+		}
+	}
+	return found, ok
+}
+
+// parseLoadOption returns the UEFIBootEntry of a Boot#### EFI_LOAD_OPTION.
+func parseLoadOption(number uint16, option []byte) (UEFIBootEntry, error) {
+	if len(option) < 6 {
+		return UEFIBootEntry{}, fmt.Errorf("Boot%04X is truncated", number)
+	}
+
+	entry := UEFIBootEntry{
+		Number: number,
+		Active: binary.LittleEndian.Uint32(option)&efiLoadOptionActive != 0,
+	}
+	pathLen := int(binary.LittleEndian.Uint16(option[4:]))
+
+	descEnd := 6
+	for descEnd+1 < len(option) && binary.LittleEndian.Uint16(option[descEnd:]) != 0 {
+		descEnd += 2
+	}
+	entry.Description = decodeUTF16(option[6:descEnd])
+
+	pathStart := descEnd + 2
+	if pathStart+pathLen > len(option) {
+		return UEFIBootEntry{}, fmt.Errorf("Boot%04X has a truncated device path", number)
+	}
+	entry.CDROM = isCDROMDevicePath(option[pathStart:pathStart+pathLen]) ||
+		isCDROMDescription(entry.Description)
+
+	return entry, nil
+}
+
+// isCDROMDevicePath returns true if the device path has a CD-ROM media node.
+func isCDROMDevicePath(path []byte) bool {
+	for len(path) >= 4 {
+		nodeType, subType := path[0], path[1]
+		nodeLen := int(binary.LittleEndian.Uint16(path[2:]))
+		if nodeType == 0x7f || nodeLen < 4 || nodeLen > len(path) {
+			return false
+		}
+		// media device path, CD-ROM
+		if nodeType == 0x04 && subType == 0x02 {
+			return true
+		}
+		path = path[nodeLen:]
+	}
+	return false
+}
+
+// isCDROMDescription matches the descriptions OVMF gives to cdrom drives,
+// whose device path only has the drive address.
+func isCDROMDescription(desc string) bool {
+	desc = strings.ToUpper(desc)
+	return strings.Contains(desc, "DVD-ROM") || strings.Contains(desc, "CD-ROM") || strings.Contains(desc, "CDROM")
+}
+
+// readBootOrder returns the vars file data, the BootOrder variable and the
+// boot entries it lists.
+func (u UEFIFirmwareDevice) readBootOrder() ([]byte, efiVariable, []UEFIBootEntry, error) {
+	if u.Vars == "" {
+		return nil, efiVariable{}, nil, fmt.Errorf("UEFIFirmwareDevice.Vars is empty: %+v", u)
+	}
+
+	data, err := os.ReadFile(u.Vars)
+	if err != nil {
+		return nil, efiVariable{}, nil, fmt.Errorf("Failed to read UEFI vars %q: %s", u.Vars, err)
+	}
+
+	vars, err := parseUEFIVars(data)
+	if err != nil {
+		return nil, efiVariable{}, nil, fmt.Errorf("Failed to parse UEFI vars %q: %s", u.Vars, err)
+	}
+
+	bootOrder, ok := findGlobalVariable(vars, "BootOrder")
+	if !ok {
+		return nil, efiVariable{}, nil, fmt.Errorf("UEFI vars %q has no BootOrder, boot the VM once first", u.Vars)
+	}
+
+	var entries []UEFIBootEntry
+	order := data[bootOrder.dataOffset : bootOrder.dataOffset+bootOrder.dataSize]
+	for i := 0; i+1 < len(order); i += 2 {
+		number := binary.LittleEndian.Uint16(order[i:])
+		v, ok := findGlobalVariable(vars, fmt.Sprintf("Boot%04X", number))
+		if !ok {
+			entries = append(entries, UEFIBootEntry{Number: number})
+			continue
+		}
+		entry, err := parseLoadOption(number, data[v.dataOffset:v.dataOffset+v.dataSize])
+		if err != nil {
+			return nil, efiVariable{}, nil, fmt.Errorf("UEFI vars %q: %s", u.Vars, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return data, bootOrder, entries, nil
+}
+
+// BootEntries returns the boot entries of the Vars file in BootOrder. The
+// firmware only writes the BootOrder once the VM has booted.
+func (u UEFIFirmwareDevice) BootEntries() ([]UEFIBootEntry, error) {
+	_, _, entries, err := u.readBootOrder()
+	return entries, err
+}
+
+// SetBootOrder moves the boot entries numbers, in that order, to the front
+// of the BootOrder of the Vars file, the other entries keep their order.
+// The Vars file is edited in place, qemu must not be running.
+//
+// OVMF and AAVMF sort the BootOrder again on each boot after the qemu
+// fw_cfg bootorder file, which lists the devices with a BootIndex. The
+// edited order is thus only kept when no device has a BootIndex, use
+// Config.SetBootOrder otherwise.
+func (u UEFIFirmwareDevice) SetBootOrder(numbers []uint16) error {
+	if strings.HasPrefix(filepath.Clean(u.Vars), filepath.Clean(VMFHostPrefix)+string(filepath.Separator)) {
+		return fmt.Errorf("Refusing to edit the boot order of system vars template %q, use EnsureVars", u.Vars)
+	}
+
+	data, bootOrder, entries, err := u.readBootOrder()
+	if err != nil {
+		return err
+	}
+
+	// the BootOrder is rewritten in place, which requires the reordered
+	// list to be as long as the original one
+	listed := make(map[uint16]bool, len(entries))
+	for _, entry := range entries {
+		if listed[entry.Number] {
+			return fmt.Errorf("UEFI vars %q BootOrder has Boot%04X more than once", u.Vars, entry.Number)
+		}
+		listed[entry.Number] = true
+	}
+
+	order := make([]uint16, 0, len(entries))
+	moved := make(map[uint16]bool, len(numbers))
+	for _, number := range numbers {
+		if !listed[number] {
+			return fmt.Errorf("UEFI vars %q BootOrder has no Boot%04X", u.Vars, number)
+		}
+		if moved[number] {
+			return fmt.Errorf("Boot%04X is given more than once", number)
+		}
+		moved[number] = true
+		order = append(order, number)
+	}
+	for _, entry := range entries {
+		if !moved[entry.Number] {
+			order = append(order, entry.Number)
+		}
+	}
+
+	for i, number := range order {
+		binary.LittleEndian.PutUint16(data[bootOrder.dataOffset+2*i:], number)
+	}
+
+	info, err := os.Stat(u.Vars)
+	if err != nil {
+		return fmt.Errorf("Failed to check UEFI vars %q: %s", u.Vars, err)
+	}
+
+	output := u.Vars + ".bootorder"
+	if err := os.WriteFile(output, data, info.Mode().Perm()); err != nil {
+		_ = os.Remove(output)
+		return fmt.Errorf("Failed to write UEFI vars %q: %s", output, err)
+	}
+
+	if err := os.Rename(output, u.Vars); err != nil {
+		_ = os.Remove(output)
+		return fmt.Errorf("Failed to update UEFI vars %q: %s", u.Vars, err)
+	}
+
+	return nil
+}
+
+// PreferDiskBoot moves the cdrom boot entries to the end of the BootOrder
+// of the Vars file so that a freshly installed guest boots from its disk
+// rather than the installer ISO. The Vars file is edited in place, qemu
+// must not be running.
+//
+// The firmware replaces the edited order on the next boot when a device of
+// config has a BootIndex, see SetBootOrder, an error is returned in that
+// case and Config.SetBootOrder should be used instead.
+func (u UEFIFirmwareDevice) PreferDiskBoot(config *Config) error {
+	if config == nil {
+		return fmt.Errorf("PreferDiskBoot requires the Config of the VM")
+	}
+	for _, dev := range config.bootDevices() {
+		if *dev.bootIndex != nil {
+			return fmt.Errorf("%s ID=%s has a BootIndex which overrides the UEFI BootOrder, use Config.SetBootOrder", dev.list, dev.id)
+		}
+	}
+
+	entries, err := u.BootEntries()
+	if err != nil {
+		return err
+	}
+
+	var numbers []uint16
+	for _, entry := range entries {
+		if !entry.CDROM {
+			numbers = append(numbers, entry.Number)
+		}
+	}
+
+	return u.SetBootOrder(numbers)
+}
@@ -0,0 +1,251 @@
+package qcli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+type testEFIVar struct {
+	name  string
+	state byte
+	data  []byte
+}
+
+func encodeUTF16(s string) []byte {
+	var b []byte
+	for _, c := range append(utf16.Encode([]rune(s)), 0) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+// buildUEFIVars returns a vars file with an authenticated variable store
+// holding vars as EFI global variables.
+func buildUEFIVars(vars []testEFIVar) []byte {
+	var store bytes.Buffer
+	for _, v := range vars {
+		name := encodeUTF16(v.name)
+		header := make([]byte, efiAuthVarHeaderSize)
+		binary.LittleEndian.PutUint16(header, efiVarStartID)
+		header[2] = v.state
+		binary.LittleEndian.PutUint32(header[4:], 0x7)
+		binary.LittleEndian.PutUint32(header[36:], uint32(len(name)))
+		binary.LittleEndian.PutUint32(header[40:], uint32(len(v.data)))
+		copy(header[44:], efiGlobalVariableGUID)
+		store.Write(header)
+		store.Write(name)
+		store.Write(v.data)
+		for store.Len()%4 != 0 {
+			store.WriteByte(0xff)
+		}
+	}
+
+	fv := make([]byte, 72)
+	copy(fv[efiFVSignatureOffset:], "_FVH")
+	binary.LittleEndian.PutUint16(fv[efiFVHeaderLengthOffset:], 72)
+
+	storeHeader := make([]byte, efiVarStoreHeaderSize)
+	copy(storeHeader, efiAuthenticatedVariableGUID)
+	binary.LittleEndian.PutUint32(storeHeader[16:], uint32(efiVarStoreHeaderSize+store.Len()+64))
+	storeHeader[20] = 0x5a
+	storeHeader[21] = 0xfe
+
+	data := append(fv, storeHeader...)
+	data = append(data, store.Bytes()...)
+	return append(data, bytes.Repeat([]byte{0xff}, 64)...)
+}
+
+// loadOption returns an EFI_LOAD_OPTION with a PciRoot device path, or a
+// CD-ROM media one if cdrom is set.
+func loadOption(desc string, cdrom bool) []byte {
+	path := []byte{0x02, 0x01, 0x0c, 0x00, 0xd0, 0x41, 0x03, 0x0a, 0x00, 0x00, 0x00, 0x00}
+	if cdrom {
+		path = append([]byte{0x04, 0x02, 0x18, 0x00}, make([]byte, 20)...)
+	}
+	path = append(path, 0x7f, 0xff, 0x04, 0x00)
+
+	option := binary.LittleEndian.AppendUint32(nil, efiLoadOptionActive)
+	option = binary.LittleEndian.AppendUint16(option, uint16(len(path)))
+	option = append(option, encodeUTF16(desc)...)
+	return append(option, path...)
+}
+
+func bootOrder(numbers ...uint16) []byte {
+	var b []byte
+	for _, n := range numbers {
+		b = binary.LittleEndian.AppendUint16(b, n)
+	}
+	return b
+}
+
+func TestUEFIFirmwareDeviceBootOrder(t *testing.T) {
+	vars := filepath.Join(t.TempDir(), UEFIVarsFileName)
+	data := buildUEFIVars([]testEFIVar{
+		{"BootOrder", 0x3c, bootOrder(2, 1, 0)},
+		{"Boot0000", efiVarAdded, loadOption("UiApp", false)},
+		{"Boot0001", efiVarAdded, loadOption("UEFI QEMU DVD-ROM QM00003", false)},
+		{"Boot0002", efiVarAdded, loadOption("installer", true)},
+		{"Boot0003", efiVarAdded, loadOption("UEFI QEMU HARDDISK QM00001", false)},
+		{"BootOrder", efiVarAdded, bootOrder(2, 1, 3, 0)},
+	})
+	if err := os.WriteFile(vars, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	udev := UEFIFirmwareDevice{Code: "OVMF_CODE.fd", Vars: vars}
+	entries, err := udev.BootEntries()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := []UEFIBootEntry{
+		{Number: 2, Description: "installer", Active: true, CDROM: true},
+		{Number: 1, Description: "UEFI QEMU DVD-ROM QM00003", Active: true, CDROM: true},
+		{Number: 3, Description: "UEFI QEMU HARDDISK QM00001", Active: true},
+		{Number: 0, Description: "UiApp", Active: true},
+	}
+	if !reflect.DeepEqual(expected, entries) {
+		t.Errorf("Expected %v, found %v", expected, entries)
+	}
+
+	c := &Config{
+		BlkDevices:          []BlockDevice{{ID: "hd0", BootIndex: NewBootIndex(0)}},
+		UEFIFirmwareDevices: []UEFIFirmwareDevice{udev},
+	}
+	if err := udev.PreferDiskBoot(c); err == nil {
+		t.Errorf("Expected error for a Config with a BootIndex")
+	}
+	if err := udev.PreferDiskBoot(nil); err == nil {
+		t.Errorf("Expected error for a nil Config")
+	}
+
+	c.BlkDevices[0].BootIndex = nil
+	if err := udev.PreferDiskBoot(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	entries, err = udev.BootEntries()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	var order []uint16
+	for _, entry := range entries {
+		order = append(order, entry.Number)
+	}
+	if !reflect.DeepEqual([]uint16{3, 0, 2, 1}, order) {
+		t.Errorf("Expected disk boot order [3 0 2 1], found %v", order)
+	}
+
+	if err := udev.SetBootOrder([]uint16{1}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	entries, _ = udev.BootEntries()
+	if entries[0].Number != 1 || entries[1].Number != 3 {
+		t.Errorf("Expected Boot0001 first, found %v", entries)
+	}
+
+	if err := udev.SetBootOrder([]uint16{7}); err == nil {
+		t.Errorf("Expected error for unknown boot entry")
+	}
+	if err := udev.SetBootOrder([]uint16{3, 3}); err == nil {
+		t.Errorf("Expected error for duplicate boot entry")
+	}
+	if PathExists(vars + ".bootorder") {
+		t.Errorf("Expected boot order output to be renamed to the vars file")
+	}
+
+	system := UEFIFirmwareDevice{Vars: filepath.Join(VMFPathBase(), "OVMF_VARS.fd")}
+	if err := system.SetBootOrder(nil); err == nil {
+		t.Errorf("Expected error editing the system vars template")
+	}
+}
+
+// Checks the boot entries of testdata/OVMF_VARS.bootorder.fd, a vars file
+// laid out as OVMF leaves it after a first boot with a SATA cdrom and disk:
+// a full firmware volume header with its block map, an authenticated
+// variable store with vendor variables, a deleted BootOrder and load options
+// with firmware file and SATA device paths followed by optional data.
+func TestUEFIBootVarsFixture(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "OVMF_VARS.bootorder.fd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := filepath.Join(t.TempDir(), UEFIVarsFileName)
+	if err := os.WriteFile(vars, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	udev := UEFIFirmwareDevice{Code: "OVMF_CODE.fd", Vars: vars}
+	entries, err := udev.BootEntries()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := []UEFIBootEntry{
+		{Number: 1, Description: "UEFI QEMU DVD-ROM QM00005", Active: true, CDROM: true},
+		{Number: 2, Description: "UEFI QEMU HARDDISK QM00001", Active: true},
+		{Number: 0, Description: "UiApp", Active: true},
+		{Number: 3, Description: "EFI Internal Shell", Active: true},
+	}
+	if !reflect.DeepEqual(expected, entries) {
+		t.Errorf("Expected %v, found %v", expected, entries)
+	}
+
+	if err := udev.PreferDiskBoot(&Config{}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	edited, err := os.ReadFile(vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edited) != len(data) {
+		t.Fatalf("Expected the vars file to keep its size %d, found %d", len(data), len(edited))
+	}
+	entries, _ = udev.BootEntries()
+	var order []uint16
+	for _, entry := range entries {
+		order = append(order, entry.Number)
+	}
+	if !reflect.DeepEqual([]uint16{2, 0, 3, 1}, order) {
+		t.Errorf("Expected disk boot order [2 0 3 1], found %v", order)
+	}
+}
+
+func TestBadUEFIBootVars(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"empty":     nil,
+		"notfv":     bytes.Repeat([]byte{0xff}, 128),
+		"noorder":   buildUEFIVars([]testEFIVar{{"Boot0000", efiVarAdded, loadOption("UiApp", false)}}),
+		"truncated": buildUEFIVars([]testEFIVar{{"BootOrder", efiVarAdded, bootOrder(0)}, {"Boot0000", efiVarAdded, []byte{1, 0}}}),
+	}
+	for name, data := range files {
+		vars := filepath.Join(dir, name)
+		if err := os.WriteFile(vars, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (UEFIFirmwareDevice{Vars: vars}).BootEntries(); err == nil {
+			t.Errorf("Expected error for %s UEFI vars", name)
+		}
+	}
+
+	if _, err := (UEFIFirmwareDevice{}).BootEntries(); err == nil {
+		t.Errorf("Expected error for empty Vars")
+	}
+
+	// a BootOrder listing an entry twice can not be rewritten in place
+	vars := filepath.Join(dir, "duplicate")
+	data := buildUEFIVars([]testEFIVar{
+		{"Boot0000", efiVarAdded, loadOption("UiApp", false)},
+		{"Boot0001", efiVarAdded, loadOption("installer", true)},
+		{"BootOrder", efiVarAdded, bootOrder(1, 0, 1)},
+	})
+	if err := os.WriteFile(vars, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := (UEFIFirmwareDevice{Vars: vars}).PreferDiskBoot(&Config{}); err == nil {
+		t.Errorf("Expected error for a BootOrder with a duplicate entry")
+	}
+}
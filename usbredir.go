@@ -0,0 +1,120 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// USBRedirDriver is the USB redirection device driver.
+	USBRedirDriver DeviceDriver = "usb-redir"
+
+	// USBRedirCharDevName is the spicevmc channel name of the USB
+	// redirection devices.
+	USBRedirCharDevName = "usbredir"
+)
+
+// USBRedirDevice represents a USB redirection channel, a SPICE client can
+// forward one of its USB devices into the guest through it.
+type USBRedirDevice struct {
+	// ID is the device ID, the spicevmc chardev ID is derived from it
+	ID string `yaml:"id"`
+
+	// Bus is the USB bus of the device, e.g. usb0.0, qemu picks a free USB
+	// port when empty
+	Bus string `yaml:"bus"`
+}
+
+// NewUSBRedirDevices returns count USB redirection devices with the IDs
+// usbredir0 to usbredir<count-1>.
+func NewUSBRedirDevices(count int) []USBRedirDevice {
+	var devices []USBRedirDevice
+	for i := 0; i < count; i++ {
+		devices = append(devices, USBRedirDevice{ID: fmt.Sprintf("usbredir%d", i)})
+	}
+	return devices
+}
+
+// Valid returns an error if the USBRedirDevice structure is not valid and
+// complete.
+func (dev USBRedirDevice) Valid() error {
+	if dev.ID == "" {
+		return fmt.Errorf("USBRedirDevice has empty ID field")
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the USBRedirDevice.
+func (dev USBRedirDevice) QemuParams(config *Config) []string {
+	var chardevParams []string
+	var deviceParams []string
+	var qemuParams []string
+
+	chardevID := dev.chardevID()
+	chardevParams = append(chardevParams, SpiceCharDevDriver)
+	chardevParams = append(chardevParams, fmt.Sprintf("id=%s", chardevID))
+	chardevParams = append(chardevParams, fmt.Sprintf("name=%s", USBRedirCharDevName))
+
+	deviceParams = append(deviceParams, string(USBRedirDriver))
+	deviceParams = append(deviceParams, fmt.Sprintf("chardev=%s", chardevID))
+	deviceParams = append(deviceParams, fmt.Sprintf("id=%s", dev.ID))
+	if dev.Bus != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", dev.Bus))
+	}
+
+	qemuParams = append(qemuParams, "-chardev")
+	qemuParams = append(qemuParams, strings.Join(chardevParams, ","))
+	qemuParams = append(qemuParams, "-device")
+	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+
+	return qemuParams
+}
+
+// chardevID returns the ID of the spicevmc chardev of the device.
+func (dev USBRedirDevice) chardevID() string {
+	return fmt.Sprintf("%s-chardev", dev.ID)
+}
+
+// validateUSBRedir checks the USB redirection devices have a SPICE server
+// to connect through and a USB controller to plug into.
+func (config *Config) validateUSBRedir() error {
+	if len(config.USBRedirDevices) == 0 {
+		return nil
+	}
+
+	spice := config.SpiceDevice
+	if spice.Port == "" && spice.TLSPort == "" && spice.UnixSocket == "" {
+		return fmt.Errorf("USBRedirDevices require a SpiceDevice")
+	}
+
+	if len(config.USBControllerDevices) == 0 {
+		return fmt.Errorf("USBRedirDevices require a USBControllerDevice")
+	}
+
+	return nil
+}
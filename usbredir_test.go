@@ -0,0 +1,39 @@
+package qcli
+
+import "testing"
+
+var (
+	deviceUSBRedirString = "-chardev spicevmc,id=usbredir0-chardev,name=usbredir -device usb-redir,chardev=usbredir0-chardev,id=usbredir0,bus=usb0.0"
+	usbRedirConfigString = "-spice port=5901,addr=127.0.0.1 -device virtio-serial-pci -device virtserialport,chardev=spicechannel0,name=com.redhat.spice.0 -chardev spicevmc,id=spicechannel0,name=vdagent -device qemu-xhci,id=usb0,addr=0x1e -chardev spicevmc,id=usbredir0-chardev,name=usbredir -device usb-redir,chardev=usbredir0-chardev,id=usbredir0 -chardev spicevmc,id=usbredir1-chardev,name=usbredir -device usb-redir,chardev=usbredir1-chardev,id=usbredir1"
+)
+
+func TestAppendUSBRedirDevice(t *testing.T) {
+	dev := USBRedirDevice{ID: "usbredir0", Bus: "usb0.0"}
+	testAppend(dev, deviceUSBRedirString, t)
+}
+
+func TestAppendConfigUSBRedirDevices(t *testing.T) {
+	c := &Config{
+		SpiceDevice:          SpiceDevice{Port: "5901"},
+		USBControllerDevices: []USBControllerDevice{{ID: "usb0", Driver: USBXHCIController}},
+		USBRedirDevices:      NewUSBRedirDevices(2),
+	}
+	testConfig(c, usbRedirConfigString, t)
+}
+
+func TestBadUSBRedirDevices(t *testing.T) {
+	if err := (USBRedirDevice{}).Valid(); err == nil {
+		t.Errorf("Expected error for USBRedirDevice without ID")
+	}
+
+	configs := []*Config{
+		{USBControllerDevices: []USBControllerDevice{{ID: "usb0", Driver: USBXHCIController}}},
+		{SpiceDevice: SpiceDevice{Port: "5901"}},
+	}
+	for _, c := range configs {
+		c.USBRedirDevices = NewUSBRedirDevices(1)
+		if err := c.validateUSBRedir(); err == nil {
+			t.Errorf("Expected error for invalid usb-redir config %+v", c)
+		}
+	}
+}
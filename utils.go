@@ -1,8 +1,11 @@
 package qcli
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 )
 
 // CopyFileBits - copy file content from a to b
@@ -37,3 +40,39 @@ func PathExists(d string) bool {
 	}
 	return true
 }
+
+// ParseMemorySize converts a qemu memory size string such as 512M or 4G to
+// bytes. A size without suffix is in MiB, like qemu's -m.
+func ParseMemorySize(size string) (uint64, error) {
+	if size == "" {
+		return 0, fmt.Errorf("empty memory size")
+	}
+
+	shift := uint(20)
+	num := size
+	switch strings.ToUpper(size[len(size)-1:]) {
+	case "B":
+		shift = 0
+	case "K":
+		shift = 10
+	case "M":
+		shift = 20
+	case "G":
+		shift = 30
+	case "T":
+		shift = 40
+	default:
+		num = size + "M"
+	}
+	num = num[:len(num)-1]
+
+	val, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory size '%s': %v", size, err)
+	}
+	if val > (^uint64(0))>>shift {
+		return 0, fmt.Errorf("memory size '%s' is too large", size)
+	}
+
+	return val << shift, nil
+}
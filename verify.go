@@ -0,0 +1,232 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+
+package qcli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// singletonParams maps the qemu options that must be given at most once to
+// the Config fields emitting them.
+var singletonParams = map[string]string{
+	"-m":               "Memory",
+	"-smp":             "SMP",
+	"-cpu":             "CPUModel",
+	"-name":            "Name",
+	"-uuid":            "UUID",
+	"-kernel":          "Kernel",
+	"-initrd":          "Kernel",
+	"-append":          "Kernel",
+	"-dtb":             "Kernel",
+	"-bios":            "Bios",
+	"-display":         "Display",
+	"-pidfile":         "PidFile",
+	"-D":               "LogFile",
+	"-incoming":        "Incoming",
+	"-loadvm":          "LoadVM",
+	"-icount":          "ICount",
+	"-compat":          "Compat",
+	"-rtc":             "RTC",
+	"-sandbox":         "SeccompSandbox",
+	"-vga":             "VGA",
+	"-overcommit":      "Knobs.Overcommit",
+	"-msg":             "Knobs.MsgTimestamp",
+	"-watchdog-action": "WatchdogDevices",
+}
+
+// idParams maps the qemu options creating named objects to the key holding
+// their identifier.
+var idParams = map[string]string{
+	"-object":   "id",
+	"-device":   "id",
+	"-chardev":  "id",
+	"-netdev":   "id",
+	"-drive":    "id",
+	"-blockdev": "node-name",
+	"-fsdev":    "id",
+	"-tpmdev":   "id",
+}
+
+// machinePropFields maps the machine properties emitted outside of
+// appendMachine to the Config fields responsible for them.
+var machinePropFields = map[string]string{
+	"memory-backend": "Memory",
+	"hpet":           "Machine, Knobs",
+	"acpi":           "Machine, Knobs",
+}
+
+// verifyParams checks the generated qemu parameters for options given
+// more than once that qemu would reject or silently override, e.g., two
+// -m, two devices with the same id or a machine property set twice.
+func (config *Config) verifyParams() error {
+	var errors []string
+	seen := make(map[string]int)
+	ids := make(map[string]bool)
+	machineProps := make(map[string]bool)
+	machineType := false
+
+	params := config.qemuParams
+	for i := 0; i < len(params)-1; i++ {
+		opt, val := params[i], params[i+1]
+
+		if field, ok := singletonParams[opt]; ok {
+			seen[opt]++
+			if seen[opt] == 2 {
+				errors = append(errors, fmt.Sprintf("%s is given more than once, check %s", opt, field))
+			}
+			i++
+			continue
+		}
+
+		if key, ok := idParams[opt]; ok {
+			for _, p := range splitParams(val) {
+				k, id, found := strings.Cut(p, "=")
+				if !found || k != key || id == "" {
+					continue
+				}
+				if ids[opt+" "+id] {
+					errors = append(errors, fmt.Sprintf("%s %s=%s is given more than once, check %s", opt, key, id, config.fieldsWithID(id)))
+				}
+				ids[opt+" "+id] = true
+			}
+			i++
+			continue
+		}
+
+		if opt == "-machine" {
+			for j, p := range splitParams(val) {
+				k, _, found := strings.Cut(p, "=")
+				if !found && j == 0 {
+					if machineType {
+						errors = append(errors, "-machine type is given more than once, check Machine")
+					}
+					machineType = true
+					continue
+				}
+				k = strings.ReplaceAll(k, "_", "-")
+				if machineProps[k] {
+					field, ok := machinePropFields[k]
+					if !ok {
+						field = "Machine"
+					}
+					errors = append(errors, fmt.Sprintf("-machine property '%s' is given more than once, check %s", k, field))
+				}
+				machineProps[k] = true
+			}
+			i++
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Conflicting qemu parameters:\n%s", strings.Join(errors, "\n"))
+	}
+
+	return nil
+}
+
+// configIDFields lists the Config fields, other than the device lists,
+// emitting id= or node-name= values, with the values they emit.
+var configIDFields = []struct {
+	field string
+	ids   func(config *Config) []string
+}{
+	{"Secrets", func(c *Config) []string {
+		var ids []string
+		for _, secret := range c.Secrets {
+			ids = append(ids, secret.ID)
+		}
+		return ids
+	}},
+	{"TLSCreds", func(c *Config) []string {
+		var ids []string
+		for _, creds := range c.TLSCreds {
+			ids = append(ids, creds.ID)
+		}
+		return ids
+	}},
+	{"QMPSockets", func(c *Config) []string {
+		// only the fd sockets are created with an explicit chardev
+		var ids []string
+		for _, q := range c.QMPSockets {
+			if q.Type == QMPFD {
+				ids = append(ids, q.Name)
+			}
+		}
+		return ids
+	}},
+	{"IOThreads", func(c *Config) []string {
+		var ids []string
+		for _, t := range c.IOThreads {
+			ids = append(ids, t.ID)
+		}
+		return ids
+	}},
+	{"TPM", func(c *Config) []string {
+		return []string{c.TPM.ID, "chr" + c.TPM.ID}
+	}},
+	{"Memory", func(c *Config) []string {
+		if c.Memory.Size == "" {
+			return nil
+		}
+		return []string{memoryBackendID}
+	}},
+}
+
+// fieldsWithID returns the names of the Config fields emitting id as an
+// id= or node-name= value.
+func (config *Config) fieldsWithID(id string) string {
+	var names []string
+
+	for _, list := range deviceRegistry {
+	devices:
+		for _, d := range list.devices(config) {
+			for _, qemuID := range list.identity(config, d).qemuIDs {
+				if qemuID == id {
+					names = append(names, list.field)
+					break devices
+				}
+			}
+		}
+	}
+
+	for _, field := range configIDFields {
+		for _, qemuID := range field.ids(config) {
+			if qemuID == id {
+				names = append(names, field.field)
+				break
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return "the generated parameters"
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
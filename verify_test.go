@@ -0,0 +1,98 @@
+package qcli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyParams(t *testing.T) {
+	c := &Config{
+		Machine: Machine{Type: MachineTypePC35},
+		Memory:  Memory{Size: "1G"},
+		Knobs:   Knobs{NoHPET: true},
+		Version: Version{Major: 8},
+		BlkDevices: []BlockDevice{
+			{Driver: VirtioBlock, ID: "hd0", File: "/var/lib/vm0.img", Format: QCOW2, Interface: NoInterface, IOThread: "iothread0"},
+			{Driver: VirtioBlock, ID: "hd1", File: "/var/lib/vm1.img", Format: QCOW2, Interface: NoInterface, IOThread: "iothread0"},
+		},
+		IOThreads: []IOThread{{ID: "iothread0"}},
+	}
+	if _, err := ConfigureParams(c, nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
+func TestVerifyParamsConflicts(t *testing.T) {
+	testCases := []struct {
+		config *Config
+		field  string
+	}{
+		{
+			&Config{
+				BlkDevices: []BlockDevice{
+					{Driver: VirtioBlock, ID: "hd0", File: "/var/lib/vm0.img", Format: QCOW2, Interface: NoInterface},
+					{Driver: VirtioBlock, ID: "hd0", File: "/var/lib/vm1.img", Format: QCOW2, Interface: NoInterface},
+				},
+			},
+			"-drive id=hd0 is given more than once, check BlkDevices",
+		},
+		{
+			&Config{
+				Secrets:  []SecretObject{{ID: "obj0", File: "/run/vm/luks.key"}},
+				TLSCreds: []TLSCredsObject{{ID: "obj0", Dir: "/etc/pki/qemu"}},
+			},
+			"-object id=obj0 is given more than once, check Secrets, TLSCreds",
+		},
+		{
+			&Config{
+				Machine: Machine{Type: MachineTypeMicrovm, Properties: map[string]string{"memory-backend": "ram0"}},
+				Memory:  Memory{Size: "1G"},
+			},
+			"-machine property 'memory-backend' is given more than once, check Memory",
+		},
+	}
+
+	for _, tc := range testCases {
+		c := tc.config
+		c.Knobs.NoDefaults = true
+		_, err := ConfigureParams(c, nil)
+		if err == nil {
+			t.Errorf("Expected error for conflicting parameters %s", tc.field)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.field) {
+			t.Errorf("Expected error to contain %q, got %q", tc.field, err)
+		}
+	}
+
+	c := &Config{qemuParams: []string{"-m", "1G", "-smp", "2", "-m", "2G"}}
+	if err := c.verifyParams(); err == nil || !strings.Contains(err.Error(), "check Memory") {
+		t.Errorf("Expected error naming Memory for duplicated -m, got %v", err)
+	}
+}
+
+func TestFieldsWithID(t *testing.T) {
+	c := &Config{
+		BlkDevices: []BlockDevice{
+			{Driver: VirtioBlock, ID: "hd0", File: "/var/lib/vm.img"},
+		},
+		CharDevices: []CharDevice{
+			{Driver: Console, ID: "char0", DeviceID: "hd0"},
+		},
+		// the DeviceID of a VFIODevice is a PCI id, not a qemu id
+		VFIODevices: []VFIODevice{
+			{BDF: "02:10.0", VendorID: "0x1af4", DeviceID: "hd0"},
+		},
+		IVShmemDevices: []IVShmemDevice{
+			{Model: IVShmemPlain, ID: "shmem0", MemDev: "hd0"},
+		},
+	}
+
+	expected := "BlkDevices, CharDevices, IVShmemDevices"
+	if fields := c.fieldsWithID("hd0"); fields != expected {
+		t.Errorf("Expected fields %q, found %q", expected, fields)
+	}
+	if fields := c.fieldsWithID("0x1af4"); fields != "the generated parameters" {
+		t.Errorf("Expected no field for a PCI id, found %q", fields)
+	}
+}
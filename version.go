@@ -0,0 +1,111 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// Version is a qemu version. The zero Version means the version is unknown
+// and arguments are emitted with their long standing spelling.
+type Version struct {
+	Major int `yaml:"major"`
+	Minor int `yaml:"minor"`
+	Micro int `yaml:"micro"`
+}
+
+var versionRegexp = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion parses a version string such as "8.2.1" or the output of
+// qemu --version, e.g. "QEMU emulator version 8.2.1 (Debian 1:8.2.1+ds-1)".
+func ParseVersion(s string) (Version, error) {
+	m := versionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("Failed to find a qemu version in %q", s)
+	}
+
+	var v Version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Micro, _ = strconv.Atoi(m[3])
+	}
+
+	return v, nil
+}
+
+// DetectVersion runs the qemu binary at path with --version and returns
+// the parsed version.
+func DetectVersion(ctx context.Context, path string) (Version, error) {
+	if path == "" {
+		path = "qemu-system-x86_64"
+	}
+
+	/* #nosec */
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to run %s --version: %s", path, err)
+	}
+
+	return ParseVersion(string(out))
+}
+
+// VersionFromQMP returns the Version announced in a QMP greeting.
+func VersionFromQMP(v *QMPVersion) Version {
+	if v == nil {
+		return Version{}
+	}
+	return Version{Major: v.Major, Minor: v.Minor, Micro: v.Micro}
+}
+
+// IsZero returns true if the version is unknown.
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+// AtLeast returns true if the version is known and greater or equal to
+// major.minor.
+func (v Version) AtLeast(major, minor int) bool {
+	if v.IsZero() {
+		return false
+	}
+	if v.Major != major {
+		return v.Major > major
+	}
+	return v.Minor >= minor
+}
+
+// Before returns true if the version is known and lower than major.minor.
+func (v Version) Before(major, minor int) bool {
+	return !v.IsZero() && !v.AtLeast(major, minor)
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Micro)
+}
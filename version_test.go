@@ -0,0 +1,129 @@
+package qcli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	testCases := []struct {
+		in       string
+		expected Version
+	}{
+		{"8.2.1", Version{8, 2, 1}},
+		{"7.2", Version{7, 2, 0}},
+		{"QEMU emulator version 8.2.1 (Debian 1:8.2.1+ds-1)\nCopyright (c) 2003-2023 Fabrice Bellard and the QEMU Project developers", Version{8, 2, 1}},
+	}
+
+	for _, tc := range testCases {
+		v, err := ParseVersion(tc.in)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %q: %s", tc.in, err)
+		}
+		if v != tc.expected {
+			t.Fatalf("Expected %s parsing %q, got %s", tc.expected, tc.in, v)
+		}
+	}
+
+	if _, err := ParseVersion("QEMU emulator"); err == nil {
+		t.Fatalf("Expected error parsing string without a version")
+	}
+}
+
+func TestDetectVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "qemu-system-fake")
+	script := "#!/bin/sh\necho 'QEMU emulator version 6.2.0 (Debian 1:6.2+dfsg-2ubuntu6)'\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake qemu: %s", err)
+	}
+
+	v, err := DetectVersion(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if v != (Version{6, 2, 0}) {
+		t.Fatalf("Expected 6.2.0, got %s", v)
+	}
+
+	if VersionFromQMP(&QMPVersion{Major: 5, Minor: 0, Micro: 1}) != (Version{5, 0, 1}) {
+		t.Fatalf("Unexpected version from QMP greeting")
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	v := Version{8, 1, 0}
+	if !v.AtLeast(8, 0) || !v.AtLeast(7, 9) || v.AtLeast(8, 2) || v.AtLeast(9, 0) {
+		t.Errorf("Unexpected AtLeast result for %s", v)
+	}
+	if !v.Before(8, 2) || v.Before(8, 1) {
+		t.Errorf("Unexpected Before result for %s", v)
+	}
+
+	var unknown Version
+	if unknown.AtLeast(0, 0) || unknown.Before(99, 0) {
+		t.Errorf("Unknown version must not compare")
+	}
+}
+
+func TestAppendVersionedKnobs(t *testing.T) {
+	knobs := Knobs{
+		Mlock:  true,
+		NoHPET: true,
+	}
+
+	c := &Config{Knobs: knobs}
+	testConfigAppend(c, knobs, "-overcommit mem-lock=on -no-hpet", t)
+
+	c = &Config{Knobs: knobs, Version: Version{Major: 2, Minor: 12}}
+	testConfigAppend(c, knobs, "-realtime mlock=on -no-hpet", t)
+
+	c = &Config{Knobs: knobs, Version: Version{Major: 8, Minor: 2}}
+	testConfigAppend(c, knobs, "-overcommit mem-lock=on -machine hpet=off", t)
+
+	c = &Config{
+		Knobs:   knobs,
+		Version: Version{Major: 8, Minor: 2},
+		Machine: Machine{
+			Type: MachineTypePC35,
+		},
+	}
+	c.appendMachine()
+	testConfigAppend(c, knobs, "-machine q35,hpet=off -overcommit mem-lock=on", t)
+}
+
+func TestAppendVersionedNoACPI(t *testing.T) {
+	knobs := Knobs{
+		NoHPET: true,
+		NoACPI: true,
+	}
+
+	c := &Config{Knobs: knobs, Version: Version{Major: 7, Minor: 2}}
+	testConfigAppend(c, knobs, "-no-hpet -no-acpi", t)
+
+	c = &Config{Knobs: knobs, Version: Version{Major: 8, Minor: 0}}
+	testConfigAppend(c, knobs, "-machine hpet=off,acpi=off", t)
+
+	c = &Config{
+		Knobs:   knobs,
+		Version: Version{Major: 9, Minor: 0},
+		Machine: Machine{
+			Type: MachineTypePC35,
+		},
+	}
+	c.appendMachine()
+	testConfigAppend(c, knobs, "-machine q35,hpet=off,acpi=off", t)
+
+	c = &Config{
+		Knobs:   Knobs{NoACPI: true},
+		Version: Version{Major: 9, Minor: 0},
+		Machine: Machine{
+			Type:       MachineTypePC35,
+			Properties: map[string]string{"acpi": "on"},
+		},
+	}
+	if err := c.appendMachine(); err == nil {
+		t.Errorf("Expected error for acpi property with NoACPI")
+	}
+}
@@ -27,31 +27,57 @@ package qcli
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // VFIODevice represents a qemu vfio device meant for direct access by guest OS.
 type VFIODevice struct {
 	// Bus-Device-Function of device
-	BDF string
+	BDF string `yaml:"bdf"`
+
+	// SysfsDev is the mediated device (mdev) to pass through instead of a
+	// host PCI function, e.g., a vGPU. It is a sysfs path or an mdev UUID
+	// under MdevSysfsDevices.
+	SysfsDev string `yaml:"sysfsdev"`
+
+	// Display is the display support of a vGPU: on, off or auto
+	Display string `yaml:"display"`
+
+	// RAMFB adds a boot framebuffer to a vGPU with Display on, so firmware
+	// and boot output are visible before the guest driver loads
+	RAMFB bool `yaml:"ramfb"`
 
 	// ROMFile specifies the ROM file being used for this device.
-	ROMFile string
+	ROMFile string `yaml:"romfile"`
 
 	// DevNo identifies the ccw devices for s390x architecture
-	DevNo string
+	DevNo string `yaml:"devno"`
 
 	// VendorID specifies vendor id
-	VendorID string
+	VendorID string `yaml:"vendor-id"`
 
 	// DeviceID specifies device id
-	DeviceID string
+	DeviceID string `yaml:"device-id"`
 
 	// Bus specifies device bus
-	Bus string
+	Bus string `yaml:"bus"`
+
+	// Addr is the guest PCI slot and function of the device, e.g., 0x5.0x1
+	Addr string `yaml:"address"`
+
+	// Multifunction is set on function 0 of a guest slot holding several
+	// functions
+	Multifunction bool `yaml:"multifunction"`
+
+	// XVGA exposes the legacy VGA ranges of a primary GPU to the guest
+	XVGA bool `yaml:"x-vga"`
 
 	// Transport is the virtio transport for this device.
-	Transport VirtioTransport
+	Transport VirtioTransport `yaml:"transport"`
 }
 
 // VFIODeviceTransport is a map of the vfio device name that corresponds to
@@ -62,14 +88,42 @@ var VFIODeviceTransport = map[VirtioTransport]string{
 	TransportMMIO: "vfio-device",
 }
 
+// MdevSysfsDevices is the sysfs directory of the mediated devices
+const MdevSysfsDevices = "/sys/bus/mdev/devices"
+
 // Valid returns true if the VFIODevice structure is valid and complete.
 func (vfioDev VFIODevice) Valid() error {
-	if vfioDev.BDF == "" {
-		return fmt.Errorf("VFIODevice has empty BDF field")
+	if vfioDev.BDF == "" && vfioDev.SysfsDev == "" {
+		return fmt.Errorf("VFIODevice has empty BDF and SysfsDev fields")
+	}
+	if vfioDev.BDF != "" && vfioDev.SysfsDev != "" {
+		return fmt.Errorf("VFIODevice BDF and SysfsDev fields are mutually exclusive")
+	}
+
+	switch vfioDev.Display {
+	case "", "on", "off", "auto":
+	default:
+		return fmt.Errorf("Invalid VFIODevice Display value: '%s', must be one of: on, off, auto", vfioDev.Display)
+	}
+	if vfioDev.RAMFB && vfioDev.Display != "on" {
+		return fmt.Errorf("VFIODevice RAMFB requires Display on")
+	}
+	if vfioDev.Addr != "" {
+		if _, _, err := parsePCIAddr(vfioDev.Addr); err != nil {
+			return fmt.Errorf("VFIODevice has %s", err)
+		}
 	}
 	return nil
 }
 
+// sysfsDevPath returns the sysfs path of the mediated device
+func (vfioDev VFIODevice) sysfsDevPath() string {
+	if strings.Contains(vfioDev.SysfsDev, "/") {
+		return vfioDev.SysfsDev
+	}
+	return MdevSysfsDevices + "/" + vfioDev.SysfsDev
+}
+
 // QemuParams returns the qemu parameters built out of this vfio device.
 func (vfioDev VFIODevice) QemuParams(config *Config) []string {
 	var qemuParams []string
@@ -77,7 +131,11 @@ func (vfioDev VFIODevice) QemuParams(config *Config) []string {
 
 	driver := vfioDev.deviceName(config)
 
-	deviceParams = append(deviceParams, fmt.Sprintf("%s,host=%s", driver, vfioDev.BDF))
+	if vfioDev.SysfsDev != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("%s,sysfsdev=%s", driver, vfioDev.sysfsDevPath()))
+	} else {
+		deviceParams = append(deviceParams, fmt.Sprintf("%s,host=%s", driver, vfioDev.BDF))
+	}
 	if vfioDev.Transport.isVirtioPCI(config) {
 		if vfioDev.VendorID != "" {
 			deviceParams = append(deviceParams, fmt.Sprintf("x-pci-vendor-id=%s", vfioDev.VendorID))
@@ -88,14 +146,33 @@ func (vfioDev VFIODevice) QemuParams(config *Config) []string {
 		if vfioDev.ROMFile != "" {
 			deviceParams = append(deviceParams, fmt.Sprintf("romfile=%s", vfioDev.ROMFile))
 		}
+		if vfioDev.XVGA {
+			deviceParams = append(deviceParams, "x-vga=on")
+		}
+		if vfioDev.Display != "" {
+			deviceParams = append(deviceParams, fmt.Sprintf("display=%s", vfioDev.Display))
+		}
+		if vfioDev.RAMFB {
+			deviceParams = append(deviceParams, "ramfb=on")
+		}
 	}
 
 	if vfioDev.Bus != "" {
 		deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", vfioDev.Bus))
 	}
 
+	if vfioDev.Transport.isVirtioPCI(config) {
+		// the slot is reserved by reservePCISlots
+		if slot, function, err := parsePCIAddr(vfioDev.Addr); err == nil {
+			deviceParams = append(deviceParams, fmt.Sprintf("addr=%s", pciAddrParam(slot, function)))
+		}
+		if vfioDev.Multifunction {
+			deviceParams = append(deviceParams, "multifunction=on")
+		}
+	}
+
 	if vfioDev.Transport.isVirtioCCW(config) {
-		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", vfioDev.DevNo))
+		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(vfioDev.DevNo)))
 	}
 
 	qemuParams = append(qemuParams, "-device")
@@ -113,3 +190,126 @@ func (vfioDev VFIODevice) deviceName(config *Config) string {
 
 	return VFIODeviceTransport[vfioDev.Transport]
 }
+
+// sysfsPCIDevices is the sysfs directory of the host PCI devices
+var sysfsPCIDevices = "/sys/bus/pci/devices"
+
+// normalizeBDF returns the BDF with its PCI domain, e.g., 0000:01:00.0 for
+// 01:00.0.
+func normalizeBDF(bdf string) string {
+	if strings.Count(bdf, ":") == 1 {
+		return "0000:" + bdf
+	}
+	return bdf
+}
+
+// IOMMUGroup returns the IOMMU group number of the host PCI device bdf.
+func IOMMUGroup(bdf string) (int, error) {
+	link, err := os.Readlink(filepath.Join(sysfsPCIDevices, normalizeBDF(bdf), "iommu_group"))
+	if err != nil {
+		return -1, fmt.Errorf("Failed to find the IOMMU group of %s: %v", bdf, err)
+	}
+	return strconv.Atoi(filepath.Base(link))
+}
+
+// IOMMUGroupDevices returns the sorted BDFs of the host PCI devices sharing
+// the IOMMU group of bdf, bdf included. They all have to be assigned to
+// the same guest.
+func IOMMUGroupDevices(bdf string) ([]string, error) {
+	dir := filepath.Join(sysfsPCIDevices, normalizeBDF(bdf), "iommu_group", "devices")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list the IOMMU group of %s: %v", bdf, err)
+	}
+
+	var devices []string
+	for _, entry := range entries {
+		devices = append(devices, entry.Name())
+	}
+	sort.Strings(devices)
+	return devices, nil
+}
+
+// isPCIBridge returns true if the host PCI device bdf is a PCI bridge,
+// which stays with the host when its IOMMU group is passed through.
+func isPCIBridge(bdf string) bool {
+	class, err := os.ReadFile(filepath.Join(sysfsPCIDevices, normalizeBDF(bdf), "class"))
+	return err == nil && strings.HasPrefix(strings.TrimSpace(string(class)), "0x0604")
+}
+
+// CheckVFIOBound returns an error if the host PCI device bdf is not bound
+// to the vfio-pci driver.
+func CheckVFIOBound(bdf string) error {
+	link, err := os.Readlink(filepath.Join(sysfsPCIDevices, normalizeBDF(bdf), "driver"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("PCI device %s is not bound to %s", bdf, VfioPCI)
+		}
+		return err
+	}
+	if driver := filepath.Base(link); driver != string(VfioPCI) {
+		return fmt.Errorf("PCI device %s is bound to %s instead of %s", bdf, driver, VfioPCI)
+	}
+	return nil
+}
+
+// VFIOGroupDevices returns the vfio-pci devices passing through the IOMMU
+// group of the host PCI device bdf, e.g., the VGA and audio functions of a
+// GPU. The functions of each host slot are placed in one multifunction
+// guest slot on bus, starting at slot and keeping their function number.
+// Every device but PCI bridges must be bound to vfio-pci. ROMFile and XVGA
+// may be set on the returned devices as needed.
+func VFIOGroupDevices(bdf string, bus string, slot int) ([]VFIODevice, error) {
+	group, err := IOMMUGroupDevices(bdf)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []VFIODevice
+	var errors []string
+	slots := map[string]int{}
+	functions := map[string]int{}
+	for _, dev := range group {
+		if isPCIBridge(dev) {
+			continue
+		}
+		if err := CheckVFIOBound(dev); err != nil {
+			errors = append(errors, err.Error())
+			continue
+		}
+
+		hostSlot, function, ok := strings.Cut(dev, ".")
+		if !ok {
+			errors = append(errors, fmt.Sprintf("Invalid PCI address %s", dev))
+			continue
+		}
+		guestSlot, ok := slots[hostSlot]
+		if !ok {
+			guestSlot = slot + len(slots)
+			slots[hostSlot] = guestSlot
+		}
+		functions[hostSlot]++
+
+		devices = append(devices, VFIODevice{
+			BDF:  dev,
+			Bus:  bus,
+			Addr: fmt.Sprintf("0x%x.0x%s", guestSlot, function),
+		})
+	}
+
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("Failed to pass through the IOMMU group of %s:\n%s", bdf, strings.Join(errors, "\n"))
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("IOMMU group of %s has no device to pass through", bdf)
+	}
+
+	for i := range devices {
+		hostSlot, function, _ := strings.Cut(devices[i].BDF, ".")
+		if function == "0" && functions[hostSlot] > 1 {
+			devices[i].Multifunction = true
+		}
+	}
+
+	return devices, nil
+}
@@ -1,6 +1,11 @@
 package qcli
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
 
 var (
 	deviceVFIOString           = "-device vfio-pci,host=02:10.0,x-pci-vendor-id=0x1234,x-pci-device-id=0x5678,romfile=efi-virtio.rom"
@@ -43,3 +48,152 @@ func TestAppendDeviceVFIOPCIe(t *testing.T) {
 	}
 	testAppend(vfioDevice, deviceVFIOPCIeFullString, t)
 }
+
+func TestAppendDeviceVFIOMultifunction(t *testing.T) {
+	vfioDevice := VFIODevice{
+		BDF:           "0000:01:00.0",
+		ROMFile:       "/usr/share/vgabios/gpu.rom",
+		XVGA:          true,
+		Bus:           "rp0",
+		Addr:          "0x0.0x0",
+		Multifunction: true,
+	}
+	testAppend(vfioDevice, "-device vfio-pci,host=0000:01:00.0,romfile=/usr/share/vgabios/gpu.rom,x-vga=on,bus=rp0,addr=0x0.0x0,multifunction=on", t)
+
+	config := Config{
+		VFIODevices: []VFIODevice{
+			{BDF: "0000:01:00.1", Bus: "rp0", Addr: "0x0.0x1"},
+		},
+	}
+	testConfig(&config, "-device vfio-pci,host=0000:01:00.1,bus=rp0,addr=0x0.0x1", t)
+
+	// the watchdog is appended first, its auto-allocated slot must not be
+	// the explicit slot 0x1e of the root bus vfio device
+	config = Config{
+		WatchdogDevices: []WatchdogDevice{{Model: WatchdogI6300ESB}},
+		VFIODevices: []VFIODevice{
+			{BDF: "0000:01:00.0", Addr: "0x1e.0x0", Multifunction: true},
+		},
+	}
+	testConfig(&config, "-device i6300esb,addr=0x1d -device vfio-pci,host=0000:01:00.0,addr=0x1e.0x0,multifunction=on", t)
+}
+
+// fakeSysfsPCI creates a sysfs PCI device tree in a temporary directory,
+// devices maps each BDF to its class, driver and IOMMU group
+func fakeSysfsPCI(t *testing.T, devices map[string][3]string) {
+	dir, err := os.MkdirTemp("", "qcli-sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	saved := sysfsPCIDevices
+	sysfsPCIDevices = filepath.Join(dir, "bus", "pci", "devices")
+	t.Cleanup(func() { sysfsPCIDevices = saved })
+
+	for bdf, dev := range devices {
+		class, driver, group := dev[0], dev[1], dev[2]
+		devDir := filepath.Join(dir, "devices", bdf)
+		groupDir := filepath.Join(dir, "kernel", "iommu_groups", group, "devices")
+		for _, d := range []string{devDir, groupDir, sysfsPCIDevices, filepath.Join(dir, "drivers", driver)} {
+			if err := os.MkdirAll(d, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(devDir, "class"), []byte(class+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		links := map[string]string{
+			filepath.Join(sysfsPCIDevices, bdf):  devDir,
+			filepath.Join(groupDir, bdf):         devDir,
+			filepath.Join(devDir, "iommu_group"): filepath.Dir(groupDir),
+		}
+		if driver != "" {
+			links[filepath.Join(devDir, "driver")] = filepath.Join(dir, "drivers", driver)
+		}
+		for link, target := range links {
+			if err := os.Symlink(target, link); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestVFIOGroupDevices(t *testing.T) {
+	fakeSysfsPCI(t, map[string][3]string{
+		"0000:00:01.0": {"0x060400", "pcieport", "1"},
+		"0000:01:00.0": {"0x030000", "vfio-pci", "1"},
+		"0000:01:00.1": {"0x040300", "vfio-pci", "1"},
+		"0000:02:00.0": {"0x020000", "vfio-pci", "2"},
+		"0000:03:00.0": {"0x010802", "nvme", "3"},
+	})
+
+	group, err := IOMMUGroup("01:00.1")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if group != 1 {
+		t.Errorf("Expected IOMMU group 1, found %d", group)
+	}
+
+	devices, err := VFIOGroupDevices("01:00.0", "rp0", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []VFIODevice{
+		{BDF: "0000:01:00.0", Bus: "rp0", Addr: "0x0.0x0", Multifunction: true},
+		{BDF: "0000:01:00.1", Bus: "rp0", Addr: "0x0.0x1"},
+	}
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("Expected %+v, found %+v", expected, devices)
+	}
+
+	devices, err = VFIOGroupDevices("0000:02:00.0", "pcie.0", 5)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(devices) != 1 || devices[0].Addr != "0x5.0x0" || devices[0].Multifunction {
+		t.Errorf("Unexpected single function passthrough %+v", devices)
+	}
+
+	if _, err := VFIOGroupDevices("03:00.0", "rp1", 0); err == nil {
+		t.Errorf("Expected error for a device bound to nvme")
+	}
+	if err := CheckVFIOBound("0000:00:01.0"); err == nil {
+		t.Errorf("Expected error for a bridge bound to pcieport")
+	}
+	if _, err := VFIOGroupDevices("04:00.0", "rp1", 0); err == nil {
+		t.Errorf("Expected error for a missing device")
+	}
+}
+
+func TestAppendDeviceVFIOMdev(t *testing.T) {
+	vfioDevice := VFIODevice{
+		SysfsDev: "4b20d080-1b54-4048-85b3-a6a62d165c01",
+		Display:  "on",
+		RAMFB:    true,
+	}
+	testAppend(vfioDevice, "-device vfio-pci,sysfsdev=/sys/bus/mdev/devices/4b20d080-1b54-4048-85b3-a6a62d165c01,display=on,ramfb=on", t)
+
+	vfioDevice = VFIODevice{
+		SysfsDev: "/sys/devices/pci0000:00/0000:00:02.0/4b20d080-1b54-4048-85b3-a6a62d165c01",
+		Display:  "off",
+		Bus:      "pcie.0",
+	}
+	testAppend(vfioDevice, "-device vfio-pci,sysfsdev=/sys/devices/pci0000:00/0000:00:02.0/4b20d080-1b54-4048-85b3-a6a62d165c01,display=off,bus=pcie.0", t)
+}
+
+func TestVFIODeviceValid(t *testing.T) {
+	for _, dev := range []VFIODevice{
+		{},
+		{BDF: "01:00.0", SysfsDev: "4b20d080-1b54-4048-85b3-a6a62d165c01"},
+		{SysfsDev: "4b20d080-1b54-4048-85b3-a6a62d165c01", Display: "yes"},
+		{SysfsDev: "4b20d080-1b54-4048-85b3-a6a62d165c01", RAMFB: true},
+		{BDF: "01:00.0", Addr: "0x20"},
+		{BDF: "01:00.0", Addr: "5:1"},
+	} {
+		if err := dev.Valid(); err == nil {
+			t.Errorf("Expected error for %+v", dev)
+		}
+	}
+}
@@ -33,23 +33,30 @@ import (
 // VhostUserDevice represents a qemu vhost-user device meant to be passed
 // in to the guest
 type VhostUserDevice struct {
-	SocketPath     string //path to vhostuser socket on host
-	CharDevID      string
-	TypeDevID      string //variable QEMU parameter based on value of VhostUserType
-	Address        string //used for MAC address in net case
-	Tag            string //virtio-fs volume id for mounting inside guest
-	CacheSize      uint32 //virtio-fs DAX cache size in MiB
-	SharedVersions bool   //enable virtio-fs shared version metadata
-	VhostUserType  DeviceDriver
+	SocketPath     string       `yaml:"socket-path"` //path to vhostuser socket on host
+	CharDevID      string       `yaml:"chardev-id"`
+	TypeDevID      string       `yaml:"type-dev-id"`     //variable QEMU parameter based on value of VhostUserType
+	Address        string       `yaml:"address"`         //used for MAC address in net case
+	Tag            string       `yaml:"tag"`             //virtio-fs volume id for mounting inside guest
+	CacheSize      uint32       `yaml:"cache-size"`      //virtio-fs DAX cache size in MiB
+	SharedVersions bool         `yaml:"shared-versions"` //enable virtio-fs shared version metadata
+	VhostUserType  DeviceDriver `yaml:"type"`
+
+	// VGA uses the vhost-user-vga device, a VhostUserGPU usable as the
+	// primary display by firmware and early boot
+	VGA bool `yaml:"vga"`
+
+	// MaxOutputs is the number of VhostUserGPU displays
+	MaxOutputs uint32 `yaml:"max-outputs"`
 
 	// ROMFile specifies the ROM file being used for this device.
-	ROMFile string
+	ROMFile string `yaml:"romfile"`
 
 	// DevNo identifies the CCW device for s390x.
-	DevNo string
+	DevNo string `yaml:"devno"`
 
 	// Transport is the virtio transport for this device.
-	Transport VirtioTransport
+	Transport VirtioTransport `yaml:"transport"`
 }
 
 // VhostUserNetTransport is a map of the virtio-net device name that
@@ -84,6 +91,12 @@ var VhostUserFSTransport = map[VirtioTransport]string{
 	TransportMMIO: "vhost-user-fs-device",
 }
 
+// VhostUserGPUTransport is a map of the vhost-user-gpu device name that
+// corresponds to each transport.
+var VhostUserGPUTransport = map[VirtioTransport]string{
+	TransportPCI: "vhost-user-gpu-pci",
+}
+
 // Valid returns true if there is a valid structure defined for VhostUserDevice
 func (vhostuserDev VhostUserDevice) Valid() error {
 
@@ -95,7 +108,7 @@ func (vhostuserDev VhostUserDevice) Valid() error {
 	}
 
 	switch vhostuserDev.VhostUserType {
-	case VhostUserNet, VhostUserSCSI, VhostUserBlk, VhostUserFS:
+	case VhostUserNet, VhostUserSCSI, VhostUserBlk, VhostUserFS, VhostUserGPU:
 		break
 	default:
 		return fmt.Errorf("VhostUserDevice has unknown VhostUserType: %s", vhostuserDev.VhostUserType)
@@ -108,6 +121,9 @@ func (vhostuserDev VhostUserDevice) Valid() error {
 		if vhostuserDev.Address == "" {
 			return fmt.Errorf("VhostUserDevice Type=VhostUserNet has empty Address field")
 		}
+		if err := validMACAddress(vhostuserDev.Address); err != nil {
+			return fmt.Errorf("VhostUserDevice Type=VhostUserNet has %s", err)
+		}
 	}
 	if vhostuserDev.VhostUserType == VhostUserSCSI {
 		if vhostuserDev.TypeDevID == "" {
@@ -119,6 +135,13 @@ func (vhostuserDev VhostUserDevice) Valid() error {
 			return fmt.Errorf("VhostUserDevice Type=VhostUserFS has empty Tag field")
 		}
 	}
+	if vhostuserDev.VhostUserType == VhostUserGPU {
+		if vhostuserDev.Transport != "" && vhostuserDev.Transport != TransportPCI {
+			return fmt.Errorf("VhostUserDevice Type=VhostUserGPU Transport=%s not supported, only %s", vhostuserDev.Transport, TransportPCI)
+		}
+	} else if vhostuserDev.VGA || vhostuserDev.MaxOutputs > 0 {
+		return fmt.Errorf("VhostUserDevice Type=%s does not support VGA or MaxOutputs", vhostuserDev.VhostUserType)
+	}
 
 	return nil
 }
@@ -227,7 +250,7 @@ func (vhostuserDev VhostUserDevice) QemuFSParams(config *Config) []string {
 		if config.Knobs.IOMMUPlatform {
 			deviceParams = append(deviceParams, "iommu_platform=on")
 		}
-		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", vhostuserDev.DevNo))
+		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(vhostuserDev.DevNo)))
 	}
 	if vhostuserDev.Transport.isVirtioPCI(config) && vhostuserDev.ROMFile != "" {
 		deviceParams = append(deviceParams, fmt.Sprintf("romfile=%s", vhostuserDev.ROMFile))
@@ -239,6 +262,34 @@ func (vhostuserDev VhostUserDevice) QemuFSParams(config *Config) []string {
 	return qemuParams
 }
 
+// QemuGPUParams builds QEMU device parameters for a VhostUserGPU device
+func (vhostuserDev VhostUserDevice) QemuGPUParams(config *Config) []string {
+	var qemuParams []string
+	var deviceParams []string
+
+	driver := vhostuserDev.deviceName(config)
+	if driver == "" {
+		return nil
+	}
+
+	deviceParams = append(deviceParams, driver)
+	if vhostuserDev.TypeDevID != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("id=%s", vhostuserDev.TypeDevID))
+	}
+	deviceParams = append(deviceParams, fmt.Sprintf("chardev=%s", vhostuserDev.CharDevID))
+	if vhostuserDev.MaxOutputs > 0 {
+		deviceParams = append(deviceParams, fmt.Sprintf("max_outputs=%d", vhostuserDev.MaxOutputs))
+	}
+	if vhostuserDev.ROMFile != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("romfile=%s", vhostuserDev.ROMFile))
+	}
+
+	qemuParams = append(qemuParams, "-device")
+	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+
+	return qemuParams
+}
+
 // QemuParams returns the qemu parameters built out of this vhostuser device.
 func (vhostuserDev VhostUserDevice) QemuParams(config *Config) []string {
 	var qemuParams []string
@@ -261,6 +312,8 @@ func (vhostuserDev VhostUserDevice) QemuParams(config *Config) []string {
 		deviceParams = vhostuserDev.QemuBlkParams(config)
 	case VhostUserFS:
 		deviceParams = vhostuserDev.QemuFSParams(config)
+	case VhostUserGPU:
+		deviceParams = vhostuserDev.QemuGPUParams(config)
 	default:
 		return nil
 	}
@@ -288,7 +341,33 @@ func (vhostuserDev VhostUserDevice) deviceName(config *Config) string {
 		return VhostUserBlkTransport[vhostuserDev.Transport]
 	case VhostUserFS:
 		return VhostUserFSTransport[vhostuserDev.Transport]
+	case VhostUserGPU:
+		if vhostuserDev.VGA && vhostuserDev.Transport == TransportPCI {
+			return string(VhostUserVGA)
+		}
+		return VhostUserGPUTransport[vhostuserDev.Transport]
 	default:
 		return ""
 	}
 }
+
+// validateVhostUserGPU checks the guest memory can be mapped by the
+// vhost-user-gpu process and that a GL display shows what it renders.
+func (config *Config) validateVhostUserGPU() error {
+	for _, dev := range config.VhostUserDevices {
+		if dev.VhostUserType != VhostUserGPU {
+			continue
+		}
+
+		if !config.Knobs.MemShared {
+			return fmt.Errorf("VhostUserDevice Type=VhostUserGPU requires Knobs.MemShared")
+		}
+
+		gl := config.Display.Type == DisplayEGLHeadless || config.Display.GL == "on" || config.SpiceDevice.GL
+		if !gl {
+			return fmt.Errorf("VhostUserDevice Type=VhostUserGPU requires a GL Display or SpiceDevice")
+		}
+	}
+
+	return nil
+}
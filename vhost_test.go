@@ -5,6 +5,8 @@ import "testing"
 var (
 	deviceVhostUserNetString  = "-chardev socket,id=char1,path=/tmp/nonexistentsocket.socket -netdev type=vhost-user,id=net1,chardev=char1,vhostforce -device virtio-net-pci,netdev=net1,mac=00:11:22:33:44:55,romfile=efi-virtio.rom"
 	deviceVhostUserSCSIString = "-chardev socket,id=char1,path=/tmp/nonexistentsocket.socket -device vhost-user-scsi-pci,id=scsi1,chardev=char1,romfile=efi-virtio.rom"
+	deviceVhostUserGPUString  = "-chardev socket,id=char3,path=/run/vhost-user-gpu.sock -device vhost-user-gpu-pci,id=gpu0,chardev=char3,max_outputs=2"
+	deviceVhostUserVGAString  = "-chardev socket,id=char3,path=/run/vhost-user-gpu.sock -device vhost-user-vga,chardev=char3"
 	deviceVhostUserBlkString  = "-chardev socket,id=char2,path=/tmp/nonexistentsocket.socket -device vhost-user-blk-pci,logical_block_size=4096,size=512M,chardev=char2,romfile=efi-virtio.rom"
 )
 
@@ -39,4 +41,61 @@ func TestAppendDeviceVhostUser(t *testing.T) {
 		ROMFile:       romfile,
 	}
 	testAppend(vhostuserNetDevice, deviceVhostUserNetString, t)
+
+	vhostuserNetDevice.Address = "ff:ff:ff:ff:ff:ff"
+	if err := vhostuserNetDevice.Valid(); err == nil {
+		t.Errorf("Expected error for a broadcast Address")
+	}
+}
+
+func TestAppendDeviceVhostUserGPU(t *testing.T) {
+	gpu := VhostUserDevice{
+		SocketPath:    "/run/vhost-user-gpu.sock",
+		CharDevID:     "char3",
+		TypeDevID:     "gpu0",
+		VhostUserType: VhostUserGPU,
+		MaxOutputs:    2,
+	}
+	if gpu.Transport.isVirtioCCW(nil) {
+		t.Skip("vhost-user-gpu is a pci device")
+	}
+	testAppend(gpu, deviceVhostUserGPUString, t)
+
+	vga := VhostUserDevice{
+		SocketPath:    "/run/vhost-user-gpu.sock",
+		CharDevID:     "char3",
+		VhostUserType: VhostUserGPU,
+		VGA:           true,
+	}
+	testAppend(vga, deviceVhostUserVGAString, t)
+
+	bad := []VhostUserDevice{
+		{SocketPath: "/run/gpu.sock", CharDevID: "char3", VhostUserType: VhostUserGPU, Transport: TransportMMIO},
+		{SocketPath: "/run/blk.sock", CharDevID: "char3", VhostUserType: VhostUserBlk, VGA: true},
+	}
+	for _, dev := range bad {
+		if err := dev.Valid(); err == nil {
+			t.Errorf("Expected error for invalid VhostUserDevice %+v", dev)
+		}
+	}
+
+	configs := []*Config{
+		{Display: Display{Type: DisplayEGLHeadless}},
+		{Knobs: Knobs{MemShared: true}, Display: Display{Type: DisplayGTK}},
+	}
+	for _, c := range configs {
+		c.VhostUserDevices = []VhostUserDevice{gpu}
+		if err := c.validateVhostUserGPU(); err == nil {
+			t.Errorf("Expected error for invalid vhost-user-gpu config %+v", c)
+		}
+	}
+
+	c := &Config{
+		Knobs:            Knobs{MemShared: true},
+		Display:          Display{Type: DisplayGTK, GL: "on"},
+		VhostUserDevices: []VhostUserDevice{gpu},
+	}
+	if err := c.validateVhostUserGPU(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
 }
@@ -0,0 +1,288 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// VirtiofsdPath is the virtiofsd binary used by StartVirtiofsd, the
+	// rust implementation is expected
+	VirtiofsdPath = "virtiofsd"
+
+	// VirtiofsdSocketTimeout is how long StartVirtiofsd waits for the
+	// virtiofsd vhost-user socket to appear
+	VirtiofsdSocketTimeout = 10 * time.Second
+)
+
+// VirtiofsdCache is the virtiofsd guest cache policy.
+type VirtiofsdCache string
+
+const (
+	// VirtiofsdCacheAuto lets the guest cache data and metadata for a
+	// short time
+	VirtiofsdCacheAuto VirtiofsdCache = "auto"
+
+	// VirtiofsdCacheAlways lets the guest cache data and metadata, the
+	// shared dir must not be modified by the host
+	VirtiofsdCacheAlways VirtiofsdCache = "always"
+
+	// VirtiofsdCacheNever disables the guest cache
+	VirtiofsdCacheNever VirtiofsdCache = "never"
+
+	// VirtiofsdCacheMetadata lets the guest cache metadata only
+	VirtiofsdCacheMetadata VirtiofsdCache = "metadata"
+)
+
+// VirtiofsdSandbox is how virtiofsd confines itself to the shared dir.
+type VirtiofsdSandbox string
+
+const (
+	// VirtiofsdSandboxNamespace uses mount, pid and network namespaces,
+	// it requires root or user namespaces
+	VirtiofsdSandboxNamespace VirtiofsdSandbox = "namespace"
+
+	// VirtiofsdSandboxChroot chroots into the shared dir, it requires root
+	VirtiofsdSandboxChroot VirtiofsdSandbox = "chroot"
+
+	// VirtiofsdSandboxNone does not sandbox virtiofsd, for unprivileged
+	// users without user namespaces
+	VirtiofsdSandboxNone VirtiofsdSandbox = "none"
+)
+
+// virtiofsdTagRegexp matches the characters allowed in a VirtiofsdOptions
+// Tag.
+var virtiofsdTagRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// virtiofsTagMaxLen is the maximum length of a virtio-fs tag in qemu.
+const virtiofsTagMaxLen = 36
+
+const (
+	// VirtiofsdStateDirName is the virtiofsd directory under
+	// Config.StateDir holding the sockets
+	VirtiofsdStateDirName = "virtiofsd"
+)
+
+// VirtiofsdOptions are the settings of a virtio-fs share started with
+// StartVirtiofsd.
+type VirtiofsdOptions struct {
+	// SharedDir is the host directory exported to the guest
+	SharedDir string
+
+	// Tag is the mount tag of the share in the guest
+	Tag string
+
+	// Cache is the guest cache policy, virtiofsd's default when empty
+	Cache VirtiofsdCache
+
+	// Sandbox is the virtiofsd sandbox, virtiofsd's default when empty
+	Sandbox VirtiofsdSandbox
+
+	// XAttr enables extended attributes support
+	XAttr bool
+
+	// ThreadPoolSize is the number of virtiofsd worker threads,
+	// virtiofsd's default when 0
+	ThreadPoolSize uint32
+
+	// CacheSize is the DAX cache size in MiB of the vhost-user-fs device
+	CacheSize uint32
+}
+
+// Valid returns an error if the VirtiofsdOptions are not usable.
+func (opts VirtiofsdOptions) Valid() error {
+	if opts.SharedDir == "" {
+		return fmt.Errorf("VirtiofsdOptions has empty SharedDir field")
+	}
+	if opts.Tag == "" {
+		return fmt.Errorf("VirtiofsdOptions has empty Tag field")
+	}
+	// the Tag names the socket under the virtiofsd state dir
+	if !virtiofsdTagRegexp.MatchString(opts.Tag) || strings.Contains(opts.Tag, "..") {
+		return fmt.Errorf("Invalid VirtiofsdOptions.Tag value: '%s', must only contain letters, digits, '_', '.' and '-'", opts.Tag)
+	}
+	if len(opts.Tag) > virtiofsTagMaxLen {
+		return fmt.Errorf("Invalid VirtiofsdOptions.Tag value: '%s', must be at most %d bytes", opts.Tag, virtiofsTagMaxLen)
+	}
+
+	switch opts.Cache {
+	case "", VirtiofsdCacheAuto, VirtiofsdCacheAlways, VirtiofsdCacheNever, VirtiofsdCacheMetadata:
+	default:
+		return fmt.Errorf("Invalid VirtiofsdOptions.Cache value: '%s', must be one of '%s', '%s', '%s', '%s'",
+			opts.Cache, VirtiofsdCacheAuto, VirtiofsdCacheAlways, VirtiofsdCacheNever, VirtiofsdCacheMetadata)
+	}
+
+	switch opts.Sandbox {
+	case "", VirtiofsdSandboxNamespace, VirtiofsdSandboxChroot, VirtiofsdSandboxNone:
+	default:
+		return fmt.Errorf("Invalid VirtiofsdOptions.Sandbox value: '%s', must be one of '%s', '%s', '%s'",
+			opts.Sandbox, VirtiofsdSandboxNamespace, VirtiofsdSandboxChroot, VirtiofsdSandboxNone)
+	}
+
+	return nil
+}
+
+func (opts VirtiofsdOptions) args(socket string) []string {
+	args := []string{
+		fmt.Sprintf("--socket-path=%s", socket),
+		fmt.Sprintf("--shared-dir=%s", opts.SharedDir),
+	}
+	if opts.Cache != "" {
+		args = append(args, fmt.Sprintf("--cache=%s", opts.Cache))
+	}
+	if opts.Sandbox != "" {
+		args = append(args, fmt.Sprintf("--sandbox=%s", opts.Sandbox))
+	}
+	if opts.XAttr {
+		args = append(args, "--xattr")
+	}
+	if opts.ThreadPoolSize > 0 {
+		args = append(args, fmt.Sprintf("--thread-pool-size=%d", opts.ThreadPoolSize))
+	}
+	return args
+}
+
+// Virtiofsd is a running virtiofsd process backing a VhostUserFS device.
+type Virtiofsd struct {
+	// SharedDir is the host directory exported to the guest
+	SharedDir string
+
+	// Tag is the mount tag of the share in the guest
+	Tag string
+
+	// SocketPath is the vhost-user socket qemu connects to
+	SocketPath string
+
+	opts VirtiofsdOptions
+	cmd  *exec.Cmd
+	done chan error
+}
+
+// StartVirtiofsd launches a virtiofsd exporting opts.SharedDir with its
+// socket under Config.StateDir, waits for the socket and adds a VhostUserFS
+// device using it to the Config. The guest memory is made shared so that
+// virtiofsd can map it. virtiofsd is stopped by Config.Cleanup, i.e. when
+// LaunchQemu returns, a VMSupervisor starts it again for each restart. The
+// socket path is returned.
+func StartVirtiofsd(config *Config, opts VirtiofsdOptions) (string, error) {
+	if err := opts.Valid(); err != nil {
+		return "", err
+	}
+	if config.StateDir == "" {
+		return "", fmt.Errorf("Config.StateDir is required to start virtiofsd")
+	}
+	for _, dev := range config.VhostUserDevices {
+		if dev.VhostUserType == VhostUserFS && dev.Tag == opts.Tag {
+			return "", fmt.Errorf("VhostUserDevice with Tag=%s already exists", opts.Tag)
+		}
+	}
+
+	ctx := config.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	stateDir := filepath.Join(config.StateDir, VirtiofsdStateDirName)
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return "", fmt.Errorf("Failed to create virtiofsd state dir %s: %s", stateDir, err)
+	}
+
+	virtiofsd, err := startVirtiofsd(ctx, opts, filepath.Join(stateDir, opts.Tag+".sock"))
+	if err != nil {
+		return "", err
+	}
+
+	config.virtiofsds = append(config.virtiofsds, virtiofsd)
+	config.VhostUserDevices = append(config.VhostUserDevices, VhostUserDevice{
+		SocketPath:    virtiofsd.SocketPath,
+		CharDevID:     "char-fs-" + opts.Tag,
+		Tag:           opts.Tag,
+		CacheSize:     opts.CacheSize,
+		VhostUserType: VhostUserFS,
+	})
+	config.Knobs.MemShared = true
+
+	return virtiofsd.SocketPath, nil
+}
+
+// startVirtiofsd launches virtiofsd for opts listening on socket and waits
+// for the socket.
+func startVirtiofsd(ctx context.Context, opts VirtiofsdOptions, socket string) (*Virtiofsd, error) {
+	virtiofsd := &Virtiofsd{
+		SharedDir:  opts.SharedDir,
+		Tag:        opts.Tag,
+		SocketPath: socket,
+		opts:       opts,
+		done:       make(chan error, 1),
+	}
+
+	// a stale socket would be mistaken for the new one
+	if err := os.Remove(virtiofsd.SocketPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Failed to remove stale virtiofsd socket %s: %s", virtiofsd.SocketPath, err)
+	}
+
+	/* #nosec */
+	virtiofsd.cmd = exec.CommandContext(ctx, VirtiofsdPath, opts.args(virtiofsd.SocketPath)...)
+	if err := virtiofsd.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Failed to start %s: %s", VirtiofsdPath, err)
+	}
+	go func() {
+		virtiofsd.done <- virtiofsd.cmd.Wait()
+	}()
+
+	if err := waitForHelperSocket(VirtiofsdPath, "virtiofsd", virtiofsd.SocketPath, virtiofsd.done, VirtiofsdSocketTimeout); err != nil {
+		virtiofsd.Stop()
+		return nil, err
+	}
+
+	return virtiofsd, nil
+}
+
+// Stop kills the virtiofsd process, if still running, and removes its
+// socket. virtiofsd exits on its own once qemu disconnects.
+func (virtiofsd *Virtiofsd) Stop() error {
+	select {
+	case <-virtiofsd.done:
+	default:
+		if err := virtiofsd.cmd.Process.Kill(); err != nil {
+			return fmt.Errorf("Failed to stop %s: %s", VirtiofsdPath, err)
+		}
+		<-virtiofsd.done
+	}
+
+	if err := os.Remove(virtiofsd.SocketPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
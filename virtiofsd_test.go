@@ -0,0 +1,97 @@
+package qcli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fakeVirtiofsd(t *testing.T, body string) {
+	fakeDaemon(t, &VirtiofsdPath, &VirtiofsdSocketTimeout, body)
+}
+
+func TestStartVirtiofsd(t *testing.T) {
+	// record the args, then create the socket given as --socket-path=<socket>
+	fakeVirtiofsd(t, "echo \"$@\" > \"${1#--socket-path=}.args\"\ntouch \"${1#--socket-path=}\"\nexec sleep 60\n")
+
+	c := &Config{StateDir: t.TempDir()}
+	opts := VirtiofsdOptions{
+		SharedDir:      "/srv/share",
+		Tag:            "share",
+		Cache:          VirtiofsdCacheNever,
+		Sandbox:        VirtiofsdSandboxNone,
+		XAttr:          true,
+		ThreadPoolSize: 4,
+	}
+	socket, err := StartVirtiofsd(c, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if expected := filepath.Join(c.StateDir, VirtiofsdStateDirName, "share.sock"); socket != expected {
+		t.Errorf("Expected socket %s, found %s", expected, socket)
+	}
+
+	args, _ := os.ReadFile(socket + ".args")
+	expected := fmt.Sprintf("--socket-path=%s --shared-dir=/srv/share --cache=never --sandbox=none --xattr --thread-pool-size=4", socket)
+	if strings.TrimSpace(string(args)) != expected {
+		t.Errorf("Expected virtiofsd args\n%s\nfound\n%s", expected, args)
+	}
+
+	expectedDev := VhostUserDevice{SocketPath: socket, CharDevID: "char-fs-share", Tag: "share", VhostUserType: VhostUserFS}
+	if len(c.VhostUserDevices) != 1 || c.VhostUserDevices[0] != expectedDev {
+		t.Errorf("Expected VhostUserDevices [%+v], found %+v", expectedDev, c.VhostUserDevices)
+	}
+	if !c.Knobs.MemShared {
+		t.Errorf("Expected Knobs.MemShared to be set")
+	}
+
+	if _, err := StartVirtiofsd(c, opts); err == nil {
+		t.Errorf("Expected error starting virtiofsd twice for the same Tag")
+	}
+
+	if err := c.Cleanup(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if PathExists(socket) {
+		t.Errorf("Expected socket %s to be removed by Cleanup", socket)
+	}
+}
+
+func TestBadStartVirtiofsd(t *testing.T) {
+	fakeVirtiofsd(t, "exit 1\n")
+
+	opts := VirtiofsdOptions{SharedDir: "/srv/share", Tag: "share"}
+	if _, err := StartVirtiofsd(&Config{}, opts); err == nil {
+		t.Errorf("Expected error without StateDir")
+	}
+
+	c := &Config{StateDir: t.TempDir()}
+	for _, bad := range []VirtiofsdOptions{
+		{Tag: "share"},
+		{SharedDir: "/srv/share"},
+		{SharedDir: "/srv/share", Tag: "share", Cache: "sometimes"},
+		{SharedDir: "/srv/share", Tag: "share", Sandbox: "jail"},
+		{SharedDir: "/srv/share", Tag: "../share"},
+		{SharedDir: "/srv/share", Tag: "sub/share"},
+		{SharedDir: "/srv/share", Tag: "share..1"},
+		{SharedDir: "/srv/share", Tag: strings.Repeat("s", 37)},
+	} {
+		if _, err := StartVirtiofsd(c, bad); err == nil {
+			t.Errorf("Expected error for %+v", bad)
+		}
+	}
+
+	if err := (VirtiofsdOptions{SharedDir: "/srv/share", Tag: "vm-1_share." + strings.Repeat("s", 25)}).Valid(); err != nil {
+		t.Errorf("Unexpected error for a 36 bytes Tag: %s", err)
+	}
+
+	if _, err := StartVirtiofsd(c, opts); err == nil {
+		t.Errorf("Expected error when virtiofsd exits")
+	}
+	if len(c.VhostUserDevices) != 0 {
+		t.Errorf("Expected no VhostUserDevices, found %+v", c.VhostUserDevices)
+	}
+}
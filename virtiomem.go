@@ -0,0 +1,214 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VirtioMemDevice represents a virtio-mem device, it hot(un)plugs guest
+// memory in BlockSize granularity from its memory backend.
+type VirtioMemDevice struct {
+	// ID is the device ID, used to resize it at runtime
+	ID string `yaml:"id"`
+
+	// MemDev is the ID of the memory backend object created for the device
+	MemDev string `yaml:"memdev"`
+
+	// Size is the memory backend size, the maximum memory the device can
+	// provide to the guest, e.g. 8G
+	Size string `yaml:"size"`
+
+	// MemPath backs the memory with a file instead of anonymous memory
+	MemPath string `yaml:"mem-path"`
+
+	// RequestedSize is the memory initially plugged into the guest
+	RequestedSize string `yaml:"requested-size"`
+
+	// BlockSize is the hot(un)plug granularity
+	BlockSize string `yaml:"block-size"`
+
+	// Node is the guest NUMA node the memory is assigned to
+	Node *int `yaml:"node"`
+
+	// Bus is the bus path name of the device
+	Bus string `yaml:"bus"`
+
+	// Addr is the PCI address of the device
+	Addr string `yaml:"address"`
+
+	// Transport is the virtio transport for this device, only pci is
+	// supported.
+	Transport VirtioTransport `yaml:"transport"`
+}
+
+// Valid returns an error if the VirtioMemDevice structure is not valid and
+// complete.
+func (vmem VirtioMemDevice) Valid() error {
+	if vmem.ID == "" {
+		return fmt.Errorf("VirtioMemDevice has empty ID field")
+	}
+
+	if vmem.MemDev == "" {
+		return fmt.Errorf("VirtioMemDevice ID=%s has empty MemDev field", vmem.ID)
+	}
+
+	if vmem.Transport != "" && vmem.Transport != TransportPCI {
+		return fmt.Errorf("VirtioMemDevice ID=%s Transport=%s not supported, only %s", vmem.ID, vmem.Transport, TransportPCI)
+	}
+
+	size, err := ParseMemorySize(vmem.Size)
+	if err != nil {
+		return fmt.Errorf("VirtioMemDevice ID=%s invalid Size: %v", vmem.ID, err)
+	}
+
+	if vmem.RequestedSize != "" {
+		requested, err := ParseMemorySize(vmem.RequestedSize)
+		if err != nil {
+			return fmt.Errorf("VirtioMemDevice ID=%s invalid RequestedSize: %v", vmem.ID, err)
+		}
+		if requested > size {
+			return fmt.Errorf("VirtioMemDevice ID=%s RequestedSize %s larger than Size %s", vmem.ID, vmem.RequestedSize, vmem.Size)
+		}
+	}
+
+	if vmem.BlockSize != "" {
+		block, err := ParseMemorySize(vmem.BlockSize)
+		if err != nil {
+			return fmt.Errorf("VirtioMemDevice ID=%s invalid BlockSize: %v", vmem.ID, err)
+		}
+		if block == 0 || block&(block-1) != 0 || size%block != 0 {
+			return fmt.Errorf("VirtioMemDevice ID=%s BlockSize %s must be a power of 2 dividing Size %s", vmem.ID, vmem.BlockSize, vmem.Size)
+		}
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the VirtioMemDevice.
+func (vmem VirtioMemDevice) QemuParams(config *Config) []string {
+	var objectParams []string
+	var deviceParams []string
+	var qemuParams []string
+
+	if vmem.MemPath != "" {
+		objectParams = append(objectParams, string(MemoryBackendFile))
+	} else {
+		objectParams = append(objectParams, "memory-backend-ram")
+	}
+	objectParams = append(objectParams, fmt.Sprintf("id=%s", vmem.MemDev))
+	objectParams = append(objectParams, fmt.Sprintf("size=%s", vmem.Size))
+	if vmem.MemPath != "" {
+		objectParams = append(objectParams, fmt.Sprintf("mem-path=%s", vmem.MemPath))
+	}
+
+	deviceParams = append(deviceParams, string(VirtioMemPCI))
+	deviceParams = append(deviceParams, fmt.Sprintf("id=%s", vmem.ID))
+	deviceParams = append(deviceParams, fmt.Sprintf("memdev=%s", vmem.MemDev))
+	if vmem.RequestedSize != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("requested-size=%s", vmem.RequestedSize))
+	}
+	if vmem.BlockSize != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("block-size=%s", vmem.BlockSize))
+	}
+	if vmem.Node != nil {
+		deviceParams = append(deviceParams, fmt.Sprintf("node=%d", *vmem.Node))
+	}
+	if vmem.Bus != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", vmem.Bus))
+	}
+	addr := config.pciBusSlots.GetSlot(vmem.Addr)
+	if addr > 0 {
+		deviceParams = append(deviceParams, fmt.Sprintf("addr=0x%02x", addr))
+	}
+
+	qemuParams = append(qemuParams, "-object")
+	qemuParams = append(qemuParams, strings.Join(objectParams, ","))
+	qemuParams = append(qemuParams, "-device")
+	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+
+	return qemuParams
+}
+
+// validateDeviceMemory checks the machine and memory configuration
+// supports the virtio-mem, nvdimm and virtio-pmem devices: a pci machine,
+// enough memory slots for the nvdimms and a maxmem large enough for the
+// boot memory plus the memory of all these devices.
+func (config *Config) validateDeviceMemory() error {
+	if len(config.VirtioMemDevices) == 0 && len(config.NVDIMMDevices) == 0 && len(config.VirtioPmemDevices) == 0 {
+		return nil
+	}
+
+	if config.Machine.Type == MachineTypeMicrovm {
+		return fmt.Errorf("VirtioMemDevices, NVDIMMDevices and VirtioPmemDevices are not supported by machine type %s", config.Machine.Type)
+	}
+
+	if len(config.NVDIMMDevices) > 0 {
+		if config.Machine.NVDIMM != "on" {
+			return fmt.Errorf("NVDIMMDevices require Machine.NVDIMM on")
+		}
+		if len(config.NVDIMMDevices) > int(config.Memory.Slots) {
+			return fmt.Errorf("%d NVDIMMDevices need as many Memory.Slots, found %d", len(config.NVDIMMDevices), config.Memory.Slots)
+		}
+	}
+
+	if config.Memory.MaxMem == "" {
+		return fmt.Errorf("VirtioMemDevices, NVDIMMDevices and VirtioPmemDevices require Memory.MaxMem")
+	}
+
+	maxMem, err := ParseMemorySize(config.Memory.MaxMem)
+	if err != nil {
+		return fmt.Errorf("Invalid Memory.MaxMem: %v", err)
+	}
+
+	total, err := ParseMemorySize(config.Memory.Size)
+	if err != nil {
+		return fmt.Errorf("Invalid Memory.Size: %v", err)
+	}
+
+	// invalid sizes are reported by the devices Valid
+	var sizes []string
+	for _, vmem := range config.VirtioMemDevices {
+		sizes = append(sizes, vmem.Size)
+	}
+	for _, nvdimm := range config.NVDIMMDevices {
+		sizes = append(sizes, nvdimm.Size)
+	}
+	for _, pmem := range config.VirtioPmemDevices {
+		sizes = append(sizes, pmem.Size)
+	}
+	for _, s := range sizes {
+		if size, err := ParseMemorySize(s); err == nil {
+			total += size
+		}
+	}
+
+	if total > maxMem {
+		return fmt.Errorf("Memory.Size plus the device memory sizes exceed Memory.MaxMem %s", config.Memory.MaxMem)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package qcli
+
+import "testing"
+
+var (
+	deviceVirtioMemString = "-object memory-backend-ram,id=vmem0-mem,size=8G -device virtio-mem-pci,id=vmem0,memdev=vmem0-mem,requested-size=1G,block-size=2M,node=0,addr=0x1e"
+	virtioMemConfigString = "-m 4G,maxmem=12G -object memory-backend-file,id=vmem0-mem,size=8G,mem-path=/dev/hugepages -device virtio-mem-pci,id=vmem0,memdev=vmem0-mem,addr=0x1e -object memory-backend-ram,id=dimm1,size=4G -numa node,memdev=dimm1"
+)
+
+func TestAppendVirtioMemDevice(t *testing.T) {
+	node := 0
+	vmem := VirtioMemDevice{
+		ID:            "vmem0",
+		MemDev:        "vmem0-mem",
+		Size:          "8G",
+		RequestedSize: "1G",
+		BlockSize:     "2M",
+		Node:          &node,
+	}
+	testAppend(vmem, deviceVirtioMemString, t)
+}
+
+func TestAppendConfigVirtioMemDevices(t *testing.T) {
+	c := &Config{
+		Memory: Memory{
+			Size:   "4G",
+			MaxMem: "12G",
+		},
+		VirtioMemDevices: []VirtioMemDevice{
+			{
+				ID:      "vmem0",
+				MemDev:  "vmem0-mem",
+				Size:    "8G",
+				MemPath: "/dev/hugepages",
+			},
+		},
+	}
+	testConfig(c, virtioMemConfigString, t)
+}
+
+func TestBadVirtioMemDevice(t *testing.T) {
+	devices := []VirtioMemDevice{
+		{MemDev: "mem0", Size: "8G"},
+		{ID: "vmem0", Size: "8G"},
+		{ID: "vmem0", MemDev: "mem0"},
+		{ID: "vmem0", MemDev: "mem0", Size: "8X"},
+		{ID: "vmem0", MemDev: "mem0", Size: "8G", Transport: TransportCCW},
+		{ID: "vmem0", MemDev: "mem0", Size: "8G", RequestedSize: "16G"},
+		{ID: "vmem0", MemDev: "mem0", Size: "8G", BlockSize: "3M"},
+	}
+	for _, d := range devices {
+		if err := d.Valid(); err == nil {
+			t.Errorf("Expected error for invalid VirtioMemDevice %+v", d)
+		}
+	}
+
+	vmem := VirtioMemDevice{ID: "vmem0", MemDev: "mem0", Size: "8G"}
+	configs := []*Config{
+		{Memory: Memory{Size: "4G"}},
+		{Memory: Memory{Size: "4G", MaxMem: "8G"}},
+		{Machine: Machine{Type: MachineTypeMicrovm}, Memory: Memory{Size: "4G", MaxMem: "16G"}},
+	}
+	for _, c := range configs {
+		c.VirtioMemDevices = []VirtioMemDevice{vmem}
+		if err := c.validateDeviceMemory(); err == nil {
+			t.Errorf("Expected error for invalid virtio-mem config %+v", c)
+		}
+	}
+}
+
+func TestParseMemorySize(t *testing.T) {
+	sizes := map[string]uint64{
+		"512":  512 << 20,
+		"512M": 512 << 20,
+		"4G":   4 << 30,
+		"2m":   2 << 20,
+		"1T":   1 << 40,
+		"64K":  64 << 10,
+		"100B": 100,
+	}
+	for size, expected := range sizes {
+		val, err := ParseMemorySize(size)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %s", size, err)
+		} else if val != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, size, val)
+		}
+	}
+
+	for _, size := range []string{"", "G", "4X", "-1G", "99999999999T"} {
+		if _, err := ParseMemorySize(size); err == nil {
+			t.Errorf("Expected error for invalid size %s", size)
+		}
+	}
+}
@@ -33,24 +33,24 @@ import (
 
 // VSOCKDevice represents a AF_VSOCK socket.
 type VSOCKDevice struct {
-	ID string
+	ID string `yaml:"id"`
 
-	ContextID uint64
+	ContextID uint64 `yaml:"context-id"`
 
 	// VHostFD vhost file descriptor that holds the ContextID
-	VHostFD *os.File
+	VHostFD *os.File `yaml:"-"`
 
 	// DisableModern prevents qemu from relying on fast MMIO.
-	DisableModern bool
+	DisableModern bool `yaml:"disable-modern"`
 
 	// ROMFile specifies the ROM file being used for this device.
-	ROMFile string
+	ROMFile string `yaml:"romfile"`
 
 	// DevNo identifies the ccw devices for s390x architecture
-	DevNo string
+	DevNo string `yaml:"devno"`
 
 	// Transport is the virtio transport for this device.
-	Transport VirtioTransport
+	Transport VirtioTransport `yaml:"transport"`
 }
 
 // VSOCKDeviceTransport is a map of the vhost-vsock device name that
@@ -114,7 +114,7 @@ func (vsock VSOCKDevice) QemuParams(config *Config) []string {
 		if config.Knobs.IOMMUPlatform {
 			deviceParams = append(deviceParams, "iommu_platform=on")
 		}
-		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", vsock.DevNo))
+		deviceParams = append(deviceParams, fmt.Sprintf("devno=%s", config.ccwBus.GetDevNo(vsock.DevNo)))
 	}
 
 	qemuParams = append(qemuParams, "-device")
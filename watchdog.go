@@ -0,0 +1,162 @@
+/*
+// Copyright contributors to the Virtual Machine Manager for Go project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package qemu provides methods and types for launching and managing QEMU
+// instances.  Instances can be launched with the LaunchQemu function and
+// managed thereafter via QMPStart and the QMP object that this function
+// returns.  To manage a qemu instance after it has been launched you need
+// to pass the -qmp option during launch requesting the qemu instance to create
+// a QMP unix domain manageent socket, e.g.,
+// -qmp unix:/tmp/qmp-socket,server,nowait.  For more information see the
+// example below.
+package qcli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WatchdogModel is the emulated watchdog hardware model.
+type WatchdogModel string
+
+const (
+	// WatchdogI6300ESB is the Intel 6300ESB PCI watchdog.
+	WatchdogI6300ESB WatchdogModel = "i6300esb"
+
+	// WatchdogIB700 is the iBASE 700 ISA watchdog.
+	WatchdogIB700 WatchdogModel = "ib700"
+
+	// WatchdogDiag288 is the s390x diag288 watchdog.
+	WatchdogDiag288 WatchdogModel = "diag288"
+)
+
+// WatchdogAction is the action qemu takes when the watchdog timer expires.
+type WatchdogAction string
+
+const (
+	// WatchdogActionReset forcefully resets the guest.
+	WatchdogActionReset WatchdogAction = "reset"
+
+	// WatchdogActionShutdown attempts a graceful guest shutdown.
+	WatchdogActionShutdown WatchdogAction = "shutdown"
+
+	// WatchdogActionPoweroff forcefully powers off the guest.
+	WatchdogActionPoweroff WatchdogAction = "poweroff"
+
+	// WatchdogActionPause pauses the guest.
+	WatchdogActionPause WatchdogAction = "pause"
+
+	// WatchdogActionDebug prints a debug message and continues.
+	WatchdogActionDebug WatchdogAction = "debug"
+
+	// WatchdogActionNone does nothing.
+	WatchdogActionNone WatchdogAction = "none"
+)
+
+// WatchdogDevice represents a qemu watchdog device.
+type WatchdogDevice struct {
+	// ID is the device ID
+	ID string `yaml:"id"`
+
+	// Model is the watchdog hardware model.
+	Model WatchdogModel `yaml:"model"`
+
+	// Action is the action taken when the watchdog expires.
+	Action WatchdogAction `yaml:"action"`
+
+	// Bus is the bus path name of a this device.
+	Bus string `yaml:"bus"`
+
+	// Addr is the address offset of this device on the bus.
+	Addr string `yaml:"address"`
+}
+
+// Valid returns true if the WatchdogDevice structure is valid and complete.
+func (dev WatchdogDevice) Valid() error {
+	switch dev.Model {
+	case WatchdogI6300ESB, WatchdogIB700, WatchdogDiag288:
+	case "":
+		return fmt.Errorf("WatchdogDevice has empty Model field")
+	default:
+		return fmt.Errorf("WatchdogDevice has invalid Model field: %s", dev.Model)
+	}
+
+	switch dev.Action {
+	case "", WatchdogActionReset, WatchdogActionShutdown, WatchdogActionPoweroff,
+		WatchdogActionPause, WatchdogActionDebug, WatchdogActionNone:
+	default:
+		return fmt.Errorf("WatchdogDevice has invalid Action field: %s", dev.Action)
+	}
+
+	if dev.Model != WatchdogI6300ESB && (dev.Bus != "" || dev.Addr != "") {
+		return fmt.Errorf("WatchdogDevice model %s does not support Bus or Addr", dev.Model)
+	}
+
+	return nil
+}
+
+// QemuParams returns the qemu parameters built out of the WatchdogDevice.
+func (dev WatchdogDevice) QemuParams(config *Config) []string {
+	var qemuParams []string
+	var deviceParams []string
+
+	deviceParams = append(deviceParams, string(dev.Model))
+
+	if dev.ID != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("id=%s", dev.ID))
+	}
+
+	if dev.Bus != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf("bus=%s", dev.Bus))
+	}
+
+	// only the i6300esb is a pci device
+	if dev.Model == WatchdogI6300ESB {
+		addr := config.pciBusSlots.GetSlot(dev.Addr)
+		if addr > 0 {
+			deviceParams = append(deviceParams, fmt.Sprintf("addr=0x%02x", addr))
+		}
+	}
+
+	qemuParams = append(qemuParams, "-device")
+	qemuParams = append(qemuParams, strings.Join(deviceParams, ","))
+
+	// qemu has a single action for all the watchdogs, emit it once
+	if dev.Action != "" && config.watchdogAction == "" {
+		config.watchdogAction = dev.Action
+		qemuParams = append(qemuParams, "-watchdog-action")
+		qemuParams = append(qemuParams, string(dev.Action))
+	}
+
+	return qemuParams
+}
+
+// validateWatchdogs checks the watchdog devices do not ask for different
+// actions, qemu only has the one -watchdog-action.
+func (config *Config) validateWatchdogs() error {
+	var action WatchdogAction
+	for _, dev := range config.WatchdogDevices {
+		if dev.Action == "" {
+			continue
+		}
+		if action != "" && dev.Action != action {
+			return fmt.Errorf("WatchdogDevices have conflicting Action fields: %s and %s", action, dev.Action)
+		}
+		action = dev.Action
+	}
+
+	return nil
+}
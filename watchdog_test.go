@@ -0,0 +1,77 @@
+package qcli
+
+import (
+	"strings"
+	"testing"
+)
+
+var (
+	deviceWatchdogI6300ESBString = "-device i6300esb,id=watchdog0,bus=pcie.0,addr=0x05 -watchdog-action reset"
+	deviceWatchdogIB700String    = "-device ib700,id=watchdog0 -watchdog-action poweroff"
+	deviceWatchdogDiag288String  = "-device diag288"
+)
+
+func TestAppendWatchdogDevice(t *testing.T) {
+	wdt := WatchdogDevice{
+		ID:     "watchdog0",
+		Model:  WatchdogI6300ESB,
+		Action: WatchdogActionReset,
+		Bus:    "pcie.0",
+		Addr:   "5",
+	}
+	testAppend(wdt, deviceWatchdogI6300ESBString, t)
+
+	wdt = WatchdogDevice{
+		ID:     "watchdog0",
+		Model:  WatchdogIB700,
+		Action: WatchdogActionPoweroff,
+	}
+	testAppend(wdt, deviceWatchdogIB700String, t)
+
+	wdt = WatchdogDevice{
+		Model: WatchdogDiag288,
+	}
+	testAppend(wdt, deviceWatchdogDiag288String, t)
+}
+
+func TestBadWatchdogDevice(t *testing.T) {
+	bad := []WatchdogDevice{
+		{},
+		{Model: WatchdogModel("sp805")},
+		{Model: WatchdogI6300ESB, Action: WatchdogAction("explode")},
+		{Model: WatchdogIB700, Bus: "pcie.0"},
+	}
+
+	for _, wdt := range bad {
+		if err := wdt.Valid(); err == nil {
+			t.Errorf("Expected error for invalid WatchdogDevice %+v", wdt)
+		}
+	}
+}
+
+func TestWatchdogActionOnce(t *testing.T) {
+	c := &Config{
+		WatchdogDevices: []WatchdogDevice{
+			{Model: WatchdogI6300ESB, Action: WatchdogActionPause, Addr: "5"},
+			{Model: WatchdogIB700, Action: WatchdogActionPause},
+		},
+	}
+	params, err := ConfigureParams(c, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "-device i6300esb,addr=0x05 -watchdog-action pause -device ib700"
+	if result := strings.Join(params, " "); result != expected {
+		t.Errorf("Expected %q, found %q", expected, result)
+	}
+
+	c = &Config{
+		WatchdogDevices: []WatchdogDevice{
+			{Model: WatchdogI6300ESB, Action: WatchdogActionPause},
+			{Model: WatchdogIB700, Action: WatchdogActionReset},
+		},
+	}
+	if _, err := ConfigureParams(c, nil); err == nil {
+		t.Errorf("Expected error for conflicting watchdog actions")
+	}
+}